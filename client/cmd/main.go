@@ -18,6 +18,7 @@ import (
 
 	"gkipass/client/internal/app"
 	"gkipass/client/internal/config"
+	"gkipass/client/internal/logbuf"
 )
 
 const (
@@ -272,8 +273,12 @@ func setupLogger(level string) *zap.Logger {
 	// 配置输出
 	writeSyncer := zapcore.AddSync(os.Stdout)
 
-	// 创建核心
-	core := zapcore.NewCore(encoder, writeSyncer, zapLevel)
+	// 创建核心：级别可由面板远程命令调整，同时保留最近日志供面板拉取
+	logbuf.Level().SetLevel(zapLevel)
+	core := zapcore.NewTee(
+		zapcore.NewCore(encoder, writeSyncer, logbuf.Level()),
+		logbuf.NewCore(),
+	)
 
 	// 创建日志器
 	logger := zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
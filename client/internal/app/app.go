@@ -2,28 +2,39 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	"gkipass/client/internal/auth"
 	"gkipass/client/internal/cache"
+	"gkipass/client/internal/certificate"
+	"gkipass/client/internal/command"
 	"gkipass/client/internal/config"
 	"gkipass/client/internal/debug"
 	"gkipass/client/internal/diagnostics"
+	"gkipass/client/internal/handlers"
 	"gkipass/client/internal/identity"
+	"gkipass/client/internal/metrics"
+	"gkipass/client/internal/monitoring"
 	"gkipass/client/internal/optimizer"
 	"gkipass/client/internal/performance"
 	"gkipass/client/internal/plane"
 	"gkipass/client/internal/pool"
+	"gkipass/client/internal/ports"
 	"gkipass/client/internal/protocol"
 	"gkipass/client/internal/rules"
 	"gkipass/client/internal/tls"
+	"gkipass/client/internal/tracing"
 	"gkipass/client/internal/transport"
+	"gkipass/client/internal/tunnel"
+	"gkipass/client/internal/udp"
 )
 
 // Application 应用程序
@@ -37,6 +48,8 @@ type Application struct {
 	ruleManager         *rules.Manager
 	poolManager         *pool.Manager
 	protocolManager     *protocol.Manager
+	transportManager    *transport.Manager
+	certManager         *certificate.Manager
 	tlsManager          *tls.Manager
 	debugManager        *debug.Manager
 	diagnosticsManager  *diagnostics.Manager
@@ -45,6 +58,14 @@ type Application struct {
 	goroutineOptimizer  *optimizer.GoroutineOptimizer
 	cacheManager        *cache.SmartCache
 	trafficManager      *protocol.TrafficManager
+	portManager         *ports.Manager
+	udpManager          *udp.Manager
+	tunnelManager       *tunnel.Manager
+	monitorManager      *monitoring.Manager
+	metricsExporter     *metrics.Exporter
+	tracer              *tracing.Provider
+	commands            *command.Dispatcher
+	logStreams          *logStreamer
 	logger              *zap.Logger
 }
 
@@ -130,14 +151,38 @@ func (a *Application) initComponents() error {
 	}
 	a.poolManager = pool.NewPoolManagerWithConfig(poolConfig)
 
+	// 初始化节点证书管理器：使用持久化的节点身份（与面板注册的节点ID一致，相邻节点按该ID校验证书）
+	if err := a.identityManager.Initialize(); err != nil {
+		return fmt.Errorf("初始化节点身份失败: %w", err)
+	}
+	a.certManager, err = certificate.New(a.identityManager.GetNodeID(), a.cfg.Paths.CertDir)
+	if err != nil {
+		return fmt.Errorf("初始化证书管理器失败: %w", err)
+	}
+
 	// 初始化传输管理器（用于协议管理器）
-	transportManager, err := transport.New(nil)
+	a.transportManager, err = transport.New(nil)
 	if err != nil {
 		return fmt.Errorf("初始化传输管理器失败: %w", err)
 	}
+	if kcpCfg := a.cfg.Transport.KCP; kcpCfg != nil {
+		transportKCP, err := buildKCPConfig(kcpCfg)
+		if err == nil {
+			err = a.transportManager.ConfigureKCP(transportKCP)
+		}
+		if err != nil {
+			return fmt.Errorf("配置KCP传输失败: %w", err)
+		}
+	}
+	if err := a.transportManager.ConfigureQUIC(buildQUICConfig(a.cfg.Transport.QUIC), a.certManager.GetTLSConfig, a.certManager.ClientTLSConfig); err != nil {
+		return fmt.Errorf("配置QUIC传输失败: %w", err)
+	}
+	if err := a.transportManager.ConfigureTLSMux(buildTLSMuxConfig(a.cfg.Transport.TLSMux), a.certManager.GetTLSConfig, a.certManager.ClientTLSConfig); err != nil {
+		return fmt.Errorf("配置TLS多路复用传输失败: %w", err)
+	}
 
 	// 初始化协议管理器
-	a.protocolManager, err = protocol.New(transportManager)
+	a.protocolManager, err = protocol.New(a.transportManager)
 	if err != nil {
 		return fmt.Errorf("初始化协议管理器失败: %w", err)
 	}
@@ -215,18 +260,156 @@ func (a *Application) initComponents() error {
 	// 初始化流量管理器
 	a.trafficManager = protocol.NewTrafficManager()
 
+	// 初始化隧道运行时（面板下发规则 -> 端口监听 -> 协议处理器/转发器）
+	portConfig := ports.DefaultManagerConfig()
+	portConfig.ScanEnabled = false
+	a.portManager = ports.NewManager(portConfig)
+	a.udpManager = udp.NewManager(nil)
+	tunnelConfig := tunnel.DefaultManagerConfig()
+	tunnelConfig.NodeID = a.identityManager.GetNodeID()
+	a.tunnelManager = tunnel.NewManager(tunnelConfig, a.portManager, a.udpManager, a.transportManager, handlers.NewCredentialStore())
+	a.tunnelManager.SetTrafficReporter(func(report *protocol.TrafficReportRequest) error {
+		report.NodeID = a.identityManager.GetNodeID()
+		return a.planeManager.SendMessage("traffic_report", report)
+	})
+	a.tunnelManager.SetFailoverReporter(func(event *protocol.FailoverEventReport) error {
+		event.NodeID = a.identityManager.GetNodeID()
+		return a.planeManager.SendMessage("failover_event", event)
+	})
+	a.tunnelManager.SetPeerTrust(a.certManager)
+	a.planeManager.SetRulesVersionProvider(a.tunnelManager.Version)
+	a.planeManager.SetCertPin(a.certManager.CAPin())
+	a.registerPlaneHandlers()
+
+	// 初始化本地 Prometheus 指标端点（可选）
+	if a.cfg.Monitoring.EnableMetrics {
+		a.monitorManager, err = monitoring.New()
+		if err != nil {
+			return fmt.Errorf("初始化监控管理器失败: %w", err)
+		}
+		a.metricsExporter = metrics.NewExporter(&metrics.Config{
+			ListenAddr: a.cfg.Monitoring.MetricsAddr,
+			Port:       a.cfg.Monitoring.MetricsPort,
+		}, a.monitorManager, a.poolManager, a.tunnelManager)
+	}
+
+	// 初始化链路追踪（可选）：面板下发的规则同步在本节点的应用过程作为面板链路的子 span 导出
+	if a.cfg.Tracing != nil && a.cfg.Tracing.Enabled {
+		a.tracer, err = tracing.Setup(&tracing.Config{
+			Exporter:    a.cfg.Tracing.Exporter,
+			Endpoint:    a.cfg.Tracing.Endpoint,
+			Insecure:    a.cfg.Tracing.Insecure,
+			FilePath:    a.cfg.Tracing.FilePath,
+			SampleRatio: a.cfg.Tracing.SampleRatio,
+			ServiceName: a.cfg.Tracing.ServiceName,
+		}, a.identityManager.GetNodeID())
+		if err != nil {
+			return fmt.Errorf("初始化链路追踪失败: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// registerPlaneHandlers 注册面板下发消息的处理器
+func (a *Application) registerPlaneHandlers() {
+	a.planeManager.RegisterHandler("sync_rules", func(msg *plane.Message) (err error) {
+		// 接续面板推送时的链路，确认和补发请求也携带该链路
+		ctx, span := tracing.Start(tracing.Extract(a.ctx, msg.Trace), "node.SyncRules",
+			attribute.String("gkipass.message.id", msg.ID))
+		defer func() { tracing.End(span, err) }()
+
+		var req protocol.SyncRulesRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return fmt.Errorf("解析同步规则失败: %w", err)
+		}
+
+		// 增量起点超过本地版本说明中间有变更未收到，请求面板从本地版本补发
+		if a.tunnelManager.NeedsResync(&req) {
+			span.SetAttributes(attribute.Bool("gkipass.sync.resync_requested", true))
+			return a.planeManager.SendMessageContext(ctx, "sync_request", &protocol.SyncRequest{
+				SinceVersion: a.tunnelManager.Version(),
+			})
+		}
+
+		resp := a.tunnelManager.ApplyRules(ctx, &req)
+		ack := &protocol.SyncAckRequest{
+			Version:      resp.Version,
+			Success:      resp.Success,
+			AppliedCount: resp.AppliedCount,
+			FailedRules:  resp.FailedRules,
+			Message:      resp.Message,
+		}
+		if err := a.planeManager.SendMessageContext(ctx, "sync_ack", ack); err != nil {
+			a.logger.Warn("发送规则同步确认失败", zap.Int64("version", resp.Version), zap.Error(err))
+		}
+		if !resp.Success {
+			return fmt.Errorf("同步规则失败: %s (%v)", resp.Message, resp.FailedRules)
+		}
+		return nil
+	})
+
+	a.planeManager.RegisterHandler("delete_rule", func(msg *plane.Message) (err error) {
+		_, span := tracing.Start(tracing.Extract(a.ctx, msg.Trace), "node.DeleteRule",
+			attribute.String("gkipass.message.id", msg.ID))
+		defer func() { tracing.End(span, err) }()
+
+		var req protocol.DeleteRuleRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return fmt.Errorf("解析删除规则失败: %w", err)
+		}
+		span.SetAttributes(attribute.String("gkipass.tunnel.id", req.TunnelID))
+		return a.tunnelManager.DeleteRule(req.TunnelID)
+	})
+
+	// 流量上报与容灾事件的确认无需处理
+	a.planeManager.RegisterHandler("traffic_report", func(msg *plane.Message) error {
+		return nil
+	})
+	a.planeManager.RegisterHandler("failover_event_ack", func(msg *plane.Message) error {
+		return nil
+	})
+
+	// 远程命令：只执行白名单内的命令，结果按请求ID回传
+	a.commands = a.newCommandDispatcher()
+	a.planeManager.RegisterHandler(string(protocol.MessageTypeCommand), a.handleCommand)
+
+	// 实时日志：面板订阅后按条件推送，面板停止续租后自动结束
+	a.logStreams = newLogStreamer(a)
+	a.planeManager.RegisterHandler("log_stream_start", a.logStreams.handleStart)
+	a.planeManager.RegisterHandler("log_stream_stop", a.logStreams.handleStop)
+}
+
 // Start 启动应用程序
 func (a *Application) Start() error {
 	a.logger.Info("正在启动应用程序...")
 
+	// 启动证书管理器
+	if err := a.certManager.Start(); err != nil {
+		return fmt.Errorf("启动证书管理器失败: %w", err)
+	}
+
+	// 启动传输管理器
+	if err := a.transportManager.Start(); err != nil {
+		return fmt.Errorf("启动传输管理器失败: %w", err)
+	}
+
 	// 启动认证管理器
 	if err := a.authManager.Start(); err != nil {
 		return fmt.Errorf("启动认证管理器失败: %w", err)
 	}
 
+	// 启动隧道运行时（先于面板连接，确保首次同步的规则可以落地）
+	if err := a.portManager.Start(); err != nil {
+		return fmt.Errorf("启动端口管理器失败: %w", err)
+	}
+	if err := a.udpManager.Start(); err != nil {
+		return fmt.Errorf("启动UDP会话管理器失败: %w", err)
+	}
+	if err := a.tunnelManager.Start(); err != nil {
+		return fmt.Errorf("启动隧道运行时失败: %w", err)
+	}
+
 	// 启动Plane管理器
 	if err := a.planeManager.Start(); err != nil {
 		return fmt.Errorf("启动Plane管理器失败: %w", err)
@@ -289,6 +472,16 @@ func (a *Application) Start() error {
 		return fmt.Errorf("启动流量管理器失败: %w", err)
 	}
 
+	// 启动本地指标端点
+	if a.metricsExporter != nil {
+		if err := a.monitorManager.Start(); err != nil {
+			return fmt.Errorf("启动监控管理器失败: %w", err)
+		}
+		if err := a.metricsExporter.Start(); err != nil {
+			return fmt.Errorf("启动指标端点失败: %w", err)
+		}
+	}
+
 	a.logger.Info("应用程序已启动")
 
 	return nil
@@ -311,6 +504,16 @@ func (a *Application) Stop() error {
 		{"诊断管理器", a.diagnosticsManager.Stop},
 	}
 
+	if a.metricsExporter != nil {
+		stopComponents = append(stopComponents, struct {
+			name string
+			stop func() error
+		}{"指标端点", a.metricsExporter.Stop}, struct {
+			name string
+			stop func() error
+		}{"监控管理器", a.monitorManager.Stop})
+	}
+
 	if a.debugManager != nil {
 		stopComponents = append(stopComponents, struct {
 			name string
@@ -339,10 +542,30 @@ func (a *Application) Stop() error {
 			name string
 			stop func() error
 		}{"Plane管理器", a.planeManager.Stop},
+		struct {
+			name string
+			stop func() error
+		}{"隧道运行时", a.tunnelManager.Stop},
+		struct {
+			name string
+			stop func() error
+		}{"UDP会话管理器", a.udpManager.Stop},
+		struct {
+			name string
+			stop func() error
+		}{"端口管理器", a.portManager.Stop},
 		struct {
 			name string
 			stop func() error
 		}{"认证管理器", a.authManager.Stop},
+		struct {
+			name string
+			stop func() error
+		}{"传输管理器", a.transportManager.Stop},
+		struct {
+			name string
+			stop func() error
+		}{"证书管理器", a.certManager.Stop},
 	)
 
 	// 停止所有组件
@@ -352,6 +575,13 @@ func (a *Application) Stop() error {
 		}
 	}
 
+	// 最后关闭链路追踪，导出停止过程中产生的 span
+	if a.tracer != nil {
+		if err := a.tracer.Stop(); err != nil {
+			a.logger.Error("停止链路追踪失败", zap.Error(err))
+		}
+	}
+
 	// 取消上下文
 	a.cancel()
 
@@ -406,6 +636,7 @@ func (a *Application) GetStatus() map[string]interface{} {
 			"plane":       a.planeManager.GetStatus(),
 			"pool":        a.poolManager.GetStats(),
 			"protocol":    a.protocolManager.GetStats(),
+			"transport":   a.transportManager.GetStats(),
 			"tls":         a.tlsManager.GetStatus(),
 			"diagnostics": a.diagnosticsManager.GetStats(),
 			"performance": a.performanceAnalyzer.GetStats(),
@@ -413,6 +644,7 @@ func (a *Application) GetStatus() map[string]interface{} {
 			"goroutine":   a.goroutineOptimizer.GetStats(),
 			"cache":       a.cacheManager.GetStats(),
 			"traffic":     a.trafficManager.GetStats(),
+			"tunnel":      a.tunnelManager.GetStats(),
 		},
 	}
 
@@ -422,3 +654,92 @@ func (a *Application) GetStatus() map[string]interface{} {
 
 	return status
 }
+
+// buildKCPConfig 将配置文件中的KCP设置合并到默认KCP参数
+// FEC数据分片与校验分片只设置其一时返回配置错误，而不是静默关闭FEC
+func buildKCPConfig(cfg *config.KCPConfig) (*transport.KCPConfig, error) {
+	kcpCfg := transport.DefaultKCPConfig()
+	if cfg.Profile != "" {
+		kcpCfg.Profile = cfg.Profile
+	}
+	if cfg.Profile == "manual" {
+		kcpCfg.NoDelay = cfg.NoDelay
+		if cfg.Interval > 0 {
+			kcpCfg.Interval = cfg.Interval
+		}
+		kcpCfg.Resend = cfg.Resend
+		kcpCfg.NoCongestion = cfg.NoCongestion
+	}
+	if cfg.MTU > 0 {
+		kcpCfg.MTU = cfg.MTU
+	}
+	if cfg.SndWnd > 0 {
+		kcpCfg.SndWnd = cfg.SndWnd
+	}
+	if cfg.RcvWnd > 0 {
+		kcpCfg.RcvWnd = cfg.RcvWnd
+	}
+	if !cfg.NoFEC && (cfg.DataShards > 0) != (cfg.ParityShards > 0) {
+		return nil, fmt.Errorf("FEC数据分片数(%d)与校验分片数(%d)必须同时设置", cfg.DataShards, cfg.ParityShards)
+	}
+	if cfg.DataShards > 0 && cfg.ParityShards > 0 {
+		kcpCfg.DataShards = cfg.DataShards
+		kcpCfg.ParityShards = cfg.ParityShards
+	}
+	if cfg.NoFEC {
+		kcpCfg.DataShards = 0
+		kcpCfg.ParityShards = 0
+	}
+	if cfg.SockBuf > 0 {
+		kcpCfg.SockBuf = cfg.SockBuf
+	}
+	kcpCfg.AckNoDelay = cfg.AckNoDelay
+	return kcpCfg, nil
+}
+
+// buildQUICConfig 将配置文件中的QUIC设置合并到默认QUIC参数
+func buildQUICConfig(cfg *config.QUICConfig) *transport.QUICConfig {
+	quicCfg := transport.DefaultQUICConfig()
+	if cfg == nil {
+		return quicCfg
+	}
+	if cfg.ALPN != "" {
+		quicCfg.ALPN = cfg.ALPN
+	}
+	if cfg.MaxIdleTimeout > 0 {
+		quicCfg.MaxIdleTimeout = cfg.MaxIdleTimeout
+	}
+	if cfg.KeepAlivePeriod > 0 {
+		quicCfg.KeepAlivePeriod = cfg.KeepAlivePeriod
+	}
+	if cfg.MaxIncomingStreams > 0 {
+		quicCfg.MaxIncomingStreams = cfg.MaxIncomingStreams
+	}
+	quicCfg.Allow0RTT = !cfg.Disable0RTT
+	quicCfg.EnableMigration = !cfg.DisableMigration
+	return quicCfg
+}
+
+// buildTLSMuxConfig 将配置文件中的TLS多路复用设置合并到默认参数
+func buildTLSMuxConfig(cfg *config.TLSMuxConfig) *transport.TLSMuxConfig {
+	muxCfg := transport.DefaultTLSMuxConfig()
+	if cfg == nil {
+		return muxCfg
+	}
+	if cfg.ConnsPerPeer > 0 {
+		muxCfg.ConnsPerPeer = cfg.ConnsPerPeer
+	}
+	if cfg.StreamsPerConn > 0 {
+		muxCfg.StreamsPerConn = cfg.StreamsPerConn
+	}
+	if cfg.InitialWindow > 0 {
+		muxCfg.InitialWindow = cfg.InitialWindow
+	}
+	if cfg.DrainTimeout > 0 {
+		muxCfg.DrainTimeout = cfg.DrainTimeout
+	}
+	if cfg.PingInterval > 0 {
+		muxCfg.PingInterval = cfg.PingInterval
+	}
+	return muxCfg
+}
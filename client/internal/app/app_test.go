@@ -0,0 +1,30 @@
+package app
+
+import (
+	"testing"
+
+	"gkipass/client/internal/config"
+)
+
+// TestBuildKCPConfig 只设置一种FEC分片数返回配置错误，manual模式使用配置文件中的手动参数
+func TestBuildKCPConfig(t *testing.T) {
+	for _, cfg := range []*config.KCPConfig{{DataShards: 10}, {ParityShards: 3}} {
+		if _, err := buildKCPConfig(cfg); err == nil {
+			t.Errorf("FEC %d+%d 应返回配置错误", cfg.DataShards, cfg.ParityShards)
+		}
+	}
+	if _, err := buildKCPConfig(&config.KCPConfig{DataShards: 10, NoFEC: true}); err != nil {
+		t.Errorf("关闭FEC时不应校验分片数: %v", err)
+	}
+
+	kcpCfg, err := buildKCPConfig(&config.KCPConfig{Profile: "manual", NoDelay: 1, Interval: 15, Resend: 3, NoCongestion: 1})
+	if err != nil {
+		t.Fatalf("构建manual配置失败: %v", err)
+	}
+	if err := kcpCfg.Validate(); err != nil {
+		t.Fatalf("manual配置应通过校验: %v", err)
+	}
+	if kcpCfg.NoDelay != 1 || kcpCfg.Interval != 15 || kcpCfg.Resend != 3 || kcpCfg.NoCongestion != 1 {
+		t.Errorf("manual模式应使用配置的手动参数，实际 %+v", kcpCfg)
+	}
+}
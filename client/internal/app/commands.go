@@ -0,0 +1,159 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"gkipass/client/internal/command"
+	"gkipass/client/internal/logbuf"
+	"gkipass/client/internal/plane"
+	"gkipass/client/internal/probe"
+	"gkipass/client/internal/protocol"
+	"gkipass/client/internal/tracing"
+)
+
+const (
+	maxGoroutineDump = 256 << 10 // 协程堆栈最多回传 256KB（面板单条消息上限 512KB）
+	maxProbeCount    = 5
+	maxFetchLogs     = 1000
+)
+
+// newCommandDispatcher 注册面板可下发的远程命令
+func (a *Application) newCommandDispatcher() *command.Dispatcher {
+	d := command.NewDispatcher()
+
+	// 请求面板全量下发规则，应用结果通过 sync_ack 上报
+	d.Register(command.ReloadRules, func(ctx context.Context, _ map[string]interface{}) (map[string]interface{}, error) {
+		if err := a.planeManager.SendMessageContext(ctx, "sync_request", &protocol.SyncRequest{SinceVersion: 0}); err != nil {
+			return nil, fmt.Errorf("请求全量同步失败: %w", err)
+		}
+		return map[string]interface{}{
+			"previous_version": a.tunnelManager.Version(),
+		}, nil
+	})
+
+	d.Register(command.RestartListener, func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+		tunnelID := command.StringParam(params, "tunnel_id")
+		if tunnelID == "" {
+			return nil, fmt.Errorf("缺少参数 tunnel_id")
+		}
+		if err := a.tunnelManager.RestartRule(ctx, tunnelID); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"tunnel_id": tunnelID}, nil
+	})
+
+	d.Register(command.DumpGoroutines, func(context.Context, map[string]interface{}) (map[string]interface{}, error) {
+		var buf bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+			return nil, fmt.Errorf("导出协程堆栈失败: %w", err)
+		}
+		truncated := buf.Len() > maxGoroutineDump
+		if truncated {
+			buf.Truncate(maxGoroutineDump)
+		}
+		return map[string]interface{}{
+			"goroutines": runtime.NumGoroutine(),
+			"stacks":     buf.String(),
+			"truncated":  truncated,
+		}, nil
+	})
+
+	d.Register(command.RotateCert, func(context.Context, map[string]interface{}) (map[string]interface{}, error) {
+		info, err := a.certManager.Rotate()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"serial_number": info.SerialNumber,
+			"fingerprint":   info.Fingerprint,
+			"not_after":     info.NotAfter,
+		}, nil
+	})
+
+	d.Register(command.RunProbe, func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+		options := probe.DefaultProbeOptions()
+		options.Target = command.StringParam(params, "target")
+		if t := command.StringParam(params, "type"); t != "" {
+			options.Type = probe.ProbeType(t)
+		}
+		options.Count = command.IntParam(params, "count", 3)
+		if options.Count > maxProbeCount {
+			options.Count = maxProbeCount
+		}
+
+		// Probe 在上下文取消后提前返回会导致仍在执行的探测写入已关闭的通道，
+		// 这里不传递取消，由次数上限和单次超时约束总耗时
+		pm := probe.NewProbeManager()
+		results, err := pm.Probe(context.WithoutCancel(ctx), options)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"results": results,
+			"summary": pm.AnalyzeResults(results),
+		}, nil
+	})
+
+	d.Register(command.FetchLogs, func(_ context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+		limit := command.IntParam(params, "limit", 200)
+		if limit <= 0 || limit > maxFetchLogs {
+			limit = maxFetchLogs
+		}
+		entries, err := logbuf.Recent(limit, command.StringParam(params, "level"))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"entries": entries,
+			"count":   len(entries),
+		}, nil
+	})
+
+	d.Register(command.SetLogLevel, func(_ context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+		level := command.StringParam(params, "level")
+		previous, err := logbuf.SetLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		a.logger.Info("日志级别已修改", zap.String("previous", previous), zap.String("level", level))
+		return map[string]interface{}{
+			"previous": previous,
+			"level":    logbuf.Level().Level().String(),
+		}, nil
+	})
+
+	return d
+}
+
+// handleCommand 处理面板下发的远程命令：在独立协程中执行，避免阻塞消息读取，结束后回传 command_result
+func (a *Application) handleCommand(msg *plane.Message) error {
+	var cmd protocol.Command
+	if err := json.Unmarshal(msg.Data, &cmd); err != nil {
+		return fmt.Errorf("解析远程命令失败: %w", err)
+	}
+
+	go func() {
+		ctx, span := tracing.Start(tracing.Extract(a.ctx, msg.Trace), "node.Command",
+			attribute.String("gkipass.command", cmd.Command),
+			attribute.String("gkipass.command.id", cmd.RequestID))
+		defer span.End()
+
+		result := a.commands.Handle(ctx, &cmd)
+		span.SetAttributes(attribute.String("gkipass.command.status", result.Status))
+		if err := a.planeManager.SendMessageContext(ctx, string(protocol.MessageTypeCommandResult), result); err != nil {
+			a.logger.Warn("回传命令结果失败",
+				zap.String("request_id", cmd.RequestID),
+				zap.String("command", cmd.Command),
+				zap.Error(err))
+		}
+	}()
+	return nil
+}
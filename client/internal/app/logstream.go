@@ -0,0 +1,238 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gkipass/client/internal/logbuf"
+	"gkipass/client/internal/plane"
+)
+
+const (
+	logStreamLease      = 90 * time.Second       // 面板每 30 秒续租，超过该时长未续租则停止推送
+	logStreamFlush      = 500 * time.Millisecond // 批量推送间隔
+	logStreamBatchSize  = 200                    // 单批最多条数
+	logStreamRateLimit  = 200                    // 每个订阅每秒最多推送的条数，超出部分丢弃并计数
+	logStreamBuffer     = 1024                   // 订阅缓冲的条数，推送不及时时丢弃
+	logStreamMaxStreams = 8                      // 同时存在的订阅数
+	logStreamMaxBacklog = 500
+)
+
+// logStreamStart 面板开始或续租日志订阅
+type logStreamStart struct {
+	StreamID  string   `json:"stream_id"`
+	Level     string   `json:"level,omitempty"`
+	TunnelIDs []string `json:"tunnel_ids,omitempty"`
+	Backlog   int      `json:"backlog,omitempty"`
+}
+
+// logStreamStop 面板结束日志订阅
+type logStreamStop struct {
+	StreamID string `json:"stream_id"`
+}
+
+// logStreamBatch 推送给面板的一批日志
+type logStreamBatch struct {
+	StreamID string         `json:"stream_id"`
+	Entries  []logbuf.Entry `json:"entries"`
+	Dropped  int64          `json:"dropped,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// logStream 一个面板日志订阅
+type logStream struct {
+	id    string
+	sub   *logbuf.Subscription
+	lease time.Time
+	stop  chan struct{}
+	once  sync.Once
+}
+
+func (s *logStream) close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// logStreamer 按面板订阅把本节点日志实时推送到面板：按级别和隧道过滤、批量发送、限速，
+// 面板停止续租（订阅方关闭、实例宕机）后自动结束
+type logStreamer struct {
+	app     *Application
+	streams map[string]*logStream
+	mutex   sync.Mutex
+	logger  *zap.Logger
+}
+
+func newLogStreamer(app *Application) *logStreamer {
+	return &logStreamer{
+		app:     app,
+		streams: make(map[string]*logStream),
+		logger:  zap.L().Named("log-stream"),
+	}
+}
+
+// handleStart 处理 log_stream_start：已存在的订阅只续租
+func (l *logStreamer) handleStart(msg *plane.Message) error {
+	var req logStreamStart
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		return fmt.Errorf("解析日志订阅失败: %w", err)
+	}
+	if req.StreamID == "" {
+		return fmt.Errorf("日志订阅缺少 stream_id")
+	}
+
+	l.mutex.Lock()
+	if stream, ok := l.streams[req.StreamID]; ok {
+		stream.lease = time.Now().Add(logStreamLease)
+		l.mutex.Unlock()
+		return nil
+	}
+	if len(l.streams) >= logStreamMaxStreams {
+		l.mutex.Unlock()
+		return l.reject(req.StreamID, "节点日志订阅数已达上限")
+	}
+
+	filter := logbuf.Filter{MinLevel: logbuf.Level().Level()}
+	if req.Level != "" {
+		lvl, err := logbuf.ParseLevel(req.Level)
+		if err != nil {
+			l.mutex.Unlock()
+			return l.reject(req.StreamID, err.Error())
+		}
+		filter.MinLevel = lvl
+	}
+	if len(req.TunnelIDs) > 0 {
+		filter.TunnelIDs = make(map[string]bool, len(req.TunnelIDs))
+		for _, id := range req.TunnelIDs {
+			filter.TunnelIDs[id] = true
+		}
+	}
+
+	stream := &logStream{
+		id:    req.StreamID,
+		sub:   logbuf.Subscribe(filter, logStreamBuffer),
+		lease: time.Now().Add(logStreamLease),
+		stop:  make(chan struct{}),
+	}
+	l.streams[req.StreamID] = stream
+	l.mutex.Unlock()
+
+	backlog := req.Backlog
+	if backlog > logStreamMaxBacklog {
+		backlog = logStreamMaxBacklog
+	}
+	var recent []logbuf.Entry
+	if backlog > 0 {
+		recent = logbuf.RecentMatching(backlog, filter)
+	}
+
+	l.logger.Info("开始推送日志",
+		zap.String("stream_id", req.StreamID),
+		zap.String("level", filter.MinLevel.String()),
+		zap.Strings("tunnel_ids", req.TunnelIDs))
+
+	go l.run(stream, recent)
+	return nil
+}
+
+// handleStop 处理 log_stream_stop
+func (l *logStreamer) handleStop(msg *plane.Message) error {
+	var req logStreamStop
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		return fmt.Errorf("解析日志订阅失败: %w", err)
+	}
+
+	l.mutex.Lock()
+	stream, ok := l.streams[req.StreamID]
+	l.mutex.Unlock()
+	if ok {
+		stream.close()
+	}
+	return nil
+}
+
+// reject 通知面板订阅被拒绝
+func (l *logStreamer) reject(streamID, reason string) error {
+	return l.app.planeManager.SendMessage("log_stream", &logStreamBatch{StreamID: streamID, Error: reason})
+}
+
+// run 批量推送订阅的日志，直到面板结束订阅、续租过期或应用停止
+func (l *logStreamer) run(stream *logStream, backlog []logbuf.Entry) {
+	defer func() {
+		stream.sub.Close()
+		l.mutex.Lock()
+		delete(l.streams, stream.id)
+		l.mutex.Unlock()
+		l.logger.Info("停止推送日志", zap.String("stream_id", stream.id))
+	}()
+
+	var dropped int64
+	pending := make([]logbuf.Entry, 0, logStreamBatchSize)
+	flush := func() {
+		dropped += stream.sub.TakeDropped()
+		if len(pending) == 0 && dropped == 0 {
+			return
+		}
+		batch := &logStreamBatch{StreamID: stream.id, Entries: pending, Dropped: dropped}
+		if err := l.app.planeManager.SendMessage("log_stream", batch); err != nil {
+			// 面板连接中断期间的日志直接丢弃，重连后由续租恢复推送
+			dropped += int64(len(pending))
+		} else {
+			dropped = 0
+		}
+		pending = make([]logbuf.Entry, 0, logStreamBatchSize)
+	}
+
+	for len(backlog) > 0 {
+		n := len(backlog)
+		if n > logStreamBatchSize {
+			n = logStreamBatchSize
+		}
+		pending = append(pending, backlog[:n]...)
+		backlog = backlog[n:]
+		flush()
+	}
+
+	ticker := time.NewTicker(logStreamFlush)
+	defer ticker.Stop()
+	windowStart, windowCount := time.Now(), 0
+
+	for {
+		select {
+		case entry, ok := <-stream.sub.C:
+			if !ok {
+				return
+			}
+			if time.Since(windowStart) >= time.Second {
+				windowStart, windowCount = time.Now(), 0
+			}
+			if windowCount >= logStreamRateLimit {
+				dropped++
+				continue
+			}
+			windowCount++
+			pending = append(pending, entry)
+			if len(pending) >= logStreamBatchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			l.mutex.Lock()
+			expired := time.Now().After(stream.lease)
+			l.mutex.Unlock()
+			if expired {
+				return
+			}
+			flush()
+
+		case <-stream.stop:
+			flush()
+			return
+
+		case <-l.app.ctx.Done():
+			return
+		}
+	}
+}
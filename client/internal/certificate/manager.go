@@ -1,6 +1,7 @@
 package certificate
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
@@ -12,6 +13,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"math/big"
+	"net"
 	"os"
 	"path/filepath"
 	"sync"
@@ -70,15 +72,30 @@ type Manager struct {
 
 	// PIN验证列表 (SPKI hashes)
 	trustedPins map[string]bool
+
+	// 链路上相邻节点的CA证书固定（按规则登记）
+	peers map[string][]Peer
+}
+
+// Peer 链路上相邻节点的证书信息（面板在规则中下发）
+// 各节点使用自己生成的CA签发节点证书，节点间以CA公钥的SPKI固定互相信任
+type Peer struct {
+	Host    string // 节点隧道地址（不含端口）
+	NodeID  string // 节点ID，连接该节点时作为 ServerName 并校验节点证书
+	CertPin string // 节点CA公钥的 SPKI SHA-256（base64），即对端 CAPin 的返回值
 }
 
-// New 创建证书管理器
+// New 创建证书管理器，nodeID 为空时返回错误
 func New(nodeID, certDir string) (*Manager, error) {
+	if nodeID == "" {
+		return nil, fmt.Errorf("节点ID为空")
+	}
 	manager := &Manager{
 		nodeID:      nodeID,
 		certDir:     certDir,
 		logger:      zap.L().Named("certificate"),
 		trustedPins: make(map[string]bool),
+		peers:       make(map[string][]Peer),
 	}
 
 	// 确保证书目录存在
@@ -199,7 +216,7 @@ func (m *Manager) generateCA(certPath, keyPath string) error {
 			Locality:      []string{""},
 			StreetAddress: []string{""},
 			PostalCode:    []string{""},
-			CommonName:    fmt.Sprintf("GKIPass-Node-CA-%s", m.nodeID[:8]),
+			CommonName:    fmt.Sprintf("GKIPass-Node-CA-%s", shortNodeID(m.nodeID)),
 		},
 		NotBefore:             time.Now(),
 		NotAfter:              time.Now().AddDate(0, 0, CACertValidDays),
@@ -253,6 +270,8 @@ func (m *Manager) loadOrGenerateNodeCert() error {
 		// 检查证书是否需要更新
 		if m.needsRenewal(m.nodeCert) {
 			m.logger.Info("节点证书需要更新", zap.Time("expires", m.nodeCert.NotAfter))
+		} else if m.nodeCert.VerifyHostname(m.nodeID) != nil {
+			m.logger.Info("节点ID已变化，重新签发节点证书", zap.String("node_id", m.nodeID))
 		} else {
 			m.logger.Info("使用现有节点证书", zap.Time("expires", m.nodeCert.NotAfter))
 			return nil
@@ -390,19 +409,14 @@ func (m *Manager) buildTLSConfig() error {
 		Leaf:        m.nodeCert,
 	}
 
-	// 创建CA证书池
-	caCertPool := x509.NewCertPool()
-	caCertPool.AddCert(m.caCert)
-
-	// 构建TLS配置
+	// 构建TLS配置：各节点的CA互不相同，不使用系统根证书校验，
+	// 对端证书链在 VerifyConnection 中按本节点CA或面板下发的对端CA固定校验
 	m.tlsConfig = &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		ClientCAs:    caCertPool,
-		RootCAs:      caCertPool,
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-		ServerName:   m.nodeID,
-		MinVersion:   tls.VersionTLS12,
-		MaxVersion:   tls.VersionTLS13,
+		Certificates:       []tls.Certificate{cert},
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+		MaxVersion:         tls.VersionTLS13,
 		CipherSuites: []uint16{
 			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
@@ -416,14 +430,68 @@ func (m *Manager) buildTLSConfig() error {
 	return nil
 }
 
-// verifyConnection 自定义证书验证（PIN验证）
+// ClientTLSConfig 连接指定对端地址时的TLS配置
+// 对端已登记时以其节点ID作为 ServerName，并要求证书由该节点的CA签发；未登记时接受任一已信任的节点CA
+func (m *Manager) ClientTLSConfig(address string) *tls.Config {
+	conf := m.GetTLSConfig()
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+
+	peer, ok := m.lookupPeer(host)
+	if !ok {
+		conf.ServerName = host
+		return conf
+	}
+	conf.ServerName = peer.NodeID
+	if conf.ServerName == "" {
+		conf.ServerName = host
+	}
+	conf.VerifyConnection = func(cs tls.ConnectionState) error {
+		return m.verifyPeer(cs, &peer)
+	}
+	return conf
+}
+
+// verifyConnection 自定义证书验证（节点CA固定 + PIN验证）
 func (m *Manager) verifyConnection(cs tls.ConnectionState) error {
+	return m.verifyPeer(cs, nil)
+}
+
+// verifyPeer 校验对端证书链：签发CA须为本节点CA或已登记的对端CA，
+// expected 非空时CA须与该对端的固定一致，且节点证书须包含其节点ID
+func (m *Manager) verifyPeer(cs tls.ConnectionState, expected *Peer) error {
 	if len(cs.PeerCertificates) == 0 {
 		return fmt.Errorf("没有对等证书")
 	}
 
-	// 计算证书的SPKI hash
 	cert := cs.PeerCertificates[0]
+	var issuer *x509.Certificate
+	for _, ca := range cs.PeerCertificates[1:] {
+		if ca.IsCA && m.trustedCA(ca, expected) {
+			issuer = ca
+			break
+		}
+	}
+	if issuer == nil {
+		return fmt.Errorf("对端证书不是由信任的节点CA签发: %s", cert.Subject.CommonName)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(issuer)
+	opts := x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if expected != nil {
+		opts.DNSName = expected.NodeID
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		return fmt.Errorf("对端证书验证失败: %w", err)
+	}
+
+	// 计算证书的SPKI hash
 	spkiHash := m.calculateSPKI(cert)
 
 	// 如果有PIN列表，进行PIN验证
@@ -444,6 +512,75 @@ func (m *Manager) verifyConnection(cs tls.ConnectionState) error {
 	return nil
 }
 
+// trustedCA 判断CA是否可信：本节点CA始终可信，否则须与已登记的对端CA固定一致
+func (m *Manager) trustedCA(ca *x509.Certificate, expected *Peer) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.caCert != nil && bytes.Equal(ca.Raw, m.caCert.Raw) {
+		return true
+	}
+	pin := m.calculateSPKI(ca)
+	if expected != nil && expected.CertPin != "" {
+		return pin == expected.CertPin
+	}
+	for _, peers := range m.peers {
+		for _, peer := range peers {
+			if peer.CertPin == pin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lookupPeer 按地址查找已登记的对端
+func (m *Manager) lookupPeer(host string) (Peer, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, peers := range m.peers {
+		for _, peer := range peers {
+			if peer.Host == host {
+				return peer, true
+			}
+		}
+	}
+	return Peer{}, false
+}
+
+// SetPeers 登记（替换）owner（如隧道规则）信任的对端节点，未携带证书固定的对端被忽略
+func (m *Manager) SetPeers(owner string, peers []Peer) {
+	trusted := make([]Peer, 0, len(peers))
+	for _, peer := range peers {
+		if peer.Host != "" && peer.CertPin != "" {
+			trusted = append(trusted, peer)
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(trusted) == 0 {
+		delete(m.peers, owner)
+		return
+	}
+	m.peers[owner] = trusted
+}
+
+// RemovePeers 移除 owner 登记的对端节点
+func (m *Manager) RemovePeers(owner string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.peers, owner)
+}
+
+// CAPin 本节点CA公钥的SPKI固定，注册时上报面板，由面板下发给链路上的相邻节点
+func (m *Manager) CAPin() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.calculateSPKI(m.caCert)
+}
+
 // Start 启动证书管理器
 func (m *Manager) Start() error {
 	m.ctx, m.cancel = context.WithCancel(context.Background())
@@ -520,6 +657,31 @@ func (m *Manager) renewNodeCert() {
 	m.scheduleRenewal()
 }
 
+// Rotate 立即重新签发节点证书并重建TLS配置（面板远程命令触发），CA 保持不变
+func (m *Manager) Rotate() (*CertificateInfo, error) {
+	nodeCertPath := filepath.Join(m.certDir, NodeCertFile)
+	nodeKeyPath := filepath.Join(m.certDir, NodeKeyFile)
+
+	m.mutex.Lock()
+	if err := m.generateNodeCert(nodeCertPath, nodeKeyPath); err != nil {
+		m.mutex.Unlock()
+		return nil, fmt.Errorf("轮换节点证书失败: %w", err)
+	}
+	if err := m.buildTLSConfig(); err != nil {
+		m.mutex.Unlock()
+		return nil, fmt.Errorf("重新构建TLS配置失败: %w", err)
+	}
+	if m.renewTimer != nil {
+		m.renewTimer.Stop()
+	}
+	m.scheduleRenewal()
+	m.mutex.Unlock()
+
+	_, nodeInfo := m.GetCertificateInfo()
+	m.logger.Info("节点证书已轮换", zap.Time("expires", nodeInfo.NotAfter))
+	return nodeInfo, nil
+}
+
 // needsRenewal 检查证书是否需要更新
 func (m *Manager) needsRenewal(cert *x509.Certificate) bool {
 	if cert == nil {
@@ -623,6 +785,14 @@ func (m *Manager) GetTrustedPins() []string {
 
 // 辅助方法
 
+// shortNodeID 取节点ID前8个字符用于CA名称，不足8个字符时使用完整ID
+func shortNodeID(nodeID string) string {
+	if len(nodeID) > 8 {
+		return nodeID[:8]
+	}
+	return nodeID
+}
+
 // saveCertificate 保存证书到文件
 func (m *Manager) saveCertificate(path string, certDER []byte) error {
 	certPEM := pem.EncodeToMemory(&pem.Block{
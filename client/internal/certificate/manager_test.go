@@ -0,0 +1,18 @@
+package certificate
+
+import "testing"
+
+// TestNew_ShortNodeID 节点ID不足8个字符（如短主机名）时正常生成证书
+func TestNew_ShortNodeID(t *testing.T) {
+	m, err := New("edge1", t.TempDir())
+	if err != nil {
+		t.Fatalf("创建证书管理器失败: %v", err)
+	}
+	if cn := m.GetCACertificate().Subject.CommonName; cn != "GKIPass-Node-CA-edge1" {
+		t.Errorf("CA名称应使用完整的短节点ID，实际 %s", cn)
+	}
+
+	if _, err := New("", t.TempDir()); err == nil {
+		t.Error("节点ID为空时应返回错误")
+	}
+}
@@ -0,0 +1,164 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gkipass/client/internal/protocol"
+)
+
+// 面板可下发的远程命令（白名单，与面板一致）
+const (
+	ReloadRules     = "reload_rules"
+	RestartListener = "restart_listener"
+	DumpGoroutines  = "dump_goroutines"
+	RotateCert      = "rotate_cert"
+	RunProbe        = "run_probe"
+	FetchLogs       = "fetch_logs"
+	SetLogLevel     = "set_log_level"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	maxTimeout     = 120 * time.Second
+)
+
+// Handler 命令处理函数，返回值作为结果回传面板；ctx 在命令超时后取消
+type Handler func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error)
+
+// Dispatcher 远程命令分发器：只执行已注册的命令，按命令超时取消，结果携带请求ID
+type Dispatcher struct {
+	handlers map[string]Handler
+	mutex    sync.RWMutex
+	logger   *zap.Logger
+}
+
+// NewDispatcher 创建命令分发器
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		handlers: make(map[string]Handler),
+		logger:   zap.L().Named("command"),
+	}
+}
+
+// Register 注册命令处理函数
+func (d *Dispatcher) Register(name string, handler Handler) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.handlers[name] = handler
+}
+
+// Commands 已注册的命令
+func (d *Dispatcher) Commands() []string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	names := make([]string, 0, len(d.handlers))
+	for name := range d.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Handle 执行命令并生成结果，未注册的命令直接返回失败
+func (d *Dispatcher) Handle(ctx context.Context, cmd *protocol.Command) *protocol.CommandResult {
+	start := time.Now()
+	result := &protocol.CommandResult{
+		RequestID: cmd.RequestID,
+		Command:   cmd.Command,
+		Status:    "success",
+	}
+	defer func() {
+		result.DurationMs = time.Since(start).Milliseconds()
+		result.Timestamp = time.Now().Unix()
+	}()
+
+	d.mutex.RLock()
+	handler, ok := d.handlers[cmd.Command]
+	d.mutex.RUnlock()
+	if !ok {
+		result.Status = "failed"
+		result.Message = fmt.Sprintf("不支持的命令: %s", cmd.Command)
+		d.logger.Warn("拒绝执行未注册的命令",
+			zap.String("request_id", cmd.RequestID),
+			zap.String("command", cmd.Command))
+		return result
+	}
+
+	timeout := time.Duration(cmd.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d.logger.Info("执行远程命令",
+		zap.String("request_id", cmd.RequestID),
+		zap.String("command", cmd.Command),
+		zap.Any("params", cmd.Params))
+
+	output, err := d.run(ctx, handler, cmd.Params)
+	if err != nil {
+		result.Status = "failed"
+		result.Message = err.Error()
+		d.logger.Warn("远程命令执行失败",
+			zap.String("request_id", cmd.RequestID),
+			zap.String("command", cmd.Command),
+			zap.Error(err))
+		return result
+	}
+	result.Result = output
+	return result
+}
+
+// run 在独立协程中执行处理函数，超时后不再等待其返回
+func (d *Dispatcher) run(ctx context.Context, handler Handler, params map[string]interface{}) (map[string]interface{}, error) {
+	type outcome struct {
+		output map[string]interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("命令执行异常: %v", r)}
+			}
+		}()
+		output, err := handler(ctx, params)
+		done <- outcome{output: output, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.output, o.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("命令执行超时: %w", ctx.Err())
+	}
+}
+
+// StringParam 读取字符串参数
+func StringParam(params map[string]interface{}, key string) string {
+	if v, ok := params[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// IntParam 读取整数参数（JSON 数字解码为 float64），缺失或无效时返回 def
+func IntParam(params map[string]interface{}, key string, def int) int {
+	switch v := params[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return def
+}
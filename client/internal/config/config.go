@@ -28,6 +28,7 @@ type Config struct {
 	Monitoring MonitoringConfig `json:"monitoring"`
 	HotReload  *HotReloadConfig `json:"hot_reload,omitempty"`
 	Debug      *DebugConfig     `json:"debug,omitempty"`
+	Tracing    *TracingConfig   `json:"tracing,omitempty"`
 }
 
 // PlaneConfig Plane服务器配置
@@ -63,11 +64,50 @@ type LogConfig struct {
 
 // TransportConfig 传输配置
 type TransportConfig struct {
-	Type           string        `json:"type"`            // 传输类型：tcp/tls/mtls/ws/wss/none
-	MaxConnections int           `json:"max_connections"` // 最大连接数
-	MinConnections int           `json:"min_connections"` // 最小连接数
-	ConnectTimeout time.Duration `json:"connect_timeout"` // 连接超时
-	IdleTimeout    time.Duration `json:"idle_timeout"`    // 空闲超时
+	Type           string        `json:"type"`              // 传输类型：tcp/tls/mtls/tls-mux/ws/wss/kcp/quic/none
+	MaxConnections int           `json:"max_connections"`   // 最大连接数
+	MinConnections int           `json:"min_connections"`   // 最小连接数
+	ConnectTimeout time.Duration `json:"connect_timeout"`   // 连接超时
+	IdleTimeout    time.Duration `json:"idle_timeout"`      // 空闲超时
+	KCP            *KCPConfig    `json:"kcp,omitempty"`     // KCP传输设置
+	QUIC           *QUICConfig   `json:"quic,omitempty"`    // QUIC传输设置
+	TLSMux         *TLSMuxConfig `json:"tls_mux,omitempty"` // TLS多路复用传输设置
+}
+
+// KCPConfig KCP传输设置，未设置的字段使用所选模式的默认值
+type KCPConfig struct {
+	Profile      string `json:"profile"`       // 模式：normal/fast/fast2/fast3/manual
+	MTU          int    `json:"mtu"`           // 最大传输单元
+	SndWnd       int    `json:"snd_wnd"`       // 发送窗口
+	RcvWnd       int    `json:"rcv_wnd"`       // 接收窗口
+	NoDelay      int    `json:"no_delay"`      // manual模式：无延迟模式 0/1
+	Interval     int    `json:"interval"`      // manual模式：内部刷新间隔(ms，10-5000)，0沿用默认值
+	Resend       int    `json:"resend"`        // manual模式：快速重传阈值，0关闭
+	NoCongestion int    `json:"no_congestion"` // manual模式：1关闭拥塞控制
+	DataShards   int    `json:"data_shards"`   // FEC数据分片数，须与校验分片数同时设置
+	ParityShards int    `json:"parity_shards"` // FEC校验分片数，须与数据分片数同时设置
+	NoFEC        bool   `json:"no_fec"`        // 关闭FEC
+	AckNoDelay   bool   `json:"ack_no_delay"`  // 收到数据立即回ACK
+	SockBuf      int    `json:"sock_buf"`      // UDP套接字缓冲区大小
+}
+
+// QUICConfig QUIC传输设置，未设置的字段使用默认值
+type QUICConfig struct {
+	ALPN               string        `json:"alpn"`                 // 应用层协议标识
+	Disable0RTT        bool          `json:"disable_0rtt"`         // 关闭0-RTT会话恢复
+	DisableMigration   bool          `json:"disable_migration"`    // 关闭连接迁移
+	MaxIdleTimeout     time.Duration `json:"max_idle_timeout"`     // 连接空闲超时
+	KeepAlivePeriod    time.Duration `json:"keep_alive_period"`    // 保活间隔
+	MaxIncomingStreams int64         `json:"max_incoming_streams"` // 单连接最大并发流
+}
+
+// TLSMuxConfig TLS多路复用传输设置，未设置的字段使用默认值
+type TLSMuxConfig struct {
+	ConnsPerPeer   int           `json:"conns_per_peer"`   // 每个对端最多保持的TLS连接数
+	StreamsPerConn int           `json:"streams_per_conn"` // 单连接流数达到该值时优先新建连接
+	InitialWindow  int64         `json:"initial_window"`   // 流初始窗口（字节）
+	DrainTimeout   time.Duration `json:"drain_timeout"`    // 排空存量流的最长时间
+	PingInterval   time.Duration `json:"ping_interval"`    // 会话心跳间隔
 }
 
 // ProtocolConfig 协议配置
@@ -99,6 +139,8 @@ type TrafficConfig struct {
 type MonitoringConfig struct {
 	Enabled        bool          `json:"enabled"`         // 启用监控
 	ReportInterval time.Duration `json:"report_interval"` // 上报间隔
+	EnableMetrics  bool          `json:"enable_metrics"`  // 启用本地 Prometheus /metrics 端点
+	MetricsAddr    string        `json:"metrics_addr"`    // 指标监听地址，默认仅本机
 	MetricsPort    int           `json:"metrics_port"`    // 指标端口
 	EnablePprof    bool          `json:"enable_pprof"`    // 启用pprof
 	PprofPort      int           `json:"pprof_port"`      // pprof端口
@@ -170,6 +212,17 @@ type DebugConfig struct {
 	PprofPort   int    `json:"pprof_port"`   // pprof端口
 }
 
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	Enabled     bool    `json:"enabled"`      // 启用链路追踪
+	Exporter    string  `json:"exporter"`     // 导出方式: otlp/file
+	Endpoint    string  `json:"endpoint"`     // OTLP/HTTP 收集器地址 (host:port)
+	Insecure    bool    `json:"insecure"`     // 不使用 TLS 连接收集器
+	FilePath    string  `json:"file_path"`    // 文件导出路径
+	SampleRatio float64 `json:"sample_ratio"` // 本地发起的链路采样率
+	ServiceName string  `json:"service_name"` // 上报的服务名
+}
+
 // LoadFromFile 从文件加载配置
 func (c *Config) LoadFromFile(filename string) error {
 	data, err := os.ReadFile(filename)
@@ -336,6 +389,8 @@ func DefaultConfig() *Config {
 		Monitoring: MonitoringConfig{
 			Enabled:        true,
 			ReportInterval: 60 * time.Second,
+			EnableMetrics:  false,
+			MetricsAddr:    "127.0.0.1",
 			MetricsPort:    9090,
 			EnablePprof:    false,
 			PprofPort:      6060,
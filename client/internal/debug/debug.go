@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,7 +15,9 @@ import (
 
 	"go.uber.org/zap"
 
+	"gkipass/client/internal/certificate"
 	"gkipass/client/internal/config"
+	"gkipass/client/internal/transport"
 )
 
 // Mode 调试模式
@@ -700,21 +704,98 @@ func (m *Manager) startTLSServer(addr string) error {
 
 // startTLSMuxServer 启动TLS多路复用服务器
 func (m *Manager) startTLSMuxServer(addr string) error {
-	m.logger.Info("TLS多路复用服务器启动", zap.String("addr", addr))
-	// TODO: 实现TLS多路复用服务器
-	return fmt.Errorf("TLS多路复用服务器暂未实现")
+	// 调试服务器使用临时目录中的自签名证书
+	certManager, err := certificate.New("debug", filepath.Join(os.TempDir(), "gkipass-debug-certs"))
+	if err != nil {
+		return fmt.Errorf("创建调试证书失败: %w", err)
+	}
+
+	muxTransport, err := transport.NewTLSMuxTransport(nil, certManager.GetTLSConfig, m.logger.Named("tls-mux"))
+	if err != nil {
+		return fmt.Errorf("创建TLS多路复用传输失败: %w", err)
+	}
+
+	listener, err := muxTransport.Listen(m.ctx, addr)
+	if err != nil {
+		return fmt.Errorf("TLS多路复用监听失败: %w", err)
+	}
+
+	m.serverListener = listener
+	m.serverPort = listener.Addr().(*net.TCPAddr).Port
+
+	m.logger.Info("TLS多路复用调试服务器启动",
+		zap.String("addr", listener.Addr().String()),
+		zap.Int("port", m.serverPort))
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer muxTransport.Close()
+		m.acceptTCPConnections(listener)
+	}()
+
+	return nil
 }
 
 // startKCPServer 启动KCP服务器
 func (m *Manager) startKCPServer(addr string) error {
-	m.logger.Info("KCP服务器启动", zap.String("addr", addr))
-	// TODO: 实现KCP服务器
-	return fmt.Errorf("KCP服务器暂未实现")
+	kcpTransport, err := transport.NewKCPTransport(nil, m.logger.Named("kcp"))
+	if err != nil {
+		return fmt.Errorf("创建KCP传输失败: %w", err)
+	}
+
+	listener, err := kcpTransport.Listen(m.ctx, addr)
+	if err != nil {
+		return fmt.Errorf("KCP监听失败: %w", err)
+	}
+
+	m.serverListener = listener
+	m.serverPort = listener.Addr().(*net.UDPAddr).Port
+
+	m.logger.Info("KCP调试服务器启动",
+		zap.String("addr", listener.Addr().String()),
+		zap.Int("port", m.serverPort))
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.acceptTCPConnections(listener)
+	}()
+
+	return nil
 }
 
 // startQUICServer 启动QUIC服务器
 func (m *Manager) startQUICServer(addr string) error {
-	m.logger.Info("QUIC服务器启动", zap.String("addr", addr))
-	// TODO: 实现QUIC服务器
-	return fmt.Errorf("QUIC服务器暂未实现")
+	// 调试服务器使用临时目录中的自签名证书
+	certManager, err := certificate.New("debug", filepath.Join(os.TempDir(), "gkipass-debug-certs"))
+	if err != nil {
+		return fmt.Errorf("创建调试证书失败: %w", err)
+	}
+
+	quicTransport, err := transport.NewQUICTransport(nil, certManager.GetTLSConfig, m.logger.Named("quic"))
+	if err != nil {
+		return fmt.Errorf("创建QUIC传输失败: %w", err)
+	}
+
+	listener, err := quicTransport.Listen(m.ctx, addr)
+	if err != nil {
+		return fmt.Errorf("QUIC监听失败: %w", err)
+	}
+
+	m.serverListener = listener
+	m.serverPort = listener.Addr().(*net.UDPAddr).Port
+
+	m.logger.Info("QUIC调试服务器启动",
+		zap.String("addr", listener.Addr().String()),
+		zap.Int("port", m.serverPort))
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer quicTransport.Close()
+		m.acceptTCPConnections(listener)
+	}()
+
+	return nil
 }
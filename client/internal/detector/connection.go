@@ -5,6 +5,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -182,9 +183,9 @@ type ConnectionManager struct {
 
 	// 统计
 	stats struct {
-		totalConnections    int64
-		detectedConnections int64
-		handledConnections  int64
+		totalConnections    atomic.Int64
+		detectedConnections atomic.Int64
+		handledConnections  atomic.Int64
 	}
 }
 
@@ -211,7 +212,7 @@ func (cm *ConnectionManager) RegisterHandler(protocol Protocol, handler Connecti
 
 // HandleConnection 处理连接
 func (cm *ConnectionManager) HandleConnection(conn net.Conn) error {
-	cm.stats.totalConnections++
+	cm.stats.totalConnections.Add(1)
 
 	// 创建检测连接
 	detectingConn := NewDetectingConn(conn, cm.detector, 1024)
@@ -225,7 +226,7 @@ func (cm *ConnectionManager) HandleConnection(conn net.Conn) error {
 		return err
 	}
 
-	cm.stats.detectedConnections++
+	cm.stats.detectedConnections.Add(1)
 
 	cm.logger.Info("检测到连接协议",
 		zap.String("protocol", string(result.Protocol)),
@@ -249,16 +250,16 @@ func (cm *ConnectionManager) HandleConnection(conn net.Conn) error {
 	}
 
 	// 执行处理器
-	cm.stats.handledConnections++
+	cm.stats.handledConnections.Add(1)
 	return handler(detectingConn, result)
 }
 
 // GetStats 获取统计信息
 func (cm *ConnectionManager) GetStats() map[string]interface{} {
 	return map[string]interface{}{
-		"total_connections":    cm.stats.totalConnections,
-		"detected_connections": cm.stats.detectedConnections,
-		"handled_connections":  cm.stats.handledConnections,
+		"total_connections":    cm.stats.totalConnections.Load(),
+		"detected_connections": cm.stats.detectedConnections.Load(),
+		"handled_connections":  cm.stats.handledConnections.Load(),
 		"registered_handlers":  len(cm.handlers),
 	}
 }
@@ -64,6 +64,7 @@ type DetectionResult struct {
 	Protocol   Protocol
 	Confidence float64 // 0.0 to 1.0
 	Buffer     []byte  // The buffer read during detection
+	ServerName string  // TLS SNI or HTTP Host, set by PeekHostname
 }
 
 // DetectorConfig configures the protocol detector.
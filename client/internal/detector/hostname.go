@@ -0,0 +1,274 @@
+package detector
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrNotHostnameProtocol 首包既不是 TLS ClientHello 也不是 HTTP 请求
+var ErrNotHostnameProtocol = errors.New("首包不是 TLS ClientHello 或 HTTP 请求")
+
+// MaxHostnamePeekSize 共享端口预读上限：ClientHello 允许跨记录，携带后量子密钥交换时可超过 1KB
+const MaxHostnamePeekSize = 16*1024 + 5
+
+// ParseTLSServerName 从 TLS 首包中解析 SNI
+// complete 为 false 表示数据不足需继续读取；ClientHello 不含 SNI 时返回空名称且 complete 为 true
+func ParseTLSServerName(data []byte) (string, bool, error) {
+	// 重组握手消息（ClientHello 可能被拆分到多个 TLS 记录）
+	var handshake []byte
+	for len(data) > 0 {
+		if len(data) < 5 {
+			break
+		}
+		if data[0] != 0x16 || data[1] != 0x03 {
+			return "", false, ErrNotHostnameProtocol
+		}
+		recordLen := int(data[3])<<8 | int(data[4])
+		if len(data) < 5+recordLen {
+			handshake = append(handshake, data[5:]...)
+			break
+		}
+		handshake = append(handshake, data[5:5+recordLen]...)
+		data = data[5+recordLen:]
+		if len(handshake) >= 4 && len(handshake) >= 4+handshakeLen(handshake) {
+			break
+		}
+	}
+
+	if len(handshake) < 4 {
+		return "", false, nil
+	}
+	if handshake[0] != 0x01 {
+		return "", false, ErrNotHostnameProtocol
+	}
+	msgLen := handshakeLen(handshake)
+	if len(handshake) < 4+msgLen {
+		return "", false, nil
+	}
+
+	name, err := parseClientHelloSNI(handshake[4 : 4+msgLen])
+	if err != nil {
+		return "", false, err
+	}
+	return name, true, nil
+}
+
+func handshakeLen(handshake []byte) int {
+	return int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+}
+
+// parseClientHelloSNI 解析完整 ClientHello 消息体中的 server_name 扩展
+func parseClientHelloSNI(msg []byte) (string, error) {
+	malformed := errors.New("ClientHello 格式错误")
+
+	// 版本(2) + 随机数(32)
+	if len(msg) < 34 {
+		return "", malformed
+	}
+	msg = msg[34:]
+
+	// 会话 ID
+	if len(msg) < 1 || len(msg) < 1+int(msg[0]) {
+		return "", malformed
+	}
+	msg = msg[1+int(msg[0]):]
+
+	// 密码套件
+	if len(msg) < 2 {
+		return "", malformed
+	}
+	n := int(msg[0])<<8 | int(msg[1])
+	if len(msg) < 2+n {
+		return "", malformed
+	}
+	msg = msg[2+n:]
+
+	// 压缩方法
+	if len(msg) < 1 || len(msg) < 1+int(msg[0]) {
+		return "", malformed
+	}
+	msg = msg[1+int(msg[0]):]
+
+	// 无扩展
+	if len(msg) < 2 {
+		return "", nil
+	}
+	n = int(msg[0])<<8 | int(msg[1])
+	if len(msg) < 2+n {
+		return "", malformed
+	}
+	exts := msg[2 : 2+n]
+
+	for len(exts) >= 4 {
+		extType := int(exts[0])<<8 | int(exts[1])
+		extLen := int(exts[2])<<8 | int(exts[3])
+		if len(exts) < 4+extLen {
+			return "", malformed
+		}
+		ext := exts[4 : 4+extLen]
+		exts = exts[4+extLen:]
+
+		if extType != 0x0000 {
+			continue
+		}
+
+		// server_name_list
+		if len(ext) < 2 {
+			return "", malformed
+		}
+		list := ext[2:]
+		for len(list) >= 3 {
+			nameType := list[0]
+			nameLen := int(list[1])<<8 | int(list[2])
+			if len(list) < 3+nameLen {
+				return "", malformed
+			}
+			if nameType == 0 { // host_name
+				return normalizeHostname(string(list[3 : 3+nameLen])), nil
+			}
+			list = list[3+nameLen:]
+		}
+		return "", nil
+	}
+
+	return "", nil
+}
+
+// ParseHTTPHost 从 HTTP 请求首部解析 Host（去除端口、统一小写）
+// complete 为 false 表示请求头尚未读完；请求头不含 Host 时返回空名称且 complete 为 true
+func ParseHTTPHost(data []byte) (string, bool, error) {
+	lineEnd := bytes.Index(data, []byte("\r\n"))
+	if lineEnd < 0 {
+		if len(data) >= 8 && !looksLikeHTTPMethod(data) {
+			return "", false, ErrNotHostnameProtocol
+		}
+		return "", false, nil
+	}
+
+	requestLine := data[:lineEnd]
+	if !looksLikeHTTPMethod(requestLine) || !bytes.Contains(requestLine, []byte(" HTTP/")) {
+		return "", false, ErrNotHostnameProtocol
+	}
+
+	rest := data[lineEnd+2:]
+	for {
+		lineEnd = bytes.Index(rest, []byte("\r\n"))
+		if lineEnd < 0 {
+			return "", false, nil
+		}
+		line := rest[:lineEnd]
+		rest = rest[lineEnd+2:]
+
+		// 空行：请求头结束
+		if len(line) == 0 {
+			return "", true, nil
+		}
+
+		colon := bytes.IndexByte(line, ':')
+		if colon <= 0 {
+			continue
+		}
+		if !strings.EqualFold(string(bytes.TrimSpace(line[:colon])), "host") {
+			continue
+		}
+
+		host := strings.TrimSpace(string(line[colon+1:]))
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		return normalizeHostname(host), true, nil
+	}
+}
+
+func looksLikeHTTPMethod(data []byte) bool {
+	space := bytes.IndexByte(data, ' ')
+	if space <= 0 {
+		return false
+	}
+	for _, c := range data[:space] {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeHostname(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// PeekHostname 预读首包解析 TLS SNI 或 HTTP Host（不消费数据）
+// 持续读取直到首包可解析或达到预读上限，结果同时写入检测结果的 ServerName
+func (dc *DetectingConn) PeekHostname(timeout time.Duration) (*DetectionResult, error) {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	if dc.detected {
+		return dc.detectionResult, nil
+	}
+
+	if timeout > 0 {
+		dc.Conn.SetReadDeadline(time.Now().Add(timeout))
+		defer dc.Conn.SetReadDeadline(time.Time{})
+	}
+
+	var (
+		name     string
+		parseErr error
+	)
+	for {
+		if len(dc.peekBuffer) > 0 {
+			var complete bool
+			if dc.peekBuffer[0] == 0x16 {
+				name, complete, parseErr = ParseTLSServerName(dc.peekBuffer)
+			} else {
+				name, complete, parseErr = ParseHTTPHost(dc.peekBuffer)
+			}
+			if complete || parseErr != nil {
+				break
+			}
+		}
+
+		if len(dc.peekBuffer) >= dc.peekSize {
+			parseErr = errors.New("首包超过预读上限")
+			break
+		}
+
+		tempBuf := make([]byte, dc.peekSize-len(dc.peekBuffer))
+		n, err := dc.Conn.Read(tempBuf)
+		if n > 0 {
+			dc.peekBuffer = append(dc.peekBuffer, tempBuf[:n]...)
+		}
+		if err != nil {
+			if err == io.EOF && len(dc.peekBuffer) > 0 {
+				parseErr = io.ErrUnexpectedEOF
+				break
+			}
+			return nil, err
+		}
+	}
+
+	if len(dc.peekBuffer) > 0 {
+		dc.detectProtocol()
+	} else {
+		dc.detectionResult = &DetectionResult{Protocol: ProtocolUnknown}
+		dc.detected = true
+	}
+	dc.detectionResult.ServerName = name
+
+	if parseErr != nil {
+		dc.logger.Debug("主机名解析失败",
+			zap.String("remote_addr", dc.RemoteAddr().String()),
+			zap.Error(parseErr))
+		return dc.detectionResult, parseErr
+	}
+	return dc.detectionResult, nil
+}
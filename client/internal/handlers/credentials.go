@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"sync"
+)
+
+// ProxyCredential 代理认证凭据（面板下发，只包含密码摘要）
+type ProxyCredential struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"` // hex(SHA-256(salt + password))
+	Salt         string `json:"salt"`
+}
+
+// CredentialStore 按隧道保存代理认证凭据，由面板规则同步更新
+type CredentialStore struct {
+	tunnels map[string]map[string]ProxyCredential // tunnelID -> username -> 凭据
+	mutex   sync.RWMutex
+}
+
+// NewCredentialStore 创建凭据存储
+func NewCredentialStore() *CredentialStore {
+	return &CredentialStore{
+		tunnels: make(map[string]map[string]ProxyCredential),
+	}
+}
+
+// SetTunnelCredentials 替换隧道的全部凭据
+// 空列表保留一个空条目，表示任何用户名都无法通过认证，而不是无需认证
+func (cs *CredentialStore) SetTunnelCredentials(tunnelID string, credentials []ProxyCredential) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	users := make(map[string]ProxyCredential, len(credentials))
+	for _, cred := range credentials {
+		users[cred.Username] = cred
+	}
+	cs.tunnels[tunnelID] = users
+}
+
+// RemoveTunnel 移除隧道凭据
+func (cs *CredentialStore) RemoveTunnel(tunnelID string) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	delete(cs.tunnels, tunnelID)
+}
+
+// HasCredentials 检查隧道是否配置了凭据（配置后必须认证）
+func (cs *CredentialStore) HasCredentials(tunnelID string) bool {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	return len(cs.tunnels[tunnelID]) > 0
+}
+
+// Verify 校验用户名密码
+func (cs *CredentialStore) Verify(tunnelID, username, password string) bool {
+	cs.mutex.RLock()
+	cred, ok := cs.tunnels[tunnelID][username]
+	cs.mutex.RUnlock()
+
+	// 用户不存在时同样计算一次摘要，避免通过耗时探测用户名
+	sum := sha256.Sum256([]byte(cred.Salt + password))
+	expected, err := hex.DecodeString(cred.PasswordHash)
+	if err != nil || len(expected) != len(sum) {
+		expected = make([]byte, len(sum))
+		ok = false
+	}
+
+	match := subtle.ConstantTimeCompare(sum[:], expected) == 1
+	return ok && match
+}
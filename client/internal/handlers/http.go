@@ -3,28 +3,92 @@ package handlers
 import (
 	"bufio"
 	"context"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"gkipass/client/internal/detector"
+	"gkipass/client/internal/rules"
 
 	"go.uber.org/zap"
 )
 
-// HTTPHandler HTTP协议处理器
+// HTTPProxyConfig HTTP正向代理配置
+type HTTPProxyConfig struct {
+	TunnelID       string           // 所属隧道，用于查找认证凭据
+	Credentials    *CredentialStore // 面板下发的隧道/用户凭据
+	RequireAuth    bool             // 隧道未配置凭据时也拒绝无认证访问
+	AllowedDomains *rules.Rule      // 目标白名单，按 MatchesDomain 匹配，Domains 为空表示不限制
+	Realm          string           // Proxy-Authenticate 中的 realm
+	DialTimeout    time.Duration    // 连接目标超时
+	IdleTimeout    time.Duration    // 长连接等待下一个请求的超时
+}
+
+// DefaultHTTPProxyConfig 默认HTTP正向代理配置
+func DefaultHTTPProxyConfig() *HTTPProxyConfig {
+	return &HTTPProxyConfig{
+		Realm:       "gkipass",
+		DialTimeout: 10 * time.Second,
+		IdleTimeout: 90 * time.Second,
+	}
+}
+
+// HTTPHandler HTTP协议处理器（正向代理：CONNECT 与绝对 URI 请求）
 type HTTPHandler struct {
 	*BaseHandler
 	upstreamAddr string
+	config       *HTTPProxyConfig
+	transport    *http.Transport
+
+	proxyStats struct {
+		authFailures atomic.Int64
+		denied       atomic.Int64
+		requests     atomic.Int64
+		tunnels      atomic.Int64
+	}
 }
 
 // NewHTTPHandler 创建HTTP处理器
 func NewHTTPHandler(upstreamAddr string) *HTTPHandler {
+	h := NewHTTPProxyHandler(nil)
+	h.upstreamAddr = upstreamAddr
+	return h
+}
+
+// NewHTTPProxyHandler 创建带认证和目标白名单的HTTP正向代理处理器
+func NewHTTPProxyHandler(config *HTTPProxyConfig) *HTTPHandler {
+	if config == nil {
+		config = DefaultHTTPProxyConfig()
+	}
+	def := DefaultHTTPProxyConfig()
+	if config.Realm == "" {
+		config.Realm = def.Realm
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = def.DialTimeout
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = def.IdleTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: config.DialTimeout}
 	return &HTTPHandler{
-		BaseHandler:  NewBaseHandler("http", detector.ProtocolHTTP),
-		upstreamAddr: upstreamAddr,
+		BaseHandler: NewBaseHandler("http", detector.ProtocolHTTP),
+		config:      config,
+		transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   8,
+			IdleConnTimeout:       config.IdleTimeout,
+			ResponseHeaderTimeout: 60 * time.Second,
+			DisableCompression:    true,
+		},
 	}
 }
 
@@ -37,310 +101,308 @@ func (h *HTTPHandler) Handle(ctx context.Context, conn net.Conn, result *detecto
 		zap.String("protocol", string(result.Protocol)),
 		zap.Float64("confidence", result.Confidence))
 
-	// 读取HTTP请求
+	// 同一连接上可能有多个请求（包括407后携带凭据的重试）
 	reader := bufio.NewReader(conn)
-	req, err := http.ReadRequest(reader)
-	if err != nil {
-		h.recordConnection(false, 0)
-		return fmt.Errorf("读取HTTP请求失败: %w", err)
-	}
+	var totalBytes int64
+	served := false
+	for {
+		conn.SetReadDeadline(time.Now().Add(h.config.IdleTimeout))
+		req, err := http.ReadRequest(reader)
+		conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			if served {
+				h.recordConnection(true, totalBytes)
+				return nil
+			}
+			h.recordConnection(false, 0)
+			return fmt.Errorf("读取HTTP请求失败: %w", err)
+		}
 
-	// 处理不同类型的HTTP请求
-	if req.Method == "CONNECT" {
-		return h.handleConnect(conn, req)
-	}
+		if !h.authorize(conn, req) {
+			if req.Close || !drainRequestBody(req) {
+				h.recordConnection(false, totalBytes)
+				return fmt.Errorf("代理认证失败")
+			}
+			continue
+		}
 
-	return h.handleHTTPProxy(conn, req)
-}
+		host, port, err := proxyTarget(req)
+		if err != nil {
+			writeProxyError(conn, http.StatusBadRequest, req)
+			h.recordConnection(false, totalBytes)
+			return err
+		}
+		if !h.allowed(host) {
+			h.proxyStats.denied.Add(1)
+			h.logger.Warn("目标不在白名单中",
+				zap.String("remote_addr", conn.RemoteAddr().String()),
+				zap.String("host", host))
+			writeProxyError(conn, http.StatusForbidden, req)
+			if req.Close || !drainRequestBody(req) {
+				h.recordConnection(false, totalBytes)
+				return fmt.Errorf("目标不在白名单中: %s", host)
+			}
+			continue
+		}
 
-// handleConnect 处理CONNECT方法（用于HTTPS代理）
-func (h *HTTPHandler) handleConnect(conn net.Conn, req *http.Request) error {
-	// 连接到目标服务器
-	targetConn, err := net.DialTimeout("tcp", req.Host, 10*time.Second)
-	if err != nil {
-		// 发送错误响应
-		response := "HTTP/1.1 502 Bad Gateway\r\n\r\n"
-		conn.Write([]byte(response))
-		h.recordConnection(false, 0)
-		return fmt.Errorf("连接目标服务器失败: %w", err)
+		// CONNECT 之后连接转为隧道，不再解析后续请求
+		if req.Method == http.MethodConnect {
+			n, err := h.handleConnect(ctx, &bufferedConn{Conn: conn, reader: reader}, net.JoinHostPort(host, port))
+			h.recordConnection(err == nil, totalBytes+n)
+			return err
+		}
+
+		n, keepAlive, err := h.handleHTTPProxy(ctx, conn, req)
+		totalBytes += n
+		served = true
+		if err != nil {
+			h.recordConnection(false, totalBytes)
+			return err
+		}
+		if !keepAlive {
+			h.recordConnection(true, totalBytes)
+			return nil
+		}
 	}
-	defer targetConn.Close()
+}
 
-	// 发送成功响应
-	response := "HTTP/1.1 200 Connection Established\r\n\r\n"
-	if _, err := conn.Write([]byte(response)); err != nil {
-		h.recordConnection(false, 0)
-		return fmt.Errorf("发送CONNECT响应失败: %w", err)
+// authorize 校验 Proxy-Authorization，失败时回复407
+func (h *HTTPHandler) authorize(conn net.Conn, req *http.Request) bool {
+	if !h.authRequired() {
+		return true
 	}
 
-	// 开始双向中继
-	relay := NewRelayConnection(conn, targetConn)
-	if err := relay.Start(); err != nil {
-		h.recordConnection(false, 0)
-		return err
+	username, password, ok := parseProxyBasicAuth(req.Header.Get("Proxy-Authorization"))
+	if ok && h.config.Credentials != nil && h.config.Credentials.Verify(h.config.TunnelID, username, password) {
+		return true
 	}
 
-	relay.Wait()
-	stats := relay.GetStats()
-	totalBytes := stats["total_bytes"].(int64)
-	h.recordConnection(true, totalBytes)
+	h.proxyStats.authFailures.Add(1)
+	if ok {
+		h.logger.Warn("HTTP代理认证失败",
+			zap.String("remote_addr", conn.RemoteAddr().String()),
+			zap.String("username", username))
+	}
 
-	return nil
+	resp := &http.Response{
+		StatusCode: http.StatusProxyAuthRequired,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Close:      req.Close,
+		Request:    req,
+	}
+	resp.Header.Set("Proxy-Authenticate", fmt.Sprintf("Basic realm=%q", h.config.Realm))
+	resp.Write(conn)
+	return false
 }
 
-// handleHTTPProxy 处理普通HTTP代理
-func (h *HTTPHandler) handleHTTPProxy(conn net.Conn, req *http.Request) error {
-	// 解析目标URL
-	var targetHost string
-	if req.URL.IsAbs() {
-		targetHost = req.URL.Host
-	} else {
-		targetHost = req.Host
+// authRequired 当前隧道是否必须认证
+func (h *HTTPHandler) authRequired() bool {
+	if h.config.RequireAuth {
+		return true
 	}
+	return h.config.Credentials != nil && h.config.Credentials.HasCredentials(h.config.TunnelID)
+}
 
-	if targetHost == "" {
-		response := "HTTP/1.1 400 Bad Request\r\n\r\n"
-		conn.Write([]byte(response))
-		h.recordConnection(false, 0)
-		return fmt.Errorf("无效的请求，缺少Host")
+// allowed 检查目标主机是否在白名单中
+func (h *HTTPHandler) allowed(host string) bool {
+	if h.config.AllowedDomains == nil {
+		return true
 	}
+	return h.config.AllowedDomains.MatchesDomain(strings.TrimSuffix(strings.ToLower(host), "."))
+}
 
-	// 添加默认端口
-	if !strings.Contains(targetHost, ":") {
-		targetHost += ":80"
-	}
+// handleConnect 处理CONNECT方法（用于HTTPS代理）
+func (h *HTTPHandler) handleConnect(ctx context.Context, conn net.Conn, target string) (int64, error) {
+	h.proxyStats.tunnels.Add(1)
 
 	// 连接到目标服务器
-	targetConn, err := net.DialTimeout("tcp", targetHost, 10*time.Second)
+	dialer := net.Dialer{Timeout: h.config.DialTimeout}
+	targetConn, err := dialer.DialContext(ctx, "tcp", target)
 	if err != nil {
+		// 发送错误响应
 		response := "HTTP/1.1 502 Bad Gateway\r\n\r\n"
 		conn.Write([]byte(response))
-		h.recordConnection(false, 0)
-		return fmt.Errorf("连接目标服务器失败: %w", err)
+		return 0, fmt.Errorf("连接目标服务器失败: %w", err)
 	}
 	defer targetConn.Close()
 
-	// 修改请求URL为相对路径
-	if req.URL.IsAbs() {
-		req.URL.Scheme = ""
-		req.URL.Host = ""
-	}
-
-	// 转发请求到目标服务器
-	if err := req.Write(targetConn); err != nil {
-		h.recordConnection(false, 0)
-		return fmt.Errorf("转发请求失败: %w", err)
+	// 发送成功响应
+	response := "HTTP/1.1 200 Connection Established\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		return 0, fmt.Errorf("发送CONNECT响应失败: %w", err)
 	}
 
 	// 开始双向中继
 	relay := NewRelayConnection(conn, targetConn)
 	if err := relay.Start(); err != nil {
-		h.recordConnection(false, 0)
-		return err
+		return 0, err
 	}
 
 	relay.Wait()
 	stats := relay.GetStats()
-	totalBytes := stats["total_bytes"].(int64)
-	h.recordConnection(true, totalBytes)
-
-	return nil
+	return stats["total_bytes"].(int64), nil
 }
 
-// SOCKSHandler SOCKS协议处理器
-type SOCKSHandler struct {
-	*BaseHandler
-}
+// handleHTTPProxy 处理普通HTTP代理请求，返回是否保持连接
+func (h *HTTPHandler) handleHTTPProxy(ctx context.Context, conn net.Conn, req *http.Request) (int64, bool, error) {
+	h.proxyStats.requests.Add(1)
 
-// NewSOCKSHandler 创建SOCKS处理器
-func NewSOCKSHandler() *SOCKSHandler {
-	return &SOCKSHandler{
-		BaseHandler: NewBaseHandler("socks", detector.ProtocolSOCKS5),
+	// 转换为客户端请求：绝对 URI，去掉逐跳头部
+	outReq := req.Clone(ctx)
+	outReq.RequestURI = ""
+	if !outReq.URL.IsAbs() {
+		outReq.URL.Scheme = "http"
+		outReq.URL.Host = req.Host
 	}
-}
-
-// Handle 处理SOCKS连接
-func (s *SOCKSHandler) Handle(ctx context.Context, conn net.Conn, result *detector.DetectionResult) error {
-	defer conn.Close()
-
-	s.logger.Info("处理SOCKS连接",
-		zap.String("remote_addr", conn.RemoteAddr().String()),
-		zap.String("protocol", string(result.Protocol)),
-		zap.Float64("confidence", result.Confidence))
-
-	// 根据检测结果选择处理方式
-	switch result.Protocol {
-	case detector.ProtocolSOCKS4:
-		return s.handleSOCKS4(conn)
-	case detector.ProtocolSOCKS5:
-		return s.handleSOCKS5(conn)
-	default:
-		s.recordConnection(false, 0)
-		return fmt.Errorf("不支持的SOCKS版本: %s", result.Protocol)
+	if outReq.URL.Scheme != "http" {
+		writeProxyError(conn, http.StatusBadRequest, req)
+		return 0, false, fmt.Errorf("不支持的代理协议: %s", outReq.URL.Scheme)
 	}
-}
-
-// handleSOCKS4 处理SOCKS4协议
-func (s *SOCKSHandler) handleSOCKS4(conn net.Conn) error {
-	// 读取SOCKS4请求
-	buffer := make([]byte, 1024)
-	n, err := conn.Read(buffer)
-	if err != nil || n < 8 {
-		s.recordConnection(false, 0)
-		return fmt.Errorf("读取SOCKS4请求失败")
-	}
-
-	// 解析请求
-	version := buffer[0]
-	command := buffer[1]
+	removeHopHeaders(outReq.Header)
+	outReq.Close = false
 
-	if version != 4 {
-		s.recordConnection(false, 0)
-		return fmt.Errorf("无效的SOCKS版本: %d", version)
+	resp, err := h.transport.RoundTrip(outReq)
+	if err != nil {
+		writeProxyError(conn, http.StatusBadGateway, req)
+		return 0, false, fmt.Errorf("转发请求失败: %w", err)
 	}
+	defer resp.Body.Close()
 
-	if command != 1 { // 只支持CONNECT
-		// 发送失败响应
-		response := []byte{0, 91, 0, 0, 0, 0, 0, 0} // 91 = 请求被拒绝
-		conn.Write(response)
-		s.recordConnection(false, 0)
-		return fmt.Errorf("不支持的SOCKS4命令: %d", command)
+	removeHopHeaders(resp.Header)
+	resp.Close = req.Close
+	counter := &countingWriter{w: conn}
+	if err := resp.Write(counter); err != nil {
+		return counter.n, false, fmt.Errorf("写回响应失败: %w", err)
 	}
+	return counter.n, !req.Close, nil
+}
 
-	// 提取目标地址和端口
-	port := (uint16(buffer[2]) << 8) | uint16(buffer[3])
-	ip := fmt.Sprintf("%d.%d.%d.%d", buffer[4], buffer[5], buffer[6], buffer[7])
-	targetAddr := fmt.Sprintf("%s:%d", ip, port)
-
-	return s.connectAndRelay(conn, targetAddr, []byte{0, 90, 0, 0, 0, 0, 0, 0}) // 90 = 请求成功
+// GetStats 获取统计信息
+func (h *HTTPHandler) GetStats() map[string]interface{} {
+	stats := h.BaseHandler.GetStats()
+	stats["auth_failures"] = h.proxyStats.authFailures.Load()
+	stats["denied"] = h.proxyStats.denied.Load()
+	stats["requests"] = h.proxyStats.requests.Load()
+	stats["connect_tunnels"] = h.proxyStats.tunnels.Load()
+	stats["auth_required"] = h.authRequired()
+	return stats
 }
 
-// handleSOCKS5 处理SOCKS5协议
-func (s *SOCKSHandler) handleSOCKS5(conn net.Conn) error {
-	// 阶段1：认证方法协商
-	buffer := make([]byte, 256)
-	n, err := conn.Read(buffer)
-	if err != nil || n < 3 {
-		s.recordConnection(false, 0)
-		return fmt.Errorf("读取SOCKS5认证请求失败")
+// proxyTarget 解析代理请求的目标主机和端口
+func proxyTarget(req *http.Request) (string, string, error) {
+	hostPort := req.Host
+	defaultPort := "80"
+	if req.Method == http.MethodConnect {
+		defaultPort = "443"
+	} else if req.URL.IsAbs() {
+		hostPort = req.URL.Host
+		if req.URL.Scheme == "https" {
+			defaultPort = "443"
+		}
 	}
-
-	version := buffer[0]
-	if version != 5 {
-		s.recordConnection(false, 0)
-		return fmt.Errorf("无效的SOCKS版本: %d", version)
+	if hostPort == "" {
+		return "", "", fmt.Errorf("无效的请求，缺少Host")
 	}
 
-	// 回复：使用无认证方法
-	response := []byte{5, 0} // 版本5，方法0（无认证）
-	if _, err := conn.Write(response); err != nil {
-		s.recordConnection(false, 0)
-		return fmt.Errorf("发送认证响应失败: %w", err)
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		// 不带端口（IPv6 字面量可能带方括号）
+		host = strings.TrimSuffix(strings.TrimPrefix(hostPort, "["), "]")
+		port = defaultPort
 	}
-
-	// 阶段2：连接请求
-	n, err = conn.Read(buffer)
-	if err != nil || n < 4 {
-		s.recordConnection(false, 0)
-		return fmt.Errorf("读取SOCKS5连接请求失败")
+	if host == "" {
+		return "", "", fmt.Errorf("无效的目标地址: %s", hostPort)
 	}
+	return host, port, nil
+}
 
-	version = buffer[0]
-	command := buffer[1]
-	addrType := buffer[3]
-
-	if version != 5 {
-		s.recordConnection(false, 0)
-		return fmt.Errorf("无效的SOCKS5版本: %d", version)
+// parseProxyBasicAuth 解析 Proxy-Authorization: Basic 凭据
+func parseProxyBasicAuth(header string) (string, string, bool) {
+	const prefix = "basic "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", "", false
 	}
-
-	if command != 1 { // 只支持CONNECT
-		response := []byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0} // 7 = 不支持的命令
-		conn.Write(response)
-		s.recordConnection(false, 0)
-		return fmt.Errorf("不支持的SOCKS5命令: %d", command)
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[len(prefix):]))
+	if err != nil {
+		return "", "", false
 	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	return username, password, ok
+}
 
-	// 解析目标地址
-	var targetAddr string
-	pos := 4
+// hopHeaders 逐跳头部，代理转发时必须移除（RFC 7230 6.1）
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
 
-	switch addrType {
-	case 1: // IPv4
-		if n < pos+6 {
-			response := []byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0} // 1 = 一般性SOCKS服务器故障
-			conn.Write(response)
-			s.recordConnection(false, 0)
-			return fmt.Errorf("IPv4地址数据不完整")
-		}
-		ip := fmt.Sprintf("%d.%d.%d.%d", buffer[pos], buffer[pos+1], buffer[pos+2], buffer[pos+3])
-		port := (uint16(buffer[pos+4]) << 8) | uint16(buffer[pos+5])
-		targetAddr = fmt.Sprintf("%s:%d", ip, port)
-
-	case 3: // 域名
-		if n < pos+1 {
-			response := []byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0}
-			conn.Write(response)
-			s.recordConnection(false, 0)
-			return fmt.Errorf("域名长度数据不完整")
+// removeHopHeaders 移除逐跳头部及 Connection 中列出的头部
+func removeHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
 		}
-		domainLen := buffer[pos]
-		pos++
-		if n < pos+int(domainLen)+2 {
-			response := []byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0}
-			conn.Write(response)
-			s.recordConnection(false, 0)
-			return fmt.Errorf("域名数据不完整")
-		}
-		domain := string(buffer[pos : pos+int(domainLen)])
-		pos += int(domainLen)
-		port := (uint16(buffer[pos]) << 8) | uint16(buffer[pos+1])
-		targetAddr = fmt.Sprintf("%s:%d", domain, port)
-
-	default:
-		response := []byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0} // 8 = 不支持的地址类型
-		conn.Write(response)
-		s.recordConnection(false, 0)
-		return fmt.Errorf("不支持的地址类型: %d", addrType)
 	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
 
-	successResponse := []byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0} // 连接成功
-	return s.connectAndRelay(conn, targetAddr, successResponse)
+// writeProxyError 回复代理错误
+func writeProxyError(conn net.Conn, status int, req *http.Request) {
+	resp := &http.Response{
+		StatusCode: status,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Close:      req.Close,
+		Request:    req,
+	}
+	resp.Write(conn)
 }
 
-// connectAndRelay 连接目标并中继数据
-func (s *SOCKSHandler) connectAndRelay(conn net.Conn, targetAddr string, successResponse []byte) error {
-	// 连接到目标服务器
-	targetConn, err := net.DialTimeout("tcp", targetAddr, 10*time.Second)
-	if err != nil {
-		s.recordConnection(false, 0)
-		return fmt.Errorf("连接目标服务器失败: %w", err)
-	}
-	defer targetConn.Close()
+// maxDrainBody 拒绝请求后为保持长连接最多丢弃的请求体大小
+const maxDrainBody = 256 * 1024
 
-	// 发送成功响应
-	if _, err := conn.Write(successResponse); err != nil {
-		s.recordConnection(false, 0)
-		return fmt.Errorf("发送成功响应失败: %w", err)
-	}
+// drainRequestBody 丢弃被拒绝请求的请求体，过大时返回 false 表示应关闭连接
+func drainRequestBody(req *http.Request) bool {
+	n, err := io.Copy(io.Discard, io.LimitReader(req.Body, maxDrainBody+1))
+	return err == nil && n <= maxDrainBody
+}
 
-	// 开始双向中继
-	relay := NewRelayConnection(conn, targetConn)
-	if err := relay.Start(); err != nil {
-		s.recordConnection(false, 0)
-		return err
-	}
+// bufferedConn 保留 bufio 已预读数据的连接
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
 
-	relay.Wait()
-	stats := relay.GetStats()
-	totalBytes := stats["total_bytes"].(int64)
-	s.recordConnection(true, totalBytes)
+// Read 优先读取缓冲数据
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
 
-	s.logger.Info("SOCKS连接处理完成",
-		zap.String("target_addr", targetAddr),
-		zap.Int64("bytes_transferred", totalBytes))
+// countingWriter 统计写出字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
 
-	return nil
+// Write 写入并计数
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
 }
 
 // TCPHandler TCP协议处理器
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"gkipass/client/internal/detector"
+	"gkipass/client/internal/rules"
+)
+
+// httpConnect 发起 HTTP CONNECT，返回响应状态码
+func httpConnect(t *testing.T, conn net.Conn, reader *bufio.Reader, target *net.TCPAddr, username, password string) int {
+	t.Helper()
+	req := "CONNECT " + target.String() + " HTTP/1.1\r\nHost: " + target.String() + "\r\n"
+	if username != "" {
+		req += "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)) + "\r\n"
+	}
+	conn.Write([]byte(req + "\r\n"))
+
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("读取 CONNECT 响应失败: %v", err)
+	}
+	return resp.StatusCode
+}
+
+// TestHTTPConnect_Auth 缺少或错误的凭据返回 407，同一连接带正确凭据重试后建立隧道
+func TestHTTPConnect_Auth(t *testing.T) {
+	target := startEchoTarget(t)
+	handler := NewHTTPProxyHandler(&HTTPProxyConfig{TunnelID: "tunnel-1", Credentials: testCredentials("tunnel-1")})
+	conn := serveHandler(t, handler, detector.ProtocolHTTP)
+	reader := bufio.NewReader(conn)
+
+	if status := httpConnect(t, conn, reader, target, "", ""); status != http.StatusProxyAuthRequired {
+		t.Fatalf("未携带凭据应返回 407，实际 %d", status)
+	}
+	if status := httpConnect(t, conn, reader, target, "alice", "wrong"); status != http.StatusProxyAuthRequired {
+		t.Fatalf("错误密码应返回 407，实际 %d", status)
+	}
+	if got := handler.proxyStats.authFailures.Load(); got != 2 {
+		t.Errorf("认证失败计数应为 2，实际 %d", got)
+	}
+
+	if status := httpConnect(t, conn, reader, target, "alice", "secret"); status != http.StatusOK {
+		t.Fatalf("正确凭据应建立隧道，实际 %d", status)
+	}
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(reader, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("应经隧道收到回显，实际 %q (%v)", buf, err)
+	}
+}
+
+// TestHTTPConnect_AllowedDomains 目标不在白名单时返回 403，凭据清空后任何用户都返回 407
+func TestHTTPConnect_AllowedDomains(t *testing.T) {
+	target := startEchoTarget(t)
+	store := testCredentials("tunnel-1")
+	handler := NewHTTPProxyHandler(&HTTPProxyConfig{
+		TunnelID:       "tunnel-1",
+		Credentials:    store,
+		RequireAuth:    true,
+		AllowedDomains: &rules.Rule{Domains: []string{"example.com"}},
+	})
+	conn := serveHandler(t, handler, detector.ProtocolHTTP)
+	reader := bufio.NewReader(conn)
+
+	if status := httpConnect(t, conn, reader, target, "alice", "secret"); status != http.StatusForbidden {
+		t.Fatalf("白名单外的目标应返回 403，实际 %d", status)
+	}
+	if got := handler.proxyStats.denied.Load(); got != 1 {
+		t.Errorf("白名单拒绝计数应为 1，实际 %d", got)
+	}
+
+	store.SetTunnelCredentials("tunnel-1", nil)
+	if status := httpConnect(t, conn, reader, target, "alice", "secret"); status != http.StatusProxyAuthRequired {
+		t.Errorf("凭据清空后应返回 407，实际 %d", status)
+	}
+}
@@ -0,0 +1,851 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gkipass/client/internal/detector"
+	"gkipass/client/internal/udp"
+
+	"go.uber.org/zap"
+)
+
+// SOCKS5 协议常量（RFC 1928 / RFC 1929）
+const (
+	socks5Version = 0x05
+
+	socksAuthNone         = 0x00
+	socksAuthPassword     = 0x02
+	socksAuthNoAcceptable = 0xFF
+
+	socksPasswordVersion = 0x01
+
+	socksCmdConnect      = 0x01
+	socksCmdBind         = 0x02
+	socksCmdUDPAssociate = 0x03
+
+	socksAtypIPv4   = 0x01
+	socksAtypDomain = 0x03
+	socksAtypIPv6   = 0x04
+
+	socksRepSuccess             = 0x00
+	socksRepGeneralFailure      = 0x01
+	socksRepNetworkUnreachable  = 0x03
+	socksRepHostUnreachable     = 0x04
+	socksRepConnectionRefused   = 0x05
+	socksRepTTLExpired          = 0x06
+	socksRepCommandNotSupported = 0x07
+	socksRepAddrNotSupported    = 0x08
+)
+
+// errSOCKSAddrType 不支持的地址类型
+var errSOCKSAddrType = errors.New("不支持的地址类型")
+
+// SOCKSConfig SOCKS处理器配置
+type SOCKSConfig struct {
+	TunnelID    string           // 所属隧道，用于查找认证凭据
+	Credentials *CredentialStore // 面板下发的隧道凭据
+	RequireAuth bool             // 隧道未配置凭据时也拒绝无认证访问
+	UDPManager  *udp.Manager     // UDP ASSOCIATE 会话管理器，为空时不支持UDP
+	EnableBind  bool             // 是否允许BIND命令（会在入口节点上开放临时监听端口，默认关闭）
+	AdvertiseIP string           // UDP ASSOCIATE/BIND 回复中公布的地址，为空使用控制连接本地地址
+	DialTimeout time.Duration    // 连接目标超时
+	BindTimeout time.Duration    // BIND 等待入站连接超时
+	UDPBuffer   int              // UDP中继缓冲区大小
+}
+
+// DefaultSOCKSConfig 默认SOCKS配置
+func DefaultSOCKSConfig() *SOCKSConfig {
+	return &SOCKSConfig{
+		DialTimeout: 10 * time.Second,
+		BindTimeout: 2 * time.Minute,
+		UDPBuffer:   65535,
+	}
+}
+
+// SOCKSHandler SOCKS协议处理器
+type SOCKSHandler struct {
+	*BaseHandler
+	config *SOCKSConfig
+
+	socksStats struct {
+		authFailures    atomic.Int64
+		udpAssociations atomic.Int64
+		udpPackets      atomic.Int64
+		udpDropped      atomic.Int64
+		bindRequests    atomic.Int64
+	}
+}
+
+// NewSOCKSHandler 创建SOCKS处理器
+func NewSOCKSHandler(config *SOCKSConfig) *SOCKSHandler {
+	if config == nil {
+		config = DefaultSOCKSConfig()
+	}
+	def := DefaultSOCKSConfig()
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = def.DialTimeout
+	}
+	if config.BindTimeout <= 0 {
+		config.BindTimeout = def.BindTimeout
+	}
+	if config.UDPBuffer <= 0 {
+		config.UDPBuffer = def.UDPBuffer
+	}
+
+	return &SOCKSHandler{
+		BaseHandler: NewBaseHandler("socks", detector.ProtocolSOCKS5),
+		config:      config,
+	}
+}
+
+// Handle 处理SOCKS连接
+func (s *SOCKSHandler) Handle(ctx context.Context, conn net.Conn, result *detector.DetectionResult) error {
+	defer conn.Close()
+
+	s.logger.Info("处理SOCKS连接",
+		zap.String("remote_addr", conn.RemoteAddr().String()),
+		zap.String("protocol", string(result.Protocol)),
+		zap.Float64("confidence", result.Confidence))
+
+	// 根据检测结果选择处理方式
+	switch result.Protocol {
+	case detector.ProtocolSOCKS4:
+		return s.handleSOCKS4(conn)
+	case detector.ProtocolSOCKS5:
+		return s.handleSOCKS5(ctx, conn)
+	default:
+		s.recordConnection(false, 0)
+		return fmt.Errorf("不支持的SOCKS版本: %s", result.Protocol)
+	}
+}
+
+// authRequired 当前隧道是否必须认证
+func (s *SOCKSHandler) authRequired() bool {
+	if s.config.RequireAuth {
+		return true
+	}
+	return s.config.Credentials != nil && s.config.Credentials.HasCredentials(s.config.TunnelID)
+}
+
+// handleSOCKS4 处理SOCKS4协议
+func (s *SOCKSHandler) handleSOCKS4(conn net.Conn) error {
+	// 读取SOCKS4请求
+	buffer := make([]byte, 1024)
+	n, err := conn.Read(buffer)
+	if err != nil || n < 8 {
+		s.recordConnection(false, 0)
+		return fmt.Errorf("读取SOCKS4请求失败")
+	}
+
+	// 解析请求
+	version := buffer[0]
+	command := buffer[1]
+
+	if version != 4 {
+		s.recordConnection(false, 0)
+		return fmt.Errorf("无效的SOCKS版本: %d", version)
+	}
+
+	// SOCKS4 不支持密码认证，隧道要求认证时直接拒绝
+	if s.authRequired() {
+		conn.Write([]byte{0, 91, 0, 0, 0, 0, 0, 0}) // 91 = 请求被拒绝
+		s.socksStats.authFailures.Add(1)
+		s.recordConnection(false, 0)
+		return fmt.Errorf("隧道要求认证，拒绝SOCKS4请求")
+	}
+
+	if command != 1 { // 只支持CONNECT
+		// 发送失败响应
+		response := []byte{0, 91, 0, 0, 0, 0, 0, 0} // 91 = 请求被拒绝
+		conn.Write(response)
+		s.recordConnection(false, 0)
+		return fmt.Errorf("不支持的SOCKS4命令: %d", command)
+	}
+
+	// 提取目标地址和端口
+	port := (uint16(buffer[2]) << 8) | uint16(buffer[3])
+	ip := net.IPv4(buffer[4], buffer[5], buffer[6], buffer[7])
+	targetAddr := net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+
+	targetConn, err := net.DialTimeout("tcp", targetAddr, s.config.DialTimeout)
+	if err != nil {
+		conn.Write([]byte{0, 91, 0, 0, 0, 0, 0, 0})
+		s.recordConnection(false, 0)
+		return fmt.Errorf("连接目标服务器失败: %w", err)
+	}
+
+	if _, err := conn.Write([]byte{0, 90, 0, 0, 0, 0, 0, 0}); err != nil { // 90 = 请求成功
+		targetConn.Close()
+		s.recordConnection(false, 0)
+		return fmt.Errorf("发送成功响应失败: %w", err)
+	}
+
+	return s.relay(conn, targetConn, targetAddr)
+}
+
+// handleSOCKS5 处理SOCKS5协议
+func (s *SOCKSHandler) handleSOCKS5(ctx context.Context, conn net.Conn) error {
+	// 握手阶段限时，避免半开连接占用资源
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	// 阶段1：认证方法协商
+	username, err := s.negotiateSOCKS5Auth(conn)
+	if err != nil {
+		s.recordConnection(false, 0)
+		return err
+	}
+
+	// 阶段2：请求
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		s.recordConnection(false, 0)
+		return fmt.Errorf("读取SOCKS5请求失败: %w", err)
+	}
+	if header[0] != socks5Version {
+		s.recordConnection(false, 0)
+		return fmt.Errorf("无效的SOCKS5版本: %d", header[0])
+	}
+	command := header[1]
+
+	targetAddr, err := readSOCKSAddr(conn)
+	if err != nil {
+		rep := byte(socksRepGeneralFailure)
+		if errors.Is(err, errSOCKSAddrType) {
+			rep = socksRepAddrNotSupported
+		}
+		writeSOCKS5Reply(conn, rep, nil)
+		s.recordConnection(false, 0)
+		return fmt.Errorf("解析目标地址失败: %w", err)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	s.logger.Debug("SOCKS5请求",
+		zap.Uint8("command", command),
+		zap.String("target_addr", targetAddr),
+		zap.String("username", username))
+
+	switch command {
+	case socksCmdConnect:
+		return s.handleConnect(conn, targetAddr)
+	case socksCmdBind:
+		if !s.config.EnableBind {
+			break
+		}
+		return s.handleBind(ctx, conn, targetAddr)
+	case socksCmdUDPAssociate:
+		if s.config.UDPManager == nil {
+			break
+		}
+		return s.handleUDPAssociate(ctx, conn, targetAddr)
+	}
+
+	writeSOCKS5Reply(conn, socksRepCommandNotSupported, nil)
+	s.recordConnection(false, 0)
+	return fmt.Errorf("不支持的SOCKS5命令: %d", command)
+}
+
+// negotiateSOCKS5Auth 协商认证方法并执行 RFC 1929 用户名密码认证，返回认证用户名
+func (s *SOCKSHandler) negotiateSOCKS5Auth(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", fmt.Errorf("读取SOCKS5认证请求失败: %w", err)
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("无效的SOCKS版本: %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", fmt.Errorf("读取SOCKS5认证方法失败: %w", err)
+	}
+
+	wanted := byte(socksAuthNone)
+	if s.authRequired() {
+		wanted = socksAuthPassword
+	}
+
+	offered := false
+	for _, method := range methods {
+		if method == wanted {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		conn.Write([]byte{socks5Version, socksAuthNoAcceptable})
+		if wanted == socksAuthPassword {
+			s.socksStats.authFailures.Add(1)
+		}
+		return "", fmt.Errorf("客户端未提供可接受的认证方法")
+	}
+
+	if _, err := conn.Write([]byte{socks5Version, wanted}); err != nil {
+		return "", fmt.Errorf("发送认证响应失败: %w", err)
+	}
+	if wanted == socksAuthNone {
+		return "", nil
+	}
+
+	// RFC 1929: VER | ULEN | UNAME | PLEN | PASSWD
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return "", fmt.Errorf("读取认证信息失败: %w", err)
+	}
+	if buf[0] != socksPasswordVersion {
+		return "", fmt.Errorf("无效的认证子协商版本: %d", buf[0])
+	}
+	uname := make([]byte, buf[1])
+	if _, err := io.ReadFull(conn, uname); err != nil {
+		return "", fmt.Errorf("读取用户名失败: %w", err)
+	}
+	if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+		return "", fmt.Errorf("读取密码长度失败: %w", err)
+	}
+	passwd := make([]byte, buf[0])
+	if _, err := io.ReadFull(conn, passwd); err != nil {
+		return "", fmt.Errorf("读取密码失败: %w", err)
+	}
+
+	username := string(uname)
+	if s.config.Credentials == nil || !s.config.Credentials.Verify(s.config.TunnelID, username, string(passwd)) {
+		conn.Write([]byte{socksPasswordVersion, 0x01})
+		s.socksStats.authFailures.Add(1)
+		s.logger.Warn("SOCKS5认证失败",
+			zap.String("remote_addr", conn.RemoteAddr().String()),
+			zap.String("username", username))
+		return "", fmt.Errorf("SOCKS5认证失败: %s", username)
+	}
+
+	if _, err := conn.Write([]byte{socksPasswordVersion, 0x00}); err != nil {
+		return "", fmt.Errorf("发送认证结果失败: %w", err)
+	}
+	return username, nil
+}
+
+// handleConnect 处理CONNECT命令
+func (s *SOCKSHandler) handleConnect(conn net.Conn, targetAddr string) error {
+	targetConn, err := net.DialTimeout("tcp", targetAddr, s.config.DialTimeout)
+	if err != nil {
+		writeSOCKS5Reply(conn, dialErrorReply(err), nil)
+		s.recordConnection(false, 0)
+		return fmt.Errorf("连接目标服务器失败: %w", err)
+	}
+
+	if err := writeSOCKS5Reply(conn, socksRepSuccess, targetConn.LocalAddr()); err != nil {
+		targetConn.Close()
+		s.recordConnection(false, 0)
+		return fmt.Errorf("发送成功响应失败: %w", err)
+	}
+
+	return s.relay(conn, targetConn, targetAddr)
+}
+
+// handleBind 处理BIND命令：监听临时端口，等待目标主机回连后中继
+func (s *SOCKSHandler) handleBind(ctx context.Context, conn net.Conn, targetAddr string) error {
+	s.socksStats.bindRequests.Add(1)
+
+	localIP := hostIP(conn.LocalAddr())
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: localIP})
+	if err != nil {
+		writeSOCKS5Reply(conn, socksRepGeneralFailure, nil)
+		s.recordConnection(false, 0)
+		return fmt.Errorf("BIND监听失败: %w", err)
+	}
+	defer listener.Close()
+
+	// 第一次回复：公布监听地址
+	if err := writeSOCKS5Reply(conn, socksRepSuccess, s.advertiseAddr(listener.Addr())); err != nil {
+		s.recordConnection(false, 0)
+		return fmt.Errorf("发送BIND响应失败: %w", err)
+	}
+
+	// 只接受来自请求中目标主机的连接
+	expectedIPs := resolveHostIPs(targetAddr)
+
+	// 控制连接关闭或超时时停止等待
+	bindCtx, cancel := context.WithTimeout(ctx, s.config.BindTimeout)
+	defer cancel()
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		io.Copy(io.Discard, conn)
+		cancel()
+	}()
+	go func() {
+		<-bindCtx.Done()
+		listener.Close()
+	}()
+
+	var inbound net.Conn
+	for {
+		c, err := listener.Accept()
+		if err != nil {
+			writeSOCKS5Reply(conn, socksRepTTLExpired, nil)
+			s.recordConnection(false, 0)
+			return fmt.Errorf("BIND等待入站连接失败: %w", err)
+		}
+		if len(expectedIPs) > 0 && !containsIP(expectedIPs, hostIP(c.RemoteAddr())) {
+			s.logger.Warn("拒绝非目标主机的BIND入站连接",
+				zap.String("remote_addr", c.RemoteAddr().String()),
+				zap.String("expected", targetAddr))
+			c.Close()
+			continue
+		}
+		inbound = c
+		break
+	}
+
+	// 停止控制连接上的读取，交由中继接管
+	conn.SetReadDeadline(time.Now())
+	<-watchDone
+	conn.SetReadDeadline(time.Time{})
+
+	// 第二次回复：入站连接的来源地址
+	if err := writeSOCKS5Reply(conn, socksRepSuccess, inbound.RemoteAddr()); err != nil {
+		inbound.Close()
+		s.recordConnection(false, 0)
+		return fmt.Errorf("发送BIND连接响应失败: %w", err)
+	}
+
+	return s.relay(conn, inbound, inbound.RemoteAddr().String())
+}
+
+// handleUDPAssociate 处理UDP ASSOCIATE命令：分配UDP中继端口，按目标地址建立udp会话
+func (s *SOCKSHandler) handleUDPAssociate(ctx context.Context, conn net.Conn, clientHint string) error {
+	s.socksStats.udpAssociations.Add(1)
+
+	clientIP := hostIP(conn.RemoteAddr())
+	relayConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: hostIP(conn.LocalAddr())})
+	if err != nil {
+		writeSOCKS5Reply(conn, socksRepGeneralFailure, nil)
+		s.recordConnection(false, 0)
+		return fmt.Errorf("UDP中继监听失败: %w", err)
+	}
+
+	assoc := &udpAssociation{
+		handler:   s,
+		relayConn: relayConn,
+		clientIP:  clientIP,
+		sessions:  make(map[string]struct{}),
+		resolved:  make(map[string]*net.UDPAddr),
+		logger:    s.logger.With(zap.String("client", conn.RemoteAddr().String())),
+	}
+
+	// 客户端在请求中声明了发送端口时，只接受该端口的报文
+	if _, portStr, err := net.SplitHostPort(clientHint); err == nil {
+		if port, _ := strconv.Atoi(portStr); port != 0 {
+			assoc.clientPort = port
+		}
+	}
+
+	if err := writeSOCKS5Reply(conn, socksRepSuccess, s.advertiseAddr(relayConn.LocalAddr())); err != nil {
+		relayConn.Close()
+		s.recordConnection(false, 0)
+		return fmt.Errorf("发送UDP ASSOCIATE响应失败: %w", err)
+	}
+
+	s.logger.Info("建立UDP关联",
+		zap.String("client", conn.RemoteAddr().String()),
+		zap.String("relay_addr", relayConn.LocalAddr().String()))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assoc.serve()
+	}()
+
+	// 关联的生命周期跟随控制连接（RFC 1928 第7节）
+	ctrlDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-ctrlDone:
+		}
+	}()
+	io.Copy(io.Discard, conn)
+	close(ctrlDone)
+
+	relayConn.Close()
+	<-done
+	assoc.close()
+
+	total := assoc.bytesUp.Load() + assoc.bytesDown.Load()
+	s.recordConnection(true, total)
+
+	s.logger.Info("UDP关联结束",
+		zap.String("client", conn.RemoteAddr().String()),
+		zap.Int64("bytes_up", assoc.bytesUp.Load()),
+		zap.Int64("bytes_down", assoc.bytesDown.Load()))
+
+	return nil
+}
+
+// relay 双向中继并记录统计
+func (s *SOCKSHandler) relay(conn, targetConn net.Conn, targetAddr string) error {
+	defer targetConn.Close()
+
+	relay := NewRelayConnection(conn, targetConn)
+	if err := relay.Start(); err != nil {
+		s.recordConnection(false, 0)
+		return err
+	}
+
+	relay.Wait()
+	stats := relay.GetStats()
+	totalBytes := stats["total_bytes"].(int64)
+	s.recordConnection(true, totalBytes)
+
+	s.logger.Info("SOCKS连接处理完成",
+		zap.String("target_addr", targetAddr),
+		zap.Int64("bytes_transferred", totalBytes))
+
+	return nil
+}
+
+// advertiseAddr 回复中公布的地址，配置了 AdvertiseIP 时替换IP
+func (s *SOCKSHandler) advertiseAddr(addr net.Addr) net.Addr {
+	if s.config.AdvertiseIP == "" {
+		return addr
+	}
+	ip := net.ParseIP(s.config.AdvertiseIP)
+	if ip == nil {
+		return addr
+	}
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return &net.TCPAddr{IP: ip, Port: a.Port}
+	case *net.UDPAddr:
+		return &net.UDPAddr{IP: ip, Port: a.Port}
+	}
+	return addr
+}
+
+// GetStats 获取统计信息
+func (s *SOCKSHandler) GetStats() map[string]interface{} {
+	stats := s.BaseHandler.GetStats()
+	stats["auth_required"] = s.authRequired()
+	stats["auth_failures"] = s.socksStats.authFailures.Load()
+	stats["udp_associations"] = s.socksStats.udpAssociations.Load()
+	stats["udp_packets"] = s.socksStats.udpPackets.Load()
+	stats["udp_dropped"] = s.socksStats.udpDropped.Load()
+	stats["bind_requests"] = s.socksStats.bindRequests.Load()
+	return stats
+}
+
+// udpAssociation 一个UDP ASSOCIATE关联：客户端报文经中继端口进入，按目标地址分配udp会话
+type udpAssociation struct {
+	handler    *SOCKSHandler
+	relayConn  *net.UDPConn
+	clientIP   net.IP
+	clientPort int
+
+	mu         sync.Mutex
+	clientAddr *net.UDPAddr            // 首个合法报文确定的客户端地址
+	sessions   map[string]struct{}     // 本关联创建的udp会话ID
+	resolved   map[string]*net.UDPAddr // 域名解析缓存
+
+	bytesUp   atomic.Int64
+	bytesDown atomic.Int64
+	logger    *zap.Logger
+}
+
+// serve 读取客户端报文并转发
+func (a *udpAssociation) serve() {
+	buffer := make([]byte, a.handler.config.UDPBuffer)
+	for {
+		n, from, err := a.relayConn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		if !a.acceptFrom(from) {
+			a.handler.socksStats.udpDropped.Add(1)
+			continue
+		}
+		if err := a.forward(buffer[:n], from); err != nil {
+			a.handler.socksStats.udpDropped.Add(1)
+			a.logger.Debug("丢弃UDP报文", zap.Error(err))
+		}
+	}
+}
+
+// acceptFrom 只接受来自控制连接客户端的报文，首个报文锁定客户端端口
+func (a *udpAssociation) acceptFrom(from *net.UDPAddr) bool {
+	if !from.IP.Equal(a.clientIP) {
+		return false
+	}
+	if a.clientPort != 0 && from.Port != a.clientPort {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.clientAddr == nil {
+		a.clientAddr = from
+		return true
+	}
+	return a.clientAddr.Port == from.Port
+}
+
+// forward 解析SOCKS5 UDP报头并经udp会话发往目标
+func (a *udpAssociation) forward(packet []byte, from *net.UDPAddr) error {
+	target, payload, err := parseSOCKSUDPPacket(packet)
+	if err != nil {
+		return err
+	}
+
+	targetAddr, err := a.resolve(target)
+	if err != nil {
+		return err
+	}
+
+	tuple, err := udp.ParseFiveTuple(from, targetAddr, "udp")
+	if err != nil {
+		return err
+	}
+
+	manager := a.handler.config.UDPManager
+	session, err := manager.GetRelaySession(tuple, from, targetAddr, a.reply)
+	if err != nil {
+		return fmt.Errorf("获取UDP会话失败: %w", err)
+	}
+
+	a.mu.Lock()
+	a.sessions[session.GetID()] = struct{}{}
+	a.mu.Unlock()
+
+	n, err := session.WriteToServer(payload)
+	if err != nil {
+		return err
+	}
+	a.bytesUp.Add(int64(n))
+	a.handler.socksStats.udpPackets.Add(1)
+	return nil
+}
+
+// reply 为目标回包添加SOCKS5 UDP报头后发回客户端
+func (a *udpAssociation) reply(data []byte, from *net.UDPAddr) error {
+	a.mu.Lock()
+	clientAddr := a.clientAddr
+	a.mu.Unlock()
+	if clientAddr == nil {
+		return fmt.Errorf("客户端地址未知")
+	}
+
+	packet := make([]byte, 0, len(data)+22)
+	packet = append(packet, 0, 0, 0) // RSV RSV FRAG
+	packet = appendSOCKSAddr(packet, from)
+	packet = append(packet, data...)
+
+	if _, err := a.relayConn.WriteToUDP(packet, clientAddr); err != nil {
+		return err
+	}
+	a.bytesDown.Add(int64(len(data)))
+	a.handler.socksStats.udpPackets.Add(1)
+	return nil
+}
+
+// resolve 解析目标地址（带缓存）
+func (a *udpAssociation) resolve(target string) (*net.UDPAddr, error) {
+	a.mu.Lock()
+	addr, ok := a.resolved[target]
+	a.mu.Unlock()
+	if ok {
+		return addr, nil
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, fmt.Errorf("解析目标地址失败: %w", err)
+	}
+
+	a.mu.Lock()
+	if len(a.resolved) < 1024 {
+		a.resolved[target] = addr
+	}
+	a.mu.Unlock()
+	return addr, nil
+}
+
+// close 移除本关联创建的全部udp会话
+func (a *udpAssociation) close() {
+	a.mu.Lock()
+	ids := make([]string, 0, len(a.sessions))
+	for id := range a.sessions {
+		ids = append(ids, id)
+	}
+	a.mu.Unlock()
+
+	for _, id := range ids {
+		// 会话可能已被空闲清理移除
+		a.handler.config.UDPManager.RemoveSession(id)
+	}
+}
+
+// readSOCKSAddr 读取 ATYP | DST.ADDR | DST.PORT，返回 host:port
+func readSOCKSAddr(r io.Reader) (string, error) {
+	atyp := make([]byte, 1)
+	if _, err := io.ReadFull(r, atyp); err != nil {
+		return "", err
+	}
+
+	var host string
+	switch atyp[0] {
+	case socksAtypIPv4, socksAtypIPv6:
+		size := net.IPv4len
+		if atyp[0] == socksAtypIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socksAtypDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(r, length); err != nil {
+			return "", err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		return "", fmt.Errorf("%w: %d", errSOCKSAddrType, atyp[0])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// parseSOCKSUDPPacket 解析 RSV | FRAG | ATYP | DST.ADDR | DST.PORT | DATA
+func parseSOCKSUDPPacket(packet []byte) (string, []byte, error) {
+	if len(packet) < 4 {
+		return "", nil, fmt.Errorf("UDP报文过短")
+	}
+	// 不支持分片，按RFC 1928丢弃
+	if packet[2] != 0 {
+		return "", nil, fmt.Errorf("不支持UDP分片: %d", packet[2])
+	}
+
+	r := bytes.NewReader(packet[3:])
+	target, err := readSOCKSAddr(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("解析UDP报头失败: %w", err)
+	}
+	return target, packet[len(packet)-r.Len():], nil
+}
+
+// appendSOCKSAddr 追加 ATYP | ADDR | PORT
+func appendSOCKSAddr(buf []byte, addr net.Addr) []byte {
+	ip := hostIP(addr)
+	port := 0
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		port = a.Port
+	case *net.UDPAddr:
+		port = a.Port
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		buf = append(buf, socksAtypIPv4)
+		buf = append(buf, ip4...)
+	} else if ip16 := ip.To16(); ip16 != nil {
+		buf = append(buf, socksAtypIPv6)
+		buf = append(buf, ip16...)
+	} else {
+		buf = append(buf, socksAtypIPv4, 0, 0, 0, 0)
+	}
+	return binary.BigEndian.AppendUint16(buf, uint16(port))
+}
+
+// writeSOCKS5Reply 发送 VER | REP | RSV | BND.ADDR | BND.PORT
+func writeSOCKS5Reply(conn net.Conn, rep byte, bound net.Addr) error {
+	reply := []byte{socks5Version, rep, 0}
+	if bound == nil {
+		reply = append(reply, socksAtypIPv4, 0, 0, 0, 0, 0, 0)
+	} else {
+		reply = appendSOCKSAddr(reply, bound)
+	}
+	_, err := conn.Write(reply)
+	return err
+}
+
+// dialErrorReply 将拨号错误映射为SOCKS5回复码
+func dialErrorReply(err error) byte {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return socksRepConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return socksRepNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return socksRepHostUnreachable
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return socksRepHostUnreachable
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return socksRepHostUnreachable
+	}
+	return socksRepGeneralFailure
+}
+
+// hostIP 提取地址中的IP
+func hostIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return net.ParseIP(host)
+	}
+	return nil
+}
+
+// resolveHostIPs 解析 host:port 中的主机IP，未指定地址（0.0.0.0）时返回空
+func resolveHostIPs(address string) []net.IP {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsUnspecified() {
+			return nil
+		}
+		return []net.IP{ip}
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	return ips
+}
+
+// containsIP 检查IP是否在列表中
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, candidate := range ips {
+		if candidate.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"gkipass/client/internal/detector"
+)
+
+// testCredentials 创建包含 alice/secret 凭据的隧道凭据存储
+func testCredentials(tunnelID string) *CredentialStore {
+	sum := sha256.Sum256([]byte("salt" + "secret"))
+	store := NewCredentialStore()
+	store.SetTunnelCredentials(tunnelID, []ProxyCredential{
+		{Username: "alice", PasswordHash: hex.EncodeToString(sum[:]), Salt: "salt"},
+	})
+	return store
+}
+
+// startEchoTarget 启动回显目标，返回监听地址
+func startEchoTarget(t *testing.T) *net.TCPAddr {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动回显服务失败: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr)
+}
+
+// serveHandler 在本地监听上用处理器接收一个连接，返回客户端连接
+func serveHandler(t *testing.T, handler Handler, protocol detector.Protocol) net.Conn {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动代理监听失败: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		handler.Handle(context.Background(), conn, &detector.DetectionResult{Protocol: protocol, Confidence: 1})
+	}()
+
+	conn, err := net.DialTimeout("tcp", l.Addr().String(), 2*time.Second)
+	if err != nil {
+		t.Fatalf("连接代理失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// socks5Connect 以用户名密码认证发起 SOCKS5 CONNECT，返回认证状态与请求回复码
+func socks5Connect(t *testing.T, conn net.Conn, username, password string, target *net.TCPAddr) (byte, byte) {
+	t.Helper()
+	return socks5Request(t, conn, username, password, socksCmdConnect, target)
+}
+
+// socks5Request 以用户名密码认证发起 SOCKS5 请求，返回认证状态与请求回复码
+func socks5Request(t *testing.T, conn net.Conn, username, password string, command byte, target *net.TCPAddr) (byte, byte) {
+	t.Helper()
+	conn.Write([]byte{socks5Version, 1, socksAuthPassword})
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil {
+		t.Fatalf("读取认证方法失败: %v", err)
+	}
+	if method[1] != socksAuthPassword {
+		t.Fatalf("服务端应要求用户名密码认证，实际 %#x", method[1])
+	}
+
+	auth := []byte{socksPasswordVersion, byte(len(username))}
+	auth = append(auth, username...)
+	auth = append(auth, byte(len(password)))
+	auth = append(auth, password...)
+	conn.Write(auth)
+	status := make([]byte, 2)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		t.Fatalf("读取认证结果失败: %v", err)
+	}
+	if status[1] != 0x00 {
+		return status[1], 0
+	}
+
+	req := []byte{socks5Version, command, 0x00, socksAtypIPv4}
+	req = append(req, target.IP.To4()...)
+	req = binary.BigEndian.AppendUint16(req, uint16(target.Port))
+	conn.Write(req)
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("读取请求回复失败: %v", err)
+	}
+	return status[1], reply[1]
+}
+
+// TestSOCKS5_Auth 正确凭据可建立 CONNECT 隧道，错误密码与未提供认证方法被拒绝
+func TestSOCKS5_Auth(t *testing.T) {
+	target := startEchoTarget(t)
+	newHandler := func() *SOCKSHandler {
+		return NewSOCKSHandler(&SOCKSConfig{TunnelID: "tunnel-1", Credentials: testCredentials("tunnel-1")})
+	}
+
+	conn := serveHandler(t, newHandler(), detector.ProtocolSOCKS5)
+	status, rep := socks5Connect(t, conn, "alice", "secret", target)
+	if status != 0x00 || rep != socksRepSuccess {
+		t.Fatalf("正确凭据应认证并连接成功，实际认证 %#x 回复 %#x", status, rep)
+	}
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("应经隧道收到回显，实际 %q (%v)", buf, err)
+	}
+
+	handler := newHandler()
+	conn = serveHandler(t, handler, detector.ProtocolSOCKS5)
+	if status, _ := socks5Connect(t, conn, "alice", "wrong", target); status == 0x00 {
+		t.Error("错误密码应认证失败")
+	}
+	if got := handler.socksStats.authFailures.Load(); got != 1 {
+		t.Errorf("认证失败计数应为 1，实际 %d", got)
+	}
+
+	conn = serveHandler(t, newHandler(), detector.ProtocolSOCKS5)
+	conn.Write([]byte{socks5Version, 1, socksAuthNone})
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil || method[1] != socksAuthNoAcceptable {
+		t.Errorf("配置凭据后无认证请求应被拒绝，实际 %#x (%v)", method[1], err)
+	}
+}
+
+// TestSOCKS5_EmptyCredentialsDenied 隧道凭据为空时拒绝所有用户，不会退化为无需认证
+func TestSOCKS5_EmptyCredentialsDenied(t *testing.T) {
+	target := startEchoTarget(t)
+	store := testCredentials("tunnel-1")
+	store.SetTunnelCredentials("tunnel-1", nil)
+	newHandler := func() *SOCKSHandler {
+		return NewSOCKSHandler(&SOCKSConfig{TunnelID: "tunnel-1", Credentials: store, RequireAuth: true})
+	}
+
+	conn := serveHandler(t, newHandler(), detector.ProtocolSOCKS5)
+	if status, _ := socks5Connect(t, conn, "alice", "secret", target); status == 0x00 {
+		t.Error("凭据已清空时原有用户不应认证成功")
+	}
+
+	conn = serveHandler(t, newHandler(), detector.ProtocolSOCKS5)
+	conn.Write([]byte{socks5Version, 1, socksAuthNone})
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil || method[1] != socksAuthNoAcceptable {
+		t.Errorf("凭据为空时无认证请求应被拒绝，实际 %#x (%v)", method[1], err)
+	}
+}
+
+// TestSOCKS5_BindDisabledByDefault 默认配置不开放 BIND，规则显式开启后才允许
+func TestSOCKS5_BindDisabledByDefault(t *testing.T) {
+	target := startEchoTarget(t)
+	config := DefaultSOCKSConfig()
+	config.TunnelID = "tunnel-1"
+	config.Credentials = testCredentials("tunnel-1")
+	config.RequireAuth = true
+
+	conn := serveHandler(t, NewSOCKSHandler(config), detector.ProtocolSOCKS5)
+	if status, rep := socks5Request(t, conn, "alice", "secret", socksCmdBind, target); status != 0x00 || rep != socksRepCommandNotSupported {
+		t.Errorf("未开启 BIND 时应回复命令不支持，实际认证 %#x 回复 %#x", status, rep)
+	}
+
+	enabled := *config
+	enabled.EnableBind = true
+	conn = serveHandler(t, NewSOCKSHandler(&enabled), detector.ProtocolSOCKS5)
+	if status, rep := socks5Request(t, conn, "alice", "secret", socksCmdBind, target); status != 0x00 || rep != socksRepSuccess {
+		t.Errorf("开启 BIND 后应返回监听地址，实际认证 %#x 回复 %#x", status, rep)
+	}
+}
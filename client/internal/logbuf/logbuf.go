@@ -0,0 +1,301 @@
+package logbuf
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultCapacity 内存中保留的最近日志条数
+const DefaultCapacity = 2000
+
+// Entry 一条日志记录
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Logger  string                 `json:"logger,omitempty"`
+	Message string                 `json:"message"`
+	Caller  string                 `json:"caller,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+var (
+	level  = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	buffer = newRing(DefaultCapacity)
+	subs   = newSubscribers()
+)
+
+// TunnelID 条目关联的隧道（tunnel_id 或 rule_id 字段）
+func (e *Entry) TunnelID() string {
+	for _, key := range []string{"tunnel_id", "rule_id"} {
+		if v, ok := e.Fields[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Level 进程日志级别，创建日志核心时使用，运行中可由面板远程命令修改
+func Level() zap.AtomicLevel {
+	return level
+}
+
+// ParseLevel 解析日志级别（debug/info/warn/error）
+func ParseLevel(name string) (zapcore.Level, error) {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return l, fmt.Errorf("无效的日志级别: %s", name)
+	}
+	return l, nil
+}
+
+// SetLevel 修改日志级别，返回修改前的级别
+func SetLevel(name string) (string, error) {
+	l, err := ParseLevel(name)
+	if err != nil {
+		return "", err
+	}
+	previous := level.Level().String()
+	level.SetLevel(l)
+	return previous, nil
+}
+
+// NewCore 创建写入最近日志缓冲区和实时订阅的日志核心，与输出核心一起通过 zapcore.NewTee 挂载
+func NewCore() zapcore.Core {
+	return &ringCore{ring: buffer, enabler: level}
+}
+
+// Recent 返回最近的日志（按时间正序），minLevel 为空时不过滤级别
+func Recent(limit int, minLevel string) ([]Entry, error) {
+	min := zapcore.DebugLevel
+	if minLevel != "" {
+		l, err := ParseLevel(minLevel)
+		if err != nil {
+			return nil, err
+		}
+		min = l
+	}
+	return buffer.recent(limit, Filter{MinLevel: min}), nil
+}
+
+// RecentMatching 返回最近符合过滤条件的日志（按时间正序）
+func RecentMatching(limit int, filter Filter) []Entry {
+	return buffer.recent(limit, filter)
+}
+
+// Filter 日志过滤条件
+type Filter struct {
+	MinLevel  zapcore.Level
+	TunnelIDs map[string]bool // 非空时只匹配关联这些隧道的日志
+}
+
+func (f *Filter) match(l zapcore.Level, entry *Entry) bool {
+	if l < f.MinLevel {
+		return false
+	}
+	return len(f.TunnelIDs) == 0 || f.TunnelIDs[entry.TunnelID()]
+}
+
+// Subscription 实时日志订阅：新日志按过滤条件写入 C，C 满时丢弃并计数，不阻塞日志调用方
+type Subscription struct {
+	C       <-chan Entry
+	ch      chan Entry
+	filter  Filter
+	dropped atomic.Int64
+	once    sync.Once
+}
+
+// TakeDropped 返回并清零自上次调用以来丢弃的条数
+func (s *Subscription) TakeDropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// Close 取消订阅并关闭 C
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		subs.remove(s)
+		close(s.ch)
+	})
+}
+
+// Subscribe 订阅新日志；级别低于进程日志级别的日志在订阅期间也会被采集（只推送给订阅方，不输出也不进入缓冲区）
+func Subscribe(filter Filter, size int) *Subscription {
+	if size <= 0 {
+		size = 1024
+	}
+	ch := make(chan Entry, size)
+	sub := &Subscription{C: ch, ch: ch, filter: filter}
+	subs.add(sub)
+	return sub
+}
+
+// subscribers 当前订阅及其中最低的日志级别
+type subscribers struct {
+	mu      sync.RWMutex
+	set     map[*Subscription]struct{}
+	capture atomic.Int32 // 订阅要求的最低级别，无订阅时为 zapcore.FatalLevel+1
+}
+
+func newSubscribers() *subscribers {
+	s := &subscribers{set: make(map[*Subscription]struct{})}
+	s.updateCapture()
+	return s
+}
+
+func (s *subscribers) add(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set[sub] = struct{}{}
+	s.updateCapture()
+}
+
+func (s *subscribers) remove(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.set, sub)
+	s.updateCapture()
+}
+
+func (s *subscribers) updateCapture() {
+	min := zapcore.FatalLevel + 1
+	for sub := range s.set {
+		if sub.filter.MinLevel < min {
+			min = sub.filter.MinLevel
+		}
+	}
+	s.capture.Store(int32(min))
+}
+
+func (s *subscribers) enabled(l zapcore.Level) bool {
+	return int32(l) >= s.capture.Load()
+}
+
+func (s *subscribers) publish(l zapcore.Level, entry *Entry) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for sub := range s.set {
+		if !sub.filter.match(l, entry) {
+			continue
+		}
+		select {
+		case sub.ch <- *entry:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// ring 固定容量的环形日志缓冲区
+type ring struct {
+	mu      sync.Mutex
+	entries []Entry
+	levels  []zapcore.Level
+	next    int
+	full    bool
+}
+
+func newRing(capacity int) *ring {
+	return &ring{
+		entries: make([]Entry, capacity),
+		levels:  make([]zapcore.Level, capacity),
+	}
+}
+
+func (r *ring) add(l zapcore.Level, entry Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = entry
+	r.levels[r.next] = l
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+func (r *ring) recent(limit int, filter Filter) []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	size := r.next
+	if r.full {
+		size = len(r.entries)
+	}
+	if limit <= 0 || limit > size {
+		limit = size
+	}
+
+	// 从最新一条向前收集，再翻转为时间正序
+	result := make([]Entry, 0, limit)
+	for i := 1; i <= size && len(result) < limit; i++ {
+		idx := (r.next - i + len(r.entries)) % len(r.entries)
+		if filter.match(r.levels[idx], &r.entries[idx]) {
+			result = append(result, r.entries[idx])
+		}
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// ringCore 把日志写入环形缓冲区并分发给实时订阅的 zapcore.Core
+type ringCore struct {
+	ring    *ring
+	enabler zapcore.LevelEnabler
+	fields  []zapcore.Field
+}
+
+func (c *ringCore) Enabled(l zapcore.Level) bool {
+	return c.enabler.Enabled(l) || subs.enabled(l)
+}
+
+func (c *ringCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &ringCore{ring: c.ring, enabler: c.enabler}
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(clone.fields, c.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return clone
+}
+
+func (c *ringCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *ringCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	entry := Entry{
+		Time:    ent.Time,
+		Level:   ent.Level.String(),
+		Logger:  ent.LoggerName,
+		Message: ent.Message,
+	}
+	if ent.Caller.Defined {
+		entry.Caller = ent.Caller.TrimmedPath()
+	}
+	if len(c.fields)+len(fields) > 0 {
+		enc := zapcore.NewMapObjectEncoder()
+		for _, f := range c.fields {
+			f.AddTo(enc)
+		}
+		for _, f := range fields {
+			f.AddTo(enc)
+		}
+		entry.Fields = enc.Fields
+	}
+	if c.enabler.Enabled(ent.Level) {
+		c.ring.add(ent.Level, entry)
+	}
+	subs.publish(ent.Level, &entry)
+	return nil
+}
+
+func (c *ringCore) Sync() error {
+	return nil
+}
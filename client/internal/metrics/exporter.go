@@ -0,0 +1,291 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	"gkipass/client/internal/monitoring"
+	"gkipass/client/internal/pool"
+	"gkipass/client/internal/tunnel"
+)
+
+// Config 本地指标端点配置
+type Config struct {
+	ListenAddr string `json:"listen_addr"` // 监听地址，默认仅本机
+	Port       int    `json:"port"`        // 监听端口
+	Path       string `json:"path"`        // 指标路径
+}
+
+// DefaultConfig 默认本地指标端点配置
+func DefaultConfig() *Config {
+	return &Config{
+		ListenAddr: "127.0.0.1",
+		Port:       9090,
+		Path:       "/metrics",
+	}
+}
+
+// 节点本地指标，统一使用 gkipass_client_ 前缀，避免与面板导出的同名指标冲突
+var (
+	cpuDesc = prometheus.NewDesc("gkipass_client_cpu_usage_percent",
+		"节点 CPU 使用率（%）", nil, nil)
+	memoryDesc = prometheus.NewDesc("gkipass_client_memory_used_bytes",
+		"节点已用内存（字节）", nil, nil)
+	memoryPercentDesc = prometheus.NewDesc("gkipass_client_memory_usage_percent",
+		"节点内存使用率（%）", nil, nil)
+	uptimeDesc = prometheus.NewDesc("gkipass_client_uptime_seconds",
+		"节点进程运行时长（秒）", nil, nil)
+	networkBytesDesc = prometheus.NewDesc("gkipass_client_network_bytes_total",
+		"网卡累计流量（字节）", []string{"direction"}, nil)
+	networkPacketsDesc = prometheus.NewDesc("gkipass_client_network_packets_total",
+		"网卡累计数据包数", []string{"direction"}, nil)
+	networkErrorsDesc = prometheus.NewDesc("gkipass_client_network_errors_total",
+		"网络错误次数", nil, nil)
+	appActiveConnsDesc = prometheus.NewDesc("gkipass_client_active_connections",
+		"当前活跃连接数", nil, nil)
+	appConnsDesc = prometheus.NewDesc("gkipass_client_connections_total",
+		"累计连接数", nil, nil)
+	appFailedConnsDesc = prometheus.NewDesc("gkipass_client_failed_connections_total",
+		"累计失败连接数", nil, nil)
+	appRequestsDesc = prometheus.NewDesc("gkipass_client_requests_total",
+		"累计处理请求数", nil, nil)
+	appRequestsFailedDesc = prometheus.NewDesc("gkipass_client_requests_failed_total",
+		"累计失败请求数", nil, nil)
+	appProtocolDesc = prometheus.NewDesc("gkipass_client_protocol_connections_total",
+		"按协议统计的累计连接数", []string{"protocol"}, nil)
+
+	tunnelBytesDesc = prometheus.NewDesc("gkipass_client_tunnel_traffic_bytes_total",
+		"隧道累计流量（字节）", []string{"tunnel_id", "tunnel_name", "direction"}, nil)
+	tunnelConnsDesc = prometheus.NewDesc("gkipass_client_tunnel_connections_total",
+		"隧道累计连接数", []string{"tunnel_id", "tunnel_name"}, nil)
+	tunnelActiveConnsDesc = prometheus.NewDesc("gkipass_client_tunnel_active_connections",
+		"隧道当前活跃连接数", []string{"tunnel_id", "tunnel_name"}, nil)
+	tunnelFailedConnsDesc = prometheus.NewDesc("gkipass_client_tunnel_failed_connections_total",
+		"隧道累计失败连接数", []string{"tunnel_id", "tunnel_name"}, nil)
+
+	poolLabels   = []string{"pool", "target", "transport"}
+	poolSizeDesc = prometheus.NewDesc("gkipass_client_pool_size",
+		"连接池当前连接数", poolLabels, nil)
+	poolInUseDesc = prometheus.NewDesc("gkipass_client_pool_connections_in_use",
+		"连接池中正在使用的连接数", poolLabels, nil)
+	poolConnsDesc = prometheus.NewDesc("gkipass_client_pool_connections_total",
+		"连接池累计创建的连接数", poolLabels, nil)
+	poolFailedDesc = prometheus.NewDesc("gkipass_client_pool_failed_connections_total",
+		"连接池累计建连失败数", poolLabels, nil)
+	poolHitsDesc = prometheus.NewDesc("gkipass_client_pool_hits_total",
+		"连接池命中次数", poolLabels, nil)
+	poolMissesDesc = prometheus.NewDesc("gkipass_client_pool_misses_total",
+		"连接池未命中次数", poolLabels, nil)
+	poolScalingDesc = prometheus.NewDesc("gkipass_client_pool_scaling_events_total",
+		"连接池扩缩容次数", poolLabels, nil)
+	poolQualityDesc = prometheus.NewDesc("gkipass_client_pool_average_quality",
+		"连接池平均连接质量", poolLabels, nil)
+)
+
+// poolMetrics 连接池统计字段与指标的对应关系
+var poolMetrics = []struct {
+	key       string
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+}{
+	{"pool_size", poolSizeDesc, prometheus.GaugeValue},
+	{"connections_in_use", poolInUseDesc, prometheus.GaugeValue},
+	{"total_connections", poolConnsDesc, prometheus.CounterValue},
+	{"failed_connections", poolFailedDesc, prometheus.CounterValue},
+	{"pool_hits", poolHitsDesc, prometheus.CounterValue},
+	{"pool_misses", poolMissesDesc, prometheus.CounterValue},
+	{"scaling_events", poolScalingDesc, prometheus.CounterValue},
+	{"average_quality", poolQualityDesc, prometheus.GaugeValue},
+}
+
+// collector 抓取时从监控管理器、连接池和隧道运行时读取实时统计
+type collector struct {
+	monitor *monitoring.Manager
+	pools   *pool.Manager
+	tunnels *tunnel.Manager
+}
+
+// Describe 实现 prometheus.Collector
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		cpuDesc, memoryDesc, memoryPercentDesc, uptimeDesc,
+		networkBytesDesc, networkPacketsDesc, networkErrorsDesc,
+		appActiveConnsDesc, appConnsDesc, appFailedConnsDesc, appRequestsDesc, appRequestsFailedDesc, appProtocolDesc,
+		tunnelBytesDesc, tunnelConnsDesc, tunnelActiveConnsDesc, tunnelFailedConnsDesc,
+	} {
+		ch <- desc
+	}
+	for _, pm := range poolMetrics {
+		ch <- pm.desc
+	}
+}
+
+// Collect 实现 prometheus.Collector
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	if c.monitor != nil {
+		c.collectMonitoring(ch)
+	}
+	if c.pools != nil {
+		c.collectPools(ch)
+	}
+	if c.tunnels != nil {
+		c.collectTunnels(ch)
+	}
+}
+
+func (c *collector) collectMonitoring(ch chan<- prometheus.Metric) {
+	sample := c.monitor.Snapshot()
+	sys, network, app := sample.SystemStats, sample.NetworkStats, sample.AppStats
+
+	ch <- prometheus.MustNewConstMetric(cpuDesc, prometheus.GaugeValue, sys.CPUPercent)
+	ch <- prometheus.MustNewConstMetric(memoryDesc, prometheus.GaugeValue, float64(sys.MemoryUsage))
+	ch <- prometheus.MustNewConstMetric(memoryPercentDesc, prometheus.GaugeValue, sys.MemoryPercent)
+	ch <- prometheus.MustNewConstMetric(uptimeDesc, prometheus.GaugeValue, float64(sys.Uptime))
+
+	ch <- prometheus.MustNewConstMetric(networkBytesDesc, prometheus.CounterValue, float64(network.BytesIn), "in")
+	ch <- prometheus.MustNewConstMetric(networkBytesDesc, prometheus.CounterValue, float64(network.BytesOut), "out")
+	ch <- prometheus.MustNewConstMetric(networkPacketsDesc, prometheus.CounterValue, float64(network.PacketsIn), "in")
+	ch <- prometheus.MustNewConstMetric(networkPacketsDesc, prometheus.CounterValue, float64(network.PacketsOut), "out")
+	ch <- prometheus.MustNewConstMetric(networkErrorsDesc, prometheus.CounterValue, float64(network.Errors))
+
+	ch <- prometheus.MustNewConstMetric(appActiveConnsDesc, prometheus.GaugeValue, float64(app.ActiveConnections))
+	ch <- prometheus.MustNewConstMetric(appConnsDesc, prometheus.CounterValue, float64(app.TotalConnections))
+	ch <- prometheus.MustNewConstMetric(appFailedConnsDesc, prometheus.CounterValue, float64(app.FailedConnections))
+	ch <- prometheus.MustNewConstMetric(appRequestsDesc, prometheus.CounterValue, float64(app.RequestsProcessed))
+	ch <- prometheus.MustNewConstMetric(appRequestsFailedDesc, prometheus.CounterValue, float64(app.RequestsFailed))
+	for protocol, count := range app.ProtocolCounts {
+		ch <- prometheus.MustNewConstMetric(appProtocolDesc, prometheus.CounterValue, float64(count), protocol)
+	}
+}
+
+func (c *collector) collectPools(ch chan<- prometheus.Metric) {
+	for key, stats := range c.pools.PoolStats() {
+		target, _ := stats["target_addr"].(string)
+		transportType, _ := stats["transport_type"].(string)
+		for _, pm := range poolMetrics {
+			value, ok := statFloat(stats[pm.key])
+			if !ok {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(pm.desc, pm.valueType, value, key, target, transportType)
+		}
+	}
+}
+
+func (c *collector) collectTunnels(ch chan<- prometheus.Metric) {
+	for _, t := range c.tunnels.TunnelStats() {
+		ch <- prometheus.MustNewConstMetric(tunnelBytesDesc, prometheus.CounterValue, float64(t.BytesIn), t.TunnelID, t.TunnelName, "in")
+		ch <- prometheus.MustNewConstMetric(tunnelBytesDesc, prometheus.CounterValue, float64(t.BytesOut), t.TunnelID, t.TunnelName, "out")
+		ch <- prometheus.MustNewConstMetric(tunnelConnsDesc, prometheus.CounterValue, float64(t.TotalConns), t.TunnelID, t.TunnelName)
+		ch <- prometheus.MustNewConstMetric(tunnelActiveConnsDesc, prometheus.GaugeValue, float64(t.ActiveConns), t.TunnelID, t.TunnelName)
+		ch <- prometheus.MustNewConstMetric(tunnelFailedConnsDesc, prometheus.CounterValue, float64(t.FailedConns), t.TunnelID, t.TunnelName)
+	}
+}
+
+// statFloat 把 GetStats 返回的数值字段转换为 float64
+func statFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// Exporter 节点本地 Prometheus 指标端点
+type Exporter struct {
+	config   *Config
+	registry *prometheus.Registry
+	server   *http.Server
+	logger   *zap.Logger
+}
+
+// NewExporter 创建本地指标端点，数据源为 nil 时跳过对应指标
+func NewExporter(config *Config, monitor *monitoring.Manager, pools *pool.Manager, tunnels *tunnel.Manager) *Exporter {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	def := DefaultConfig()
+	if config.ListenAddr == "" {
+		config.ListenAddr = def.ListenAddr
+	}
+	if config.Port <= 0 {
+		config.Port = def.Port
+	}
+	if config.Path == "" {
+		config.Path = def.Path
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		&collector{monitor: monitor, pools: pools, tunnels: tunnels},
+	)
+
+	return &Exporter{
+		config:   config,
+		registry: registry,
+		logger:   zap.L().Named("metrics"),
+	}
+}
+
+// Registry 返回指标注册表
+func (e *Exporter) Registry() *prometheus.Registry {
+	return e.registry
+}
+
+// Start 启动指标 HTTP 服务
+func (e *Exporter) Start() error {
+	addr := net.JoinHostPort(e.config.ListenAddr, strconv.Itoa(e.config.Port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("监听指标端口失败: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(e.config.Path, promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{}))
+	e.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := e.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.logger.Error("指标服务异常退出", zap.Error(err))
+		}
+	}()
+
+	e.logger.Info("📈 Prometheus 指标端点已启动",
+		zap.String("addr", listener.Addr().String()),
+		zap.String("path", e.config.Path))
+	return nil
+}
+
+// Stop 停止指标 HTTP 服务
+func (e *Exporter) Stop() error {
+	if e.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return e.server.Shutdown(ctx)
+}
@@ -418,6 +418,11 @@ func (m *Manager) GetStats() map[string]interface{} {
 	}
 }
 
+// Snapshot 获取当前统计快照
+func (m *Manager) Snapshot() StatsSample {
+	return m.createStatsSample()
+}
+
 // GetHistoricalStats 获取历史统计
 func (m *Manager) GetHistoricalStats(since time.Time) []StatsSample {
 	m.history.mutex.RLock()
@@ -1,7 +1,9 @@
 package multiplex
 
 import (
+	"container/heap"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -21,8 +23,20 @@ type SessionConfig struct {
 	PingInterval         time.Duration // Ping间隔
 	PingTimeout          time.Duration // Ping超时
 	EnableFlowControl    bool          // 启用流控制
+	DrainTimeout         time.Duration // GO_AWAY后等待存量流结束的最长时间
 }
 
+const (
+	// maxDataChunk 单个数据帧的最大负载，限制单帧占用连接的时间以便高优先级流插队
+	maxDataChunk = 16 * 1024
+
+	// controlPriority 控制帧（窗口更新、PING、GO_AWAY等）的发送优先级
+	controlPriority = 255
+)
+
+// ErrSessionDraining 会话已收到或发出GO_AWAY，不再接受新流
+var ErrSessionDraining = errors.New("会话正在排空，不再接受新流")
+
 // DefaultSessionConfig 默认会话配置
 func DefaultSessionConfig() *SessionConfig {
 	return &SessionConfig{
@@ -33,6 +47,7 @@ func DefaultSessionConfig() *SessionConfig {
 		PingInterval:         30 * time.Second,
 		PingTimeout:          10 * time.Second,
 		EnableFlowControl:    true,
+		DrainTimeout:         30 * time.Second,
 	}
 }
 
@@ -50,18 +65,22 @@ type Session struct {
 	// 帧处理
 	frameReader *FrameReader
 	frameWriter *FrameWriter
-	writeMutex  sync.Mutex
+	writeSched  writeScheduler // 按优先级调度写入
 
 	// 流控制
 	connectionSendWindow atomic.Int64
 	connectionRecvWindow atomic.Int64
 
 	// 状态管理
-	closed      atomic.Bool
-	closeReason atomic.Value // ErrorCode
-	ctx         context.Context
-	cancel      context.CancelFunc
-	wg          sync.WaitGroup
+	closed       atomic.Bool
+	closeReason  atomic.Value // ErrorCode
+	goingAway    atomic.Bool  // 本端已发送GO_AWAY
+	remoteGoAway atomic.Bool  // 对端已发送GO_AWAY
+	drainOnce    sync.Once
+	lastRecv     atomic.Int64 // 最近一次收到帧的时间（UnixNano）
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
 
 	// 通知通道
 	acceptCh chan *Stream
@@ -114,6 +133,7 @@ func NewSession(conn net.Conn, config *SessionConfig, isClient bool) *Session {
 	// 设置连接级别的流控窗口
 	session.connectionSendWindow.Store(config.InitialWindowSize)
 	session.connectionRecvWindow.Store(config.InitialWindowSize)
+	session.lastRecv.Store(time.Now().UnixNano())
 
 	// 创建帧读写器
 	session.frameReader = NewFrameReader(conn)
@@ -149,10 +169,11 @@ func (s *Session) CloseWithError(errorCode ErrorCode) error {
 
 		s.closeReason.Store(errorCode)
 
-		// 发送GO_AWAY帧
+		// 发送GO_AWAY帧（限时，避免对端不读时阻塞关闭）
 		lastStreamID := s.getLastStreamID()
 		frame := NewGoAwayFrame(lastStreamID, uint32(errorCode), nil)
-		s.writeFrame(frame)
+		s.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		s.sendFrame(frame, controlPriority)
 
 		// 取消上下文
 		if s.cancel != nil {
@@ -179,6 +200,76 @@ func (s *Session) IsClosed() bool {
 	return s.closed.Load()
 }
 
+// Done 返回会话关闭时关闭的通道
+func (s *Session) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// IsDraining 检查会话是否处于排空状态（任一端发送过GO_AWAY）
+func (s *Session) IsDraining() bool {
+	return s.goingAway.Load() || s.remoteGoAway.Load()
+}
+
+// NumStreams 获取活跃流数量
+func (s *Session) NumStreams() int {
+	s.streamsMutex.RLock()
+	defer s.streamsMutex.RUnlock()
+	return len(s.streams)
+}
+
+// LocalAddr 返回底层连接的本地地址
+func (s *Session) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// RemoteAddr 返回底层连接的远端地址
+func (s *Session) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// GoAway 优雅关闭：通知对端不再接受新流，存量流结束（或超时）后关闭会话
+func (s *Session) GoAway() error {
+	if s.IsClosed() {
+		return nil
+	}
+	if !s.goingAway.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	s.logger.Info("发送GO_AWAY，开始排空会话", zap.Int("active_streams", s.NumStreams()))
+
+	frame := NewGoAwayFrame(s.getLastStreamID(), uint32(ErrorCodeNoError), nil)
+	err := s.writeFrame(frame)
+	s.startDrain()
+	return err
+}
+
+// startDrain 等待存量流结束后关闭会话
+func (s *Session) startDrain() {
+	s.drainOnce.Do(func() {
+		go func() {
+			timer := time.NewTimer(s.config.DrainTimeout)
+			defer timer.Stop()
+
+			ticker := time.NewTicker(100 * time.Millisecond)
+			defer ticker.Stop()
+
+			for s.NumStreams() > 0 {
+				select {
+				case <-ticker.C:
+				case <-timer.C:
+					s.logger.Warn("会话排空超时，强制关闭", zap.Int("active_streams", s.NumStreams()))
+					s.CloseWithError(ErrorCodeNoError)
+					return
+				case <-s.ctx.Done():
+					return
+				}
+			}
+			s.Close()
+		}()
+	})
+}
+
 // OpenStream 打开新流
 func (s *Session) OpenStream() (*Stream, error) {
 	return s.OpenStreamWithPriority(0)
@@ -189,6 +280,9 @@ func (s *Session) OpenStreamWithPriority(priority uint8) (*Stream, error) {
 	if s.IsClosed() {
 		return nil, fmt.Errorf("会话已关闭")
 	}
+	if s.IsDraining() {
+		return nil, ErrSessionDraining
+	}
 
 	// 检查并发流限制
 	s.streamsMutex.RLock()
@@ -266,14 +360,23 @@ func (s *Session) Ping(data []byte) error {
 	return s.writeFrame(frame)
 }
 
-// writeFrame 写入帧
+// writeFrame 以控制帧优先级写入帧
 func (s *Session) writeFrame(frame *Frame) error {
+	return s.writeFrameWithPriority(frame, controlPriority)
+}
+
+// writeFrameWithPriority 按优先级写入帧，多个写入方竞争时高优先级先写
+func (s *Session) writeFrameWithPriority(frame *Frame, priority uint8) error {
 	if s.IsClosed() {
 		return fmt.Errorf("会话已关闭")
 	}
+	return s.sendFrame(frame, priority)
+}
 
-	s.writeMutex.Lock()
-	defer s.writeMutex.Unlock()
+// sendFrame 获取写入权后写入帧（不检查会话状态，用于关闭时发送GO_AWAY）
+func (s *Session) sendFrame(frame *Frame, priority uint8) error {
+	s.writeSched.acquire(priority)
+	defer s.writeSched.release()
 
 	if err := s.frameWriter.WriteFrame(frame); err != nil {
 		return err
@@ -299,19 +402,25 @@ func (s *Session) readLoop() {
 
 		frame, err := s.frameReader.ReadFrame()
 		if err != nil {
-			if err != io.EOF && !s.IsClosed() {
-				s.logger.Error("读取帧失败", zap.Error(err))
-				s.CloseWithError(ErrorCodeProtocolError)
+			// CloseWithError会等待本协程退出，需异步调用
+			if !s.IsClosed() {
+				if err == io.EOF || s.IsDraining() {
+					go s.CloseWithError(ErrorCodeNoError)
+				} else {
+					s.logger.Error("读取帧失败", zap.Error(err))
+					go s.CloseWithError(ErrorCodeProtocolError)
+				}
 			}
 			return
 		}
 
+		s.lastRecv.Store(time.Now().UnixNano())
 		s.stats.framesReceived.Add(1)
 		s.stats.bytesReceived.Add(int64(frame.Length + FrameHeaderLength))
 
 		if err := s.handleFrame(frame); err != nil {
 			s.logger.Error("处理帧失败", zap.Error(err))
-			s.CloseWithError(ErrorCodeProtocolError)
+			go s.CloseWithError(ErrorCodeProtocolError)
 			return
 		}
 	}
@@ -350,7 +459,7 @@ func (s *Session) handleStreamFrame(frame *Frame) error {
 	stream, exists := s.GetStream(frame.StreamID)
 	if !exists {
 		// 流不存在，可能已经关闭
-		s.logger.Warn("流不存在", zap.Uint32("stream_id", uint32(frame.StreamID)))
+		s.logger.Debug("流不存在", zap.Uint32("stream_id", uint32(frame.StreamID)))
 		return nil
 	}
 
@@ -367,12 +476,12 @@ func (s *Session) handleStreamOpenFrame(frame *Frame) error {
 		return s.writeFrame(resetFrame)
 	}
 
-	// 检查并发流限制
+	// 检查并发流限制，本端排空时拒绝新流
 	s.streamsMutex.RLock()
 	activeStreams := len(s.streams)
 	s.streamsMutex.RUnlock()
 
-	if activeStreams >= int(s.config.MaxConcurrentStreams) {
+	if activeStreams >= int(s.config.MaxConcurrentStreams) || s.goingAway.Load() {
 		resetFrame := NewStreamResetFrame(streamID, uint32(ErrorCodeRefusedStream))
 		return s.writeFrame(resetFrame)
 	}
@@ -435,8 +544,16 @@ func (s *Session) handleGoAwayFrame(frame *Frame) error {
 		zap.Uint32("last_stream_id", uint32(lastStreamID)),
 		zap.String("error", errorCode.String()))
 
-	// 关闭会话
-	return s.CloseWithError(errorCode)
+	// 异常关闭立即关闭会话（异步，避免在读取循环中等待自身退出）
+	if errorCode != ErrorCodeNoError {
+		go s.CloseWithError(errorCode)
+		return nil
+	}
+
+	// 正常GO_AWAY：不再打开新流，存量流结束后关闭
+	s.remoteGoAway.Store(true)
+	s.startDrain()
+	return nil
 }
 
 // handleSettingsFrame 处理设置帧
@@ -461,6 +578,14 @@ func (s *Session) pingLoop() {
 				return
 			}
 
+			// 超过Ping间隔+超时未收到任何帧，判定连接失效
+			silence := time.Since(time.Unix(0, s.lastRecv.Load()))
+			if silence > s.config.PingInterval+s.config.PingTimeout {
+				s.logger.Warn("会话心跳超时", zap.Duration("silence", silence))
+				go s.CloseWithError(ErrorCodeInternalError)
+				return
+			}
+
 			// 发送Ping
 			pingData := []byte(fmt.Sprintf("%d", time.Now().UnixNano()))
 			if err := s.Ping(pingData); err != nil {
@@ -497,22 +622,19 @@ func (s *Session) cleanupIdleStreams() {
 	now := time.Now().Unix()
 	timeout := int64(s.config.StreamIdleTimeout.Seconds())
 
-	s.streamsMutex.Lock()
-	defer s.streamsMutex.Unlock()
-
-	var toRemove []StreamID
-	for id, stream := range s.streams {
+	s.streamsMutex.RLock()
+	var idle []*Stream
+	for _, stream := range s.streams {
 		if now-stream.lastActivity.Load() > timeout {
-			toRemove = append(toRemove, id)
+			idle = append(idle, stream)
 		}
 	}
+	s.streamsMutex.RUnlock()
 
-	for _, id := range toRemove {
-		stream := s.streams[id]
+	// Reset会移除流，需在锁外调用
+	for _, stream := range idle {
 		stream.Reset(ErrorCodeCancel)
-		delete(s.streams, id)
-		s.stats.streamsClosed.Add(1)
-		s.logger.Debug("清理空闲流", zap.Uint32("stream_id", uint32(id)))
+		s.logger.Debug("清理空闲流", zap.Uint32("stream_id", uint32(stream.id)))
 	}
 }
 
@@ -589,6 +711,7 @@ func (s *Session) GetStats() map[string]interface{} {
 
 	return map[string]interface{}{
 		"is_client":              s.isClient,
+		"draining":               s.IsDraining(),
 		"active_streams":         activeStreams,
 		"streams_created":        s.stats.streamsCreated.Load(),
 		"streams_closed":         s.stats.streamsClosed.Load(),
@@ -604,6 +727,72 @@ func (s *Session) GetStats() map[string]interface{} {
 	}
 }
 
+// writeScheduler 写入调度器：同一时刻只有一个写入方，等待者按优先级（高优先）和到达顺序获得写入权
+type writeScheduler struct {
+	mu      sync.Mutex
+	busy    bool
+	seq     uint64
+	waiters writeWaiterHeap
+}
+
+type writeWaiter struct {
+	priority uint8
+	seq      uint64
+	ready    chan struct{}
+}
+
+// acquire 获取写入权
+func (ws *writeScheduler) acquire(priority uint8) {
+	ws.mu.Lock()
+	if !ws.busy {
+		ws.busy = true
+		ws.mu.Unlock()
+		return
+	}
+
+	ws.seq++
+	w := &writeWaiter{priority: priority, seq: ws.seq, ready: make(chan struct{})}
+	heap.Push(&ws.waiters, w)
+	ws.mu.Unlock()
+
+	<-w.ready
+}
+
+// release 释放写入权，直接移交给优先级最高的等待者
+func (ws *writeScheduler) release() {
+	ws.mu.Lock()
+	if ws.waiters.Len() == 0 {
+		ws.busy = false
+		ws.mu.Unlock()
+		return
+	}
+	w := heap.Pop(&ws.waiters).(*writeWaiter)
+	ws.mu.Unlock()
+
+	close(w.ready)
+}
+
+// writeWaiterHeap 等待者优先队列
+type writeWaiterHeap []*writeWaiter
+
+func (h writeWaiterHeap) Len() int { return len(h) }
+func (h writeWaiterHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h writeWaiterHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *writeWaiterHeap) Push(x any)   { *h = append(*h, x.(*writeWaiter)) }
+func (h *writeWaiterHeap) Pop() any {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return w
+}
+
 // FrameReader 帧读取器
 type FrameReader struct {
 	reader io.Reader
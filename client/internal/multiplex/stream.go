@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -65,6 +67,13 @@ type Stream struct {
 	readNotify  chan struct{}
 	writeNotify chan struct{}
 	closeNotify chan struct{}
+	closeOnce   sync.Once
+
+	// 读写截止时间（time.Time）
+	readDeadline  atomic.Value
+	writeDeadline atomic.Value
+
+	pendingWindow int64 // 已消费但尚未通告给对端的接收窗口（受readMutex保护）
 
 	// 统计信息
 	bytesRead    atomic.Int64
@@ -88,11 +97,17 @@ type Stream struct {
 func NewStream(id StreamID, session *Session, initialWindow int64) *Stream {
 	ctx, cancel := context.WithCancel(session.ctx)
 
+	// 读缓冲区不小于接收窗口，对端在窗口内发送的数据总能放下
+	readBufSize := 32 * 1024
+	if initialWindow > int64(readBufSize) {
+		readBufSize = int(initialWindow)
+	}
+
 	stream := &Stream{
 		id:            id,
 		session:       session,
 		priority:      0,
-		readBuf:       NewRingBuffer(32 * 1024), // 32KB读缓冲
+		readBuf:       NewRingBuffer(readBufSize),
 		writeBuf:      NewRingBuffer(32 * 1024), // 32KB写缓冲
 		maxRecvWindow: initialWindow,
 		readNotify:    make(chan struct{}, 1),
@@ -120,6 +135,11 @@ func (s *Stream) ID() StreamID {
 	return s.id
 }
 
+// Priority 获取流优先级（数值越大越优先发送）
+func (s *Stream) Priority() uint8 {
+	return s.priority
+}
+
 // State 获取流状态
 func (s *Stream) State() StreamState {
 	return StreamState(s.state.Load())
@@ -140,15 +160,10 @@ func (s *Stream) Read(p []byte) (n int, err error) {
 	s.readMutex.Lock()
 	defer s.readMutex.Unlock()
 
-	// 检查流状态
-	if s.readClosed.Load() {
-		return 0, io.EOF
-	}
-
-	// 从缓冲区读取数据
 	for {
-		n, err = s.readBuf.Read(p)
-		if n > 0 {
+		// 优先读取缓冲区中的数据（读取端关闭前已到达的数据仍可读出）
+		if s.readBuf.Len() > 0 {
+			n, _ = s.readBuf.Read(p)
 			s.bytesRead.Add(int64(n))
 			s.updateActivity()
 
@@ -157,20 +172,25 @@ func (s *Stream) Read(p []byte) (n int, err error) {
 			return n, nil
 		}
 
-		if err != nil {
-			return 0, err
+		if s.readClosed.Load() {
+			return 0, io.EOF
 		}
 
 		// 缓冲区为空，等待数据
+		deadline, timer := s.deadlineTimer(&s.readDeadline)
 		select {
 		case <-s.readNotify:
 			// 有新数据到达，继续读取
-			continue
 		case <-s.closeNotify:
-			return 0, io.EOF
 		case <-s.ctx.Done():
-			return 0, s.ctx.Err()
+			if s.readBuf.Len() == 0 {
+				stopTimer(timer)
+				return 0, io.EOF
+			}
+		case <-deadline:
+			return 0, os.ErrDeadlineExceeded
 		}
+		stopTimer(timer)
 	}
 }
 
@@ -179,39 +199,45 @@ func (s *Stream) Write(p []byte) (n int, err error) {
 	s.writeMutex.Lock()
 	defer s.writeMutex.Unlock()
 
-	// 检查流状态
-	if s.writeClosed.Load() {
-		return 0, fmt.Errorf("流已关闭写入")
-	}
-
 	remaining := len(p)
 	written := 0
 
 	for remaining > 0 {
-		// 检查发送窗口
+		// 检查流状态
+		if s.writeClosed.Load() {
+			return written, fmt.Errorf("流已关闭写入")
+		}
+
+		// 检查发送窗口，窗口耗尽时阻塞等待对端消费（流级背压）
 		window := s.sendWindow.Load()
 		if window <= 0 {
-			// 等待窗口更新
+			deadline, timer := s.deadlineTimer(&s.writeDeadline)
 			select {
 			case <-s.writeNotify:
+				stopTimer(timer)
 				continue
 			case <-s.ctx.Done():
-				return written, s.ctx.Err()
+				return written, io.ErrClosedPipe
+			case <-deadline:
+				return written, os.ErrDeadlineExceeded
 			}
 		}
 
-		// 计算本次可发送的数据量
+		// 计算本次可发送的数据量，单帧不超过maxDataChunk以便按优先级交替发送
 		chunkSize := remaining
 		if int64(chunkSize) > window {
 			chunkSize = int(window)
 		}
+		if chunkSize > maxDataChunk {
+			chunkSize = maxDataChunk
+		}
 
 		// 准备数据帧
 		chunk := p[written : written+chunkSize]
 		frame := NewDataFrame(s.id, chunk, false)
 
-		// 发送帧
-		if err := s.session.writeFrame(frame); err != nil {
+		// 按流优先级发送帧
+		if err := s.session.writeFrameWithPriority(frame, s.priority); err != nil {
 			return written, err
 		}
 
@@ -226,16 +252,19 @@ func (s *Stream) Write(p []byte) (n int, err error) {
 	return written, nil
 }
 
-// Close 关闭流
+// Close 关闭流（通知对端写入结束并释放流）
 func (s *Stream) Close() error {
-	return s.CloseWrite()
+	err := s.CloseWrite()
+	s.CloseRead()
+	s.session.removeStream(s.id)
+	return err
 }
 
 // CloseRead 关闭读取端
 func (s *Stream) CloseRead() error {
 	if s.readClosed.CompareAndSwap(false, true) {
 		s.logger.Debug("关闭流读取端")
-		close(s.closeNotify)
+		s.closeOnce.Do(func() { close(s.closeNotify) })
 		s.notifyRead()
 	}
 	return nil
@@ -245,14 +274,18 @@ func (s *Stream) CloseRead() error {
 func (s *Stream) CloseWrite() error {
 	if s.writeClosed.CompareAndSwap(false, true) {
 		s.logger.Debug("关闭流写入端")
+		s.notifyWrite()
 
 		// 发送流关闭帧
 		frame := NewStreamCloseFrame(s.id)
-		if err := s.session.writeFrame(frame); err != nil {
+		if err := s.session.writeFrameWithPriority(frame, s.priority); err != nil {
 			return err
 		}
 
-		s.notifyWrite()
+		// 双向均已关闭，释放流
+		if s.readClosed.Load() {
+			s.session.removeStream(s.id)
+		}
 	}
 	return nil
 }
@@ -263,13 +296,11 @@ func (s *Stream) Reset(errorCode ErrorCode) error {
 
 	// 发送重置帧
 	frame := NewStreamResetFrame(s.id, uint32(errorCode))
-	if err := s.session.writeFrame(frame); err != nil {
-		return err
-	}
+	err := s.session.writeFrame(frame)
 
-	// 关闭流
-	s.forceClose()
-	return nil
+	// 关闭并释放流
+	s.session.removeStream(s.id)
+	return err
 }
 
 // forceClose 强制关闭流
@@ -285,7 +316,7 @@ func (s *Stream) forceClose() {
 	// 通知所有等待的操作
 	s.notifyRead()
 	s.notifyWrite()
-	close(s.closeNotify)
+	s.closeOnce.Do(func() { close(s.closeNotify) })
 }
 
 // IsClosed 检查流是否已关闭
@@ -373,32 +404,90 @@ func (s *Stream) handleWindowUpdateFrame(frame *Frame) error {
 func (s *Stream) handleStreamCloseFrame(frame *Frame) error {
 	s.logger.Debug("收到流关闭帧")
 	s.CloseRead()
+
+	// 双向均已关闭，释放流
+	if s.writeClosed.Load() {
+		s.session.removeStream(s.id)
+	}
 	return nil
 }
 
 // handleStreamResetFrame 处理流重置帧
 func (s *Stream) handleStreamResetFrame(frame *Frame) error {
 	errorCode := ErrorCode(frame.GetErrorCode())
-	s.logger.Info("收到流重置帧", zap.String("error", errorCode.String()))
-	s.forceClose()
+	s.logger.Debug("收到流重置帧", zap.String("error", errorCode.String()))
+	s.session.removeStream(s.id)
 	return nil
 }
 
-// updateRecvWindow 更新接收窗口
+// updateRecvWindow 更新接收窗口（调用方持有readMutex）
 func (s *Stream) updateRecvWindow(consumed int64) {
-	// 如果消费了超过窗口一半的数据，发送窗口更新
-	if consumed > s.maxRecvWindow/2 {
-		increment := uint32(consumed)
-		frame := NewWindowUpdateFrame(s.id, increment)
-
-		if err := s.session.writeFrame(frame); err != nil {
-			s.logger.Error("发送窗口更新失败", zap.Error(err))
-		} else {
-			s.recvWindow.Add(consumed)
-			s.logger.Debug("发送窗口更新",
-				zap.Uint32("increment", increment),
-				zap.Int64("new_window", s.recvWindow.Load()))
-		}
+	// 累计消费超过窗口一半时发送窗口更新
+	s.pendingWindow += consumed
+	if s.pendingWindow < s.maxRecvWindow/2 {
+		return
+	}
+
+	increment := uint32(s.pendingWindow)
+	frame := NewWindowUpdateFrame(s.id, increment)
+
+	if err := s.session.writeFrame(frame); err != nil {
+		s.logger.Debug("发送窗口更新失败", zap.Error(err))
+		return
+	}
+
+	s.recvWindow.Add(s.pendingWindow)
+	s.pendingWindow = 0
+	s.logger.Debug("发送窗口更新",
+		zap.Uint32("increment", increment),
+		zap.Int64("new_window", s.recvWindow.Load()))
+}
+
+// LocalAddr 返回底层连接的本地地址
+func (s *Stream) LocalAddr() net.Addr {
+	return s.session.conn.LocalAddr()
+}
+
+// RemoteAddr 返回底层连接的远端地址
+func (s *Stream) RemoteAddr() net.Addr {
+	return s.session.conn.RemoteAddr()
+}
+
+// SetDeadline 设置读写截止时间
+func (s *Stream) SetDeadline(t time.Time) error {
+	s.SetReadDeadline(t)
+	s.SetWriteDeadline(t)
+	return nil
+}
+
+// SetReadDeadline 设置读截止时间
+func (s *Stream) SetReadDeadline(t time.Time) error {
+	s.readDeadline.Store(t)
+	s.notifyRead()
+	return nil
+}
+
+// SetWriteDeadline 设置写截止时间
+func (s *Stream) SetWriteDeadline(t time.Time) error {
+	s.writeDeadline.Store(t)
+	s.notifyWrite()
+	return nil
+}
+
+// deadlineTimer 根据截止时间创建定时器，未设置截止时间时返回nil通道
+func (s *Stream) deadlineTimer(v *atomic.Value) (<-chan time.Time, *time.Timer) {
+	deadline, _ := v.Load().(time.Time)
+	if deadline.IsZero() {
+		return nil, nil
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	return timer.C, timer
+}
+
+// stopTimer 停止可能为nil的定时器
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
 	}
 }
 
@@ -468,13 +557,11 @@ func (rb *RingBuffer) Write(data []byte) error {
 		return fmt.Errorf("缓冲区空间不足")
 	}
 
-	for i, b := range data {
-		rb.buf[rb.end] = b
-		rb.end = (rb.end + 1) % len(rb.buf)
-		if i == dataLen-1 {
-			rb.size += dataLen
-		}
-	}
+	// 分两段拷贝（尾部 + 回绕到头部）
+	n := copy(rb.buf[rb.end:], data)
+	copy(rb.buf, data[n:])
+	rb.end = (rb.end + dataLen) % len(rb.buf)
+	rb.size += dataLen
 
 	return nil
 }
@@ -493,11 +580,12 @@ func (rb *RingBuffer) Read(p []byte) (n int, err error) {
 		n = rb.size
 	}
 
-	for i := 0; i < n; i++ {
-		p[i] = rb.buf[rb.start]
-		rb.start = (rb.start + 1) % len(rb.buf)
+	// 分两段拷贝（尾部 + 回绕到头部）
+	first := copy(p[:n], rb.buf[rb.start:])
+	if first < n {
+		copy(p[first:n], rb.buf)
 	}
-
+	rb.start = (rb.start + n) % len(rb.buf)
 	rb.size -= n
 	return n, nil
 }
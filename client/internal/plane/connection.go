@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"strings"
 	"sync"
 	"time"
 
@@ -17,6 +16,7 @@ import (
 
 	"gkipass/client/internal/auth"
 	"gkipass/client/internal/identity"
+	"gkipass/client/internal/tracing"
 )
 
 // ConnectionStatus 连接状态
@@ -75,6 +75,10 @@ type Connection struct {
 
 	handlers   map[string]MessageHandler
 	handlersMu sync.RWMutex
+	writeMu    sync.Mutex // websocket 不支持并发写
+
+	rulesVersion func() int64 // 注册时上报的已应用规则版本，面板据此只下发差异
+	certPin      string       // 注册时上报的节点CA公钥固定
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -84,13 +88,14 @@ type Connection struct {
 // MessageHandler 消息处理器
 type MessageHandler func(msg *Message) error
 
-// Message Plane消息
+// Message Plane消息（与面板 ws.Message 格式一致，时间戳为 RFC3339）
 type Message struct {
-	Type      string          `json:"type"`
-	ID        string          `json:"id,omitempty"`
-	Timestamp int64           `json:"timestamp"`
-	Data      json.RawMessage `json:"data"`
-	Error     *MessageError   `json:"error,omitempty"`
+	Type      string            `json:"type"`
+	ID        string            `json:"id,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	Data      json.RawMessage   `json:"data"`
+	Error     *MessageError     `json:"error,omitempty"`
+	Trace     map[string]string `json:"trace,omitempty"` // 链路追踪上下文（W3C traceparent），面板下发的规则同步消息携带
 }
 
 // MessageError 消息错误
@@ -129,9 +134,10 @@ func NewConnection(config *ConnectionConfig, authManager *auth.Manager, identity
 	// 注册内置处理器
 	c.RegisterHandler("ping", c.handlePing)
 	c.RegisterHandler("auth_result", c.handleAuthResult)
+	c.RegisterHandler("register_ack", c.handleAuthResult)
+	c.RegisterHandler("heartbeat", c.handleHeartbeatAck)
 	c.RegisterHandler("config_update", c.handleConfigUpdate)
 	c.RegisterHandler("rule_update", c.handleRuleUpdate)
-	c.RegisterHandler("command", c.handleCommand)
 
 	return c, nil
 }
@@ -177,6 +183,20 @@ func (c *Connection) RegisterHandler(msgType string, handler MessageHandler) {
 	c.handlers[msgType] = handler
 }
 
+// SetRulesVersionProvider 设置注册时上报已应用规则版本的函数
+func (c *Connection) SetRulesVersionProvider(provider func() int64) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	c.rulesVersion = provider
+}
+
+// SetCertPin 设置注册时上报的节点CA公钥固定
+func (c *Connection) SetCertPin(pin string) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	c.certPin = pin
+}
+
 // SendMessage 发送消息
 func (c *Connection) SendMessage(msgType string, data interface{}) error {
 	c.statusMu.RLock()
@@ -186,10 +206,28 @@ func (c *Connection) SendMessage(msgType string, data interface{}) error {
 	}
 	c.statusMu.RUnlock()
 
+	return c.writeMessage(msgType, data, nil)
+}
+
+// SendMessageContext 发送消息并携带 ctx 中的追踪上下文，面板据此把处理过程接入同一条链路
+func (c *Connection) SendMessageContext(ctx context.Context, msgType string, data interface{}) error {
+	c.statusMu.RLock()
+	if c.status != StatusConnected {
+		c.statusMu.RUnlock()
+		return fmt.Errorf("连接未建立，当前状态: %s", c.status)
+	}
+	c.statusMu.RUnlock()
+
+	return c.writeMessage(msgType, data, tracing.Inject(ctx))
+}
+
+// writeMessage 写入消息（不检查连接状态，注册消息在连接建立阶段发送）
+func (c *Connection) writeMessage(msgType string, data interface{}, trace map[string]string) error {
 	msg := &Message{
 		Type:      msgType,
 		ID:        generateMessageID(),
-		Timestamp: time.Now().Unix(),
+		Timestamp: time.Now(),
+		Trace:     trace,
 	}
 
 	if data != nil {
@@ -200,6 +238,13 @@ func (c *Connection) SendMessage(msgType string, data interface{}) error {
 		msg.Data = jsonData
 	}
 
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.conn == nil {
+		return fmt.Errorf("连接未建立")
+	}
+
 	// 设置写超时
 	if c.config.WriteTimeout > 0 {
 		c.conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
@@ -298,13 +343,9 @@ func (c *Connection) connect() error {
 		return fmt.Errorf("不支持的URL协议: %s", u.Scheme)
 	}
 
-	// 确保路径以/ws结尾
-	if !strings.HasSuffix(u.Path, "/ws") {
-		if u.Path == "" || u.Path == "/" {
-			u.Path = "/ws"
-		} else {
-			u.Path = strings.TrimSuffix(u.Path, "/") + "/ws"
-		}
+	// 未指定路径时使用面板节点接入端点
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/ws/node"
 	}
 
 	// 添加查询参数
@@ -355,7 +396,9 @@ func (c *Connection) connect() error {
 		return fmt.Errorf("连接失败: %w", err)
 	}
 
+	c.writeMu.Lock()
 	c.conn = conn
+	c.writeMu.Unlock()
 	c.lastActivity = time.Now()
 
 	c.logger.Info("已连接到Plane服务器",
@@ -374,6 +417,9 @@ func (c *Connection) connect() error {
 
 // closeConnection 关闭连接
 func (c *Connection) closeConnection() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
 	if c.conn != nil {
 		c.conn.Close()
 		c.conn = nil
@@ -383,15 +429,22 @@ func (c *Connection) closeConnection() {
 
 // readLoop 读取消息循环
 func (c *Connection) readLoop() {
+	c.writeMu.Lock()
+	conn := c.conn
+	c.writeMu.Unlock()
+	if conn == nil {
+		return
+	}
+
 	for {
 		// 设置读超时
 		if c.config.ReadTimeout > 0 {
-			c.conn.SetReadDeadline(time.Now().Add(c.config.ReadTimeout))
+			conn.SetReadDeadline(time.Now().Add(c.config.ReadTimeout))
 		}
 
 		// 读取消息
 		var msg Message
-		err := c.conn.ReadJSON(&msg)
+		err := conn.ReadJSON(&msg)
 		if err != nil {
 			c.setLastError(err)
 			c.logger.Error("读取消息失败", zap.Error(err))
@@ -424,8 +477,9 @@ func (c *Connection) heartbeatLoop(ctx context.Context) {
 			return
 		case <-ticker.C:
 			// 发送心跳
-			if err := c.SendMessage("ping", map[string]interface{}{
-				"timestamp": time.Now().Unix(),
+			if err := c.SendMessage("heartbeat", map[string]interface{}{
+				"node_id": c.identityManager.GetNodeID(),
+				"status":  "online",
 			}); err != nil {
 				c.logger.Error("发送心跳失败", zap.Error(err))
 			}
@@ -466,7 +520,7 @@ func (c *Connection) setLastError(err error) {
 	c.lastError = err
 }
 
-// sendAuthMessage 发送认证消息
+// sendAuthMessage 发送节点注册消息（面板要求首条消息为 node_register，以连接密钥认证）
 func (c *Connection) sendAuthMessage() error {
 	// 获取节点ID
 	nodeID := c.identityManager.GetNodeID()
@@ -474,10 +528,15 @@ func (c *Connection) sendAuthMessage() error {
 		return fmt.Errorf("节点ID为空")
 	}
 
-	// 获取认证令牌
-	token := c.authManager.GetAuthResult()
-	if token == nil || !token.Success {
-		return fmt.Errorf("未认证")
+	// 连接密钥：优先使用配置/身份中的令牌，其次使用认证结果
+	ck := c.identityManager.GetAuthToken()
+	if ck == "" {
+		if token := c.authManager.GetAuthResult(); token != nil && token.Success {
+			ck = token.Token
+		}
+	}
+	if ck == "" {
+		return fmt.Errorf("未配置连接密钥")
 	}
 
 	// 获取身份信息
@@ -486,18 +545,29 @@ func (c *Connection) sendAuthMessage() error {
 		return fmt.Errorf("身份信息为空")
 	}
 
-	// 构建认证消息
-	authData := map[string]interface{}{
+	// 构建注册消息
+	registerData := map[string]interface{}{
 		"node_id":     nodeID,
-		"token":       token.Token,
 		"node_name":   identity.NodeName,
+		"ck":          ck,
 		"hardware_id": identity.HardwareID,
 		"system_info": identity.SystemInfo,
 		"timestamp":   time.Now().Unix(),
 	}
 
-	// 发送认证消息
-	return c.SendMessage("auth", authData)
+	c.handlersMu.RLock()
+	rulesVersion := c.rulesVersion
+	certPin := c.certPin
+	c.handlersMu.RUnlock()
+	if rulesVersion != nil {
+		registerData["rules_version"] = rulesVersion()
+	}
+	if certPin != "" {
+		registerData["cert_pin"] = certPin
+	}
+
+	// 发送注册消息
+	return c.writeMessage("node_register", registerData, nil)
 }
 
 // handlePing 处理ping消息
@@ -509,7 +579,12 @@ func (c *Connection) handlePing(msg *Message) error {
 	})
 }
 
-// handleAuthResult 处理认证结果消息
+// handleHeartbeatAck 处理面板心跳响应
+func (c *Connection) handleHeartbeatAck(msg *Message) error {
+	return nil
+}
+
+// handleAuthResult 处理认证结果消息（兼容 register_ack）
 func (c *Connection) handleAuthResult(msg *Message) error {
 	var result struct {
 		Success  bool     `json:"success"`
@@ -585,32 +660,6 @@ func (c *Connection) handleRuleUpdate(msg *Message) error {
 	})
 }
 
-// handleCommand 处理命令消息
-func (c *Connection) handleCommand(msg *Message) error {
-	// 解析命令
-	var command struct {
-		Command string                 `json:"command"`
-		Params  map[string]interface{} `json:"params"`
-	}
-	if err := json.Unmarshal(msg.Data, &command); err != nil {
-		return fmt.Errorf("解析命令失败: %w", err)
-	}
-
-	c.logger.Info("收到命令",
-		zap.String("command", command.Command),
-		zap.Any("params", command.Params))
-
-	// TODO: 执行命令
-
-	// 回复确认
-	return c.SendMessage("command_ack", map[string]interface{}{
-		"status":    "success",
-		"message":   "命令已执行",
-		"command":   command.Command,
-		"timestamp": time.Now().Unix(),
-	})
-}
-
 // generateMessageID 生成消息ID
 func generateMessageID() string {
 	// 生成随机字节
@@ -2,6 +2,7 @@ package plane
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -37,6 +38,10 @@ type Manager struct {
 	config          *Config
 	identityManager *identity.Manager
 	authManager     *auth.Manager
+	connection      *Connection
+	handlers        map[string]MessageHandler // 连接建立前注册的消息处理器
+	rulesVersion    func() int64              // 注册时上报的已应用规则版本
+	certPin         string                    // 注册时上报的节点CA公钥固定
 	logger          *zap.Logger
 
 	ctx    context.Context
@@ -54,10 +59,11 @@ func NewManager(config *Config) *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Manager{
-		config: config,
-		logger: zap.L().Named("plane"),
-		ctx:    ctx,
-		cancel: cancel,
+		config:   config,
+		handlers: make(map[string]MessageHandler),
+		logger:   zap.L().Named("plane"),
+		ctx:      ctx,
+		cancel:   cancel,
 	}
 }
 
@@ -75,6 +81,70 @@ func (m *Manager) SetAuthManager(authManager *auth.Manager) {
 	m.authManager = authManager
 }
 
+// RegisterHandler 注册面板消息处理器（可在连接建立前调用）
+func (m *Manager) RegisterHandler(msgType string, handler MessageHandler) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.handlers[msgType] = handler
+	if m.connection != nil {
+		m.connection.RegisterHandler(msgType, handler)
+	}
+}
+
+// SetCertPin 设置注册时上报的节点CA公钥固定（面板下发给链路上的相邻节点用于证书校验）
+func (m *Manager) SetCertPin(pin string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.certPin = pin
+	if m.connection != nil {
+		m.connection.SetCertPin(pin)
+	}
+}
+
+// SetRulesVersionProvider 设置注册时上报已应用规则版本的函数（重连时面板只下发该版本之后的差异）
+func (m *Manager) SetRulesVersionProvider(provider func() int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.rulesVersion = provider
+	if m.connection != nil {
+		m.connection.SetRulesVersionProvider(provider)
+	}
+}
+
+// SendMessage 向面板发送消息
+func (m *Manager) SendMessage(msgType string, data interface{}) error {
+	m.lock.RLock()
+	connection := m.connection
+	m.lock.RUnlock()
+
+	if connection == nil {
+		return fmt.Errorf("面板连接未建立")
+	}
+	return connection.SendMessage(msgType, data)
+}
+
+// SendMessageContext 发送消息并携带 ctx 中的追踪上下文
+func (m *Manager) SendMessageContext(ctx context.Context, msgType string, data interface{}) error {
+	m.lock.RLock()
+	connection := m.connection
+	m.lock.RUnlock()
+
+	if connection == nil {
+		return fmt.Errorf("面板连接未建立")
+	}
+	return connection.SendMessageContext(ctx, msgType, data)
+}
+
+// IsConnected 是否已连接面板
+func (m *Manager) IsConnected() bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.connection != nil && m.connection.GetStatus() == StatusConnected
+}
+
 // Start 启动面板管理器
 func (m *Manager) Start() error {
 	m.logger.Info("启动面板管理器")
@@ -107,6 +177,9 @@ func (m *Manager) GetStatus() map[string]interface{} {
 	status := map[string]interface{}{
 		"url": m.config.URL,
 	}
+	if m.connection != nil {
+		status["connection"] = m.connection.GetStats()
+	}
 
 	return status
 }
@@ -121,10 +194,45 @@ func (m *Manager) connectionLoop() {
 		return
 	}
 
-	// TODO: 实现连接逻辑
+	connConfig := DefaultConnectionConfig()
+	connConfig.URL = m.config.URL
+	connConfig.APIKey = m.config.APIKey
+	if m.config.ConnectTimeout > 0 {
+		connConfig.ConnectTimeout = m.config.ConnectTimeout
+	}
+	if m.config.ReconnectInterval > 0 {
+		connConfig.ReconnectInterval = m.config.ReconnectInterval
+	}
+	connConfig.MaxReconnectAttempts = m.config.MaxReconnectAttempts
+	if m.config.HeartbeatInterval > 0 {
+		connConfig.HeartbeatInterval = m.config.HeartbeatInterval
+	}
+
+	m.lock.Lock()
+	connection, err := NewConnection(connConfig, m.authManager, m.identityManager)
+	if err != nil {
+		m.lock.Unlock()
+		m.logger.Error("创建面板连接失败", zap.Error(err))
+		return
+	}
+	for msgType, handler := range m.handlers {
+		connection.RegisterHandler(msgType, handler)
+	}
+	if m.rulesVersion != nil {
+		connection.SetRulesVersionProvider(m.rulesVersion)
+	}
+	connection.SetCertPin(m.certPin)
+	m.connection = connection
+	m.lock.Unlock()
+
+	if err := connection.Start(); err != nil {
+		m.logger.Error("启动面板连接失败", zap.Error(err))
+		return
+	}
 
 	// 等待取消
 	<-m.ctx.Done()
+	connection.Stop()
 }
 
 // waitForDependencies 等待依赖
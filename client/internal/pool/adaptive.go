@@ -149,11 +149,14 @@ func (p *AdaptivePool) Start(ctx context.Context) error {
 		zap.Int("min_connections", p.minConnections),
 		zap.Int("max_connections", p.maxConnections))
 
-	// 预创建最小连接数
+	// 预创建最小连接数（创建后放回池中供后续获取）
 	for i := 0; i < p.minConnections; i++ {
-		if _, err := p.createConnection(); err != nil {
+		conn, err := p.createConnection()
+		if err != nil {
 			p.logger.Error("创建初始连接失败", zap.Error(err))
+			continue
 		}
+		p.ReleaseConnection(conn)
 	}
 
 	// 连接预热
@@ -167,7 +170,10 @@ func (p *AdaptivePool) Start(ctx context.Context) error {
 	go p.qualityMonitoring()
 	go p.connectionCleaner()
 	go p.trafficMonitoring()
-	go p.loadBalancer.StartWeightUpdateLoop(p.ctx)
+	go func() {
+		defer p.wg.Done()
+		p.loadBalancer.StartWeightUpdateLoop(p.ctx)
+	}()
 
 	p.logger.Info("✅ 自适应连接池启动完成")
 	return nil
@@ -295,6 +301,7 @@ func (p *AdaptivePool) createConnection() (*PooledConnection, error) {
 	// 添加到池中
 	p.connMutex.Lock()
 	p.connections[connID] = pooledConn
+	poolSize := len(p.connections)
 	p.connMutex.Unlock()
 
 	p.stats.totalConnections.Add(1)
@@ -303,7 +310,7 @@ func (p *AdaptivePool) createConnection() (*PooledConnection, error) {
 	p.logger.Debug("创建新连接",
 		zap.String("conn_id", connID),
 		zap.String("target", p.targetAddr),
-		zap.Int("pool_size", len(p.connections)))
+		zap.Int("pool_size", poolSize))
 
 	return pooledConn, nil
 }
@@ -322,16 +329,35 @@ func (p *AdaptivePool) ReleaseConnection(conn *PooledConnection) {
 
 	// 清理负载均衡器中的过期记录
 	if p.loadBalancer != nil {
+		p.connMutex.RLock()
 		activeIDs := make([]string, 0, len(p.connections))
 		for id := range p.connections {
 			activeIDs = append(activeIDs, id)
 		}
+		p.connMutex.RUnlock()
 		p.loadBalancer.CleanupStaleConnections(activeIDs)
 	}
 
 	p.logger.Debug("释放连接", zap.String("conn_id", conn.id))
 }
 
+// RemoveConnection 关闭连接并将其移出连接池（连接已不可复用时使用）
+func (p *AdaptivePool) RemoveConnection(conn *PooledConnection) error {
+	if conn == nil {
+		return nil
+	}
+
+	p.connMutex.Lock()
+	if _, exists := p.connections[conn.id]; exists {
+		delete(p.connections, conn.id)
+		p.stats.activeConnections.Add(-1)
+	}
+	p.connMutex.Unlock()
+
+	conn.cancel()
+	return conn.conn.Close()
+}
+
 // isConnectionValid 检查连接是否有效
 func (p *AdaptivePool) isConnectionValid(conn *PooledConnection) bool {
 	// 检查连接年龄
@@ -864,6 +890,19 @@ func (p *AdaptivePool) selectByRandom(connections []*PooledConnection) *PooledCo
 	return connections[index]
 }
 
+// SetMinConnections 设置最少保持的连接数（启动前调用），为 0 时不预先建立空闲连接
+func (p *AdaptivePool) SetMinConnections(n int) {
+	if n < 0 {
+		n = 0
+	}
+	p.minConnections = n
+}
+
+// SetPreWarming 设置启动时是否预热连接（启动前调用）
+func (p *AdaptivePool) SetPreWarming(enabled bool) {
+	p.preWarmingEnabled = enabled
+}
+
 // SetLoadBalanceStrategy 设置负载均衡策略
 func (p *AdaptivePool) SetLoadBalanceStrategy(strategy LoadBalanceStrategy) {
 	p.loadBalanceStrategy = strategy
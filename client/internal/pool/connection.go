@@ -82,9 +82,9 @@ func (m *MonitoredConnection) Close() error {
 	return nil
 }
 
-// ForceClose 强制关闭连接
+// ForceClose 强制关闭连接并移出连接池
 func (m *MonitoredConnection) ForceClose() error {
-	return m.Conn.Close()
+	return m.pool.RemoveConnection(m.pooledConn)
 }
 
 // recordRTT 记录RTT样本
@@ -312,6 +312,18 @@ func (pm *PoolManager) GetStats() map[string]interface{} {
 	return stats
 }
 
+// PoolStats 按池键获取各连接池的统计
+func (pm *PoolManager) PoolStats() map[string]map[string]interface{} {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	stats := make(map[string]map[string]interface{}, len(pm.pools))
+	for key, pool := range pm.pools {
+		stats[key] = pool.GetStats()
+	}
+	return stats
+}
+
 // configWatchLoop 配置监控循环
 func (pm *PoolManager) configWatchLoop() {
 	defer pm.wg.Done()
@@ -274,10 +274,13 @@ func DefaultManagerConfig() *ManagerConfig {
 // Manager 端口管理器
 type Manager struct {
 	config    *ManagerConfig
-	ports     map[uint16]*PortInfo     // 端口信息
-	listeners map[uint16]*PortListener // 活跃监听器
+	ports     map[uint16]*PortInfo       // 端口信息
+	listeners map[uint16]*PortListener   // 活跃监听器
+	shared    map[uint16]*SharedListener // 按主机名分发的共享监听
 	mutex     sync.RWMutex
 
+	sharedMutex sync.Mutex // 保护 shared，先于 mutex 获取
+
 	// 统计
 	totalPorts    atomic.Int64
 	occupiedPorts atomic.Int64
@@ -303,6 +306,7 @@ func NewManager(config *ManagerConfig) *Manager {
 		config:    config,
 		ports:     make(map[uint16]*PortInfo),
 		listeners: make(map[uint16]*PortListener),
+		shared:    make(map[uint16]*SharedListener),
 		ctx:       ctx,
 		cancel:    cancel,
 		logger:    zap.L().Named("port-manager"),
@@ -764,8 +768,3 @@ func (m *Manager) GetStats() map[string]interface{} {
 		},
 	}
 }
-
-
-
-
-
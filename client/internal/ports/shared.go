@@ -0,0 +1,354 @@
+package ports
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gkipass/client/internal/detector"
+
+	"go.uber.org/zap"
+)
+
+// sharedOwner 共享监听在端口管理器中的占用者标识
+const sharedOwner = "shared"
+
+// DefaultSharedPeekTimeout 等待首包（ClientHello / 请求头）的默认超时
+const DefaultSharedPeekTimeout = 5 * time.Second
+
+// SharedListener 共享端口监听：预读 TLS SNI 或 HTTP Host，将连接分发给对应隧道
+type SharedListener struct {
+	port        uint16
+	peekTimeout time.Duration
+	detector    *detector.Detector
+
+	exact    map[string]*routeListener // 精确主机名
+	wildcard map[string]*routeListener // *.example.com 去掉 "*" 后的后缀
+	routes   map[string]*routeListener // tunnelID -> 路由
+	mutex    sync.RWMutex
+
+	// 统计
+	totalConns     atomic.Int64
+	unmatchedConns atomic.Int64
+	peekFailures   atomic.Int64
+
+	logger *zap.Logger
+}
+
+// NewSharedListener 创建共享端口监听
+func NewSharedListener(port uint16, peekTimeout time.Duration) *SharedListener {
+	if peekTimeout <= 0 {
+		peekTimeout = DefaultSharedPeekTimeout
+	}
+
+	return &SharedListener{
+		port:        port,
+		peekTimeout: peekTimeout,
+		detector:    detector.NewDetector(nil),
+		exact:       make(map[string]*routeListener),
+		wildcard:    make(map[string]*routeListener),
+		routes:      make(map[string]*routeListener),
+		logger:      zap.L().Named("shared-listener").With(zap.Uint16("port", port)),
+	}
+}
+
+// addRoute 注册隧道路由，主机名与其他隧道冲突时返回错误
+func (sl *SharedListener) addRoute(tunnelID string, hostnames []string, addr net.Addr) (*routeListener, error) {
+	if len(hostnames) == 0 {
+		return nil, fmt.Errorf("隧道 %s 未配置路由主机名", tunnelID)
+	}
+
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	if _, exists := sl.routes[tunnelID]; exists {
+		return nil, fmt.Errorf("隧道 %s 已在端口 %d 注册路由", tunnelID, sl.port)
+	}
+
+	normalized := make([]string, 0, len(hostnames))
+	for _, host := range hostnames {
+		host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+		if host == "" {
+			continue
+		}
+		if owner := sl.lookupLocked(host, true); owner != nil {
+			return nil, fmt.Errorf("主机名 %s 已被隧道 %s 使用", host, owner.tunnelID)
+		}
+		normalized = append(normalized, host)
+	}
+
+	route := newRouteListener(tunnelID, normalized, addr, sl)
+	for _, host := range normalized {
+		if strings.HasPrefix(host, "*.") {
+			sl.wildcard[host[1:]] = route
+		} else {
+			sl.exact[host] = route
+		}
+	}
+	sl.routes[tunnelID] = route
+
+	sl.logger.Info("注册共享端口路由",
+		zap.String("tunnel_id", tunnelID),
+		zap.Strings("hostnames", normalized))
+
+	return route, nil
+}
+
+// removeRoute 移除隧道路由，返回剩余路由数
+func (sl *SharedListener) removeRoute(route *routeListener) int {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	if sl.routes[route.tunnelID] != route {
+		return len(sl.routes)
+	}
+
+	for _, host := range route.hostnames {
+		if strings.HasPrefix(host, "*.") {
+			delete(sl.wildcard, host[1:])
+		} else {
+			delete(sl.exact, host)
+		}
+	}
+	delete(sl.routes, route.tunnelID)
+
+	sl.logger.Info("移除共享端口路由", zap.String("tunnel_id", route.tunnelID))
+	return len(sl.routes)
+}
+
+// lookupLocked 查找主机名对应的路由：精确匹配优先，其次最长通配后缀
+// exactOnly 用于注册冲突检查，只比较完全相同的主机名
+func (sl *SharedListener) lookupLocked(host string, exactOnly bool) *routeListener {
+	if exactOnly {
+		if strings.HasPrefix(host, "*.") {
+			return sl.wildcard[host[1:]]
+		}
+		return sl.exact[host]
+	}
+
+	if route, ok := sl.exact[host]; ok {
+		return route
+	}
+	for i := strings.IndexByte(host, '.'); i >= 0; {
+		if route, ok := sl.wildcard[host[i:]]; ok {
+			return route
+		}
+		next := strings.IndexByte(host[i+1:], '.')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil
+}
+
+// Match 按主机名查找隧道ID
+func (sl *SharedListener) Match(host string) (string, bool) {
+	sl.mutex.RLock()
+	defer sl.mutex.RUnlock()
+
+	route := sl.lookupLocked(strings.TrimSuffix(strings.ToLower(host), "."), false)
+	if route == nil {
+		return "", false
+	}
+	return route.tunnelID, true
+}
+
+// Handle 处理共享端口上的新连接（作为端口监听器的 handler）
+func (sl *SharedListener) Handle(conn net.Conn) {
+	sl.totalConns.Add(1)
+
+	dc := detector.NewDetectingConn(conn, sl.detector, detector.MaxHostnamePeekSize)
+	result, err := dc.PeekHostname(sl.peekTimeout)
+	if err != nil {
+		sl.peekFailures.Add(1)
+		sl.logger.Debug("解析首包主机名失败",
+			zap.String("remote_addr", conn.RemoteAddr().String()),
+			zap.Error(err))
+		conn.Close()
+		return
+	}
+
+	sl.mutex.RLock()
+	route := sl.lookupLocked(result.ServerName, false)
+	sl.mutex.RUnlock()
+
+	if route == nil {
+		sl.unmatchedConns.Add(1)
+		sl.logger.Debug("主机名未匹配任何隧道",
+			zap.String("server_name", result.ServerName),
+			zap.String("remote_addr", conn.RemoteAddr().String()))
+		conn.Close()
+		return
+	}
+
+	if !route.deliver(dc) {
+		conn.Close()
+	}
+}
+
+// GetStats 获取共享监听统计信息
+func (sl *SharedListener) GetStats() map[string]interface{} {
+	sl.mutex.RLock()
+	routes := make(map[string]interface{}, len(sl.routes))
+	for tunnelID, route := range sl.routes {
+		routes[tunnelID] = map[string]interface{}{
+			"hostnames":   route.hostnames,
+			"accepted":    route.accepted.Load(),
+			"queue_depth": len(route.conns),
+		}
+	}
+	sl.mutex.RUnlock()
+
+	return map[string]interface{}{
+		"port":            sl.port,
+		"total_conns":     sl.totalConns.Load(),
+		"unmatched_conns": sl.unmatchedConns.Load(),
+		"peek_failures":   sl.peekFailures.Load(),
+		"routes":          routes,
+	}
+}
+
+// routeListener 单个隧道在共享端口上的监听视图，实现 net.Listener
+type routeListener struct {
+	tunnelID  string
+	hostnames []string
+	addr      net.Addr
+	shared    *SharedListener
+
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+	onClose   func()
+
+	accepted atomic.Int64
+}
+
+func newRouteListener(tunnelID string, hostnames []string, addr net.Addr, shared *SharedListener) *routeListener {
+	return &routeListener{
+		tunnelID:  tunnelID,
+		hostnames: hostnames,
+		addr:      addr,
+		shared:    shared,
+		conns:     make(chan net.Conn, 64),
+		closed:    make(chan struct{}),
+	}
+}
+
+// deliver 投递连接，路由已关闭时返回 false
+func (rl *routeListener) deliver(conn net.Conn) bool {
+	select {
+	case <-rl.closed:
+		return false
+	default:
+	}
+
+	select {
+	case rl.conns <- conn:
+		return true
+	case <-rl.closed:
+		return false
+	}
+}
+
+// Accept 等待分发到该隧道的连接
+func (rl *routeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-rl.conns:
+		rl.accepted.Add(1)
+		return conn, nil
+	case <-rl.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close 关闭路由并从共享监听中移除
+func (rl *routeListener) Close() error {
+	rl.closeOnce.Do(func() {
+		close(rl.closed)
+
+		// 丢弃尚未被接受的连接
+		for len(rl.conns) > 0 {
+			(<-rl.conns).Close()
+		}
+
+		if rl.onClose != nil {
+			rl.onClose()
+		}
+	})
+	return nil
+}
+
+// Addr 返回共享端口地址
+func (rl *routeListener) Addr() net.Addr {
+	return rl.addr
+}
+
+// ListenShared 在共享端口上为隧道注册主机名路由，返回只接收该隧道连接的 net.Listener
+// 端口首个路由注册时启动监听，最后一个路由关闭时停止监听
+func (m *Manager) ListenShared(port uint16, tunnelID string, hostnames []string) (net.Listener, error) {
+	m.sharedMutex.Lock()
+	defer m.sharedMutex.Unlock()
+
+	sl, exists := m.shared[port]
+	if !exists {
+		sl = NewSharedListener(port, DefaultSharedPeekTimeout)
+		if err := m.StartListener(port, PortTypeTCP, sharedOwner, sl.Handle); err != nil {
+			return nil, err
+		}
+		m.shared[port] = sl
+	}
+
+	addr := &net.TCPAddr{Port: int(port)}
+	m.mutex.RLock()
+	if pl, ok := m.listeners[port]; ok && pl.TCPConn != nil {
+		addr = pl.TCPConn.Addr().(*net.TCPAddr)
+	}
+	m.mutex.RUnlock()
+
+	route, err := sl.addRoute(tunnelID, hostnames, addr)
+	if err != nil {
+		if !exists {
+			delete(m.shared, port)
+			m.StopListener(port, sharedOwner)
+		}
+		return nil, err
+	}
+	route.onClose = func() { m.releaseShared(port, route) }
+
+	return route, nil
+}
+
+// releaseShared 移除路由，端口上无路由时停止共享监听
+func (m *Manager) releaseShared(port uint16, route *routeListener) {
+	m.sharedMutex.Lock()
+	defer m.sharedMutex.Unlock()
+
+	sl, exists := m.shared[port]
+	if !exists || sl != route.shared {
+		return
+	}
+	if sl.removeRoute(route) > 0 {
+		return
+	}
+
+	delete(m.shared, port)
+	if err := m.StopListener(port, sharedOwner); err != nil {
+		m.logger.Warn("停止共享端口监听失败", zap.Uint16("port", port), zap.Error(err))
+	}
+}
+
+// GetSharedStats 获取共享端口统计信息
+func (m *Manager) GetSharedStats() map[uint16]interface{} {
+	m.sharedMutex.Lock()
+	defer m.sharedMutex.Unlock()
+
+	stats := make(map[uint16]interface{}, len(m.shared))
+	for port, sl := range m.shared {
+		stats[port] = sl.GetStats()
+	}
+	return stats
+}
@@ -210,6 +210,7 @@ type LogReport struct {
 
 // Command 命令
 type Command struct {
+	RequestID string                 `json:"request_id"`        // 请求ID，结果原样带回用于关联
 	Command   string                 `json:"command"`           // 命令
 	Params    map[string]interface{} `json:"params,omitempty"`  // 参数
 	Timeout   int                    `json:"timeout,omitempty"` // 超时（秒）
@@ -218,11 +219,13 @@ type Command struct {
 
 // CommandResult 命令结果
 type CommandResult struct {
-	Command   string                 `json:"command"`           // 命令
-	Status    string                 `json:"status"`            // 状态：success/failed
-	Message   string                 `json:"message,omitempty"` // 消息
-	Result    map[string]interface{} `json:"result,omitempty"`  // 结果
-	Timestamp int64                  `json:"timestamp"`         // 时间戳
+	RequestID  string                 `json:"request_id"`        // 请求ID
+	Command    string                 `json:"command"`           // 命令
+	Status     string                 `json:"status"`            // 状态：success/failed
+	Message    string                 `json:"message,omitempty"` // 消息
+	Result     map[string]interface{} `json:"result,omitempty"`  // 结果
+	DurationMs int64                  `json:"duration_ms"`       // 执行耗时（毫秒）
+	Timestamp  int64                  `json:"timestamp"`         // 时间戳
 }
 
 // ProbeRequest 探测请求
@@ -289,6 +292,15 @@ type TrafficReportRequest struct {
 	TrafficOut  int64            `json:"traffic_out"`       // 出站流量(bytes)
 	Connections int              `json:"connections"`       // 连接数
 	Details     map[string]int64 `json:"details,omitempty"` // 详细统计
+	Sources     []TrafficSource  `json:"sources,omitempty"` // 按真实来源 IP 的增量
+}
+
+// TrafficSource 单个真实来源 IP 的流量增量
+type TrafficSource struct {
+	IP          string `json:"ip"` // 超出跟踪上限的来源合并为 "other"
+	Connections int64  `json:"connections"`
+	BytesIn     int64  `json:"bytes_in"`
+	BytesOut    int64  `json:"bytes_out"`
 }
 
 // TrafficReportResponse 流量上报响应
@@ -297,7 +309,25 @@ type TrafficReportResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
-// TunnelRule 隧道规则
+// 容灾事件类型
+const (
+	FailoverEventFailover = "failover" // 切换到容灾出口
+	FailoverEventRecovery = "recovery" // 回切到主出口
+)
+
+// FailoverEventReport 容灾事件上报（failover_event）
+type FailoverEventReport struct {
+	NodeID          string `json:"node_id"`
+	TunnelID        string `json:"tunnel_id"`
+	EventType       string `json:"event_type"`       // failover/recovery
+	FromGroupID     string `json:"from_group_id"`    // 切换前的出口组
+	ToGroupID       string `json:"to_group_id"`      // 切换后的出口组
+	Reason          string `json:"reason"`           // timeout/all_nodes_down/recovered
+	FailureDuration int    `json:"failure_duration"` // 故障持续秒数
+	Timestamp       int64  `json:"timestamp"`        // 毫秒时间戳
+}
+
+// TunnelRule 隧道规则（面板 sync_rules 下发的规则结构）
 type TunnelRule struct {
 	TunnelID     string         `json:"tunnel_id"`
 	Name         string         `json:"name"`
@@ -307,19 +337,145 @@ type TunnelRule struct {
 	Enabled      bool           `json:"enabled"`
 	UserID       string         `json:"user_id"`
 	MaxBandwidth int64          `json:"max_bandwidth,omitempty"` // 带宽限制
+
+	TunnelName      string `json:"tunnel_name,omitempty"`
+	IngressProtocol string `json:"ingress_protocol,omitempty"`
+	EgressProtocol  string `json:"egress_protocol,omitempty"`
+	ListenPort      int    `json:"listen_port,omitempty"` // 入口监听端口，为空时使用 LocalPort
+	TargetAddress   string `json:"target_address,omitempty"`
+	TargetPort      int    `json:"target_port,omitempty"`
+	RateLimitBPS    int64  `json:"rate_limit_bps,omitempty"`
+	MaxConnections  int    `json:"max_connections,omitempty"`
+	IdleTimeout     int    `json:"idle_timeout,omitempty"` // 秒
+	Version         int64  `json:"version,omitempty"`
+	Priority        int    `json:"priority,omitempty"` // 规则优先级，作为复用传输（tls-mux）上的流优先级
+
+	// PROXY protocol
+	SendProxyProtocol   string `json:"send_proxy_protocol,omitempty"`
+	AcceptProxyProtocol bool   `json:"accept_proxy_protocol,omitempty"`
+
+	// 访问控制：按优先级从高到低排列，以真实来源地址（PROXY 头解析后）匹配
+	ACL []ACLRule `json:"acl,omitempty"`
+
+	// 代理入口认证凭据与目标白名单
+	Credentials    []TunnelCredential `json:"credentials,omitempty"`
+	AllowedDomains []string           `json:"allowed_domains,omitempty"`
+	AllowBind      bool               `json:"allow_bind,omitempty"` // SOCKS5 BIND 仅在规则显式开启时允许
+
+	// 共享端口路由主机名（SNI/Host）
+	Hostnames []string `json:"hostnames,omitempty"`
+
+	// 多跳链路中本节点的角色与下一跳，Role 为空表示单跳隧道
+	Role     string      `json:"role,omitempty"`
+	HopIndex int         `json:"hop_index,omitempty"`
+	NextHop  *TunnelHop  `json:"next_hop,omitempty"`
+	Hops     []TunnelHop `json:"hops,omitempty"` // 完整链路（入口、中继、出口）
+
+	// 出口容灾策略：主出口不可达超过 FailoverTimeout 秒后切换到 FailoverTargets
+	EgressGroupID       string         `json:"egress_group_id,omitempty"`
+	FailoverGroupID     string         `json:"failover_group_id,omitempty"`
+	FailoverTargets     []TunnelTarget `json:"failover_targets,omitempty"`
+	FailoverTimeout     int            `json:"failover_timeout,omitempty"` // 秒
+	FailoverAutoRecover bool           `json:"failover_auto_recover,omitempty"`
+
+	// 反向隧道：出口无法被上一跳直连时由出口回连上一跳的监听端口。
+	// ReverseSecret 下发给出口与上一跳，ReversePeers（需要回连的上一跳节点）只下发给出口
+	Reverse       bool           `json:"reverse,omitempty"`
+	ReverseSecret string         `json:"reverse_secret,omitempty"`
+	ReversePeers  []TunnelTarget `json:"reverse_peers,omitempty"`
 }
 
 // TunnelTarget 隧道目标
 type TunnelTarget struct {
-	Host   string `json:"host"`
-	Port   int    `json:"port"`
-	Weight int    `json:"weight"`
+	Host    string `json:"host"`
+	Port    int    `json:"port"`
+	Weight  int    `json:"weight"`
+	Enabled bool   `json:"enabled"`
+
+	// 目标为链路节点时携带节点ID与其CA公钥固定，用于节点间QUIC/TLS互相认证
+	NodeID  string `json:"node_id,omitempty"`
+	CertPin string `json:"cert_pin,omitempty"`
+}
+
+// TunnelCredential 代理认证凭据（仅密码摘要）
+type TunnelCredential struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Salt         string `json:"salt"`
+}
+
+// ACLRule 访问控制规则，字段为空表示不限制该维度
+type ACLRule struct {
+	Action    string `json:"action"`               // allow / deny
+	SourceIP  string `json:"source_ip,omitempty"`  // 单个 IP 或 CIDR
+	DestIP    string `json:"dest_ip,omitempty"`    // 单个 IP 或 CIDR
+	Protocol  string `json:"protocol,omitempty"`   // tcp / udp / any
+	PortRange string `json:"port_range,omitempty"` // 单个端口或 起始-结束
+}
+
+// TunnelHop 多跳链路中的一跳
+type TunnelHop struct {
+	Index    int            `json:"index"`
+	Role     string         `json:"role"`
+	GroupID  string         `json:"group_id"`
+	NodeID   string         `json:"node_id,omitempty"`
+	Protocol string         `json:"protocol"` // 进入该跳使用的传输协议
+	Nodes    []TunnelTarget `json:"nodes,omitempty"`
+}
+
+// GetListenPort 获取入口监听端口
+func (r *TunnelRule) GetListenPort() int {
+	if r.ListenPort > 0 {
+		return r.ListenPort
+	}
+	return r.LocalPort
+}
+
+// IsHop 本节点是否为多跳链路的中继或出口（接收上一跳节点的流量）
+func (r *TunnelRule) IsHop() bool {
+	return r.Role == "relay" || r.Role == "egress"
+}
+
+// IsReverseAgent 本节点是否为反向隧道的出口（主动回连 ReversePeers）
+func (r *TunnelRule) IsReverseAgent() bool {
+	return r.Reverse && r.ReverseSecret != "" && len(r.ReversePeers) > 0
+}
+
+// IsReverseHub 本节点是否为反向隧道出口的上一跳（接受出口回连，经反向会话连接下一跳）
+func (r *TunnelRule) IsReverseHub() bool {
+	return r.Reverse && r.ReverseSecret != "" && len(r.ReversePeers) == 0 && r.NextHop != nil
+}
+
+// HopProtocol 上一跳连接本节点使用的传输协议，非中继/出口或未指定时为空
+func (r *TunnelRule) HopProtocol() string {
+	if !r.IsHop() {
+		return ""
+	}
+	for _, hop := range r.Hops {
+		if hop.Index == r.HopIndex {
+			return hop.Protocol
+		}
+	}
+	return ""
+}
+
+// GetIngressProtocol 获取入口协议
+func (r *TunnelRule) GetIngressProtocol() string {
+	if r.IngressProtocol != "" {
+		return r.IngressProtocol
+	}
+	return r.Protocol
 }
 
 // SyncRulesRequest 同步规则请求
+// Force 为全量同步；Incremental 为增量同步，仅包含 BaseVersion 之后变更的规则和需删除的隧道
 type SyncRulesRequest struct {
-	Rules []TunnelRule `json:"rules"`
-	Force bool         `json:"force"` // 是否强制同步
+	Rules       []TunnelRule `json:"rules"`
+	Deleted     []string     `json:"deleted,omitempty"`      // 需删除的隧道ID（增量同步）
+	Force       bool         `json:"force"`                  // 是否强制同步
+	Incremental bool         `json:"incremental,omitempty"`  // 是否增量同步
+	BaseVersion int64        `json:"base_version,omitempty"` // 增量起点，节点应已应用到该版本
+	Version     string       `json:"version,omitempty"`      // 同步后的规则版本
 }
 
 // SyncRulesResponse 同步规则响应
@@ -328,6 +484,21 @@ type SyncRulesResponse struct {
 	AppliedCount int      `json:"applied_count"`
 	FailedRules  []string `json:"failed_rules,omitempty"`
 	Message      string   `json:"message,omitempty"`
+	Version      int64    `json:"version"` // 应用后的本地规则版本
+}
+
+// SyncAckRequest 规则同步确认（节点 -> 面板 sync_ack）
+type SyncAckRequest struct {
+	Version      int64    `json:"version"` // 已应用到的规则版本
+	Success      bool     `json:"success"`
+	AppliedCount int      `json:"applied_count"`
+	FailedRules  []string `json:"failed_rules,omitempty"`
+	Message      string   `json:"message,omitempty"`
+}
+
+// SyncRequest 增量同步请求（节点 -> 面板 sync_request），发现版本缺口时请求补发
+type SyncRequest struct {
+	SinceVersion int64 `json:"since_version"` // 本地已应用的版本
 }
 
 // DeleteRuleRequest 删除规则请求
@@ -0,0 +1,437 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ProxyProtocolVersion PROXY protocol 版本
+功能：HAProxy PROXY protocol 头版本，空值表示不发送
+*/
+type ProxyProtocolVersion string
+
+const (
+	ProxyProtocolNone ProxyProtocolVersion = ""
+	ProxyProtocolV1   ProxyProtocolVersion = "v1"
+	ProxyProtocolV2   ProxyProtocolVersion = "v2"
+)
+
+const (
+	/* v1 头最大长度（含 CRLF），见 HAProxy 规范 2.1 节 */
+	proxyV1MaxLength = 107
+
+	/* v2 头固定部分长度：签名 12 + 版本命令 1 + 协议族 1 + 长度 2 */
+	proxyV2HeaderLength = 16
+
+	proxyV2CmdLocal = 0x20
+	proxyV2CmdProxy = 0x21
+
+	proxyV2FamTCP4 = 0x11
+	proxyV2FamUDP4 = 0x12
+	proxyV2FamTCP6 = 0x21
+	proxyV2FamUDP6 = 0x22
+
+	/* 默认读取 PROXY 头的超时 */
+	defaultProxyHeaderTimeout = 5 * time.Second
+)
+
+/* v2 签名：\r\n\r\n\0\r\nQUIT\n */
+var proxyV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+/* ErrNoProxyHeader 连接起始数据不是 PROXY 头 */
+var ErrNoProxyHeader = errors.New("连接未携带 PROXY protocol 头")
+
+/*
+ProxyHeader PROXY protocol 头
+功能：描述解析出的原始连接地址。
+Local 为 true 时（v2 LOCAL 命令或 v1 UNKNOWN）不携带地址，应使用连接自身地址
+*/
+type ProxyHeader struct {
+	Version    ProxyProtocolVersion
+	Local      bool
+	SourceAddr net.Addr
+	DestAddr   net.Addr
+}
+
+/*
+ParseProxyProtocolVersion 解析 PROXY protocol 版本字符串
+*/
+func ParseProxyProtocolVersion(s string) (ProxyProtocolVersion, error) {
+	switch ProxyProtocolVersion(strings.ToLower(s)) {
+	case ProxyProtocolNone:
+		return ProxyProtocolNone, nil
+	case ProxyProtocolV1:
+		return ProxyProtocolV1, nil
+	case ProxyProtocolV2:
+		return ProxyProtocolV2, nil
+	default:
+		return ProxyProtocolNone, fmt.Errorf("不支持的 PROXY protocol 版本: %s", s)
+	}
+}
+
+/*
+BuildProxyHeader 构建 PROXY protocol 头
+功能：按版本编码源/目的地址；地址无法表示（非 TCP/UDP 或为空）时
+v1 输出 UNKNOWN、v2 输出 LOCAL 命令
+*/
+func BuildProxyHeader(version ProxyProtocolVersion, src, dst net.Addr) ([]byte, error) {
+	switch version {
+	case ProxyProtocolV1:
+		return buildProxyV1Header(src, dst), nil
+	case ProxyProtocolV2:
+		return buildProxyV2Header(src, dst), nil
+	default:
+		return nil, fmt.Errorf("不支持的 PROXY protocol 版本: %s", version)
+	}
+}
+
+/*
+WriteProxyHeader 向连接写入 PROXY protocol 头
+*/
+func WriteProxyHeader(w io.Writer, version ProxyProtocolVersion, src, dst net.Addr) error {
+	header, err := BuildProxyHeader(version, src, dst)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("写入 PROXY 头失败: %w", err)
+	}
+	return nil
+}
+
+/*
+buildProxyV1Header 构建 v1 文本头
+*/
+func buildProxyV1Header(src, dst net.Addr) []byte {
+	srcIP, srcPort, srcOK := splitProxyAddr(src)
+	dstIP, dstPort, dstOK := splitProxyAddr(dst)
+	if !srcOK || !dstOK || isUDPAddr(src) {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+
+	/* v1 要求两端地址族一致，混合时统一为 IPv6 */
+	family := "TCP4"
+	if srcIP.To4() == nil || dstIP.To4() == nil {
+		family = "TCP6"
+		srcIP, dstIP = srcIP.To16(), dstIP.To16()
+	} else {
+		srcIP, dstIP = srcIP.To4(), dstIP.To4()
+	}
+
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n",
+		family, formatProxyV1IP(srcIP, family), formatProxyV1IP(dstIP, family), srcPort, dstPort))
+}
+
+/*
+formatProxyV1IP 按地址族格式化 IP（TCP6 下 IPv4 使用映射地址形式）
+*/
+func formatProxyV1IP(ip net.IP, family string) string {
+	if family == "TCP6" && ip.To4() != nil {
+		return "::ffff:" + ip.To4().String()
+	}
+	return ip.String()
+}
+
+/*
+buildProxyV2Header 构建 v2 二进制头
+*/
+func buildProxyV2Header(src, dst net.Addr) []byte {
+	header := make([]byte, proxyV2HeaderLength, proxyV2HeaderLength+36)
+	copy(header, proxyV2Signature)
+
+	srcIP, srcPort, srcOK := splitProxyAddr(src)
+	dstIP, dstPort, dstOK := splitProxyAddr(dst)
+	if !srcOK || !dstOK {
+		header[12] = proxyV2CmdLocal
+		return header
+	}
+
+	header[12] = proxyV2CmdProxy
+	udp := isUDPAddr(src)
+	if srcIP.To4() != nil && dstIP.To4() != nil {
+		header[13] = proxyV2FamTCP4
+		if udp {
+			header[13] = proxyV2FamUDP4
+		}
+		header = append(header, srcIP.To4()...)
+		header = append(header, dstIP.To4()...)
+	} else {
+		header[13] = proxyV2FamTCP6
+		if udp {
+			header[13] = proxyV2FamUDP6
+		}
+		header = append(header, srcIP.To16()...)
+		header = append(header, dstIP.To16()...)
+	}
+	header = binary.BigEndian.AppendUint16(header, uint16(srcPort))
+	header = binary.BigEndian.AppendUint16(header, uint16(dstPort))
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(header)-proxyV2HeaderLength))
+	return header
+}
+
+/*
+splitProxyAddr 提取地址的 IP 和端口
+*/
+func splitProxyAddr(addr net.Addr) (net.IP, int, bool) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP, a.Port, a.IP != nil
+	case *net.UDPAddr:
+		return a.IP, a.Port, a.IP != nil
+	default:
+		return nil, 0, false
+	}
+}
+
+func isUDPAddr(addr net.Addr) bool {
+	_, ok := addr.(*net.UDPAddr)
+	return ok
+}
+
+/*
+ReadProxyHeader 从读取器解析 PROXY protocol 头
+功能：自动识别 v1/v2，起始数据不是 PROXY 头时返回 ErrNoProxyHeader
+（此时已预读的数据仍保留在读取器中）
+*/
+func ReadProxyHeader(r *bufio.Reader) (*ProxyHeader, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case 'P':
+		prefix, err := r.Peek(6)
+		if err != nil {
+			return nil, err
+		}
+		if string(prefix) != "PROXY " {
+			return nil, ErrNoProxyHeader
+		}
+		return readProxyV1Header(r)
+	case proxyV2Signature[0]:
+		sig, err := r.Peek(len(proxyV2Signature))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(sig, proxyV2Signature) {
+			return nil, ErrNoProxyHeader
+		}
+		return readProxyV2Header(r)
+	default:
+		return nil, ErrNoProxyHeader
+	}
+}
+
+/*
+readProxyV1Header 解析 v1 文本头
+格式：PROXY TCP4|TCP6|UNKNOWN <src> <dst> <sport> <dport>\r\n
+*/
+func readProxyV1Header(r *bufio.Reader) (*ProxyHeader, error) {
+	line := make([]byte, 0, proxyV1MaxLength)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("读取 PROXY v1 头失败: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLength {
+			return nil, fmt.Errorf("PROXY v1 头超过 %d 字节", proxyV1MaxLength)
+		}
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("PROXY v1 头缺少 CRLF")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	header := &ProxyHeader{Version: ProxyProtocolV1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		header.Local = true
+		return header, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("PROXY v1 头字段数错误: %d", len(fields))
+	}
+	if fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, fmt.Errorf("PROXY v1 头协议族无效: %s", fields[1])
+	}
+
+	srcIP := net.ParseIP(fields[2])
+	dstIP := net.ParseIP(fields[3])
+	if srcIP == nil || dstIP == nil {
+		return nil, fmt.Errorf("PROXY v1 头地址无效")
+	}
+	isV6 := fields[1] == "TCP6"
+	if strings.Contains(fields[2], ":") != isV6 || strings.Contains(fields[3], ":") != isV6 {
+		return nil, fmt.Errorf("PROXY v1 头地址与协议族不符")
+	}
+	srcPort, err := parseProxyPort(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dstPort, err := parseProxyPort(fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	header.SourceAddr = &net.TCPAddr{IP: srcIP, Port: srcPort}
+	header.DestAddr = &net.TCPAddr{IP: dstIP, Port: dstPort}
+	return header, nil
+}
+
+/*
+parseProxyPort 解析 v1 头中的端口（十进制，不允许前导零）
+*/
+func parseProxyPort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 0 || port > 65535 || (len(s) > 1 && s[0] == '0') {
+		return 0, fmt.Errorf("PROXY v1 头端口无效: %s", s)
+	}
+	return port, nil
+}
+
+/*
+readProxyV2Header 解析 v2 二进制头
+功能：支持 TCP/UDP over IPv4/IPv6，跳过 TLV 扩展；
+LOCAL 命令或 UNIX/未指定协议族时不携带地址
+*/
+func readProxyV2Header(r *bufio.Reader) (*ProxyHeader, error) {
+	fixed := make([]byte, proxyV2HeaderLength)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, fmt.Errorf("读取 PROXY v2 头失败: %w", err)
+	}
+
+	verCmd := fixed[12]
+	family := fixed[13]
+	length := int(binary.BigEndian.Uint16(fixed[14:16]))
+
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("PROXY v2 头版本无效: %#x", verCmd)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("读取 PROXY v2 地址失败: %w", err)
+	}
+
+	header := &ProxyHeader{Version: ProxyProtocolV2}
+	switch verCmd {
+	case proxyV2CmdLocal:
+		header.Local = true
+		return header, nil
+	case proxyV2CmdProxy:
+	default:
+		return nil, fmt.Errorf("PROXY v2 命令无效: %#x", verCmd)
+	}
+
+	var ipLen int
+	switch family {
+	case proxyV2FamTCP4, proxyV2FamUDP4:
+		ipLen = net.IPv4len
+	case proxyV2FamTCP6, proxyV2FamUDP6:
+		ipLen = net.IPv6len
+	default:
+		/* UNIX 套接字或未指定协议族：接受但不使用地址 */
+		header.Local = true
+		return header, nil
+	}
+
+	if len(payload) < ipLen*2+4 {
+		return nil, fmt.Errorf("PROXY v2 地址长度不足: %d", len(payload))
+	}
+	srcIP := net.IP(append([]byte(nil), payload[:ipLen]...))
+	dstIP := net.IP(append([]byte(nil), payload[ipLen:ipLen*2]...))
+	srcPort := int(binary.BigEndian.Uint16(payload[ipLen*2:]))
+	dstPort := int(binary.BigEndian.Uint16(payload[ipLen*2+2:]))
+
+	if family == proxyV2FamUDP4 || family == proxyV2FamUDP6 {
+		header.SourceAddr = &net.UDPAddr{IP: srcIP, Port: srcPort}
+		header.DestAddr = &net.UDPAddr{IP: dstIP, Port: dstPort}
+	} else {
+		header.SourceAddr = &net.TCPAddr{IP: srcIP, Port: srcPort}
+		header.DestAddr = &net.TCPAddr{IP: dstIP, Port: dstPort}
+	}
+	return header, nil
+}
+
+/*
+ProxyConn 携带 PROXY 头信息的连接
+功能：RemoteAddr/LocalAddr 返回头中声明的原始地址，
+读取时先消费解析头时预读的缓冲数据
+*/
+type ProxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	header *ProxyHeader
+}
+
+/*
+AcceptProxyHeader 在新接受的连接上读取 PROXY 头
+功能：在超时时间内必须收到合法的 v1/v2 头，否则返回错误（调用方应关闭连接）。
+仅应在可信的前置负载均衡器或上一跳节点之后启用
+*/
+func AcceptProxyHeader(conn net.Conn, timeout time.Duration) (*ProxyConn, error) {
+	if timeout <= 0 {
+		timeout = defaultProxyHeaderTimeout
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	header, err := ReadProxyHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return &ProxyConn{Conn: conn, reader: reader, header: header}, nil
+}
+
+/*
+Read 读取数据（优先返回预读缓冲）
+*/
+func (c *ProxyConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+/*
+RemoteAddr 返回真实客户端地址
+*/
+func (c *ProxyConn) RemoteAddr() net.Addr {
+	if c.header != nil && !c.header.Local && c.header.SourceAddr != nil {
+		return c.header.SourceAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+/*
+LocalAddr 返回客户端原始连接的目的地址
+*/
+func (c *ProxyConn) LocalAddr() net.Addr {
+	if c.header != nil && !c.header.Local && c.header.DestAddr != nil {
+		return c.header.DestAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+/*
+Header 返回解析出的 PROXY 头
+*/
+func (c *ProxyConn) Header() *ProxyHeader {
+	return c.header
+}
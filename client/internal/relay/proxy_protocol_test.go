@@ -0,0 +1,220 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestProxyHeader_RoundTrip 写入的 v1/v2 头应能被解析回原始地址
+func TestProxyHeader_RoundTrip(t *testing.T) {
+	cases := []struct {
+		name    string
+		version ProxyProtocolVersion
+		src     net.Addr
+		dst     net.Addr
+	}{
+		{"v1 tcp4", ProxyProtocolV1,
+			&net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 40000},
+			&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}},
+		{"v1 tcp6", ProxyProtocolV1,
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::7"), Port: 40000},
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}},
+		{"v2 tcp4", ProxyProtocolV2,
+			&net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 40000},
+			&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}},
+		{"v2 tcp6", ProxyProtocolV2,
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::7"), Port: 40000},
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}},
+		{"v2 udp4", ProxyProtocolV2,
+			&net.UDPAddr{IP: net.ParseIP("198.51.100.7"), Port: 5353},
+			&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 53}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteProxyHeader(&buf, tc.version, tc.src, tc.dst); err != nil {
+				t.Fatalf("写入 PROXY 头失败: %v", err)
+			}
+			buf.WriteString("payload")
+
+			r := bufio.NewReader(&buf)
+			header, err := ReadProxyHeader(r)
+			if err != nil {
+				t.Fatalf("解析 PROXY 头失败: %v", err)
+			}
+			if header.Version != tc.version || header.Local {
+				t.Fatalf("头版本应为 %s 且非 LOCAL，实际 %+v", tc.version, header)
+			}
+			if header.SourceAddr.String() != tc.src.String() || header.SourceAddr.Network() != tc.src.Network() {
+				t.Errorf("来源地址应为 %s/%s，实际 %s/%s", tc.src.Network(), tc.src, header.SourceAddr.Network(), header.SourceAddr)
+			}
+			if header.DestAddr.String() != tc.dst.String() {
+				t.Errorf("目标地址应为 %s，实际 %s", tc.dst, header.DestAddr)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != "payload" {
+				t.Errorf("头之后的数据应保留，实际 %q", rest)
+			}
+		})
+	}
+}
+
+// TestProxyHeader_Unknown 无法表示的地址写为 v1 UNKNOWN / v2 LOCAL
+func TestProxyHeader_Unknown(t *testing.T) {
+	v1, err := BuildProxyHeader(ProxyProtocolV1, nil, nil)
+	if err != nil || string(v1) != "PROXY UNKNOWN\r\n" {
+		t.Fatalf("v1 未知地址应为 UNKNOWN 头，实际 %q (%v)", v1, err)
+	}
+
+	for _, version := range []ProxyProtocolVersion{ProxyProtocolV1, ProxyProtocolV2} {
+		raw, err := BuildProxyHeader(version, nil, nil)
+		if err != nil {
+			t.Fatalf("生成 %s 头失败: %v", version, err)
+		}
+		header, err := ReadProxyHeader(bufio.NewReader(bytes.NewReader(raw)))
+		if err != nil {
+			t.Fatalf("解析 %s 头失败: %v", version, err)
+		}
+		if !header.Local || header.SourceAddr != nil {
+			t.Errorf("%s 未知地址应解析为不携带地址，实际 %+v", version, header)
+		}
+	}
+}
+
+// TestProxyHeader_Reject 非 PROXY 数据与格式错误的头
+func TestProxyHeader_Reject(t *testing.T) {
+	_, err := ReadProxyHeader(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n")))
+	if !errors.Is(err, ErrNoProxyHeader) {
+		t.Errorf("普通数据应返回 ErrNoProxyHeader，实际 %v", err)
+	}
+
+	malformed := []string{
+		"PROXY TCP4 198.51.100.7 10.0.0.1 40000\r\n",
+		"PROXY TCP4 198.51.100.7 10.0.0.1 40000 443\n",
+		"PROXY TCP6 198.51.100.7 10.0.0.1 40000 443\r\n",
+		"PROXY TCP4 198.51.100.7 10.0.0.1 040000 443\r\n",
+		"PROXY TCP4 198.51.100.7 10.0.0.1 70000 443\r\n",
+		"PROXY SCTP 198.51.100.7 10.0.0.1 40000 443\r\n",
+		"PROXY TCP4 " + strings.Repeat("1", proxyV1MaxLength) + "\r\n",
+	}
+	for _, raw := range malformed {
+		if _, err := ReadProxyHeader(bufio.NewReader(strings.NewReader(raw))); err == nil || errors.Is(err, ErrNoProxyHeader) {
+			t.Errorf("格式错误的头 %q 应被拒绝，实际 %v", raw, err)
+		}
+	}
+
+	v2, err := BuildProxyHeader(ProxyProtocolV2,
+		&net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 40000},
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443})
+	if err != nil {
+		t.Fatalf("生成 v2 头失败: %v", err)
+	}
+	if _, err := ReadProxyHeader(bufio.NewReader(bytes.NewReader(v2[:len(v2)-2]))); err == nil {
+		t.Error("截断的 v2 头应被拒绝")
+	}
+}
+
+// TestAcceptProxyHeader 连接的地址取自 PROXY 头，头之后的数据可正常读取
+func TestAcceptProxyHeader(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	src := &net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 40000}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}
+	go func() {
+		WriteProxyHeader(client, ProxyProtocolV2, src, dst)
+		client.Write([]byte("hello"))
+	}()
+
+	conn, err := AcceptProxyHeader(server, 2*time.Second)
+	if err != nil {
+		t.Fatalf("接收 PROXY 头失败: %v", err)
+	}
+	if conn.RemoteAddr().String() != src.String() || conn.LocalAddr().String() != dst.String() {
+		t.Errorf("连接地址应为 %s -> %s，实际 %s -> %s", src, dst, conn.RemoteAddr(), conn.LocalAddr())
+	}
+	if conn.Header().Version != ProxyProtocolV2 {
+		t.Errorf("头版本应为 v2，实际 %s", conn.Header().Version)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("应读到头之后的数据 hello，实际 %q (%v)", buf, err)
+	}
+}
+
+// TestTCPRelay_ProxyProtocolChain 转发器只采用可信来源的 PROXY 头，并把真实来源以配置的版本传给目标
+func TestTCPRelay_ProxyProtocolChain(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动目标失败: %v", err)
+	}
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				proxyConn, err := AcceptProxyHeader(conn, 2*time.Second)
+				if err != nil {
+					return
+				}
+				proxyConn.Write([]byte(string(proxyConn.Header().Version) + " " + proxyConn.RemoteAddr().String()))
+			}()
+		}
+	}()
+
+	var trusted atomic.Bool
+	config := DefaultTCPRelayConfig()
+	config.ListenAddr = "127.0.0.1"
+	config.TargetAddr = "127.0.0.1"
+	config.TargetPort = target.Addr().(*net.TCPAddr).Port
+	config.AcceptProxyProtocol = true
+	config.SendProxyProtocol = ProxyProtocolV1
+	config.TrustedProxySource = func(net.Addr) bool { return trusted.Load() }
+	relay := NewTCPRelay(config)
+	if err := relay.Start(); err != nil {
+		t.Fatalf("启动转发器失败: %v", err)
+	}
+	defer relay.Stop()
+
+	src := &net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 40000}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}
+	send := func() (string, error) {
+		conn, err := net.DialTimeout("tcp", relay.listener.Addr().String(), 2*time.Second)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(3 * time.Second))
+		if err := WriteProxyHeader(conn, ProxyProtocolV2, src, dst); err != nil {
+			return "", err
+		}
+		reply, err := io.ReadAll(conn)
+		return string(reply), err
+	}
+
+	trusted.Store(true)
+	if reply, err := send(); err != nil || reply != "v1 "+src.String() {
+		t.Fatalf("目标应收到携带真实来源的 v1 头，实际 %q (%v)", reply, err)
+	}
+
+	trusted.Store(false)
+	if reply, _ := send(); reply != "" {
+		t.Errorf("不可信来源的连接不应被转发，实际收到 %q", reply)
+	}
+	if got := relay.stats.DeniedConns.Load(); got != 1 {
+		t.Errorf("不可信来源应计入拒绝连接，实际 %d", got)
+	}
+}
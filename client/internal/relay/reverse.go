@@ -0,0 +1,892 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gkipass/client/internal/multiplex"
+	"gkipass/client/internal/pool"
+)
+
+/*
+反向隧道
+功能：出口节点位于 NAT/防火墙之后、上一跳无法直连时，由出口节点（ReverseAgent）
+经 pool.AdaptivePool 主动向上一跳建立并维持若干长连接，每条连接握手后作为一个多路复用会话；
+上一跳（ReverseHub）接受这些会话，并为每个用户连接在会话上打开一个流。
+
+握手（出口 → 上一跳）：
+  "GKRV" | 版本(1) | len(隧道ID)(1) | 隧道ID | len(节点ID)(1) | 节点ID | Unix 秒(8) | HMAC-SHA256(32)
+  HMAC 以面板下发的隧道反向密钥计算，覆盖其前的全部字节；上一跳回复 1 字节状态码
+*/
+
+const (
+	reverseMagic   = "GKRV"
+	reverseVersion = 1
+
+	reverseStatusOK            byte = 0x00
+	reverseStatusUnknownTunnel byte = 0x01
+	reverseStatusAuthFailed    byte = 0x02
+	reverseStatusExpired       byte = 0x03
+	reverseStatusBusy          byte = 0x04
+)
+
+var (
+	// ErrReverseAuthFailed 反向握手认证失败
+	ErrReverseAuthFailed = errors.New("反向隧道握手认证失败")
+	// ErrReverseNoSession 隧道没有可用的反向会话
+	ErrReverseNoSession = errors.New("隧道没有可用的反向会话")
+)
+
+/*
+IsReverseHandshake 判断连接起始字节是否为反向隧道握手
+功能：供与其他协议共享监听端口的入口按前缀分流，prefix 至少需要 4 字节
+*/
+func IsReverseHandshake(prefix []byte) bool {
+	return len(prefix) >= len(reverseMagic) && string(prefix[:len(reverseMagic)]) == reverseMagic
+}
+
+/* reverseHello 反向握手请求 */
+type reverseHello struct {
+	tunnelID  string
+	nodeID    string
+	timestamp time.Time
+	signed    []byte
+	mac       []byte
+}
+
+/*
+writeReverseHello 发送反向握手请求
+*/
+func writeReverseHello(w io.Writer, tunnelID, nodeID string, secret []byte, now time.Time) error {
+	if len(tunnelID) == 0 || len(tunnelID) > 255 || len(nodeID) > 255 {
+		return fmt.Errorf("反向握手字段长度无效")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(reverseMagic)
+	buf.WriteByte(reverseVersion)
+	buf.WriteByte(byte(len(tunnelID)))
+	buf.WriteString(tunnelID)
+	buf.WriteByte(byte(len(nodeID)))
+	buf.WriteString(nodeID)
+	binary.Write(&buf, binary.BigEndian, now.Unix())
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(buf.Bytes())
+	buf.Write(mac.Sum(nil))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+/*
+readReverseHello 读取反向握手请求
+*/
+func readReverseHello(r io.Reader) (*reverseHello, error) {
+	var signed bytes.Buffer
+	tee := io.TeeReader(r, &signed)
+
+	head := make([]byte, len(reverseMagic)+2)
+	if _, err := io.ReadFull(tee, head); err != nil {
+		return nil, fmt.Errorf("读取反向握手失败: %w", err)
+	}
+	if !IsReverseHandshake(head) {
+		return nil, fmt.Errorf("不是反向隧道握手")
+	}
+	if head[len(reverseMagic)] != reverseVersion {
+		return nil, fmt.Errorf("不支持的反向握手版本: %d", head[len(reverseMagic)])
+	}
+
+	tunnelID := make([]byte, head[len(reverseMagic)+1])
+	if _, err := io.ReadFull(tee, tunnelID); err != nil {
+		return nil, fmt.Errorf("读取隧道ID失败: %w", err)
+	}
+
+	var nodeLen [1]byte
+	if _, err := io.ReadFull(tee, nodeLen[:]); err != nil {
+		return nil, fmt.Errorf("读取节点ID失败: %w", err)
+	}
+	nodeID := make([]byte, nodeLen[0])
+	if _, err := io.ReadFull(tee, nodeID); err != nil {
+		return nil, fmt.Errorf("读取节点ID失败: %w", err)
+	}
+
+	var ts int64
+	if err := binary.Read(tee, binary.BigEndian, &ts); err != nil {
+		return nil, fmt.Errorf("读取时间戳失败: %w", err)
+	}
+
+	mac := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, mac); err != nil {
+		return nil, fmt.Errorf("读取握手签名失败: %w", err)
+	}
+
+	return &reverseHello{
+		tunnelID:  string(tunnelID),
+		nodeID:    string(nodeID),
+		timestamp: time.Unix(ts, 0),
+		signed:    signed.Bytes(),
+		mac:       mac,
+	}, nil
+}
+
+/*
+verify 校验握手签名和时间戳
+*/
+func (h *reverseHello) verify(secret []byte, now time.Time, maxSkew time.Duration) byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(h.signed)
+	if !hmac.Equal(mac.Sum(nil), h.mac) {
+		return reverseStatusAuthFailed
+	}
+
+	skew := now.Sub(h.timestamp)
+	if skew < 0 {
+		skew = -skew
+	}
+	if maxSkew > 0 && skew > maxSkew {
+		return reverseStatusExpired
+	}
+	return reverseStatusOK
+}
+
+/*
+reverseStatusError 将握手状态码转换为错误
+*/
+func reverseStatusError(status byte) error {
+	switch status {
+	case reverseStatusOK:
+		return nil
+	case reverseStatusUnknownTunnel:
+		return fmt.Errorf("上一跳未注册该隧道")
+	case reverseStatusAuthFailed:
+		return ErrReverseAuthFailed
+	case reverseStatusExpired:
+		return fmt.Errorf("反向握手时间戳超出允许偏差，请检查节点时钟")
+	case reverseStatusBusy:
+		return fmt.Errorf("上一跳反向会话数已达上限")
+	default:
+		return fmt.Errorf("未知的反向握手状态: %d", status)
+	}
+}
+
+/*
+ReverseHubConfig 反向隧道接入端配置
+*/
+type ReverseHubConfig struct {
+	SessionConfig    *multiplex.SessionConfig `json:"-"`
+	HandshakeTimeout time.Duration            `json:"handshake_timeout"` // 等待握手请求的最长时间
+	MaxClockSkew     time.Duration            `json:"max_clock_skew"`    // 握手时间戳允许的最大偏差
+	DialTimeout      time.Duration            `json:"dial_timeout"`      // 无可用会话时等待出口回连的最长时间
+	MaxSessions      int                      `json:"max_sessions"`      // 单隧道最多接受的会话数
+}
+
+/*
+DefaultReverseHubConfig 默认反向隧道接入端配置
+*/
+func DefaultReverseHubConfig() *ReverseHubConfig {
+	return &ReverseHubConfig{
+		SessionConfig:    multiplex.DefaultSessionConfig(),
+		HandshakeTimeout: 10 * time.Second,
+		MaxClockSkew:     5 * time.Minute,
+		DialTimeout:      10 * time.Second,
+		MaxSessions:      64,
+	}
+}
+
+/* reverseSession 出口节点回连建立的会话 */
+type reverseSession struct {
+	session     *multiplex.Session
+	nodeID      string
+	connectedAt time.Time
+}
+
+/* reverseTunnel 单个隧道的反向会话集合 */
+type reverseTunnel struct {
+	secret   []byte
+	sessions []*reverseSession
+	notify   chan struct{} // 新会话加入时关闭并重建，唤醒等待的拨号
+}
+
+/*
+ReverseHub 反向隧道接入端（入口或最后一个中继）
+功能：接受出口节点回连的会话，按隧道登记，并在其上为用户连接打开流
+*/
+type ReverseHub struct {
+	config  *ReverseHubConfig
+	tunnels map[string]*reverseTunnel
+	mutex   sync.RWMutex
+	logger  *zap.Logger
+
+	listeners   map[net.Listener]struct{}
+	listenersMu sync.Mutex
+	closed      atomic.Bool
+
+	/* 统计 */
+	stats struct {
+		accepted      atomic.Int64
+		rejected      atomic.Int64
+		streamsOpened atomic.Int64
+		dialFailures  atomic.Int64
+	}
+}
+
+/*
+NewReverseHub 创建反向隧道接入端
+*/
+func NewReverseHub(config *ReverseHubConfig) *ReverseHub {
+	def := DefaultReverseHubConfig()
+	if config == nil {
+		config = def
+	}
+	if config.SessionConfig == nil {
+		config.SessionConfig = def.SessionConfig
+	}
+	if config.HandshakeTimeout <= 0 {
+		config.HandshakeTimeout = def.HandshakeTimeout
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = def.DialTimeout
+	}
+	if config.MaxSessions <= 0 {
+		config.MaxSessions = def.MaxSessions
+	}
+
+	return &ReverseHub{
+		config:    config,
+		tunnels:   make(map[string]*reverseTunnel),
+		listeners: make(map[net.Listener]struct{}),
+		logger:    zap.L().Named("reverse-hub"),
+	}
+}
+
+/*
+RegisterTunnel 登记（或更新）接受回连的隧道
+功能：密钥变化时关闭以旧密钥建立的会话，出口节点将以新密钥重连
+*/
+func (h *ReverseHub) RegisterTunnel(tunnelID, secret string) {
+	h.mutex.Lock()
+	t, ok := h.tunnels[tunnelID]
+	if !ok {
+		h.tunnels[tunnelID] = &reverseTunnel{
+			secret: []byte(secret),
+			notify: make(chan struct{}),
+		}
+		h.mutex.Unlock()
+		return
+	}
+
+	var stale []*reverseSession
+	if !hmac.Equal(t.secret, []byte(secret)) {
+		t.secret = []byte(secret)
+		stale = t.sessions
+		t.sessions = nil
+	}
+	h.mutex.Unlock()
+
+	for _, rs := range stale {
+		rs.session.Close()
+	}
+}
+
+/*
+RemoveTunnel 移除隧道并关闭其全部反向会话
+*/
+func (h *ReverseHub) RemoveTunnel(tunnelID string) {
+	h.mutex.Lock()
+	t, ok := h.tunnels[tunnelID]
+	delete(h.tunnels, tunnelID)
+	h.mutex.Unlock()
+
+	if ok {
+		for _, rs := range t.sessions {
+			rs.session.Close()
+		}
+	}
+}
+
+/*
+Serve 在监听器上接受出口节点的回连，直到监听器关闭
+*/
+func (h *ReverseHub) Serve(listener net.Listener) error {
+	h.listenersMu.Lock()
+	h.listeners[listener] = struct{}{}
+	h.listenersMu.Unlock()
+	defer func() {
+		h.listenersMu.Lock()
+		delete(h.listeners, listener)
+		h.listenersMu.Unlock()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if h.closed.Load() || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("接受反向连接失败: %w", err)
+		}
+
+		go func() {
+			if err := h.ServeConn(conn); err != nil {
+				h.logger.Debug("反向连接握手失败",
+					zap.String("peer", conn.RemoteAddr().String()),
+					zap.Error(err))
+			}
+		}()
+	}
+}
+
+/*
+ServeConn 处理一条出口节点的回连
+功能：完成握手后登记为多路复用会话并立即返回，会话结束时自动注销；
+共享监听端口的入口按 IsReverseHandshake 分流后可直接调用
+*/
+func (h *ReverseHub) ServeConn(conn net.Conn) error {
+	if h.closed.Load() {
+		conn.Close()
+		return net.ErrClosed
+	}
+
+	conn.SetDeadline(time.Now().Add(h.config.HandshakeTimeout))
+	hello, err := readReverseHello(conn)
+	if err != nil {
+		h.stats.rejected.Add(1)
+		conn.Close()
+		return err
+	}
+
+	status := h.authorize(hello)
+	conn.Write([]byte{status})
+	if status != reverseStatusOK {
+		h.stats.rejected.Add(1)
+		conn.Close()
+		h.logger.Warn("拒绝反向连接",
+			zap.String("tunnel_id", hello.tunnelID),
+			zap.String("node_id", hello.nodeID),
+			zap.String("peer", conn.RemoteAddr().String()),
+			zap.Error(reverseStatusError(status)))
+		return reverseStatusError(status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	/* 上一跳主动开流，作为多路复用客户端 */
+	session := multiplex.NewSession(conn, h.config.SessionConfig, true)
+	if err := session.Start(); err != nil {
+		conn.Close()
+		return fmt.Errorf("启动反向会话失败: %w", err)
+	}
+
+	rs := &reverseSession{session: session, nodeID: hello.nodeID, connectedAt: time.Now()}
+	if !h.addSession(hello.tunnelID, rs) {
+		session.Close()
+		return fmt.Errorf("隧道已移除: %s", hello.tunnelID)
+	}
+	h.stats.accepted.Add(1)
+
+	h.logger.Info("出口节点已回连",
+		zap.String("tunnel_id", hello.tunnelID),
+		zap.String("node_id", hello.nodeID),
+		zap.String("peer", conn.RemoteAddr().String()))
+
+	go func() {
+		<-session.Done()
+		h.removeSession(hello.tunnelID, rs)
+	}()
+	return nil
+}
+
+/*
+authorize 校验握手请求对应的隧道、签名和会话数
+*/
+func (h *ReverseHub) authorize(hello *reverseHello) byte {
+	h.mutex.RLock()
+	t, ok := h.tunnels[hello.tunnelID]
+	var secret []byte
+	var sessions int
+	if ok {
+		secret = t.secret
+		sessions = len(t.sessions)
+	}
+	h.mutex.RUnlock()
+
+	if !ok {
+		return reverseStatusUnknownTunnel
+	}
+	if status := hello.verify(secret, time.Now(), h.config.MaxClockSkew); status != reverseStatusOK {
+		return status
+	}
+	if sessions >= h.config.MaxSessions {
+		return reverseStatusBusy
+	}
+	return reverseStatusOK
+}
+
+/*
+addSession 登记会话并唤醒等待的拨号
+*/
+func (h *ReverseHub) addSession(tunnelID string, rs *reverseSession) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	t, ok := h.tunnels[tunnelID]
+	if !ok {
+		return false
+	}
+	t.sessions = append(t.sessions, rs)
+	close(t.notify)
+	t.notify = make(chan struct{})
+	return true
+}
+
+/*
+removeSession 注销会话
+*/
+func (h *ReverseHub) removeSession(tunnelID string, rs *reverseSession) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	t, ok := h.tunnels[tunnelID]
+	if !ok {
+		return
+	}
+	for i, s := range t.sessions {
+		if s == rs {
+			t.sessions = append(t.sessions[:i], t.sessions[i+1:]...)
+			break
+		}
+	}
+}
+
+/*
+DialTunnel 经隧道的反向会话打开一个流
+功能：选择活跃流最少的会话开流；暂无会话时等待出口回连，
+ctx 未设置截止时间时最多等待 DialTimeout
+*/
+func (h *ReverseHub) DialTunnel(ctx context.Context, tunnelID string) (net.Conn, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.config.DialTimeout)
+		defer cancel()
+	}
+
+	for {
+		h.mutex.RLock()
+		t, ok := h.tunnels[tunnelID]
+		var best *reverseSession
+		var notify chan struct{}
+		if ok {
+			notify = t.notify
+			for _, rs := range t.sessions {
+				if rs.session.IsClosed() || rs.session.IsDraining() {
+					continue
+				}
+				if best == nil || rs.session.NumStreams() < best.session.NumStreams() {
+					best = rs
+				}
+			}
+		}
+		h.mutex.RUnlock()
+
+		if !ok {
+			h.stats.dialFailures.Add(1)
+			return nil, fmt.Errorf("隧道未启用反向接入: %s", tunnelID)
+		}
+
+		if best != nil {
+			stream, err := best.session.OpenStream()
+			if err == nil {
+				h.stats.streamsOpened.Add(1)
+				return stream, nil
+			}
+			/* 会话不可用（已满或正在关闭），移除后重试其他会话 */
+			h.logger.Debug("反向会话开流失败",
+				zap.String("tunnel_id", tunnelID),
+				zap.String("node_id", best.nodeID),
+				zap.Error(err))
+			h.removeSession(tunnelID, best)
+			continue
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			h.stats.dialFailures.Add(1)
+			return nil, fmt.Errorf("%w: %s", ErrReverseNoSession, tunnelID)
+		}
+	}
+}
+
+/*
+Dialer 返回经指定隧道反向会话拨号的函数，用作 TCPRelayConfig.Dialer（忽略目标地址）
+*/
+func (h *ReverseHub) Dialer(tunnelID string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		return h.DialTunnel(ctx, tunnelID)
+	}
+}
+
+/*
+SessionCount 获取隧道当前的反向会话数
+*/
+func (h *ReverseHub) SessionCount(tunnelID string) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if t, ok := h.tunnels[tunnelID]; ok {
+		return len(t.sessions)
+	}
+	return 0
+}
+
+/*
+Stop 停止接入端，关闭监听器和全部会话
+*/
+func (h *ReverseHub) Stop() error {
+	if !h.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	h.listenersMu.Lock()
+	for listener := range h.listeners {
+		listener.Close()
+	}
+	h.listenersMu.Unlock()
+
+	h.mutex.Lock()
+	tunnels := h.tunnels
+	h.tunnels = make(map[string]*reverseTunnel)
+	h.mutex.Unlock()
+
+	for _, t := range tunnels {
+		for _, rs := range t.sessions {
+			rs.session.Close()
+		}
+	}
+	return nil
+}
+
+/*
+GetStats 获取接入端统计
+*/
+func (h *ReverseHub) GetStats() map[string]interface{} {
+	h.mutex.RLock()
+	tunnels := make(map[string]interface{}, len(h.tunnels))
+	for id, t := range h.tunnels {
+		nodes := make([]string, 0, len(t.sessions))
+		for _, rs := range t.sessions {
+			nodes = append(nodes, rs.nodeID)
+		}
+		tunnels[id] = map[string]interface{}{
+			"sessions": len(t.sessions),
+			"nodes":    nodes,
+		}
+	}
+	h.mutex.RUnlock()
+
+	return map[string]interface{}{
+		"tunnels":        tunnels,
+		"accepted":       h.stats.accepted.Load(),
+		"rejected":       h.stats.rejected.Load(),
+		"streams_opened": h.stats.streamsOpened.Load(),
+		"dial_failures":  h.stats.dialFailures.Load(),
+	}
+}
+
+/*
+ReverseAgentConfig 反向隧道回连端配置
+*/
+type ReverseAgentConfig struct {
+	TunnelID         string                   `json:"tunnel_id"`
+	NodeID           string                   `json:"node_id"`
+	Secret           string                   `json:"-"`        // 面板下发的隧道反向密钥
+	Sessions         int                      `json:"sessions"` // 维持的会话数
+	SessionConfig    *multiplex.SessionConfig `json:"-"`
+	HandshakeTimeout time.Duration            `json:"handshake_timeout"` // 等待握手响应的最长时间
+	RetryInterval    time.Duration            `json:"retry_interval"`    // 重连初始间隔
+	MaxRetryInterval time.Duration            `json:"max_retry_interval"`
+	AcceptQueue      int                      `json:"accept_queue"` // 待处理流队列长度
+}
+
+/*
+DefaultReverseAgentConfig 默认反向隧道回连端配置
+*/
+func DefaultReverseAgentConfig() *ReverseAgentConfig {
+	return &ReverseAgentConfig{
+		Sessions:         2,
+		SessionConfig:    multiplex.DefaultSessionConfig(),
+		HandshakeTimeout: 10 * time.Second,
+		RetryInterval:    time.Second,
+		MaxRetryInterval: 30 * time.Second,
+		AcceptQueue:      256,
+	}
+}
+
+/* reverseQuickRetries 连续失败在该次数内立即重试：连接池中的空闲连接可能已被上一跳关闭 */
+const reverseQuickRetries = 2
+
+/*
+ReverseAgent 反向隧道回连端（出口节点）
+功能：经 pool.AdaptivePool 向上一跳维持 Sessions 个已握手的多路复用会话，
+上一跳打开的流通过 Accept 交给出口转发（实现 net.Listener，可直接交给 TCPRelay.Serve）。
+连接池由 ReverseAgent 负责启动和停止
+*/
+type ReverseAgent struct {
+	config   *ReverseAgentConfig
+	pool     *pool.AdaptivePool
+	peerAddr string
+	streams  chan net.Conn
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	logger   *zap.Logger
+
+	/* 统计 */
+	stats struct {
+		activeSessions  atomic.Int64
+		handshakes      atomic.Int64
+		handshakeErrors atomic.Int64
+		streamsAccepted atomic.Int64
+	}
+}
+
+/*
+NewReverseAgent 创建反向隧道回连端
+*/
+func NewReverseAgent(config *ReverseAgentConfig, connPool *pool.AdaptivePool, peerAddr string) *ReverseAgent {
+	def := DefaultReverseAgentConfig()
+	if config == nil {
+		config = def
+	}
+	if config.Sessions <= 0 {
+		config.Sessions = def.Sessions
+	}
+	if config.SessionConfig == nil {
+		config.SessionConfig = def.SessionConfig
+	}
+	if config.HandshakeTimeout <= 0 {
+		config.HandshakeTimeout = def.HandshakeTimeout
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = def.RetryInterval
+	}
+	if config.MaxRetryInterval < config.RetryInterval {
+		config.MaxRetryInterval = def.MaxRetryInterval
+	}
+	if config.AcceptQueue <= 0 {
+		config.AcceptQueue = def.AcceptQueue
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ReverseAgent{
+		config:   config,
+		pool:     connPool,
+		peerAddr: peerAddr,
+		streams:  make(chan net.Conn, config.AcceptQueue),
+		ctx:      ctx,
+		cancel:   cancel,
+		logger:   zap.L().Named("reverse-agent"),
+	}
+}
+
+/*
+Start 启动连接池并开始维持反向会话
+*/
+func (a *ReverseAgent) Start() error {
+	if a.config.TunnelID == "" {
+		return fmt.Errorf("反向隧道缺少隧道ID")
+	}
+	if err := a.pool.Start(a.ctx); err != nil {
+		return fmt.Errorf("启动反向连接池失败: %w", err)
+	}
+
+	a.logger.Info("反向隧道回连已启动",
+		zap.String("tunnel_id", a.config.TunnelID),
+		zap.String("peer", a.peerAddr),
+		zap.Int("sessions", a.config.Sessions))
+
+	a.wg.Add(a.config.Sessions)
+	for i := 0; i < a.config.Sessions; i++ {
+		go a.maintain()
+	}
+	return nil
+}
+
+/*
+maintain 维持一个反向会话，断开后按退避间隔重连
+*/
+func (a *ReverseAgent) maintain() {
+	defer a.wg.Done()
+
+	failures := 0
+	backoff := a.config.RetryInterval
+	for a.ctx.Err() == nil {
+		session, err := a.connect()
+		if err != nil {
+			failures++
+			a.stats.handshakeErrors.Add(1)
+			if failures <= reverseQuickRetries {
+				continue
+			}
+
+			a.logger.Warn("反向连接失败",
+				zap.String("tunnel_id", a.config.TunnelID),
+				zap.String("peer", a.peerAddr),
+				zap.Duration("retry_in", backoff),
+				zap.Error(err))
+
+			select {
+			case <-time.After(backoff):
+			case <-a.ctx.Done():
+				return
+			}
+			backoff *= 2
+			if backoff > a.config.MaxRetryInterval {
+				backoff = a.config.MaxRetryInterval
+			}
+			continue
+		}
+
+		failures = 0
+		backoff = a.config.RetryInterval
+		a.serve(session)
+	}
+}
+
+/*
+connect 从连接池取出一条连接并完成反向握手
+*/
+func (a *ReverseAgent) connect() (*multiplex.Session, error) {
+	pooled, err := a.pool.GetConnection()
+	if err != nil {
+		return nil, err
+	}
+	conn := &reversePoolConn{MonitoredConnection: pool.NewMonitoredConnection(pooled, a.pool)}
+
+	conn.SetDeadline(time.Now().Add(a.config.HandshakeTimeout))
+	if err := writeReverseHello(conn, a.config.TunnelID, a.config.NodeID, []byte(a.config.Secret), time.Now()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("发送反向握手失败: %w", err)
+	}
+
+	var status [1]byte
+	if _, err := io.ReadFull(conn, status[:]); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("读取反向握手响应失败: %w", err)
+	}
+	if err := reverseStatusError(status[0]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	/* 上一跳开流，本端作为多路复用服务端 */
+	session := multiplex.NewSession(conn, a.config.SessionConfig, false)
+	if err := session.Start(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("启动反向会话失败: %w", err)
+	}
+	a.stats.handshakes.Add(1)
+	return session, nil
+}
+
+/*
+serve 接受会话上的流直到会话结束
+*/
+func (a *ReverseAgent) serve(session *multiplex.Session) {
+	a.stats.activeSessions.Add(1)
+	defer a.stats.activeSessions.Add(-1)
+
+	stop := context.AfterFunc(a.ctx, func() { session.Close() })
+	defer stop()
+	defer session.Close()
+
+	for {
+		stream, err := session.AcceptStream()
+		if err != nil {
+			return
+		}
+		select {
+		case a.streams <- stream:
+			a.stats.streamsAccepted.Add(1)
+		case <-a.ctx.Done():
+			stream.Close()
+			return
+		}
+	}
+}
+
+/*
+Accept 获取上一跳打开的下一个流
+*/
+func (a *ReverseAgent) Accept() (net.Conn, error) {
+	select {
+	case stream := <-a.streams:
+		return stream, nil
+	case <-a.ctx.Done():
+		return nil, net.ErrClosed
+	}
+}
+
+/*
+Close 停止回连并关闭全部会话和连接池
+*/
+func (a *ReverseAgent) Close() error {
+	if a.ctx.Err() != nil {
+		return nil
+	}
+	a.cancel()
+	a.wg.Wait()
+	return a.pool.Stop()
+}
+
+/*
+Addr 返回上一跳地址
+*/
+func (a *ReverseAgent) Addr() net.Addr {
+	return reverseAddr(a.peerAddr)
+}
+
+/*
+GetStats 获取回连端统计
+*/
+func (a *ReverseAgent) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"tunnel_id":        a.config.TunnelID,
+		"peer":             a.peerAddr,
+		"active_sessions":  a.stats.activeSessions.Load(),
+		"handshakes":       a.stats.handshakes.Load(),
+		"handshake_errors": a.stats.handshakeErrors.Load(),
+		"streams_accepted": a.stats.streamsAccepted.Load(),
+		"pool":             a.pool.GetStats(),
+	}
+}
+
+/* reverseAddr 反向监听地址（上一跳地址） */
+type reverseAddr string
+
+func (a reverseAddr) Network() string { return "reverse" }
+func (a reverseAddr) String() string  { return string(a) }
+
+/*
+reversePoolConn 反向会话占用的池化连接
+功能：会话关闭时连接已不可复用，关闭即移出连接池而不是归还
+*/
+type reversePoolConn struct {
+	*pool.MonitoredConnection
+}
+
+func (c *reversePoolConn) Close() error {
+	return c.ForceClose()
+}
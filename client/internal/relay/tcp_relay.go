@@ -2,6 +2,7 @@ package relay
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -51,6 +52,23 @@ type TCPRelayConfig struct {
 	RateLimitBPS   int64         `json:"rate_limit_bps"`
 	EnableEncrypt  bool          `json:"enable_encrypt"`
 	EncryptMethod  string        `json:"encrypt_method"`
+
+	/*
+		PROXY protocol：AcceptProxyProtocol 要求每个入站连接以 PROXY 头开始
+		（位于负载均衡器或上一跳节点之后），SendProxyProtocol 向目标发送真实客户端地址
+	*/
+	AcceptProxyProtocol bool                 `json:"accept_proxy_protocol"`
+	SendProxyProtocol   ProxyProtocolVersion `json:"send_proxy_protocol"`
+	ProxyHeaderTimeout  time.Duration        `json:"proxy_header_timeout"`
+
+	/* TrustedProxySource 判断直连来源能否携带 PROXY 头（如仅限上一跳节点），不可信来源的连接被拒绝；为空时不限制 */
+	TrustedProxySource func(remote net.Addr) bool `json:"-"`
+
+	/* AccessCheck 以真实来源地址（PROXY 头解析后）做访问控制，返回 false 时拒绝连接；为空不限制 */
+	AccessCheck func(source net.Addr) bool `json:"-"`
+
+	/* Dialer 自定义目标拨号（如经反向隧道会话开流），为空时直接 TCP 拨号 TargetAddr:TargetPort */
+	Dialer func(ctx context.Context, network, address string) (net.Conn, error) `json:"-"`
 }
 
 /*
@@ -76,7 +94,73 @@ type RelayStats struct {
 	TotalConns  atomic.Int64 `json:"total_conns"`
 	ActiveConns atomic.Int64 `json:"active_conns"`
 	FailedConns atomic.Int64 `json:"failed_conns"`
+	DeniedConns atomic.Int64 `json:"denied_conns"`
 	StartTime   time.Time    `json:"start_time"`
+
+	/* 按真实来源 IP 统计（经 PROXY protocol 解析后的客户端地址） */
+	sourcesMu sync.Mutex
+	sources   map[string]*SourceStats
+}
+
+/* 单个转发器最多跟踪的来源 IP 数，超出部分计入 otherSourceKey */
+const (
+	maxTrackedSources = 1024
+	otherSourceKey    = "other"
+)
+
+/*
+SourceStats 单个来源 IP 的流量统计
+*/
+type SourceStats struct {
+	Connections int64 `json:"connections"`
+	BytesIn     int64 `json:"bytes_in"`
+	BytesOut    int64 `json:"bytes_out"`
+}
+
+/*
+RecordSource 记录一次连接的来源流量
+功能：addr 为真实客户端地址，按 IP 聚合
+*/
+func (s *RelayStats) RecordSource(addr net.Addr, bytesIn, bytesOut int64) {
+	key := otherSourceKey
+	if ip, _, ok := splitProxyAddr(addr); ok {
+		key = ip.String()
+	}
+
+	s.sourcesMu.Lock()
+	defer s.sourcesMu.Unlock()
+
+	if s.sources == nil {
+		s.sources = make(map[string]*SourceStats)
+	}
+	entry, ok := s.sources[key]
+	if !ok {
+		if len(s.sources) >= maxTrackedSources {
+			key = otherSourceKey
+			entry = s.sources[key]
+		}
+		if entry == nil {
+			entry = &SourceStats{}
+			s.sources[key] = entry
+		}
+	}
+	entry.Connections++
+	entry.BytesIn += bytesIn
+	entry.BytesOut += bytesOut
+}
+
+/*
+GetSources 获取按来源 IP 的统计快照
+*/
+func (s *RelayStats) GetSources() map[string]SourceStats {
+	s.sourcesMu.Lock()
+	defer s.sourcesMu.Unlock()
+
+	sources := make(map[string]SourceStats, len(s.sources))
+	for ip, entry := range s.sources {
+		sources[ip] = *entry
+	}
+	return sources
 }
 
 /*
@@ -90,7 +174,9 @@ func (s *RelayStats) GetSnapshot() map[string]interface{} {
 		"total_conns":  s.TotalConns.Load(),
 		"active_conns": s.ActiveConns.Load(),
 		"failed_conns": s.FailedConns.Load(),
+		"denied_conns": s.DeniedConns.Load(),
 		"uptime_secs":  int64(time.Since(s.StartTime).Seconds()),
+		"sources":      s.GetSources(),
 	}
 }
 
@@ -121,11 +207,19 @@ func (r *TCPRelay) Start() error {
 		return fmt.Errorf("TCP 监听失败 [%s]: %w", listenAddr, err)
 	}
 
+	return r.Serve(listener)
+}
+
+/*
+Serve 在给定监听器上启动 TCP 转发器
+功能：监听器可以是任意 net.Listener（如反向隧道回连端 ReverseAgent），Stop 时一并关闭
+*/
+func (r *TCPRelay) Serve(listener net.Listener) error {
 	r.listener = listener
 	r.running.Store(true)
 
 	r.logger.Info("TCP 转发器已启动",
-		zap.String("listen", listenAddr),
+		zap.String("listen", listener.Addr().String()),
 		zap.String("target", fmt.Sprintf("%s:%d", r.config.TargetAddr, r.config.TargetPort)),
 		zap.String("name", r.config.Name))
 
@@ -153,23 +247,37 @@ func (r *TCPRelay) acceptLoop() {
 			continue
 		}
 
-		/* 检查连接数限制 */
-		if r.config.MaxConnections > 0 && r.connCount.Load() >= int64(r.config.MaxConnections) {
-			r.logger.Warn("连接数已达上限，拒绝新连接",
-				zap.Int64("current", r.connCount.Load()),
-				zap.Int("max", r.config.MaxConnections))
-			conn.Close()
-			r.stats.FailedConns.Add(1)
-			continue
-		}
+		r.ServeConn(conn)
+	}
+}
 
-		r.activeConn.Add(1)
-		r.connCount.Add(1)
-		r.stats.TotalConns.Add(1)
-		r.stats.ActiveConns.Add(1)
+/*
+ServeConn 转发一个由外部监听器接受的连接
+功能：用于端口由其他组件持有的场景（如端口管理器监听、共享端口分发），
+连接数限制与统计与自有监听一致，转发在独立协程中进行
+*/
+func (r *TCPRelay) ServeConn(conn net.Conn) {
+	if r.ctx.Err() != nil {
+		conn.Close()
+		return
+	}
 
-		go r.handleConnection(conn)
+	/* 检查连接数限制 */
+	if r.config.MaxConnections > 0 && r.connCount.Load() >= int64(r.config.MaxConnections) {
+		r.logger.Warn("连接数已达上限，拒绝新连接",
+			zap.Int64("current", r.connCount.Load()),
+			zap.Int("max", r.config.MaxConnections))
+		conn.Close()
+		r.stats.FailedConns.Add(1)
+		return
 	}
+
+	r.activeConn.Add(1)
+	r.connCount.Add(1)
+	r.stats.TotalConns.Add(1)
+	r.stats.ActiveConns.Add(1)
+
+	go r.handleConnection(conn)
 }
 
 /*
@@ -185,12 +293,51 @@ func (r *TCPRelay) handleConnection(clientConn net.Conn) {
 		r.stats.ActiveConns.Add(-1)
 	}()
 
+	/* 解析前置负载均衡器/上一跳节点的 PROXY 头，之后 RemoteAddr 即为真实客户端地址 */
+	if r.config.AcceptProxyProtocol {
+		if r.config.TrustedProxySource != nil && !r.config.TrustedProxySource(clientConn.RemoteAddr()) {
+			r.logger.Warn("拒绝不可信来源的 PROXY 连接",
+				zap.String("peer", clientConn.RemoteAddr().String()))
+			r.stats.DeniedConns.Add(1)
+			return
+		}
+		proxyConn, err := AcceptProxyHeader(clientConn, r.config.ProxyHeaderTimeout)
+		if errors.Is(err, io.EOF) {
+			/* 未发送任何数据即关闭（如上一跳的存活探测），不计为失败 */
+			return
+		}
+		if err != nil {
+			r.logger.Warn("读取 PROXY 头失败",
+				zap.String("peer", clientConn.RemoteAddr().String()),
+				zap.Error(err))
+			r.stats.FailedConns.Add(1)
+			return
+		}
+		clientConn = proxyConn
+	}
+
+	if r.config.AccessCheck != nil && !r.config.AccessCheck(clientConn.RemoteAddr()) {
+		r.logger.Debug("访问控制拒绝连接",
+			zap.String("client", clientConn.RemoteAddr().String()))
+		r.stats.DeniedConns.Add(1)
+		return
+	}
+
 	clientAddr := clientConn.RemoteAddr().String()
 	targetAddr := fmt.Sprintf("%s:%d", r.config.TargetAddr, r.config.TargetPort)
 
 	/* 连接到目标地址 */
-	dialer := net.Dialer{Timeout: r.config.ConnTimeout}
-	targetConn, err := dialer.DialContext(r.ctx, "tcp", targetAddr)
+	dial := r.config.Dialer
+	if dial == nil {
+		dialer := net.Dialer{Timeout: r.config.ConnTimeout}
+		dial = dialer.DialContext
+	}
+	dialCtx, cancelDial := r.ctx, context.CancelFunc(func() {})
+	if r.config.ConnTimeout > 0 {
+		dialCtx, cancelDial = context.WithTimeout(r.ctx, r.config.ConnTimeout)
+	}
+	targetConn, err := dial(dialCtx, "tcp", targetAddr)
+	cancelDial()
 	if err != nil {
 		r.logger.Error("连接目标失败",
 			zap.String("target", targetAddr),
@@ -201,17 +348,34 @@ func (r *TCPRelay) handleConnection(clientConn net.Conn) {
 	}
 	defer targetConn.Close()
 
+	/* 向目标发送真实客户端地址 */
+	if r.config.SendProxyProtocol != ProxyProtocolNone {
+		if err := WriteProxyHeader(targetConn, r.config.SendProxyProtocol, clientConn.RemoteAddr(), clientConn.LocalAddr()); err != nil {
+			r.logger.Error("发送 PROXY 头失败",
+				zap.String("target", targetAddr),
+				zap.String("client", clientAddr),
+				zap.Error(err))
+			r.stats.FailedConns.Add(1)
+			return
+		}
+	}
+
 	r.logger.Debug("TCP 连接建立",
 		zap.String("client", clientAddr),
 		zap.String("target", targetAddr))
 
 	/* 启动双向数据转发 */
 	done := make(chan struct{}, 2)
+	var copies sync.WaitGroup
+	var sentIn, sentOut int64
+	copies.Add(2)
 
 	/* 客户端 -> 目标 */
 	go func() {
+		defer copies.Done()
 		defer func() { done <- struct{}{} }()
 		n := r.copyWithStats(targetConn, clientConn, &r.stats.BytesIn)
+		sentIn = n
 		r.logger.Debug("客户端->目标 流量传输完成",
 			zap.String("client", clientAddr),
 			zap.Int64("bytes", n))
@@ -219,8 +383,10 @@ func (r *TCPRelay) handleConnection(clientConn net.Conn) {
 
 	/* 目标 -> 客户端 */
 	go func() {
+		defer copies.Done()
 		defer func() { done <- struct{}{} }()
 		n := r.copyWithStats(clientConn, targetConn, &r.stats.BytesOut)
+		sentOut = n
 		r.logger.Debug("目标->客户端 流量传输完成",
 			zap.String("client", clientAddr),
 			zap.Int64("bytes", n))
@@ -231,6 +397,12 @@ func (r *TCPRelay) handleConnection(clientConn net.Conn) {
 	case <-done:
 	case <-r.ctx.Done():
 	}
+
+	/* 关闭两端结束另一方向，再按真实来源记录本连接流量 */
+	clientConn.Close()
+	targetConn.Close()
+	copies.Wait()
+	r.stats.RecordSource(clientConn.RemoteAddr(), sentIn, sentOut)
 }
 
 /*
@@ -490,6 +490,19 @@ func (b *TunnelRelayBridge) handleConnection(localConn net.Conn) {
 		b.stats.ActiveConns.Add(-1)
 	}()
 
+	/* 位于负载均衡器之后时先解析 PROXY 头，取得真实客户端地址 */
+	if b.localConfig.AcceptProxyProtocol {
+		proxyConn, err := AcceptProxyHeader(localConn, b.localConfig.ProxyHeaderTimeout)
+		if err != nil {
+			b.logger.Warn("读取 PROXY 头失败",
+				zap.String("peer", localConn.RemoteAddr().String()),
+				zap.Error(err))
+			b.stats.FailedConns.Add(1)
+			return
+		}
+		localConn = proxyConn
+	}
+
 	/* 建立加密隧道 */
 	tunnel := NewEncryptedTunnel(b.tunnelConfig)
 	if err := tunnel.Connect(); err != nil {
@@ -501,8 +514,26 @@ func (b *TunnelRelayBridge) handleConnection(localConn net.Conn) {
 	}
 	defer tunnel.Close()
 
+	/* 跨节点传递真实来源地址：本地配置要求发送 PROXY 头时写在隧道流起始处，对端以 AcceptProxyProtocol 解析 */
+	var headerLen int64
+	if b.localConfig.SendProxyProtocol != ProxyProtocolNone {
+		header, err := BuildProxyHeader(b.localConfig.SendProxyProtocol, localConn.RemoteAddr(), localConn.LocalAddr())
+		if err == nil {
+			_, err = tunnel.Write(header)
+		}
+		if err != nil {
+			b.logger.Error("发送 PROXY 头失败",
+				zap.String("client", localConn.RemoteAddr().String()),
+				zap.Error(err))
+			b.stats.FailedConns.Add(1)
+			return
+		}
+		headerLen = int64(len(header))
+	}
+
 	/* 桥接数据 */
 	tunnel.BridgeToConn(localConn)
+	b.stats.RecordSource(localConn.RemoteAddr(), tunnel.bytesOut.Load()-headerLen, tunnel.bytesIn.Load())
 }
 
 /*
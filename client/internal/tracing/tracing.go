@@ -0,0 +1,190 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// 导出方式
+const (
+	ExporterOTLP = "otlp" // 经 OTLP/HTTP 发送到收集器
+	ExporterFile = "file" // 写入本地文件，每行一个 JSON span
+)
+
+// instrumentationName 节点侧 Tracer 名称
+const instrumentationName = "gkipass/client"
+
+// propagator 面板消息中携带的追踪上下文格式（W3C traceparent/tracestate + baggage）
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Config 链路追踪配置
+type Config struct {
+	Exporter    string  `json:"exporter"`     // 导出方式: otlp/file
+	Endpoint    string  `json:"endpoint"`     // OTLP/HTTP 收集器地址 (host:port)
+	Insecure    bool    `json:"insecure"`     // 不使用 TLS 连接收集器
+	FilePath    string  `json:"file_path"`    // 文件导出路径
+	SampleRatio float64 `json:"sample_ratio"` // 本地发起的链路采样率，面板传入的链路沿用面板的采样决定
+	ServiceName string  `json:"service_name"` // 上报的服务名
+}
+
+// DefaultConfig 默认链路追踪配置
+func DefaultConfig() *Config {
+	return &Config{
+		Exporter:    ExporterOTLP,
+		Endpoint:    "127.0.0.1:4318",
+		Insecure:    true,
+		FilePath:    "./logs/traces.jsonl",
+		SampleRatio: 1.0,
+		ServiceName: "gkipass-node",
+	}
+}
+
+// Provider 链路追踪提供者，持有导出器和需要在退出时关闭的文件
+type Provider struct {
+	provider *sdktrace.TracerProvider
+	file     *os.File
+	logger   *zap.Logger
+}
+
+// Setup 按配置创建导出器并注册为全局 TracerProvider
+func Setup(config *Config, nodeID string) (*Provider, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	def := DefaultConfig()
+	if config.Exporter == "" {
+		config.Exporter = def.Exporter
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = def.ServiceName
+	}
+	if config.SampleRatio <= 0 || config.SampleRatio > 1 {
+		config.SampleRatio = def.SampleRatio
+	}
+
+	p := &Provider{logger: zap.L().Named("tracing")}
+
+	var exporter sdktrace.SpanExporter
+	switch strings.ToLower(config.Exporter) {
+	case ExporterOTLP:
+		if config.Endpoint == "" {
+			config.Endpoint = def.Endpoint
+		}
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.Endpoint)}
+		if config.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		otlp, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("创建 OTLP 导出器失败: %w", err)
+		}
+		exporter = otlp
+	case ExporterFile:
+		if config.FilePath == "" {
+			config.FilePath = def.FilePath
+		}
+		if err := os.MkdirAll(filepath.Dir(config.FilePath), 0755); err != nil {
+			return nil, fmt.Errorf("创建追踪文件目录失败: %w", err)
+		}
+		file, err := os.OpenFile(config.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("打开追踪文件失败: %w", err)
+		}
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("创建文件导出器失败: %w", err)
+		}
+		exporter = stdout
+		p.file = file
+	default:
+		return nil, fmt.Errorf("不支持的追踪导出方式: %s", config.Exporter)
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("service.name", config.ServiceName)}
+	if nodeID != "" {
+		attrs = append(attrs, attribute.String("service.instance.id", nodeID))
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attrs...))
+	if err != nil {
+		res = resource.NewSchemaless(attrs...)
+	}
+
+	p.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(p.provider)
+	otel.SetTextMapPropagator(propagator)
+
+	p.logger.Info("链路追踪已启用",
+		zap.String("exporter", config.Exporter),
+		zap.String("endpoint", config.Endpoint),
+		zap.String("file", config.FilePath),
+		zap.Float64("sample_ratio", config.SampleRatio))
+
+	return p, nil
+}
+
+// Stop 导出剩余 span 并关闭导出器
+func (p *Provider) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := p.provider.Shutdown(ctx)
+	if p.file != nil {
+		p.file.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("关闭链路追踪失败: %w", err)
+	}
+	return nil
+}
+
+// Start 创建 span，未启用追踪时返回不记录的 span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End 结束 span，err 非空时记录错误并标记失败
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject 将上下文中的追踪信息写入消息载体，没有有效 span 时返回 nil
+func Inject(ctx context.Context) map[string]string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract 从面板消息载体恢复追踪上下文
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier(carrier))
+}
@@ -0,0 +1,772 @@
+package transport
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+)
+
+// KCP协议常量（与ikcp保持一致，保证线路格式兼容）
+const (
+	kcpRTONoDelay  = 30    // 无延迟模式最小RTO
+	kcpRTOMin      = 100   // 普通模式最小RTO
+	kcpRTODefault  = 200   // 默认RTO
+	kcpRTOMax      = 60000 // 最大RTO
+	kcpCmdPush     = 81    // 数据推送
+	kcpCmdAck      = 82    // 确认
+	kcpCmdWask     = 83    // 窗口探测（询问）
+	kcpCmdWins     = 84    // 窗口大小（告知）
+	kcpAskSend     = 1     // 需要发送窗口探测
+	kcpAskTell     = 2     // 需要告知窗口大小
+	kcpWndSnd      = 32    // 默认发送窗口
+	kcpWndRcv      = 128   // 默认接收窗口（不得小于最大分片数）
+	kcpMTUDefault  = 1400  // 默认MTU
+	kcpInterval    = 100   // 默认刷新间隔(ms)
+	kcpOverhead    = 24    // 报文头长度
+	kcpDeadLink    = 20    // 最大重传次数
+	kcpThreshInit  = 2     // 初始慢启动阈值
+	kcpThreshMin   = 2     // 最小慢启动阈值
+	kcpProbeInit   = 7000  // 初始窗口探测间隔(ms)
+	kcpProbeLimit  = 120000
+	kcpStateDead   = 0xFFFFFFFF
+	kcpMaxFragment = 255
+)
+
+// kcpRefTime 时间基准，所有时间戳均为相对毫秒
+var kcpRefTime = time.Now()
+
+// kcpCurrentMs 获取当前相对毫秒时间
+func kcpCurrentMs() uint32 {
+	return uint32(time.Since(kcpRefTime) / time.Millisecond)
+}
+
+func kcpTimeDiff(later, earlier uint32) int32 {
+	return int32(later - earlier)
+}
+
+func kcpMin(a, b uint32) uint32 {
+	if a <= b {
+		return a
+	}
+	return b
+}
+
+func kcpMax(a, b uint32) uint32 {
+	if a >= b {
+		return a
+	}
+	return b
+}
+
+func kcpBound(lower, middle, upper uint32) uint32 {
+	return kcpMin(kcpMax(lower, middle), upper)
+}
+
+// kcpSegment KCP报文段
+type kcpSegment struct {
+	conv     uint32
+	cmd      uint8
+	frg      uint8
+	wnd      uint16
+	ts       uint32
+	sn       uint32
+	una      uint32
+	rto      uint32
+	xmit     uint32
+	resendts uint32
+	fastack  uint32
+	acked    uint32
+	data     []byte
+}
+
+// encode 编码报文头，返回剩余缓冲区
+func (seg *kcpSegment) encode(ptr []byte) []byte {
+	binary.LittleEndian.PutUint32(ptr, seg.conv)
+	ptr[4] = seg.cmd
+	ptr[5] = seg.frg
+	binary.LittleEndian.PutUint16(ptr[6:], seg.wnd)
+	binary.LittleEndian.PutUint32(ptr[8:], seg.ts)
+	binary.LittleEndian.PutUint32(ptr[12:], seg.sn)
+	binary.LittleEndian.PutUint32(ptr[16:], seg.una)
+	binary.LittleEndian.PutUint32(ptr[20:], uint32(len(seg.data)))
+	return ptr[kcpOverhead:]
+}
+
+type kcpAckItem struct {
+	sn uint32
+	ts uint32
+}
+
+// kcpOutputFunc 底层输出回调，buf的前reserved字节为上层预留空间
+type kcpOutputFunc func(buf []byte, size int)
+
+// kcpControl KCP协议控制块（ARQ状态机）
+// 非线程安全，调用方负责加锁
+type kcpControl struct {
+	conv, mtu, mss, state                  uint32
+	sndUna, sndNxt, rcvNxt                 uint32
+	ssthresh                               uint32
+	rxRttvar, rxSrtt                       int32
+	rxRTO, rxMinRTO                        uint32
+	sndWnd, rcvWnd, rmtWnd, cwnd, probe    uint32
+	interval, tsFlush                      uint32
+	nodelay, updated                       uint32
+	tsProbe, probeWait                     uint32
+	deadLink, incr                         uint32
+	fastresend                             int32
+	nocwnd, stream                         int32
+	reserved                               int
+	sndQueue, rcvQueue, sndBuf, rcvBuf     []kcpSegment
+	acklist                                []kcpAckItem
+	buffer                                 []byte
+	output                                 kcpOutputFunc
+	retransSegs, fastRetransSegs, lostSegs atomic.Uint64
+}
+
+// newKCPControl 创建KCP控制块
+func newKCPControl(conv uint32, output kcpOutputFunc) *kcpControl {
+	kcp := &kcpControl{
+		conv:     conv,
+		sndWnd:   kcpWndSnd,
+		rcvWnd:   kcpWndRcv,
+		rmtWnd:   kcpWndRcv,
+		mtu:      kcpMTUDefault,
+		mss:      kcpMTUDefault - kcpOverhead,
+		rxRTO:    kcpRTODefault,
+		rxMinRTO: kcpRTOMin,
+		interval: kcpInterval,
+		tsFlush:  kcpInterval,
+		ssthresh: kcpThreshInit,
+		deadLink: kcpDeadLink,
+		output:   output,
+	}
+	kcp.buffer = make([]byte, kcp.mtu)
+	return kcp
+}
+
+// setMTU 设置MTU
+func (kcp *kcpControl) setMTU(mtu int) bool {
+	if mtu < 50 || mtu < kcpOverhead+kcp.reserved {
+		return false
+	}
+	kcp.mtu = uint32(mtu)
+	kcp.mss = kcp.mtu - kcpOverhead - uint32(kcp.reserved)
+	kcp.buffer = make([]byte, mtu)
+	return true
+}
+
+// setReserved 为上层协议（如FEC头）在每个报文前预留空间
+func (kcp *kcpControl) setReserved(n int) bool {
+	if n >= int(kcp.mtu-kcpOverhead) || n < 0 {
+		return false
+	}
+	kcp.reserved = n
+	kcp.mss = kcp.mtu - kcpOverhead - uint32(n)
+	return true
+}
+
+// setNoDelay 设置无延迟参数
+// nodelay: 0关闭 1开启；interval: 刷新间隔；resend: 快速重传阈值；nc: 1关闭拥塞控制
+func (kcp *kcpControl) setNoDelay(nodelay, interval, resend, nc int) {
+	if nodelay >= 0 {
+		kcp.nodelay = uint32(nodelay)
+		if nodelay != 0 {
+			kcp.rxMinRTO = kcpRTONoDelay
+		} else {
+			kcp.rxMinRTO = kcpRTOMin
+		}
+	}
+	if interval >= 0 {
+		if interval > 5000 {
+			interval = 5000
+		} else if interval < 10 {
+			interval = 10
+		}
+		kcp.interval = uint32(interval)
+	}
+	if resend >= 0 {
+		kcp.fastresend = int32(resend)
+	}
+	if nc >= 0 {
+		kcp.nocwnd = int32(nc)
+	}
+}
+
+// setWndSize 设置收发窗口
+func (kcp *kcpControl) setWndSize(sndwnd, rcvwnd int) {
+	if sndwnd > 0 {
+		kcp.sndWnd = uint32(sndwnd)
+	}
+	if rcvwnd > 0 {
+		kcp.rcvWnd = kcpMax(uint32(rcvwnd), kcpWndRcv)
+	}
+}
+
+// waitSnd 待发送的报文数量
+func (kcp *kcpControl) waitSnd() int {
+	return len(kcp.sndBuf) + len(kcp.sndQueue)
+}
+
+// peekSize 下一条完整消息的长度，无数据返回-1
+func (kcp *kcpControl) peekSize() int {
+	if len(kcp.rcvQueue) == 0 {
+		return -1
+	}
+
+	seg := &kcp.rcvQueue[0]
+	if seg.frg == 0 {
+		return len(seg.data)
+	}
+
+	if len(kcp.rcvQueue) < int(seg.frg)+1 {
+		return -1
+	}
+
+	length := 0
+	for k := range kcp.rcvQueue {
+		seg := &kcp.rcvQueue[k]
+		length += len(seg.data)
+		if seg.frg == 0 {
+			break
+		}
+	}
+	return length
+}
+
+// recv 读取一条完整消息到buffer
+func (kcp *kcpControl) recv(buffer []byte) int {
+	peeksize := kcp.peekSize()
+	if peeksize < 0 {
+		return -1
+	}
+	if peeksize > len(buffer) {
+		return -2
+	}
+
+	fastRecover := len(kcp.rcvQueue) >= int(kcp.rcvWnd)
+
+	n := 0
+	count := 0
+	for k := range kcp.rcvQueue {
+		seg := &kcp.rcvQueue[k]
+		copy(buffer, seg.data)
+		buffer = buffer[len(seg.data):]
+		n += len(seg.data)
+		count++
+		if seg.frg == 0 {
+			break
+		}
+	}
+	if count > 0 {
+		kcp.rcvQueue = kcpRemoveFront(kcp.rcvQueue, count)
+	}
+
+	kcp.moveReceived()
+
+	// 接收队列从满到有空位，主动告知对端窗口
+	if len(kcp.rcvQueue) < int(kcp.rcvWnd) && fastRecover {
+		kcp.probe |= kcpAskTell
+	}
+
+	return n
+}
+
+// send 将数据放入发送队列
+func (kcp *kcpControl) send(buffer []byte) int {
+	if len(buffer) == 0 {
+		return -1
+	}
+
+	// 流模式下尽量合并到最后一个未满报文
+	if kcp.stream != 0 {
+		if n := len(kcp.sndQueue); n > 0 {
+			seg := &kcp.sndQueue[n-1]
+			if len(seg.data) < int(kcp.mss) {
+				extend := int(kcp.mss) - len(seg.data)
+				if len(buffer) < extend {
+					extend = len(buffer)
+				}
+				seg.data = append(seg.data, buffer[:extend]...)
+				buffer = buffer[extend:]
+			}
+		}
+		if len(buffer) == 0 {
+			return 0
+		}
+	}
+
+	count := (len(buffer) + int(kcp.mss) - 1) / int(kcp.mss)
+	if count > kcpMaxFragment {
+		return -2
+	}
+	if count == 0 {
+		count = 1
+	}
+
+	for i := 0; i < count; i++ {
+		size := len(buffer)
+		if size > int(kcp.mss) {
+			size = int(kcp.mss)
+		}
+		seg := kcpSegment{data: make([]byte, size, kcp.mss)}
+		copy(seg.data, buffer[:size])
+		if kcp.stream == 0 {
+			seg.frg = uint8(count - i - 1)
+		}
+		kcp.sndQueue = append(kcp.sndQueue, seg)
+		buffer = buffer[size:]
+	}
+	return 0
+}
+
+// moveReceived 将连续的报文从接收缓冲移到接收队列
+func (kcp *kcpControl) moveReceived() {
+	count := 0
+	for k := range kcp.rcvBuf {
+		seg := &kcp.rcvBuf[k]
+		if seg.sn == kcp.rcvNxt && len(kcp.rcvQueue)+count < int(kcp.rcvWnd) {
+			kcp.rcvNxt++
+			count++
+		} else {
+			break
+		}
+	}
+	if count > 0 {
+		kcp.rcvQueue = append(kcp.rcvQueue, kcp.rcvBuf[:count]...)
+		kcp.rcvBuf = kcpRemoveFront(kcp.rcvBuf, count)
+	}
+}
+
+// updateAck 根据RTT样本更新RTO
+func (kcp *kcpControl) updateAck(rtt int32) {
+	if kcp.rxSrtt == 0 {
+		kcp.rxSrtt = rtt
+		kcp.rxRttvar = rtt >> 1
+	} else {
+		delta := rtt - kcp.rxSrtt
+		kcp.rxSrtt += delta >> 3
+		if delta < 0 {
+			delta = -delta
+		}
+		if rtt < kcp.rxSrtt-kcp.rxRttvar {
+			kcp.rxRttvar += (delta - kcp.rxRttvar) >> 5
+		} else {
+			kcp.rxRttvar += (delta - kcp.rxRttvar) >> 2
+		}
+	}
+	if kcp.rxSrtt < 1 {
+		kcp.rxSrtt = 1
+	}
+	rto := uint32(kcp.rxSrtt) + kcpMax(kcp.interval, uint32(kcp.rxRttvar)<<2)
+	kcp.rxRTO = kcpBound(kcp.rxMinRTO, rto, kcpRTOMax)
+}
+
+func (kcp *kcpControl) shrinkBuf() {
+	if len(kcp.sndBuf) > 0 {
+		kcp.sndUna = kcp.sndBuf[0].sn
+	} else {
+		kcp.sndUna = kcp.sndNxt
+	}
+}
+
+func (kcp *kcpControl) parseAck(sn uint32) {
+	if kcpTimeDiff(sn, kcp.sndUna) < 0 || kcpTimeDiff(sn, kcp.sndNxt) >= 0 {
+		return
+	}
+	for k := range kcp.sndBuf {
+		seg := &kcp.sndBuf[k]
+		if sn == seg.sn {
+			seg.acked = 1
+			seg.data = nil
+			break
+		}
+		if kcpTimeDiff(sn, seg.sn) < 0 {
+			break
+		}
+	}
+}
+
+func (kcp *kcpControl) parseFastack(sn, ts uint32) {
+	if kcpTimeDiff(sn, kcp.sndUna) < 0 || kcpTimeDiff(sn, kcp.sndNxt) >= 0 {
+		return
+	}
+	for k := range kcp.sndBuf {
+		seg := &kcp.sndBuf[k]
+		if kcpTimeDiff(sn, seg.sn) < 0 {
+			break
+		} else if sn != seg.sn && kcpTimeDiff(seg.ts, ts) <= 0 {
+			seg.fastack++
+		}
+	}
+}
+
+func (kcp *kcpControl) parseUna(una uint32) {
+	count := 0
+	for k := range kcp.sndBuf {
+		if kcpTimeDiff(una, kcp.sndBuf[k].sn) > 0 {
+			count++
+		} else {
+			break
+		}
+	}
+	if count > 0 {
+		kcp.sndBuf = kcpRemoveFront(kcp.sndBuf, count)
+	}
+}
+
+func (kcp *kcpControl) parseData(newseg kcpSegment) {
+	sn := newseg.sn
+	if kcpTimeDiff(sn, kcp.rcvNxt+kcp.rcvWnd) >= 0 || kcpTimeDiff(sn, kcp.rcvNxt) < 0 {
+		return
+	}
+
+	n := len(kcp.rcvBuf) - 1
+	insertIdx := 0
+	repeat := false
+	for i := n; i >= 0; i-- {
+		seg := &kcp.rcvBuf[i]
+		if seg.sn == sn {
+			repeat = true
+			break
+		}
+		if kcpTimeDiff(sn, seg.sn) > 0 {
+			insertIdx = i + 1
+			break
+		}
+	}
+
+	if !repeat {
+		// 底层缓冲区会被复用，必须拷贝
+		dataCopy := make([]byte, len(newseg.data))
+		copy(dataCopy, newseg.data)
+		newseg.data = dataCopy
+
+		if insertIdx == n+1 {
+			kcp.rcvBuf = append(kcp.rcvBuf, newseg)
+		} else {
+			kcp.rcvBuf = append(kcp.rcvBuf, kcpSegment{})
+			copy(kcp.rcvBuf[insertIdx+1:], kcp.rcvBuf[insertIdx:])
+			kcp.rcvBuf[insertIdx] = newseg
+		}
+	}
+
+	kcp.moveReceived()
+}
+
+// input 处理底层收到的KCP报文
+func (kcp *kcpControl) input(data []byte, ackNoDelay bool) int {
+	sndUna := kcp.sndUna
+	if len(data) < kcpOverhead {
+		return -1
+	}
+
+	var latest uint32
+	var flag int
+
+	for len(data) >= kcpOverhead {
+		conv := binary.LittleEndian.Uint32(data)
+		if conv != kcp.conv {
+			return -1
+		}
+		cmd := data[4]
+		frg := data[5]
+		wnd := binary.LittleEndian.Uint16(data[6:])
+		ts := binary.LittleEndian.Uint32(data[8:])
+		sn := binary.LittleEndian.Uint32(data[12:])
+		una := binary.LittleEndian.Uint32(data[16:])
+		length := binary.LittleEndian.Uint32(data[20:])
+		data = data[kcpOverhead:]
+
+		if uint32(len(data)) < length {
+			return -2
+		}
+
+		if cmd != kcpCmdPush && cmd != kcpCmdAck && cmd != kcpCmdWask && cmd != kcpCmdWins {
+			return -3
+		}
+
+		kcp.rmtWnd = uint32(wnd)
+		kcp.parseUna(una)
+		kcp.shrinkBuf()
+
+		switch cmd {
+		case kcpCmdAck:
+			kcp.parseAck(sn)
+			kcp.parseFastack(sn, ts)
+			flag |= 1
+			latest = ts
+		case kcpCmdPush:
+			if kcpTimeDiff(sn, kcp.rcvNxt+kcp.rcvWnd) < 0 {
+				kcp.acklist = append(kcp.acklist, kcpAckItem{sn: sn, ts: ts})
+				if kcpTimeDiff(sn, kcp.rcvNxt) >= 0 {
+					kcp.parseData(kcpSegment{
+						conv: conv,
+						cmd:  cmd,
+						frg:  frg,
+						wnd:  wnd,
+						ts:   ts,
+						sn:   sn,
+						una:  una,
+						data: data[:length],
+					})
+				}
+			}
+		case kcpCmdWask:
+			kcp.probe |= kcpAskTell
+		case kcpCmdWins:
+			// 仅更新远端窗口
+		}
+
+		data = data[length:]
+	}
+
+	// 使用最新的ACK时间戳更新RTT
+	if flag != 0 {
+		if current := kcpCurrentMs(); kcpTimeDiff(current, latest) >= 0 {
+			kcp.updateAck(kcpTimeDiff(current, latest))
+		}
+	}
+
+	// 拥塞窗口增长
+	if kcp.nocwnd == 0 && kcpTimeDiff(kcp.sndUna, sndUna) > 0 && kcp.cwnd < kcp.rmtWnd {
+		mss := kcp.mss
+		if kcp.cwnd < kcp.ssthresh {
+			kcp.cwnd++
+			kcp.incr += mss
+		} else {
+			if kcp.incr < mss {
+				kcp.incr = mss
+			}
+			kcp.incr += (mss*mss)/kcp.incr + (mss / 16)
+			if (kcp.cwnd+1)*mss <= kcp.incr {
+				kcp.cwnd++
+			}
+		}
+		if kcp.cwnd > kcp.rmtWnd {
+			kcp.cwnd = kcp.rmtWnd
+			kcp.incr = kcp.rmtWnd * mss
+		}
+	}
+
+	if ackNoDelay && len(kcp.acklist) > 0 {
+		kcp.flush(true)
+	}
+
+	return 0
+}
+
+func (kcp *kcpControl) wndUnused() uint16 {
+	if len(kcp.rcvQueue) < int(kcp.rcvWnd) {
+		return uint16(int(kcp.rcvWnd) - len(kcp.rcvQueue))
+	}
+	return 0
+}
+
+// flush 发送ACK、窗口探测和数据报文，返回建议的下次刷新间隔(ms)
+func (kcp *kcpControl) flush(ackOnly bool) uint32 {
+	seg := kcpSegment{
+		conv: kcp.conv,
+		cmd:  kcpCmdAck,
+		wnd:  kcp.wndUnused(),
+		una:  kcp.rcvNxt,
+	}
+
+	buffer := kcp.buffer
+	ptr := buffer[kcp.reserved:]
+
+	makeSpace := func(space int) {
+		size := len(buffer) - len(ptr)
+		if size+space > int(kcp.mtu) {
+			kcp.output(buffer, size)
+			ptr = buffer[kcp.reserved:]
+		}
+	}
+
+	flushBuffer := func() {
+		size := len(buffer) - len(ptr)
+		if size > kcp.reserved {
+			kcp.output(buffer, size)
+		}
+	}
+
+	// 发送ACK
+	for i, ack := range kcp.acklist {
+		makeSpace(kcpOverhead)
+		if kcpTimeDiff(ack.sn, kcp.rcvNxt) >= 0 || len(kcp.acklist)-1 == i {
+			seg.sn, seg.ts = ack.sn, ack.ts
+			ptr = seg.encode(ptr)
+		}
+	}
+	kcp.acklist = kcp.acklist[:0]
+
+	if ackOnly {
+		flushBuffer()
+		return kcp.interval
+	}
+
+	// 远端窗口为0时进行窗口探测
+	if kcp.rmtWnd == 0 {
+		current := kcpCurrentMs()
+		if kcp.probeWait == 0 {
+			kcp.probeWait = kcpProbeInit
+			kcp.tsProbe = current + kcp.probeWait
+		} else if kcpTimeDiff(current, kcp.tsProbe) >= 0 {
+			if kcp.probeWait < kcpProbeInit {
+				kcp.probeWait = kcpProbeInit
+			}
+			kcp.probeWait += kcp.probeWait / 2
+			if kcp.probeWait > kcpProbeLimit {
+				kcp.probeWait = kcpProbeLimit
+			}
+			kcp.tsProbe = current + kcp.probeWait
+			kcp.probe |= kcpAskSend
+		}
+	} else {
+		kcp.tsProbe = 0
+		kcp.probeWait = 0
+	}
+
+	if kcp.probe&kcpAskSend != 0 {
+		seg.cmd = kcpCmdWask
+		makeSpace(kcpOverhead)
+		ptr = seg.encode(ptr)
+	}
+	if kcp.probe&kcpAskTell != 0 {
+		seg.cmd = kcpCmdWins
+		makeSpace(kcpOverhead)
+		ptr = seg.encode(ptr)
+	}
+	kcp.probe = 0
+
+	// 计算有效窗口
+	cwnd := kcpMin(kcp.sndWnd, kcp.rmtWnd)
+	if kcp.nocwnd == 0 {
+		cwnd = kcpMin(kcp.cwnd, cwnd)
+	}
+
+	// 将发送队列中的报文移入发送缓冲
+	newSegsCount := 0
+	for k := range kcp.sndQueue {
+		if kcpTimeDiff(kcp.sndNxt, kcp.sndUna+cwnd) >= 0 {
+			break
+		}
+		newseg := kcp.sndQueue[k]
+		newseg.conv = kcp.conv
+		newseg.cmd = kcpCmdPush
+		newseg.sn = kcp.sndNxt
+		kcp.sndBuf = append(kcp.sndBuf, newseg)
+		kcp.sndNxt++
+		newSegsCount++
+	}
+	if newSegsCount > 0 {
+		kcp.sndQueue = kcpRemoveFront(kcp.sndQueue, newSegsCount)
+	}
+
+	resent := uint32(kcp.fastresend)
+	if kcp.fastresend <= 0 {
+		resent = 0xffffffff
+	}
+
+	current := kcpCurrentMs()
+	var change, lost uint64
+	minrto := int32(kcp.interval)
+
+	for k := range kcp.sndBuf {
+		segment := &kcp.sndBuf[k]
+		if segment.acked == 1 {
+			continue
+		}
+
+		needsend := false
+		if segment.xmit == 0 {
+			// 首次发送
+			needsend = true
+			segment.rto = kcp.rxRTO
+			segment.resendts = current + segment.rto
+		} else if segment.fastack >= resent {
+			// 快速重传
+			needsend = true
+			segment.fastack = 0
+			segment.rto = kcp.rxRTO
+			segment.resendts = current + segment.rto
+			change++
+			kcp.fastRetransSegs.Add(1)
+		} else if kcpTimeDiff(current, segment.resendts) >= 0 {
+			// 超时重传
+			needsend = true
+			if kcp.nodelay == 0 {
+				segment.rto += kcp.rxRTO
+			} else {
+				segment.rto += kcp.rxRTO / 2
+			}
+			segment.fastack = 0
+			segment.resendts = current + segment.rto
+			lost++
+			kcp.lostSegs.Add(1)
+		}
+
+		if needsend {
+			if segment.xmit > 0 {
+				kcp.retransSegs.Add(1)
+			}
+			segment.xmit++
+			segment.ts = current
+			segment.wnd = seg.wnd
+			segment.una = seg.una
+
+			makeSpace(kcpOverhead + len(segment.data))
+			ptr = segment.encode(ptr)
+			copy(ptr, segment.data)
+			ptr = ptr[len(segment.data):]
+
+			if segment.xmit >= kcp.deadLink {
+				kcp.state = kcpStateDead
+			}
+		}
+
+		if rto := kcpTimeDiff(segment.resendts, current); rto > 0 && rto < minrto {
+			minrto = rto
+		}
+	}
+
+	flushBuffer()
+
+	// 拥塞控制：快速重传后收缩窗口，超时丢包后进入慢启动
+	if kcp.nocwnd == 0 {
+		if change > 0 {
+			inflight := kcp.sndNxt - kcp.sndUna
+			kcp.ssthresh = inflight / 2
+			if kcp.ssthresh < kcpThreshMin {
+				kcp.ssthresh = kcpThreshMin
+			}
+			kcp.cwnd = kcp.ssthresh + resent
+			kcp.incr = kcp.cwnd * kcp.mss
+		}
+		if lost > 0 {
+			kcp.ssthresh = cwnd / 2
+			if kcp.ssthresh < kcpThreshMin {
+				kcp.ssthresh = kcpThreshMin
+			}
+			kcp.cwnd = 1
+			kcp.incr = kcp.mss
+		}
+		if kcp.cwnd < 1 {
+			kcp.cwnd = 1
+			kcp.incr = kcp.mss
+		}
+	}
+
+	return uint32(minrto)
+}
+
+// kcpRemoveFront 移除切片前count个元素并复用底层数组
+func kcpRemoveFront(q []kcpSegment, count int) []kcpSegment {
+	if count > cap(q)/2 {
+		newn := copy(q, q[count:])
+		for i := newn; i < len(q); i++ {
+			q[i] = kcpSegment{}
+		}
+		return q[:newn]
+	}
+	return q[count:]
+}
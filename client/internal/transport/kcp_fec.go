@@ -0,0 +1,313 @@
+package transport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// FEC报文格式：
+//
+//	| seqid(4) | flag(2) | size(2) | payload |
+//
+// 数据分片的size为payload长度+2；校验分片的size及之后内容为RS编码结果。
+// 每 dataShards+parityShards 个连续seqid组成一个分组。
+const (
+	fecHeaderSize      = 6
+	fecHeaderSizePlus2 = fecHeaderSize + 2
+	fecTypeData        = 0xf1
+	fecTypeParity      = 0xf2
+	fecMaxGroups       = 64 // 解码器最多保留的分组数
+)
+
+// checkFECShards 校验FEC分片参数：两者须同为0（关闭）或同为正数
+func checkFECShards(dataShards, parityShards int) error {
+	if dataShards < 0 || parityShards < 0 || (dataShards > 0) != (parityShards > 0) {
+		return fmt.Errorf("FEC数据分片与校验分片必须同时设置: %d+%d", dataShards, parityShards)
+	}
+	return nil
+}
+
+// kcpFECEncoder FEC编码器
+type kcpFECEncoder struct {
+	dataShards   int
+	parityShards int
+	shardSize    int
+	next         uint32 // 下一个seqid
+
+	shardCount int      // 当前分组已收集的数据分片数
+	maxSize    int      // 当前分组最大分片长度
+	shardCache [][]byte // 分组缓存
+
+	codec reedsolomon.Encoder
+}
+
+// newKCPFECEncoder 创建FEC编码器，两者均为0时不启用，只设置其一时返回错误
+func newKCPFECEncoder(dataShards, parityShards int) (*kcpFECEncoder, error) {
+	if err := checkFECShards(dataShards, parityShards); err != nil || dataShards == 0 {
+		return nil, err
+	}
+
+	codec, err := reedsolomon.New(dataShards, parityShards)
+	if err != nil {
+		return nil, fmt.Errorf("创建RS编码器失败: %w", err)
+	}
+
+	enc := &kcpFECEncoder{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		shardSize:    dataShards + parityShards,
+		codec:        codec,
+		shardCache:   make([][]byte, dataShards+parityShards),
+	}
+	return enc, nil
+}
+
+// encode 为数据报文填充FEC头，分组满时返回校验分片
+// b 的前 fecHeaderSizePlus2 字节为预留的头部空间
+func (enc *kcpFECEncoder) encode(b []byte) [][]byte {
+	enc.markData(b)
+	binary.LittleEndian.PutUint16(b[fecHeaderSize:], uint16(len(b)-fecHeaderSize))
+
+	// 缓存数据分片（底层缓冲区会被复用）
+	sz := len(b)
+	enc.shardCache[enc.shardCount] = append(enc.shardCache[enc.shardCount][:0], b...)
+	enc.shardCount++
+	if sz > enc.maxSize {
+		enc.maxSize = sz
+	}
+
+	if enc.shardCount < enc.dataShards {
+		return nil
+	}
+
+	// 分组满，补齐长度后生成校验分片
+	for i := 0; i < enc.dataShards; i++ {
+		shard := enc.shardCache[i]
+		slen := len(shard)
+		if cap(shard) < enc.maxSize {
+			grown := make([]byte, enc.maxSize)
+			copy(grown, shard)
+			shard = grown
+		} else {
+			shard = shard[:enc.maxSize]
+			clear(shard[slen:])
+		}
+		enc.shardCache[i] = shard
+	}
+
+	shards := make([][]byte, enc.shardSize)
+	for i := 0; i < enc.dataShards; i++ {
+		shards[i] = enc.shardCache[i][fecHeaderSize:]
+	}
+	for i := enc.dataShards; i < enc.shardSize; i++ {
+		if cap(enc.shardCache[i]) < enc.maxSize {
+			enc.shardCache[i] = make([]byte, enc.maxSize)
+		}
+		enc.shardCache[i] = enc.shardCache[i][:enc.maxSize]
+		shards[i] = enc.shardCache[i][fecHeaderSize:]
+	}
+
+	var ps [][]byte
+	if err := enc.codec.Encode(shards); err == nil {
+		ps = make([][]byte, 0, enc.parityShards)
+		for i := enc.dataShards; i < enc.shardSize; i++ {
+			enc.markParity(enc.shardCache[i])
+			ps = append(ps, enc.shardCache[i])
+		}
+	} else {
+		// 编码失败时跳过本组校验分片的seqid
+		enc.next += uint32(enc.parityShards)
+	}
+
+	enc.shardCount = 0
+	enc.maxSize = 0
+	return ps
+}
+
+func (enc *kcpFECEncoder) markData(data []byte) {
+	binary.LittleEndian.PutUint32(data, enc.next)
+	binary.LittleEndian.PutUint16(data[4:], fecTypeData)
+	enc.next++
+}
+
+func (enc *kcpFECEncoder) markParity(data []byte) {
+	binary.LittleEndian.PutUint32(data, enc.next)
+	binary.LittleEndian.PutUint16(data[4:], fecTypeParity)
+	enc.next++
+}
+
+// kcpFECGroup 解码分组
+type kcpFECGroup struct {
+	shards    [][]byte
+	received  int
+	delivered []bool // 数据分片是否已交付
+	recovered bool
+}
+
+// kcpFECDecoder FEC解码器
+type kcpFECDecoder struct {
+	dataShards   int
+	parityShards int
+	shardSize    int
+	groups       map[uint32]*kcpFECGroup
+	order        []uint32 // 分组创建顺序，用于淘汰
+
+	codec reedsolomon.Encoder
+
+	recoveredShards atomic.Uint64
+	parityShardsIn  atomic.Uint64
+}
+
+// newKCPFECDecoder 创建FEC解码器，两者均为0时不启用，只设置其一时返回错误
+func newKCPFECDecoder(dataShards, parityShards int) (*kcpFECDecoder, error) {
+	if err := checkFECShards(dataShards, parityShards); err != nil || dataShards == 0 {
+		return nil, err
+	}
+
+	codec, err := reedsolomon.New(dataShards, parityShards)
+	if err != nil {
+		return nil, fmt.Errorf("创建RS解码器失败: %w", err)
+	}
+
+	return &kcpFECDecoder{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		shardSize:    dataShards + parityShards,
+		groups:       make(map[uint32]*kcpFECGroup),
+		codec:        codec,
+	}, nil
+}
+
+// decode 处理一个FEC报文，返回可交付给KCP的报文列表
+func (dec *kcpFECDecoder) decode(pkt []byte) [][]byte {
+	if len(pkt) < fecHeaderSizePlus2 {
+		return nil
+	}
+
+	seqid := binary.LittleEndian.Uint32(pkt)
+	flag := binary.LittleEndian.Uint16(pkt[4:])
+	if flag != fecTypeData && flag != fecTypeParity {
+		return nil
+	}
+
+	groupID := seqid / uint32(dec.shardSize)
+	idx := int(seqid % uint32(dec.shardSize))
+	// 序号与类型不符的报文（数据分片落在校验位置或相反）直接丢弃
+	if !dec.validShard(flag, idx) {
+		return nil
+	}
+
+	group, ok := dec.groups[groupID]
+	if !ok {
+		group = &kcpFECGroup{
+			shards:    make([][]byte, dec.shardSize),
+			delivered: make([]bool, dec.dataShards),
+		}
+		dec.groups[groupID] = group
+		dec.order = append(dec.order, groupID)
+		dec.evict()
+	}
+
+	var out [][]byte
+	if flag == fecTypeData {
+		if payload, ok := fecPayload(pkt[fecHeaderSize:]); ok && !group.delivered[idx] {
+			group.delivered[idx] = true
+			out = append(out, payload)
+		}
+	} else {
+		dec.parityShardsIn.Add(1)
+	}
+
+	if group.recovered || group.shards[idx] != nil {
+		return out
+	}
+
+	shard := make([]byte, len(pkt)-fecHeaderSize)
+	copy(shard, pkt[fecHeaderSize:])
+	group.shards[idx] = shard
+	group.received++
+
+	// 收到足够分片且存在丢失的数据分片时尝试恢复
+	if group.received < dec.dataShards {
+		return out
+	}
+
+	missing := false
+	for i := 0; i < dec.dataShards; i++ {
+		if group.shards[i] == nil {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		group.recovered = true
+		return out
+	}
+
+	// RS要求所有分片等长，按最大长度补零
+	maxlen := 0
+	for _, s := range group.shards {
+		if len(s) > maxlen {
+			maxlen = len(s)
+		}
+	}
+	shards := make([][]byte, dec.shardSize)
+	for i, s := range group.shards {
+		if s == nil {
+			continue
+		}
+		if len(s) < maxlen {
+			padded := make([]byte, maxlen)
+			copy(padded, s)
+			s = padded
+		}
+		shards[i] = s
+	}
+
+	if err := dec.codec.ReconstructData(shards); err == nil {
+		for i := 0; i < dec.dataShards; i++ {
+			if group.shards[i] != nil || group.delivered[i] {
+				continue
+			}
+			if payload, ok := fecPayload(shards[i]); ok {
+				group.delivered[i] = true
+				out = append(out, payload)
+				dec.recoveredShards.Add(1)
+			}
+		}
+	}
+	group.recovered = true
+
+	return out
+}
+
+// validShard 数据分片的组内序号须小于数据分片数，校验分片须不小于数据分片数
+func (dec *kcpFECDecoder) validShard(flag uint16, idx int) bool {
+	if flag == fecTypeData {
+		return idx < dec.dataShards
+	}
+	return idx >= dec.dataShards && idx < dec.shardSize
+}
+
+// evict 淘汰最旧的分组
+func (dec *kcpFECDecoder) evict() {
+	for len(dec.order) > fecMaxGroups {
+		delete(dec.groups, dec.order[0])
+		dec.order = dec.order[1:]
+	}
+}
+
+// fecPayload 从 size(2)|payload 格式中取出payload
+func fecPayload(b []byte) ([]byte, bool) {
+	if len(b) < 2 {
+		return nil, false
+	}
+	size := int(binary.LittleEndian.Uint16(b))
+	if size < 2 || size > len(b) {
+		return nil, false
+	}
+	return b[2:size], true
+}
@@ -0,0 +1,205 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestKCPTransport_FECDialAccept 启用FEC的KCP会话在本地回环上建立并双向传输
+func TestKCPTransport_FECDialAccept(t *testing.T) {
+	server, err := NewKCPTransport(nil, nil)
+	if err != nil {
+		t.Fatalf("创建KCP传输失败: %v", err)
+	}
+	defer server.Close()
+	client, err := NewKCPTransport(nil, nil)
+	if err != nil {
+		t.Fatalf("创建KCP传输失败: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	l, err := server.Listen(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("KCP监听失败: %v", err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	conn, err := client.Dial(ctx, l.Addr().String())
+	if err != nil {
+		t.Fatalf("KCP连接失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	payload := bytes.Repeat([]byte("kcp-fec"), 4096)
+	go conn.Write(payload)
+	buf := make([]byte, len(payload))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("读取回显失败: %v", err)
+	}
+	if !bytes.Equal(buf, payload) {
+		t.Fatal("回显内容与发送内容不一致")
+	}
+
+	if got := server.GetStats()["fec_parity_in"].(uint64); got == 0 {
+		t.Error("启用FEC时服务端应收到校验分片")
+	}
+	if got := server.GetStats()["accepted_sessions"].(int64); got != 1 {
+		t.Errorf("服务端应接受 1 个会话，实际 %d", got)
+	}
+}
+
+// TestKCPConfig_UnpairedFECShards 只设置数据分片或校验分片时返回配置错误
+func TestKCPConfig_UnpairedFECShards(t *testing.T) {
+	for _, shards := range [][2]int{{10, 0}, {0, 3}} {
+		cfg := DefaultKCPConfig()
+		cfg.DataShards, cfg.ParityShards = shards[0], shards[1]
+		if _, err := NewKCPTransport(cfg, nil); err == nil {
+			t.Errorf("FEC %d+%d 应返回配置错误", shards[0], shards[1])
+		}
+		if _, err := newKCPFECEncoder(shards[0], shards[1]); err == nil {
+			t.Errorf("FEC编码器 %d+%d 应返回错误", shards[0], shards[1])
+		}
+		if _, err := newKCPFECDecoder(shards[0], shards[1]); err == nil {
+			t.Errorf("FEC解码器 %d+%d 应返回错误", shards[0], shards[1])
+		}
+	}
+
+	cfg := DefaultKCPConfig()
+	cfg.DataShards, cfg.ParityShards = 0, 0
+	if err := cfg.Validate(); err != nil || cfg.fecEnabled() {
+		t.Errorf("分片数均为0应关闭FEC，实际 %v", err)
+	}
+	if enc, err := newKCPFECEncoder(0, 0); enc != nil || err != nil {
+		t.Errorf("分片数均为0时不应创建编码器，实际 %v", err)
+	}
+}
+
+// TestKCPConfig_Manual manual模式保留手动参数并校验取值范围
+func TestKCPConfig_Manual(t *testing.T) {
+	cfg := DefaultKCPConfig()
+	cfg.Profile = "manual"
+	cfg.NoDelay, cfg.Interval, cfg.Resend, cfg.NoCongestion = 1, 15, 3, 0
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("合法的手动参数应通过校验: %v", err)
+	}
+	if cfg.NoDelay != 1 || cfg.Interval != 15 || cfg.Resend != 3 || cfg.NoCongestion != 0 {
+		t.Errorf("manual模式不应被预设覆盖，实际 %+v", cfg)
+	}
+
+	invalid := []func(c *KCPConfig){
+		func(c *KCPConfig) { c.NoDelay = 2 },
+		func(c *KCPConfig) { c.NoCongestion = -1 },
+		func(c *KCPConfig) { c.Resend = -1 },
+		func(c *KCPConfig) { c.Interval = 5 },
+		func(c *KCPConfig) { c.Interval = 6000 },
+	}
+	for i, mutate := range invalid {
+		cfg := DefaultKCPConfig()
+		cfg.Profile = "manual"
+		mutate(cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("第 %d 组无效手动参数应返回错误", i)
+		}
+	}
+}
+
+// malformedFECPacket 构造组内序号落在校验位置却标记为数据分片的报文
+func malformedFECPacket(seqid uint32) []byte {
+	pkt := make([]byte, fecHeaderSizePlus2+kcpOverhead+8)
+	binary.LittleEndian.PutUint32(pkt, seqid)
+	binary.LittleEndian.PutUint16(pkt[4:], fecTypeData)
+	binary.LittleEndian.PutUint16(pkt[fecHeaderSize:], uint16(len(pkt)-fecHeaderSize))
+	binary.LittleEndian.PutUint32(pkt[fecHeaderSizePlus2:], 0x1234)
+	return pkt
+}
+
+// TestKCPFECDecoder_RejectsShardIndexMismatch 数据分片序号超出数据分片数时丢弃，不越界
+func TestKCPFECDecoder_RejectsShardIndexMismatch(t *testing.T) {
+	dec, err := newKCPFECDecoder(10, 3)
+	if err != nil {
+		t.Fatalf("创建FEC解码器失败: %v", err)
+	}
+	for _, seqid := range []uint32{10, 12, 25} {
+		if out := dec.decode(malformedFECPacket(seqid)); out != nil {
+			t.Errorf("序号 %d 的数据分片应被丢弃，实际交付 %d 个报文", seqid, len(out))
+		}
+	}
+	parity := malformedFECPacket(3)
+	binary.LittleEndian.PutUint16(parity[4:], fecTypeParity)
+	dec.decode(parity)
+	if got := dec.parityShardsIn.Load(); got != 0 {
+		t.Errorf("落在数据位置的校验分片应被丢弃，实际计入 %d 个", got)
+	}
+}
+
+// TestKCPListener_MalformedFECPacket 非法分片不创建会话，监听继续正常工作
+func TestKCPListener_MalformedFECPacket(t *testing.T) {
+	server, err := NewKCPTransport(nil, nil)
+	if err != nil {
+		t.Fatalf("创建KCP传输失败: %v", err)
+	}
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	l, err := server.Listen(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("KCP监听失败: %v", err)
+	}
+	defer l.Close()
+
+	udp, err := net.Dial("udp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("连接UDP失败: %v", err)
+	}
+	defer udp.Close()
+	if _, err := udp.Write(malformedFECPacket(12)); err != nil {
+		t.Fatalf("发送报文失败: %v", err)
+	}
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	client, err := NewKCPTransport(nil, nil)
+	if err != nil {
+		t.Fatalf("创建KCP传输失败: %v", err)
+	}
+	defer client.Close()
+	conn, err := client.Dial(ctx, l.Addr().String())
+	if err != nil {
+		t.Fatalf("KCP连接失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("alive"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "alive" {
+		t.Fatalf("非法报文后监听应继续工作，实际 %q (%v)", buf, err)
+	}
+	if got := server.GetStats()["accepted_sessions"].(int64); got != 1 {
+		t.Errorf("非法报文不应创建会话，实际接受 %d 个", got)
+	}
+}
@@ -0,0 +1,783 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// KCPConfig KCP传输配置
+type KCPConfig struct {
+	Profile      string        `json:"profile"`       // 预设模式: normal/fast/fast2/fast3/manual
+	MTU          int           `json:"mtu"`           // 最大传输单元
+	SndWnd       int           `json:"snd_wnd"`       // 发送窗口（报文数）
+	RcvWnd       int           `json:"rcv_wnd"`       // 接收窗口（报文数）
+	NoDelay      int           `json:"no_delay"`      // 无延迟模式 0/1
+	Interval     int           `json:"interval"`      // 内部刷新间隔(ms)
+	Resend       int           `json:"resend"`        // 快速重传阈值，0关闭
+	NoCongestion int           `json:"no_congestion"` // 1关闭拥塞控制
+	DataShards   int           `json:"data_shards"`   // FEC数据分片数，0关闭FEC
+	ParityShards int           `json:"parity_shards"` // FEC校验分片数，0关闭FEC
+	AckNoDelay   bool          `json:"ack_no_delay"`  // 收到数据立即回ACK
+	SockBuf      int           `json:"sock_buf"`      // UDP套接字缓冲区大小
+	IdleTimeout  time.Duration `json:"idle_timeout"`  // 会话空闲超时
+	AcceptQueue  int           `json:"accept_queue"`  // 监听端待接受会话队列长度
+}
+
+// kcpProfiles 预设模式参数：nodelay, interval, resend, nc（与kcptun一致）
+var kcpProfiles = map[string][4]int{
+	"normal": {0, 40, 2, 1},
+	"fast":   {0, 30, 2, 1},
+	"fast2":  {1, 20, 2, 1},
+	"fast3":  {1, 10, 2, 1},
+}
+
+// DefaultKCPConfig 默认KCP配置（fast模式，10+3 FEC）
+func DefaultKCPConfig() *KCPConfig {
+	cfg := &KCPConfig{
+		Profile:      "fast",
+		MTU:          1350,
+		SndWnd:       1024,
+		RcvWnd:       1024,
+		DataShards:   10,
+		ParityShards: 3,
+		AckNoDelay:   false,
+		SockBuf:      4 * 1024 * 1024,
+		IdleTimeout:  2 * time.Minute,
+		AcceptQueue:  128,
+	}
+	cfg.ApplyProfile(cfg.Profile)
+	return cfg
+}
+
+// ApplyProfile 应用预设模式，manual 保持手动参数不变
+func (c *KCPConfig) ApplyProfile(profile string) error {
+	if profile == "" || profile == "manual" {
+		c.Profile = "manual"
+		return nil
+	}
+
+	p, ok := kcpProfiles[profile]
+	if !ok {
+		return fmt.Errorf("未知的KCP模式: %s", profile)
+	}
+
+	c.Profile = profile
+	c.NoDelay, c.Interval, c.Resend, c.NoCongestion = p[0], p[1], p[2], p[3]
+	return nil
+}
+
+// Validate 校验配置并补全默认值
+func (c *KCPConfig) Validate() error {
+	if c.Profile != "" && c.Profile != "manual" {
+		if err := c.ApplyProfile(c.Profile); err != nil {
+			return err
+		}
+	}
+	if c.MTU == 0 {
+		c.MTU = 1350
+	}
+	if c.MTU < 576 || c.MTU > 1500 {
+		return fmt.Errorf("KCP MTU超出范围(576-1500): %d", c.MTU)
+	}
+	if c.SndWnd <= 0 {
+		c.SndWnd = kcpWndSnd
+	}
+	if c.RcvWnd <= 0 {
+		c.RcvWnd = kcpWndRcv
+	}
+	if c.Profile == "manual" {
+		if c.NoDelay < 0 || c.NoDelay > 1 || c.NoCongestion < 0 || c.NoCongestion > 1 || c.Resend < 0 {
+			return fmt.Errorf("无效的KCP手动参数: nodelay=%d resend=%d nc=%d", c.NoDelay, c.Resend, c.NoCongestion)
+		}
+		if c.Interval < 10 || c.Interval > 5000 {
+			return fmt.Errorf("KCP刷新间隔超出范围(10-5000ms): %d", c.Interval)
+		}
+	}
+	if c.DataShards < 0 || c.ParityShards < 0 || c.DataShards+c.ParityShards > 256 {
+		return fmt.Errorf("无效的FEC参数: %d+%d", c.DataShards, c.ParityShards)
+	}
+	if (c.DataShards > 0) != (c.ParityShards > 0) {
+		return fmt.Errorf("FEC数据分片与校验分片必须同时设置: %d+%d", c.DataShards, c.ParityShards)
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = 2 * time.Minute
+	}
+	if c.AcceptQueue <= 0 {
+		c.AcceptQueue = 128
+	}
+	return nil
+}
+
+// fecEnabled 是否启用FEC
+func (c *KCPConfig) fecEnabled() bool {
+	return c.DataShards > 0 && c.ParityShards > 0
+}
+
+// KCPTransport KCP传输实现（基于UDP的可靠传输，以带宽换延迟）
+type KCPTransport struct {
+	config *KCPConfig
+	logger *zap.Logger
+
+	listeners   map[*KCPListener]struct{}
+	listenersMu sync.Mutex
+
+	// 统计信息
+	stats struct {
+		activeSessions  atomic.Int64
+		dialedSessions  atomic.Int64
+		acceptSessions  atomic.Int64
+		bytesIn         atomic.Int64
+		bytesOut        atomic.Int64
+		packetsIn       atomic.Int64
+		packetsOut      atomic.Int64
+		retransSegs     atomic.Uint64
+		fastRetransSegs atomic.Uint64
+		lostSegs        atomic.Uint64
+		fecRecovered    atomic.Uint64
+		fecParityIn     atomic.Uint64
+		inputErrors     atomic.Int64
+	}
+}
+
+// NewKCPTransport 创建KCP传输
+func NewKCPTransport(config *KCPConfig, logger *zap.Logger) (*KCPTransport, error) {
+	if config == nil {
+		config = DefaultKCPConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = zap.L().Named("kcp")
+	}
+
+	return &KCPTransport{
+		config:    config,
+		logger:    logger,
+		listeners: make(map[*KCPListener]struct{}),
+	}, nil
+}
+
+func (t *KCPTransport) Type() TransportType {
+	return TransportKCP
+}
+
+func (t *KCPTransport) Dial(ctx context.Context, address string) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("解析KCP地址失败: %w", err)
+	}
+
+	var lc net.ListenConfig
+	pc, err := lc.ListenPacket(ctx, "udp", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("创建UDP套接字失败: %w", err)
+	}
+	t.setSockBuf(pc)
+
+	var convBuf [4]byte
+	if _, err := io.ReadFull(rand.Reader, convBuf[:]); err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("生成会话ID失败: %w", err)
+	}
+	conv := binary.LittleEndian.Uint32(convBuf[:])
+
+	sess, err := newKCPSession(t, conv, pc, raddr, nil)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+
+	go sess.readLoop()
+
+	t.stats.dialedSessions.Add(1)
+	t.logger.Debug("KCP会话建立",
+		zap.String("remote", raddr.String()),
+		zap.Uint32("conv", conv))
+
+	return sess, nil
+}
+
+func (t *KCPTransport) Listen(ctx context.Context, address string) (net.Listener, error) {
+	var lc net.ListenConfig
+	pc, err := lc.ListenPacket(ctx, "udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("KCP监听失败: %w", err)
+	}
+	t.setSockBuf(pc)
+
+	l := &KCPListener{
+		transport: t,
+		conn:      pc,
+		sessions:  make(map[string]*KCPSession),
+		acceptCh:  make(chan *KCPSession, t.config.AcceptQueue),
+		die:       make(chan struct{}),
+	}
+
+	t.listenersMu.Lock()
+	t.listeners[l] = struct{}{}
+	t.listenersMu.Unlock()
+
+	go l.monitor()
+
+	return l, nil
+}
+
+func (t *KCPTransport) Close() error {
+	t.listenersMu.Lock()
+	listeners := make([]*KCPListener, 0, len(t.listeners))
+	for l := range t.listeners {
+		listeners = append(listeners, l)
+	}
+	t.listenersMu.Unlock()
+
+	for _, l := range listeners {
+		l.Close()
+	}
+	return nil
+}
+
+func (t *KCPTransport) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"type":              "kcp",
+		"profile":           t.config.Profile,
+		"mtu":               t.config.MTU,
+		"snd_wnd":           t.config.SndWnd,
+		"rcv_wnd":           t.config.RcvWnd,
+		"data_shards":       t.config.DataShards,
+		"parity_shards":     t.config.ParityShards,
+		"active_sessions":   t.stats.activeSessions.Load(),
+		"dialed_sessions":   t.stats.dialedSessions.Load(),
+		"accepted_sessions": t.stats.acceptSessions.Load(),
+		"bytes_in":          t.stats.bytesIn.Load(),
+		"bytes_out":         t.stats.bytesOut.Load(),
+		"packets_in":        t.stats.packetsIn.Load(),
+		"packets_out":       t.stats.packetsOut.Load(),
+		"retrans_segs":      t.stats.retransSegs.Load(),
+		"fast_retrans_segs": t.stats.fastRetransSegs.Load(),
+		"lost_segs":         t.stats.lostSegs.Load(),
+		"fec_recovered":     t.stats.fecRecovered.Load(),
+		"fec_parity_in":     t.stats.fecParityIn.Load(),
+		"input_errors":      t.stats.inputErrors.Load(),
+	}
+}
+
+// setSockBuf 设置UDP套接字缓冲区
+func (t *KCPTransport) setSockBuf(pc net.PacketConn) {
+	if t.config.SockBuf <= 0 {
+		return
+	}
+	if udpConn, ok := pc.(*net.UDPConn); ok {
+		if err := udpConn.SetReadBuffer(t.config.SockBuf); err != nil {
+			t.logger.Debug("设置UDP读缓冲区失败", zap.Error(err))
+		}
+		if err := udpConn.SetWriteBuffer(t.config.SockBuf); err != nil {
+			t.logger.Debug("设置UDP写缓冲区失败", zap.Error(err))
+		}
+	}
+}
+
+// KCPSession KCP会话，实现net.Conn
+type KCPSession struct {
+	transport *KCPTransport
+	conn      net.PacketConn
+	remote    net.Addr
+	listener  *KCPListener // 服务端会话所属监听器，客户端会话为nil
+
+	kcp    *kcpControl
+	fecEnc *kcpFECEncoder
+	fecDec *kcpFECDecoder
+	mu     sync.Mutex
+
+	leftover []byte // 未读完的消息
+
+	readDeadline  atomic.Value
+	writeDeadline atomic.Value
+	lastInput     atomic.Int64
+
+	chReadEvent  chan struct{}
+	chWriteEvent chan struct{}
+	die          chan struct{}
+	closeOnce    sync.Once
+}
+
+// newKCPSession 创建KCP会话
+func newKCPSession(t *KCPTransport, conv uint32, conn net.PacketConn, remote net.Addr, l *KCPListener) (*KCPSession, error) {
+	s := &KCPSession{
+		transport:    t,
+		conn:         conn,
+		remote:       remote,
+		listener:     l,
+		chReadEvent:  make(chan struct{}, 1),
+		chWriteEvent: make(chan struct{}, 1),
+		die:          make(chan struct{}),
+	}
+
+	cfg := t.config
+	if cfg.fecEnabled() {
+		var err error
+		if s.fecEnc, err = newKCPFECEncoder(cfg.DataShards, cfg.ParityShards); err != nil {
+			return nil, err
+		}
+		if s.fecDec, err = newKCPFECDecoder(cfg.DataShards, cfg.ParityShards); err != nil {
+			return nil, err
+		}
+	}
+
+	s.kcp = newKCPControl(conv, s.output)
+	s.kcp.stream = 1
+	s.kcp.setMTU(cfg.MTU)
+	if s.fecEnc != nil {
+		s.kcp.setReserved(fecHeaderSizePlus2)
+	}
+	s.kcp.setWndSize(cfg.SndWnd, cfg.RcvWnd)
+	s.kcp.setNoDelay(cfg.NoDelay, cfg.Interval, cfg.Resend, cfg.NoCongestion)
+
+	s.lastInput.Store(time.Now().UnixNano())
+	t.stats.activeSessions.Add(1)
+
+	go s.updater()
+
+	return s, nil
+}
+
+// output KCP输出回调（在持有s.mu时被调用）
+func (s *KCPSession) output(buf []byte, size int) {
+	pkt := buf[:size]
+
+	if s.fecEnc != nil {
+		parity := s.fecEnc.encode(pkt)
+		s.writePacket(pkt)
+		for _, p := range parity {
+			s.writePacket(p)
+		}
+		return
+	}
+
+	s.writePacket(pkt)
+}
+
+func (s *KCPSession) writePacket(pkt []byte) {
+	n, err := s.conn.WriteTo(pkt, s.remote)
+	if err != nil {
+		s.transport.logger.Debug("KCP报文发送失败", zap.Error(err))
+		return
+	}
+	s.transport.stats.packetsOut.Add(1)
+	s.transport.stats.bytesOut.Add(int64(n))
+}
+
+// input 处理收到的UDP报文
+func (s *KCPSession) input(pkt []byte) {
+	s.transport.stats.packetsIn.Add(1)
+	s.transport.stats.bytesIn.Add(int64(len(pkt)))
+	s.lastInput.Store(time.Now().UnixNano())
+
+	s.mu.Lock()
+	if s.fecDec != nil {
+		before := s.fecDec.recoveredShards.Load()
+		beforeParity := s.fecDec.parityShardsIn.Load()
+		for _, data := range s.fecDec.decode(pkt) {
+			if ret := s.kcp.input(data, s.transport.config.AckNoDelay); ret != 0 {
+				s.transport.stats.inputErrors.Add(1)
+			}
+		}
+		s.transport.stats.fecRecovered.Add(s.fecDec.recoveredShards.Load() - before)
+		s.transport.stats.fecParityIn.Add(s.fecDec.parityShardsIn.Load() - beforeParity)
+	} else if ret := s.kcp.input(pkt, s.transport.config.AckNoDelay); ret != 0 {
+		s.transport.stats.inputErrors.Add(1)
+	}
+
+	readable := s.kcp.peekSize() > 0
+	writable := s.kcp.waitSnd() < int(s.kcp.sndWnd)
+	s.mu.Unlock()
+
+	if readable {
+		s.notify(s.chReadEvent)
+	}
+	if writable {
+		s.notify(s.chWriteEvent)
+	}
+}
+
+// updater 周期性刷新KCP状态
+func (s *KCPSession) updater() {
+	interval := time.Duration(s.kcp.interval) * time.Millisecond
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	idleTimeout := s.transport.config.IdleTimeout
+
+	for {
+		select {
+		case <-s.die:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		s.kcp.flush(false)
+		dead := s.kcp.state == kcpStateDead
+		writable := s.kcp.waitSnd() < int(s.kcp.sndWnd)
+		s.mu.Unlock()
+
+		if writable {
+			s.notify(s.chWriteEvent)
+		}
+
+		if dead {
+			s.transport.logger.Debug("KCP会话链路失效", zap.String("remote", s.remote.String()))
+			s.Close()
+			return
+		}
+
+		if time.Since(time.Unix(0, s.lastInput.Load())) > idleTimeout {
+			s.transport.logger.Debug("KCP会话空闲超时", zap.String("remote", s.remote.String()))
+			s.Close()
+			return
+		}
+	}
+}
+
+// readLoop 客户端会话独占UDP套接字时的接收循环
+func (s *KCPSession) readLoop() {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			s.Close()
+			return
+		}
+		if addr.String() != s.remote.String() {
+			continue
+		}
+		s.input(buf[:n])
+	}
+}
+
+func (s *KCPSession) notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (s *KCPSession) Read(b []byte) (int, error) {
+	for {
+		s.mu.Lock()
+		if len(s.leftover) > 0 {
+			n := copy(b, s.leftover)
+			s.leftover = s.leftover[n:]
+			s.mu.Unlock()
+			return n, nil
+		}
+
+		if size := s.kcp.peekSize(); size > 0 {
+			if len(b) >= size {
+				n := s.kcp.recv(b)
+				s.mu.Unlock()
+				return n, nil
+			}
+
+			buf := make([]byte, size)
+			s.kcp.recv(buf)
+			n := copy(b, buf)
+			s.leftover = buf[n:]
+			s.mu.Unlock()
+			return n, nil
+		}
+		s.mu.Unlock()
+
+		if err := s.waitEvent(s.chReadEvent, &s.readDeadline); err != nil {
+			if err == io.ErrClosedPipe {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+	}
+}
+
+func (s *KCPSession) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		select {
+		case <-s.die:
+			return written, io.ErrClosedPipe
+		default:
+		}
+
+		s.mu.Lock()
+		// 发送队列未满时写入，满时等待对端确认（回压）
+		if s.kcp.waitSnd() < int(s.kcp.sndWnd) {
+			mss := int(s.kcp.mss)
+			for written < len(b) && s.kcp.waitSnd() < int(s.kcp.sndWnd) {
+				end := written + mss
+				if end > len(b) {
+					end = len(b)
+				}
+				s.kcp.send(b[written:end])
+				written = end
+			}
+			s.kcp.flush(false)
+			s.mu.Unlock()
+			continue
+		}
+		s.mu.Unlock()
+
+		if err := s.waitEvent(s.chWriteEvent, &s.writeDeadline); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// waitEvent 等待读写事件、超时或会话关闭
+func (s *KCPSession) waitEvent(ch chan struct{}, deadline *atomic.Value) error {
+	var timeout <-chan time.Time
+	if d, ok := deadline.Load().(time.Time); ok && !d.IsZero() {
+		delay := time.Until(d)
+		if delay <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-s.die:
+		return io.ErrClosedPipe
+	}
+}
+
+func (s *KCPSession) Close() error {
+	var once bool
+	s.closeOnce.Do(func() {
+		once = true
+		close(s.die)
+
+		// 尽力发送残留数据
+		s.mu.Lock()
+		s.kcp.flush(false)
+		s.mu.Unlock()
+
+		s.transport.stats.activeSessions.Add(-1)
+		s.collectStats()
+
+		if s.listener != nil {
+			s.listener.removeSession(s.remote)
+		} else {
+			s.conn.Close()
+		}
+	})
+
+	if !once {
+		return io.ErrClosedPipe
+	}
+	return nil
+}
+
+func (s *KCPSession) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+func (s *KCPSession) RemoteAddr() net.Addr {
+	return s.remote
+}
+
+func (s *KCPSession) SetDeadline(t time.Time) error {
+	s.readDeadline.Store(t)
+	s.writeDeadline.Store(t)
+	s.notify(s.chReadEvent)
+	s.notify(s.chWriteEvent)
+	return nil
+}
+
+func (s *KCPSession) SetReadDeadline(t time.Time) error {
+	s.readDeadline.Store(t)
+	s.notify(s.chReadEvent)
+	return nil
+}
+
+func (s *KCPSession) SetWriteDeadline(t time.Time) error {
+	s.writeDeadline.Store(t)
+	s.notify(s.chWriteEvent)
+	return nil
+}
+
+// GetStats 获取会话统计（RTT/RTO/重传）
+func (s *KCPSession) GetStats() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return map[string]interface{}{
+		"conv":              s.kcp.conv,
+		"remote":            s.remote.String(),
+		"srtt_ms":           s.kcp.rxSrtt,
+		"rttvar_ms":         s.kcp.rxRttvar,
+		"rto_ms":            s.kcp.rxRTO,
+		"cwnd":              s.kcp.cwnd,
+		"remote_wnd":        s.kcp.rmtWnd,
+		"wait_snd":          s.kcp.waitSnd(),
+		"retrans_segs":      s.kcp.retransSegs.Load(),
+		"fast_retrans_segs": s.kcp.fastRetransSegs.Load(),
+		"lost_segs":         s.kcp.lostSegs.Load(),
+	}
+}
+
+// collectStats 会话关闭时汇总重传统计
+func (s *KCPSession) collectStats() {
+	s.transport.stats.retransSegs.Add(s.kcp.retransSegs.Load())
+	s.transport.stats.fastRetransSegs.Add(s.kcp.fastRetransSegs.Load())
+	s.transport.stats.lostSegs.Add(s.kcp.lostSegs.Load())
+}
+
+// KCPListener KCP监听器，按远端地址将UDP报文分发给会话
+type KCPListener struct {
+	transport *KCPTransport
+	conn      net.PacketConn
+
+	sessions   map[string]*KCPSession
+	sessionsMu sync.Mutex
+
+	acceptCh  chan *KCPSession
+	die       chan struct{}
+	closeOnce sync.Once
+}
+
+// monitor 接收UDP报文并分发
+func (l *KCPListener) monitor() {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			l.Close()
+			return
+		}
+		l.packetInput(buf[:n], addr)
+	}
+}
+
+func (l *KCPListener) packetInput(pkt []byte, addr net.Addr) {
+	key := addr.String()
+
+	l.sessionsMu.Lock()
+	sess, ok := l.sessions[key]
+	l.sessionsMu.Unlock()
+
+	if ok {
+		sess.input(pkt)
+		return
+	}
+
+	// 新会话：从首个数据报文中取出conv
+	conv, ok := l.peekConv(pkt)
+	if !ok {
+		return
+	}
+
+	sess, err := newKCPSession(l.transport, conv, l.conn, addr, l)
+	if err != nil {
+		l.transport.logger.Error("创建KCP会话失败", zap.Error(err))
+		return
+	}
+
+	select {
+	case l.acceptCh <- sess:
+	default:
+		// 接受队列已满，丢弃新会话
+		sess.Close()
+		return
+	}
+
+	l.sessionsMu.Lock()
+	l.sessions[key] = sess
+	l.sessionsMu.Unlock()
+
+	l.transport.stats.acceptSessions.Add(1)
+	sess.input(pkt)
+}
+
+// peekConv 从报文中解析KCP会话ID
+func (l *KCPListener) peekConv(pkt []byte) (uint32, bool) {
+	if l.transport.config.fecEnabled() {
+		if len(pkt) < fecHeaderSizePlus2+kcpOverhead {
+			return 0, false
+		}
+		if binary.LittleEndian.Uint16(pkt[4:]) != fecTypeData {
+			return 0, false
+		}
+		shardSize := uint32(l.transport.config.DataShards + l.transport.config.ParityShards)
+		if int(binary.LittleEndian.Uint32(pkt)%shardSize) >= l.transport.config.DataShards {
+			return 0, false
+		}
+		pkt = pkt[fecHeaderSizePlus2:]
+	}
+	if len(pkt) < kcpOverhead {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(pkt), true
+}
+
+func (l *KCPListener) removeSession(addr net.Addr) {
+	l.sessionsMu.Lock()
+	delete(l.sessions, addr.String())
+	l.sessionsMu.Unlock()
+}
+
+func (l *KCPListener) Accept() (net.Conn, error) {
+	select {
+	case sess := <-l.acceptCh:
+		return sess, nil
+	case <-l.die:
+		return nil, errors.New("KCP监听器已关闭")
+	}
+}
+
+func (l *KCPListener) Close() error {
+	var once bool
+	l.closeOnce.Do(func() {
+		once = true
+		close(l.die)
+		l.conn.Close()
+
+		l.sessionsMu.Lock()
+		sessions := make([]*KCPSession, 0, len(l.sessions))
+		for _, sess := range l.sessions {
+			sessions = append(sessions, sess)
+		}
+		l.sessionsMu.Unlock()
+
+		for _, sess := range sessions {
+			sess.Close()
+		}
+
+		l.transport.listenersMu.Lock()
+		delete(l.transport.listeners, l)
+		l.transport.listenersMu.Unlock()
+	})
+
+	if !once {
+		return io.ErrClosedPipe
+	}
+	return nil
+}
+
+func (l *KCPListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
@@ -19,12 +19,15 @@ import (
 type TransportType string
 
 const (
-	TransportTCP  TransportType = "tcp"  // 普通TCP
-	TransportTLS  TransportType = "tls"  // TLS加密
-	TransportMTLS TransportType = "mtls" // 双向TLS
-	TransportWS   TransportType = "ws"   // WebSocket
-	TransportWSS  TransportType = "wss"  // WebSocket over TLS
-	TransportNone TransportType = "none" // 无传输（用于测试）
+	TransportTCP    TransportType = "tcp"     // 普通TCP
+	TransportTLS    TransportType = "tls"     // TLS加密
+	TransportMTLS   TransportType = "mtls"    // 双向TLS
+	TransportWS     TransportType = "ws"      // WebSocket
+	TransportWSS    TransportType = "wss"     // WebSocket over TLS
+	TransportKCP    TransportType = "kcp"     // KCP over UDP
+	TransportQUIC   TransportType = "quic"    // QUIC（多流复用，支持0-RTT与连接迁移）
+	TransportTLSMux TransportType = "tls-mux" // TLS多路复用（少量长连接承载多个流）
+	TransportNone   TransportType = "none"    // 无传输（用于测试）
 )
 
 // Transport 传输层接口
@@ -122,10 +125,121 @@ func (m *Manager) initTransports() error {
 	}
 	m.transports[TransportWSS] = wssTransport
 
+	// KCP传输
+	kcpTransport, err := NewKCPTransport(DefaultKCPConfig(), m.logger.Named("kcp"))
+	if err != nil {
+		return fmt.Errorf("初始化KCP传输失败: %w", err)
+	}
+	m.transports[TransportKCP] = kcpTransport
+
+	// QUIC传输
+	quicTransport, err := NewQUICTransport(DefaultQUICConfig(), m.getTLSConfig, m.logger.Named("quic"))
+	if err != nil {
+		return fmt.Errorf("初始化QUIC传输失败: %w", err)
+	}
+	m.transports[TransportQUIC] = quicTransport
+
+	// TLS多路复用传输
+	tlsMuxTransport, err := NewTLSMuxTransport(DefaultTLSMuxConfig(), m.getTLSConfig, m.logger.Named("tls-mux"))
+	if err != nil {
+		return fmt.Errorf("初始化tls-mux传输失败: %w", err)
+	}
+	m.transports[TransportTLSMux] = tlsMuxTransport
+
 	m.logger.Info("✅ 传输层初始化完成", zap.Int("types", len(m.transports)))
 	return nil
 }
 
+// ConfigureKCP 使用指定参数重建KCP传输（窗口、FEC、nodelay模式）
+func (m *Manager) ConfigureKCP(config *KCPConfig) error {
+	kcpTransport, err := NewKCPTransport(config, m.logger.Named("kcp"))
+	if err != nil {
+		return fmt.Errorf("配置KCP传输失败: %w", err)
+	}
+
+	m.transportsMu.Lock()
+	old := m.transports[TransportKCP]
+	m.transports[TransportKCP] = kcpTransport
+	m.transportsMu.Unlock()
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			m.logger.Warn("关闭旧KCP传输失败", zap.Error(err))
+		}
+	}
+
+	m.logger.Info("KCP传输已配置",
+		zap.String("profile", config.Profile),
+		zap.Int("snd_wnd", config.SndWnd),
+		zap.Int("rcv_wnd", config.RcvWnd),
+		zap.Int("data_shards", config.DataShards),
+		zap.Int("parity_shards", config.ParityShards))
+	return nil
+}
+
+// ConfigureQUIC 使用指定参数和证书来源重建QUIC传输（如 certificate.Manager.GetTLSConfig），
+// peerTLS 非空时拨号按对端地址取TLS配置（如 certificate.Manager.ClientTLSConfig）
+func (m *Manager) ConfigureQUIC(config *QUICConfig, tlsProvider TLSConfigProvider, peerTLS PeerTLSConfigProvider) error {
+	if tlsProvider == nil {
+		tlsProvider = m.getTLSConfig
+	}
+	quicTransport, err := NewQUICTransport(config, tlsProvider, m.logger.Named("quic"))
+	if err != nil {
+		return fmt.Errorf("配置QUIC传输失败: %w", err)
+	}
+	quicTransport.SetPeerTLS(peerTLS)
+
+	m.transportsMu.Lock()
+	old := m.transports[TransportQUIC]
+	m.transports[TransportQUIC] = quicTransport
+	m.transportsMu.Unlock()
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			m.logger.Warn("关闭旧QUIC传输失败", zap.Error(err))
+		}
+	}
+
+	m.logger.Info("QUIC传输已配置",
+		zap.Bool("allow_0rtt", quicTransport.config.Allow0RTT),
+		zap.Bool("migration", quicTransport.config.EnableMigration))
+	return nil
+}
+
+// ConfigureTLSMux 使用指定参数和证书来源重建tls-mux传输，旧传输的会话会被排空，
+// peerTLS 的含义同 ConfigureQUIC
+func (m *Manager) ConfigureTLSMux(config *TLSMuxConfig, tlsProvider TLSConfigProvider, peerTLS PeerTLSConfigProvider) error {
+	if tlsProvider == nil {
+		tlsProvider = m.getTLSConfig
+	}
+	tlsMuxTransport, err := NewTLSMuxTransport(config, tlsProvider, m.logger.Named("tls-mux"))
+	if err != nil {
+		return fmt.Errorf("配置tls-mux传输失败: %w", err)
+	}
+	tlsMuxTransport.SetPeerTLS(peerTLS)
+
+	m.transportsMu.Lock()
+	old := m.transports[TransportTLSMux]
+	m.transports[TransportTLSMux] = tlsMuxTransport
+	m.transportsMu.Unlock()
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			m.logger.Warn("关闭旧tls-mux传输失败", zap.Error(err))
+		}
+	}
+
+	m.logger.Info("tls-mux传输已配置",
+		zap.Int("conns_per_peer", tlsMuxTransport.config.ConnsPerPeer),
+		zap.Int("streams_per_conn", tlsMuxTransport.config.StreamsPerConn))
+	return nil
+}
+
+// getTLSConfig 返回创建管理器时传入的TLS配置
+func (m *Manager) getTLSConfig() *tls.Config {
+	return m.tlsConfig
+}
+
 // Start 启动传输管理器
 func (m *Manager) Start() error {
 	m.ctx, m.cancel = context.WithCancel(context.Background())
@@ -0,0 +1,833 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"go.uber.org/zap"
+)
+
+const (
+	// quicStreamHeader 新建流时客户端发送的首字节，让服务端立即感知流（QUIC流在首次写入前对端不可见）
+	quicStreamHeader byte = 0x01
+
+	quicCloseNormal quic.ApplicationErrorCode = 0x0
+	quicStreamReset quic.StreamErrorCode      = 0x0
+)
+
+// QUICConfig QUIC传输配置
+type QUICConfig struct {
+	ALPN                   string        `json:"alpn"`                     // 应用层协议标识
+	Allow0RTT              bool          `json:"allow_0rtt"`               // 启用0-RTT会话恢复
+	EnableMigration        bool          `json:"enable_migration"`         // 本地网络变化时主动迁移连接
+	MigrationCheckInterval time.Duration `json:"migration_check_interval"` // 本地地址检测间隔
+	HandshakeTimeout       time.Duration `json:"handshake_timeout"`        // 握手超时
+	MaxIdleTimeout         time.Duration `json:"max_idle_timeout"`         // 连接空闲超时
+	KeepAlivePeriod        time.Duration `json:"keep_alive_period"`        // 保活间隔（维持NAT映射）
+	MaxIncomingStreams     int64         `json:"max_incoming_streams"`     // 单连接最大并发流
+	MaxStreamWindow        uint64        `json:"max_stream_window"`        // 单流最大接收窗口
+	MaxConnectionWindow    uint64        `json:"max_connection_window"`    // 连接最大接收窗口
+	SessionCacheSize       int           `json:"session_cache_size"`       // TLS会话票据缓存数量
+	AcceptQueue            int           `json:"accept_queue"`             // 监听端待接受流队列长度
+}
+
+// DefaultQUICConfig 默认QUIC配置
+func DefaultQUICConfig() *QUICConfig {
+	return &QUICConfig{
+		ALPN:                   "gkipass-quic",
+		Allow0RTT:              true,
+		EnableMigration:        true,
+		MigrationCheckInterval: 3 * time.Second,
+		HandshakeTimeout:       10 * time.Second,
+		MaxIdleTimeout:         60 * time.Second,
+		KeepAlivePeriod:        15 * time.Second,
+		MaxIncomingStreams:     1024,
+		MaxStreamWindow:        16 * 1024 * 1024,
+		MaxConnectionWindow:    64 * 1024 * 1024,
+		SessionCacheSize:       256,
+		AcceptQueue:            256,
+	}
+}
+
+// Validate 校验并补全配置
+func (c *QUICConfig) Validate() error {
+	if c.ALPN == "" {
+		c.ALPN = "gkipass-quic"
+	}
+	if c.HandshakeTimeout <= 0 {
+		c.HandshakeTimeout = 10 * time.Second
+	}
+	if c.MaxIdleTimeout <= 0 {
+		c.MaxIdleTimeout = 60 * time.Second
+	}
+	if c.KeepAlivePeriod < 0 || (c.KeepAlivePeriod > 0 && c.KeepAlivePeriod >= c.MaxIdleTimeout) {
+		return fmt.Errorf("无效的保活间隔: %v (空闲超时 %v)", c.KeepAlivePeriod, c.MaxIdleTimeout)
+	}
+	if c.MigrationCheckInterval <= 0 {
+		c.MigrationCheckInterval = 3 * time.Second
+	}
+	if c.MaxIncomingStreams <= 0 {
+		c.MaxIncomingStreams = 1024
+	}
+	if c.SessionCacheSize <= 0 {
+		c.SessionCacheSize = 256
+	}
+	if c.AcceptQueue <= 0 {
+		c.AcceptQueue = 256
+	}
+	return nil
+}
+
+// quicConfig 转换为quic-go配置
+func (c *QUICConfig) quicConfig() *quic.Config {
+	return &quic.Config{
+		HandshakeIdleTimeout:       c.HandshakeTimeout,
+		MaxIdleTimeout:             c.MaxIdleTimeout,
+		KeepAlivePeriod:            c.KeepAlivePeriod,
+		MaxIncomingStreams:         c.MaxIncomingStreams,
+		MaxIncomingUniStreams:      -1,
+		MaxStreamReceiveWindow:     c.MaxStreamWindow,
+		MaxConnectionReceiveWindow: c.MaxConnectionWindow,
+		Allow0RTT:                  c.Allow0RTT,
+	}
+}
+
+// TLSConfigProvider 返回当前TLS配置（证书轮换后返回新证书）
+type TLSConfigProvider func() *tls.Config
+
+// PeerTLSConfigProvider 返回连接指定对端时的TLS配置（按对端节点设置 ServerName 与证书校验）
+type PeerTLSConfigProvider func(address string) *tls.Config
+
+// QUICTransport QUIC传输实现：同一对端复用一条QUIC连接，每次Dial/Accept对应一个流
+type QUICTransport struct {
+	config       *QUICConfig
+	tlsProvider  TLSConfigProvider
+	peerTLS      PeerTLSConfigProvider
+	sessionCache tls.ClientSessionCache
+	ticketKey    [32]byte // 服务端会话票据密钥，所有握手共用以支持0-RTT恢复
+	logger       *zap.Logger
+
+	// 客户端连接（按目标地址复用）
+	peers   map[string]*quicPeer
+	peersMu sync.Mutex
+
+	listeners   map[*QUICListener]struct{}
+	listenersMu sync.Mutex
+
+	// 统计信息
+	stats struct {
+		dials             atomic.Int64
+		dialFailures      atomic.Int64
+		acceptedConns     atomic.Int64
+		streamsOpened     atomic.Int64
+		streamsAccepted   atomic.Int64
+		activeStreams     atomic.Int64
+		zeroRTTConns      atomic.Int64
+		migrations        atomic.Int64
+		migrationFailures atomic.Int64
+	}
+
+	localAddrs []string // 最近一次检测到的本地地址
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// NewQUICTransport 创建QUIC传输，tlsProvider为空时无法拨号和监听
+func NewQUICTransport(config *QUICConfig, tlsProvider TLSConfigProvider, logger *zap.Logger) (*QUICTransport, error) {
+	if config == nil {
+		config = DefaultQUICConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = zap.L().Named("quic")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &QUICTransport{
+		config:       config,
+		tlsProvider:  tlsProvider,
+		sessionCache: tls.NewLRUClientSessionCache(config.SessionCacheSize),
+		logger:       logger,
+		peers:        make(map[string]*quicPeer),
+		listeners:    make(map[*QUICListener]struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	if _, err := rand.Read(t.ticketKey[:]); err != nil {
+		cancel()
+		return nil, fmt.Errorf("生成会话票据密钥失败: %w", err)
+	}
+
+	if config.EnableMigration {
+		t.localAddrs = localInterfaceAddrs()
+		go t.migrationMonitor()
+	}
+
+	return t, nil
+}
+
+// SetPeerTLS 设置按对端地址构建客户端TLS配置的来源，需在拨号前调用
+func (t *QUICTransport) SetPeerTLS(peerTLS PeerTLSConfigProvider) {
+	t.peerTLS = peerTLS
+}
+
+func (t *QUICTransport) Type() TransportType {
+	return TransportQUIC
+}
+
+// clientTLSConfig 构建客户端TLS配置
+func (t *QUICTransport) clientTLSConfig(address string) (*tls.Config, error) {
+	if t.tlsProvider == nil {
+		return nil, fmt.Errorf("QUIC传输未配置TLS证书")
+	}
+	var tlsConf *tls.Config
+	if t.peerTLS != nil {
+		tlsConf = t.peerTLS(address)
+	} else {
+		tlsConf = t.tlsProvider()
+	}
+	if tlsConf == nil {
+		return nil, fmt.Errorf("QUIC传输未配置TLS证书")
+	}
+	tlsConf = tlsConf.Clone()
+	tlsConf.NextProtos = []string{t.config.ALPN}
+	tlsConf.MinVersion = tls.VersionTLS13
+	tlsConf.MaxVersion = 0
+	tlsConf.ClientSessionCache = t.sessionCache
+	if tlsConf.ServerName == "" {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			tlsConf.ServerName = host
+		}
+	}
+	return tlsConf, nil
+}
+
+// serverTLSConfig 构建服务端TLS配置，证书轮换后新连接自动使用新证书
+func (t *QUICTransport) serverTLSConfig() (*tls.Config, error) {
+	if t.tlsProvider == nil || t.tlsProvider() == nil {
+		return nil, fmt.Errorf("QUIC传输未配置TLS证书")
+	}
+	build := func() *tls.Config {
+		conf := t.tlsProvider().Clone()
+		conf.NextProtos = []string{t.config.ALPN}
+		conf.MinVersion = tls.VersionTLS13
+		conf.MaxVersion = 0
+		conf.SetSessionTicketKeys([][32]byte{t.ticketKey})
+		return conf
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		NextProtos: []string{t.config.ALPN},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return build(), nil
+		},
+	}, nil
+}
+
+func (t *QUICTransport) Dial(ctx context.Context, address string) (net.Conn, error) {
+	peer, err := t.getPeer(ctx, address)
+	if err != nil {
+		t.stats.dialFailures.Add(1)
+		return nil, err
+	}
+
+	stream, err := peer.conn.OpenStreamSync(ctx)
+	if err != nil {
+		// 连接已失效，移除后重试一次
+		t.removePeer(address, peer)
+		if peer, err = t.getPeer(ctx, address); err != nil {
+			t.stats.dialFailures.Add(1)
+			return nil, err
+		}
+		if stream, err = peer.conn.OpenStreamSync(ctx); err != nil {
+			t.stats.dialFailures.Add(1)
+			return nil, fmt.Errorf("打开QUIC流失败: %w", err)
+		}
+	}
+
+	if _, err := stream.Write([]byte{quicStreamHeader}); err != nil {
+		stream.CancelRead(quicStreamReset)
+		stream.CancelWrite(quicStreamReset)
+		t.stats.dialFailures.Add(1)
+		return nil, fmt.Errorf("初始化QUIC流失败: %w", err)
+	}
+
+	t.stats.streamsOpened.Add(1)
+	return newQUICStreamConn(t, peer.conn, stream, peer), nil
+}
+
+// getPeer 获取或建立到目标地址的QUIC连接
+func (t *QUICTransport) getPeer(ctx context.Context, address string) (*quicPeer, error) {
+	t.peersMu.Lock()
+	peer, ok := t.peers[address]
+	if !ok {
+		peer = &quicPeer{address: address, ready: make(chan struct{})}
+		t.peers[address] = peer
+	}
+	t.peersMu.Unlock()
+
+	if ok {
+		select {
+		case <-peer.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if peer.err == nil && peer.conn.Context().Err() == nil {
+			return peer, nil
+		}
+		// 连接失败或已关闭，重新建立
+		t.removePeer(address, peer)
+		return t.getPeer(ctx, address)
+	}
+
+	peer.conn, peer.transports, peer.err = t.dialConn(ctx, address)
+	close(peer.ready)
+	if peer.err != nil {
+		t.removePeer(address, peer)
+		return nil, peer.err
+	}
+
+	go t.watchPeer(peer)
+	return peer, nil
+}
+
+// dialConn 建立新的QUIC连接，支持0-RTT时使用早期连接
+func (t *QUICTransport) dialConn(ctx context.Context, address string) (*quic.Conn, []*quic.Transport, error) {
+	t.stats.dials.Add(1)
+
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析QUIC地址失败: %w", err)
+	}
+	tlsConf, err := t.clientTLSConfig(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	udpConn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建UDP套接字失败: %w", err)
+	}
+	tr := &quic.Transport{Conn: udpConn}
+
+	var conn *quic.Conn
+	if t.config.Allow0RTT {
+		conn, err = tr.DialEarly(ctx, raddr, tlsConf, t.config.quicConfig())
+	} else {
+		conn, err = tr.Dial(ctx, raddr, tlsConf, t.config.quicConfig())
+	}
+	if err != nil {
+		tr.Close()
+		return nil, nil, fmt.Errorf("QUIC握手失败: %w", err)
+	}
+
+	t.logger.Debug("QUIC连接建立",
+		zap.String("remote", raddr.String()),
+		zap.String("local", conn.LocalAddr().String()))
+
+	return conn, []*quic.Transport{tr}, nil
+}
+
+// watchPeer 连接关闭后清理对端记录并释放UDP套接字
+func (t *QUICTransport) watchPeer(peer *quicPeer) {
+	select {
+	case <-peer.conn.HandshakeComplete():
+		if peer.conn.ConnectionState().Used0RTT {
+			t.stats.zeroRTTConns.Add(1)
+		}
+	case <-peer.conn.Context().Done():
+	}
+
+	<-peer.conn.Context().Done()
+	t.removePeer(peer.address, peer)
+	peer.closeTransports()
+
+	t.logger.Debug("QUIC连接关闭",
+		zap.String("remote", peer.address),
+		zap.Error(context.Cause(peer.conn.Context())))
+}
+
+// removePeer 移除对端记录（仅当记录未被替换时）
+func (t *QUICTransport) removePeer(address string, peer *quicPeer) {
+	t.peersMu.Lock()
+	if t.peers[address] == peer {
+		delete(t.peers, address)
+	}
+	t.peersMu.Unlock()
+}
+
+// migrationMonitor 检测本地地址变化，变化时将客户端连接迁移到新路径
+func (t *QUICTransport) migrationMonitor() {
+	ticker := time.NewTicker(t.config.MigrationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		addrs := localInterfaceAddrs()
+		if slices.Equal(addrs, t.localAddrs) {
+			continue
+		}
+		t.localAddrs = addrs
+
+		t.logger.Info("检测到本地网络变化，迁移QUIC连接", zap.Strings("addrs", addrs))
+
+		t.peersMu.Lock()
+		peers := make([]*quicPeer, 0, len(t.peers))
+		for _, peer := range t.peers {
+			peers = append(peers, peer)
+		}
+		t.peersMu.Unlock()
+
+		for _, peer := range peers {
+			select {
+			case <-peer.ready:
+			default:
+				continue
+			}
+			if peer.err != nil || peer.conn.Context().Err() != nil {
+				continue
+			}
+			go t.migrate(peer)
+		}
+	}
+}
+
+// migrate 在新的UDP套接字上探测路径并切换
+func (t *QUICTransport) migrate(peer *quicPeer) {
+	if !peer.migrating.CompareAndSwap(false, true) {
+		return
+	}
+	defer peer.migrating.Store(false)
+
+	udpConn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		t.stats.migrationFailures.Add(1)
+		t.logger.Warn("QUIC迁移创建套接字失败", zap.String("remote", peer.address), zap.Error(err))
+		return
+	}
+	tr := &quic.Transport{Conn: udpConn}
+
+	path, err := peer.conn.AddPath(tr)
+	if err != nil {
+		tr.Close()
+		t.stats.migrationFailures.Add(1)
+		t.logger.Warn("QUIC迁移添加路径失败", zap.String("remote", peer.address), zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(peer.conn.Context(), t.config.HandshakeTimeout)
+	defer cancel()
+
+	if err := path.Probe(ctx); err != nil {
+		path.Close()
+		tr.Close()
+		t.stats.migrationFailures.Add(1)
+		t.logger.Warn("QUIC路径探测失败", zap.String("remote", peer.address), zap.Error(err))
+		return
+	}
+	if err := path.Switch(); err != nil {
+		path.Close()
+		tr.Close()
+		t.stats.migrationFailures.Add(1)
+		t.logger.Warn("QUIC路径切换失败", zap.String("remote", peer.address), zap.Error(err))
+		return
+	}
+
+	// 旧套接字关闭会中断连接，保留到连接结束
+	peer.addTransport(tr)
+	peer.migrations.Add(1)
+	t.stats.migrations.Add(1)
+
+	t.logger.Info("QUIC连接迁移成功",
+		zap.String("remote", peer.address),
+		zap.String("local", udpConn.LocalAddr().String()))
+}
+
+func (t *QUICTransport) Listen(ctx context.Context, address string) (net.Listener, error) {
+	tlsConf, err := t.serverTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var lc net.ListenConfig
+	pc, err := lc.ListenPacket(ctx, "udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("QUIC监听失败: %w", err)
+	}
+	tr := &quic.Transport{Conn: pc}
+
+	ln, err := tr.ListenEarly(tlsConf, t.config.quicConfig())
+	if err != nil {
+		tr.Close()
+		return nil, fmt.Errorf("QUIC监听失败: %w", err)
+	}
+
+	l := &QUICListener{
+		transport: t,
+		tr:        tr,
+		ln:        ln,
+		conns:     make(map[*quic.Conn]struct{}),
+		acceptCh:  make(chan *quicStreamConn, t.config.AcceptQueue),
+		die:       make(chan struct{}),
+	}
+
+	t.listenersMu.Lock()
+	t.listeners[l] = struct{}{}
+	t.listenersMu.Unlock()
+
+	go l.acceptConns()
+
+	return l, nil
+}
+
+func (t *QUICTransport) Close() error {
+	t.cancel()
+
+	t.listenersMu.Lock()
+	listeners := make([]*QUICListener, 0, len(t.listeners))
+	for l := range t.listeners {
+		listeners = append(listeners, l)
+	}
+	t.listenersMu.Unlock()
+
+	for _, l := range listeners {
+		l.Close()
+	}
+
+	t.peersMu.Lock()
+	peers := t.peers
+	t.peers = make(map[string]*quicPeer)
+	t.peersMu.Unlock()
+
+	for _, peer := range peers {
+		select {
+		case <-peer.ready:
+			if peer.err == nil {
+				peer.conn.CloseWithError(quicCloseNormal, "transport closed")
+				peer.closeTransports()
+			}
+		default:
+		}
+	}
+	return nil
+}
+
+func (t *QUICTransport) GetStats() map[string]interface{} {
+	t.peersMu.Lock()
+	connStats := make([]map[string]interface{}, 0, len(t.peers))
+	for _, peer := range t.peers {
+		select {
+		case <-peer.ready:
+		default:
+			continue
+		}
+		if peer.err != nil {
+			continue
+		}
+		stats := quicConnStats(peer.conn)
+		stats["streams"] = peer.streams.Load()
+		stats["migrations"] = peer.migrations.Load()
+		connStats = append(connStats, stats)
+	}
+	t.peersMu.Unlock()
+
+	t.listenersMu.Lock()
+	for l := range t.listeners {
+		connStats = append(connStats, l.connStats()...)
+	}
+	t.listenersMu.Unlock()
+
+	return map[string]interface{}{
+		"type":               "quic",
+		"allow_0rtt":         t.config.Allow0RTT,
+		"migration":          t.config.EnableMigration,
+		"dials":              t.stats.dials.Load(),
+		"dial_failures":      t.stats.dialFailures.Load(),
+		"accepted_conns":     t.stats.acceptedConns.Load(),
+		"streams_opened":     t.stats.streamsOpened.Load(),
+		"streams_accepted":   t.stats.streamsAccepted.Load(),
+		"active_streams":     t.stats.activeStreams.Load(),
+		"zero_rtt_conns":     t.stats.zeroRTTConns.Load(),
+		"migrations":         t.stats.migrations.Load(),
+		"migration_failures": t.stats.migrationFailures.Load(),
+		"connections":        connStats,
+	}
+}
+
+// quicConnStats 单个QUIC连接的RTT与丢包统计
+func quicConnStats(conn *quic.Conn) map[string]interface{} {
+	cs := conn.ConnectionStats()
+	lossRate := 0.0
+	if cs.PacketsSent > 0 {
+		lossRate = float64(cs.PacketsLost) / float64(cs.PacketsSent)
+	}
+	return map[string]interface{}{
+		"remote":           conn.RemoteAddr().String(),
+		"local":            conn.LocalAddr().String(),
+		"used_0rtt":        conn.ConnectionState().Used0RTT,
+		"rtt_ms":           float64(cs.SmoothedRTT.Microseconds()) / 1000,
+		"min_rtt_ms":       float64(cs.MinRTT.Microseconds()) / 1000,
+		"latest_rtt_ms":    float64(cs.LatestRTT.Microseconds()) / 1000,
+		"rtt_var_ms":       float64(cs.MeanDeviation.Microseconds()) / 1000,
+		"bytes_sent":       cs.BytesSent,
+		"bytes_received":   cs.BytesReceived,
+		"packets_sent":     cs.PacketsSent,
+		"packets_received": cs.PacketsReceived,
+		"packets_lost":     cs.PacketsLost,
+		"loss_rate":        lossRate,
+	}
+}
+
+// localInterfaceAddrs 获取本机非回环地址（排序后用于比较）
+func localInterfaceAddrs() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	result := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		result = append(result, ipNet.IP.String())
+	}
+	slices.Sort(result)
+	return result
+}
+
+// quicPeer 到某个对端地址的共享QUIC连接
+type quicPeer struct {
+	address string
+	conn    *quic.Conn
+	err     error
+	ready   chan struct{} // 连接建立完成（成功或失败）
+
+	transports   []*quic.Transport // 连接使用过的所有UDP套接字（迁移后保留旧套接字）
+	transportsMu sync.Mutex
+
+	streams    atomic.Int64
+	migrations atomic.Int64
+	migrating  atomic.Bool
+}
+
+func (p *quicPeer) addTransport(tr *quic.Transport) {
+	p.transportsMu.Lock()
+	p.transports = append(p.transports, tr)
+	p.transportsMu.Unlock()
+}
+
+func (p *quicPeer) closeTransports() {
+	p.transportsMu.Lock()
+	transports := p.transports
+	p.transports = nil
+	p.transportsMu.Unlock()
+
+	for _, tr := range transports {
+		tr.Close()
+	}
+}
+
+// QUICListener QUIC监听器，将所有连接上的流作为net.Conn返回
+type QUICListener struct {
+	transport *QUICTransport
+	tr        *quic.Transport
+	ln        *quic.EarlyListener
+
+	conns   map[*quic.Conn]struct{}
+	connsMu sync.Mutex
+
+	acceptCh  chan *quicStreamConn
+	die       chan struct{}
+	closeOnce sync.Once
+}
+
+// acceptConns 接受新连接
+func (l *QUICListener) acceptConns() {
+	for {
+		conn, err := l.ln.Accept(context.Background())
+		if err != nil {
+			l.Close()
+			return
+		}
+
+		l.connsMu.Lock()
+		l.conns[conn] = struct{}{}
+		l.connsMu.Unlock()
+		l.transport.stats.acceptedConns.Add(1)
+
+		go l.acceptStreams(conn)
+	}
+}
+
+// acceptStreams 接受连接上的新流
+func (l *QUICListener) acceptStreams(conn *quic.Conn) {
+	defer func() {
+		l.connsMu.Lock()
+		delete(l.conns, conn)
+		l.connsMu.Unlock()
+	}()
+
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go l.handshakeStream(conn, stream)
+	}
+}
+
+// handshakeStream 读取流首字节后投递到Accept队列
+func (l *QUICListener) handshakeStream(conn *quic.Conn, stream *quic.Stream) {
+	var header [1]byte
+	stream.SetReadDeadline(time.Now().Add(l.transport.config.HandshakeTimeout))
+	if _, err := io.ReadFull(stream, header[:]); err != nil || header[0] != quicStreamHeader {
+		stream.CancelRead(quicStreamReset)
+		stream.CancelWrite(quicStreamReset)
+		return
+	}
+	stream.SetReadDeadline(time.Time{})
+
+	sc := newQUICStreamConn(l.transport, conn, stream, nil)
+	select {
+	case l.acceptCh <- sc:
+		l.transport.stats.streamsAccepted.Add(1)
+	case <-l.die:
+		sc.Close()
+	}
+}
+
+// connStats 监听端所有连接的统计
+func (l *QUICListener) connStats() []map[string]interface{} {
+	l.connsMu.Lock()
+	defer l.connsMu.Unlock()
+
+	stats := make([]map[string]interface{}, 0, len(l.conns))
+	for conn := range l.conns {
+		s := quicConnStats(conn)
+		s["inbound"] = true
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+func (l *QUICListener) Accept() (net.Conn, error) {
+	select {
+	case sc := <-l.acceptCh:
+		return sc, nil
+	case <-l.die:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *QUICListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.die)
+		l.ln.Close()
+
+		l.connsMu.Lock()
+		for conn := range l.conns {
+			conn.CloseWithError(quicCloseNormal, "listener closed")
+		}
+		l.connsMu.Unlock()
+
+		l.tr.Close()
+
+		l.transport.listenersMu.Lock()
+		delete(l.transport.listeners, l)
+		l.transport.listenersMu.Unlock()
+	})
+	return nil
+}
+
+func (l *QUICListener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// quicStreamConn QUIC流包装为net.Conn
+type quicStreamConn struct {
+	*quic.Stream
+	transport *QUICTransport
+	conn      *quic.Conn
+	peer      *quicPeer
+	closeOnce sync.Once
+}
+
+func newQUICStreamConn(t *QUICTransport, conn *quic.Conn, stream *quic.Stream, peer *quicPeer) *quicStreamConn {
+	t.stats.activeStreams.Add(1)
+	if peer != nil {
+		peer.streams.Add(1)
+	}
+	return &quicStreamConn{
+		Stream:    stream,
+		transport: t,
+		conn:      conn,
+		peer:      peer,
+	}
+}
+
+// Close 关闭流的读写两端（quic.Stream.Close只关闭写端）
+func (c *quicStreamConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.Stream.CancelRead(quicStreamReset)
+		err = c.Stream.Close()
+		c.transport.stats.activeStreams.Add(-1)
+		if c.peer != nil {
+			c.peer.streams.Add(-1)
+		}
+	})
+	return err
+}
+
+// CloseWrite 半关闭，通知对端不再写入
+func (c *quicStreamConn) CloseWrite() error {
+	return c.Stream.Close()
+}
+
+func (c *quicStreamConn) Read(b []byte) (int, error) {
+	n, err := c.Stream.Read(b)
+	return n, quicStreamError(err)
+}
+
+func (c *quicStreamConn) Write(b []byte) (int, error) {
+	n, err := c.Stream.Write(b)
+	if quicStreamError(err) == io.EOF {
+		err = io.ErrClosedPipe
+	}
+	return n, err
+}
+
+func (c *quicStreamConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *quicStreamConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// quicStreamError 将对端重置流转换为io.EOF，便于转发逻辑统一处理
+func quicStreamError(err error) error {
+	var streamErr *quic.StreamError
+	if errors.As(err, &streamErr) && streamErr.Remote && streamErr.ErrorCode == quicStreamReset {
+		return io.EOF
+	}
+	return err
+}
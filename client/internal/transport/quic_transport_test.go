@@ -0,0 +1,117 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"gkipass/client/internal/certificate"
+)
+
+// newTestNode 创建独立证书目录的节点证书管理器（各节点CA互不相同）
+func newTestNode(t *testing.T, nodeID string) *certificate.Manager {
+	t.Helper()
+	m, err := certificate.New(nodeID, t.TempDir())
+	if err != nil {
+		t.Fatalf("创建节点 %s 证书失败: %v", nodeID, err)
+	}
+	return m
+}
+
+// startQUICEcho 以节点证书启动QUIC回显服务，返回监听地址
+func startQUICEcho(t *testing.T, node *certificate.Manager) string {
+	t.Helper()
+	server, err := NewQUICTransport(nil, node.GetTLSConfig, nil)
+	if err != nil {
+		t.Fatalf("创建QUIC传输失败: %v", err)
+	}
+	server.SetPeerTLS(node.ClientTLSConfig)
+	t.Cleanup(func() { server.Close() })
+
+	l, err := server.Listen(context.Background(), "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("QUIC监听失败: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// quicEcho 以节点证书拨号并完成一次回显
+func quicEcho(node *certificate.Manager, address string) error {
+	client, err := NewQUICTransport(nil, node.GetTLSConfig, nil)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	client.SetPeerTLS(node.ClientTLSConfig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	conn, err := client.Dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		return err
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if string(buf) != "ping" {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// TestQUICTransport_CrossNodeHandshake 两个独立节点按面板下发的CA固定互相认证后完成握手与回显
+func TestQUICTransport_CrossNodeHandshake(t *testing.T) {
+	const entryID, exitID = "0f1e2d3c4b5a69788796a5b4c3d2e1f0", "a1b2c3d4e5f60718293a4b5c6d7e8f90"
+	entry := newTestNode(t, entryID)
+	exit := newTestNode(t, exitID)
+	entry.SetPeers("tunnel:t1", []certificate.Peer{{Host: "127.0.0.1", NodeID: exitID, CertPin: exit.CAPin()}})
+	exit.SetPeers("tunnel:t1", []certificate.Peer{{Host: "127.0.0.1", NodeID: entryID, CertPin: entry.CAPin()}})
+
+	address := startQUICEcho(t, exit)
+	if err := quicEcho(entry, address); err != nil {
+		t.Fatalf("已互相固定的两个节点应完成QUIC握手: %v", err)
+	}
+
+	// 未登记对端固定的节点不信任对方CA
+	stranger := newTestNode(t, "5566778899aabbccddeeff0011223344")
+	if err := quicEcho(stranger, address); err == nil {
+		t.Error("未固定出口CA的节点不应连接成功")
+	}
+
+	// 出口未固定该节点的CA，拒绝其客户端证书
+	stranger.SetPeers("tunnel:t1", []certificate.Peer{{Host: "127.0.0.1", NodeID: exitID, CertPin: exit.CAPin()}})
+	if err := quicEcho(stranger, address); err == nil {
+		t.Error("出口未固定的节点不应连接成功")
+	}
+
+	// 固定正确但节点ID不符（证书不属于预期节点）
+	entry.SetPeers("tunnel:t1", []certificate.Peer{{Host: "127.0.0.1", NodeID: "ffffffffffffffffffffffffffffffff", CertPin: exit.CAPin()}})
+	if err := quicEcho(entry, address); err == nil {
+		t.Error("节点ID与证书不符时不应连接成功")
+	}
+
+	entry.RemovePeers("tunnel:t1")
+	if err := quicEcho(entry, address); err == nil {
+		t.Error("移除对端固定后不应再信任出口CA")
+	}
+}
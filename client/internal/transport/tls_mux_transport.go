@@ -0,0 +1,625 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gkipass/client/internal/multiplex"
+)
+
+var _ net.Conn = (*multiplex.Stream)(nil)
+
+// TLSMuxConfig TLS多路复用传输配置
+type TLSMuxConfig struct {
+	ConnsPerPeer      int           `json:"conns_per_peer"`      // 每个对端最多保持的TLS连接数
+	StreamsPerConn    int           `json:"streams_per_conn"`    // 单连接流数达到该值时优先新建连接
+	MaxStreams        uint32        `json:"max_streams"`         // 单连接最大并发流
+	InitialWindow     int64         `json:"initial_window"`      // 流初始窗口（字节）
+	DialTimeout       time.Duration `json:"dial_timeout"`        // TLS拨号超时
+	HandshakeTimeout  time.Duration `json:"handshake_timeout"`   // 服务端TLS握手超时
+	DrainTimeout      time.Duration `json:"drain_timeout"`       // GO_AWAY后等待存量流结束的最长时间
+	PingInterval      time.Duration `json:"ping_interval"`       // 会话心跳间隔
+	StreamIdleTimeout time.Duration `json:"stream_idle_timeout"` // 流空闲超时
+	AcceptQueue       int           `json:"accept_queue"`        // 监听端待接受流队列长度
+}
+
+// DefaultTLSMuxConfig 默认TLS多路复用配置
+func DefaultTLSMuxConfig() *TLSMuxConfig {
+	return &TLSMuxConfig{
+		ConnsPerPeer:      4,
+		StreamsPerConn:    256,
+		MaxStreams:        1024,
+		InitialWindow:     256 * 1024,
+		DialTimeout:       10 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		DrainTimeout:      30 * time.Second,
+		PingInterval:      15 * time.Second,
+		StreamIdleTimeout: 5 * time.Minute,
+		AcceptQueue:       256,
+	}
+}
+
+// Validate 校验并补全配置
+func (c *TLSMuxConfig) Validate() error {
+	def := DefaultTLSMuxConfig()
+	if c.ConnsPerPeer <= 0 {
+		c.ConnsPerPeer = def.ConnsPerPeer
+	}
+	if c.StreamsPerConn <= 0 {
+		c.StreamsPerConn = def.StreamsPerConn
+	}
+	if c.MaxStreams == 0 {
+		c.MaxStreams = def.MaxStreams
+	}
+	if c.StreamsPerConn > int(c.MaxStreams) {
+		return fmt.Errorf("单连接流数阈值(%d)不能超过最大并发流(%d)", c.StreamsPerConn, c.MaxStreams)
+	}
+	if c.InitialWindow <= 0 {
+		c.InitialWindow = def.InitialWindow
+	}
+	if c.InitialWindow > 64*1024*1024 {
+		return fmt.Errorf("流初始窗口过大: %d", c.InitialWindow)
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = def.DialTimeout
+	}
+	if c.HandshakeTimeout <= 0 {
+		c.HandshakeTimeout = def.HandshakeTimeout
+	}
+	if c.DrainTimeout <= 0 {
+		c.DrainTimeout = def.DrainTimeout
+	}
+	if c.PingInterval <= 0 {
+		c.PingInterval = def.PingInterval
+	}
+	if c.StreamIdleTimeout <= 0 {
+		c.StreamIdleTimeout = def.StreamIdleTimeout
+	}
+	if c.AcceptQueue <= 0 {
+		c.AcceptQueue = def.AcceptQueue
+	}
+	return nil
+}
+
+// sessionConfig 转换为多路复用会话配置
+func (c *TLSMuxConfig) sessionConfig() *multiplex.SessionConfig {
+	cfg := multiplex.DefaultSessionConfig()
+	cfg.InitialWindowSize = c.InitialWindow
+	cfg.MaxConcurrentStreams = c.MaxStreams
+	cfg.StreamIdleTimeout = c.StreamIdleTimeout
+	cfg.PingInterval = c.PingInterval
+	cfg.DrainTimeout = c.DrainTimeout
+	return cfg
+}
+
+// streamPriorityKey 拨号上下文中的流优先级
+type streamPriorityKey struct{}
+
+// WithStreamPriority 为拨号上下文设置流优先级（数值越大越优先，超出0-255时截断），
+// 隧道按规则优先级拨号时使用，tls-mux 传输据此调度同一连接上各流的发送顺序
+func WithStreamPriority(ctx context.Context, priority int) context.Context {
+	if priority < 0 {
+		priority = 0
+	} else if priority > 255 {
+		priority = 255
+	}
+	return context.WithValue(ctx, streamPriorityKey{}, uint8(priority))
+}
+
+// streamPriorityFromContext 获取拨号上下文中的流优先级，未设置时为0
+func streamPriorityFromContext(ctx context.Context) uint8 {
+	priority, _ := ctx.Value(streamPriorityKey{}).(uint8)
+	return priority
+}
+
+// TLSMuxTransport TLS多路复用传输：每个对端保持少量长连接TLS会话，每次Dial/Accept对应一个流
+type TLSMuxTransport struct {
+	config      *TLSMuxConfig
+	tlsProvider TLSConfigProvider
+	peerTLS     PeerTLSConfigProvider
+	logger      *zap.Logger
+
+	peers   map[string]*muxPeer
+	peersMu sync.Mutex
+
+	listeners   map[*TLSMuxListener]struct{}
+	listenersMu sync.Mutex
+
+	// 统计信息
+	stats struct {
+		dials           atomic.Int64
+		dialFailures    atomic.Int64
+		acceptedConns   atomic.Int64
+		streamsOpened   atomic.Int64
+		streamsAccepted atomic.Int64
+		drainedSessions atomic.Int64
+	}
+}
+
+// NewTLSMuxTransport 创建TLS多路复用传输
+func NewTLSMuxTransport(config *TLSMuxConfig, tlsProvider TLSConfigProvider, logger *zap.Logger) (*TLSMuxTransport, error) {
+	if config == nil {
+		config = DefaultTLSMuxConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = zap.L().Named("tls-mux")
+	}
+
+	return &TLSMuxTransport{
+		config:      config,
+		tlsProvider: tlsProvider,
+		logger:      logger,
+		peers:       make(map[string]*muxPeer),
+		listeners:   make(map[*TLSMuxListener]struct{}),
+	}, nil
+}
+
+// SetPeerTLS 设置按对端地址构建客户端TLS配置的来源，需在拨号前调用
+func (t *TLSMuxTransport) SetPeerTLS(peerTLS PeerTLSConfigProvider) {
+	t.peerTLS = peerTLS
+}
+
+func (t *TLSMuxTransport) Type() TransportType {
+	return TransportTLSMux
+}
+
+// Dial 在到目标地址的复用会话上打开新流，优先级取自 WithStreamPriority
+func (t *TLSMuxTransport) Dial(ctx context.Context, address string) (net.Conn, error) {
+	priority := streamPriorityFromContext(ctx)
+
+	// 会话可能在选中后进入排空或关闭，换一个会话重试
+	var lastErr error
+	for attempt := 0; attempt < 3; attempt++ {
+		session, err := t.pickSession(ctx, address)
+		if err != nil {
+			t.stats.dialFailures.Add(1)
+			return nil, err
+		}
+
+		stream, err := session.OpenStreamWithPriority(priority)
+		if err == nil {
+			t.stats.streamsOpened.Add(1)
+			return stream, nil
+		}
+		lastErr = err
+	}
+
+	t.stats.dialFailures.Add(1)
+	return nil, fmt.Errorf("打开复用流失败: %w", lastErr)
+}
+
+// pickSession 选择流最少的可用会话，必要时新建TLS连接
+func (t *TLSMuxTransport) pickSession(ctx context.Context, address string) (*multiplex.Session, error) {
+	peer := t.getPeer(address)
+
+	peer.mu.Lock()
+	var best *multiplex.Session
+	for {
+		peer.prune()
+		best = peer.leastLoaded()
+		total := len(peer.sessions) + peer.dialing
+		if best != nil && (best.NumStreams() < t.config.StreamsPerConn || total >= t.config.ConnsPerPeer) {
+			peer.mu.Unlock()
+			return best, nil
+		}
+		if total < t.config.ConnsPerPeer {
+			break
+		}
+
+		// 连接数已达上限且均在建立中，等待任一拨号完成
+		if peer.dialDone == nil {
+			peer.dialDone = make(chan struct{})
+		}
+		done := peer.dialDone
+		peer.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		peer.mu.Lock()
+	}
+	peer.dialing++
+	peer.mu.Unlock()
+
+	session, err := t.dialSession(ctx, address)
+
+	peer.mu.Lock()
+	peer.dialing--
+	if err == nil {
+		peer.sessions = append(peer.sessions, session)
+	}
+	if peer.dialDone != nil {
+		close(peer.dialDone)
+		peer.dialDone = nil
+	}
+	peer.mu.Unlock()
+
+	if err != nil {
+		// 新建失败时退回已有会话
+		if best != nil && !best.IsClosed() && !best.IsDraining() {
+			t.logger.Debug("新建复用连接失败，使用已有会话", zap.String("address", address), zap.Error(err))
+			return best, nil
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// getPeer 获取或创建对端记录
+func (t *TLSMuxTransport) getPeer(address string) *muxPeer {
+	t.peersMu.Lock()
+	defer t.peersMu.Unlock()
+
+	peer, ok := t.peers[address]
+	if !ok {
+		peer = &muxPeer{address: address}
+		t.peers[address] = peer
+	}
+	return peer
+}
+
+// dialSession 建立TLS连接并创建客户端会话
+func (t *TLSMuxTransport) dialSession(ctx context.Context, address string) (*multiplex.Session, error) {
+	t.stats.dials.Add(1)
+
+	tlsConf, err := t.clientTLSConfig(address)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &tls.Dialer{
+		Config:    tlsConf,
+		NetDialer: &net.Dialer{Timeout: t.config.DialTimeout, KeepAlive: 30 * time.Second},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("TLS拨号失败: %w", err)
+	}
+
+	session := multiplex.NewSession(conn, t.config.sessionConfig(), true)
+	if err := session.Start(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t.logger.Debug("复用会话建立",
+		zap.String("address", address),
+		zap.String("local", conn.LocalAddr().String()))
+
+	return session, nil
+}
+
+// clientTLSConfig 构建客户端TLS配置
+func (t *TLSMuxTransport) clientTLSConfig(address string) (*tls.Config, error) {
+	if t.tlsProvider == nil || t.tlsProvider() == nil {
+		return nil, fmt.Errorf("tls-mux传输未配置TLS证书")
+	}
+	var tlsConf *tls.Config
+	if t.peerTLS != nil {
+		tlsConf = t.peerTLS(address)
+	} else {
+		tlsConf = t.tlsProvider().Clone()
+	}
+	if tlsConf.ServerName == "" {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			tlsConf.ServerName = host
+		}
+	}
+	return tlsConf, nil
+}
+
+// Drain 对目标地址的现有会话发送GO_AWAY：新流改用新连接，存量流结束后旧连接关闭
+func (t *TLSMuxTransport) Drain(address string) {
+	t.peersMu.Lock()
+	peer, ok := t.peers[address]
+	t.peersMu.Unlock()
+	if !ok {
+		return
+	}
+
+	peer.mu.Lock()
+	sessions := peer.sessions
+	peer.sessions = nil
+	peer.mu.Unlock()
+
+	for _, session := range sessions {
+		if err := session.GoAway(); err != nil {
+			t.logger.Debug("发送GO_AWAY失败", zap.String("address", address), zap.Error(err))
+		}
+		t.stats.drainedSessions.Add(1)
+	}
+
+	if len(sessions) > 0 {
+		t.logger.Info("复用连接开始排空", zap.String("address", address), zap.Int("sessions", len(sessions)))
+	}
+}
+
+func (t *TLSMuxTransport) Listen(ctx context.Context, address string) (net.Listener, error) {
+	if t.tlsProvider == nil || t.tlsProvider() == nil {
+		return nil, fmt.Errorf("tls-mux传输未配置TLS证书")
+	}
+
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("tls-mux监听失败: %w", err)
+	}
+
+	// 每次握手读取最新证书，支持证书轮换
+	tlsConf := &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return t.tlsProvider().Clone(), nil
+		},
+	}
+
+	l := &TLSMuxListener{
+		transport: t,
+		ln:        ln,
+		tlsConfig: tlsConf,
+		sessions:  make(map[*multiplex.Session]struct{}),
+		acceptCh:  make(chan *multiplex.Stream, t.config.AcceptQueue),
+		die:       make(chan struct{}),
+	}
+
+	t.listenersMu.Lock()
+	t.listeners[l] = struct{}{}
+	t.listenersMu.Unlock()
+
+	go l.acceptConns()
+
+	return l, nil
+}
+
+// Close 关闭所有监听器，并排空所有客户端会话
+func (t *TLSMuxTransport) Close() error {
+	t.listenersMu.Lock()
+	listeners := make([]*TLSMuxListener, 0, len(t.listeners))
+	for l := range t.listeners {
+		listeners = append(listeners, l)
+	}
+	t.listenersMu.Unlock()
+
+	for _, l := range listeners {
+		l.Close()
+	}
+
+	t.peersMu.Lock()
+	addresses := make([]string, 0, len(t.peers))
+	for address := range t.peers {
+		addresses = append(addresses, address)
+	}
+	t.peersMu.Unlock()
+
+	for _, address := range addresses {
+		t.Drain(address)
+	}
+	return nil
+}
+
+func (t *TLSMuxTransport) GetStats() map[string]interface{} {
+	sessions := make([]map[string]interface{}, 0)
+
+	t.peersMu.Lock()
+	for address, peer := range t.peers {
+		peer.mu.Lock()
+		peer.prune()
+		for _, session := range peer.sessions {
+			stats := session.GetStats()
+			stats["address"] = address
+			sessions = append(sessions, stats)
+		}
+		peer.mu.Unlock()
+	}
+	t.peersMu.Unlock()
+
+	t.listenersMu.Lock()
+	for l := range t.listeners {
+		sessions = append(sessions, l.sessionStats()...)
+	}
+	t.listenersMu.Unlock()
+
+	return map[string]interface{}{
+		"type":             "tls-mux",
+		"conns_per_peer":   t.config.ConnsPerPeer,
+		"streams_per_conn": t.config.StreamsPerConn,
+		"dials":            t.stats.dials.Load(),
+		"dial_failures":    t.stats.dialFailures.Load(),
+		"accepted_conns":   t.stats.acceptedConns.Load(),
+		"streams_opened":   t.stats.streamsOpened.Load(),
+		"streams_accepted": t.stats.streamsAccepted.Load(),
+		"drained_sessions": t.stats.drainedSessions.Load(),
+		"sessions":         sessions,
+	}
+}
+
+// muxPeer 到某个对端地址的复用会话集合
+type muxPeer struct {
+	address  string
+	mu       sync.Mutex
+	sessions []*multiplex.Session
+	dialing  int           // 正在建立的连接数
+	dialDone chan struct{} // 拨号完成通知，等待者在连接数达上限时使用
+}
+
+// prune 移除已关闭或排空中的会话（调用方持有mu）
+func (p *muxPeer) prune() {
+	alive := p.sessions[:0]
+	for _, session := range p.sessions {
+		if !session.IsClosed() && !session.IsDraining() {
+			alive = append(alive, session)
+		}
+	}
+	clear(p.sessions[len(alive):])
+	p.sessions = alive
+}
+
+// leastLoaded 返回流最少的会话（调用方持有mu）
+func (p *muxPeer) leastLoaded() *multiplex.Session {
+	var best *multiplex.Session
+	bestStreams := 0
+	for _, session := range p.sessions {
+		n := session.NumStreams()
+		if best == nil || n < bestStreams {
+			best, bestStreams = session, n
+		}
+	}
+	return best
+}
+
+// TLSMuxListener TLS多路复用监听器，将所有会话上的流作为net.Conn返回
+type TLSMuxListener struct {
+	transport *TLSMuxTransport
+	ln        net.Listener
+	tlsConfig *tls.Config
+
+	sessions   map[*multiplex.Session]struct{}
+	sessionsMu sync.Mutex
+
+	acceptCh  chan *multiplex.Stream
+	die       chan struct{}
+	closeOnce sync.Once
+}
+
+// acceptConns 接受TCP连接并完成TLS握手
+func (l *TLSMuxListener) acceptConns() {
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				l.Close()
+				return
+			}
+			l.transport.logger.Debug("接受连接失败", zap.Error(err))
+			continue
+		}
+		go l.handshake(conn)
+	}
+}
+
+// handshake 完成TLS握手后创建服务端会话
+func (l *TLSMuxListener) handshake(conn net.Conn) {
+	tlsConn := tls.Server(conn, l.tlsConfig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.transport.config.HandshakeTimeout)
+	err := tlsConn.HandshakeContext(ctx)
+	cancel()
+	if err != nil {
+		l.transport.logger.Debug("TLS握手失败",
+			zap.String("remote", conn.RemoteAddr().String()),
+			zap.Error(err))
+		conn.Close()
+		return
+	}
+
+	session := multiplex.NewSession(tlsConn, l.transport.config.sessionConfig(), false)
+
+	l.sessionsMu.Lock()
+	select {
+	case <-l.die:
+		l.sessionsMu.Unlock()
+		tlsConn.Close()
+		return
+	default:
+	}
+	l.sessions[session] = struct{}{}
+	l.sessionsMu.Unlock()
+
+	if err := session.Start(); err != nil {
+		l.removeSession(session)
+		tlsConn.Close()
+		return
+	}
+	l.transport.stats.acceptedConns.Add(1)
+
+	l.acceptStreams(session)
+}
+
+// acceptStreams 将会话上的新流投递到Accept队列
+func (l *TLSMuxListener) acceptStreams(session *multiplex.Session) {
+	defer l.removeSession(session)
+
+	for {
+		stream, err := session.AcceptStream()
+		if err != nil {
+			return
+		}
+
+		select {
+		case l.acceptCh <- stream:
+			l.transport.stats.streamsAccepted.Add(1)
+		case <-l.die:
+			stream.Reset(multiplex.ErrorCodeRefusedStream)
+			return
+		}
+	}
+}
+
+func (l *TLSMuxListener) removeSession(session *multiplex.Session) {
+	l.sessionsMu.Lock()
+	delete(l.sessions, session)
+	l.sessionsMu.Unlock()
+}
+
+// sessionStats 监听端所有会话的统计
+func (l *TLSMuxListener) sessionStats() []map[string]interface{} {
+	l.sessionsMu.Lock()
+	defer l.sessionsMu.Unlock()
+
+	stats := make([]map[string]interface{}, 0, len(l.sessions))
+	for session := range l.sessions {
+		s := session.GetStats()
+		s["address"] = session.RemoteAddr().String()
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+func (l *TLSMuxListener) Accept() (net.Conn, error) {
+	select {
+	case stream := <-l.acceptCh:
+		return stream, nil
+	case <-l.die:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close 停止接受新连接，并对现有会话发送GO_AWAY排空
+func (l *TLSMuxListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.sessionsMu.Lock()
+		close(l.die)
+		sessions := make([]*multiplex.Session, 0, len(l.sessions))
+		for session := range l.sessions {
+			sessions = append(sessions, session)
+		}
+		l.sessionsMu.Unlock()
+
+		l.ln.Close()
+
+		for _, session := range sessions {
+			session.GoAway()
+			l.transport.stats.drainedSessions.Add(1)
+		}
+
+		l.transport.listenersMu.Lock()
+		delete(l.transport.listeners, l)
+		l.transport.listenersMu.Unlock()
+	})
+	return nil
+}
+
+func (l *TLSMuxListener) Addr() net.Addr {
+	return l.ln.Addr()
+}
@@ -0,0 +1,81 @@
+package tunnel
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"gkipass/client/internal/protocol"
+)
+
+// checkAccess 按面板下发的 ACL 判断连接是否允许（与面板 ACLService.CheckAccess 语义一致）
+// 规则按顺序匹配，字段为空表示不限制该维度，第一条命中的规则决定结果，无规则或未命中时允许
+func checkAccess(acl []protocol.ACLRule, sourceIP, destIP, proto string, port int) bool {
+	sourceIP = normalizeIP(sourceIP)
+	destIP = normalizeIP(destIP)
+
+	for _, rule := range acl {
+		if rule.SourceIP != "" && !matchIP(sourceIP, rule.SourceIP) {
+			continue
+		}
+		if rule.DestIP != "" && !matchIP(destIP, rule.DestIP) {
+			continue
+		}
+		if rule.Protocol != "" && rule.Protocol != "any" && !strings.EqualFold(proto, rule.Protocol) {
+			continue
+		}
+		if rule.PortRange != "" && !matchPort(port, rule.PortRange) {
+			continue
+		}
+		return rule.Action == "allow"
+	}
+	return true
+}
+
+// normalizeIP 去掉地址中的端口并将 IPv4 映射的 IPv6 地址还原为 IPv4
+func normalizeIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if ip := net.ParseIP(addr); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			return v4.String()
+		}
+		return ip.String()
+	}
+	return addr
+}
+
+// matchIP 匹配单个 IP 或 CIDR
+func matchIP(ip, cidr string) bool {
+	if !strings.Contains(cidr, "/") {
+		if ip == cidr {
+			return true
+		}
+		ruleIP := net.ParseIP(cidr)
+		return ruleIP != nil && ruleIP.Equal(net.ParseIP(ip))
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	return parsed != nil && ipNet.Contains(parsed)
+}
+
+// matchPort 匹配单个端口或 起始-结束 范围
+func matchPort(port int, portRange string) bool {
+	start, end, found := strings.Cut(portRange, "-")
+	if !found {
+		end = start
+	}
+	low, err := strconv.Atoi(strings.TrimSpace(start))
+	if err != nil {
+		return false
+	}
+	high, err := strconv.Atoi(strings.TrimSpace(end))
+	if err != nil {
+		return false
+	}
+	return port >= low && port <= high
+}
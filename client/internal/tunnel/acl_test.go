@@ -0,0 +1,41 @@
+package tunnel
+
+import (
+	"testing"
+
+	"gkipass/client/internal/protocol"
+)
+
+// TestCheckAccess 按顺序匹配第一条命中的规则，未命中时允许
+func TestCheckAccess(t *testing.T) {
+	acl := []protocol.ACLRule{
+		{Action: "allow", SourceIP: "203.0.113.5"},
+		{Action: "deny", SourceIP: "203.0.113.0/24"},
+		{Action: "deny", Protocol: "udp"},
+		{Action: "deny", DestIP: "10.0.0.1", PortRange: "8000-8100"},
+	}
+	cases := []struct {
+		name    string
+		source  string
+		dest    string
+		proto   string
+		port    int
+		allowed bool
+	}{
+		{"优先级更高的放行", "203.0.113.5:40000", "10.0.0.2", "tcp", 80, true},
+		{"CIDR 拒绝", "203.0.113.9:40000", "10.0.0.2", "tcp", 80, false},
+		{"IPv4 映射地址", "[::ffff:203.0.113.9]:40000", "10.0.0.2", "tcp", 80, false},
+		{"协议拒绝", "198.51.100.1:40000", "10.0.0.2", "udp", 80, false},
+		{"端口范围内", "198.51.100.1:40000", "10.0.0.1", "tcp", 8080, false},
+		{"端口范围外", "198.51.100.1:40000", "10.0.0.1", "tcp", 8200, true},
+		{"未命中默认允许", "198.51.100.1:40000", "10.0.0.2", "tcp", 80, true},
+	}
+	for _, tc := range cases {
+		if got := checkAccess(acl, tc.source, tc.dest, tc.proto, tc.port); got != tc.allowed {
+			t.Errorf("%s: 期望 %v，实际 %v", tc.name, tc.allowed, got)
+		}
+	}
+	if !checkAccess(nil, "203.0.113.9", "", "tcp", 0) {
+		t.Error("没有 ACL 时应允许")
+	}
+}
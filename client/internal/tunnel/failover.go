@@ -0,0 +1,266 @@
+package tunnel
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gkipass/client/internal/protocol"
+)
+
+// 容灾触发原因
+const (
+	failoverReasonTimeout      = "timeout"        // 唯一的主出口持续不可达超过超时
+	failoverReasonAllNodesDown = "all_nodes_down" // 主出口组所有节点持续不可达超过超时
+	failoverReasonRecovered    = "recovered"      // 主出口恢复后自动回切
+)
+
+// DefaultFailoverTimeout 面板未指定超时时的容灾触发时间
+const DefaultFailoverTimeout = 30 * time.Second
+
+// FailoverReporter 容灾事件上报函数（通常为向面板发送 failover_event）
+type FailoverReporter func(event *protocol.FailoverEventReport) error
+
+// failoverMonitor 单条规则的出口容灾状态机
+// 主出口持续不可达超过超时后切到容灾目标；开启自动回切时，主出口连续探测成功后切回
+type failoverMonitor struct {
+	primary     []ruleTarget
+	backup      []ruleTarget
+	timeout     time.Duration
+	autoRecover bool
+	fromGroupID string // 主出口组
+	toGroupID   string // 容灾出口组
+
+	mutex         sync.Mutex
+	active        bool      // 是否已切换到容灾出口
+	downSince     time.Time // 主出口开始不可达的时间，零值表示可达
+	recoverStreak int       // 切换后主出口连续探测成功次数
+	switchedAt    time.Time
+	failovers     int64
+	recoveries    int64
+}
+
+// newFailoverMonitor 按规则的容灾策略创建状态机，未配置容灾或主出口不是出口组时返回 nil
+func newFailoverMonitor(rule *protocol.TunnelRule, primary []ruleTarget) *failoverMonitor {
+	if len(rule.FailoverTargets) == 0 || len(primary) == 0 {
+		return nil
+	}
+	// 出口直连最终目标，容灾组是出口的替代而不是目标的替代
+	if rule.Role == "egress" {
+		return nil
+	}
+	// 多跳入口的下一跳是中继时，容灾由出口组的上一跳负责
+	if rule.NextHop != nil && len(rule.NextHop.Nodes) > 0 && rule.NextHop.Role != "egress" {
+		return nil
+	}
+
+	fm := &failoverMonitor{
+		primary:     primary,
+		timeout:     DefaultFailoverTimeout,
+		autoRecover: rule.FailoverAutoRecover,
+		fromGroupID: rule.EgressGroupID,
+		toGroupID:   rule.FailoverGroupID,
+	}
+	if rule.FailoverTimeout > 0 {
+		fm.timeout = time.Duration(rule.FailoverTimeout) * time.Second
+	}
+	for _, target := range rule.FailoverTargets {
+		if target.Enabled && target.Host != "" && target.Port > 0 {
+			fm.backup = append(fm.backup, ruleTarget{host: target.Host, port: target.Port})
+		}
+	}
+	if len(fm.backup) == 0 {
+		return nil
+	}
+	return fm
+}
+
+// targets 返回当前应拨号的目标，第二个返回值表示是否处于容灾状态
+func (fm *failoverMonitor) targets() ([]ruleTarget, bool) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.active {
+		return fm.backup, true
+	}
+	return fm.primary, false
+}
+
+// observe 记录一次主出口可达性观测，发生切换时返回待上报事件
+func (fm *failoverMonitor) observe(healthy bool, recoverChecks int, now time.Time) *protocol.FailoverEventReport {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if healthy {
+		if !fm.active {
+			fm.downSince = time.Time{}
+			return nil
+		}
+		if !fm.autoRecover {
+			return nil
+		}
+		fm.recoverStreak++
+		if fm.recoverStreak < recoverChecks {
+			return nil
+		}
+
+		duration := now.Sub(fm.downSince)
+		fm.active = false
+		fm.downSince = time.Time{}
+		fm.recoverStreak = 0
+		fm.switchedAt = now
+		fm.recoveries++
+		return fm.newEvent(protocol.FailoverEventRecovery, fm.toGroupID, fm.fromGroupID, failoverReasonRecovered, duration, now)
+	}
+
+	fm.recoverStreak = 0
+	if fm.downSince.IsZero() {
+		fm.downSince = now
+	}
+	if fm.active || now.Sub(fm.downSince) < fm.timeout {
+		return nil
+	}
+
+	reason := failoverReasonTimeout
+	if len(fm.primary) > 1 {
+		reason = failoverReasonAllNodesDown
+	}
+	fm.active = true
+	fm.switchedAt = now
+	fm.failovers++
+	return fm.newEvent(protocol.FailoverEventFailover, fm.fromGroupID, fm.toGroupID, reason, now.Sub(fm.downSince), now)
+}
+
+func (fm *failoverMonitor) newEvent(eventType, from, to, reason string, duration time.Duration, now time.Time) *protocol.FailoverEventReport {
+	return &protocol.FailoverEventReport{
+		EventType:       eventType,
+		FromGroupID:     from,
+		ToGroupID:       to,
+		Reason:          reason,
+		FailureDuration: int(duration / time.Second),
+		Timestamp:       now.UnixMilli(),
+	}
+}
+
+// getStats 获取容灾状态
+func (fm *failoverMonitor) getStats() map[string]interface{} {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	stats := map[string]interface{}{
+		"active":          fm.active,
+		"timeout_secs":    int(fm.timeout / time.Second),
+		"auto_recover":    fm.autoRecover,
+		"primary_targets": len(fm.primary),
+		"backup_targets":  len(fm.backup),
+		"failovers":       fm.failovers,
+		"recoveries":      fm.recoveries,
+	}
+	if !fm.downSince.IsZero() {
+		stats["primary_down_secs"] = int64(time.Since(fm.downSince) / time.Second)
+	}
+	if !fm.switchedAt.IsZero() {
+		stats["switched_at"] = fm.switchedAt.Format(time.RFC3339)
+	}
+	return stats
+}
+
+// probeLoop 周期探测主出口，驱动容灾切换与回切
+func (r *ruleRunner) probeLoop() {
+	ticker := time.NewTicker(r.manager.config.FailoverCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			r.observePrimary(r.probePrimary())
+		}
+	}
+}
+
+// probePrimary 任一主出口目标可连接即视为主出口可达
+func (r *ruleRunner) probePrimary() bool {
+	for _, target := range r.failover.primary {
+		ctx, cancel := context.WithTimeout(r.ctx, r.manager.config.DialTimeout)
+		conn, err := r.dial(ctx, target)
+		cancel()
+		if err == nil {
+			conn.Close()
+			return true
+		}
+	}
+	return false
+}
+
+// observePrimary 更新容灾状态，发生切换时记录并上报事件
+func (r *ruleRunner) observePrimary(healthy bool) {
+	if r.failover == nil || r.ctx.Err() != nil {
+		return
+	}
+
+	event := r.failover.observe(healthy, r.manager.config.FailoverRecoverChecks, time.Now())
+	if event == nil {
+		return
+	}
+	event.TunnelID = r.rule.TunnelID
+
+	if event.EventType == protocol.FailoverEventFailover {
+		r.logger.Warn("主出口不可达，切换到容灾出口",
+			zap.String("from_group", event.FromGroupID),
+			zap.String("to_group", event.ToGroupID),
+			zap.String("reason", event.Reason),
+			zap.Int("failure_duration", event.FailureDuration))
+	} else {
+		r.logger.Info("主出口已恢复，回切到主出口",
+			zap.String("from_group", event.FromGroupID),
+			zap.String("to_group", event.ToGroupID),
+			zap.Int("failure_duration", event.FailureDuration))
+	}
+
+	r.manager.reportFailoverEvent(event)
+}
+
+// reportFailoverEvent 上报容灾事件，失败时排队等待下次重试
+func (m *Manager) reportFailoverEvent(event *protocol.FailoverEventReport) {
+	m.failoverMu.Lock()
+	m.pendingEvents = append(m.pendingEvents, event)
+	if over := len(m.pendingEvents) - maxPendingFailoverEvents; over > 0 {
+		m.pendingEvents = m.pendingEvents[over:]
+	}
+	m.failoverMu.Unlock()
+
+	m.flushFailoverEvents()
+}
+
+// flushFailoverEvents 按发生顺序发送排队的容灾事件，遇到失败即停止
+func (m *Manager) flushFailoverEvents() {
+	m.failoverMu.Lock()
+	defer m.failoverMu.Unlock()
+
+	if m.failoverReporter == nil {
+		return
+	}
+	for len(m.pendingEvents) > 0 {
+		if err := m.failoverReporter(m.pendingEvents[0]); err != nil {
+			m.logger.Debug("上报容灾事件失败，稍后重试",
+				zap.String("tunnel_id", m.pendingEvents[0].TunnelID),
+				zap.Int("pending", len(m.pendingEvents)),
+				zap.Error(err))
+			return
+		}
+		m.pendingEvents = m.pendingEvents[1:]
+	}
+}
+
+// SetFailoverReporter 设置容灾事件上报函数
+func (m *Manager) SetFailoverReporter(reporter FailoverReporter) {
+	m.failoverMu.Lock()
+	m.failoverReporter = reporter
+	m.failoverMu.Unlock()
+
+	m.flushFailoverEvents()
+}
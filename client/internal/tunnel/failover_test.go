@@ -0,0 +1,123 @@
+package tunnel
+
+import (
+	"testing"
+	"time"
+
+	"gkipass/client/internal/protocol"
+)
+
+// TestFailoverMonitor_Observe 主出口持续不可达超过超时才切换，恢复需连续探测成功，未开启自动回切时保持容灾
+func TestFailoverMonitor_Observe(t *testing.T) {
+	rule := &protocol.TunnelRule{
+		Role:            "ingress",
+		EgressGroupID:   "group-egress",
+		FailoverGroupID: "group-backup",
+		FailoverTargets: []protocol.TunnelTarget{{Host: "10.0.0.9", Port: 9000, Enabled: true}},
+		FailoverTimeout: 10,
+	}
+	primary := []ruleTarget{{host: "10.0.0.1", port: 9000}, {host: "10.0.0.2", port: 9000}}
+	start := time.Unix(1700000000, 0)
+
+	fm := newFailoverMonitor(rule, primary)
+	if fm == nil {
+		t.Fatal("配置了容灾目标的入口应创建容灾状态机")
+	}
+	if event := fm.observe(false, 2, start); event != nil {
+		t.Fatalf("首次不可达不应切换，实际 %+v", event)
+	}
+	if event := fm.observe(false, 2, start.Add(9*time.Second)); event != nil {
+		t.Fatalf("未超过超时不应切换，实际 %+v", event)
+	}
+	event := fm.observe(false, 2, start.Add(10*time.Second))
+	if event == nil || event.EventType != protocol.FailoverEventFailover || event.Reason != failoverReasonAllNodesDown ||
+		event.FromGroupID != "group-egress" || event.ToGroupID != "group-backup" || event.FailureDuration != 10 {
+		t.Fatalf("超时后应切到容灾组（多节点原因为 all_nodes_down），实际 %+v", event)
+	}
+	if targets, active := fm.targets(); !active || len(targets) != 1 || targets[0].host != "10.0.0.9" {
+		t.Fatalf("切换后应拨号容灾目标，实际 %v %v", targets, active)
+	}
+
+	if event := fm.observe(true, 2, start.Add(20*time.Second)); event != nil {
+		t.Fatalf("未开启自动回切时主出口恢复也应保持容灾，实际 %+v", event)
+	}
+
+	rule.FailoverAutoRecover = true
+	fm = newFailoverMonitor(rule, primary)
+	fm.observe(false, 2, start)
+	fm.observe(false, 2, start.Add(10*time.Second))
+	if event := fm.observe(true, 2, start.Add(15*time.Second)); event != nil {
+		t.Fatalf("连续成功次数不足时不应回切，实际 %+v", event)
+	}
+	fm.observe(false, 2, start.Add(16*time.Second))
+	fm.observe(true, 2, start.Add(17*time.Second))
+	event = fm.observe(true, 2, start.Add(18*time.Second))
+	if event == nil || event.EventType != protocol.FailoverEventRecovery || event.FromGroupID != "group-backup" {
+		t.Fatalf("连续探测成功后应回切主出口，实际 %+v", event)
+	}
+	if _, active := fm.targets(); active {
+		t.Error("回切后应拨号主出口")
+	}
+
+	rule.Role = "egress"
+	if newFailoverMonitor(rule, primary) != nil {
+		t.Error("出口直连最终目标，不应创建容灾状态机")
+	}
+}
+
+// TestRuleRunner_FailoverToBackupEgress 主出口不可达超过超时后切到容灾出口，主出口恢复后自动回切
+func TestRuleRunner_FailoverToBackupEgress(t *testing.T) {
+	target := startEchoServer(t)
+	listenPorts := []int{freePort(t), freePort(t)}
+	backupPort := freePort(t)
+	hops := hopChain(listenPorts, []string{"tcp", "tcp"})
+	rules := chainRules(hops, listenPorts, target)
+
+	ingressRule, egressRule := rules[0], rules[1]
+	ingressRule.EgressGroupID = "group-egress"
+	ingressRule.FailoverGroupID = "group-backup"
+	ingressRule.FailoverTargets = []protocol.TunnelTarget{{Host: "127.0.0.1", Port: backupPort, Weight: 1, Enabled: true}}
+	ingressRule.FailoverTimeout = 1
+	ingressRule.FailoverAutoRecover = true
+
+	backupRule := egressRule
+	backupRule.ListenPort = backupPort
+	applyRule(t, newTestManager(t), backupRule)
+
+	ingress := newTestManager(t)
+	events := make(chan *protocol.FailoverEventReport, 4)
+	ingress.SetFailoverReporter(func(event *protocol.FailoverEventReport) error {
+		events <- event
+		return nil
+	})
+	applyRule(t, ingress, ingressRule)
+	runner := runnerOf(ingress, "tunnel-chain")
+	if runner == nil || runner.failover == nil {
+		t.Fatal("入口应启用出口容灾")
+	}
+
+	waitEvent := func(eventType string) {
+		t.Helper()
+		select {
+		case event := <-events:
+			if event.EventType != eventType || event.TunnelID != "tunnel-chain" {
+				t.Fatalf("应上报 %s 事件，实际 %+v", eventType, event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("未上报 %s 事件", eventType)
+		}
+	}
+
+	waitEvent(protocol.FailoverEventFailover)
+	if _, active := runner.failover.targets(); !active {
+		t.Fatal("主出口不可达超时后应处于容灾状态")
+	}
+	assertEcho(t, listenPorts[0], "via backup egress")
+
+	applyRule(t, newTestManager(t), egressRule)
+	waitEvent(protocol.FailoverEventRecovery)
+	if _, active := runner.failover.targets(); active {
+		t.Fatal("主出口恢复后应回切")
+	}
+	assertEcho(t, listenPorts[0], "via primary egress")
+}
@@ -0,0 +1,513 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+
+	"gkipass/client/internal/certificate"
+	"gkipass/client/internal/handlers"
+	"gkipass/client/internal/ports"
+	"gkipass/client/internal/protocol"
+	"gkipass/client/internal/relay"
+	"gkipass/client/internal/tracing"
+	"gkipass/client/internal/transport"
+	"gkipass/client/internal/udp"
+)
+
+// ManagerConfig 隧道运行时配置
+type ManagerConfig struct {
+	ReportInterval time.Duration `json:"report_interval"` // 流量上报间隔
+	PeekTimeout    time.Duration `json:"peek_timeout"`    // 代理入口等待首包的超时
+	DialTimeout    time.Duration `json:"dial_timeout"`    // 连接目标/下一跳超时
+
+	FailoverCheckInterval time.Duration `json:"failover_check_interval"` // 主出口探测间隔
+	FailoverRecoverChecks int           `json:"failover_recover_checks"` // 回切前主出口需连续探测成功的次数
+
+	NodeID string `json:"node_id"` // 本节点ID，反向隧道回连握手时携带
+}
+
+// DefaultManagerConfig 默认隧道运行时配置
+func DefaultManagerConfig() *ManagerConfig {
+	return &ManagerConfig{
+		ReportInterval: 30 * time.Second,
+		PeekTimeout:    5 * time.Second,
+		DialTimeout:    10 * time.Second,
+
+		FailoverCheckInterval: 5 * time.Second,
+		FailoverRecoverChecks: 3,
+	}
+}
+
+// maxPendingFailoverEvents 面板断开期间最多缓存的容灾事件数
+const maxPendingFailoverEvents = 100
+
+// TrafficReporter 流量上报函数（通常为向面板发送 traffic_report）
+type TrafficReporter func(report *protocol.TrafficReportRequest) error
+
+// PeerTrust 链路相邻节点的证书信任登记（通常为 certificate.Manager），按规则登记与移除
+type PeerTrust interface {
+	SetPeers(owner string, peers []certificate.Peer)
+	RemovePeers(owner string)
+}
+
+// Manager 隧道运行时管理器：把面板下发的规则落地为端口监听、协议处理器和转发器
+type Manager struct {
+	config           *ManagerConfig
+	portManager      *ports.Manager
+	udpManager       *udp.Manager
+	transportManager *transport.Manager
+	credentials      *handlers.CredentialStore
+	reverseHub       *relay.ReverseHub // 接受反向隧道出口回连（本节点为出口的上一跳时）
+
+	reporter   TrafficReporter
+	reporterMu sync.RWMutex
+
+	peerTrust PeerTrust
+
+	failoverReporter FailoverReporter
+	pendingEvents    []*protocol.FailoverEventReport // 待上报的容灾事件
+	failoverMu       sync.Mutex
+
+	rules   map[string]*ruleRunner // tunnelID -> 运行实例
+	version int64                  // 已应用的面板规则版本（进程内有效，重启后为 0 以触发全量同步）
+	mutex   sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	logger *zap.Logger
+}
+
+// NewManager 创建隧道运行时管理器
+func NewManager(config *ManagerConfig, portManager *ports.Manager, udpManager *udp.Manager,
+	transportManager *transport.Manager, credentials *handlers.CredentialStore) *Manager {
+	if config == nil {
+		config = DefaultManagerConfig()
+	}
+	def := DefaultManagerConfig()
+	if config.ReportInterval <= 0 {
+		config.ReportInterval = def.ReportInterval
+	}
+	if config.PeekTimeout <= 0 {
+		config.PeekTimeout = def.PeekTimeout
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = def.DialTimeout
+	}
+	if config.FailoverCheckInterval <= 0 {
+		config.FailoverCheckInterval = def.FailoverCheckInterval
+	}
+	if config.FailoverRecoverChecks <= 0 {
+		config.FailoverRecoverChecks = def.FailoverRecoverChecks
+	}
+	if credentials == nil {
+		credentials = handlers.NewCredentialStore()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Manager{
+		config:           config,
+		portManager:      portManager,
+		udpManager:       udpManager,
+		transportManager: transportManager,
+		credentials:      credentials,
+		reverseHub:       relay.NewReverseHub(nil),
+		rules:            make(map[string]*ruleRunner),
+		ctx:              ctx,
+		cancel:           cancel,
+		logger:           zap.L().Named("tunnel"),
+	}
+}
+
+// SetTrafficReporter 设置流量上报函数
+func (m *Manager) SetTrafficReporter(reporter TrafficReporter) {
+	m.reporterMu.Lock()
+	defer m.reporterMu.Unlock()
+	m.reporter = reporter
+}
+
+// SetPeerTrust 设置相邻节点证书信任登记，需在 Start 之前调用
+func (m *Manager) SetPeerTrust(trust PeerTrust) {
+	m.peerTrust = trust
+}
+
+// Start 启动隧道运行时管理器
+func (m *Manager) Start() error {
+	m.logger.Info("启动隧道运行时管理器",
+		zap.Duration("report_interval", m.config.ReportInterval))
+
+	m.wg.Add(1)
+	go m.reportLoop()
+
+	return nil
+}
+
+// Stop 停止隧道运行时管理器，关闭所有规则
+func (m *Manager) Stop() error {
+	m.logger.Info("停止隧道运行时管理器")
+
+	m.cancel()
+	m.wg.Wait()
+
+	m.mutex.Lock()
+	runners := make([]*ruleRunner, 0, len(m.rules))
+	for tunnelID, runner := range m.rules {
+		runners = append(runners, runner)
+		delete(m.rules, tunnelID)
+	}
+	m.mutex.Unlock()
+
+	for _, runner := range runners {
+		m.stopRunner(runner)
+	}
+	m.reverseHub.Stop()
+
+	return nil
+}
+
+// Version 获取已应用的面板规则版本
+func (m *Manager) Version() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.version
+}
+
+// NeedsResync 增量同步的起点超过本地版本（中间有变更未收到）时返回 true
+func (m *Manager) NeedsResync(req *protocol.SyncRulesRequest) bool {
+	if !req.Incremental {
+		return false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return req.BaseVersion > m.version
+}
+
+// ApplyRules 应用面板同步的规则
+// 版本未变化的规则保持运行；禁用的规则被移除；Force 时移除本次未下发的规则；增量同步时移除 Deleted 中的规则
+// ctx 携带面板下发消息中的追踪上下文，每条规则的应用和端口监听作为子 span 记录
+func (m *Manager) ApplyRules(ctx context.Context, req *protocol.SyncRulesRequest) *protocol.SyncRulesResponse {
+	resp := &protocol.SyncRulesResponse{Success: true}
+
+	ctx, span := tracing.Start(ctx, "tunnel.ApplyRules",
+		attribute.String("gkipass.sync.version", req.Version),
+		attribute.Bool("gkipass.sync.force", req.Force),
+		attribute.Bool("gkipass.sync.incremental", req.Incremental),
+		attribute.Int("gkipass.sync.rules", len(req.Rules)),
+		attribute.Int("gkipass.sync.deleted", len(req.Deleted)))
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("gkipass.sync.applied", resp.AppliedCount),
+			attribute.StringSlice("gkipass.sync.failed_rules", resp.FailedRules))
+		if !resp.Success {
+			span.SetStatus(codes.Error, resp.Message)
+		}
+		span.End()
+	}()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, tunnelID := range req.Deleted {
+		if runner, exists := m.rules[tunnelID]; exists {
+			delete(m.rules, tunnelID)
+			m.stopRunner(runner)
+		}
+		resp.AppliedCount++
+	}
+
+	if req.Force {
+		wanted := make(map[string]bool, len(req.Rules))
+		for _, rule := range req.Rules {
+			wanted[rule.TunnelID] = true
+		}
+		for tunnelID, runner := range m.rules {
+			if !wanted[tunnelID] {
+				delete(m.rules, tunnelID)
+				m.stopRunner(runner)
+			}
+		}
+	}
+
+	for i := range req.Rules {
+		rule := req.Rules[i]
+		if rule.TunnelID == "" {
+			continue
+		}
+
+		existing, exists := m.rules[rule.TunnelID]
+		if !rule.Enabled {
+			if exists {
+				delete(m.rules, rule.TunnelID)
+				m.stopRunner(existing)
+			}
+			resp.AppliedCount++
+			continue
+		}
+
+		if exists && rule.Version != 0 && existing.rule.Version == rule.Version {
+			resp.AppliedCount++
+			continue
+		}
+
+		// 先释放旧实例的端口再按新规则重建
+		if exists {
+			delete(m.rules, rule.TunnelID)
+			m.stopRunner(existing)
+		}
+
+		runner, err := m.startRunner(ctx, &rule)
+		if err != nil {
+			m.logger.Error("应用隧道规则失败",
+				zap.String("tunnel_id", rule.TunnelID),
+				zap.Error(err))
+			resp.FailedRules = append(resp.FailedRules, rule.TunnelID)
+			continue
+		}
+		if runner != nil {
+			m.rules[rule.TunnelID] = runner
+		}
+		resp.AppliedCount++
+	}
+
+	if len(resp.FailedRules) > 0 {
+		resp.Success = false
+		resp.Message = fmt.Sprintf("%d 条规则应用失败", len(resp.FailedRules))
+	}
+
+	// 全量同步以面板版本为准；增量同步版本只增不减
+	if version, err := strconv.ParseInt(req.Version, 10, 64); err == nil {
+		if req.Force || version > m.version {
+			m.version = version
+		}
+	}
+	resp.Version = m.version
+
+	m.logger.Info("隧道规则同步完成",
+		zap.Int("rules", len(req.Rules)),
+		zap.Int("deleted", len(req.Deleted)),
+		zap.Int("applied", resp.AppliedCount),
+		zap.Int("failed", len(resp.FailedRules)),
+		zap.Bool("force", req.Force),
+		zap.Bool("incremental", req.Incremental),
+		zap.Int64("version", m.version))
+
+	return resp
+}
+
+// DeleteRule 删除隧道规则并释放端口
+func (m *Manager) DeleteRule(tunnelID string) error {
+	m.mutex.Lock()
+	runner, exists := m.rules[tunnelID]
+	delete(m.rules, tunnelID)
+	m.mutex.Unlock()
+
+	if !exists {
+		return fmt.Errorf("隧道规则不存在: %s", tunnelID)
+	}
+
+	m.stopRunner(runner)
+	m.logger.Info("删除隧道规则", zap.String("tunnel_id", tunnelID))
+	return nil
+}
+
+// RestartRule 按当前规则重建隧道监听（面板远程命令触发），重建失败时该规则被移除，等待下次同步
+func (m *Manager) RestartRule(ctx context.Context, tunnelID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.rules[tunnelID]
+	if !exists {
+		return fmt.Errorf("隧道规则不存在: %s", tunnelID)
+	}
+	rule := *existing.rule
+
+	delete(m.rules, tunnelID)
+	m.stopRunner(existing)
+
+	runner, err := m.startRunner(ctx, &rule)
+	if err != nil {
+		return fmt.Errorf("重启隧道监听失败: %w", err)
+	}
+	if runner != nil {
+		m.rules[tunnelID] = runner
+	}
+	m.logger.Info("隧道监听已重启", zap.String("tunnel_id", tunnelID))
+	return nil
+}
+
+// startRunner 按规则创建并启动运行实例，未知的跳角色返回 nil
+func (m *Manager) startRunner(ctx context.Context, rule *protocol.TunnelRule) (runner *ruleRunner, err error) {
+	ctx, span := tracing.Start(ctx, "tunnel.AddRule",
+		attribute.String("gkipass.tunnel.id", rule.TunnelID),
+		attribute.String("gkipass.tunnel.name", rule.TunnelName),
+		attribute.String("gkipass.tunnel.role", rule.Role),
+		attribute.String("gkipass.tunnel.ingress_protocol", rule.GetIngressProtocol()),
+		attribute.Int("gkipass.tunnel.listen_port", rule.GetListenPort()),
+		attribute.Int64("gkipass.tunnel.version", rule.Version))
+	defer func() { tracing.End(span, err) }()
+
+	switch rule.Role {
+	case "", "ingress", "relay", "egress":
+	default:
+		m.logger.Warn("未知的跳角色，跳过规则",
+			zap.String("tunnel_id", rule.TunnelID),
+			zap.String("role", rule.Role),
+			zap.Int("hop_index", rule.HopIndex))
+		span.SetAttributes(attribute.Bool("gkipass.tunnel.skipped", true))
+		return nil, nil
+	}
+
+	if rule.GetListenPort() <= 0 || rule.GetListenPort() > 65535 {
+		return nil, fmt.Errorf("无效的监听端口: %d", rule.GetListenPort())
+	}
+
+	runner, err = newRuleRunner(m, rule)
+	if err != nil {
+		return nil, err
+	}
+	if err := runner.start(ctx); err != nil {
+		runner.stop()
+		return nil, err
+	}
+
+	m.logger.Info("隧道规则已启动",
+		zap.String("tunnel_id", rule.TunnelID),
+		zap.String("name", rule.TunnelName),
+		zap.String("role", rule.Role),
+		zap.Int("hop_index", rule.HopIndex),
+		zap.String("ingress_protocol", rule.GetIngressProtocol()),
+		zap.Int("listen_port", rule.GetListenPort()),
+		zap.Int64("version", rule.Version))
+
+	return runner, nil
+}
+
+// stopRunner 停止运行实例并上报剩余流量
+func (m *Manager) stopRunner(runner *ruleRunner) {
+	runner.stop()
+	m.credentials.RemoveTunnel(runner.rule.TunnelID)
+	m.sendReport(runner)
+}
+
+// reportLoop 定时上报各规则流量增量
+func (m *Manager) reportLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.config.ReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.mutex.Lock()
+			runners := make([]*ruleRunner, 0, len(m.rules))
+			for _, runner := range m.rules {
+				runners = append(runners, runner)
+			}
+			m.mutex.Unlock()
+
+			for _, runner := range runners {
+				m.sendReport(runner)
+			}
+			m.flushFailoverEvents()
+		}
+	}
+}
+
+// sendReport 上报单条规则自上次上报以来的流量，无新流量时跳过
+func (m *Manager) sendReport(runner *ruleRunner) {
+	m.reporterMu.RLock()
+	reporter := m.reporter
+	m.reporterMu.RUnlock()
+
+	if reporter == nil {
+		return
+	}
+
+	report := runner.takeReport()
+	if report == nil {
+		return
+	}
+
+	if err := reporter(report); err != nil {
+		// 上报失败时把增量退回，下次合并上报
+		runner.restoreReport(report)
+		m.logger.Debug("上报隧道流量失败",
+			zap.String("tunnel_id", report.TunnelID),
+			zap.Error(err))
+	}
+}
+
+// TunnelStats 单条隧道的运行统计
+type TunnelStats struct {
+	TunnelID    string
+	TunnelName  string
+	Protocol    string
+	ListenPort  uint16
+	BytesIn     int64
+	BytesOut    int64
+	TotalConns  int64
+	ActiveConns int64
+	FailedConns int64
+}
+
+// TunnelStats 获取各隧道的运行统计快照
+func (m *Manager) TunnelStats() []TunnelStats {
+	m.mutex.Lock()
+	runners := make([]*ruleRunner, 0, len(m.rules))
+	for _, runner := range m.rules {
+		runners = append(runners, runner)
+	}
+	m.mutex.Unlock()
+
+	stats := make([]TunnelStats, 0, len(runners))
+	for _, r := range runners {
+		bytesIn, bytesOut, totalConns := r.counters()
+		stats = append(stats, TunnelStats{
+			TunnelID:    r.rule.TunnelID,
+			TunnelName:  r.rule.TunnelName,
+			Protocol:    r.rule.GetIngressProtocol(),
+			ListenPort:  r.port,
+			BytesIn:     bytesIn,
+			BytesOut:    bytesOut,
+			TotalConns:  totalConns,
+			ActiveConns: r.activeConns.Load(),
+			FailedConns: r.failedCount(),
+		})
+	}
+	return stats
+}
+
+// GetStats 获取隧道运行时统计
+func (m *Manager) GetStats() map[string]interface{} {
+	m.mutex.Lock()
+	rules := make(map[string]interface{}, len(m.rules))
+	for tunnelID, runner := range m.rules {
+		rules[tunnelID] = runner.getStats()
+	}
+	version := m.version
+	m.mutex.Unlock()
+
+	m.failoverMu.Lock()
+	pendingEvents := len(m.pendingEvents)
+	m.failoverMu.Unlock()
+
+	return map[string]interface{}{
+		"active_rules":            len(rules),
+		"rules_version":           version,
+		"pending_failover_events": pendingEvents,
+		"rules":                   rules,
+		"shared_ports":            m.portManager.GetSharedStats(),
+		"reverse_hub":             m.reverseHub.GetStats(),
+	}
+}
@@ -0,0 +1,891 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"gkipass/client/internal/certificate"
+	"gkipass/client/internal/detector"
+	"gkipass/client/internal/handlers"
+	"gkipass/client/internal/pool"
+	"gkipass/client/internal/ports"
+	"gkipass/client/internal/protocol"
+	"gkipass/client/internal/relay"
+	"gkipass/client/internal/rules"
+	"gkipass/client/internal/tracing"
+	"gkipass/client/internal/transport"
+)
+
+// ruleTarget 规则的一个转发目标
+type ruleTarget struct {
+	host    string
+	port    int
+	reverse bool // 出口回连本节点，经反向会话开流而不按地址拨号
+}
+
+func (t ruleTarget) address() string {
+	return net.JoinHostPort(t.host, strconv.Itoa(t.port))
+}
+
+// ruleRunner 单条隧道规则的运行实例
+// 入口连接经检测→处理器（SOCKS/HTTP 代理入口）或直接进入转发器，按规则统计流量；
+// 多跳链路的中继/出口以进入本跳的传输协议监听，不识别入口协议，原样转发到下一跳或目标
+type ruleRunner struct {
+	manager *Manager
+	rule    *protocol.TunnelRule
+	port    uint16
+	owner   string
+	logger  *zap.Logger
+
+	// 转发目标：有下一跳时为下一跳节点，否则为规则目标
+	targets       []ruleTarget
+	transportType transport.TransportType
+	nextTarget    atomic.Uint64
+	failover      *failoverMonitor // 出口容灾，未配置时为 nil
+
+	// 入口组件
+	sharedListener net.Listener          // 共享端口路由（Hostnames 非空时）
+	hopListener    net.Listener          // 中继/出口的非 TCP 跳传输监听
+	reverseAgents  []*relay.ReverseAgent // 反向隧道出口向各上一跳节点的回连
+	tcpRelay       *relay.TCPRelay
+	udpRelay       *relay.UDPRelay
+	connManager    *detector.ConnectionManager
+	socksHandler   *handlers.SOCKSHandler
+	httpHandler    *handlers.HTTPHandler
+
+	// 活跃连接，停止时统一关闭
+	conns   map[*countingConn]struct{}
+	connsMu sync.Mutex
+
+	// 流量统计（累计值与已上报值）
+	bytesIn     atomic.Int64
+	bytesOut    atomic.Int64
+	totalConns  atomic.Int64
+	activeConns atomic.Int64
+	failedConns atomic.Int64
+	deniedConns atomic.Int64
+	sources     relay.RelayStats // 代理入口按真实来源的统计（转发器路径由 tcpRelay 统计）
+	reported    struct {
+		bytesIn    int64
+		bytesOut   int64
+		totalConns int64
+		sources    map[string]relay.SourceStats
+	}
+	reportMu sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newRuleRunner 根据规则创建运行实例（不启动监听）
+func newRuleRunner(m *Manager, rule *protocol.TunnelRule) (*ruleRunner, error) {
+	ctx, cancel := context.WithCancel(m.ctx)
+
+	r := &ruleRunner{
+		manager:       m,
+		rule:          rule,
+		port:          uint16(rule.GetListenPort()),
+		owner:         "tunnel:" + rule.TunnelID,
+		transportType: transport.TransportTCP,
+		conns:         make(map[*countingConn]struct{}),
+		ctx:           ctx,
+		cancel:        cancel,
+		logger: m.logger.With(
+			zap.String("tunnel_id", rule.TunnelID),
+			zap.Int("listen_port", rule.GetListenPort())),
+	}
+
+	if err := r.resolveTargets(); err != nil {
+		cancel()
+		return nil, err
+	}
+	if rule.IsHop() || (!r.isProxyIngress() && !strings.EqualFold(rule.GetIngressProtocol(), "udp")) {
+		r.failover = newFailoverMonitor(rule, r.targets)
+	}
+	return r, nil
+}
+
+// resolveTargets 确定转发目标：多跳入口连接下一跳节点，单跳直连规则目标
+func (r *ruleRunner) resolveTargets() error {
+	if hop := r.rule.NextHop; hop != nil && len(hop.Nodes) > 0 {
+		for _, node := range hop.Nodes {
+			if node.Host != "" && node.Port > 0 {
+				r.targets = append(r.targets, ruleTarget{host: node.Host, port: node.Port, reverse: r.rule.IsReverseHub()})
+			}
+		}
+		if hop.Protocol != "" {
+			r.transportType = transport.TransportType(hop.Protocol)
+		}
+	}
+
+	if len(r.targets) == 0 {
+		for _, target := range r.rule.Targets {
+			if target.Enabled && target.Host != "" && target.Port > 0 {
+				r.targets = append(r.targets, ruleTarget{host: target.Host, port: target.Port})
+			}
+		}
+	}
+
+	if len(r.targets) == 0 && r.rule.TargetAddress != "" && r.rule.TargetPort > 0 {
+		r.targets = append(r.targets, ruleTarget{host: r.rule.TargetAddress, port: r.rule.TargetPort})
+	}
+
+	// 代理入口的目标由客户端请求决定
+	if len(r.targets) == 0 && !r.isProxyIngress() {
+		return fmt.Errorf("隧道 %s 没有可用的转发目标", r.rule.TunnelID)
+	}
+	return nil
+}
+
+// isProxyIngress 入口是否为 SOCKS/HTTP 正向代理（只在链路入口识别）
+func (r *ruleRunner) isProxyIngress() bool {
+	if r.rule.IsHop() {
+		return false
+	}
+	switch strings.ToLower(r.rule.GetIngressProtocol()) {
+	case "socks5", "socks", "http":
+		return true
+	}
+	return false
+}
+
+// start 启动入口监听
+func (r *ruleRunner) start(ctx context.Context) (err error) {
+	ingress := strings.ToLower(r.rule.GetIngressProtocol())
+	_, span := tracing.Start(ctx, "tunnel.StartListener",
+		attribute.String("gkipass.tunnel.id", r.rule.TunnelID),
+		attribute.String("gkipass.tunnel.role", r.rule.Role),
+		attribute.String("gkipass.tunnel.ingress_protocol", ingress),
+		attribute.Int("gkipass.tunnel.listen_port", int(r.port)),
+		attribute.Bool("gkipass.tunnel.shared_port", len(r.rule.Hostnames) > 0))
+	defer func() { tracing.End(span, err) }()
+
+	if trust := r.manager.peerTrust; trust != nil {
+		trust.SetPeers(r.owner, r.peerNodes())
+	}
+
+	if r.rule.IsReverseHub() {
+		if err := r.registerReverse(ingress); err != nil {
+			return err
+		}
+	}
+
+	if ingress == "udp" && !r.rule.IsHop() {
+		return r.startUDP()
+	}
+
+	if r.isProxyIngress() {
+		r.setupProxyHandlers(ingress)
+	} else if err := r.setupRelay(); err != nil {
+		return err
+	}
+
+	if r.failover != nil {
+		go r.probeLoop()
+	}
+
+	if r.rule.IsReverseAgent() {
+		return r.startReverseAgents()
+	}
+	if r.rule.IsHop() {
+		return r.startHopListener()
+	}
+
+	if len(r.rule.Hostnames) > 0 {
+		listener, err := r.manager.portManager.ListenShared(r.port, r.rule.TunnelID, r.rule.Hostnames)
+		if err != nil {
+			return fmt.Errorf("注册共享端口路由失败: %w", err)
+		}
+		r.sharedListener = listener
+		go r.acceptFrom(listener)
+		return nil
+	}
+
+	if err := r.manager.portManager.StartListener(r.port, ports.PortTypeTCP, r.owner, r.dispatchPort); err != nil {
+		return fmt.Errorf("启动端口监听失败: %w", err)
+	}
+	return nil
+}
+
+// registerReverse 在反向接入端登记本隧道，出口以 TCP 回连本节点的监听端口
+// 端口需由本实例以 TCP 独占（按首包分流），或跳传输基于 UDP（同端口另开 TCP 监听）
+func (r *ruleRunner) registerReverse(ingress string) error {
+	if len(r.rule.Hostnames) > 0 {
+		return fmt.Errorf("共享端口路由的隧道不支持反向接入")
+	}
+	if r.rule.IsHop() {
+		switch r.hopTransport() {
+		case transport.TransportTCP, transport.TransportKCP, transport.TransportQUIC:
+		default:
+			return fmt.Errorf("上一跳以 %s 接入时无法在同一端口接受反向回连", r.hopTransport())
+		}
+	} else if ingress == "udp" {
+		return fmt.Errorf("UDP 入口不支持反向接入")
+	}
+
+	r.manager.reverseHub.RegisterTunnel(r.rule.TunnelID, r.rule.ReverseSecret)
+	return nil
+}
+
+// startReverseAgents 反向隧道出口不监听端口，向每个上一跳节点维持反向会话，上一跳打开的流作为本跳连接进入转发器
+func (r *ruleRunner) startReverseAgents() error {
+	if r.manager.transportManager == nil {
+		return fmt.Errorf("未启用传输层，无法回连上一跳")
+	}
+
+	for _, peer := range r.rule.ReversePeers {
+		if peer.Host == "" || peer.Port <= 0 {
+			continue
+		}
+		address := net.JoinHostPort(peer.Host, strconv.Itoa(peer.Port))
+
+		// 上一跳按首包分流，不预建空闲连接，避免其被当作普通连接转发
+		connPool := pool.NewAdaptivePool(address, transport.TransportTCP, r.manager.transportManager)
+		connPool.SetMinConnections(0)
+		connPool.SetPreWarming(false)
+
+		config := relay.DefaultReverseAgentConfig()
+		config.TunnelID = r.rule.TunnelID
+		config.NodeID = r.manager.config.NodeID
+		config.Secret = r.rule.ReverseSecret
+		agent := relay.NewReverseAgent(config, connPool, address)
+		if err := agent.Start(); err != nil {
+			return fmt.Errorf("启动反向回连失败 [%s]: %w", address, err)
+		}
+		r.reverseAgents = append(r.reverseAgents, agent)
+		go r.acceptFrom(agent)
+	}
+
+	if len(r.reverseAgents) == 0 {
+		return fmt.Errorf("隧道 %s 没有可回连的上一跳节点", r.rule.TunnelID)
+	}
+	return nil
+}
+
+// peerNodes 链路上与本节点直连的节点（下一跳、容灾出口、上一跳），用于登记节点证书信任
+func (r *ruleRunner) peerNodes() []certificate.Peer {
+	var nodes []protocol.TunnelTarget
+	if r.rule.NextHop != nil {
+		nodes = append(nodes, r.rule.NextHop.Nodes...)
+	}
+	nodes = append(nodes, r.rule.FailoverTargets...)
+	nodes = append(nodes, r.previousHop()...)
+
+	peers := make([]certificate.Peer, 0, len(nodes))
+	for _, node := range nodes {
+		if node.CertPin != "" {
+			peers = append(peers, certificate.Peer{Host: node.Host, NodeID: node.NodeID, CertPin: node.CertPin})
+		}
+	}
+	return peers
+}
+
+// previousHop 中继/出口的上一跳节点（入口及非链路规则为空）
+func (r *ruleRunner) previousHop() []protocol.TunnelTarget {
+	if !r.rule.IsHop() {
+		return nil
+	}
+	for _, hop := range r.rule.Hops {
+		if hop.Index == r.rule.HopIndex-1 {
+			return hop.Nodes
+		}
+	}
+	return nil
+}
+
+// trustedProxySource 来源是否为上一跳节点，中继/出口只采用上一跳发来的 PROXY 头
+func (r *ruleRunner) trustedProxySource() func(remote net.Addr) bool {
+	hosts := make(map[string]bool)
+	for _, node := range r.previousHop() {
+		if ip := net.ParseIP(node.Host); ip != nil {
+			hosts[ip.String()] = true
+		} else {
+			hosts[node.Host] = true
+		}
+	}
+	return func(remote net.Addr) bool {
+		host, _, err := net.SplitHostPort(remote.String())
+		if err != nil {
+			return false
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			host = ip.String()
+		}
+		return hosts[host]
+	}
+}
+
+// hopTransport 上一跳连接本节点使用的传输协议，未指定时为 TCP
+func (r *ruleRunner) hopTransport() transport.TransportType {
+	if protocol := r.rule.HopProtocol(); protocol != "" {
+		return transport.TransportType(strings.ToLower(protocol))
+	}
+	return transport.TransportTCP
+}
+
+// startHopListener 中继/出口按进入本跳的传输协议监听（kcp/quic/tls-mux 等），连接直接进入转发器
+func (r *ruleRunner) startHopListener() error {
+	hopTransport := r.hopTransport()
+	if hopTransport == transport.TransportTCP {
+		if err := r.manager.portManager.StartListener(r.port, ports.PortTypeTCP, r.owner, r.dispatchPort); err != nil {
+			return fmt.Errorf("启动端口监听失败: %w", err)
+		}
+		return nil
+	}
+
+	if r.manager.transportManager == nil {
+		return fmt.Errorf("未启用传输层，无法以 %s 接收上一跳流量", hopTransport)
+	}
+	listener, err := r.manager.transportManager.ListenContext(r.ctx, hopTransport, fmt.Sprintf(":%d", r.port))
+	if err != nil {
+		return fmt.Errorf("启动跳传输监听失败: %w", err)
+	}
+	r.hopListener = listener
+	go r.acceptFrom(listener)
+
+	// UDP 类跳传输不占用 TCP 端口，反向接入端在同端口另开 TCP 监听接受出口回连
+	if r.rule.IsReverseHub() {
+		if err := r.manager.portManager.StartListener(r.port, ports.PortTypeTCP, r.owner, r.serveReverse); err != nil {
+			return fmt.Errorf("启动反向接入监听失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// startUDP 启动 UDP 转发（UDP 转发器自行持有端口）
+func (r *ruleRunner) startUDP() error {
+	target := r.targets[0]
+
+	config := r.relayConfig()
+	config.ListenPort = int(r.port)
+	config.TargetAddr = target.host
+	config.TargetPort = target.port
+
+	r.udpRelay = relay.NewUDPRelay(config)
+	if err := r.udpRelay.Start(); err != nil {
+		r.udpRelay = nil
+		return err
+	}
+	return nil
+}
+
+// relayConfig 由规则生成转发器配置
+func (r *ruleRunner) relayConfig() *relay.TCPRelayConfig {
+	config := relay.DefaultTCPRelayConfig()
+	config.Name = r.rule.TunnelName
+	config.Protocol = r.rule.GetIngressProtocol()
+	config.ListenPort = int(r.port)
+	config.MaxConnections = r.rule.MaxConnections
+	config.RateLimitBPS = r.rule.RateLimitBPS
+	config.ConnTimeout = r.manager.config.DialTimeout
+	if r.rule.IdleTimeout > 0 {
+		config.IdleTimeout = time.Duration(r.rule.IdleTimeout) * time.Second
+	}
+	if len(r.targets) > 0 {
+		config.TargetAddr = r.targets[0].host
+		config.TargetPort = r.targets[0].port
+	}
+	return config
+}
+
+// setupRelay 创建 TCP 转发器，连接由本实例的监听分发进入
+// 真实来源按角色沿链路传递：中继/出口始终解析上一跳的 PROXY 头（只接受上一跳节点地址的连接），
+// 入口按隧道配置解析前置负载均衡器的头；有下一跳时向下一跳发送 PROXY v2 头，连接最终目标的节点按隧道配置发送 v1/v2 头
+func (r *ruleRunner) setupRelay() error {
+	config := r.relayConfig()
+	config.AcceptProxyProtocol = r.rule.IsHop() || r.rule.AcceptProxyProtocol
+	// 反向隧道出口不监听端口，连接只来自已通过密钥握手的反向会话
+	if r.rule.IsHop() && !r.rule.IsReverseAgent() {
+		config.TrustedProxySource = r.trustedProxySource()
+	}
+	if r.rule.NextHop != nil {
+		config.SendProxyProtocol = relay.ProxyProtocolV2
+	} else if r.rule.SendProxyProtocol != "" {
+		version, err := relay.ParseProxyProtocolVersion(r.rule.SendProxyProtocol)
+		if err != nil {
+			return err
+		}
+		config.SendProxyProtocol = version
+	}
+	if len(r.rule.ACL) > 0 {
+		config.AccessCheck = func(source net.Addr) bool {
+			return checkAccess(r.rule.ACL, source.String(), r.rule.TargetAddress, "tcp", r.rule.TargetPort)
+		}
+	}
+	config.Dialer = r.dialTarget
+
+	r.tcpRelay = relay.NewTCPRelay(config)
+	return nil
+}
+
+// setupProxyHandlers 创建 SOCKS/HTTP 代理入口的检测与处理器
+// 代理入口始终要求认证：凭据列表为空时拒绝所有请求，不会退化为开放代理
+func (r *ruleRunner) setupProxyHandlers(ingress string) {
+	credentials := make([]handlers.ProxyCredential, 0, len(r.rule.Credentials))
+	for _, cred := range r.rule.Credentials {
+		credentials = append(credentials, handlers.ProxyCredential{
+			Username:     cred.Username,
+			PasswordHash: cred.PasswordHash,
+			Salt:         cred.Salt,
+		})
+	}
+	r.manager.credentials.SetTunnelCredentials(r.rule.TunnelID, credentials)
+
+	r.connManager = detector.NewConnectionManager()
+
+	switch ingress {
+	case "http":
+		config := handlers.DefaultHTTPProxyConfig()
+		config.TunnelID = r.rule.TunnelID
+		config.Credentials = r.manager.credentials
+		config.RequireAuth = true
+		config.DialTimeout = r.manager.config.DialTimeout
+		if len(r.rule.AllowedDomains) > 0 {
+			config.AllowedDomains = &rules.Rule{Domains: r.rule.AllowedDomains}
+		}
+		r.httpHandler = handlers.NewHTTPProxyHandler(config)
+		r.connManager.RegisterHandler(detector.ProtocolHTTP, r.handleWith(r.httpHandler))
+	default:
+		config := handlers.DefaultSOCKSConfig()
+		config.TunnelID = r.rule.TunnelID
+		config.Credentials = r.manager.credentials
+		config.RequireAuth = true
+		config.EnableBind = r.rule.AllowBind
+		config.UDPManager = r.manager.udpManager
+		config.DialTimeout = r.manager.config.DialTimeout
+		r.socksHandler = handlers.NewSOCKSHandler(config)
+		r.connManager.RegisterHandler(detector.ProtocolSOCKS5, r.handleWith(r.socksHandler))
+		r.connManager.RegisterHandler(detector.ProtocolSOCKS4, r.handleWith(r.socksHandler))
+	}
+}
+
+// handleWith 把协议处理器适配为检测管理器的连接处理函数
+func (r *ruleRunner) handleWith(handler handlers.Handler) detector.ConnectionHandler {
+	return func(conn net.Conn, result *detector.DetectionResult) error {
+		return handler.Handle(r.ctx, conn, result)
+	}
+}
+
+// acceptFrom 接受共享端口分发或跳传输监听器收到的连接
+func (r *ruleRunner) acceptFrom(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go r.dispatch(conn)
+	}
+}
+
+// dispatchPort 处理本实例 TCP 端口上的连接，反向接入端先按首包分出出口回连
+func (r *ruleRunner) dispatchPort(conn net.Conn) {
+	if r.rule.IsReverseHub() {
+		peeked, reverse := r.peekReverse(conn)
+		if reverse {
+			r.serveReverse(peeked)
+			return
+		}
+		conn = peeked
+	}
+	r.dispatch(conn)
+}
+
+// peekReverse 预读首包判断是否为出口回连
+// PeekTimeout 内没有数据时按普通连接处理（服务端先发数据的协议在反向接入端会延迟 PeekTimeout）
+func (r *ruleRunner) peekReverse(conn net.Conn) (net.Conn, bool) {
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(r.manager.config.PeekTimeout))
+	prefix, _ := reader.Peek(4)
+	conn.SetReadDeadline(time.Time{})
+	return &peekedConn{Conn: conn, reader: reader}, relay.IsReverseHandshake(prefix)
+}
+
+// serveReverse 完成出口回连握手，会话登记到反向接入端后由其持有
+func (r *ruleRunner) serveReverse(conn net.Conn) {
+	if err := r.manager.reverseHub.ServeConn(conn); err != nil {
+		r.logger.Debug("出口回连握手失败",
+			zap.String("remote_addr", conn.RemoteAddr().String()),
+			zap.Error(err))
+	}
+}
+
+// dispatch 处理一个入口连接
+func (r *ruleRunner) dispatch(conn net.Conn) {
+	cc := r.track(conn)
+	if cc == nil {
+		return
+	}
+
+	if r.connManager != nil {
+		r.serveProxy(cc)
+		return
+	}
+
+	r.tcpRelay.ServeConn(cc)
+}
+
+// serveProxy 处理代理入口连接：按需解析前置负载均衡器的 PROXY 头，以真实来源做访问控制与统计
+// 代理入口的目标在 SOCKS/HTTP 握手后才确定，访问控制只按来源匹配，限定目标的 ACL 规则不会命中
+func (r *ruleRunner) serveProxy(cc *countingConn) {
+	defer cc.Close()
+
+	var conn net.Conn = cc
+	if r.rule.AcceptProxyProtocol {
+		proxyConn, err := relay.AcceptProxyHeader(cc, 0)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				r.failedConns.Add(1)
+				r.logger.Debug("读取 PROXY 头失败",
+					zap.String("remote_addr", cc.RemoteAddr().String()),
+					zap.Error(err))
+			}
+			return
+		}
+		conn = proxyConn
+	}
+
+	if len(r.rule.ACL) > 0 && !checkAccess(r.rule.ACL, conn.RemoteAddr().String(), "", "tcp", 0) {
+		r.deniedConns.Add(1)
+		r.logger.Debug("访问控制拒绝连接", zap.String("remote_addr", conn.RemoteAddr().String()))
+		return
+	}
+
+	if err := r.connManager.HandleConnection(conn); err != nil {
+		r.failedConns.Add(1)
+		r.logger.Debug("代理入口处理失败",
+			zap.String("remote_addr", conn.RemoteAddr().String()),
+			zap.Error(err))
+	}
+	r.sources.RecordSource(conn.RemoteAddr(), cc.bytesIn.Load(), cc.bytesOut.Load())
+}
+
+// dialTarget 依次尝试转发目标（轮询起点），直到连接成功
+// 处于容灾状态时先尝试容灾目标，主出口作为最后的退路；主出口全部失败计入容灾判定
+func (r *ruleRunner) dialTarget(ctx context.Context, _, _ string) (net.Conn, error) {
+	targets, failedOver := r.targets, false
+	if r.failover != nil {
+		targets, failedOver = r.failover.targets()
+	}
+
+	start := int(r.nextTarget.Add(1) - 1)
+	ordered := make([]ruleTarget, 0, len(targets)+len(r.targets))
+	for i := range targets {
+		ordered = append(ordered, targets[(start+i)%len(targets)])
+	}
+	if failedOver {
+		ordered = append(ordered, r.targets...)
+	}
+
+	var lastErr error
+	for _, target := range ordered {
+		conn, err := r.dial(ctx, target)
+		if err == nil {
+			return conn, nil
+		}
+
+		lastErr = err
+		r.logger.Debug("连接转发目标失败，尝试下一个",
+			zap.String("target", target.address()),
+			zap.String("transport", string(r.transportType)),
+			zap.Error(err))
+	}
+	if !failedOver && ctx.Err() == nil {
+		r.observePrimary(false)
+	}
+	return nil, fmt.Errorf("所有转发目标均不可达: %w", lastErr)
+}
+
+// dial 按规则的传输协议连接单个目标，规则优先级作为复用传输的流优先级；出口回连的目标经反向会话开流
+func (r *ruleRunner) dial(ctx context.Context, target ruleTarget) (net.Conn, error) {
+	if target.reverse {
+		return r.manager.reverseHub.DialTunnel(ctx, r.rule.TunnelID)
+	}
+	if r.transportType == transport.TransportTCP || r.manager.transportManager == nil {
+		dialer := net.Dialer{Timeout: r.manager.config.DialTimeout}
+		return dialer.DialContext(ctx, "tcp", target.address())
+	}
+	ctx = transport.WithStreamPriority(ctx, r.rule.Priority)
+	return r.manager.transportManager.DialContext(ctx, r.transportType, target.address())
+}
+
+// track 登记入口连接并包装流量计数，实例已停止时关闭连接
+func (r *ruleRunner) track(conn net.Conn) *countingConn {
+	cc := &countingConn{Conn: conn, runner: r}
+
+	r.connsMu.Lock()
+	if r.ctx.Err() != nil {
+		r.connsMu.Unlock()
+		conn.Close()
+		return nil
+	}
+	r.conns[cc] = struct{}{}
+	r.connsMu.Unlock()
+
+	r.totalConns.Add(1)
+	r.activeConns.Add(1)
+	return cc
+}
+
+// untrack 注销入口连接
+func (r *ruleRunner) untrack(cc *countingConn) {
+	r.connsMu.Lock()
+	delete(r.conns, cc)
+	r.connsMu.Unlock()
+
+	r.activeConns.Add(-1)
+}
+
+// stop 停止监听并关闭本规则的全部连接
+func (r *ruleRunner) stop() {
+	r.connsMu.Lock()
+	r.cancel()
+	r.connsMu.Unlock()
+
+	if r.sharedListener != nil {
+		r.sharedListener.Close()
+	} else if r.udpRelay == nil {
+		if r.hopListener != nil {
+			r.hopListener.Close()
+		}
+		// 端口未被本实例占用时返回错误，忽略即可（跳传输监听的反向接入端另占 TCP 端口）
+		r.manager.portManager.StopListener(r.port, r.owner)
+	}
+	for _, agent := range r.reverseAgents {
+		agent.Close()
+	}
+	if r.rule.IsReverseHub() {
+		r.manager.reverseHub.RemoveTunnel(r.rule.TunnelID)
+	}
+
+	r.connsMu.Lock()
+	conns := make([]*countingConn, 0, len(r.conns))
+	for cc := range r.conns {
+		conns = append(conns, cc)
+	}
+	r.connsMu.Unlock()
+	for _, cc := range conns {
+		cc.Close()
+	}
+
+	if r.tcpRelay != nil {
+		r.tcpRelay.Stop()
+	}
+	if r.udpRelay != nil {
+		r.udpRelay.Stop()
+	}
+	if trust := r.manager.peerTrust; trust != nil {
+		trust.RemovePeers(r.owner)
+	}
+}
+
+// takeReport 生成自上次上报以来的流量增量，无变化时返回 nil
+func (r *ruleRunner) takeReport() *protocol.TrafficReportRequest {
+	r.reportMu.Lock()
+	defer r.reportMu.Unlock()
+
+	bytesIn, bytesOut, totalConns := r.counters()
+	deltaIn := bytesIn - r.reported.bytesIn
+	deltaOut := bytesOut - r.reported.bytesOut
+	deltaConns := totalConns - r.reported.totalConns
+
+	sources := r.sourceTotals()
+	var deltaSources []protocol.TrafficSource
+	for ip, total := range sources {
+		prev := r.reported.sources[ip]
+		delta := protocol.TrafficSource{
+			IP:          ip,
+			Connections: total.Connections - prev.Connections,
+			BytesIn:     total.BytesIn - prev.BytesIn,
+			BytesOut:    total.BytesOut - prev.BytesOut,
+		}
+		if delta.Connections != 0 || delta.BytesIn != 0 || delta.BytesOut != 0 {
+			deltaSources = append(deltaSources, delta)
+		}
+	}
+	if deltaIn == 0 && deltaOut == 0 && deltaConns == 0 && len(deltaSources) == 0 {
+		return nil
+	}
+	sort.Slice(deltaSources, func(i, j int) bool { return deltaSources[i].IP < deltaSources[j].IP })
+
+	r.reported.bytesIn = bytesIn
+	r.reported.bytesOut = bytesOut
+	r.reported.totalConns = totalConns
+	r.reported.sources = sources
+
+	return &protocol.TrafficReportRequest{
+		TunnelID:    r.rule.TunnelID,
+		TrafficIn:   deltaIn,
+		TrafficOut:  deltaOut,
+		Connections: int(deltaConns),
+		Details: map[string]int64{
+			"active_conns": r.activeConns.Load(),
+			"total_conns":  totalConns,
+			"failed_conns": r.failedCount(),
+			"denied_conns": r.deniedCount(),
+		},
+		Sources: deltaSources,
+	}
+}
+
+// restoreReport 上报失败时退回增量
+func (r *ruleRunner) restoreReport(report *protocol.TrafficReportRequest) {
+	r.reportMu.Lock()
+	defer r.reportMu.Unlock()
+
+	r.reported.bytesIn -= report.TrafficIn
+	r.reported.bytesOut -= report.TrafficOut
+	r.reported.totalConns -= int64(report.Connections)
+	for _, source := range report.Sources {
+		prev := r.reported.sources[source.IP]
+		prev.Connections -= source.Connections
+		prev.BytesIn -= source.BytesIn
+		prev.BytesOut -= source.BytesOut
+		r.reported.sources[source.IP] = prev
+	}
+}
+
+// sourceTotals 按真实来源 IP 的累计统计（转发器与代理入口之和）
+func (r *ruleRunner) sourceTotals() map[string]relay.SourceStats {
+	totals := r.sources.GetSources()
+	if r.tcpRelay != nil {
+		relaySources, _ := r.tcpRelay.GetStats()["sources"].(map[string]relay.SourceStats)
+		for ip, stats := range relaySources {
+			total := totals[ip]
+			total.Connections += stats.Connections
+			total.BytesIn += stats.BytesIn
+			total.BytesOut += stats.BytesOut
+			totals[ip] = total
+		}
+	}
+	return totals
+}
+
+// counters 返回累计入站字节、出站字节与连接数（UDP 取转发器统计）
+func (r *ruleRunner) counters() (int64, int64, int64) {
+	if r.udpRelay != nil {
+		stats := r.udpRelay.GetStats()
+		return statInt64(stats, "bytes_in"), statInt64(stats, "bytes_out"), statInt64(stats, "total_conns")
+	}
+	return r.bytesIn.Load(), r.bytesOut.Load(), r.totalConns.Load()
+}
+
+// failedCount 入口处理失败与转发器连接目标失败之和
+func (r *ruleRunner) failedCount() int64 {
+	failed := r.failedConns.Load()
+	if r.tcpRelay != nil {
+		failed += statInt64(r.tcpRelay.GetStats(), "failed_conns")
+	}
+	if r.udpRelay != nil {
+		failed += statInt64(r.udpRelay.GetStats(), "failed_conns")
+	}
+	return failed
+}
+
+// deniedCount 访问控制拒绝的连接数（代理入口与转发器之和）
+func (r *ruleRunner) deniedCount() int64 {
+	denied := r.deniedConns.Load()
+	if r.tcpRelay != nil {
+		denied += statInt64(r.tcpRelay.GetStats(), "denied_conns")
+	}
+	return denied
+}
+
+// getStats 获取规则运行统计
+func (r *ruleRunner) getStats() map[string]interface{} {
+	bytesIn, bytesOut, totalConns := r.counters()
+
+	stats := map[string]interface{}{
+		"name":             r.rule.TunnelName,
+		"role":             r.rule.Role,
+		"ingress_protocol": r.rule.GetIngressProtocol(),
+		"listen_port":      r.port,
+		"version":          r.rule.Version,
+		"shared":           r.sharedListener != nil,
+		"targets":          len(r.targets),
+		"transport":        string(r.transportType),
+		"bytes_in":         bytesIn,
+		"bytes_out":        bytesOut,
+		"total_conns":      totalConns,
+		"active_conns":     r.activeConns.Load(),
+		"failed_conns":     r.failedCount(),
+		"denied_conns":     r.deniedCount(),
+	}
+	if r.failover != nil {
+		stats["failover"] = r.failover.getStats()
+	}
+	if r.connManager != nil {
+		stats["detection"] = r.connManager.GetStats()
+	}
+	if r.socksHandler != nil {
+		stats["handler"] = r.socksHandler.GetStats()
+	}
+	if r.httpHandler != nil {
+		stats["handler"] = r.httpHandler.GetStats()
+	}
+	return stats
+}
+
+func statInt64(stats map[string]interface{}, key string) int64 {
+	if v, ok := stats[key].(int64); ok {
+		return v
+	}
+	return 0
+}
+
+// peekedConn 已预读首包的连接，读取时先返回预读的数据
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// countingConn 统计入口连接流量：读为入站，写为出站
+type countingConn struct {
+	net.Conn
+	runner    *ruleRunner
+	bytesIn   atomic.Int64 // 本连接的入站字节，用于按来源统计
+	bytesOut  atomic.Int64
+	closeOnce sync.Once
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.bytesIn.Add(int64(n))
+		c.runner.bytesIn.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.bytesOut.Add(int64(n))
+		c.runner.bytesOut.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.runner.untrack(c)
+	})
+	return err
+}
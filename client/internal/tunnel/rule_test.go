@@ -0,0 +1,533 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"gkipass/client/internal/certificate"
+	"gkipass/client/internal/ports"
+	"gkipass/client/internal/protocol"
+	"gkipass/client/internal/relay"
+	"gkipass/client/internal/transport"
+)
+
+// newTestManager 创建模拟单个节点的隧道运行时，停止时释放全部监听
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	transportManager, err := transport.New(nil)
+	if err != nil {
+		t.Fatalf("创建传输管理器失败: %v", err)
+	}
+	m := NewManager(&ManagerConfig{
+		DialTimeout:           2 * time.Second,
+		FailoverCheckInterval: 50 * time.Millisecond,
+		FailoverRecoverChecks: 1,
+	}, ports.NewManager(nil), nil, transportManager, nil)
+	t.Cleanup(func() { m.Stop() })
+	return m
+}
+
+// freePort 获取一个当前空闲的本地端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("获取空闲端口失败: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startEchoServer 启动回显服务，返回监听端口
+func startEchoServer(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动回显服务失败: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// applyRule 向节点下发单条规则
+func applyRule(t *testing.T, m *Manager, rule protocol.TunnelRule) {
+	t.Helper()
+	resp := m.ApplyRules(context.Background(), &protocol.SyncRulesRequest{Rules: []protocol.TunnelRule{rule}, Force: true})
+	if !resp.Success {
+		t.Fatalf("应用 %s 规则失败: %s", rule.Role, resp.Message)
+	}
+}
+
+// runnerOf 获取节点上运行的隧道实例
+func runnerOf(m *Manager, tunnelID string) *ruleRunner {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.rules[tunnelID]
+}
+
+// assertEcho 经入口端口发送数据，应收到原样回显
+func assertEcho(t *testing.T, port int, payload string) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", "127.0.0.1:"+strconv.Itoa(port), 2*time.Second)
+	if err != nil {
+		t.Fatalf("连接入口失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte(payload)); err != nil {
+		t.Fatalf("写入数据失败: %v", err)
+	}
+	buf := make([]byte, len(payload))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("读取回显失败: %v", err)
+	}
+	if string(buf) != payload {
+		t.Errorf("回显内容应为 %q，实际 %q", payload, buf)
+	}
+}
+
+// hopChain 按端口与跳传输协议构造链路描述，最后一跳为出口
+func hopChain(listenPorts []int, protocols []string) []protocol.TunnelHop {
+	hops := make([]protocol.TunnelHop, len(listenPorts))
+	for i, port := range listenPorts {
+		role := "relay"
+		switch i {
+		case 0:
+			role = "ingress"
+		case len(listenPorts) - 1:
+			role = "egress"
+		}
+		hops[i] = protocol.TunnelHop{Index: i, Role: role, Protocol: protocols[i], GroupID: "group-" + role}
+		hops[i].Nodes = []protocol.TunnelTarget{{Host: "127.0.0.1", Port: port, Weight: 1, Enabled: true}}
+	}
+	return hops
+}
+
+// chainRules 生成链路上每个节点收到的规则（与面板按组下发的结构一致）
+func chainRules(hops []protocol.TunnelHop, listenPorts []int, targetPort int) []protocol.TunnelRule {
+	rules := make([]protocol.TunnelRule, len(hops))
+	for i, hop := range hops {
+		rule := protocol.TunnelRule{
+			TunnelID:        "tunnel-chain",
+			TunnelName:      "链路测试",
+			Enabled:         true,
+			Version:         1,
+			IngressProtocol: "tcp",
+			ListenPort:      listenPorts[i],
+			TargetAddress:   "127.0.0.1",
+			TargetPort:      targetPort,
+			Role:            hop.Role,
+			HopIndex:        hop.Index,
+			Hops:            hops,
+		}
+		if i+1 < len(hops) {
+			next := hops[i+1]
+			rule.NextHop = &next
+		}
+		rules[i] = rule
+	}
+	return rules
+}
+
+// TestRuleRunner_TwoHopChain 入口 → 出口，出口以 TCP 跳监听并连接最终目标
+func TestRuleRunner_TwoHopChain(t *testing.T) {
+	target := startEchoServer(t)
+	listenPorts := []int{freePort(t), freePort(t)}
+	hops := hopChain(listenPorts, []string{"tcp", "tcp"})
+
+	for _, rule := range chainRules(hops, listenPorts, target) {
+		applyRule(t, newTestManager(t), rule)
+	}
+	assertEcho(t, listenPorts[0], "two-hop payload")
+}
+
+// TestRuleRunner_ThreeHopChain 入口 → 中继 → 出口，中继到出口走 KCP，中继与出口不识别入口协议
+func TestRuleRunner_ThreeHopChain(t *testing.T) {
+	target := startEchoServer(t)
+	listenPorts := []int{freePort(t), freePort(t), freePort(t)}
+	hops := hopChain(listenPorts, []string{"tcp", "tcp", "kcp"})
+
+	managers := make([]*Manager, len(hops))
+	for i, rule := range chainRules(hops, listenPorts, target) {
+		managers[i] = newTestManager(t)
+		applyRule(t, managers[i], rule)
+	}
+	assertEcho(t, listenPorts[0], "three-hop payload")
+
+	for i, m := range managers[1:] {
+		if runner := runnerOf(m, "tunnel-chain"); runner == nil || runner.connManager != nil {
+			t.Fatalf("第 %d 跳应以转发器原样转发", i+1)
+		}
+	}
+	egress := runnerOf(managers[2], "tunnel-chain")
+	if egress.hopListener == nil || egress.hopTransport() != transport.TransportKCP {
+		t.Errorf("出口应以 KCP 接收上一跳流量")
+	}
+}
+
+// newNodeManager 创建拥有独立节点证书的隧道运行时（QUIC 使用该节点证书）
+func newNodeManager(t *testing.T, nodeID string) (*Manager, *certificate.Manager) {
+	t.Helper()
+	cert, err := certificate.New(nodeID, t.TempDir())
+	if err != nil {
+		t.Fatalf("创建节点证书失败: %v", err)
+	}
+	m := newTestManager(t)
+	if err := m.transportManager.ConfigureQUIC(nil, cert.GetTLSConfig, cert.ClientTLSConfig); err != nil {
+		t.Fatalf("配置QUIC传输失败: %v", err)
+	}
+	if err := m.transportManager.ConfigureTLSMux(nil, cert.GetTLSConfig, cert.ClientTLSConfig); err != nil {
+		t.Fatalf("配置tls-mux传输失败: %v", err)
+	}
+	m.SetPeerTrust(cert)
+	return m, cert
+}
+
+// TestRuleRunner_QUICHopAcrossNodes 入口与出口各用自己的CA，按规则下发的节点ID与证书固定完成 QUIC 跳
+func TestRuleRunner_QUICHopAcrossNodes(t *testing.T) {
+	target := startEchoServer(t)
+	listenPorts := []int{freePort(t), freePort(t)}
+	hops := hopChain(listenPorts, []string{"tcp", "quic"})
+
+	ids := []string{"0f1e2d3c4b5a69788796a5b4c3d2e1f0", "a1b2c3d4e5f60718293a4b5c6d7e8f90"}
+	managers := make([]*Manager, len(ids))
+	certs := make([]*certificate.Manager, len(ids))
+	for i, id := range ids {
+		managers[i], certs[i] = newNodeManager(t, id)
+	}
+	for i := range hops {
+		hops[i].Nodes[0].NodeID = ids[i]
+		hops[i].Nodes[0].CertPin = certs[i].CAPin()
+	}
+
+	for i, rule := range chainRules(hops, listenPorts, target) {
+		applyRule(t, managers[i], rule)
+	}
+	assertEcho(t, listenPorts[0], "quic hop payload")
+}
+
+// TestRuleRunner_TLSMuxHopAcrossNodes 入口经 tls-mux 连接另一节点（各自的CA），流优先级取自规则优先级
+func TestRuleRunner_TLSMuxHopAcrossNodes(t *testing.T) {
+	const ingressID, egressID = "0f1e2d3c4b5a69788796a5b4c3d2e1f0", "a1b2c3d4e5f60718293a4b5c6d7e8f90"
+	ingress, ingressCert := newNodeManager(t, ingressID)
+	egressCert, err := certificate.New(egressID, t.TempDir())
+	if err != nil {
+		t.Fatalf("创建节点证书失败: %v", err)
+	}
+	egressCert.SetPeers("tunnel:tunnel-mux", []certificate.Peer{{Host: "127.0.0.1", NodeID: ingressID, CertPin: ingressCert.CAPin()}})
+
+	// 出口：tls-mux 监听，记录每个流的优先级，去掉入口附加的 PROXY 头后回显
+	egress, err := transport.NewTLSMuxTransport(nil, egressCert.GetTLSConfig, nil)
+	if err != nil {
+		t.Fatalf("创建tls-mux传输失败: %v", err)
+	}
+	t.Cleanup(func() { egress.Close() })
+	l, err := egress.Listen(context.Background(), "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("tls-mux监听失败: %v", err)
+	}
+	priorities := make(chan uint8, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			if stream, ok := conn.(interface{ Priority() uint8 }); ok {
+				priorities <- stream.Priority()
+			}
+			go func() {
+				defer conn.Close()
+				if pc, err := relay.AcceptProxyHeader(conn, 2*time.Second); err == nil {
+					io.Copy(pc, pc)
+				}
+			}()
+		}
+	}()
+
+	listenPort := freePort(t)
+	applyRule(t, ingress, protocol.TunnelRule{
+		TunnelID:        "tunnel-mux",
+		Enabled:         true,
+		Version:         1,
+		IngressProtocol: "tcp",
+		ListenPort:      listenPort,
+		Priority:        7,
+		Role:            "ingress",
+		NextHop: &protocol.TunnelHop{Index: 1, Role: "egress", Protocol: "tls-mux", Nodes: []protocol.TunnelTarget{{
+			Host: "127.0.0.1", Port: l.Addr().(*net.TCPAddr).Port, Enabled: true,
+			NodeID: egressID, CertPin: egressCert.CAPin(),
+		}}},
+	})
+	assertEcho(t, listenPort, "tls-mux hop payload")
+
+	select {
+	case priority := <-priorities:
+		if priority != 7 {
+			t.Errorf("复用流优先级应为规则优先级 7，实际 %d", priority)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("出口未收到复用流")
+	}
+}
+
+// TestRuleRunner_HopIgnoresProxyIngress 代理入口隧道的中继/出口不解析 SOCKS/HTTP
+func TestRuleRunner_HopIgnoresProxyIngress(t *testing.T) {
+	m := newTestManager(t)
+	rule := &protocol.TunnelRule{
+		TunnelID:        "tunnel-socks",
+		Enabled:         true,
+		IngressProtocol: "socks5",
+		ListenPort:      freePort(t),
+		TargetAddress:   "127.0.0.1",
+		TargetPort:      startEchoServer(t),
+		Role:            "egress",
+		HopIndex:        1,
+	}
+	runner, err := newRuleRunner(m, rule)
+	if err != nil {
+		t.Fatalf("创建规则实例失败: %v", err)
+	}
+	if runner.isProxyIngress() {
+		t.Errorf("出口节点不应识别为代理入口")
+	}
+}
+
+// dialWithProxyHeader 以伪造的来源地址（模拟前置负载均衡器）连接入口
+func dialWithProxyHeader(t *testing.T, port int, source string) net.Conn {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", "127.0.0.1:"+strconv.Itoa(port), 2*time.Second)
+	if err != nil {
+		t.Fatalf("连接入口失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	src := &net.TCPAddr{IP: net.ParseIP(source), Port: 40000}
+	if err := relay.WriteProxyHeader(conn, relay.ProxyProtocolV1, src, conn.RemoteAddr()); err != nil {
+		t.Fatalf("写入 PROXY 头失败: %v", err)
+	}
+	return conn
+}
+
+// TestRuleRunner_ChainCarriesRealSource 入口解析负载均衡器的 PROXY 头，经跳间 PROXY v2 传到出口，出口按 v1 发给目标
+func TestRuleRunner_ChainCarriesRealSource(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动目标服务失败: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	seen := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		header, err := relay.ReadProxyHeader(bufio.NewReader(conn))
+		if err != nil {
+			seen <- "error: " + err.Error()
+			return
+		}
+		seen <- header.SourceAddr.String()
+	}()
+
+	listenPorts := []int{freePort(t), freePort(t)}
+	hops := hopChain(listenPorts, []string{"tcp", "tcp"})
+	managers := make([]*Manager, len(hops))
+	for i, rule := range chainRules(hops, listenPorts, l.Addr().(*net.TCPAddr).Port) {
+		rule.AcceptProxyProtocol = true
+		rule.SendProxyProtocol = "v1"
+		managers[i] = newTestManager(t)
+		applyRule(t, managers[i], rule)
+	}
+
+	conn := dialWithProxyHeader(t, listenPorts[0], "198.51.100.7")
+	conn.Write([]byte("hello"))
+	select {
+	case source := <-seen:
+		if source != "198.51.100.7:40000" {
+			t.Fatalf("目标应看到真实来源 198.51.100.7:40000，实际 %s", source)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("目标未收到连接")
+	}
+	conn.Close()
+
+	egress := runnerOf(managers[1], "tunnel-chain")
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if report := egress.takeReport(); report != nil && len(report.Sources) > 0 {
+			if report.Sources[0].IP != "198.51.100.7" || report.Sources[0].Connections != 1 {
+				t.Errorf("出口应按真实来源统计，实际 %+v", report.Sources)
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Error("出口流量上报缺少来源统计")
+}
+
+// TestRuleRunner_HopRejectsUntrustedProxySource 出口只采用上一跳节点发来的 PROXY 头，其他来源直连出口被拒绝
+func TestRuleRunner_HopRejectsUntrustedProxySource(t *testing.T) {
+	target := startEchoServer(t)
+	listenPorts := []int{freePort(t), freePort(t)}
+	hops := hopChain(listenPorts, []string{"tcp", "tcp"})
+	hops[0].Nodes[0].Host = "198.51.100.1"
+	egress := newTestManager(t)
+	applyRule(t, egress, chainRules(hops, listenPorts, target)[1])
+
+	conn := dialWithProxyHeader(t, listenPorts[1], "203.0.113.9")
+	conn.Write([]byte("spoofed"))
+	buf := make([]byte, 7)
+	if n, err := conn.Read(buf); err == nil {
+		t.Fatalf("非上一跳来源的 PROXY 头不应被采用，实际读到 %q", buf[:n])
+	}
+	if got := runnerOf(egress, "tunnel-chain").deniedCount(); got != 1 {
+		t.Errorf("出口应拒绝 1 个连接，实际 %d", got)
+	}
+}
+
+// TestRuleRunner_HopACLUsesRealSource 出口按上一跳传来的真实来源执行访问控制
+func TestRuleRunner_HopACLUsesRealSource(t *testing.T) {
+	target := startEchoServer(t)
+	listenPorts := []int{freePort(t), freePort(t)}
+	hops := hopChain(listenPorts, []string{"tcp", "tcp"})
+	managers := make([]*Manager, len(hops))
+	for i, rule := range chainRules(hops, listenPorts, target) {
+		rule.AcceptProxyProtocol = true
+		if rule.Role == "egress" {
+			rule.ACL = []protocol.ACLRule{{Action: "deny", SourceIP: "203.0.113.0/24"}}
+		}
+		managers[i] = newTestManager(t)
+		applyRule(t, managers[i], rule)
+	}
+
+	allowed := dialWithProxyHeader(t, listenPorts[0], "198.51.100.7")
+	allowed.Write([]byte("ok"))
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(allowed, buf); err != nil || string(buf) != "ok" {
+		t.Fatalf("未命中拒绝规则的来源应正常转发: %v", err)
+	}
+
+	denied := dialWithProxyHeader(t, listenPorts[0], "203.0.113.9")
+	denied.Write([]byte("no"))
+	if n, err := denied.Read(buf); err == nil {
+		t.Fatalf("被拒绝的来源不应收到数据，实际读到 %q", buf[:n])
+	}
+	if got := runnerOf(managers[1], "tunnel-chain").deniedCount(); got != 1 {
+		t.Errorf("出口应拒绝 1 个连接，实际 %d", got)
+	}
+	if got := runnerOf(managers[0], "tunnel-chain").deniedCount(); got != 0 {
+		t.Errorf("入口没有 ACL，不应拒绝连接，实际 %d", got)
+	}
+}
+
+// reverseChainRules 生成出口为反向模式的链路规则：出口回连上一跳，上一跳经反向会话连接出口
+func reverseChainRules(hops []protocol.TunnelHop, listenPorts []int, targetPort int, secret string) []protocol.TunnelRule {
+	rules := chainRules(hops, listenPorts, targetPort)
+	n := len(rules)
+	for i := range rules {
+		rules[i].Reverse = true
+	}
+	rules[n-2].ReverseSecret = secret
+	rules[n-1].ReverseSecret = secret
+	rules[n-1].ReversePeers = hops[n-2].Nodes
+	return rules
+}
+
+// TestRuleRunner_ReverseEgress 出口不监听端口，回连上一跳的监听端口后，入口流量经反向会话到达出口和最终目标
+func TestRuleRunner_ReverseEgress(t *testing.T) {
+	cases := []struct {
+		name      string
+		protocols []string
+	}{
+		{"入口接受回连", []string{"tcp", "tcp"}},
+		{"KCP中继接受回连", []string{"tcp", "kcp", "tcp"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			target := startEchoServer(t)
+			listenPorts := make([]int, len(tc.protocols))
+			for i := range listenPorts {
+				listenPorts[i] = freePort(t)
+			}
+			hops := hopChain(listenPorts, tc.protocols)
+			rules := reverseChainRules(hops, listenPorts, target, "reverse-secret")
+
+			managers := make([]*Manager, len(rules))
+			for i, rule := range rules {
+				managers[i] = newTestManager(t)
+				applyRule(t, managers[i], rule)
+			}
+			hub := managers[len(managers)-2]
+			egress := managers[len(managers)-1]
+
+			if runner := runnerOf(egress, "tunnel-chain"); runner == nil || len(runner.reverseAgents) != 1 {
+				t.Fatal("反向出口应为上一跳节点启动回连")
+			}
+			if conn, err := net.DialTimeout("tcp", "127.0.0.1:"+strconv.Itoa(listenPorts[len(listenPorts)-1]), time.Second); err == nil {
+				conn.Close()
+				t.Error("反向出口不应监听隧道端口")
+			}
+
+			assertEcho(t, listenPorts[0], "via reverse egress")
+			if hub.reverseHub.SessionCount("tunnel-chain") == 0 {
+				t.Error("上一跳应登记出口回连的会话")
+			}
+
+			// 出口规则移除后回连关闭，上一跳不再登记会话
+			egress.ApplyRules(context.Background(), &protocol.SyncRulesRequest{Force: true})
+			deadline := time.Now().Add(3 * time.Second)
+			for hub.reverseHub.SessionCount("tunnel-chain") > 0 && time.Now().Before(deadline) {
+				time.Sleep(20 * time.Millisecond)
+			}
+			if n := hub.reverseHub.SessionCount("tunnel-chain"); n != 0 {
+				t.Errorf("出口停止后上一跳不应保留反向会话，实际 %d", n)
+			}
+		})
+	}
+}
+
+// TestRuleRunner_ReverseEgressWrongSecret 密钥不符的出口回连被上一跳拒绝
+func TestRuleRunner_ReverseEgressWrongSecret(t *testing.T) {
+	target := startEchoServer(t)
+	listenPorts := []int{freePort(t), freePort(t)}
+	hops := hopChain(listenPorts, []string{"tcp", "tcp"})
+	rules := reverseChainRules(hops, listenPorts, target, "reverse-secret")
+	rules[1].ReverseSecret = "stale-secret"
+
+	ingress := newTestManager(t)
+	applyRule(t, ingress, rules[0])
+	applyRule(t, newTestManager(t), rules[1])
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if ingress.reverseHub.SessionCount("tunnel-chain") > 0 {
+			t.Fatal("密钥不符的出口不应建立反向会话")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if rejected := ingress.reverseHub.GetStats()["rejected"].(int64); rejected == 0 {
+		t.Error("上一跳应拒绝密钥不符的回连")
+	}
+}
@@ -149,6 +149,20 @@ func (m *Manager) Stop() error {
 
 // GetSession 获取或创建UDP会话
 func (m *Manager) GetSession(tuple FiveTuple, clientAddr, serverAddr *net.UDPAddr) (*UDPSession, error) {
+	return m.getOrCreateSession(tuple, clientAddr, serverAddr, nil)
+}
+
+// GetRelaySession 获取或创建中继模式UDP会话：上行由调用方通过 WriteToServer 写入，
+// 回包交给 handler 处理（如 SOCKS5 UDP ASSOCIATE 需要为回包添加报头）
+func (m *Manager) GetRelaySession(tuple FiveTuple, clientAddr, serverAddr *net.UDPAddr, handler ResponseHandler) (*UDPSession, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("中继会话必须设置回包处理函数")
+	}
+	return m.getOrCreateSession(tuple, clientAddr, serverAddr, handler)
+}
+
+// getOrCreateSession 获取已存在的会话或创建新会话
+func (m *Manager) getOrCreateSession(tuple FiveTuple, clientAddr, serverAddr *net.UDPAddr, handler ResponseHandler) (*UDPSession, error) {
 	tupleHash := tuple.Hash()
 
 	// 先尝试获取已存在的会话
@@ -170,6 +184,7 @@ func (m *Manager) GetSession(tuple FiveTuple, clientAddr, serverAddr *net.UDPAdd
 	// 创建新会话
 	sessionID := m.generateSessionID(tuple)
 	session := NewUDPSession(sessionID, tuple, clientAddr, serverAddr)
+	session.responseHandler = handler
 
 	// 添加到管理器
 	m.mutex.Lock()
@@ -209,19 +224,22 @@ func (m *Manager) RemoveSession(sessionID string) error {
 		return fmt.Errorf("会话不存在: %s", sessionID)
 	}
 
-	// 停止会话
+	// 停止会话（停止后状态不再是活跃，需先记录）
+	wasActive := session.IsActive()
 	session.Stop()
 
 	// 从映射中移除
 	tupleHash := session.GetTuple().Hash()
 	delete(m.sessions, sessionID)
-	delete(m.tupleMap, tupleHash)
+	if m.tupleMap[tupleHash] == sessionID {
+		delete(m.tupleMap, tupleHash)
+	}
 
 	// 移除NAT映射
 	m.natTable.RemoveMapping(session.GetTuple())
 
 	// 更新统计
-	if session.IsActive() {
+	if wasActive {
 		m.activeSessions.Add(-1)
 	}
 
@@ -45,6 +45,9 @@ func (ft FiveTuple) Reverse() FiveTuple {
 	}
 }
 
+// ResponseHandler 服务端回包处理函数，设置后回包交由其封装发送，不再直接写回客户端
+type ResponseHandler func(data []byte, from *net.UDPAddr) error
+
 // UDPSession UDP会话
 type UDPSession struct {
 	id           string
@@ -57,6 +60,9 @@ type UDPSession struct {
 	clientAddr *net.UDPAddr
 	serverAddr *net.UDPAddr
 
+	// 中继模式：上行由调用方 WriteToServer 写入，回包交给 responseHandler
+	responseHandler ResponseHandler
+
 	// 状态信息
 	state        SessionState
 	createdAt    time.Time
@@ -145,10 +151,13 @@ func (s *UDPSession) Start() error {
 		return fmt.Errorf("连接服务端失败: %w", err)
 	}
 
-	// 启动数据转发协程
+	// 启动数据转发协程（中继模式下上行由调用方写入）
 	s.state = SessionStateActive
-	s.wg.Add(2)
-	go s.forwardToServer()
+	if s.responseHandler == nil {
+		s.wg.Add(1)
+		go s.forwardToServer()
+	}
+	s.wg.Add(1)
 	go s.forwardToClient()
 
 	s.logger.Debug("UDP会话启动完成")
@@ -274,7 +283,11 @@ func (s *UDPSession) forwardToClient() {
 
 		if n > 0 {
 			// 转发到客户端
-			_, err := s.clientConn.WriteToUDP(buffer[:n], s.clientAddr)
+			if s.responseHandler != nil {
+				err = s.responseHandler(buffer[:n], s.serverAddr)
+			} else {
+				_, err = s.clientConn.WriteToUDP(buffer[:n], s.clientAddr)
+			}
 			if err != nil {
 				s.logger.Error("转发到客户端失败", zap.Error(err))
 				return
@@ -289,6 +302,28 @@ func (s *UDPSession) forwardToClient() {
 	}
 }
 
+// WriteToServer 中继模式下发送数据到服务端
+func (s *UDPSession) WriteToServer(data []byte) (int, error) {
+	s.mutex.RLock()
+	conn := s.serverConn
+	state := s.state
+	s.mutex.RUnlock()
+
+	if state != SessionStateActive || conn == nil {
+		return 0, fmt.Errorf("会话未激活: %s", state.String())
+	}
+
+	n, err := conn.Write(data)
+	if err != nil {
+		return n, fmt.Errorf("发送到服务端失败: %w", err)
+	}
+
+	s.packetsOut.Add(1)
+	s.bytesOut.Add(int64(n))
+	s.updateActivity()
+	return n, nil
+}
+
 // SetClientConn 设置客户端连接
 func (s *UDPSession) SetClientConn(conn *net.UDPConn) {
 	s.mutex.Lock()
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
@@ -17,8 +19,10 @@ import (
 	"gkipass/plane/internal/config"
 	"gkipass/plane/internal/db"
 	"gkipass/plane/internal/db/dao"
+	"gkipass/plane/internal/metrics"
 	"gkipass/plane/internal/pkg/initializer"
 	"gkipass/plane/internal/pkg/logger"
+	"gkipass/plane/internal/pkg/tracing"
 	"gkipass/plane/internal/server"
 	"gkipass/plane/internal/service"
 	"gkipass/plane/internal/ws"
@@ -88,6 +92,20 @@ func main() {
 		logger.Fatal("重新初始化日志系统失败", zap.Error(err))
 	}
 
+	/* 链路追踪：API 请求 → 规则同步 → 节点应用，未启用时只注册传播器 */
+	if err := tracing.Init(&tracing.Config{
+		Enabled:     cfg.Tracing.Enabled,
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		FilePath:    cfg.Tracing.FilePath,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: cfg.Tracing.ServiceName,
+	}); err != nil {
+		logger.Fatal("初始化链路追踪失败", zap.Error(err))
+	}
+	defer tracing.Shutdown()
+
 	/* 阶段 4：初始化数据库（必须串行，后续服务依赖它） */
 	dbStart := time.Now()
 	dbManager, err := db.NewManager(&db.Config{
@@ -121,6 +139,30 @@ func main() {
 	/* 初始化 GORM DAO 层 */
 	gormDAO := dao.New(dbManager.GormDB)
 
+	/*
+		多实例部署（依赖 Redis）：定时任务只在选出的主实例执行，
+		节点消息经 Redis 转发到节点所在实例，全局在线节点表刷新节点组在线数
+	*/
+	var (
+		leader      *service.LeaderElector /* nil 表示单实例，定时任务照常执行 */
+		redisClient = dbManager.RedisClient()
+		instanceID  = cfg.Cluster.InstanceID
+		clustered   = cfg.Cluster.Enabled && redisClient != nil
+	)
+	if cfg.Cluster.Enabled && redisClient == nil {
+		logger.Warn("已启用多实例部署但 Redis 不可用，按单实例运行")
+	}
+	if clustered {
+		if instanceID == "" {
+			instanceID = newInstanceID()
+		}
+		leader = service.NewLeaderElector(service.NewLockManager(redisClient), "scheduler", instanceID,
+			time.Duration(cfg.Cluster.LeaderTTL)*time.Second)
+		leader.Start()
+		defer leader.Stop()
+		logger.Info("✓ 多实例部署已启用", zap.String("instance", instanceID), zap.Bool("leader", leader.IsLeader()))
+	}
+
 	/*
 		阶段 5：并行启动独立服务
 		JWT 管理器、端口管理器、清理服务、WebSocket 服务器互不依赖，
@@ -132,6 +174,7 @@ func main() {
 		cleanupService  *service.CleanupService
 		failoverService *service.FailoverService
 		wsServer        *ws.Server
+		wsCluster       *ws.Cluster
 		wg              sync.WaitGroup
 	)
 
@@ -168,6 +211,15 @@ func main() {
 	go func() {
 		defer wg.Done()
 		wsServer = ws.NewServer(gormDAO, cfg.Server.WSMaxConnections, failoverService)
+		if clustered {
+			groupCache := service.GetNodeGroupCache(dbManager.GormDB)
+			cluster, err := wsServer.EnableCluster(redisClient, instanceID,
+				time.Duration(cfg.Cluster.NodeTTL)*time.Second, groupCache.SyncOnlineCounts)
+			if err != nil {
+				logger.Error("启用多实例协同失败，节点消息只投递本实例连接", zap.Error(err))
+			}
+			wsCluster = cluster
+		}
 		wsServer.Start()
 		logger.Debug("✓ WebSocket 服务器就绪")
 	}()
@@ -177,9 +229,43 @@ func main() {
 	/* 服务间依赖串行处理 */
 	defer jwtManager.Stop()
 	cfg.Auth.JWTSecret = jwtManager.GetSecret()
+	cleanupService.SetLeaderElector(leader)
 	go cleanupService.Start()
 	defer cleanupService.Stop()
 
+	/* 支付监听、节点监控（小时聚合、离线告警检查、过期数据清理），多实例时只在主实例执行 */
+	paymentMonitor := service.NewPaymentMonitorService(gormDAO)
+	paymentMonitor.SetLeaderElector(leader)
+	go paymentMonitor.Start()
+	defer paymentMonitor.Stop()
+	monitoringService := service.NewNodeMonitoringService(gormDAO)
+	monitoringService.SetLeaderElector(leader)
+	monitoringService.Start()
+	defer monitoringService.Stop()
+
+	/* Prometheus 业务指标：隧道/节点/节点组/用户维度，经 /metrics 暴露 */
+	metricsExporter := metrics.NewPlaneExporter(gormDAO, wsServer.GetManager())
+	metricsExporter.Start()
+	defer metricsExporter.Stop()
+
+	/* 节点健康（由监控上报判定）与规则分批发布：发布推进、回滚判定多实例时只在主实例执行 */
+	healthService := service.NewHealthService()
+	healthService.Start()
+	defer healthService.Stop()
+	wsServer.SetHealthService(healthService)
+	rolloutController := service.NewRolloutController(dbManager.GormDB, wsServer.GetSyncService(), service.RolloutOptions{
+		Enabled:       cfg.Rollout.Enabled,
+		CanaryPercent: cfg.Rollout.CanaryPercent,
+		Waves:         cfg.Rollout.Waves,
+		BakeTime:      time.Duration(cfg.Rollout.BakeSeconds) * time.Second,
+		AckTimeout:    time.Duration(cfg.Rollout.AckTimeoutSeconds) * time.Second,
+		MaxErrorRate:  cfg.Rollout.MaxErrorRate,
+	})
+	rolloutController.SetLeaderElector(leader)
+	rolloutController.SetHealthService(healthService)
+	rolloutController.Start()
+	defer rolloutController.Stop()
+
 	logger.Info("✓ 后台服务并行初始化完成", zap.Duration("耗时", time.Since(servicesStart)))
 
 	/* 阶段 6：组装路由 + 启动 HTTP 服务器 */
@@ -257,12 +343,28 @@ func main() {
 		}
 	}
 
-	/* 断开所有 WebSocket 节点连接 */
+	/* 注销本实例登记的节点，再断开所有 WebSocket 节点连接 */
+	if wsCluster != nil {
+		wsCluster.Stop()
+	}
 	wsServer.Stop()
 
 	logger.Info("✓ 所有服务已停止")
 }
 
+/* newInstanceID 生成实例 ID：主机名 + 随机后缀，同一主机上的多个实例也不冲突 */
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "plane"
+	}
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return host + "-" + hex.EncodeToString(b)
+}
+
 func printBanner() {
 	banner := `
 ╔═══════════════════════════════════════════════════════╗
@@ -87,6 +87,8 @@ func (h *PlanHandler) Create(c *gin.Context) {
 		return
 	}
 
+	middleware.AuditChange(c, "plan.create", "plan:"+plan.ID, nil, plan)
+
 	response.GinSuccessWithMessage(c, "套餐创建成功", plan)
 }
 
@@ -154,6 +156,7 @@ func (h *PlanHandler) Update(c *gin.Context) {
 		updates["duration_unit"] = req.DurationUnit
 	}
 
+	previous, _ := h.planSvc.GetPlan(id)
 	plan, err := h.planSvc.UpdatePlan(id, updates)
 	if err != nil {
 		h.logger.Error("更新套餐失败", zap.String("id", id), zap.Error(err))
@@ -161,6 +164,8 @@ func (h *PlanHandler) Update(c *gin.Context) {
 		return
 	}
 
+	middleware.AuditChange(c, "plan.update", "plan:"+id, previous, plan)
+
 	response.GinSuccessWithMessage(c, "套餐更新成功", plan)
 }
 
@@ -171,12 +176,15 @@ Delete 删除套餐（仅管理员，软删除）
 func (h *PlanHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 
+	previous, _ := h.planSvc.GetPlan(id)
 	if err := h.planSvc.DeletePlan(id); err != nil {
 		h.logger.Error("删除套餐失败", zap.String("id", id), zap.Error(err))
 		response.GinBadRequest(c, err.Error())
 		return
 	}
 
+	middleware.AuditChange(c, "plan.delete", "plan:"+id, previous, nil)
+
 	response.GinSuccessWithMessage(c, "套餐已删除", nil)
 }
 
@@ -0,0 +1,115 @@
+package node
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"gkipass/plane/internal/api/middleware"
+	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/service"
+)
+
+/*
+NodeCommandHandler 节点远程命令 API 处理器
+功能：管理员向在线节点下发白名单命令（重载规则、重启监听、导出协程、轮换证书、探测、取日志、改日志级别），
+同步等待节点返回结果；每条命令记录在 node_commands 并写入审计日志
+*/
+type NodeCommandHandler struct {
+	commands *service.NodeCommandService
+	logger   *zap.Logger
+}
+
+/*
+NewNodeCommandHandler 创建节点远程命令处理器
+*/
+func NewNodeCommandHandler(commands *service.NodeCommandService) *NodeCommandHandler {
+	return &NodeCommandHandler{
+		commands: commands,
+		logger:   zap.L().Named("node-command-handler"),
+	}
+}
+
+/* ExecuteCommandRequest 下发命令请求 */
+type ExecuteCommandRequest struct {
+	Command string                 `json:"command" binding:"required"`
+	Params  map[string]interface{} `json:"params"`
+	Timeout int                    `json:"timeout"` /* 秒，0 使用命令默认超时，最长 120 秒 */
+}
+
+/*
+Execute 下发命令并等待结果
+功能：节点返回或超时后响应命令记录（status 为 success / failed / timeout）
+路由：POST /api/v1/nodes/:id/commands
+*/
+func (h *NodeCommandHandler) Execute(c *gin.Context) {
+	var req ExecuteCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "无效的请求参数: "+err.Error())
+		return
+	}
+
+	cmd, err := h.commands.Execute(c.Request.Context(), &service.NodeCommandRequest{
+		NodeID:      c.Param("id"),
+		Command:     req.Command,
+		Params:      req.Params,
+		Timeout:     time.Duration(req.Timeout) * time.Second,
+		RequestedBy: middleware.GetUserID(c),
+		Username:    middleware.GetUsername(c),
+		ClientIP:    c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+	})
+	if err != nil {
+		h.logger.Warn("下发节点命令失败",
+			zap.String("node_id", c.Param("id")),
+			zap.String("command", req.Command),
+			zap.Error(err))
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+
+	response.GinSuccess(c, cmd)
+}
+
+/*
+ListCommands 列出白名单命令
+路由：GET /api/v1/nodes/commands/available
+*/
+func (h *NodeCommandHandler) ListCommands(c *gin.Context) {
+	response.GinSuccess(c, gin.H{
+		"commands": service.NodeCommandNames(),
+	})
+}
+
+/*
+List 列出节点的命令记录
+路由：GET /api/v1/nodes/:id/commands?limit=
+*/
+func (h *NodeCommandHandler) List(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	list, err := h.commands.List(c.Param("id"), limit)
+	if err != nil {
+		response.GinInternalError(c, "查询命令记录失败", err)
+		return
+	}
+
+	response.GinSuccess(c, gin.H{
+		"commands": list,
+		"total":    len(list),
+	})
+}
+
+/*
+Get 获取命令记录
+路由：GET /api/v1/nodes/:id/commands/:command_id
+*/
+func (h *NodeCommandHandler) Get(c *gin.Context) {
+	cmd, err := h.commands.Get(c.Param("id"), c.Param("command_id"))
+	if err != nil {
+		response.GinNotFound(c, err.Error())
+		return
+	}
+	response.GinSuccess(c, cmd)
+}
@@ -2,20 +2,25 @@ package node
 
 import (
 	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/api/middleware"
 	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/pkg/logger"
+	"gkipass/plane/internal/service"
 	"gkipass/plane/internal/types"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 // NodeGroupHandler 节点组处理器
 type NodeGroupHandler struct {
-	app *types.App
+	app     *types.App
+	syncSvc *service.GormNodeSyncService /* 可为 nil（未启用节点同步） */
 }
 
 // NewNodeGroupHandler 创建节点组处理器
-func NewNodeGroupHandler(app *types.App) *NodeGroupHandler {
-	return &NodeGroupHandler{app: app}
+func NewNodeGroupHandler(app *types.App, syncSvc *service.GormNodeSyncService) *NodeGroupHandler {
+	return &NodeGroupHandler{app: app, syncSvc: syncSvc}
 }
 
 // CreateNodeGroupRequest 创建节点组请求
@@ -23,6 +28,7 @@ type CreateNodeGroupRequest struct {
 	Name        string `json:"name" binding:"required,min=1,max=64"`
 	Role        string `json:"role" binding:"omitempty,oneof=ingress egress both"` /* ingress/egress/both */
 	Description string `json:"description" binding:"omitempty,max=512"`
+	ReverseMode bool   `json:"reverse_mode"` /* 反向模式：出口节点主动回连上一跳（仅出口组） */
 }
 
 // Create 创建节点组
@@ -37,11 +43,16 @@ func (h *NodeGroupHandler) Create(c *gin.Context) {
 	if role == "" {
 		role = models.NodeRoleBoth
 	}
+	if req.ReverseMode && role == models.NodeRoleIngress {
+		response.GinBadRequest(c, "反向模式仅适用于出口组")
+		return
+	}
 
 	group := &models.NodeGroup{
 		Name:        req.Name,
 		Role:        role,
 		Description: req.Description,
+		ReverseMode: req.ReverseMode,
 	}
 
 	if err := h.app.DAO.CreateNodeGroup(group); err != nil {
@@ -49,6 +60,7 @@ func (h *NodeGroupHandler) Create(c *gin.Context) {
 		return
 	}
 
+	middleware.AuditChange(c, "node_group.create", "node_group:"+group.ID, nil, group)
 	response.GinSuccessWithMessage(c, "节点组已创建", group)
 }
 
@@ -89,6 +101,7 @@ type UpdateNodeGroupRequest struct {
 	Name        string `json:"name" binding:"omitempty,max=64"`
 	Role        string `json:"role" binding:"omitempty,oneof=ingress egress both"`
 	Description string `json:"description" binding:"omitempty,max=512"`
+	ReverseMode *bool  `json:"reverse_mode"` /* 为空表示不修改 */
 }
 
 // Update 更新节点组
@@ -106,6 +119,7 @@ func (h *NodeGroupHandler) Update(c *gin.Context) {
 		response.GinNotFound(c, "节点组不存在")
 		return
 	}
+	previous := *group
 
 	if req.Name != "" {
 		group.Name = req.Name
@@ -116,12 +130,39 @@ func (h *NodeGroupHandler) Update(c *gin.Context) {
 	if req.Description != "" {
 		group.Description = req.Description
 	}
+	reverseChanged := req.ReverseMode != nil && *req.ReverseMode != group.ReverseMode
+	if req.ReverseMode != nil {
+		group.ReverseMode = *req.ReverseMode
+	}
+	if group.ReverseMode && group.Role == models.NodeRoleIngress {
+		response.GinBadRequest(c, "反向模式仅适用于出口组")
+		return
+	}
+
+	// 反向模式决定以该组为出口的隧道规则，修改前记录节点上的原有规则
+	var baseline *service.RolloutBaseline
+	if reverseChanged && h.syncSvc != nil {
+		baseline = h.syncSvc.Rollouts().Capture(h.syncSvc.EgressTunnelIDs(id)...)
+	}
 
 	if err := h.app.DAO.UpdateNodeGroup(group); err != nil {
 		response.GinInternalError(c, "更新节点组失败", err)
 		return
 	}
 
+	if reverseChanged && h.syncSvc != nil {
+		var err error
+		if baseline != nil {
+			_, err = h.syncSvc.Rollouts().Begin(c.Request.Context(), baseline, models.RolloutKindNodeGroup, id, middleware.GetUserID(c))
+		} else {
+			err = h.syncSvc.OnNodeGroupUpdated(c.Request.Context(), id)
+		}
+		if err != nil {
+			logger.Error("同步节点组隧道规则失败", zap.String("group_id", id), zap.Error(err))
+		}
+	}
+
+	middleware.AuditChange(c, "node_group.update", "node_group:"+id, &previous, group)
 	response.GinSuccessWithMessage(c, "节点组已更新", group)
 }
 
@@ -129,10 +170,12 @@ func (h *NodeGroupHandler) Update(c *gin.Context) {
 func (h *NodeGroupHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 
+	previous, _ := h.app.DAO.GetNodeGroup(id)
 	if err := h.app.DAO.DeleteNodeGroup(id); err != nil {
 		response.GinBadRequest(c, err.Error())
 		return
 	}
 
+	middleware.AuditChange(c, "node_group.delete", "node_group:"+id, previous, nil)
 	response.GinSuccessWithMessage(c, "节点组已删除", nil)
 }
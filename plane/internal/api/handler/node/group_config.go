@@ -135,6 +135,8 @@ func (h *NodeGroupConfigHandler) UpdateNodeGroupConfig(c *gin.Context) {
 	// 构造端口范围字符串
 	portRange := fmt.Sprintf("%d-%d", req.PortRangeStart, req.PortRangeEnd)
 
+	previous, _ := h.app.DAO.GetNodeGroupConfig(groupID)
+
 	// 更新配置
 	config := &models.NodeGroupConfig{}
 	config.ID = uuid.New().String()
@@ -148,6 +150,7 @@ func (h *NodeGroupConfigHandler) UpdateNodeGroupConfig(c *gin.Context) {
 		response.InternalError(c, "Failed to update node group config")
 		return
 	}
+	middleware.AuditChange(c, "node_group.config_update", "node_group:"+groupID, auditGroupConfig(previous), auditGroupConfig(config))
 
 	response.SuccessWithMessage(c, "Node group config updated successfully", gin.H{
 		"group_id":           config.GroupID,
@@ -175,6 +178,8 @@ func (h *NodeGroupConfigHandler) ResetNodeGroupConfig(c *gin.Context) {
 		return
 	}
 
+	previous, _ := h.app.DAO.GetNodeGroupConfig(groupID)
+
 	defaultProtocols, _ := json.Marshal([]string{"tcp", "udp"})
 	config := &models.NodeGroupConfig{}
 	config.ID = uuid.New().String()
@@ -188,6 +193,7 @@ func (h *NodeGroupConfigHandler) ResetNodeGroupConfig(c *gin.Context) {
 		response.InternalError(c, "Failed to reset node group config")
 		return
 	}
+	middleware.AuditChange(c, "node_group.config_reset", "node_group:"+groupID, auditGroupConfig(previous), auditGroupConfig(config))
 
 	response.SuccessWithMessage(c, "Node group config reset successfully", gin.H{
 		"group_id":           config.GroupID,
@@ -198,3 +204,15 @@ func (h *NodeGroupConfigHandler) ResetNodeGroupConfig(c *gin.Context) {
 		"traffic_multiplier": config.TrafficMultiplier,
 	})
 }
+
+// auditGroupConfig 审计日志中记录的节点组配置字段（不含每次写入都会变化的 ID 和时间）
+func auditGroupConfig(cfg *models.NodeGroupConfig) interface{} {
+	if cfg == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"allowed_protocols":  cfg.AllowedProtocols,
+		"port_range":         cfg.PortRange,
+		"traffic_multiplier": cfg.TrafficMultiplier,
+	}
+}
@@ -0,0 +1,173 @@
+package node
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"gkipass/plane/internal/api/middleware"
+	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/types"
+	"gkipass/plane/internal/ws"
+)
+
+const (
+	logStreamHeartbeat      = 15 * time.Second /* SSE 心跳间隔，避免代理断开空闲连接 */
+	logStreamDefaultBacklog = 100
+	logStreamMaxBacklog     = 500
+)
+
+/*
+NodeLogHandler 节点实时日志 API 处理器
+功能：以 Server-Sent Events 推送节点日志；管理员可查看任意节点的全部日志，
+普通用户只能查看自己隧道的日志（必须指定 tunnel_id）
+*/
+type NodeLogHandler struct {
+	app    *types.App
+	hub    *ws.LogStreamHub
+	logger *zap.Logger
+}
+
+/*
+NewNodeLogHandler 创建节点实时日志处理器
+*/
+func NewNodeLogHandler(app *types.App, hub *ws.LogStreamHub) *NodeLogHandler {
+	return &NodeLogHandler{
+		app:    app,
+		hub:    hub,
+		logger: zap.L().Named("node-log-handler"),
+	}
+}
+
+/*
+Stream 实时查看节点日志
+功能：先推送最近 backlog 条日志，之后持续推送新日志直到客户端断开；事件类型：
+  - logs：一批日志（JSON 数组）
+  - dropped：因限速或读取过慢累计丢弃的条数
+  - end：节点拒绝订阅或订阅被关闭
+
+路由：GET /api/v1/nodes/:id/logs/stream?level=&tunnel_id=a,b&backlog=
+*/
+func (h *NodeLogHandler) Stream(c *gin.Context) {
+	nodeID := c.Param("id")
+	userID := middleware.GetUserID(c)
+
+	level := strings.ToLower(c.DefaultQuery("level", "info"))
+	switch level {
+	case "debug", "info", "warn", "error":
+	default:
+		response.GinBadRequest(c, "无效的日志级别: "+level)
+		return
+	}
+
+	var tunnelIDs []string
+	for _, v := range c.QueryArray("tunnel_id") {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				tunnelIDs = append(tunnelIDs, id)
+			}
+		}
+	}
+
+	if !middleware.IsAdmin(c) {
+		if len(tunnelIDs) == 0 {
+			response.GinForbidden(c, "请指定要查看的隧道（tunnel_id）")
+			return
+		}
+		var owned int64
+		if err := h.app.DAO.DB.Model(&models.Tunnel{}).
+			Where("id IN ? AND created_by = ?", tunnelIDs, userID).
+			Count(&owned).Error; err != nil {
+			response.GinInternalError(c, "查询隧道失败", err)
+			return
+		}
+		if int(owned) != len(tunnelIDs) {
+			response.GinForbidden(c, "只能查看自己隧道的日志")
+			return
+		}
+	}
+
+	if node, err := h.app.DAO.GetNode(nodeID); err != nil || node == nil {
+		response.GinNotFound(c, "节点不存在")
+		return
+	}
+
+	backlog, err := strconv.Atoi(c.DefaultQuery("backlog", strconv.Itoa(logStreamDefaultBacklog)))
+	if err != nil || backlog < 0 {
+		backlog = logStreamDefaultBacklog
+	}
+	if backlog > logStreamMaxBacklog {
+		backlog = logStreamMaxBacklog
+	}
+
+	sub, err := h.hub.Subscribe(nodeID, userID, ws.LogStreamFilter{
+		Level:     level,
+		TunnelIDs: tunnelIDs,
+		Backlog:   backlog,
+	})
+	if err != nil {
+		if errors.Is(err, ws.ErrLogStreamNodeLimit) || errors.Is(err, ws.ErrLogStreamUserLimit) {
+			response.GinError(c, http.StatusTooManyRequests, err.Error(), nil)
+			return
+		}
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	defer h.hub.Unsubscribe(sub)
+
+	/* 长连接不受 HTTP 服务器写超时限制 */
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		h.logger.Debug("取消写超时失败", zap.Error(err))
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") /* 关闭 Nginx 缓冲 */
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(logStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	var reportedDropped int64
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+
+		case batch, ok := <-sub.C:
+			if !ok {
+				c.SSEvent("end", gin.H{"reason": "订阅已关闭"})
+				c.Writer.Flush()
+				return
+			}
+			if batch.Error != "" {
+				c.SSEvent("end", gin.H{"reason": batch.Error})
+				c.Writer.Flush()
+				return
+			}
+			c.SSEvent("logs", batch.Entries)
+			if dropped := sub.Dropped(); dropped != reportedDropped {
+				reportedDropped = dropped
+				c.SSEvent("dropped", gin.H{"dropped": dropped})
+			}
+			c.Writer.Flush()
+
+		case <-heartbeat.C:
+			if dropped := sub.Dropped(); dropped != reportedDropped {
+				reportedDropped = dropped
+				c.SSEvent("dropped", gin.H{"dropped": dropped})
+			}
+			if _, err := c.Writer.WriteString(": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package security
+
+import (
+	"gkipass/plane/internal/api/middleware"
+	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/service"
+	"gkipass/plane/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+/*
+APITokenHandler 用户个人 API 令牌处理器
+功能：创建、列出、吊销 API 令牌；这些接口只接受登录 JWT，API 令牌不能管理令牌
+*/
+type APITokenHandler struct {
+	tokens *service.APITokenService
+	logger *zap.Logger
+}
+
+/*
+NewAPITokenHandler 创建 API 令牌处理器
+*/
+func NewAPITokenHandler(app *types.App) *APITokenHandler {
+	return &APITokenHandler{
+		tokens: service.NewAPITokenService(app.DB.GormDB),
+		logger: zap.L().Named("api-token-handler"),
+	}
+}
+
+/*
+Scopes 可授予的权限范围
+路由：GET /api/v1/users/api-tokens/scopes
+*/
+func (h *APITokenHandler) Scopes(c *gin.Context) {
+	response.GinSuccess(c, service.APITokenScopes)
+}
+
+/*
+List 当前用户的 API 令牌
+路由：GET /api/v1/users/api-tokens
+*/
+func (h *APITokenHandler) List(c *gin.Context) {
+	tokens, err := h.tokens.List(middleware.GetUserID(c))
+	if err != nil {
+		response.GinInternalError(c, "查询 API 令牌失败", err)
+		return
+	}
+	response.GinSuccess(c, tokens)
+}
+
+/*
+Create 创建 API 令牌，明文只在本次响应中返回
+路由：POST /api/v1/users/api-tokens/create
+*/
+func (h *APITokenHandler) Create(c *gin.Context) {
+	var req service.CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
+	userID := middleware.GetUserID(c)
+	raw, info, err := h.tokens.Create(userID, &req)
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	h.logger.Info("创建 API 令牌",
+		zap.String("userID", userID),
+		zap.String("tokenID", info.ID),
+		zap.Strings("scopes", info.Scopes))
+	middleware.AuditChange(c, "user.api_token_create", "api_token:"+info.ID, nil, gin.H{
+		"name":        info.Name,
+		"prefix":      info.Prefix,
+		"scopes":      info.Scopes,
+		"allowed_ips": info.AllowedIPs,
+		"expires_at":  info.ExpiresAt,
+	})
+	response.GinSuccessWithMessage(c, "API 令牌已创建，请立即保存，之后无法再次查看", gin.H{
+		"token": raw,
+		"info":  info,
+	})
+}
+
+/*
+Revoke 吊销 API 令牌
+路由：POST /api/v1/users/api-tokens/:id/revoke
+*/
+func (h *APITokenHandler) Revoke(c *gin.Context) {
+	info, err := h.tokens.Revoke(middleware.GetUserID(c), c.Param("id"))
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	middleware.AuditChange(c, "user.api_token_revoke", "api_token:"+info.ID,
+		gin.H{"name": info.Name, "revoked": false},
+		gin.H{"name": info.Name, "revoked": true})
+	response.GinSuccessWithMessage(c, "API 令牌已吊销", nil)
+}
@@ -1,14 +1,19 @@
 package security
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"gkipass/plane/internal/api/middleware"
 	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/db/models"
 	"gkipass/plane/internal/service"
 	"gkipass/plane/internal/types"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 )
 
@@ -17,9 +22,11 @@ AuthHandler 认证处理器
 功能：处理用户登录、登出和令牌刷新
 */
 type AuthHandler struct {
-	app     *types.App
-	userSvc *service.GormUserService
-	logger  *zap.Logger
+	app      *types.App
+	userSvc  *service.GormUserService
+	mfa      *service.MFAService
+	sessions *service.SessionService
+	logger   *zap.Logger
 }
 
 /*
@@ -27,9 +34,11 @@ NewAuthHandler 创建认证处理器
 */
 func NewAuthHandler(app *types.App) *AuthHandler {
 	return &AuthHandler{
-		app:     app,
-		userSvc: service.NewGormUserService(app.DB.GormDB),
-		logger:  zap.L().Named("auth-handler"),
+		app:      app,
+		userSvc:  service.NewGormUserService(app.DB.GormDB),
+		mfa:      service.NewMFAService(app.DB.GormDB, app.Config.Auth.MFA),
+		sessions: service.NewSessionService(app.DB.GormDB, app.Config.Auth.RefreshDays),
+		logger:   zap.L().Named("auth-handler"),
 	}
 }
 
@@ -45,6 +54,9 @@ type LoginRequest struct {
 
 /*
 LoginResponse 登录响应
+功能：需要第二因素时不签发 Token，MFARequired 或 MFAEnrollRequired 为 true，
+前端凭 MFAToken 调用 /auth/mfa/* 完成验证（或绑定）后获得正式令牌；
+RefreshToken 用于 /auth/refresh 换取新令牌，每次刷新后旧的刷新令牌作废
 */
 type LoginResponse struct {
 	Token     string `json:"token"`
@@ -52,11 +64,95 @@ type LoginResponse struct {
 	Username  string `json:"username"`
 	Role      string `json:"role"`
 	ExpiresAt int64  `json:"expires_at"`
+
+	SessionID        string `json:"session_id,omitempty"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	RefreshExpiresAt int64  `json:"refresh_expires_at,omitempty"`
+
+	MFARequired       bool     `json:"mfa_required,omitempty"`
+	MFAEnrollRequired bool     `json:"mfa_enroll_required,omitempty"`
+	MFAToken          string   `json:"mfa_token,omitempty"`
+	MFAMethods        []string `json:"mfa_methods,omitempty"`
+}
+
+/*
+issueLogin 为已通过全部认证步骤的用户创建登录会话并签发 JWT 和刷新令牌
+功能：会话记录登录时的 IP 和 User-Agent，供用户在会话列表中辨认设备
+*/
+func issueLogin(c *gin.Context, app *types.App, user *models.User) (*LoginResponse, error) {
+	sessions := service.NewSessionService(app.DB.GormDB, app.Config.Auth.RefreshDays)
+	tokens, err := sessions.Create(user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return nil, err
+	}
+	return issueSessionToken(app, user, tokens)
+}
+
+/* issueSessionToken 为会话签发访问令牌 */
+func issueSessionToken(app *types.App, user *models.User, tokens *service.SessionTokens) (*LoginResponse, error) {
+	token, err := middleware.GenerateJWT(
+		user.ID,
+		user.Username,
+		string(user.Role),
+		tokens.SessionID,
+		app.Config.Auth.JWTSecret,
+		app.Config.Auth.JWTExpiration,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(time.Duration(app.Config.Auth.JWTExpiration) * time.Hour)
+	return &LoginResponse{
+		Token:            token,
+		UserID:           user.ID,
+		Username:         user.Username,
+		Role:             string(user.Role),
+		ExpiresAt:        expiresAt.Unix(),
+		SessionID:        tokens.SessionID,
+		RefreshToken:     tokens.RefreshToken,
+		RefreshExpiresAt: tokens.RefreshExpiresAt.Unix(),
+	}, nil
+}
+
+/*
+secondFactorLogin 第一因素（密码或 OAuth）通过后检查第二因素
+功能：已启用第二因素时返回待验证响应；安全设置要求管理员启用而尚未启用时返回待绑定响应；
+两者都不需要时返回 nil，由调用方直接签发令牌
+*/
+func secondFactorLogin(app *types.App, mfa *service.MFAService, user *models.User) (*LoginResponse, error) {
+	methods, err := mfa.Methods(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	purpose := mfaPurposeLogin
+	if len(methods) == 0 {
+		if user.Role != models.RoleAdmin || !mfa.AdminMFARequired() {
+			return nil, nil
+		}
+		purpose = mfaPurposeEnroll
+	}
+
+	token, expiresAt, err := issueMFAToken(app.Config.Auth.JWTSecret, user.ID, purpose, "")
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResponse{
+		UserID:            user.ID,
+		Username:          user.Username,
+		Role:              string(user.Role),
+		ExpiresAt:         expiresAt,
+		MFARequired:       purpose == mfaPurposeLogin,
+		MFAEnrollRequired: purpose == mfaPurposeEnroll,
+		MFAToken:          token,
+		MFAMethods:        methods,
+	}, nil
 }
 
 /*
 Login 用户登录
-功能：验证码校验 → 凭据认证 → 生成JWT → 返回令牌
+功能：验证码校验 → 凭据认证 → 需要第二因素时返回待验证令牌，否则生成JWT → 返回令牌
 路由：POST /api/v1/auth/login
 */
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -95,94 +191,109 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	/* 两步验证 */
+	pending, err := secondFactorLogin(h.app, h.mfa, user)
+	if err != nil {
+		h.logger.Error("检查两步验证状态失败", zap.String("userID", user.ID), zap.Error(err))
+		response.GinInternalError(c, "登录失败", err)
+		return
+	}
+	if pending != nil {
+		response.GinSuccess(c, pending)
+		return
+	}
+
 	/* 生成 JWT 令牌（last_login 已在 Authenticate 内部更新） */
-	token, err := middleware.GenerateJWT(
-		user.ID,
-		user.Username,
-		string(user.Role),
-		h.app.Config.Auth.JWTSecret,
-		h.app.Config.Auth.JWTExpiration,
-	)
+	resp, err := issueLogin(c, h.app, user)
 	if err != nil {
 		h.logger.Error("生成令牌失败", zap.Error(err))
 		response.GinInternalError(c, "生成令牌失败", err)
 		return
 	}
 
-	expiresAt := time.Now().Add(time.Duration(h.app.Config.Auth.JWTExpiration) * time.Hour)
-
-	response.GinSuccess(c, LoginResponse{
-		Token:     token,
-		UserID:    user.ID,
-		Username:  user.Username,
-		Role:      string(user.Role),
-		ExpiresAt: expiresAt.Unix(),
-	})
+	response.GinSuccess(c, resp)
 }
 
 /*
 Logout 用户登出
-功能：清除 Redis 中的会话缓存（如果启用）
+功能：吊销当前令牌所属的会话（令牌已过期也可登出），会话吊销后访问令牌和刷新令牌都失效
 路由：POST /api/v1/auth/logout
 */
 func (h *AuthHandler) Logout(c *gin.Context) {
-	if h.app.DB.HasCache() {
-		authHeader := c.GetHeader("Authorization")
-		if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-			token := authHeader[7:]
-			_ = h.app.DB.Cache.Redis.DeleteSession(token)
+	authHeader := c.GetHeader("Authorization")
+	if tokenStr, ok := strings.CutPrefix(authHeader, "Bearer "); ok {
+		if userID, sessionID, err := h.parseSessionToken(tokenStr); err == nil && sessionID != "" {
+			_ = h.sessions.Revoke(userID, sessionID, service.SessionRevokeLogout)
 		}
 	}
 
 	response.GinSuccessWithMessage(c, "已成功登出", nil)
 }
 
+/* parseSessionToken 校验 JWT 签名并取出用户和会话 ID，不校验有效期 */
+func (h *AuthHandler) parseSessionToken(tokenStr string) (string, string, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("不支持的签名方法: %v", t.Header["alg"])
+		}
+		return []byte(h.app.Config.Auth.JWTSecret), nil
+	}, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return "", "", err
+	}
+	userID, _ := claims["user_id"].(string)
+	sessionID, _ := claims["sid"].(string)
+	return userID, sessionID, nil
+}
+
+/*
+RefreshTokenRequest 刷新令牌请求
+*/
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required,max=128"`
+}
+
 /*
 RefreshToken 刷新JWT令牌
-功能：验证当前令牌有效性 → 生成新令牌（延长有效期）
+功能：校验刷新令牌 → 轮换刷新令牌（已轮换的令牌再次使用时吊销整个会话）→ 按用户当前角色签发新令牌
 路由：POST /api/v1/auth/refresh
 */
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
-	userIDStr := middleware.GetUserID(c)
-	usernameStr := middleware.GetUsername(c)
-	roleStr := middleware.GetRole(c)
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
 
-	if userIDStr == "" {
-		response.GinUnauthorized(c, "无效的会话")
+	session, tokens, err := h.sessions.Refresh(req.RefreshToken, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, service.ErrSessionRefreshReuse) {
+			h.logger.Warn("刷新令牌重放",
+				zap.String("client_ip", c.ClientIP()),
+				zap.String("user_agent", c.Request.UserAgent()))
+		}
+		response.GinUnauthorized(c, err.Error())
 		return
 	}
 
 	/* 确认用户仍然有效 */
-	user, err := h.userSvc.GetUser(userIDStr)
+	user, err := h.userSvc.GetUser(session.UserID)
 	if err != nil {
+		_ = h.sessions.Revoke(session.UserID, session.ID, service.SessionRevokeUserDeleted)
 		response.GinUnauthorized(c, "用户不存在")
 		return
 	}
 	if !user.Enabled {
+		_ = h.sessions.Revoke(user.ID, session.ID, service.SessionRevokeUserDisabled)
 		response.GinForbidden(c, "账户已被禁用")
 		return
 	}
 
-	/* 生成新令牌 */
-	token, err := middleware.GenerateJWT(
-		userIDStr,
-		usernameStr,
-		roleStr,
-		h.app.Config.Auth.JWTSecret,
-		h.app.Config.Auth.JWTExpiration,
-	)
+	resp, err := issueSessionToken(h.app, user, tokens)
 	if err != nil {
 		response.GinInternalError(c, "生成令牌失败", err)
 		return
 	}
-
-	expiresAt := time.Now().Add(time.Duration(h.app.Config.Auth.JWTExpiration) * time.Hour)
-
-	response.GinSuccess(c, LoginResponse{
-		Token:     token,
-		UserID:    userIDStr,
-		Username:  usernameStr,
-		Role:      roleStr,
-		ExpiresAt: expiresAt.Unix(),
-	})
+	response.GinSuccess(c, resp)
 }
@@ -0,0 +1,608 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"gkipass/plane/internal/api/middleware"
+	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/pkg/webauthn"
+	"gkipass/plane/internal/service"
+	"gkipass/plane/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+/* 两步验证临时令牌 */
+const (
+	mfaTokenType = "mfa_pending"
+	mfaTokenTTL  = 5 * time.Minute
+
+	mfaPurposeLogin    = "login"    /* 密码已通过，等待第二因素 */
+	mfaPurposeEnroll   = "enroll"   /* 密码已通过，管理员必须先绑定第二因素 */
+	mfaPurposeRegister = "register" /* 已登录用户注册 WebAuthn 凭据的挑战 */
+)
+
+/*
+mfaClaims 两步验证临时令牌内容
+功能：ChallengeID 指向服务端保存的 WebAuthn 挑战，完成时删除，同一挑战只能使用一次
+*/
+type mfaClaims struct {
+	Type        string `json:"typ"`
+	UserID      string `json:"user_id"`
+	Purpose     string `json:"purpose"`
+	ChallengeID string `json:"challenge_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+/*
+mfaTokenKey 临时令牌签名密钥
+功能：由 JWT 密钥派生，临时令牌无法通过 JWTAuth 校验，不能当作登录令牌使用
+*/
+func mfaTokenKey(jwtSecret string) []byte {
+	mac := hmac.New(sha256.New, []byte(jwtSecret))
+	mac.Write([]byte(mfaTokenType))
+	return mac.Sum(nil)
+}
+
+/* issueMFAToken 签发 5 分钟有效的临时令牌，返回令牌和过期时间（Unix 秒） */
+func issueMFAToken(jwtSecret, userID, purpose, challengeID string) (string, int64, error) {
+	now := time.Now()
+	expiresAt := now.Add(mfaTokenTTL)
+	claims := mfaClaims{
+		Type:        mfaTokenType,
+		UserID:      userID,
+		Purpose:     purpose,
+		ChallengeID: challengeID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(mfaTokenKey(jwtSecret))
+	if err != nil {
+		return "", 0, fmt.Errorf("签名两步验证令牌失败: %w", err)
+	}
+	return signed, expiresAt.Unix(), nil
+}
+
+/* parseMFAToken 校验临时令牌签名、有效期和用途 */
+func parseMFAToken(jwtSecret, token, purpose string) (*mfaClaims, error) {
+	claims := &mfaClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return mfaTokenKey(jwtSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !parsed.Valid {
+		return nil, errors.New("两步验证令牌无效或已过期，请重新登录")
+	}
+	if claims.Type != mfaTokenType || claims.Purpose != purpose || claims.UserID == "" {
+		return nil, errors.New("两步验证令牌用途不符")
+	}
+	return claims, nil
+}
+
+/*
+MFAHandler 两步验证处理器
+功能：登录第二步（TOTP、恢复码、WebAuthn）、管理员强制绑定，
+以及已登录用户管理自己的 TOTP、恢复码和 WebAuthn 凭据
+*/
+type MFAHandler struct {
+	app     *types.App
+	mfa     *service.MFAService
+	userSvc *service.GormUserService
+	logger  *zap.Logger
+}
+
+/*
+NewMFAHandler 创建两步验证处理器
+*/
+func NewMFAHandler(app *types.App) *MFAHandler {
+	mfa := service.NewMFAService(app.DB.GormDB, app.Config.Auth.MFA)
+	mfa.SetRedis(app.DB.RedisClient())
+	return &MFAHandler{
+		app:     app,
+		mfa:     mfa,
+		userSvc: service.NewGormUserService(app.DB.GormDB),
+		logger:  zap.L().Named("mfa-handler"),
+	}
+}
+
+/*
+MFAVerifyRequest 登录第二步请求（TOTP 或恢复码）
+*/
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Method   string `json:"method" binding:"required,oneof=totp recovery"`
+	Code     string `json:"code" binding:"required,max=32"`
+}
+
+/*
+MFATokenRequest 只携带临时令牌的请求
+*/
+type MFATokenRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+/*
+WebAuthnAssertion 前端 navigator.credentials.get 的结果，二进制字段为 base64url
+*/
+type WebAuthnAssertion struct {
+	ID                string `json:"id" binding:"required,max=1024"`
+	ClientDataJSON    string `json:"client_data_json" binding:"required"`
+	AuthenticatorData string `json:"authenticator_data" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+}
+
+/*
+MFAWebAuthnFinishRequest WebAuthn 登录完成请求
+*/
+type MFAWebAuthnFinishRequest struct {
+	MFAToken   string            `json:"mfa_token" binding:"required"`
+	Credential WebAuthnAssertion `json:"credential" binding:"required"`
+}
+
+/*
+MFACodeRequest 携带验证码的请求
+*/
+type MFACodeRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code" binding:"required,max=32"`
+}
+
+/*
+WebAuthnRegisterFinishRequest WebAuthn 注册完成请求
+功能：State 为注册开始时返回的令牌，Credential 为 navigator.credentials.create 的结果（base64url）
+*/
+type WebAuthnRegisterFinishRequest struct {
+	State      string `json:"state" binding:"required"`
+	Name       string `json:"name" binding:"max=64"`
+	Credential struct {
+		ClientDataJSON    string `json:"client_data_json" binding:"required"`
+		AttestationObject string `json:"attestation_object" binding:"required"`
+	} `json:"credential" binding:"required"`
+}
+
+/*
+MFAEnrollResponse 启用第二因素的响应，RecoveryCodes 只在本次返回
+*/
+type MFAEnrollResponse struct {
+	*LoginResponse
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+/* pendingUser 校验临时令牌并返回仍然有效的用户 */
+func (h *MFAHandler) pendingUser(c *gin.Context, token, purpose string) (*mfaClaims, *models.User, bool) {
+	claims, err := parseMFAToken(h.app.Config.Auth.JWTSecret, token, purpose)
+	if err != nil {
+		response.GinUnauthorized(c, err.Error())
+		return nil, nil, false
+	}
+	user, err := h.userSvc.GetUser(claims.UserID)
+	if err != nil || !user.Enabled {
+		response.GinUnauthorized(c, "账户不存在或已被禁用")
+		return nil, nil, false
+	}
+	return claims, user, true
+}
+
+/* currentUser 返回当前登录用户 */
+func (h *MFAHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	user, err := h.userSvc.GetUser(middleware.GetUserID(c))
+	if err != nil {
+		response.GinUnauthorized(c, "用户不存在")
+		return nil, false
+	}
+	return user, true
+}
+
+/* relyingParty 按配置确定 WebAuthn 依赖方，请求来源不在允许列表中时拒绝 */
+func (h *MFAHandler) relyingParty(c *gin.Context) (*webauthn.RelyingParty, bool) {
+	rp, err := h.mfa.RelyingParty(c.GetHeader("Origin"))
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return nil, false
+	}
+	return rp, true
+}
+
+/* verifyFailed 第二因素校验失败的统一响应 */
+func (h *MFAHandler) verifyFailed(c *gin.Context, userID string, err error) {
+	h.logger.Warn("两步验证失败",
+		zap.String("userID", userID),
+		zap.String("client_ip", c.ClientIP()),
+		zap.Error(err))
+	if errors.Is(err, service.ErrMFALocked) || errors.Is(err, service.ErrMFAInvalidCode) {
+		response.GinUnauthorized(c, err.Error())
+		return
+	}
+	response.GinBadRequest(c, err.Error())
+}
+
+/* completeLogin 第二因素通过后签发正式令牌 */
+func (h *MFAHandler) completeLogin(c *gin.Context, user *models.User, recoveryCodes []string) {
+	resp, err := issueLogin(c, h.app, user)
+	if err != nil {
+		response.GinInternalError(c, "生成令牌失败", err)
+		return
+	}
+	h.userSvc.UpdateLastLogin(user.ID)
+	if recoveryCodes == nil {
+		response.GinSuccess(c, resp)
+		return
+	}
+	response.GinSuccess(c, MFAEnrollResponse{LoginResponse: resp, RecoveryCodes: recoveryCodes})
+}
+
+/* keepsLastRequiredFactor 安全设置要求管理员启用两步验证时，不允许移除最后一个第二因素 */
+func (h *MFAHandler) keepsLastRequiredFactor(user *models.User) bool {
+	if user.Role != models.RoleAdmin || !h.mfa.AdminMFARequired() {
+		return false
+	}
+	status, err := h.mfa.Status(user.ID)
+	if err != nil {
+		return true
+	}
+	factors := len(status.WebAuthnCredentials)
+	if status.TOTPEnabled {
+		factors++
+	}
+	return factors <= 1
+}
+
+/* ==================== 登录第二步（公开，凭临时令牌） ==================== */
+
+/*
+Verify 使用 TOTP 验证码或恢复码完成登录
+路由：POST /api/v1/auth/mfa/verify
+*/
+func (h *MFAHandler) Verify(c *gin.Context) {
+	var req MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
+	_, user, ok := h.pendingUser(c, req.MFAToken, mfaPurposeLogin)
+	if !ok {
+		return
+	}
+	if err := h.mfa.Verify(user.ID, req.Method, req.Code); err != nil {
+		h.verifyFailed(c, user.ID, err)
+		return
+	}
+	h.completeLogin(c, user, nil)
+}
+
+/*
+WebAuthnLoginBegin 生成 WebAuthn 登录挑战，返回认证选项和携带挑战的新临时令牌
+路由：POST /api/v1/auth/mfa/webauthn/begin
+*/
+func (h *MFAHandler) WebAuthnLoginBegin(c *gin.Context) {
+	var req MFATokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
+	_, user, ok := h.pendingUser(c, req.MFAToken, mfaPurposeLogin)
+	if !ok {
+		return
+	}
+	rp, ok := h.relyingParty(c)
+	if !ok {
+		return
+	}
+	options, challengeID, err := h.mfa.BeginWebAuthnLogin(c.Request.Context(), rp, user.ID)
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	token, _, err := issueMFAToken(h.app.Config.Auth.JWTSecret, user.ID, mfaPurposeLogin, challengeID)
+	if err != nil {
+		response.GinInternalError(c, "生成两步验证令牌失败", err)
+		return
+	}
+	response.GinSuccess(c, gin.H{"options": options, "mfa_token": token})
+}
+
+/*
+WebAuthnLoginFinish 校验 WebAuthn 认证结果并完成登录
+路由：POST /api/v1/auth/mfa/webauthn/finish
+*/
+func (h *MFAHandler) WebAuthnLoginFinish(c *gin.Context) {
+	var req MFAWebAuthnFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
+	claims, user, ok := h.pendingUser(c, req.MFAToken, mfaPurposeLogin)
+	if !ok {
+		return
+	}
+	if claims.ChallengeID == "" {
+		response.GinBadRequest(c, "请先获取 WebAuthn 挑战")
+		return
+	}
+	rp, ok := h.relyingParty(c)
+	if !ok {
+		return
+	}
+
+	clientData, err1 := webauthn.DecodeBase64URL(req.Credential.ClientDataJSON)
+	authData, err2 := webauthn.DecodeBase64URL(req.Credential.AuthenticatorData)
+	signature, err3 := webauthn.DecodeBase64URL(req.Credential.Signature)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		response.GinBadRequest(c, "WebAuthn 数据编码无效", err)
+		return
+	}
+
+	if err := h.mfa.FinishWebAuthnLogin(c.Request.Context(), rp, user.ID, claims.ChallengeID, req.Credential.ID, clientData, authData, signature); err != nil {
+		h.verifyFailed(c, user.ID, err)
+		return
+	}
+	h.completeLogin(c, user, nil)
+}
+
+/*
+EnrollTOTP 管理员被要求启用两步验证时，凭临时令牌生成 TOTP 密钥
+路由：POST /api/v1/auth/mfa/enroll/totp
+*/
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	var req MFATokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
+	_, user, ok := h.pendingUser(c, req.MFAToken, mfaPurposeEnroll)
+	if !ok {
+		return
+	}
+	secret, uri, err := h.mfa.SetupTOTP(user)
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	response.GinSuccess(c, gin.H{"secret": secret, "otpauth_uri": uri})
+}
+
+/*
+EnrollTOTPConfirm 确认绑定 TOTP 并完成登录，返回恢复码和正式令牌
+路由：POST /api/v1/auth/mfa/enroll/totp/confirm
+*/
+func (h *MFAHandler) EnrollTOTPConfirm(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
+	_, user, ok := h.pendingUser(c, req.MFAToken, mfaPurposeEnroll)
+	if !ok {
+		return
+	}
+	codes, err := h.mfa.ConfirmTOTP(user.ID, req.Code)
+	if err != nil {
+		h.verifyFailed(c, user.ID, err)
+		return
+	}
+
+	/* 公开路由没有 JWT，审计中间件从这里取操作人 */
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	middleware.AuditChange(c, "user.mfa_enable", "user:"+user.ID, nil, gin.H{"method": service.MFAMethodTOTP})
+	h.completeLogin(c, user, codes)
+}
+
+/* ==================== 已登录用户管理 ==================== */
+
+/*
+Status 查询当前用户的两步验证状态
+路由：GET /api/v1/users/mfa
+*/
+func (h *MFAHandler) Status(c *gin.Context) {
+	status, err := h.mfa.Status(middleware.GetUserID(c))
+	if err != nil {
+		response.GinInternalError(c, "查询两步验证状态失败", err)
+		return
+	}
+	response.GinSuccess(c, status)
+}
+
+/*
+SetupTOTP 生成 TOTP 密钥（确认前不生效）
+路由：POST /api/v1/users/mfa/totp/setup
+*/
+func (h *MFAHandler) SetupTOTP(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	secret, uri, err := h.mfa.SetupTOTP(user)
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	response.GinSuccess(c, gin.H{"secret": secret, "otpauth_uri": uri})
+}
+
+/*
+ConfirmTOTP 用验证码确认并启用 TOTP，首次启用第二因素时返回恢复码
+路由：POST /api/v1/users/mfa/totp/confirm
+*/
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
+	userID := middleware.GetUserID(c)
+	codes, err := h.mfa.ConfirmTOTP(userID, req.Code)
+	if err != nil {
+		h.verifyFailed(c, userID, err)
+		return
+	}
+	middleware.AuditChange(c, "user.mfa_enable", "user:"+userID, nil, gin.H{"method": service.MFAMethodTOTP})
+	response.GinSuccessWithMessage(c, "已启用 TOTP 两步验证", gin.H{"recovery_codes": codes})
+}
+
+/*
+DisableTOTP 校验当前验证码后关闭 TOTP
+路由：POST /api/v1/users/mfa/totp/disable
+*/
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled && h.keepsLastRequiredFactor(user) {
+		response.GinForbidden(c, "管理员必须保留至少一种两步验证方式")
+		return
+	}
+	if err := h.mfa.DisableTOTP(user.ID, req.Code); err != nil {
+		h.verifyFailed(c, user.ID, err)
+		return
+	}
+	middleware.AuditChange(c, "user.mfa_disable", "user:"+user.ID, gin.H{"method": service.MFAMethodTOTP}, nil)
+	response.GinSuccessWithMessage(c, "已关闭 TOTP 两步验证", nil)
+}
+
+/*
+RegenerateRecoveryCodes 重新生成恢复码，旧码全部作废
+路由：POST /api/v1/users/mfa/recovery-codes/regenerate
+*/
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	codes, err := h.mfa.RegenerateRecoveryCodes(userID)
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	middleware.AuditChange(c, "user.mfa_recovery_regenerate", "user:"+userID, nil, nil)
+	response.GinSuccess(c, gin.H{"recovery_codes": codes})
+}
+
+/*
+WebAuthnRegisterBegin 生成 WebAuthn 注册选项，返回选项和携带挑战的状态令牌
+路由：POST /api/v1/users/mfa/webauthn/register/begin
+*/
+func (h *MFAHandler) WebAuthnRegisterBegin(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	rp, ok := h.relyingParty(c)
+	if !ok {
+		return
+	}
+	options, challengeID, err := h.mfa.BeginWebAuthnRegistration(c.Request.Context(), rp, user)
+	if err != nil {
+		response.GinInternalError(c, "生成 WebAuthn 注册选项失败", err)
+		return
+	}
+	state, _, err := issueMFAToken(h.app.Config.Auth.JWTSecret, user.ID, mfaPurposeRegister, challengeID)
+	if err != nil {
+		response.GinInternalError(c, "生成状态令牌失败", err)
+		return
+	}
+	response.GinSuccess(c, gin.H{"options": options, "state": state})
+}
+
+/*
+WebAuthnRegisterFinish 校验注册结果并保存凭据，首次启用第二因素时返回恢复码
+路由：POST /api/v1/users/mfa/webauthn/register/finish
+*/
+func (h *MFAHandler) WebAuthnRegisterFinish(c *gin.Context) {
+	var req WebAuthnRegisterFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
+	userID := middleware.GetUserID(c)
+	claims, err := parseMFAToken(h.app.Config.Auth.JWTSecret, req.State, mfaPurposeRegister)
+	if err != nil || claims.UserID != userID || claims.ChallengeID == "" {
+		response.GinBadRequest(c, "注册状态无效或已过期，请重试")
+		return
+	}
+	rp, ok := h.relyingParty(c)
+	if !ok {
+		return
+	}
+
+	clientData, err1 := webauthn.DecodeBase64URL(req.Credential.ClientDataJSON)
+	attestation, err2 := webauthn.DecodeBase64URL(req.Credential.AttestationObject)
+	if err := errors.Join(err1, err2); err != nil {
+		response.GinBadRequest(c, "WebAuthn 数据编码无效", err)
+		return
+	}
+
+	cred, codes, err := h.mfa.FinishWebAuthnRegistration(c.Request.Context(), rp, userID, req.Name, claims.ChallengeID, clientData, attestation)
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	middleware.AuditChange(c, "user.mfa_enable", "user:"+userID, nil, gin.H{
+		"method":      service.MFAMethodWebAuthn,
+		"webauthn_id": cred.ID,
+		"name":        cred.Name,
+	})
+	response.GinSuccess(c, gin.H{"credential": cred, "recovery_codes": codes})
+}
+
+/*
+DeleteWebAuthnCredential 删除当前用户的 WebAuthn 凭据
+路由：POST /api/v1/users/mfa/webauthn/credentials/:id/delete
+*/
+func (h *MFAHandler) DeleteWebAuthnCredential(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if h.keepsLastRequiredFactor(user) {
+		response.GinForbidden(c, "管理员必须保留至少一种两步验证方式")
+		return
+	}
+	cred, err := h.mfa.DeleteWebAuthnCredential(user.ID, c.Param("id"))
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	middleware.AuditChange(c, "user.mfa_disable", "user:"+user.ID, gin.H{
+		"method":      service.MFAMethodWebAuthn,
+		"webauthn_id": cred.ID,
+		"name":        cred.Name,
+	}, nil)
+	response.GinSuccessWithMessage(c, "已删除 WebAuthn 凭据", nil)
+}
+
+/*
+Reset 管理员清除指定用户的全部第二因素（用户丢失验证器时使用）
+路由：POST /api/v1/users/:id/mfa/reset
+*/
+func (h *MFAHandler) Reset(c *gin.Context) {
+	targetID := c.Param("id")
+	before, err := h.mfa.Status(targetID)
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	if err := h.mfa.Reset(targetID); err != nil {
+		response.GinInternalError(c, "重置两步验证失败", err)
+		return
+	}
+	middleware.AuditChange(c, "user.mfa_reset", "user:"+targetID, gin.H{
+		"totp_enabled":   before.TOTPEnabled,
+		"webauthn_count": len(before.WebAuthnCredentials),
+	}, gin.H{
+		"totp_enabled":   false,
+		"webauthn_count": 0,
+	})
+	response.GinSuccessWithMessage(c, "已重置两步验证", nil)
+}
@@ -10,8 +10,8 @@ import (
 	"time"
 
 	"gkipass/plane/internal/db/models"
-	"gkipass/plane/internal/api/middleware"
 	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/service"
 	"gkipass/plane/internal/types"
 	"gkipass/plane/internal/pkg/logger"
 
@@ -26,12 +26,14 @@ import (
 type OAuthHandler struct {
 	app          *types.App
 	githubConfig *oauth2.Config
+	mfa          *service.MFAService
 }
 
 // NewOAuthHandler 创建OAuth处理器
 func NewOAuthHandler(app *types.App) *OAuthHandler {
 	handler := &OAuthHandler{
 		app: app,
+		mfa: service.NewMFAService(app.DB.GormDB, app.Config.Auth.MFA),
 	}
 
 	// 初始化GitHub OAuth配置
@@ -190,30 +192,35 @@ func (h *OAuthHandler) GitHubCallback(c *gin.Context) {
 		}
 	}
 
+	// 已启用两步验证（或管理员被要求启用）时先完成第二步
+	pending, err := secondFactorLogin(h.app, h.mfa, user)
+	if err != nil {
+		response.InternalError(c, "Failed to check two-factor status")
+		return
+	}
+	if pending != nil {
+		response.GinSuccess(c, pending)
+		return
+	}
+
 	_ = h.app.DAO.UpdateUserLastLogin(user.ID)
 
-	// 生成JWT token
-	jwtToken, err := middleware.GenerateJWT(
-		user.ID,
-		user.Username,
-		string(user.Role),
-		h.app.Config.Auth.JWTSecret,
-		h.app.Config.Auth.JWTExpiration,
-	)
+	// 创建登录会话并生成JWT token
+	login, err := issueLogin(c, h.app, user)
 	if err != nil {
 		response.InternalError(c, "Failed to generate token")
 		return
 	}
 
-	// 计算过期时间
-	expiresAt := time.Now().Add(time.Duration(h.app.Config.Auth.JWTExpiration) * time.Hour)
-
 	response.GinSuccess(c, gin.H{
-		"token":      jwtToken,
-		"user_id":    user.ID,
-		"username":   user.Username,
-		"avatar":     user.Avatar,
-		"role":       user.Role,
-		"expires_at": expiresAt.Unix(),
+		"token":              login.Token,
+		"user_id":            user.ID,
+		"username":           user.Username,
+		"avatar":             user.Avatar,
+		"role":               user.Role,
+		"expires_at":         login.ExpiresAt,
+		"session_id":         login.SessionID,
+		"refresh_token":      login.RefreshToken,
+		"refresh_expires_at": login.RefreshExpiresAt,
 	})
 }
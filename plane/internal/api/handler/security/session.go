@@ -0,0 +1,123 @@
+package security
+
+import (
+	"gkipass/plane/internal/api/middleware"
+	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/service"
+	"gkipass/plane/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+/*
+SessionHandler 登录会话处理器
+功能：用户查看和吊销自己的登录会话；管理员查看用户会话、强制用户下线
+*/
+type SessionHandler struct {
+	sessions *service.SessionService
+	logger   *zap.Logger
+}
+
+/*
+NewSessionHandler 创建会话处理器
+*/
+func NewSessionHandler(app *types.App) *SessionHandler {
+	return &SessionHandler{
+		sessions: service.NewSessionService(app.DB.GormDB, app.Config.Auth.RefreshDays),
+		logger:   zap.L().Named("session-handler"),
+	}
+}
+
+/*
+SessionInfo 会话列表项，Current 表示发起请求的会话
+*/
+type SessionInfo struct {
+	models.UserSession
+	Current bool `json:"current"`
+}
+
+func (h *SessionHandler) list(c *gin.Context, userID string) {
+	sessions, err := h.sessions.List(userID)
+	if err != nil {
+		response.GinInternalError(c, "查询会话失败", err)
+		return
+	}
+	current := middleware.GetSessionID(c)
+	list := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		list = append(list, SessionInfo{UserSession: s, Current: s.ID == current})
+	}
+	response.GinSuccess(c, list)
+}
+
+/*
+List 当前用户的有效会话（设备、登录 IP、最近活动）
+路由：GET /api/v1/users/sessions
+*/
+func (h *SessionHandler) List(c *gin.Context) {
+	h.list(c, middleware.GetUserID(c))
+}
+
+/*
+Revoke 吊销当前用户的指定会话
+路由：POST /api/v1/users/sessions/:id/revoke
+*/
+func (h *SessionHandler) Revoke(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	sessionID := c.Param("id")
+	if err := h.sessions.Revoke(userID, sessionID, service.SessionRevokeUser); err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	middleware.AuditChange(c, "user.session_revoke", "user:"+userID, gin.H{"session_id": sessionID}, nil)
+	response.GinSuccessWithMessage(c, "会话已吊销", nil)
+}
+
+/*
+RevokeOthers 吊销当前用户除本会话外的全部会话
+路由：POST /api/v1/users/sessions/revoke-others
+*/
+func (h *SessionHandler) RevokeOthers(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	current := middleware.GetSessionID(c)
+	if current == "" {
+		response.GinBadRequest(c, "请使用登录令牌操作")
+		return
+	}
+	n, err := h.sessions.RevokeAll(userID, current, service.SessionRevokeUser)
+	if err != nil {
+		response.GinInternalError(c, "吊销会话失败", err)
+		return
+	}
+	middleware.AuditChange(c, "user.session_revoke", "user:"+userID, gin.H{"sessions": n}, gin.H{"sessions": 0})
+	response.GinSuccessWithMessage(c, "其他会话已吊销", gin.H{"revoked": n})
+}
+
+/*
+AdminList 管理员查看用户的有效会话
+路由：GET /api/v1/users/:id/sessions
+*/
+func (h *SessionHandler) AdminList(c *gin.Context) {
+	h.list(c, c.Param("id"))
+}
+
+/*
+AdminRevokeAll 管理员强制用户下线（吊销全部会话）
+路由：POST /api/v1/users/:id/sessions/revoke
+*/
+func (h *SessionHandler) AdminRevokeAll(c *gin.Context) {
+	targetUserID := c.Param("id")
+	n, err := h.sessions.RevokeAll(targetUserID, "", service.SessionRevokeAdmin)
+	if err != nil {
+		response.GinInternalError(c, "吊销会话失败", err)
+		return
+	}
+	h.logger.Info("管理员强制用户下线",
+		zap.String("userID", targetUserID),
+		zap.String("operator", middleware.GetUserID(c)),
+		zap.Int64("sessions", n))
+	middleware.AuditChange(c, "user.force_logout", "user:"+targetUserID, gin.H{"sessions": n}, gin.H{"sessions": 0})
+	response.GinSuccessWithMessage(c, "用户已强制下线", gin.H{"revoked": n})
+}
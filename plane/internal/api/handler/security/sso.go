@@ -0,0 +1,208 @@
+package security
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"gkipass/plane/internal/api/middleware"
+	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/service"
+	"gkipass/plane/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+/*
+SSOHandler 通用 OIDC 单点登录处理器
+功能：登录页提供方列表、发起登录、回调登录（含两步验证）、已登录用户关联和解除外部身份
+*/
+type SSOHandler struct {
+	app    *types.App
+	sso    *service.SSOService
+	mfa    *service.MFAService
+	audit  *service.AuditService
+	logger *zap.Logger
+}
+
+/*
+NewSSOHandler 创建单点登录处理器
+功能：sso 在各实例内保存授权状态（未配置 Redis 时），路由中共用同一个实例
+*/
+func NewSSOHandler(app *types.App, sso *service.SSOService, audit *service.AuditService) *SSOHandler {
+	return &SSOHandler{
+		app:    app,
+		sso:    sso,
+		mfa:    service.NewMFAService(app.DB.GormDB, app.Config.Auth.MFA),
+		audit:  audit,
+		logger: zap.L().Named("sso-handler"),
+	}
+}
+
+/*
+SSOCallbackRequest 回调请求，前端回调页把提供方带回的 code 和 state 原样提交
+*/
+type SSOCallbackRequest struct {
+	Code  string `json:"code" binding:"required,max=2048"`
+	State string `json:"state" binding:"required,max=128"`
+}
+
+/*
+Providers 登录页展示的单点登录提供方
+路由：GET /api/v1/auth/sso/providers
+*/
+func (h *SSOHandler) Providers(c *gin.Context) {
+	response.GinSuccess(c, h.sso.EnabledProviders())
+}
+
+/*
+Login 生成提供方授权地址，前端跳转到 url；同时写入 state Cookie，回调时校验
+路由：GET /api/v1/auth/sso/:provider/login
+*/
+func (h *SSOHandler) Login(c *gin.Context) {
+	url, state, err := h.sso.AuthURL(c.Request.Context(), c.Param("provider"), "")
+	if err != nil {
+		h.logger.Warn("生成单点登录地址失败", zap.String("provider", c.Param("provider")), zap.Error(err))
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	setStateCookie(c, state, int(service.SSOStateTTL/time.Second))
+	response.GinSuccess(c, gin.H{"url": url, "state": state})
+}
+
+/*
+Callback 处理提供方回调
+功能：关联外部身份时返回 linked；登录时与密码登录一样检查两步验证，通过后签发令牌
+路由：POST /api/v1/auth/sso/:provider/callback
+*/
+func (h *SSOHandler) Callback(c *gin.Context) {
+	var req SSOCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
+	provider := c.Param("provider")
+
+	/* state Cookie 只用一次，无论回调成功与否都清除 */
+	boundState, _ := c.Cookie(service.SSOStateCookie)
+	setStateCookie(c, "", -1)
+
+	result, err := h.sso.Callback(c.Request.Context(), provider, req.Code, req.State, boundState, middleware.GetUserID(c))
+	if err != nil {
+		h.logger.Warn("单点登录失败",
+			zap.String("provider", provider),
+			zap.String("client_ip", c.ClientIP()),
+			zap.Error(err))
+		response.GinUnauthorized(c, err.Error())
+		return
+	}
+	user := result.User
+
+	if result.Linked {
+		h.recordAudit(c, user.ID, user.Username, "user.sso_link", nil, gin.H{"provider": provider})
+		response.GinSuccessWithMessage(c, "已关联外部账号", gin.H{"linked": true, "provider": provider})
+		return
+	}
+	if result.Created {
+		h.recordAudit(c, user.ID, user.Username, "user.create", nil, gin.H{
+			"username": user.Username,
+			"provider": user.Provider,
+			"role":     user.Role,
+		})
+	}
+
+	pending, err := secondFactorLogin(h.app, h.mfa, user)
+	if err != nil {
+		response.GinInternalError(c, "登录失败", err)
+		return
+	}
+	if pending != nil {
+		response.GinSuccess(c, pending)
+		return
+	}
+
+	resp, err := issueLogin(c, h.app, user)
+	if err != nil {
+		response.GinInternalError(c, "生成令牌失败", err)
+		return
+	}
+	_ = h.app.DAO.UpdateUserLastLogin(user.ID)
+	response.GinSuccess(c, resp)
+}
+
+/* recordAudit 回调为公开路由，不经过审计中间件，关联和自动创建用户直接写入审计日志 */
+func (h *SSOHandler) recordAudit(c *gin.Context, userID, username, action string, before, after interface{}) {
+	if h.audit == nil {
+		return
+	}
+	_, err := h.audit.Record(context.WithoutCancel(c.Request.Context()), &service.AuditEntry{
+		UserID:    userID,
+		Username:  username,
+		Action:    action,
+		Resource:  "user:" + userID,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Status:    200,
+		RequestID: middleware.GetRequestID(c),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Before:    before,
+		After:     after,
+	})
+	if err != nil {
+		h.logger.Error("写入审计日志失败", zap.String("action", action), zap.Error(err))
+	}
+}
+
+/*
+Identities 当前用户关联的外部身份
+路由：GET /api/v1/users/sso/identities
+*/
+func (h *SSOHandler) Identities(c *gin.Context) {
+	identities, err := h.sso.ListIdentities(middleware.GetUserID(c))
+	if err != nil {
+		response.GinInternalError(c, "查询外部身份失败", err)
+		return
+	}
+	response.GinSuccess(c, identities)
+}
+
+/*
+Link 已登录用户发起关联，返回授权地址；提供方回调仍提交到 /auth/sso/:provider/callback
+路由：POST /api/v1/users/sso/:provider/link
+*/
+func (h *SSOHandler) Link(c *gin.Context) {
+	url, state, err := h.sso.AuthURL(c.Request.Context(), c.Param("provider"), middleware.GetUserID(c))
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	setStateCookie(c, state, int(service.SSOStateTTL/time.Second))
+	response.GinSuccess(c, gin.H{"url": url, "state": state})
+}
+
+/*
+setStateCookie 写入（maxAge<0 时清除）绑定本次授权的 state Cookie
+功能：HttpOnly 防止脚本读取，SameSite=Lax 不随跨站请求发送；仅回调路由需要该 Cookie
+*/
+func setStateCookie(c *gin.Context, state string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(service.SSOStateCookie, state, maxAge, "/api/v1/auth/sso", "", secure, true)
+}
+
+/*
+Unlink 解除外部身份关联
+路由：POST /api/v1/users/sso/identities/:id/delete
+*/
+func (h *SSOHandler) Unlink(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	identity, err := h.sso.Unlink(userID, c.Param("id"))
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	middleware.AuditChange(c, "user.sso_unlink", "user:"+userID, gin.H{"provider": identity.Provider}, nil)
+	response.GinSuccessWithMessage(c, "已解除关联", nil)
+}
@@ -0,0 +1,215 @@
+package system
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gkipass/plane/internal/api/middleware"
+	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/pkg/logger"
+	"gkipass/plane/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// alertChannelRequest 创建/更新告警通道请求，更新时未传的字段保持不变
+type alertChannelRequest struct {
+	Name       *string         `json:"name"`
+	Type       *string         `json:"type"`
+	Config     json.RawMessage `json:"config"` /* 对应通道类型的配置对象，见 service.AlertChannelConfig */
+	Enabled    *bool           `json:"enabled"`
+	IsDefault  *bool           `json:"is_default"`
+	RateLimit  *int            `json:"rate_limit"`
+	MaxRetries *int            `json:"max_retries"`
+}
+
+// apply 把请求字段写入通道并校验配置
+func (req *alertChannelRequest) apply(ch *models.AlertChannel) error {
+	if req.Name != nil {
+		ch.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Type != nil {
+		ch.Type = *req.Type
+	}
+	if len(req.Config) > 0 {
+		ch.Config = string(req.Config)
+	}
+	if req.Enabled != nil {
+		ch.Enabled = *req.Enabled
+	}
+	if req.IsDefault != nil {
+		ch.IsDefault = *req.IsDefault
+	}
+	if req.RateLimit != nil {
+		ch.RateLimit = *req.RateLimit
+	}
+	if req.MaxRetries != nil {
+		ch.MaxRetries = *req.MaxRetries
+	}
+
+	if ch.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if ch.RateLimit < 0 {
+		return fmt.Errorf("rate_limit must be >= 0")
+	}
+	if ch.MaxRetries < 0 || ch.MaxRetries > 10 {
+		return fmt.Errorf("max_retries must be between 0 and 10")
+	}
+	if _, err := service.NewAlertNotifier(ch); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListAlertChannels 列出告警通道（管理员）
+func (h *MonitoringHandler) ListAlertChannels(c *gin.Context) {
+	channels, err := h.app.DAO.ListAlertChannels()
+	if err != nil {
+		response.InternalError(c, "Failed to list alert channels")
+		return
+	}
+
+	response.GinSuccess(c, gin.H{
+		"channels": channels,
+		"total":    len(channels),
+	})
+}
+
+// CreateAlertChannel 创建告警通道（管理员）
+func (h *MonitoringHandler) CreateAlertChannel(c *gin.Context) {
+	var req alertChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	channel := &models.AlertChannel{
+		Enabled:    true,
+		RateLimit:  20,
+		MaxRetries: 3,
+		CreatedBy:  middleware.GetUserID(c),
+	}
+	if err := req.apply(channel); err != nil {
+		response.GinBadRequest(c, "Invalid alert channel: "+err.Error())
+		return
+	}
+
+	if err := h.app.DAO.CreateAlertChannel(channel); err != nil {
+		logger.Error("创建告警通道失败", zap.Error(err))
+		response.InternalError(c, "Failed to create alert channel")
+		return
+	}
+
+	logger.Info("告警通道已创建",
+		zap.String("channelID", channel.ID),
+		zap.String("type", channel.Type),
+		zap.String("createdBy", channel.CreatedBy))
+
+	response.SuccessWithMessage(c, "Alert channel created", channel)
+}
+
+// UpdateAlertChannel 更新告警通道（管理员）
+func (h *MonitoringHandler) UpdateAlertChannel(c *gin.Context) {
+	channel, err := h.app.DAO.GetAlertChannel(c.Param("channel_id"))
+	if err != nil || channel == nil {
+		response.GinNotFound(c, "Alert channel not found")
+		return
+	}
+
+	var req alertChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	if err := req.apply(channel); err != nil {
+		response.GinBadRequest(c, "Invalid alert channel: "+err.Error())
+		return
+	}
+
+	if err := h.app.DAO.UpdateAlertChannel(channel); err != nil {
+		logger.Error("更新告警通道失败", zap.Error(err))
+		response.InternalError(c, "Failed to update alert channel")
+		return
+	}
+
+	response.SuccessWithMessage(c, "Alert channel updated", channel)
+}
+
+// DeleteAlertChannel 删除告警通道（管理员）
+func (h *MonitoringHandler) DeleteAlertChannel(c *gin.Context) {
+	channelID := c.Param("channel_id")
+
+	channel, _ := h.app.DAO.GetAlertChannel(channelID)
+	if channel == nil {
+		response.GinNotFound(c, "Alert channel not found")
+		return
+	}
+
+	if err := h.app.DAO.DeleteAlertChannel(channelID); err != nil {
+		logger.Error("删除告警通道失败", zap.Error(err))
+		response.InternalError(c, "Failed to delete alert channel")
+		return
+	}
+
+	response.SuccessWithMessage(c, "Alert channel deleted", nil)
+}
+
+// TestAlertChannel 向告警通道发送一条测试通知（管理员）
+func (h *MonitoringHandler) TestAlertChannel(c *gin.Context) {
+	channel, err := h.app.DAO.GetAlertChannel(c.Param("channel_id"))
+	if err != nil || channel == nil {
+		response.GinNotFound(c, "Alert channel not found")
+		return
+	}
+
+	err = h.monitoringService.AlertSystem().SendToChannel(channel, service.Alert{
+		Level:   service.AlertInfo,
+		Title:   "GKIPass 告警通道测试",
+		Message: fmt.Sprintf("这是发往通道「%s」的测试通知，收到即表示配置正确。", channel.Name),
+		Tags:    []string{"test"},
+	})
+	if err != nil {
+		response.GinBadRequest(c, "Test notification failed: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(c, "Test notification sent", nil)
+}
+
+// ListAlertDeliveries 列出告警投递记录（管理员）
+func (h *MonitoringHandler) ListAlertDeliveries(c *gin.Context) {
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 500 {
+			limit = l
+		}
+	}
+
+	deliveries, err := h.app.DAO.ListAlertDeliveries(c.Query("channel_id"), c.Query("status"), limit)
+	if err != nil {
+		response.InternalError(c, "Failed to list alert deliveries")
+		return
+	}
+
+	response.GinSuccess(c, gin.H{
+		"deliveries": deliveries,
+		"total":      len(deliveries),
+	})
+}
+
+// normalizeAlertRuleChannels 校验告警规则引用的通道都存在，返回去除空白后的逗号分隔 ID
+func (h *MonitoringHandler) normalizeAlertRuleChannels(channels string) (string, error) {
+	ids := service.SplitAlertChannelIDs(channels)
+	for _, id := range ids {
+		ch, err := h.app.DAO.GetAlertChannel(id)
+		if err != nil || ch == nil {
+			return "", fmt.Errorf("alert channel not found: %s", id)
+		}
+	}
+	return strings.Join(ids, ","), nil
+}
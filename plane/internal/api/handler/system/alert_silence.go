@@ -0,0 +1,160 @@
+package system
+
+import (
+	"time"
+
+	"gkipass/plane/internal/api/middleware"
+	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ListAlertSilences 列出静默和维护窗口，默认只返回未结束的（管理员）
+func (h *MonitoringHandler) ListAlertSilences(c *gin.Context) {
+	activeAt := time.Now()
+	if c.Query("all") == "true" {
+		activeAt = time.Time{}
+	}
+
+	silences, err := h.app.DAO.ListAlertSilences(activeAt)
+	if err != nil {
+		response.InternalError(c, "Failed to list silences")
+		return
+	}
+
+	response.GinSuccess(c, gin.H{
+		"silences": silences,
+		"total":    len(silences),
+	})
+}
+
+// CreateAlertSilence 创建静默或维护窗口（管理员）
+// 静默期间告警照常记录但不通知；维护窗口内暂停规则评估，节点离线也不通知
+func (h *MonitoringHandler) CreateAlertSilence(c *gin.Context) {
+	var req struct {
+		Kind            string     `json:"kind"` // silence / maintenance，默认 silence
+		RuleID          string     `json:"rule_id"`
+		NodeID          string     `json:"node_id"`
+		GroupID         string     `json:"group_id"`
+		TunnelID        string     `json:"tunnel_id"`
+		StartsAt        *time.Time `json:"starts_at"` // 默认立即开始
+		EndsAt          *time.Time `json:"ends_at"`
+		DurationMinutes int        `json:"duration_minutes"` // 未指定 ends_at 时使用
+		Comment         string     `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	if req.Kind == "" {
+		req.Kind = models.AlertSilenceKindSilence
+	}
+	if req.Kind != models.AlertSilenceKindSilence && req.Kind != models.AlertSilenceKindMaintenance {
+		response.GinBadRequest(c, "Invalid kind, must be one of: silence, maintenance")
+		return
+	}
+
+	silence := &models.AlertSilence{
+		Kind:      req.Kind,
+		RuleID:    req.RuleID,
+		NodeID:    req.NodeID,
+		GroupID:   req.GroupID,
+		TunnelID:  req.TunnelID,
+		StartsAt:  time.Now(),
+		Comment:   req.Comment,
+		CreatedBy: middleware.GetUserID(c),
+	}
+	if req.StartsAt != nil {
+		silence.StartsAt = *req.StartsAt
+	}
+	switch {
+	case req.EndsAt != nil:
+		silence.EndsAt = *req.EndsAt
+	case req.DurationMinutes > 0:
+		silence.EndsAt = silence.StartsAt.Add(time.Duration(req.DurationMinutes) * time.Minute)
+	default:
+		response.GinBadRequest(c, "ends_at or duration_minutes is required")
+		return
+	}
+	if !silence.EndsAt.After(silence.StartsAt) || !silence.EndsAt.After(time.Now()) {
+		response.GinBadRequest(c, "ends_at must be after starts_at and in the future")
+		return
+	}
+
+	if silence.RuleID != "" {
+		if rule, err := h.app.DAO.GetNodeAlertRule(silence.RuleID); err != nil || rule == nil {
+			response.GinNotFound(c, "Alert rule not found")
+			return
+		}
+	}
+	if msg := h.checkAlertRuleTarget(&models.NodeAlertRule{
+		NodeID:   silence.NodeID,
+		GroupID:  silence.GroupID,
+		TunnelID: silence.TunnelID,
+	}); msg != "" {
+		response.GinNotFound(c, msg)
+		return
+	}
+
+	if err := h.app.DAO.CreateAlertSilence(silence); err != nil {
+		logger.Error("创建告警静默失败", zap.Error(err))
+		response.InternalError(c, "Failed to create silence")
+		return
+	}
+	h.monitoringService.AlertEngine().InvalidateSilences()
+
+	logger.Info("告警静默已创建",
+		zap.String("silenceID", silence.ID),
+		zap.String("kind", silence.Kind),
+		zap.Time("startsAt", silence.StartsAt),
+		zap.Time("endsAt", silence.EndsAt),
+		zap.String("createdBy", silence.CreatedBy))
+
+	response.SuccessWithMessage(c, "Silence created", silence)
+}
+
+// ExpireAlertSilence 提前结束静默（管理员）
+func (h *MonitoringHandler) ExpireAlertSilence(c *gin.Context) {
+	silence, err := h.app.DAO.GetAlertSilence(c.Param("silence_id"))
+	if err != nil || silence == nil {
+		response.GinNotFound(c, "Silence not found")
+		return
+	}
+
+	now := time.Now()
+	if silence.EndsAt.After(now) {
+		silence.EndsAt = now
+		if err := h.app.DAO.UpdateAlertSilence(silence); err != nil {
+			logger.Error("结束告警静默失败", zap.Error(err))
+			response.InternalError(c, "Failed to expire silence")
+			return
+		}
+		h.monitoringService.AlertEngine().InvalidateSilences()
+	}
+
+	response.SuccessWithMessage(c, "Silence expired", silence)
+}
+
+// DeleteAlertSilence 删除静默（管理员）
+func (h *MonitoringHandler) DeleteAlertSilence(c *gin.Context) {
+	silenceID := c.Param("silence_id")
+
+	silence, _ := h.app.DAO.GetAlertSilence(silenceID)
+	if silence == nil {
+		response.GinNotFound(c, "Silence not found")
+		return
+	}
+
+	if err := h.app.DAO.DeleteAlertSilence(silenceID); err != nil {
+		logger.Error("删除告警静默失败", zap.Error(err))
+		response.InternalError(c, "Failed to delete silence")
+		return
+	}
+	h.monitoringService.AlertEngine().InvalidateSilences()
+
+	response.SuccessWithMessage(c, "Silence deleted", nil)
+}
@@ -0,0 +1,141 @@
+package system
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/pkg/logger"
+	"gkipass/plane/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AuditHandler 审计日志处理器（管理员）
+type AuditHandler struct {
+	audit *service.AuditService
+}
+
+// NewAuditHandler 创建审计日志处理器
+func NewAuditHandler(audit *service.AuditService) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+// parseAuditFilter 解析查询条件：user_id、resource、action（前缀匹配）、from、to（RFC3339 或 2006-01-02，to 不含当天以后）
+func parseAuditFilter(c *gin.Context) (*service.AuditFilter, error) {
+	filter := &service.AuditFilter{
+		UserID:   c.Query("user_id"),
+		Resource: c.Query("resource"),
+		Action:   c.Query("action"),
+	}
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	var err error
+	if filter.From, err = parseAuditTime(c.Query("from"), false); err != nil {
+		return nil, fmt.Errorf("无效的开始时间: %w", err)
+	}
+	if filter.To, err = parseAuditTime(c.Query("to"), true); err != nil {
+		return nil, fmt.Errorf("无效的结束时间: %w", err)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("开始时间必须早于结束时间")
+	}
+	return filter, nil
+}
+
+// parseAuditTime 解析时间；只给日期的结束时间包含当天
+func parseAuditTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// List 查询审计日志
+// 路由：GET /api/v1/admin/audit-logs?user_id=&resource=&action=&from=&to=&page=&page_size=
+func (h *AuditHandler) List(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+
+	logs, total, err := h.audit.Search(filter)
+	if err != nil {
+		response.GinInternalError(c, "查询审计日志失败", err)
+		return
+	}
+
+	response.GinSuccess(c, gin.H{
+		"logs":      logs,
+		"total":     total,
+		"page":      filter.Page,
+		"page_size": filter.PageSize,
+	})
+}
+
+// Export 导出审计日志，条件同 List，format 为 csv（默认）或 json
+// 路由：GET /api/v1/admin/audit-logs/export?format=csv
+func (h *AuditHandler) Export(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case "csv":
+	case "json":
+		contentType = "application/json"
+	default:
+		response.GinBadRequest(c, "不支持的导出格式: "+format)
+		return
+	}
+
+	/* 导出量可能较大，不受 HTTP 服务器写超时限制 */
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logger.Debug("取消写超时失败", zap.Error(err))
+	}
+	filename := fmt.Sprintf("audit-logs-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	/* 响应头已发出，失败时只能中断输出并记录日志 */
+	if err := h.audit.Export(c.Request.Context(), c.Writer, format, filter); err != nil {
+		logger.Error("导出审计日志失败", zap.String("format", format), zap.Error(err))
+	}
+}
+
+// Verify 校验审计日志哈希链
+// 路由：GET /api/v1/admin/audit-logs/verify
+func (h *AuditHandler) Verify(c *gin.Context) {
+	result, err := h.audit.Verify(c.Request.Context())
+	if err != nil {
+		response.GinInternalError(c, "校验审计日志失败", err)
+		return
+	}
+	if !result.Valid {
+		logger.Error("审计日志哈希链校验失败",
+			zap.Int64("seq", result.BrokenSeq),
+			zap.String("id", result.BrokenID),
+			zap.String("reason", result.Reason))
+	}
+	response.GinSuccess(c, result)
+}
@@ -319,35 +319,54 @@ func (h *MonitoringHandler) GetNodeAlerts(c *gin.Context) {
 }
 
 // CreateAlertRule 创建告警规则（管理员）
+// 路径带节点 ID 时创建节点规则，否则按请求中的 scope 创建节点 / 节点组 / 隧道规则
 func (h *MonitoringHandler) CreateAlertRule(c *gin.Context) {
-	nodeID := c.Param("id")
-
 	var req struct {
-		RuleName             string  `json:"rule_name" binding:"required"`
-		MetricType           string  `json:"metric_type" binding:"required"`
-		Operator             string  `json:"operator" binding:"required"`
-		ThresholdValue       float64 `json:"threshold_value" binding:"required"`
-		DurationSeconds      int     `json:"duration_seconds"`
-		Severity             string  `json:"severity" binding:"required"`
-		Enabled              bool    `json:"enabled"`
-		NotificationChannels string  `json:"notification_channels"`
+		Scope                string   `json:"scope"`
+		NodeID               string   `json:"node_id"`
+		GroupID              string   `json:"group_id"`
+		TunnelID             string   `json:"tunnel_id"`
+		RuleName             string   `json:"rule_name" binding:"required"`
+		MetricType           string   `json:"metric_type" binding:"required"`
+		Operator             string   `json:"operator" binding:"required"`
+		ThresholdValue       float64  `json:"threshold_value" binding:"required"`
+		ResolveThreshold     *float64 `json:"resolve_threshold"`
+		Aggregation          string   `json:"aggregation"`
+		WindowSeconds        int      `json:"window_seconds"`
+		DurationSeconds      int      `json:"duration_seconds"`
+		Severity             string   `json:"severity" binding:"required"`
+		Enabled              bool     `json:"enabled"`
+		NotificationChannels string   `json:"notification_channels"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.GinBadRequest(c, "Invalid request: "+err.Error())
 		return
 	}
+	if nodeID := c.Param("id"); nodeID != "" {
+		req.Scope = models.AlertScopeNode
+		req.NodeID = nodeID
+	}
 
-	/* 校验指标类型 */
-	validMetrics := map[string]bool{"cpu": true, "memory": true, "disk": true, "response_time": true, "connections": true}
-	if !validMetrics[req.MetricType] {
-		response.GinBadRequest(c, "Invalid metric_type, must be one of: cpu, memory, disk, response_time, connections")
-		return
+	rule := &models.NodeAlertRule{
+		Scope:            req.Scope,
+		NodeID:           req.NodeID,
+		GroupID:          req.GroupID,
+		TunnelID:         req.TunnelID,
+		RuleName:         req.RuleName,
+		MetricType:       req.MetricType,
+		Operator:         req.Operator,
+		ThresholdValue:   req.ThresholdValue,
+		ResolveThreshold: req.ResolveThreshold,
+		Aggregation:      req.Aggregation,
+		WindowSeconds:    req.WindowSeconds,
+		DurationSeconds:  req.DurationSeconds,
+		Severity:         req.Severity,
+		Enabled:          req.Enabled,
 	}
 
-	/* 校验操作符 */
-	validOps := map[string]bool{">": true, "<": true, ">=": true, "<=": true, "=": true, "!=": true}
-	if !validOps[req.Operator] {
-		response.GinBadRequest(c, "Invalid operator")
+	/* 校验作用范围、指标、操作符和聚合配置 */
+	if err := service.ValidateAlertRule(rule); err != nil {
+		response.GinBadRequest(c, "Invalid alert rule: "+err.Error())
 		return
 	}
 
@@ -358,24 +377,19 @@ func (h *MonitoringHandler) CreateAlertRule(c *gin.Context) {
 		return
 	}
 
-	/* 校验节点存在 */
-	node, err := h.app.DAO.GetNode(nodeID)
-	if err != nil || node == nil {
-		response.GinNotFound(c, "Node not found")
+	/* 校验节点 / 节点组 / 隧道存在 */
+	if msg := h.checkAlertRuleTarget(rule); msg != "" {
+		response.GinNotFound(c, msg)
 		return
 	}
 
-	rule := &models.NodeAlertRule{
-		NodeID:               nodeID,
-		RuleName:             req.RuleName,
-		MetricType:           req.MetricType,
-		Operator:             req.Operator,
-		ThresholdValue:       req.ThresholdValue,
-		DurationSeconds:      req.DurationSeconds,
-		Severity:             req.Severity,
-		Enabled:              req.Enabled,
-		NotificationChannels: req.NotificationChannels,
+	/* 校验通知通道 */
+	channels, err := h.normalizeAlertRuleChannels(req.NotificationChannels)
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
 	}
+	rule.NotificationChannels = channels
 
 	if err := h.app.DAO.CreateNodeAlertRule(rule); err != nil {
 		logger.Error("创建告警规则失败", zap.Error(err))
@@ -386,6 +400,40 @@ func (h *MonitoringHandler) CreateAlertRule(c *gin.Context) {
 	response.SuccessWithMessage(c, "Alert rule created", rule)
 }
 
+// ListAllAlertRules 列出所有告警规则，可按 scope 过滤（管理员）
+func (h *MonitoringHandler) ListAllAlertRules(c *gin.Context) {
+	rules, err := h.app.DAO.ListAlertRules(c.Query("scope"))
+	if err != nil {
+		response.InternalError(c, "Failed to list alert rules")
+		return
+	}
+
+	response.GinSuccess(c, gin.H{
+		"rules": rules,
+		"total": len(rules),
+	})
+}
+
+// checkAlertRuleTarget 校验规则引用的节点 / 节点组 / 隧道存在，不存在时返回提示
+func (h *MonitoringHandler) checkAlertRuleTarget(rule *models.NodeAlertRule) string {
+	if rule.NodeID != "" {
+		if node, err := h.app.DAO.GetNode(rule.NodeID); err != nil || node == nil {
+			return "Node not found"
+		}
+	}
+	if rule.GroupID != "" {
+		if group, err := h.app.DAO.GetNodeGroup(rule.GroupID); err != nil || group == nil {
+			return "Node group not found"
+		}
+	}
+	if rule.TunnelID != "" {
+		if tunnel, err := h.app.DAO.GetTunnel(rule.TunnelID); err != nil || tunnel == nil {
+			return "Tunnel not found"
+		}
+	}
+	return ""
+}
+
 // ListAlertRules 列出节点告警规则
 func (h *MonitoringHandler) ListAlertRules(c *gin.Context) {
 	nodeID := c.Param("id")
@@ -422,6 +470,10 @@ func (h *MonitoringHandler) UpdateAlertRule(c *gin.Context) {
 		Severity             *string  `json:"severity"`
 		Enabled              *bool    `json:"enabled"`
 		NotificationChannels *string  `json:"notification_channels"`
+		Aggregation          *string  `json:"aggregation"`
+		WindowSeconds        *int     `json:"window_seconds"`
+		ResolveThreshold     *float64 `json:"resolve_threshold"`
+		ClearResolve         bool     `json:"clear_resolve_threshold"` /* 清除恢复阈值，恢复为与触发阈值相同 */
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.GinBadRequest(c, "Invalid request: "+err.Error())
@@ -449,8 +501,28 @@ func (h *MonitoringHandler) UpdateAlertRule(c *gin.Context) {
 	if req.Enabled != nil {
 		rule.Enabled = *req.Enabled
 	}
+	if req.Aggregation != nil {
+		rule.Aggregation = *req.Aggregation
+	}
+	if req.WindowSeconds != nil {
+		rule.WindowSeconds = *req.WindowSeconds
+	}
+	if req.ResolveThreshold != nil {
+		rule.ResolveThreshold = req.ResolveThreshold
+	} else if req.ClearResolve {
+		rule.ResolveThreshold = nil
+	}
+	if err := service.ValidateAlertRule(rule); err != nil {
+		response.GinBadRequest(c, "Invalid alert rule: "+err.Error())
+		return
+	}
 	if req.NotificationChannels != nil {
-		rule.NotificationChannels = *req.NotificationChannels
+		channels, err := h.normalizeAlertRuleChannels(*req.NotificationChannels)
+		if err != nil {
+			response.GinBadRequest(c, err.Error())
+			return
+		}
+		rule.NotificationChannels = channels
 	}
 
 	if err := h.app.DAO.UpdateNodeAlertRule(rule); err != nil {
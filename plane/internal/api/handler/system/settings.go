@@ -3,9 +3,12 @@ package system
 import (
 	"encoding/json"
 
+	"gkipass/plane/internal/api/middleware"
 	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/config"
 	"gkipass/plane/internal/db/models"
 	"gkipass/plane/internal/pkg/logger"
+	"gkipass/plane/internal/service"
 	"gkipass/plane/internal/types"
 
 	"github.com/gin-gonic/gin"
@@ -22,6 +25,19 @@ func NewSettingsHandler(app *types.App) *SettingsHandler {
 	return &SettingsHandler{app: app}
 }
 
+// previousSetting 读取修改前的设置值，用于审计日志记录差异；不存在或无法解析时返回 nil
+func (h *SettingsHandler) previousSetting(key string) interface{} {
+	setting, err := h.app.DAO.GetSystemSetting(key)
+	if err != nil || setting == nil {
+		return nil
+	}
+	var value map[string]interface{}
+	if err := json.Unmarshal([]byte(setting.Value), &value); err != nil {
+		return nil
+	}
+	return value
+}
+
 // GetCaptchaSettings 获取验证码设置
 func (h *SettingsHandler) GetCaptchaSettings(c *gin.Context) {
 	setting, err := h.app.DAO.GetSystemSetting("captcha")
@@ -76,6 +92,7 @@ func (h *SettingsHandler) UpdateCaptchaSettings(c *gin.Context) {
 		return
 	}
 
+	previous := h.previousSetting("captcha")
 	setting := &models.SystemSetting{
 		Key:      "captcha",
 		Value:    string(valueJSON),
@@ -87,6 +104,7 @@ func (h *SettingsHandler) UpdateCaptchaSettings(c *gin.Context) {
 		response.InternalError(c, "Failed to update settings")
 		return
 	}
+	middleware.AuditChange(c, "settings.update", "setting:"+setting.Key, previous, req)
 
 	// 同步更新配置
 	h.app.Config.Captcha.Enabled = req.Enabled
@@ -161,6 +179,7 @@ func (h *SettingsHandler) UpdateGeneralSettings(c *gin.Context) {
 		return
 	}
 
+	previous := h.previousSetting("general")
 	setting := &models.SystemSetting{
 		Key:      "general",
 		Value:    string(valueJSON),
@@ -172,6 +191,7 @@ func (h *SettingsHandler) UpdateGeneralSettings(c *gin.Context) {
 		response.InternalError(c, "Failed to update settings")
 		return
 	}
+	middleware.AuditChange(c, "settings.update", "setting:"+setting.Key, previous, req)
 
 	response.SuccessWithMessage(c, "General settings updated successfully", req)
 }
@@ -186,6 +206,7 @@ type SecuritySettings struct {
 	LoginMaxAttempts         int  `json:"login_max_attempts" binding:"min=1,max=100"`
 	LoginLockoutDuration     int  `json:"login_lockout_duration" binding:"min=1,max=1440"` /* 分钟，最大24小时 */
 	Enable2FA                bool `json:"enable_2fa"`
+	RequireAdmin2FA          bool `json:"require_admin_2fa"`                       /* 管理员登录必须通过两步验证，未绑定的管理员登录时须先绑定 */
 	SessionTimeout           int  `json:"session_timeout" binding:"min=1,max=720"` /* 小时，最大30天 */
 }
 
@@ -200,6 +221,7 @@ func (h *SettingsHandler) GetSecuritySettings(c *gin.Context) {
 		LoginMaxAttempts:         5,
 		LoginLockoutDuration:     30,
 		Enable2FA:                false,
+		RequireAdmin2FA:          false,
 		SessionTimeout:           24,
 	}
 
@@ -239,6 +261,7 @@ func (h *SettingsHandler) UpdateSecuritySettings(c *gin.Context) {
 		return
 	}
 
+	previous := h.previousSetting("security")
 	setting := &models.SystemSetting{
 		Key:      "security",
 		Value:    string(valueJSON),
@@ -250,6 +273,7 @@ func (h *SettingsHandler) UpdateSecuritySettings(c *gin.Context) {
 		response.InternalError(c, "Failed to update settings")
 		return
 	}
+	middleware.AuditChange(c, "settings.update", "setting:"+setting.Key, previous, req)
 
 	response.SuccessWithMessage(c, "Security settings updated successfully", req)
 }
@@ -340,6 +364,7 @@ func (h *SettingsHandler) UpdateNotificationSettings(c *gin.Context) {
 		return
 	}
 
+	previous := h.previousSetting("notification")
 	setting := &models.SystemSetting{
 		Key:      "notification",
 		Value:    string(valueJSON),
@@ -351,6 +376,7 @@ func (h *SettingsHandler) UpdateNotificationSettings(c *gin.Context) {
 		response.InternalError(c, "Failed to update settings")
 		return
 	}
+	middleware.AuditChange(c, "settings.update", "setting:"+setting.Key, previous, req)
 
 	logger.Info("更新通知设置",
 		zap.Bool("email_enabled", req.EmailEnabled),
@@ -358,3 +384,97 @@ func (h *SettingsHandler) UpdateNotificationSettings(c *gin.Context) {
 
 	response.SuccessWithMessage(c, "Notification settings updated successfully", req)
 }
+
+// ssoSecretMask 接口返回的客户端密钥掩码，更新时提交掩码或空值表示保留原密钥
+const ssoSecretMask = "********"
+
+// loadSSOSettings 读取管理员维护的单点登录设置
+func (h *SettingsHandler) loadSSOSettings() (*service.SSOSettings, error) {
+	settings := &service.SSOSettings{Providers: []config.OIDCProvider{}}
+	setting, err := h.app.DAO.GetSystemSetting("sso")
+	if err != nil || setting == nil {
+		return settings, err
+	}
+	if err := json.Unmarshal([]byte(setting.Value), settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// GetSSOSettings 获取单点登录设置（只含管理员维护的提供方，配置文件中的提供方不在此列出）
+func (h *SettingsHandler) GetSSOSettings(c *gin.Context) {
+	settings, err := h.loadSSOSettings()
+	if err != nil {
+		logger.Error("Failed to load sso settings", zap.Error(err))
+		response.GinInternalError(c, "读取单点登录设置失败", err)
+		return
+	}
+
+	/* 脱敏：客户端密钥不通过 API 返回明文 */
+	for i := range settings.Providers {
+		if settings.Providers[i].ClientSecret != "" {
+			settings.Providers[i].ClientSecret = ssoSecretMask
+		}
+	}
+	response.GinSuccess(c, settings)
+}
+
+// UpdateSSOSettings 更新单点登录设置，同名提供方覆盖配置文件中的同名项
+func (h *SettingsHandler) UpdateSSOSettings(c *gin.Context) {
+	var req service.SSOSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	previous, err := h.loadSSOSettings()
+	if err != nil {
+		response.GinInternalError(c, "读取单点登录设置失败", err)
+		return
+	}
+	oldSecrets := make(map[string]string, len(previous.Providers))
+	for _, p := range previous.Providers {
+		oldSecrets[p.Name] = p.ClientSecret
+	}
+
+	seen := make(map[string]bool, len(req.Providers))
+	for i := range req.Providers {
+		p := &req.Providers[i]
+		if err := service.ValidateOIDCProvider(p); err != nil {
+			response.GinBadRequest(c, err.Error())
+			return
+		}
+		if seen[p.Name] {
+			response.GinBadRequest(c, "提供方标识重复: "+p.Name)
+			return
+		}
+		seen[p.Name] = true
+		if p.ClientSecret == ssoSecretMask || p.ClientSecret == "" {
+			p.ClientSecret = oldSecrets[p.Name]
+		}
+	}
+	if req.Providers == nil {
+		req.Providers = []config.OIDCProvider{}
+	}
+
+	valueJSON, err := json.Marshal(req)
+	if err != nil {
+		response.InternalError(c, "Failed to marshal settings")
+		return
+	}
+
+	setting := &models.SystemSetting{
+		Key:      "sso",
+		Value:    string(valueJSON),
+		Category: "security",
+		Type:     "json",
+	}
+	if err := h.app.DAO.UpsertSystemSetting(setting); err != nil {
+		response.InternalError(c, "Failed to update settings")
+		return
+	}
+	middleware.AuditChange(c, "settings.update", "setting:"+setting.Key, previous, req)
+
+	logger.Info("更新单点登录设置", zap.Int("providers", len(req.Providers)))
+	response.SuccessWithMessage(c, "SSO settings updated successfully", gin.H{"providers": len(req.Providers)})
+}
@@ -1,11 +1,14 @@
 package tunnel
 
 import (
+	"context"
+
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"gkipass/plane/internal/api/middleware"
 	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/db/models"
 	"gkipass/plane/internal/service"
 	"gkipass/plane/internal/types"
 )
@@ -13,21 +16,23 @@ import (
 /*
 GinTunnelHandler 基于 Gin 框架的隧道管理 API 处理器
 功能：提供隧道的 CRUD 操作、启用/禁用切换的 HTTP API
-使用 GormTunnelService 作为数据访问层
+使用 GormTunnelService 作为数据访问层，变更成功后经 GormNodeSyncService 记录变更日志并推送到节点
 */
 type GinTunnelHandler struct {
 	app       *types.App
 	tunnelSvc *service.GormTunnelService
+	syncSvc   *service.GormNodeSyncService /* 可为 nil（未启用节点同步） */
 	logger    *zap.Logger
 }
 
 /*
 NewGinTunnelHandler 创建 Gin 隧道处理器
 */
-func NewGinTunnelHandler(app *types.App) *GinTunnelHandler {
+func NewGinTunnelHandler(app *types.App, syncSvc *service.GormNodeSyncService) *GinTunnelHandler {
 	return &GinTunnelHandler{
 		app:       app,
 		tunnelSvc: service.NewGormTunnelService(app.DB.GormDB),
+		syncSvc:   syncSvc,
 		logger:    zap.L().Named("gin-tunnel-handler"),
 	}
 }
@@ -92,13 +97,20 @@ func (h *GinTunnelHandler) Create(c *gin.Context) {
 		return
 	}
 
-	tunnel, err := h.tunnelSvc.CreateTunnel(&req, userID)
+	tunnel, err := h.tunnelSvc.CreateTunnel(c.Request.Context(), &req, userID)
 	if err != nil {
 		h.logger.Error("创建隧道失败", zap.String("name", req.Name), zap.Error(err))
 		response.GinInternalError(c, "创建隧道失败", err)
 		return
 	}
 
+	if h.syncSvc != nil {
+		if err := h.syncSvc.OnTunnelCreated(c.Request.Context(), tunnel); err != nil {
+			h.logger.Error("同步新隧道规则失败", zap.String("tunnel_id", tunnel.ID), zap.Error(err))
+		}
+	}
+
+	middleware.AuditChange(c, "tunnel.create", "tunnel:"+tunnel.ID, nil, tunnel)
 	response.GinSuccess(c, tunnel)
 }
 
@@ -116,13 +128,35 @@ func (h *GinTunnelHandler) Update(c *gin.Context) {
 		return
 	}
 
-	tunnel, err := h.tunnelSvc.UpdateTunnel(id, &req)
+	previous, _ := h.tunnelSvc.GetTunnel(id)
+
+	/* 记录更新前经过的节点组，不再经过的组需移除规则；启用分批发布时同时记录节点上的原有规则 */
+	var previousGroupIDs []string
+	var baseline *service.RolloutBaseline
+	if h.syncSvc != nil {
+		previousGroupIDs = h.syncSvc.TunnelGroupIDs(id)
+		baseline = h.syncSvc.Rollouts().Capture(id)
+	}
+
+	tunnel, err := h.tunnelSvc.UpdateTunnel(c.Request.Context(), id, &req)
 	if err != nil {
 		h.logger.Error("更新隧道失败", zap.String("id", id), zap.Error(err))
 		response.GinInternalError(c, "更新隧道失败", err)
 		return
 	}
 
+	switch {
+	case baseline != nil:
+		if _, err := h.syncSvc.Rollouts().Begin(c.Request.Context(), baseline, models.RolloutKindTunnel, id, middleware.GetUserID(c)); err != nil {
+			h.logger.Error("发起隧道规则分批发布失败", zap.String("tunnel_id", id), zap.Error(err))
+		}
+	case h.syncSvc != nil:
+		if err := h.syncSvc.OnTunnelUpdated(c.Request.Context(), tunnel, previousGroupIDs...); err != nil {
+			h.logger.Error("同步隧道规则失败", zap.String("tunnel_id", id), zap.Error(err))
+		}
+	}
+
+	middleware.AuditChange(c, "tunnel.update", "tunnel:"+id, previous, tunnel)
 	response.GinSuccess(c, tunnel)
 }
 
@@ -134,12 +168,27 @@ Delete 删除隧道
 func (h *GinTunnelHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := h.tunnelSvc.DeleteTunnel(id); err != nil {
+	previous, _ := h.tunnelSvc.GetTunnel(id)
+
+	/* 删除后无法再查询中继跳，先记录隧道经过的节点组 */
+	var groupIDs []string
+	if h.syncSvc != nil {
+		groupIDs = h.syncSvc.TunnelGroupIDs(id)
+	}
+
+	if err := h.tunnelSvc.DeleteTunnel(c.Request.Context(), id); err != nil {
 		h.logger.Error("删除隧道失败", zap.String("id", id), zap.Error(err))
 		response.GinInternalError(c, "删除隧道失败", err)
 		return
 	}
 
+	if h.syncSvc != nil {
+		if err := h.syncSvc.OnTunnelDeleted(c.Request.Context(), id, "", "", groupIDs...); err != nil {
+			h.logger.Error("同步隧道删除失败", zap.String("tunnel_id", id), zap.Error(err))
+		}
+	}
+
+	middleware.AuditChange(c, "tunnel.delete", "tunnel:"+id, previous, nil)
 	response.GinSuccessWithMessage(c, "隧道已删除", nil)
 }
 
@@ -159,7 +208,8 @@ func (h *GinTunnelHandler) Toggle(c *gin.Context) {
 		return
 	}
 
-	if _, err := h.tunnelSvc.ToggleTunnel(id, req.Enabled); err != nil {
+	previous, _ := h.tunnelSvc.GetTunnel(id)
+	if _, err := h.tunnelSvc.ToggleTunnel(c.Request.Context(), id, req.Enabled); err != nil {
 		h.logger.Error("切换隧道状态失败", zap.String("id", id), zap.Error(err))
 		response.GinInternalError(c, "切换隧道状态失败", err)
 		return
@@ -176,7 +226,9 @@ func (h *GinTunnelHandler) Toggle(c *gin.Context) {
 
 	/* 重新获取更新后的隧道数据 */
 	tunnel, _ := h.tunnelSvc.GetTunnel(id)
+	h.syncToggled(c.Request.Context(), tunnel)
 
+	middleware.AuditChange(c, "tunnel.toggle", "tunnel:"+id, previous, tunnel)
 	response.GinSuccess(c, tunnel)
 }
 
@@ -204,8 +256,12 @@ func (h *GinTunnelHandler) BatchToggle(c *gin.Context) {
 
 	var successCount int
 	for _, id := range req.IDs {
-		if _, err := h.tunnelSvc.ToggleTunnel(id, req.Enabled); err == nil {
+		previous, _ := h.tunnelSvc.GetTunnel(id)
+		if _, err := h.tunnelSvc.ToggleTunnel(c.Request.Context(), id, req.Enabled); err == nil {
 			successCount++
+			tunnel, _ := h.tunnelSvc.GetTunnel(id)
+			h.syncToggled(c.Request.Context(), tunnel)
+			middleware.AuditChange(c, "tunnel.toggle", "tunnel:"+id, previous, tunnel)
 		}
 	}
 
@@ -225,3 +281,15 @@ func (h *GinTunnelHandler) BatchToggle(c *gin.Context) {
 		"action":  action,
 	})
 }
+
+/*
+syncToggled 隧道启停后同步规则：禁用的隧道在节点上被移除，启用后重新下发
+*/
+func (h *GinTunnelHandler) syncToggled(ctx context.Context, tunnel *models.Tunnel) {
+	if h.syncSvc == nil || tunnel == nil {
+		return
+	}
+	if err := h.syncSvc.OnTunnelUpdated(ctx, tunnel); err != nil {
+		h.logger.Error("同步隧道启停失败", zap.String("tunnel_id", tunnel.ID), zap.Error(err))
+	}
+}
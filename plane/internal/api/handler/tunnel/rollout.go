@@ -0,0 +1,105 @@
+package tunnel
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"gkipass/plane/internal/api/middleware"
+	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/service"
+)
+
+/*
+RolloutHandler 规则分批发布 API 处理器
+功能：查看隧道、节点组变更的发布进度（各批次节点的确认与连接统计），手动取消进行中的发布
+*/
+type RolloutHandler struct {
+	syncSvc *service.GormNodeSyncService
+	logger  *zap.Logger
+}
+
+/*
+NewRolloutHandler 创建规则分批发布处理器
+*/
+func NewRolloutHandler(syncSvc *service.GormNodeSyncService) *RolloutHandler {
+	return &RolloutHandler{
+		syncSvc: syncSvc,
+		logger:  zap.L().Named("rollout-handler"),
+	}
+}
+
+/*
+controller 获取发布控制器，未挂载时返回 nil 并响应错误
+*/
+func (h *RolloutHandler) controller(c *gin.Context) *service.RolloutController {
+	if h.syncSvc == nil || h.syncSvc.Rollouts() == nil {
+		response.GinBadRequest(c, "规则分批发布未启用")
+		return nil
+	}
+	return h.syncSvc.Rollouts()
+}
+
+/*
+List 列出发布记录
+功能：支持按状态、变更对象筛选，按创建时间倒序
+路由：GET /api/v1/rollouts/list?status=&target_id=&limit=
+*/
+func (h *RolloutHandler) List(c *gin.Context) {
+	rollouts := h.controller(c)
+	if rollouts == nil {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	list, err := rollouts.List(c.Query("status"), c.Query("target_id"), limit)
+	if err != nil {
+		response.GinInternalError(c, "查询发布记录失败", err)
+		return
+	}
+
+	response.GinSuccess(c, gin.H{
+		"rollouts": list,
+		"total":    len(list),
+	})
+}
+
+/*
+Get 获取发布详情（含各节点进度）
+路由：GET /api/v1/rollouts/:id
+*/
+func (h *RolloutHandler) Get(c *gin.Context) {
+	rollouts := h.controller(c)
+	if rollouts == nil {
+		return
+	}
+
+	rollout, err := rollouts.Get(c.Param("id"))
+	if err != nil {
+		response.GinNotFound(c, err.Error())
+		return
+	}
+	response.GinSuccess(c, rollout)
+}
+
+/*
+Cancel 取消进行中的发布
+功能：已应用新规则的节点恢复到变更前的规则，此后全部节点保持变更前的规则，直到隧道再次变更
+路由：POST /api/v1/rollouts/:id/cancel
+*/
+func (h *RolloutHandler) Cancel(c *gin.Context) {
+	rollouts := h.controller(c)
+	if rollouts == nil {
+		return
+	}
+
+	id := c.Param("id")
+	rollout, err := rollouts.Cancel(c.Request.Context(), id, middleware.GetUserID(c))
+	if err != nil {
+		h.logger.Warn("取消发布失败", zap.String("rollout_id", id), zap.Error(err))
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+	response.GinSuccessWithMessage(c, "发布已取消，节点已恢复变更前的规则", rollout)
+}
@@ -19,21 +19,27 @@ UserHandler 用户处理器
 功能：处理用户注册、信息查询、密码修改、管理员操作等
 */
 type UserHandler struct {
-	app     *types.App
-	userSvc *service.GormUserService
-	planSvc *service.GormPlanService
-	logger  *zap.Logger
+	app          *types.App
+	userSvc      *service.GormUserService
+	planSvc      *service.GormPlanService
+	proxyCredSvc *service.GormProxyCredentialService
+	sessions     *service.SessionService
+	syncSvc      *service.GormNodeSyncService /* 可为 nil（未启用节点同步） */
+	logger       *zap.Logger
 }
 
 /*
 NewUserHandler 创建用户处理器
 */
-func NewUserHandler(app *types.App) *UserHandler {
+func NewUserHandler(app *types.App, syncSvc *service.GormNodeSyncService) *UserHandler {
 	return &UserHandler{
-		app:     app,
-		userSvc: service.NewGormUserService(app.DB.GormDB),
-		planSvc: service.NewGormPlanService(app.DB.GormDB),
-		logger:  zap.L().Named("user-handler"),
+		app:          app,
+		userSvc:      service.NewGormUserService(app.DB.GormDB),
+		planSvc:      service.NewGormPlanService(app.DB.GormDB),
+		proxyCredSvc: service.NewGormProxyCredentialService(app.DB.GormDB),
+		sessions:     service.NewSessionService(app.DB.GormDB, app.Config.Auth.RefreshDays),
+		syncSvc:      syncSvc,
+		logger:       zap.L().Named("user-handler"),
 	}
 }
 
@@ -92,11 +98,18 @@ func (h *UserHandler) Register(c *gin.Context) {
 
 	user := result.User
 
-	/* 生成 JWT 令牌（注册后自动登录） */
+	/* 创建登录会话并生成 JWT 令牌（注册后自动登录） */
+	session, err := h.sessions.Create(user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		h.logger.Error("创建会话失败", zap.Error(err))
+		response.GinInternalError(c, "生成令牌失败", err)
+		return
+	}
 	token, err := middleware.GenerateJWT(
 		user.ID,
 		user.Username,
 		string(user.Role),
+		session.SessionID,
 		h.app.Config.Auth.JWTSecret,
 		h.app.Config.Auth.JWTExpiration,
 	)
@@ -115,6 +128,10 @@ func (h *UserHandler) Register(c *gin.Context) {
 		"role":          string(user.Role),
 		"expires_at":    expiresAt.Unix(),
 		"is_first_user": result.IsFirstUser,
+
+		"session_id":         session.SessionID,
+		"refresh_token":      session.RefreshToken,
+		"refresh_expires_at": session.RefreshExpiresAt.Unix(),
 	})
 }
 
@@ -197,7 +214,7 @@ type UpdatePasswordRequest struct {
 
 /*
 UpdatePassword 修改密码
-功能：验证旧密码 → 校验新密码强度 → 更新
+功能：验证旧密码 → 校验新密码强度 → 更新 → 吊销该用户全部会话（包括当前会话，需重新登录）
 路由：POST /api/v1/users/password/update
 */
 func (h *UserHandler) UpdatePassword(c *gin.Context) {
@@ -214,7 +231,66 @@ func (h *UserHandler) UpdatePassword(c *gin.Context) {
 		return
 	}
 
-	response.GinSuccessWithMessage(c, "密码已更新", nil)
+	if _, err := h.sessions.RevokeAll(userID, "", service.SessionRevokePasswordChanged); err != nil {
+		h.logger.Error("修改密码后吊销会话失败", zap.String("userID", userID), zap.Error(err))
+	}
+
+	response.GinSuccessWithMessage(c, "密码已更新，请重新登录", nil)
+}
+
+/*
+GetProxyCredentials 获取用户级代理凭据
+功能：返回对当前用户所有代理入口隧道（socks5/http）生效的用户名列表，不含密码摘要
+路由：GET /api/v1/users/proxy-credentials
+*/
+func (h *UserHandler) GetProxyCredentials(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	credentials, err := h.proxyCredSvc.ListUserCredentials(userID)
+	if err != nil {
+		response.GinInternalError(c, "获取代理凭据失败", err)
+		return
+	}
+
+	response.GinSuccess(c, credentials)
+}
+
+/*
+UpdateProxyCredentialsRequest 更新用户级代理凭据请求
+*/
+type UpdateProxyCredentialsRequest struct {
+	Credentials []service.TunnelCredentialInput `json:"credentials"`
+}
+
+/*
+UpdateProxyCredentials 替换用户级代理凭据
+功能：整体替换，已有用户名未提交密码时沿用原密码；空列表表示清空。
+替换后立即向承载该用户代理入口隧道的节点推送规则
+路由：POST /api/v1/users/proxy-credentials/update
+*/
+func (h *UserHandler) UpdateProxyCredentials(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req UpdateProxyCredentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.GinBadRequest(c, "请求参数无效: "+err.Error())
+		return
+	}
+
+	credentials, err := h.proxyCredSvc.ReplaceUserCredentials(userID, req.Credentials)
+	if err != nil {
+		response.GinBadRequest(c, err.Error())
+		return
+	}
+
+	/* 立即下发到节点，吊销或轮换的密码不再等待其他变更触发的同步 */
+	if h.syncSvc != nil {
+		if err := h.syncSvc.OnUserProxyCredentialsUpdated(c.Request.Context(), userID); err != nil {
+			h.logger.Error("同步代理凭据失败", zap.String("user_id", userID), zap.Error(err))
+		}
+	}
+
+	response.GinSuccessWithMessage(c, "代理凭据已更新", credentials)
 }
 
 /*
@@ -328,17 +404,29 @@ func (h *UserHandler) GetCurrentUser(c *gin.Context) {
 
 /*
 ToggleUserStatus 启用/禁用用户（管理员）
+功能：禁用时吊销该用户全部会话，立即下线
 路由：POST /api/v1/users/:id/status/update
 */
 func (h *UserHandler) ToggleUserStatus(c *gin.Context) {
 	targetUserID := c.Param("id")
 	currentUserID := middleware.GetUserID(c)
 
+	previous, _ := h.userSvc.GetUser(targetUserID)
 	newStatus, err := h.userSvc.ToggleUserStatus(targetUserID, currentUserID)
 	if err != nil {
 		response.GinBadRequest(c, err.Error())
 		return
 	}
+	if !newStatus {
+		if _, err := h.sessions.RevokeAll(targetUserID, "", service.SessionRevokeUserDisabled); err != nil {
+			h.logger.Error("禁用用户后吊销会话失败", zap.String("userID", targetUserID), zap.Error(err))
+		}
+	}
+
+	if previous != nil {
+		middleware.AuditChange(c, "user.status_update", "user:"+targetUserID,
+			gin.H{"enabled": previous.Enabled}, gin.H{"enabled": newStatus})
+	}
 
 	response.GinSuccessWithMessage(c, "用户状态已更新", gin.H{
 		"user_id": targetUserID,
@@ -367,11 +455,17 @@ func (h *UserHandler) UpdateUserRole(c *gin.Context) {
 		return
 	}
 
+	previous, _ := h.userSvc.GetUser(targetUserID)
 	if err := h.userSvc.UpdateUserRole(targetUserID, currentUserID, req.Role); err != nil {
 		response.GinBadRequest(c, err.Error())
 		return
 	}
 
+	if previous != nil {
+		middleware.AuditChange(c, "user.role_update", "user:"+targetUserID,
+			gin.H{"role": previous.Role}, gin.H{"role": req.Role})
+	}
+
 	response.GinSuccessWithMessage(c, "用户角色已更新", gin.H{
 		"user_id": targetUserID,
 		"role":    req.Role,
@@ -386,10 +480,16 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 	targetUserID := c.Param("id")
 	currentUserID := middleware.GetUserID(c)
 
+	previous, _ := h.userSvc.GetUser(targetUserID)
 	if err := h.userSvc.DeleteUser(targetUserID, currentUserID); err != nil {
 		response.GinBadRequest(c, err.Error())
 		return
 	}
+	if _, err := h.sessions.RevokeAll(targetUserID, "", service.SessionRevokeUserDeleted); err != nil {
+		h.logger.Error("删除用户后吊销会话失败", zap.String("userID", targetUserID), zap.Error(err))
+	}
+
+	middleware.AuditChange(c, "user.delete", "user:"+targetUserID, previous, nil)
 
 	response.GinSuccessWithMessage(c, "用户已删除", nil)
 }
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"gkipass/plane/internal/api/response"
+	"gkipass/plane/internal/service"
+)
+
+/*
+apiTokenRoutes API 令牌可访问的路由及所需权限范围
+功能：按路由模板（c.FullPath()）匹配，path 本身或其下级路由均适用；GET/HEAD 需要 read，其余方法需要 write，
+write 为空表示只读。未列出的路由（账户、令牌管理、管理后台等）一律拒绝 API 令牌
+*/
+var apiTokenRoutes = []struct {
+	path  string
+	read  string
+	write string
+}{
+	{"/api/v1/tunnels", service.ScopeTunnelsRead, service.ScopeTunnelsWrite},
+	{"/api/v1/statistics/overview", service.ScopeStatsRead, ""},
+	{"/api/v1/statistics/nodes/:id", service.ScopeStatsRead, ""},
+	{"/api/v1/traffic/stats", service.ScopeStatsRead, ""},
+	{"/api/v1/traffic/summary", service.ScopeStatsRead, ""},
+	{"/api/v1/nodes/available", service.ScopeNodesRead, ""},
+	{"/api/v1/nodes/list", service.ScopeNodesRead, ""},
+	{"/api/v1/nodes/status/list", service.ScopeNodesRead, ""},
+	{"/api/v1/node-groups/list", service.ScopeNodesRead, ""},
+}
+
+/* apiTokenRequiredScope 返回路由所需的权限范围，空字符串表示 API 令牌不可访问 */
+func apiTokenRequiredScope(method, fullPath string) string {
+	for _, route := range apiTokenRoutes {
+		if fullPath != route.path && !strings.HasPrefix(fullPath, route.path+"/") {
+			continue
+		}
+		if method == http.MethodGet || method == http.MethodHead {
+			return route.read
+		}
+		return route.write
+	}
+	return ""
+}
+
+/*
+apiTokenAuth 使用用户个人 API 令牌认证
+功能：校验令牌和路由所需的权限范围，注入与 JWT 相同的用户信息，另外注入 api_token_id 和 api_token_scopes
+*/
+func apiTokenAuth(c *gin.Context, authService *service.AuthService, raw string) {
+	tokens := authService.GetAPITokenService()
+	if tokens == nil {
+		response.GinUnauthorized(c, "无效或已过期的令牌")
+		c.Abort()
+		return
+	}
+
+	token, user, err := tokens.Authenticate(raw, c.ClientIP())
+	if err != nil {
+		response.GinUnauthorized(c, err.Error())
+		c.Abort()
+		return
+	}
+
+	scopes := service.APITokenScopeList(token)
+	required := apiTokenRequiredScope(c.Request.Method, c.FullPath())
+	if required == "" {
+		response.GinForbidden(c, "API 令牌不能访问该接口")
+		c.Abort()
+		return
+	}
+	if !service.HasAPITokenScope(scopes, required) {
+		response.GinForbidden(c, "API 令牌缺少权限范围 "+required)
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", string(user.Role))
+	c.Set("api_token_id", token.ID)
+	c.Set("api_token_scopes", scopes)
+	c.Next()
+}
@@ -1,19 +1,53 @@
 package middleware
 
 import (
+	"context"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+
+	"gkipass/plane/internal/service"
 )
 
+/* auditChangesKey 处理器登记的资源变更在 gin.Context 中的键 */
+const auditChangesKey = "audit_changes"
+
+/* auditChange 处理器登记的一次资源变更 */
+type auditChange struct {
+	action   string
+	resource string
+	before   interface{}
+	after    interface{}
+}
+
+/*
+AuditChange 登记本次请求对资源的变更
+功能：由处理器在变更成功后调用，before/after 为变更前后的对象（创建时 before 为 nil，删除时 after 为 nil），
+AuditLog 中间件在请求结束后把每条变更写入审计日志；同一请求可登记多条（如批量操作）
+*/
+func AuditChange(c *gin.Context, action, resource string, before, after interface{}) {
+	var changes []auditChange
+	if v, ok := c.Get(auditChangesKey); ok {
+		changes, _ = v.([]auditChange)
+	}
+	c.Set(auditChangesKey, append(changes, auditChange{
+		action:   action,
+		resource: resource,
+		before:   before,
+		after:    after,
+	}))
+}
+
 /*
 AuditLog 审计日志中间件
 功能：对写操作（POST/PUT/DELETE）自动记录审计日志，
 包含用户 ID、请求方法、路径、客户端 IP、请求 ID 和响应状态码。
 跳过公开端点（/auth/login、/auth/register、/captcha 等）避免噪音。
+处理器通过 AuditChange 登记了变更时按变更逐条持久化（含前后差异），否则持久化一条请求记录；
+节点心跳、数据上报等高频端点只写结构化日志。
 */
-func AuditLog() gin.HandlerFunc {
+func AuditLog(audit *service.AuditService) gin.HandlerFunc {
 	/* 不需要审计的公开路径前缀 */
 	skipPrefixes := []string{
 		"/api/v1/auth/login",
@@ -23,6 +57,11 @@ func AuditLog() gin.HandlerFunc {
 		"/health",
 		"/metrics",
 	}
+	/* 只写结构化日志、不持久化的高频端点后缀 */
+	skipPersistSuffixes := []string{
+		"/heartbeat",
+		"/report",
+	}
 
 	return func(c *gin.Context) {
 		method := c.Request.Method
@@ -63,6 +102,55 @@ func AuditLog() gin.HandlerFunc {
 			zap.String("path", path),
 			zap.String("client_ip", c.ClientIP()),
 			zap.Int("status", status),
+			zap.String("api_token_id", GetAPITokenID(c)),
 		)
+
+		if audit == nil {
+			return
+		}
+		for _, suffix := range skipPersistSuffixes {
+			if strings.HasSuffix(path, suffix) {
+				return
+			}
+		}
+
+		entry := service.AuditEntry{
+			UserID:    userID,
+			Username:  username,
+			Method:    method,
+			Path:      path,
+			Status:    status,
+			RequestID: GetRequestID(c),
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		}
+		if tokenID := GetAPITokenID(c); tokenID != "" {
+			entry.Detail = map[string]string{"api_token_id": tokenID}
+		}
+
+		/* 客户端断开不影响审计记录写入 */
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		var changes []auditChange
+		if v, ok := c.Get(auditChangesKey); ok {
+			changes, _ = v.([]auditChange)
+		}
+		if len(changes) == 0 {
+			entry.Action = "api." + strings.ToLower(method)
+			entry.Resource = c.FullPath()
+			if entry.Resource == "" {
+				entry.Resource = path
+			}
+			_, _ = audit.Record(ctx, &entry)
+			return
+		}
+		for _, change := range changes {
+			e := entry
+			e.Action = change.action
+			e.Resource = change.resource
+			e.Before = change.before
+			e.After = change.after
+			_, _ = audit.Record(ctx, &e)
+		}
 	}
 }
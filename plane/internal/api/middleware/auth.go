@@ -15,14 +15,15 @@ import (
 /*
 GenerateJWT 生成 JWT 令牌
 功能：使用 HMAC-SHA256 签名算法生成包含用户信息的 JWT 令牌
-参数：userID 用户ID, username 用户名, role 角色, jwtSecret 签名密钥, expiresInHours 有效期(小时)
+参数：userID 用户ID, username 用户名, role 角色, sessionID 登录会话ID, jwtSecret 签名密钥, expiresInHours 有效期(小时)
 */
-func GenerateJWT(userID, username, role, jwtSecret string, expiresInHours int) (string, error) {
+func GenerateJWT(userID, username, role, sessionID, jwtSecret string, expiresInHours int) (string, error) {
 	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id":  userID,
 		"username": username,
 		"role":     role,
+		"sid":      sessionID,
 		"iat":      now.Unix(),
 		"exp":      now.Add(time.Duration(expiresInHours) * time.Hour).Unix(),
 	}
@@ -35,10 +36,28 @@ func GenerateJWT(userID, username, role, jwtSecret string, expiresInHours int) (
 	return signed, nil
 }
 
+/*
+OptionalJWTAuth 可选的 JWT 认证中间件
+功能：携带 Authorization 头时按 JWTAuth 校验并注入用户信息，未携带时以匿名身份继续；
+用于单点登录回调等公开路由中识别当前登录用户
+*/
+func OptionalJWTAuth(authService *service.AuthService) gin.HandlerFunc {
+	auth := JWTAuth(authService)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		auth(c)
+	}
+}
+
 /*
 JWTAuth 返回 Gin JWT 认证中间件
 功能：从 Authorization 头提取 Bearer 令牌，使用 HMAC-SHA256 验证签名，
-解析 claims 并注入 Gin 上下文供后续 handler 使用
+解析 claims 并注入 Gin 上下文供后续 handler 使用；
+设置了会话服务时校验 claims 中的会话 ID，会话吊销后令牌立即失效；
+以 gkp_ 开头的令牌按用户个人 API 令牌认证（需先调用 authService.SetAPITokenService）
 */
 func JWTAuth(authService *service.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -57,6 +76,11 @@ func JWTAuth(authService *service.AuthService) gin.HandlerFunc {
 			return
 		}
 
+		if strings.HasPrefix(tokenStr, service.APITokenPrefix) {
+			apiTokenAuth(c, authService, tokenStr)
+			return
+		}
+
 		/* 解析并验证 JWT */
 		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
 			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -78,9 +102,21 @@ func JWTAuth(authService *service.AuthService) gin.HandlerFunc {
 			return
 		}
 
+		/* 校验登录会话（吊销、过期） */
+		sessionID, _ := claims["sid"].(string)
+		if sessions := authService.GetSessionService(); sessions != nil {
+			userID, _ := claims["user_id"].(string)
+			if err := sessions.Validate(sessionID, userID, c.ClientIP()); err != nil {
+				response.GinUnauthorized(c, service.ErrSessionInvalid.Error())
+				c.Abort()
+				return
+			}
+		}
+
 		c.Set("user_id", claims["user_id"])
 		c.Set("username", claims["username"])
 		c.Set("role", claims["role"])
+		c.Set("session_id", sessionID)
 		c.Set("user_claims", claims)
 		c.Next()
 	}
@@ -26,6 +26,20 @@ func GetUsername(c *gin.Context) string {
 	return s
 }
 
+/* GetSessionID 从上下文提取当前登录会话 ID，API 令牌认证时为空 */
+func GetSessionID(c *gin.Context) string {
+	v, _ := c.Get("session_id")
+	s, _ := v.(string)
+	return s
+}
+
+/* GetAPITokenID 使用 API 令牌认证时返回令牌 ID，JWT 认证时为空 */
+func GetAPITokenID(c *gin.Context) string {
+	v, _ := c.Get("api_token_id")
+	s, _ := v.(string)
+	return s
+}
+
 /*
 GetRole 从上下文安全提取用户角色
 兼容 string 和自定义 string 类型（如 models.UserRole）
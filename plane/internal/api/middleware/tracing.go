@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"gkipass/plane/internal/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+Tracing 链路追踪中间件
+功能：为每个请求创建服务端 span 并写入 c.Request 的 context，供后续服务层创建子 span；
+若调用方携带 traceparent 则接入调用方的链路。有效链路的 trace ID 写入 X-Trace-ID 响应头，
+便于按请求在追踪系统中定位隧道变更在面板和节点上的完整过程。
+须在 RequestID 之后注册，以便记录请求 ID。
+*/
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := tracing.Propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		name := c.Request.Method + " " + route
+		if route == "" {
+			name = c.Request.Method
+		}
+
+		ctx, span := tracing.StartKind(ctx, name, trace.SpanKindServer,
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", c.Request.URL.Path),
+			attribute.String("client.address", c.ClientIP()),
+			attribute.String("gkipass.request_id", GetRequestID(c)))
+		defer span.End()
+
+		if traceID := tracing.TraceID(ctx); traceID != "" {
+			c.Header("X-Trace-ID", traceID)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if userID := GetUserID(c); userID != "" {
+			span.SetAttributes(attribute.String("gkipass.user_id", userID))
+		}
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
@@ -32,6 +32,7 @@ func SetupRouter(app *App, wsServer *ws.Server) *gin.Engine {
 	// 全局中间件
 	router.Use(middleware.Recovery())
 	router.Use(middleware.RequestID())
+	router.Use(middleware.Tracing())
 	router.Use(middleware.SecurityHeaders())
 	router.Use(middleware.BodyLimit(2 << 20)) /* 2MB 请求体上限，防止 OOM */
 	router.Use(middleware.Logger())
@@ -101,18 +102,42 @@ func SetupRouter(app *App, wsServer *ws.Server) *gin.Engine {
 
 		/* 登录限流器：每个 IP 每 15 分钟最多 10 次登录尝试 */
 		loginLimiter := middleware.NewLoginRateLimiter(10, 15*time.Minute)
+		/* 两步验证限流器：一次登录可能包含挑战、校验多次请求，放宽到 30 次；账户级锁定由 MFAService 负责 */
+		mfaLimiter := middleware.NewLoginRateLimiter(30, 15*time.Minute)
+		auditService := service.NewAuditService(app.DB.GormDB)
+		mfaHandler := security.NewMFAHandler(app)
+		ssoHandler := security.NewSSOHandler(app, service.NewSSOService(app.DB.GormDB, app.DB.RedisClient(), app.Config.Auth.OIDC), auditService)
+		authService := service.NewAuthService()
+		authService.SetJWTSecret(app.Config.Auth.JWTSecret)
+		authService.SetAPITokenService(service.NewAPITokenService(app.DB.GormDB))
+		authService.SetSessionService(service.NewSessionService(app.DB.GormDB, app.Config.Auth.RefreshDays))
 
 		// 认证路由（无需JWT）
 		auth := v1.Group("/auth")
 		{
 			authHandler := security.NewAuthHandler(app)
-			userHandler := user.NewUserHandler(app)
+			userHandler := user.NewUserHandler(app, wsServer.GetSyncService())
 
 			auth.POST("/register", userHandler.Register)
 			auth.POST("/login", loginLimiter.Middleware(), authHandler.Login)
 			auth.POST("/logout", authHandler.Logout)
 			auth.POST("/refresh", authHandler.RefreshToken)
 
+			// 通用 OIDC 单点登录
+			auth.GET("/sso/providers", ssoHandler.Providers)
+			auth.GET("/sso/:provider/login", ssoHandler.Login)
+			auth.POST("/sso/:provider/callback", loginLimiter.Middleware(), middleware.OptionalJWTAuth(authService), ssoHandler.Callback)
+
+			// 两步验证（凭登录返回的临时令牌）
+			mfa := auth.Group("/mfa", mfaLimiter.Middleware())
+			{
+				mfa.POST("/verify", mfaHandler.Verify)
+				mfa.POST("/webauthn/begin", mfaHandler.WebAuthnLoginBegin)
+				mfa.POST("/webauthn/finish", mfaHandler.WebAuthnLoginFinish)
+				mfa.POST("/enroll/totp", mfaHandler.EnrollTOTP)
+				mfa.POST("/enroll/totp/confirm", middleware.AuditLog(auditService), mfaHandler.EnrollTOTPConfirm)
+			}
+
 			// GitHub OAuth
 			if app.Config.Auth.GitHub.Enabled {
 				oauthHandler := security.NewOAuthHandler(app)
@@ -123,32 +148,63 @@ func SetupRouter(app *App, wsServer *ws.Server) *gin.Engine {
 
 		// 需要JWT认证的路由
 		authorized := v1.Group("")
-		authService := service.NewAuthService()
-		authService.SetJWTSecret(app.Config.Auth.JWTSecret)
 		authorized.Use(middleware.JWTAuth(authService))
-		authorized.Use(middleware.AuditLog())
+		authorized.Use(middleware.AuditLog(auditService))
 		{
 			// 用户管理
 			users := authorized.Group("/users")
 			{
-				userHandler := user.NewUserHandler(app)
+				userHandler := user.NewUserHandler(app, wsServer.GetSyncService())
 				users.GET("/me", userHandler.GetCurrentUser)              // 获取当前用户完整信息
 				users.GET("/permissions", userHandler.GetUserPermissions) // 获取用户权限详情
 				users.GET("/profile", userHandler.GetProfile)             // 获取基本信息（保留兼容）
 				users.POST("/profile/update", userHandler.UpdateProfile)
 				users.POST("/password/update", userHandler.UpdatePassword)
+				users.GET("/proxy-credentials", userHandler.GetProxyCredentials)
+				users.POST("/proxy-credentials/update", userHandler.UpdateProxyCredentials)
+
+				// 两步验证
+				users.GET("/mfa", mfaHandler.Status)
+				users.POST("/mfa/totp/setup", mfaHandler.SetupTOTP)
+				users.POST("/mfa/totp/confirm", mfaHandler.ConfirmTOTP)
+				users.POST("/mfa/totp/disable", mfaHandler.DisableTOTP)
+				users.POST("/mfa/recovery-codes/regenerate", mfaHandler.RegenerateRecoveryCodes)
+				users.POST("/mfa/webauthn/register/begin", mfaHandler.WebAuthnRegisterBegin)
+				users.POST("/mfa/webauthn/register/finish", mfaHandler.WebAuthnRegisterFinish)
+				users.POST("/mfa/webauthn/credentials/:id/delete", mfaHandler.DeleteWebAuthnCredential)
+
+				// 单点登录外部身份
+				users.GET("/sso/identities", ssoHandler.Identities)
+				users.POST("/sso/:provider/link", ssoHandler.Link)
+				users.POST("/sso/identities/:id/delete", ssoHandler.Unlink)
+
+				// 个人 API 令牌（供 CI 等自动化调用，只能用登录令牌管理）
+				apiTokenHandler := security.NewAPITokenHandler(app)
+				users.GET("/api-tokens", apiTokenHandler.List)
+				users.GET("/api-tokens/scopes", apiTokenHandler.Scopes)
+				users.POST("/api-tokens/create", apiTokenHandler.Create)
+				users.POST("/api-tokens/:id/revoke", apiTokenHandler.Revoke)
+
+				// 登录会话
+				sessionHandler := security.NewSessionHandler(app)
+				users.GET("/sessions", sessionHandler.List)
+				users.POST("/sessions/:id/revoke", sessionHandler.Revoke)
+				users.POST("/sessions/revoke-others", sessionHandler.RevokeOthers)
 
 				// 管理员功能
 				users.GET("", middleware.AdminAuth(), userHandler.ListUsers)
 				users.POST("/:id/status/update", middleware.AdminAuth(), userHandler.ToggleUserStatus)
 				users.POST("/:id/role/update", middleware.AdminAuth(), userHandler.UpdateUserRole)
 				users.POST("/:id/delete", middleware.AdminAuth(), userHandler.DeleteUser)
+				users.POST("/:id/mfa/reset", middleware.AdminAuth(), mfaHandler.Reset)
+				users.GET("/:id/sessions", middleware.AdminAuth(), sessionHandler.AdminList)
+				users.POST("/:id/sessions/revoke", middleware.AdminAuth(), sessionHandler.AdminRevokeAll)
 			}
 
 			// 节点组管理
 			groups := authorized.Group("/node-groups")
 			{
-				groupHandler := node.NewNodeGroupHandler(app)
+				groupHandler := node.NewNodeGroupHandler(app, wsServer.GetSyncService())
 				configHandler := node.NewNodeGroupConfigHandler(app)
 
 				/* 所有用户可查看节点组列表和详情 */
@@ -171,6 +227,8 @@ func SetupRouter(app *App, wsServer *ws.Server) *gin.Engine {
 				ckHandler := security.NewCKHandler(app)
 				statusHandler := node.NewNodeStatusHandler(app)
 				certHandler := node.NewNodeCertHandler(app)
+				commandHandler := node.NewNodeCommandHandler(wsServer.GetCommandService())
+				logHandler := node.NewNodeLogHandler(app, wsServer.GetLogStreams())
 
 				/* 所有用户可查看节点（可用节点根据套餐过滤） */
 				nodes.GET("/available", nodeHandler.GetAvailableNodes)
@@ -181,6 +239,9 @@ func SetupRouter(app *App, wsServer *ws.Server) *gin.Engine {
 				nodes.GET("/group/:group_id/status", statusHandler.GetNodesByGroup)
 				nodes.GET("/:id/cert/info", certHandler.GetCertInfo)
 
+				/* 实时日志：管理员可查看全部日志，普通用户只能查看自己隧道的日志 */
+				nodes.GET("/:id/logs/stream", logHandler.Stream)
+
 				/* 管理员专用：节点增删改、CK 管理、证书操作 */
 				nodes.POST("/create", middleware.AdminAuth(), nodeHandler.Create)
 				nodes.POST("/:id/update", middleware.AdminAuth(), nodeHandler.Update)
@@ -192,6 +253,12 @@ func SetupRouter(app *App, wsServer *ws.Server) *gin.Engine {
 				nodes.POST("/:id/cert/generate", middleware.AdminAuth(), certHandler.GenerateCert)
 				nodes.GET("/:id/cert/download", middleware.AdminAuth(), certHandler.DownloadCert)
 				nodes.POST("/:id/cert/renew", middleware.AdminAuth(), certHandler.RenewCert)
+
+				/* 管理员专用：远程命令（经节点 WebSocket 下发，记录审计日志） */
+				nodes.GET("/commands/available", middleware.AdminAuth(), commandHandler.ListCommands)
+				nodes.POST("/:id/commands", middleware.AdminAuth(), commandHandler.Execute)
+				nodes.GET("/:id/commands", middleware.AdminAuth(), commandHandler.List)
+				nodes.GET("/:id/commands/:command_id", middleware.AdminAuth(), commandHandler.Get)
 			}
 
 			// 节点部署 API
@@ -256,7 +323,7 @@ func SetupRouter(app *App, wsServer *ws.Server) *gin.Engine {
 			tunnels := authorized.Group("/tunnels")
 			tunnels.Use(middleware.QuotaCheck(app.DB.GormDB))
 			{
-				tunnelHandler := tunnel.NewGinTunnelHandler(app)
+				tunnelHandler := tunnel.NewGinTunnelHandler(app, wsServer.GetSyncService())
 				tunnels.GET("/list", tunnelHandler.List)
 				tunnels.GET("/:id", tunnelHandler.Get)
 				tunnels.POST("/create", tunnelHandler.Create)
@@ -266,6 +333,16 @@ func SetupRouter(app *App, wsServer *ws.Server) *gin.Engine {
 				tunnels.POST("/batch-toggle", middleware.AdminAuth(), tunnelHandler.BatchToggle)
 			}
 
+			// 规则分批发布（管理员）
+			rollouts := authorized.Group("/rollouts")
+			rollouts.Use(middleware.AdminAuth())
+			{
+				rolloutHandler := tunnel.NewRolloutHandler(wsServer.GetSyncService())
+				rollouts.GET("/list", rolloutHandler.List)
+				rollouts.GET("/:id", rolloutHandler.Get)
+				rollouts.POST("/:id/cancel", rolloutHandler.Cancel)
+			}
+
 			// 统计和监控
 			stats := authorized.Group("/statistics")
 			{
@@ -298,10 +375,22 @@ func SetupRouter(app *App, wsServer *ws.Server) *gin.Engine {
 				monitoring.GET("/nodes/:id/alerts", monitoringHandler.GetNodeAlerts)
 				monitoring.GET("/nodes/:id/alert-rules", monitoringHandler.ListAlertRules)
 				monitoring.POST("/nodes/:id/alert-rules", middleware.AdminAuth(), monitoringHandler.CreateAlertRule)
+				monitoring.GET("/alert-rules", middleware.AdminAuth(), monitoringHandler.ListAllAlertRules)
+				monitoring.POST("/alert-rules", middleware.AdminAuth(), monitoringHandler.CreateAlertRule)
 				monitoring.PUT("/alert-rules/:rule_id", middleware.AdminAuth(), monitoringHandler.UpdateAlertRule)
 				monitoring.DELETE("/alert-rules/:rule_id", middleware.AdminAuth(), monitoringHandler.DeleteAlertRule)
 				monitoring.POST("/alerts/:alert_id/acknowledge", middleware.AdminAuth(), monitoringHandler.AcknowledgeAlert)
 				monitoring.POST("/alerts/:alert_id/resolve", middleware.AdminAuth(), monitoringHandler.ResolveAlert)
+				monitoring.GET("/alert-channels", middleware.AdminAuth(), monitoringHandler.ListAlertChannels)
+				monitoring.POST("/alert-channels", middleware.AdminAuth(), monitoringHandler.CreateAlertChannel)
+				monitoring.PUT("/alert-channels/:channel_id", middleware.AdminAuth(), monitoringHandler.UpdateAlertChannel)
+				monitoring.DELETE("/alert-channels/:channel_id", middleware.AdminAuth(), monitoringHandler.DeleteAlertChannel)
+				monitoring.POST("/alert-channels/:channel_id/test", middleware.AdminAuth(), monitoringHandler.TestAlertChannel)
+				monitoring.GET("/alert-deliveries", middleware.AdminAuth(), monitoringHandler.ListAlertDeliveries)
+				monitoring.GET("/silences", middleware.AdminAuth(), monitoringHandler.ListAlertSilences)
+				monitoring.POST("/silences", middleware.AdminAuth(), monitoringHandler.CreateAlertSilence)
+				monitoring.POST("/silences/:silence_id/expire", middleware.AdminAuth(), monitoringHandler.ExpireAlertSilence)
+				monitoring.DELETE("/silences/:silence_id", middleware.AdminAuth(), monitoringHandler.DeleteAlertSilence)
 				monitoring.GET("/permissions", middleware.AdminAuth(), monitoringHandler.ListMonitoringPermissions)
 				monitoring.POST("/permissions", middleware.AdminAuth(), monitoringHandler.CreateMonitoringPermission)
 				monitoring.GET("/my-permissions", monitoringHandler.GetMyMonitoringPermissions)
@@ -386,6 +475,14 @@ func SetupRouter(app *App, wsServer *ws.Server) *gin.Engine {
 				admin.POST("/settings/security/update", settingsHandler.UpdateSecuritySettings)
 				admin.GET("/settings/notification", settingsHandler.GetNotificationSettings)
 				admin.POST("/settings/notification/update", settingsHandler.UpdateNotificationSettings)
+				admin.GET("/settings/sso", settingsHandler.GetSSOSettings)
+				admin.POST("/settings/sso/update", settingsHandler.UpdateSSOSettings)
+
+				// 审计日志
+				auditHandler := system.NewAuditHandler(auditService)
+				admin.GET("/audit-logs", auditHandler.List)
+				admin.GET("/audit-logs/export", auditHandler.Export)
+				admin.GET("/audit-logs/verify", auditHandler.Verify)
 
 				// 公告管理
 				admin.GET("/announcements", announcementHandler.ListAll)
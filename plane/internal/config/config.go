@@ -17,6 +17,9 @@ type Config struct {
 	Log      LogConfig      `yaml:"log"`
 	Captcha  CaptchaConfig  `yaml:"captcha"`
 	Payment  PaymentConfig  `yaml:"payment"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Cluster  ClusterConfig  `yaml:"cluster"`
+	Rollout  RolloutConfig  `yaml:"rollout"`
 }
 
 // ServerConfig 服务器配置
@@ -70,10 +73,46 @@ type RedisConfig struct {
 
 // AuthConfig 认证配置
 type AuthConfig struct {
-	JWTSecret     string      `yaml:"jwt_secret"`
-	JWTExpiration int         `yaml:"jwt_expiration"` // 单位：小时
-	AdminPassword string      `yaml:"admin_password"`
-	GitHub        GitHubOAuth `yaml:"github"`
+	JWTSecret     string         `yaml:"jwt_secret"`
+	JWTExpiration int            `yaml:"jwt_expiration"` // 单位：小时
+	RefreshDays   int            `yaml:"refresh_days"`   // 刷新令牌有效期（天），每次刷新后重新计算
+	AdminPassword string         `yaml:"admin_password"`
+	GitHub        GitHubOAuth    `yaml:"github"`
+	MFA           MFAConfig      `yaml:"mfa"`
+	OIDC          []OIDCProvider `yaml:"oidc"` // 通用 OIDC 单点登录，管理员也可在「单点登录设置」中维护（同名时设置优先）
+}
+
+// OIDCProvider 通用 OpenID Connect 登录提供方（Keycloak、Azure AD 等），同时用于管理员设置的 JSON
+type OIDCProvider struct {
+	Name          string          `yaml:"name" json:"name"`                 // 唯一标识，用于登录路径和用户来源 oidc:<name>
+	DisplayName   string          `yaml:"display_name" json:"display_name"` // 登录按钮显示名
+	Enabled       bool            `yaml:"enabled" json:"enabled"`
+	Issuer        string          `yaml:"issuer" json:"issuer"` // 如 https://sso.example.com/realms/main、https://login.microsoftonline.com/<tenant>/v2.0
+	ClientID      string          `yaml:"client_id" json:"client_id"`
+	ClientSecret  string          `yaml:"client_secret" json:"client_secret"`
+	RedirectURL   string          `yaml:"redirect_url" json:"redirect_url"`     // 前端回调页，收到 code/state 后提交到 /auth/sso/<name>/callback
+	Scopes        []string        `yaml:"scopes" json:"scopes"`                 // 默认 openid profile email
+	UsernameClaim string          `yaml:"username_claim" json:"username_claim"` // 默认 preferred_username
+	GroupsClaim   string          `yaml:"groups_claim" json:"groups_claim"`     // 支持点分路径（如 realm_access.roles），默认 groups
+	AdminGroups   []string        `yaml:"admin_groups" json:"admin_groups"`     // 属于其中任一组的用户为管理员
+	AllowedGroups []string        `yaml:"allowed_groups" json:"allowed_groups"` // 非空时只允许这些组的用户登录
+	GroupPlans    []OIDCGroupPlan `yaml:"group_plans" json:"group_plans"`       // 按组自动开通套餐，按顺序取第一个匹配
+	AutoCreate    bool            `yaml:"auto_create" json:"auto_create"`       // 首次登录自动创建用户
+	LinkByEmail   bool            `yaml:"link_by_email" json:"link_by_email"`   // 邮箱已验证且与本地用户一致时自动关联
+}
+
+// OIDCGroupPlan 组到套餐的映射
+type OIDCGroupPlan struct {
+	Group  string `yaml:"group" json:"group"`
+	PlanID string `yaml:"plan_id" json:"plan_id"`
+}
+
+// MFAConfig 两步验证配置（TOTP、WebAuthn）
+type MFAConfig struct {
+	Issuer          string   `yaml:"issuer"`           // 验证器 App 中显示的发行方
+	WebAuthnRPID    string   `yaml:"webauthn_rp_id"`   // WebAuthn RP ID（面板域名），为空时取第一个允许来源的主机名
+	WebAuthnRPName  string   `yaml:"webauthn_rp_name"` // 注册通行密钥时显示的站点名
+	WebAuthnOrigins []string `yaml:"webauthn_origins"` // 允许的来源（如 https://panel.example.com），为空时为 https://<RP ID>；两者都未配置时不启用 WebAuthn
 }
 
 // GitHubOAuth GitHub OAuth2 配置
@@ -105,6 +144,35 @@ type LogConfig struct {
 	Compress   bool   `yaml:"compress"`    // 是否压缩
 }
 
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`      // 是否启用 OpenTelemetry 链路追踪
+	Exporter    string  `yaml:"exporter"`     // 导出方式: otlp, file
+	Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP 收集器地址 (host:port)
+	Insecure    bool    `yaml:"insecure"`     // 不使用 TLS 连接收集器
+	FilePath    string  `yaml:"file_path"`    // 文件导出路径
+	SampleRatio float64 `yaml:"sample_ratio"` // 采样率 (0,1]
+	ServiceName string  `yaml:"service_name"` // 上报的服务名
+}
+
+// ClusterConfig 多实例部署配置（依赖 Redis）
+type ClusterConfig struct {
+	Enabled    bool   `yaml:"enabled"`     // 是否启用多实例：定时任务选主、跨实例消息转发、全局在线节点表
+	InstanceID string `yaml:"instance_id"` // 实例 ID，为空时使用主机名加随机后缀
+	LeaderTTL  int    `yaml:"leader_ttl"`  // 主实例租约时长（秒），主实例宕机后最长该时长内由其他实例接管
+	NodeTTL    int    `yaml:"node_ttl"`    // 在线节点登记有效期（秒），实例宕机后其节点在该时长后视为离线
+}
+
+// RolloutConfig 规则分批发布配置（隧道更新、节点组反向模式变更）
+type RolloutConfig struct {
+	Enabled           bool    `yaml:"enabled"`             // 是否启用分批发布，关闭时变更立即推送到全部节点
+	CanaryPercent     int     `yaml:"canary_percent"`      // 金丝雀批次占在线节点的百分比（至少 1 个节点）
+	Waves             int     `yaml:"waves"`               // 金丝雀之后的推进批次数
+	BakeSeconds       int     `yaml:"bake_seconds"`        // 每批节点确认后的观察时长（秒）
+	AckTimeoutSeconds int     `yaml:"ack_timeout_seconds"` // 等待节点确认的超时（秒），超时即回滚
+	MaxErrorRate      float64 `yaml:"max_error_rate"`      // 允许的连接失败率 (0,1]，超过即回滚
+}
+
 // CaptchaConfig 验证码配置
 type CaptchaConfig struct {
 	Enabled        bool   `yaml:"enabled"`         // 是否启用验证码
@@ -198,6 +266,9 @@ func LoadConfigOrDefault(path string) *Config {
 	if config.Auth.JWTExpiration <= 0 {
 		config.Auth.JWTExpiration = 24
 	}
+	if config.Auth.RefreshDays <= 0 {
+		config.Auth.RefreshDays = 30
+	}
 	if config.Server.Port <= 0 || config.Server.Port > 65535 {
 		config.Server.Port = 8080
 	}
@@ -250,6 +321,7 @@ func DefaultConfig() *Config {
 		Auth: AuthConfig{
 			JWTSecret:     "change-this-secret-in-production",
 			JWTExpiration: 24,
+			RefreshDays:   30,
 			AdminPassword: "admin123",
 			GitHub: GitHubOAuth{
 				Enabled:      false,
@@ -257,6 +329,10 @@ func DefaultConfig() *Config {
 				ClientSecret: "",
 				RedirectURL:  "http://localhost:3000/auth/callback/github",
 			},
+			MFA: MFAConfig{
+				Issuer:         "GKIPass",
+				WebAuthnRPName: "GKIPass",
+			},
 		},
 		TLS: TLSConfig{
 			Enabled:    false,
@@ -279,6 +355,28 @@ func DefaultConfig() *Config {
 			CallbackSecret: "",
 			CryptoSalt:     "",
 		},
+		Tracing: TracingConfig{
+			Enabled:     false,
+			Exporter:    "otlp",
+			Endpoint:    "127.0.0.1:4318",
+			Insecure:    true,
+			FilePath:    "./logs/traces.jsonl",
+			SampleRatio: 1.0,
+			ServiceName: "gkipass-plane",
+		},
+		Cluster: ClusterConfig{
+			Enabled:   false,
+			LeaderTTL: 15,
+			NodeTTL:   90,
+		},
+		Rollout: RolloutConfig{
+			Enabled:           false,
+			CanaryPercent:     10,
+			Waves:             3,
+			BakeSeconds:       60,
+			AckTimeoutSeconds: 30,
+			MaxErrorRate:      0.05,
+		},
 		Captcha: CaptchaConfig{
 			Enabled:              false,
 			Type:                 "gocaptcha",
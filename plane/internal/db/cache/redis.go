@@ -46,6 +46,11 @@ func (r *RedisCache) Close() error {
 	return r.client.Close()
 }
 
+// Client 获取底层 Redis 客户端（分布式锁、发布订阅等需要原生命令的场景）
+func (r *RedisCache) Client() *redis.Client {
+	return r.client
+}
+
 // === Session 操作 ===
 
 // SetSession 设置会话
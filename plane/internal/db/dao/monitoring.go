@@ -110,6 +110,52 @@ func (d *DAO) ListNodeAlertRules(nodeID string) ([]*models.NodeAlertRule, error)
 	return rules, err
 }
 
+/*
+ListAlertRules 列出告警规则
+功能：scope 为空时返回全部，按创建时间排序
+*/
+func (d *DAO) ListAlertRules(scope string) ([]*models.NodeAlertRule, error) {
+	var rules []*models.NodeAlertRule
+	q := d.DB.Model(&models.NodeAlertRule{})
+	if scope == models.AlertScopeNode {
+		q = q.Where("scope = ? OR scope = '' OR scope IS NULL", scope)
+	} else if scope != "" {
+		q = q.Where("scope = ?", scope)
+	}
+	err := q.Order("created_at ASC").Find(&rules).Error
+	return rules, err
+}
+
+/*
+ListEnabledAlertRulesForNode 获取作用于节点指标的已启用规则
+功能：包括该节点的节点规则和其所属节点组的组规则
+*/
+func (d *DAO) ListEnabledAlertRulesForNode(nodeID string, groupIDs []string) ([]*models.NodeAlertRule, error) {
+	var rules []*models.NodeAlertRule
+	q := d.DB.Where("enabled = ?", true)
+	if len(groupIDs) > 0 {
+		q = q.Where("((scope = ? OR scope = '' OR scope IS NULL) AND node_id = ?) OR (scope = ? AND group_id IN ?)",
+			models.AlertScopeNode, nodeID, models.AlertScopeGroup, groupIDs)
+	} else {
+		q = q.Where("(scope = ? OR scope = '' OR scope IS NULL) AND node_id = ?", models.AlertScopeNode, nodeID)
+	}
+	err := q.Find(&rules).Error
+	return rules, err
+}
+
+/*
+ListEnabledAlertRulesForTunnel 获取作用于隧道指标的已启用规则
+功能：规则的 tunnel_id / node_id 为空表示匹配所有隧道 / 节点
+*/
+func (d *DAO) ListEnabledAlertRulesForTunnel(nodeID, tunnelID string) ([]*models.NodeAlertRule, error) {
+	var rules []*models.NodeAlertRule
+	err := d.DB.Where("enabled = ? AND scope = ?", true, models.AlertScopeTunnel).
+		Where("tunnel_id = '' OR tunnel_id IS NULL OR tunnel_id = ?", tunnelID).
+		Where("node_id = '' OR node_id IS NULL OR node_id = ?", nodeID).
+		Find(&rules).Error
+	return rules, err
+}
+
 /*
 CreateNodeAlertRule 创建告警规则
 功能：为指定节点新建一条告警规则
@@ -173,6 +219,22 @@ func (d *DAO) ListNodeAlertHistory(nodeID string, limit int) ([]*models.NodeAler
 	return list, err
 }
 
+/*
+GetOpenNodeAlertByFingerprint 获取告警实例未恢复的记录，不存在返回 nil
+*/
+func (d *DAO) GetOpenNodeAlertByFingerprint(fingerprint string) (*models.NodeAlertHistory, error) {
+	var alert models.NodeAlertHistory
+	err := d.DB.Where("fingerprint = ? AND status <> ?", fingerprint, "resolved").
+		Order("triggered_at DESC").First(&alert).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &alert, nil
+}
+
 /*
 UpdateNodeAlertHistoryStatus 更新告警状态
 功能：将告警标记为 acknowledged 或 resolved，并记录操作时间和操作人
@@ -190,6 +252,168 @@ func (d *DAO) UpdateNodeAlertHistoryStatus(id, status, acknowledgedBy string) er
 	return d.DB.Model(&models.NodeAlertHistory{}).Where("id = ?", id).Updates(updates).Error
 }
 
+/* ==================== 告警静默 ==================== */
+
+/*
+CreateAlertSilence 创建静默 / 维护窗口
+*/
+func (d *DAO) CreateAlertSilence(silence *models.AlertSilence) error {
+	if silence.ID == "" {
+		silence.ID = uuid.New().String()
+	}
+	return d.DB.Create(silence).Error
+}
+
+/*
+GetAlertSilence 获取静默，不存在返回 nil
+*/
+func (d *DAO) GetAlertSilence(id string) (*models.AlertSilence, error) {
+	var silence models.AlertSilence
+	if err := d.DB.First(&silence, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &silence, nil
+}
+
+/*
+ListAlertSilences 列出静默
+功能：activeAt 非零时只返回该时刻未结束的静默（含尚未开始的）
+*/
+func (d *DAO) ListAlertSilences(activeAt time.Time) ([]*models.AlertSilence, error) {
+	var list []*models.AlertSilence
+	q := d.DB.Model(&models.AlertSilence{})
+	if !activeAt.IsZero() {
+		q = q.Where("ends_at > ?", activeAt)
+	}
+	err := q.Order("starts_at ASC").Find(&list).Error
+	return list, err
+}
+
+/*
+UpdateAlertSilence 更新静默
+*/
+func (d *DAO) UpdateAlertSilence(silence *models.AlertSilence) error {
+	return d.DB.Save(silence).Error
+}
+
+/*
+DeleteAlertSilence 删除静默
+*/
+func (d *DAO) DeleteAlertSilence(id string) error {
+	return d.DB.Delete(&models.AlertSilence{}, "id = ?", id).Error
+}
+
+/* ==================== 告警通道 ==================== */
+
+/*
+ListAlertChannels 列出所有告警通道
+*/
+func (d *DAO) ListAlertChannels() ([]*models.AlertChannel, error) {
+	var list []*models.AlertChannel
+	err := d.DB.Order("created_at ASC").Find(&list).Error
+	return list, err
+}
+
+/*
+GetAlertChannel 获取单个告警通道，不存在返回 nil
+*/
+func (d *DAO) GetAlertChannel(id string) (*models.AlertChannel, error) {
+	var ch models.AlertChannel
+	if err := d.DB.First(&ch, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ch, nil
+}
+
+/*
+GetAlertChannelsByIDs 按 ID 批量获取已启用的告警通道
+*/
+func (d *DAO) GetAlertChannelsByIDs(ids []string) ([]*models.AlertChannel, error) {
+	var list []*models.AlertChannel
+	if len(ids) == 0 {
+		return list, nil
+	}
+	err := d.DB.Where("id IN ? AND enabled = ?", ids, true).Find(&list).Error
+	return list, err
+}
+
+/*
+ListDefaultAlertChannels 获取已启用的默认告警通道
+功能：未指定通道的告警（如节点离线）发送到这些通道
+*/
+func (d *DAO) ListDefaultAlertChannels() ([]*models.AlertChannel, error) {
+	var list []*models.AlertChannel
+	err := d.DB.Where("is_default = ? AND enabled = ?", true, true).Find(&list).Error
+	return list, err
+}
+
+/*
+CreateAlertChannel 创建告警通道
+*/
+func (d *DAO) CreateAlertChannel(ch *models.AlertChannel) error {
+	if ch.ID == "" {
+		ch.ID = uuid.New().String()
+	}
+	return d.DB.Create(ch).Error
+}
+
+/*
+UpdateAlertChannel 更新告警通道
+*/
+func (d *DAO) UpdateAlertChannel(ch *models.AlertChannel) error {
+	return d.DB.Save(ch).Error
+}
+
+/*
+DeleteAlertChannel 删除告警通道
+*/
+func (d *DAO) DeleteAlertChannel(id string) error {
+	return d.DB.Delete(&models.AlertChannel{}, "id = ?", id).Error
+}
+
+/* ==================== 告警投递记录 ==================== */
+
+/*
+CreateAlertDelivery 写入一条告警投递记录
+*/
+func (d *DAO) CreateAlertDelivery(delivery *models.AlertDelivery) error {
+	if delivery.ID == "" {
+		delivery.ID = uuid.New().String()
+	}
+	return d.DB.Create(delivery).Error
+}
+
+/*
+ListAlertDeliveries 列出告警投递记录
+功能：按时间倒序取 limit 条，channelID / status 为空时不过滤
+*/
+func (d *DAO) ListAlertDeliveries(channelID, status string, limit int) ([]*models.AlertDelivery, error) {
+	var list []*models.AlertDelivery
+	q := d.DB.Model(&models.AlertDelivery{})
+	if channelID != "" {
+		q = q.Where("channel_id = ?", channelID)
+	}
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	err := q.Order("created_at DESC").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+/*
+DeleteAlertDeliveriesBefore 删除早于指定时间的投递记录
+*/
+func (d *DAO) DeleteAlertDeliveriesBefore(cutoff time.Time) (int64, error) {
+	result := d.DB.Where("created_at < ?", cutoff).Delete(&models.AlertDelivery{})
+	return result.RowsAffected, result.Error
+}
+
 /* ==================== 监控权限 ==================== */
 
 /*
@@ -255,3 +479,15 @@ func (d *DAO) GetNodePerformanceHistory(nodeID, aggType string, from, to time.Ti
 		Order("aggregation_time ASC").Find(&list).Error
 	return list, err
 }
+
+/*
+ListNodeHourlyHistory 获取节点在 [from, to] 内的小时聚合历史
+功能：按聚合时间（小时起点）过滤，供长窗口告警规则评估
+*/
+func (d *DAO) ListNodeHourlyHistory(nodeID string, from, to time.Time) ([]*models.NodePerformanceHistory, error) {
+	var list []*models.NodePerformanceHistory
+	err := d.DB.Where("node_id = ? AND aggregation_type = ? AND aggregation_time >= ? AND aggregation_time <= ?",
+		nodeID, "hourly", from, to).
+		Order("aggregation_time ASC").Find(&list).Error
+	return list, err
+}
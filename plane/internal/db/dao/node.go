@@ -212,6 +212,21 @@ func (d *DAO) GetNodesInGroup(groupID string) ([]models.Node, error) {
 	return group.Nodes, nil
 }
 
+/*
+GetNodeGroupIDs 获取节点所属的节点组 ID
+*/
+func (d *DAO) GetNodeGroupIDs(nodeID string) ([]string, error) {
+	var node models.Node
+	if err := d.DB.Preload("Groups").First(&node, "id = ?", nodeID).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(node.Groups))
+	for _, group := range node.Groups {
+		ids = append(ids, group.ID)
+	}
+	return ids, nil
+}
+
 /*
 AddNodeToGroup 将节点加入组
 */
@@ -144,11 +144,92 @@ func (d *DAO) ListOrders(userID string, page, pageSize int) ([]models.Order, int
 	return orders, total, nil
 }
 
-/* ==================== 审计日志 ==================== */
+/* ==================== Prometheus 指标导出 ==================== */
 
 /*
-CreateAuditLog 创建审计日志
+FailoverEventCount 容灾事件计数
+功能：按节点、隧道和事件类型汇总 failover_events 表
 */
-func (d *DAO) CreateAuditLog(log *models.AuditLog) error {
-	return d.DB.Create(log).Error
+type FailoverEventCount struct {
+	NodeID    string
+	TunnelID  string
+	EventType string
+	Count     int64
+}
+
+/*
+ListTunnelTrafficTotals 获取所有隧道的累计流量和连接数
+功能：只查询指标导出需要的列，供 Prometheus 导出器周期汇总
+*/
+func (d *DAO) ListTunnelTrafficTotals() ([]models.Tunnel, error) {
+	var tunnels []models.Tunnel
+	if err := d.DB.Model(&models.Tunnel{}).
+		Select("id, name, created_by, enabled, protocol, ingress_group_id, bytes_in, bytes_out, connection_count").
+		Find(&tunnels).Error; err != nil {
+		return nil, err
+	}
+	return tunnels, nil
+}
+
+/*
+ListNodesForMetrics 获取所有节点的基本信息和所属节点组
+*/
+func (d *DAO) ListNodesForMetrics() ([]models.Node, error) {
+	var nodes []models.Node
+	if err := d.DB.Preload("Groups").
+		Select("id, name, role, status, version").
+		Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+/*
+ListLatestNodeMonitoringData 获取每个节点 since 之后最新的一条监控数据
+*/
+func (d *DAO) ListLatestNodeMonitoringData(since time.Time) ([]*models.NodeMonitoringData, error) {
+	latest := d.DB.Model(&models.NodeMonitoringData{}).
+		Select("node_id, MAX(timestamp) AS max_ts").
+		Where("timestamp >= ?", since).
+		Group("node_id")
+
+	var list []*models.NodeMonitoringData
+	if err := d.DB.Model(&models.NodeMonitoringData{}).
+		Joins("JOIN (?) AS latest ON latest.node_id = node_monitoring_data.node_id AND latest.max_ts = node_monitoring_data.timestamp", latest).
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+/*
+CountFailoverEvents 按节点、隧道和事件类型统计容灾事件
+*/
+func (d *DAO) CountFailoverEvents() ([]FailoverEventCount, error) {
+	var counts []FailoverEventCount
+	if !d.DB.Migrator().HasTable("failover_events") {
+		return counts, nil
+	}
+	if err := d.DB.Table("failover_events").
+		Select("node_id, tunnel_id, event_type, COUNT(*) AS count").
+		Where("deleted_at IS NULL").
+		Group("node_id, tunnel_id, event_type").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+/*
+ListActiveSubscriptions 获取所有生效中的订阅（含套餐）
+*/
+func (d *DAO) ListActiveSubscriptions() ([]models.Subscription, error) {
+	var subs []models.Subscription
+	if err := d.DB.Preload("Plan").
+		Where("status = 'active' AND expire_at > ?", time.Now()).
+		Order("created_at DESC").
+		Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	return subs, nil
 }
@@ -129,6 +129,11 @@ func AutoMigrate(db *gorm.DB) error {
 	err := db.AutoMigrate(
 		/* 用户相关 */
 		&models.User{},
+		&models.UserRecoveryCode{},
+		&models.WebAuthnCredential{},
+		&models.UserIdentity{},
+		&models.APIToken{},
+		&models.UserSession{},
 		&models.Permission{},
 		&models.RolePermission{},
 		&models.Wallet{},
@@ -141,13 +146,22 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.NodeMetrics{},
 		&models.NodeCertificate{},
 		&models.ConnectionKey{},
+		&models.NodeCommand{},
 
 		/* 隧道和规则 */
 		&models.Tunnel{},
 		&models.TunnelTarget{},
+		&models.TunnelCredential{},
+		&models.TunnelHop{},
+		&models.UserProxyCredential{},
 		&models.Rule{},
 		&models.ACLRule{},
 		&models.TrafficStats{},
+		&models.RuleChange{},
+		&models.RuleChangeSequence{},
+		&models.NodeSyncState{},
+		&models.RuleRollout{},
+		&models.RuleRolloutNode{},
 
 		/* 策略和节点组配置 */
 		&models.Policy{},
@@ -169,6 +183,9 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.NodePerformanceHistory{},
 		&models.NodeAlertRule{},
 		&models.NodeAlertHistory{},
+		&models.AlertChannel{},
+		&models.AlertDelivery{},
+		&models.AlertSilence{},
 		&models.MonitoringPermission{},
 	)
 
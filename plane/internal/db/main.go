@@ -7,6 +7,7 @@ import (
 	"gkipass/plane/internal/db/cache"
 	"gkipass/plane/internal/db/database"
 
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
@@ -156,6 +157,17 @@ func (m *Manager) HasCache() bool {
 	return m.Cache != nil && m.Cache.Redis != nil
 }
 
+/*
+RedisClient 获取 Redis 客户端
+功能：供分布式锁、多实例消息转发等需要原生命令的场景使用，未配置 Redis 时返回 nil
+*/
+func (m *Manager) RedisClient() *redis.Client {
+	if !m.HasCache() {
+		return nil
+	}
+	return m.Cache.Redis.Client()
+}
+
 /*
 GetGormDB 获取 GORM 数据库实例
 功能：供新服务层使用的便捷方法
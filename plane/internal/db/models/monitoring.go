@@ -143,21 +143,44 @@ type NodePerformanceHistory struct {
 
 func (NodePerformanceHistory) TableName() string { return "node_performance_history" }
 
+/* 告警规则作用范围 */
+const (
+	AlertScopeNode   = "node"   /* 单个节点 */
+	AlertScopeGroup  = "group"  /* 节点组内所有节点 */
+	AlertScopeTunnel = "tunnel" /* 隧道（按承载节点区分实例） */
+)
+
+/* 告警窗口聚合方式 */
+const (
+	AlertAggLast = "last"
+	AlertAggAvg  = "avg"
+	AlertAggMax  = "max"
+	AlertAggMin  = "min"
+	AlertAggP95  = "p95"
+)
+
 /*
 NodeAlertRule 节点告警规则
-功能：定义针对某个指标的告警阈值和触发条件
+功能：定义针对某个指标的告警阈值和触发条件；
+窗口聚合值满足条件并持续 DurationSeconds 后触发，回落到恢复阈值以下后自动恢复
 */
 type NodeAlertRule struct {
 	ID                   string    `json:"id" gorm:"primaryKey;size:36"`
-	NodeID               string    `json:"node_id" gorm:"size:36;index"`
+	Scope                string    `json:"scope" gorm:"size:16;default:'node'"` /* node / group / tunnel */
+	NodeID               string    `json:"node_id" gorm:"size:36;index"`        /* scope=tunnel 时为空表示所有节点 */
+	GroupID              string    `json:"group_id,omitempty" gorm:"size:36;index"`
+	TunnelID             string    `json:"tunnel_id,omitempty" gorm:"size:36;index"` /* scope=tunnel 时为空表示所有隧道 */
 	RuleName             string    `json:"rule_name" gorm:"size:128"`
-	MetricType           string    `json:"metric_type" gorm:"size:32"` /* cpu / memory / disk / response_time / connections */
+	MetricType           string    `json:"metric_type" gorm:"size:32"` /* 节点：cpu / memory / disk / response_time / connections / ...；隧道：connections / traffic_in / ... */
 	Operator             string    `json:"operator" gorm:"size:4"`     /* > < >= <= = != */
 	ThresholdValue       float64   `json:"threshold_value"`
-	DurationSeconds      int       `json:"duration_seconds"`
-	Severity             string    `json:"severity" gorm:"size:16"` /* info / warning / critical */
+	ResolveThreshold     *float64  `json:"resolve_threshold,omitempty"`              /* 恢复阈值（滞回），为空时与触发阈值相同 */
+	Aggregation          string    `json:"aggregation" gorm:"size:8;default:'last'"` /* last / avg / max / min / p95 */
+	WindowSeconds        int       `json:"window_seconds"`                           /* 聚合窗口，超过 1 小时使用小时聚合历史 */
+	DurationSeconds      int       `json:"duration_seconds"`                         /* 条件需持续满足的时长（for） */
+	Severity             string    `json:"severity" gorm:"size:16"`                  /* info / warning / critical */
 	Enabled              bool      `json:"enabled" gorm:"default:true"`
-	NotificationChannels string    `json:"notification_channels" gorm:"size:256"`
+	NotificationChannels string    `json:"notification_channels" gorm:"size:1024"` /* 逗号分隔的告警通道 ID，为空时发送到默认通道 */
 	CreatedAt            time.Time `json:"created_at"`
 	UpdatedAt            time.Time `json:"updated_at"`
 }
@@ -183,10 +206,99 @@ type NodeAlertHistory struct {
 	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
 	AcknowledgedBy string     `json:"acknowledged_by,omitempty" gorm:"size:36"`
 	Details        string     `json:"details,omitempty" gorm:"type:text"`
+	TunnelID       string     `json:"tunnel_id,omitempty" gorm:"size:36;index"`
+	Fingerprint    string     `json:"fingerprint,omitempty" gorm:"size:128;index"` /* 规则 + 目标，标识同一告警实例 */
+	Silenced       bool       `json:"silenced"`                                    /* 触发时处于静默期，未发送通知 */
 }
 
 func (NodeAlertHistory) TableName() string { return "node_alert_history" }
 
+/* 告警静默类型 */
+const (
+	AlertSilenceKindSilence     = "silence"     /* 静默：照常记录告警，不发送通知 */
+	AlertSilenceKindMaintenance = "maintenance" /* 维护窗口：暂停规则评估，不产生新告警 */
+)
+
+/*
+AlertSilence 告警静默 / 维护窗口
+功能：在 [StartsAt, EndsAt) 内对匹配的告警生效，匹配条件为空表示不限
+*/
+type AlertSilence struct {
+	ID        string    `json:"id" gorm:"primaryKey;size:36"`
+	Kind      string    `json:"kind" gorm:"size:16"` /* silence / maintenance */
+	RuleID    string    `json:"rule_id,omitempty" gorm:"size:36"`
+	NodeID    string    `json:"node_id,omitempty" gorm:"size:36"`
+	GroupID   string    `json:"group_id,omitempty" gorm:"size:36"`
+	TunnelID  string    `json:"tunnel_id,omitempty" gorm:"size:36"`
+	StartsAt  time.Time `json:"starts_at" gorm:"index"`
+	EndsAt    time.Time `json:"ends_at" gorm:"index"`
+	Comment   string    `json:"comment" gorm:"size:256"`
+	CreatedBy string    `json:"created_by" gorm:"size:36"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (AlertSilence) TableName() string { return "alert_silences" }
+
+/* 告警通道类型 */
+const (
+	AlertChannelEmail    = "email"
+	AlertChannelSlack    = "slack"
+	AlertChannelDiscord  = "discord"
+	AlertChannelDingTalk = "dingtalk"
+	AlertChannelFeishu   = "feishu"
+	AlertChannelWeCom    = "wecom"
+	AlertChannelTelegram = "telegram"
+	AlertChannelWebhook  = "webhook"
+)
+
+/* 告警投递状态 */
+const (
+	AlertDeliverySent        = "sent"
+	AlertDeliveryFailed      = "failed"
+	AlertDeliveryRateLimited = "rate_limited"
+)
+
+/*
+AlertChannel 告警通知通道
+功能：保存一个可被告警规则引用的通知目标，Config 为对应类型的 JSON 配置
+*/
+type AlertChannel struct {
+	ID         string    `json:"id" gorm:"primaryKey;size:36"`
+	Name       string    `json:"name" gorm:"size:128"`
+	Type       string    `json:"type" gorm:"size:16;index"` /* email / slack / discord / dingtalk / feishu / wecom / telegram / webhook */
+	Config     string    `json:"config" gorm:"type:text"`
+	Enabled    bool      `json:"enabled" gorm:"default:true"`
+	IsDefault  bool      `json:"is_default" gorm:"default:false"` /* 未指定通道的告警（如节点离线）发送到默认通道 */
+	RateLimit  int       `json:"rate_limit" gorm:"default:20"`    /* 每分钟最多发送条数，0 表示不限制 */
+	MaxRetries int       `json:"max_retries" gorm:"default:3"`    /* 失败后的重试次数 */
+	CreatedBy  string    `json:"created_by" gorm:"size:36"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (AlertChannel) TableName() string { return "alert_channels" }
+
+/*
+AlertDelivery 告警投递记录
+功能：记录每次告警发往每个通道的结果，便于排查通知丢失
+*/
+type AlertDelivery struct {
+	ID          string    `json:"id" gorm:"primaryKey;size:36"`
+	ChannelID   string    `json:"channel_id" gorm:"size:36;index"`
+	ChannelType string    `json:"channel_type" gorm:"size:16"`
+	RuleID      string    `json:"rule_id,omitempty" gorm:"size:36;index"`
+	NodeID      string    `json:"node_id,omitempty" gorm:"size:36;index"`
+	Level       string    `json:"level" gorm:"size:16"`
+	Title       string    `json:"title" gorm:"size:256"`
+	Status      string    `json:"status" gorm:"size:16;index"` /* sent / failed / rate_limited */
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error,omitempty" gorm:"size:512"`
+	DurationMs  int64     `json:"duration_ms"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
+}
+
+func (AlertDelivery) TableName() string { return "alert_deliveries" }
+
 /*
 MonitoringPermission 监控权限
 功能：控制用户对节点监控数据的访问权限
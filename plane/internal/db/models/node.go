@@ -73,6 +73,7 @@ type Node struct {
 	PublicIP   string `gorm:"type:varchar(64)" json:"public_ip"`   /* 公网 IP（用于隧道连接） */
 	InternalIP string `gorm:"type:varchar(64)" json:"internal_ip"` /* 内网 IP（用于同机房直连） */
 	Port       int    `gorm:"default:0" json:"port"`               /* 隧道监听端口 */
+	CertPin    string `gorm:"type:varchar(64)" json:"cert_pin"`    /* 节点CA公钥固定（SPKI SHA-256），下发给链路相邻节点用于QUIC/TLS互认 */
 
 	/* 认证凭证：用于节点 WebSocket 连接认证 */
 	Token     string `gorm:"type:varchar(256)" json:"-"` /* 节点认证令牌（不序列化） */
@@ -144,6 +145,14 @@ type NodeGroup struct {
 	FailoverTimeout     int    `gorm:"default:60" json:"failover_timeout"`        /* 容灾触发超时（秒），出口持续不可达超过此时间触发切换 */
 	FailoverAutoRecover bool   `gorm:"default:true" json:"failover_auto_recover"` /* 是否自动回切：原出口组恢复后节点自动切回 */
 
+	/*
+		反向模式（仅出口组）
+		组内节点位于 NAT/防火墙之后，上一跳无法直连时启用。
+		出口节点主动向上一跳（入口或最后一个中继）建立并维持连接池，
+		上一跳经这些连接为每个用户连接回开一个流，不再主动拨号出口。
+	*/
+	ReverseMode bool `gorm:"default:false" json:"reverse_mode"` /* 是否为反向模式出口组 */
+
 	/* 关联节点 */
 	Nodes []Node `gorm:"many2many:node_group_nodes;" json:"nodes,omitempty"` /* 组内节点列表 */
 }
@@ -222,3 +231,34 @@ type ConnectionKey struct {
 func (ConnectionKey) TableName() string {
 	return "connection_keys"
 }
+
+/* 节点远程命令状态 */
+const (
+	NodeCommandPending = "pending" /* 已下发，等待节点返回 */
+	NodeCommandSuccess = "success" /* 执行成功 */
+	NodeCommandFailed  = "failed"  /* 节点执行失败或下发失败 */
+	NodeCommandTimeout = "timeout" /* 超时未返回 */
+)
+
+/*
+NodeCommand 节点远程命令
+功能：记录经 WebSocket 下发到节点的白名单命令及其结果，ID 即请求与结果关联的 request_id；
+多实例部署时结果由节点所连接的实例写入，发起请求的实例轮询该记录
+*/
+type NodeCommand struct {
+	BaseModel
+	NodeID         string     `gorm:"type:varchar(36);index;not null" json:"node_id"`
+	Command        string     `gorm:"type:varchar(32);index;not null" json:"command"`
+	Params         string     `gorm:"type:text" json:"params,omitempty"` /* 参数（JSON） */
+	Status         string     `gorm:"type:varchar(16);index;not null" json:"status"`
+	Result         string     `gorm:"type:text" json:"result,omitempty"` /* 节点返回的结果（JSON） */
+	Error          string     `gorm:"type:varchar(1024)" json:"error,omitempty"`
+	TimeoutSeconds int        `gorm:"not null;default:0" json:"timeout_seconds"`
+	RequestedBy    string     `gorm:"type:varchar(36);index" json:"requested_by"`
+	ClientIP       string     `gorm:"type:varchar(64)" json:"client_ip"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+func (NodeCommand) TableName() string {
+	return "node_commands"
+}
@@ -127,16 +127,27 @@ func (PaymentConfig) TableName() string {
 
 /*
 AuditLog 审计日志
-功能：记录系统中的关键操作日志，用于安全审计
+功能：记录系统中的关键操作日志，用于安全审计；
+记录按 Seq 组成哈希链（Hash 覆盖本条内容和 PrevHash），修改或删除任一条都能被校验发现
 */
 type AuditLog struct {
 	BaseModel
-	UserID   string `gorm:"type:varchar(36);index" json:"user_id"`
-	Action   string `gorm:"type:varchar(64);index;not null" json:"action"`
-	Resource string `gorm:"type:varchar(64);index" json:"resource"`
-	Detail   string `gorm:"type:text" json:"detail"`
-	IP       string `gorm:"type:varchar(64)" json:"ip"`
-	UA       string `gorm:"type:varchar(512)" json:"ua"`
+	Seq       int64  `gorm:"uniqueIndex;not null" json:"seq"`
+	UserID    string `gorm:"type:varchar(36);index" json:"user_id"`
+	Username  string `gorm:"type:varchar(64)" json:"username"`
+	Action    string `gorm:"type:varchar(64);index;not null" json:"action"`
+	Resource  string `gorm:"type:varchar(128);index" json:"resource"`
+	Method    string `gorm:"type:varchar(8)" json:"method"`
+	Path      string `gorm:"type:varchar(256)" json:"path"`
+	Status    int    `gorm:"default:0" json:"status"`
+	RequestID string `gorm:"type:varchar(64)" json:"request_id"`
+	Detail    string `gorm:"type:text" json:"detail"`
+	Before    string `gorm:"type:text" json:"before"` /* 变更前的字段（JSON，只含变化的字段） */
+	After     string `gorm:"type:text" json:"after"`  /* 变更后的字段 */
+	IP        string `gorm:"type:varchar(64)" json:"ip"`
+	UA        string `gorm:"type:varchar(512)" json:"ua"`
+	PrevHash  string `gorm:"type:varchar(64)" json:"prev_hash"`
+	Hash      string `gorm:"type:varchar(64);not null" json:"hash"`
 }
 
 func (AuditLog) TableName() string {
@@ -16,6 +16,8 @@ TunnelProtocol 隧道通讯协议枚举
 	WebSocket 协议：ws, wss — HTTP 兼容，可穿越 CDN/反代/防火墙
 	TLS 协议：tls, tls-mux — 加密传输，tls-mux 支持单连接多路复用
 	高性能协议：kcp, quic — 基于 UDP 的可靠传输，弱网环境表现优异
+	代理入口：socks5 — 仅用于 IngressProtocol，入口节点作为 SOCKS5 代理（支持 UDP ASSOCIATE）
+	         http — 仅用于 IngressProtocol，入口节点作为 HTTP 正向代理（CONNECT 与绝对 URI 请求）
 
 节点组的 DisabledProtocols 字段可禁用特定协议，
 例如某些网络环境不支持 UDP 时可禁用 kcp 和 quic。
@@ -31,6 +33,8 @@ const (
 	ProtocolTLSMux TunnelProtocol = "tls-mux" /* TLS 多路复用：单条 TLS 连接承载多个隧道流，减少握手开销 */
 	ProtocolKCP    TunnelProtocol = "kcp"     /* KCP 协议：基于 UDP 的可靠传输，以带宽换延迟，适合高丢包网络 */
 	ProtocolQUIC   TunnelProtocol = "quic"    /* QUIC 协议：基于 UDP 的加密传输（内置 TLS 1.3），0-RTT 连接，支持多路复用 */
+	ProtocolSOCKS5 TunnelProtocol = "socks5"  /* SOCKS5 代理入口：客户端以 SOCKS5 连接入口节点，必须配置隧道或用户级凭据进行用户名密码认证 */
+	ProtocolHTTP   TunnelProtocol = "http"    /* HTTP 正向代理入口：浏览器/命令行工具直接配置为代理，以 Proxy-Authorization 认证 */
 )
 
 /*
@@ -48,6 +52,13 @@ Tunnel 隧道模型
 	示例：用户通过 TCP 连接入口节点，节点间用 WSS 加密隧道传输，出口节点用 TCP 连接目标
 	  IngressProtocol=tcp, Protocol=wss, EgressProtocol=tcp
 
+多跳链路（可选）：
+
+	入口节点 ←[Hops[0].Protocol]→ 中继组 1 ←[Hops[1].Protocol]→ … 中继组 N ←[Protocol]→ 出口节点
+
+	- Hops 按 Position 排序，每跳指定中继节点组（或精确节点）和进入该跳所用的协议
+	- 最后一跳到出口节点之间使用隧道的 Protocol；未配置 Hops 时即为单跳
+
 节点选择：
   - IngressNodeID / IngressGroupID：指定入口节点或入口组（监听端用户连接的节点）
   - EgressNodeID / EgressGroupID：指定出口节点或出口组（连接目标服务器的节点）
@@ -89,6 +100,31 @@ type Tunnel struct {
 	EnableEncryption bool   `gorm:"default:false" json:"enable_encryption"`                          /* 是否启用应用层加密 */
 	EncryptionMethod string `gorm:"type:varchar(32);default:'aes-256-gcm'" json:"encryption_method"` /* 加密算法：aes-256-gcm, chacha20-poly1305 */
 
+	/*
+		PROXY protocol：向目标服务器传递真实客户端地址
+		入口节点可接受前置负载均衡器发来的 PROXY 头（AcceptProxyProtocol）；
+		多跳链路中有下一跳的节点向下一跳发送 PROXY v2 头，中继/出口节点解析该头得到真实来源，
+		用于访问控制与按来源的流量统计；出口节点按 SendProxyProtocol 向目标发送 v1/v2 头
+	*/
+	SendProxyProtocol   string `gorm:"type:varchar(8);default:''" json:"send_proxy_protocol"` /* 出口发送的 PROXY 头版本：空（不发送）、v1、v2 */
+	AcceptProxyProtocol bool   `gorm:"default:false" json:"accept_proxy_protocol"`            /* 入口监听是否要求并解析传入的 PROXY 头（位于负载均衡器之后时启用） */
+
+	/* 代理入口目标白名单：JSON 数组，支持 *.example.com 通配，空表示不限制 */
+	AllowedDomains string `gorm:"type:text" json:"allowed_domains"`
+
+	/* SOCKS5 BIND：会在入口节点上开放临时监听端口，默认关闭，仅显式开启的隧道允许 */
+	AllowBind bool `gorm:"default:false" json:"allow_bind"`
+
+	/*
+		共享端口路由：JSON 数组，按 TLS ClientHello SNI 或 HTTP Host 匹配（支持 *.example.com）。
+		非空时隧道工作在共享监听模式，同一入口组内可与其他配置了主机名的隧道共用 ListenPort，
+		主机名在入口组内唯一
+	*/
+	Hostnames string `gorm:"type:text" json:"hostnames"`
+
+	/* 反向隧道握手密钥：出口组为反向模式时下发给出口与上一跳，用于校验回连 */
+	ReverseSecret string `gorm:"type:varchar(64)" json:"-"`
+
 	/* 流量控制 */
 	RateLimitBPS   int64 `gorm:"default:0" json:"rate_limit_bps"`  /* 带宽限制（bit/s），0 表示不限制 */
 	MaxConnections int   `gorm:"default:0" json:"max_connections"` /* 最大并发连接数，0 表示不限制 */
@@ -104,9 +140,11 @@ type Tunnel struct {
 	LastActive      time.Time `gorm:"" json:"last_active"`               /* 最后活跃时间 */
 
 	/* 关联模型 */
-	Rules   []Rule         `gorm:"foreignKey:TunnelID" json:"rules,omitempty"`   /* 转发规则列表 */
-	Targets []TunnelTarget `gorm:"foreignKey:TunnelID" json:"targets,omitempty"` /* 目标地址列表（负载均衡） */
-	Creator User           `gorm:"foreignKey:CreatedBy" json:"-"`                /* 创建者用户 */
+	Rules       []Rule             `gorm:"foreignKey:TunnelID" json:"rules,omitempty"`       /* 转发规则列表 */
+	Targets     []TunnelTarget     `gorm:"foreignKey:TunnelID" json:"targets,omitempty"`     /* 目标地址列表（负载均衡） */
+	Credentials []TunnelCredential `gorm:"foreignKey:TunnelID" json:"credentials,omitempty"` /* 代理入口认证凭据 */
+	Hops        []TunnelHop        `gorm:"foreignKey:TunnelID" json:"hops,omitempty"`        /* 中继跳列表（按 Position 排序） */
+	Creator     User               `gorm:"foreignKey:CreatedBy" json:"-"`                    /* 创建者用户 */
 }
 
 func (Tunnel) TableName() string {
@@ -134,6 +172,70 @@ func (TunnelTarget) TableName() string {
 	return "tunnel_targets"
 }
 
+/*
+TunnelHop 隧道中继跳
+功能：入口与出口之间的有序中继节点组。中继节点在自身隧道端口接收上一跳的流量，
+再按下一跳的协议转发，适用于只能经由中转地区稳定到达的线路
+*/
+type TunnelHop struct {
+	BaseModel
+	TunnelID string         `gorm:"type:varchar(36);index;not null" json:"tunnel_id"` /* 所属隧道 ID */
+	Position int            `gorm:"not null" json:"position"`                         /* 跳序号（从 1 开始，入口之后的第一跳为 1） */
+	GroupID  string         `gorm:"type:varchar(36);index;not null" json:"group_id"`  /* 中继节点组 ID */
+	NodeID   string         `gorm:"type:varchar(36)" json:"node_id"`                  /* 中继节点 ID（可选，精确指定组内节点） */
+	Protocol TunnelProtocol `gorm:"type:varchar(16);not null" json:"protocol"`        /* 上一跳 → 本跳使用的隧道协议 */
+
+	/* 关联 */
+	Tunnel Tunnel `gorm:"foreignKey:TunnelID" json:"-"`
+}
+
+func (TunnelHop) TableName() string {
+	return "tunnel_hops"
+}
+
+/*
+TunnelCredential 隧道代理认证凭据
+功能：入口协议为代理类型（如 socks5）时的用户名密码认证凭据。
+密码只保存加盐 SHA-256 摘要，随规则下发到入口节点本地校验，明文既不落库也不下发。
+代理入口始终要求认证；隧道及创建者都没有启用的凭据时，面板不下发该隧道规则
+*/
+type TunnelCredential struct {
+	BaseModel
+	TunnelID     string `gorm:"type:varchar(36);index;not null" json:"tunnel_id"` /* 所属隧道 ID */
+	Username     string `gorm:"type:varchar(255);not null" json:"username"`       /* 用户名（RFC 1929 限制 255 字节） */
+	PasswordHash string `gorm:"type:varchar(64);not null" json:"-"`               /* hex(SHA-256(salt + password)) */
+	Salt         string `gorm:"type:varchar(32);not null" json:"-"`               /* 随机盐（hex） */
+	Enabled      bool   `gorm:"default:true;not null" json:"enabled"`             /* 是否启用 */
+
+	/* 关联 */
+	Tunnel Tunnel `gorm:"foreignKey:TunnelID" json:"-"`
+}
+
+func (TunnelCredential) TableName() string {
+	return "tunnel_credentials"
+}
+
+/*
+UserProxyCredential 用户级代理认证凭据
+功能：对用户创建的所有代理入口隧道生效，存储方式与 TunnelCredential 相同。
+下发时与隧道凭据合并，用户名冲突时以隧道凭据为准
+*/
+type UserProxyCredential struct {
+	BaseModel
+	UserID       string `gorm:"type:varchar(36);index;not null" json:"user_id"` /* 所属用户 ID */
+	Username     string `gorm:"type:varchar(255);not null" json:"username"`     /* 用户名 */
+	PasswordHash string `gorm:"type:varchar(64);not null" json:"-"`             /* hex(SHA-256(salt + password)) */
+	Salt         string `gorm:"type:varchar(32);not null" json:"-"`             /* 随机盐（hex） */
+	Enabled      bool   `gorm:"default:true;not null" json:"enabled"`           /* 是否启用 */
+
+	/* 关联 */
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (UserProxyCredential) TableName() string {
+	return "user_proxy_credentials"
+}
+
 /*
 Rule 转发规则模型
 功能：定义具体的流量转发规则，包括协议、端口、ACL 和高级选项
@@ -230,3 +332,136 @@ type TrafficStats struct {
 func (TrafficStats) TableName() string {
 	return "traffic_stats"
 }
+
+/* 规则变更动作 */
+const (
+	RuleChangeUpsert = "upsert" /* 隧道创建/更新/启停，节点需按最新配置重建规则 */
+	RuleChangeDelete = "delete" /* 隧道删除或不再经过该组，节点需移除规则 */
+)
+
+/*
+RuleChange 规则变更日志
+功能：隧道每次变更按受影响的节点组各记一条，Version 全局单调递增，
+节点确认已应用的版本后，重连时只需拉取该版本之后的变更
+*/
+type RuleChange struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement" json:"version"`          /* 变更版本号（由 RuleChangeSequence 按提交顺序分配） */
+	TunnelID  string    `gorm:"type:varchar(36);index;not null" json:"tunnel_id"` /* 变更的隧道 ID */
+	GroupID   string    `gorm:"type:varchar(36);index;not null" json:"group_id"`  /* 受影响的节点组 ID */
+	Action    string    `gorm:"type:varchar(16);not null" json:"action"`          /* upsert / delete */
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`           /* 记录时间（用于压缩） */
+}
+
+func (RuleChange) TableName() string {
+	return "rule_changes"
+}
+
+/*
+RuleChangeSequence 规则变更版本计数器
+功能：单行计数器，变更在同一事务内加锁递增后再写入日志，
+版本号按提交顺序分配，不会出现已读取更大版本后才提交的较小版本
+*/
+type RuleChangeSequence struct {
+	ID      uint  `gorm:"primaryKey" json:"id"`
+	Version int64 `gorm:"not null;default:0" json:"version"` /* 最近分配的版本号 */
+}
+
+func (RuleChangeSequence) TableName() string {
+	return "rule_change_sequences"
+}
+
+/*
+NodeSyncState 节点规则同步状态
+功能：记录节点已确认应用的变更版本和最近一次全量同步时的节点组，
+节点组变化后增量日志无法覆盖新组的存量规则，需回退全量同步
+*/
+type NodeSyncState struct {
+	NodeID         string    `gorm:"type:varchar(36);primaryKey" json:"node_id"`
+	AckedVersion   int64     `gorm:"default:0;not null" json:"acked_version"` /* 节点已确认应用的版本 */
+	AckedAt        time.Time `json:"acked_at"`                                /* 最近确认时间 */
+	GroupKey       string    `gorm:"type:text" json:"group_key"`              /* 最近全量同步时节点所在组（排序后逗号拼接） */
+	LastFullSyncAt time.Time `json:"last_full_sync_at"`                       /* 最近全量同步时间 */
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (NodeSyncState) TableName() string {
+	return "node_sync_states"
+}
+
+/* 规则分批发布类型 */
+const (
+	RolloutKindTunnel    = "tunnel"     /* 隧道配置变更 */
+	RolloutKindNodeGroup = "node_group" /* 节点组配置变更（影响以其为出口的所有隧道） */
+)
+
+/* 规则分批发布状态 */
+const (
+	RolloutStatusRunning    = "running"     /* 分批推进中 */
+	RolloutStatusSucceeded  = "succeeded"   /* 全部批次完成 */
+	RolloutStatusRolledBack = "rolled_back" /* 健康检查未通过，已自动回滚 */
+	RolloutStatusCancelled  = "cancelled"   /* 管理员取消，已回滚 */
+	RolloutStatusSuperseded = "superseded"  /* 推进中隧道再次变更，由新变更接管 */
+)
+
+/* 分批发布中节点的状态 */
+const (
+	RolloutNodeHeld       = "held"        /* 尚未轮到，保持变更前的规则 */
+	RolloutNodeApplied    = "applied"     /* 已下发新规则，等待确认 */
+	RolloutNodeAcked      = "acked"       /* 已确认应用新规则 */
+	RolloutNodeFailed     = "failed"      /* 新规则应用失败 */
+	RolloutNodeOffline    = "offline"     /* 轮到时离线，重连后直接获得新规则 */
+	RolloutNodeRolledBack = "rolled_back" /* 已回滚到变更前的规则 */
+)
+
+/*
+RuleRollout 规则分批发布
+功能：隧道或节点组变更先下发到金丝雀节点，确认与健康检查通过后分批推进，
+异常时回滚到 Snapshot 中的变更前规则。Pinned 为 true 时尚未轮到的节点（推进中）
+或全部节点（已回滚/取消）保持快照规则，直到这些隧道再次变更
+*/
+type RuleRollout struct {
+	BaseModel
+	Kind              string            `gorm:"type:varchar(16);not null" json:"kind"`            /* tunnel / node_group */
+	TargetID          string            `gorm:"type:varchar(36);index;not null" json:"target_id"` /* 变更的隧道或节点组 ID */
+	TunnelIDs         string            `gorm:"type:text" json:"tunnel_ids"`                      /* 涉及的隧道 ID（JSON 数组） */
+	Snapshot          string            `gorm:"type:text" json:"-"`                               /* 变更前的规则（JSON，含密钥，不对外输出） */
+	Version           int64             `gorm:"not null" json:"version"`                          /* 本次变更写入的变更日志版本 */
+	Status            string            `gorm:"type:varchar(16);index;not null" json:"status"`    /* 发布状态 */
+	Pinned            bool              `gorm:"index;not null;default:false" json:"pinned"`       /* 快照规则是否仍在生效 */
+	CurrentWave       int               `gorm:"not null;default:0" json:"current_wave"`           /* 当前批次（0 为金丝雀） */
+	TotalWaves        int               `gorm:"not null;default:1" json:"total_waves"`            /* 总批次数 */
+	WaveStartedAt     time.Time         `json:"wave_started_at"`                                  /* 当前批次开始时间 */
+	BakeSeconds       int               `gorm:"not null;default:0" json:"bake_seconds"`           /* 每批确认后的观察时长 */
+	AckTimeoutSeconds int               `gorm:"not null;default:0" json:"ack_timeout_seconds"`    /* 等待节点确认的超时 */
+	MaxErrorRate      float64           `gorm:"not null;default:0" json:"max_error_rate"`         /* 允许的连接失败率 */
+	Reason            string            `gorm:"type:varchar(512)" json:"reason,omitempty"`        /* 回滚、取消或接管原因 */
+	CreatedBy         string            `gorm:"type:varchar(36)" json:"created_by"`               /* 发起变更的用户 */
+	FinishedAt        *time.Time        `json:"finished_at,omitempty"`                            /* 结束时间 */
+	Nodes             []RuleRolloutNode `gorm:"foreignKey:RolloutID" json:"nodes,omitempty"`      /* 各节点进度 */
+}
+
+func (RuleRollout) TableName() string {
+	return "rule_rollouts"
+}
+
+/*
+RuleRolloutNode 分批发布中单个节点的进度
+功能：SyncVersion 为下发新规则时的变更日志版本，节点确认到该版本视为已应用；
+Connections/FailedConnections 为应用新规则后该节点上相关隧道的新建与失败连接数
+*/
+type RuleRolloutNode struct {
+	RolloutID         string     `gorm:"type:varchar(36);primaryKey" json:"rollout_id"`
+	NodeID            string     `gorm:"type:varchar(36);primaryKey;index" json:"node_id"`
+	Wave              int        `gorm:"not null;default:0" json:"wave"`
+	Status            string     `gorm:"type:varchar(16);not null" json:"status"`
+	SyncVersion       int64      `gorm:"not null;default:0" json:"sync_version"`
+	Connections       int64      `gorm:"not null;default:0" json:"connections"`
+	FailedConnections int64      `gorm:"not null;default:0" json:"failed_connections"`
+	Error             string     `gorm:"type:varchar(512)" json:"error,omitempty"`
+	AppliedAt         *time.Time `json:"applied_at,omitempty"`
+	AckedAt           *time.Time `json:"acked_at,omitempty"`
+}
+
+func (RuleRolloutNode) TableName() string {
+	return "rule_rollout_nodes"
+}
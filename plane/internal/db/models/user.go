@@ -34,6 +34,13 @@ type User struct {
 	Provider    string    `gorm:"type:varchar(32);index" json:"provider"`     /* OAuth 提供商: github/google */
 	ProviderID  string    `gorm:"type:varchar(128);index" json:"provider_id"` /* OAuth 提供商用户ID */
 
+	/* 两步验证 */
+	TOTPSecret     string     `gorm:"type:varchar(64)" json:"-"` /* base32 密钥，确认前 TOTPEnabled 为 false */
+	TOTPEnabled    bool       `gorm:"default:false;not null" json:"totp_enabled"`
+	TOTPLastStep   int64      `gorm:"default:0" json:"-"` /* 最近一次通过验证的时间步，防止验证码重放 */
+	MFAFailures    int        `gorm:"default:0" json:"-"` /* 连续验证失败次数 */
+	MFALockedUntil *time.Time `gorm:"" json:"-"`
+
 	/* 关联 */
 	Permissions   []Permission   `gorm:"many2many:user_permissions;" json:"permissions,omitempty"`
 	Subscriptions []Subscription `gorm:"foreignKey:UserID" json:"subscriptions,omitempty"`
@@ -45,6 +52,103 @@ func (User) TableName() string {
 	return "users"
 }
 
+/*
+UserRecoveryCode 两步验证恢复码
+功能：丢失验证器时代替第二因素登录，只保存哈希，每个码只能使用一次
+*/
+type UserRecoveryCode struct {
+	BaseModel
+	UserID   string     `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	CodeHash string     `gorm:"type:varchar(64);not null" json:"-"` /* hex(SHA-256(规范化后的恢复码)) */
+	UsedAt   *time.Time `gorm:"" json:"used_at"`
+}
+
+func (UserRecoveryCode) TableName() string {
+	return "user_recovery_codes"
+}
+
+/*
+WebAuthnCredential WebAuthn 凭据（通行密钥、安全密钥）
+功能：CredentialID 和 PublicKey 为 base64url 编码，SignCount 用于发现被复制的凭据
+*/
+type WebAuthnCredential struct {
+	BaseModel
+	UserID       string     `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	Name         string     `gorm:"type:varchar(64)" json:"name"`
+	CredentialID string     `gorm:"type:varchar(512);uniqueIndex;not null" json:"credential_id"`
+	PublicKey    string     `gorm:"type:text;not null" json:"-"` /* COSE_Key */
+	Algorithm    int64      `gorm:"not null" json:"algorithm"`
+	SignCount    uint32     `gorm:"default:0" json:"-"`
+	AAGUID       string     `gorm:"type:varchar(36)" json:"aaguid"`
+	LastUsedAt   *time.Time `gorm:"" json:"last_used_at"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+/*
+UserIdentity 外部身份与本地用户的关联（OIDC 单点登录）
+功能：同一用户可关联多个提供方；Provider 为 oidc:<name>，Subject 为提供方的 sub
+*/
+type UserIdentity struct {
+	BaseModel
+	UserID      string     `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	Provider    string     `gorm:"type:varchar(32);uniqueIndex:idx_identity_provider_subject;not null" json:"provider"`
+	Subject     string     `gorm:"type:varchar(255);uniqueIndex:idx_identity_provider_subject;not null" json:"subject"`
+	Email       string     `gorm:"type:varchar(128)" json:"email"`
+	LastLoginAt *time.Time `gorm:"" json:"last_login_at"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+/*
+APIToken 用户个人 API 令牌（CI 等自动化调用）
+功能：明文只在创建时返回一次，库中只保存哈希；Scopes、AllowedIPs 为逗号分隔，AllowedIPs 为空表示不限来源
+*/
+type APIToken struct {
+	BaseModel
+	UserID     string     `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	Name       string     `gorm:"type:varchar(64);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"`        /* 明文前 12 位，用于在列表中辨认 */
+	TokenHash  string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"` /* hex(SHA-256(明文)) */
+	Scopes     string     `gorm:"type:varchar(512);not null" json:"scopes"`       /* 如 tunnels:read,stats:read */
+	AllowedIPs string     `gorm:"type:varchar(1024)" json:"allowed_ips"`          /* IP 或 CIDR */
+	ExpiresAt  *time.Time `gorm:"index" json:"expires_at"`                        /* 为空表示不过期 */
+	LastUsedAt *time.Time `gorm:"" json:"last_used_at"`
+	LastUsedIP string     `gorm:"type:varchar(64)" json:"last_used_ip"`
+	RevokedAt  *time.Time `gorm:"" json:"revoked_at"`
+}
+
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+/*
+UserSession 登录会话
+功能：每次登录创建一个会话，访问令牌携带会话 ID，吊销后立即失效；
+刷新令牌每次使用后轮换，只保存当前和上一个令牌的哈希，上一个令牌再次出现视为被盗用
+*/
+type UserSession struct {
+	BaseModel
+	UserID          string     `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	RefreshHash     string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"` /* hex(SHA-256(当前刷新令牌)) */
+	PrevRefreshHash string     `gorm:"type:varchar(64);index" json:"-"`                /* 上一个刷新令牌，用于发现重放 */
+	IP              string     `gorm:"type:varchar(64)" json:"ip"`                     /* 登录时的 IP */
+	UserAgent       string     `gorm:"type:varchar(512)" json:"user_agent"`
+	LastSeenAt      time.Time  `gorm:"" json:"last_seen_at"`
+	LastSeenIP      string     `gorm:"type:varchar(64)" json:"last_seen_ip"`
+	ExpiresAt       time.Time  `gorm:"index" json:"expires_at"` /* 刷新令牌过期时间 */
+	RevokedAt       *time.Time `gorm:"index" json:"revoked_at"`
+	RevokeReason    string     `gorm:"type:varchar(32)" json:"revoke_reason"`
+}
+
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
+
 /*
 Permission 权限模型
 功能：定义系统权限项
@@ -0,0 +1,417 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"gkipass/plane/internal/db/dao"
+	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+/*
+NodeConnectionQuality 节点 WebSocket 连接质量快照
+功能：由 ws 包根据 Ping/Pong 统计提供，PacketLoss 为 0-1 之间的比例
+*/
+type NodeConnectionQuality struct {
+	NodeID           string
+	RTT              time.Duration
+	PacketLoss       float64
+	QualityScore     int32
+	MissedHeartbeats int32
+}
+
+/*
+ConnectionQualitySource 连接质量数据源
+功能：抓取时实时读取，避免 metrics 包反向依赖 ws 包
+*/
+type ConnectionQualitySource interface {
+	NodeConnectionQuality() []NodeConnectionQuality
+}
+
+/* 业务指标描述：标签只放 ID，名称等可变属性放在 *_info 指标里，便于 PromQL 关联 */
+var (
+	tunnelInfoDesc = prometheus.NewDesc("gkipass_tunnel_info",
+		"隧道信息（值恒为 1）", []string{"tunnel_id", "tunnel_name", "user_id", "protocol", "ingress_group_id"}, nil)
+	tunnelEnabledDesc = prometheus.NewDesc("gkipass_tunnel_enabled",
+		"隧道是否启用", []string{"tunnel_id", "user_id"}, nil)
+	tunnelBytesDesc = prometheus.NewDesc("gkipass_tunnel_traffic_bytes_total",
+		"隧道累计流量（字节）", []string{"tunnel_id", "user_id", "direction"}, nil)
+	tunnelConnsDesc = prometheus.NewDesc("gkipass_tunnel_connections_total",
+		"隧道累计连接次数", []string{"tunnel_id", "user_id"}, nil)
+	tunnelActiveConnsDesc = prometheus.NewDesc("gkipass_tunnel_active_connections",
+		"隧道在各节点上的当前活跃连接数", []string{"tunnel_id", "node_id"}, nil)
+	tunnelFailoversDesc = prometheus.NewDesc("gkipass_tunnel_failover_events_total",
+		"隧道容灾切换/回切事件次数", []string{"tunnel_id", "node_id", "event_type"}, nil)
+
+	nodeInfoDesc = prometheus.NewDesc("gkipass_node_info",
+		"节点信息（值恒为 1）", []string{"node_id", "node_name", "role", "version"}, nil)
+	nodeUpDesc = prometheus.NewDesc("gkipass_node_up",
+		"节点是否在线", []string{"node_id"}, nil)
+	nodeRTTDesc = prometheus.NewDesc("gkipass_node_rtt_seconds",
+		"面板到节点 WebSocket 连接的往返时延（秒）", []string{"node_id"}, nil)
+	nodePacketLossDesc = prometheus.NewDesc("gkipass_node_packet_loss_ratio",
+		"面板到节点 WebSocket 连接的 Ping 丢失比例", []string{"node_id"}, nil)
+	nodeQualityDesc = prometheus.NewDesc("gkipass_node_connection_quality",
+		"节点连接质量评分（0-100）", []string{"node_id"}, nil)
+	nodeMissedHeartbeatsDesc = prometheus.NewDesc("gkipass_node_missed_heartbeats",
+		"节点连续未响应的 Ping 次数", []string{"node_id"}, nil)
+	nodeCPUDesc = prometheus.NewDesc("gkipass_node_cpu_usage_percent",
+		"节点 CPU 使用率（%）", []string{"node_id"}, nil)
+	nodeMemoryDesc = prometheus.NewDesc("gkipass_node_memory_usage_percent",
+		"节点内存使用率（%）", []string{"node_id"}, nil)
+	nodeDiskDesc = prometheus.NewDesc("gkipass_node_disk_usage_percent",
+		"节点磁盘使用率（%）", []string{"node_id"}, nil)
+	nodeConnectionsDesc = prometheus.NewDesc("gkipass_node_connections",
+		"节点当前连接数", []string{"node_id"}, nil)
+	nodeActiveTunnelsDesc = prometheus.NewDesc("gkipass_node_active_tunnels",
+		"节点当前运行的隧道数", []string{"node_id"}, nil)
+
+	groupInfoDesc = prometheus.NewDesc("gkipass_node_group_info",
+		"节点组信息（值恒为 1）", []string{"group_id", "group_name", "role"}, nil)
+	groupNodesDesc = prometheus.NewDesc("gkipass_node_group_nodes",
+		"节点组内节点数", []string{"group_id"}, nil)
+	groupNodesOnlineDesc = prometheus.NewDesc("gkipass_node_group_nodes_online",
+		"节点组内在线节点数", []string{"group_id"}, nil)
+	groupBytesDesc = prometheus.NewDesc("gkipass_node_group_traffic_bytes_total",
+		"以该组为入口的隧道累计流量（字节）", []string{"group_id", "direction"}, nil)
+
+	userTunnelsDesc = prometheus.NewDesc("gkipass_user_tunnels",
+		"用户隧道数", []string{"user_id"}, nil)
+	userTrafficDesc = prometheus.NewDesc("gkipass_user_traffic_used_bytes",
+		"用户现有隧道的累计流量（字节）", []string{"user_id"}, nil)
+	userTrafficLimitDesc = prometheus.NewDesc("gkipass_user_traffic_limit_bytes",
+		"用户套餐流量上限（字节），无限制时不导出", []string{"user_id"}, nil)
+	userTunnelLimitDesc = prometheus.NewDesc("gkipass_user_tunnel_limit",
+		"用户套餐隧道数上限，无限制时不导出", []string{"user_id"}, nil)
+
+	exporterRefreshDesc = prometheus.NewDesc("gkipass_exporter_last_refresh_timestamp_seconds",
+		"业务指标最近一次从数据库刷新的时间", nil, nil)
+)
+
+/* tunnelConnTTL 隧道实时连接数超过该时长未上报则不再导出 */
+const tunnelConnTTL = 5 * time.Minute
+
+type tunnelConnKey struct {
+	nodeID   string
+	tunnelID string
+}
+
+type tunnelConnSample struct {
+	active int64
+	at     time.Time
+}
+
+var liveTunnelConns = struct {
+	sync.Mutex
+	samples map[tunnelConnKey]tunnelConnSample
+}{samples: make(map[tunnelConnKey]tunnelConnSample)}
+
+/*
+ObserveTunnelConnections 记录节点上报的隧道活跃连接数
+功能：由节点流量上报驱动，数据只保存在内存中
+*/
+func ObserveTunnelConnections(nodeID, tunnelID string, active int64) {
+	liveTunnelConns.Lock()
+	defer liveTunnelConns.Unlock()
+	liveTunnelConns.samples[tunnelConnKey{nodeID: nodeID, tunnelID: tunnelID}] = tunnelConnSample{
+		active: active,
+		at:     time.Now(),
+	}
+}
+
+/*
+PlaneExporter 业务指标导出器
+功能：周期从数据库汇总隧道、节点、节点组和用户维度的数据并缓存为常量指标，
+抓取时再合并节点连接质量和隧道实时连接数，抓取本身不访问数据库。
+同时维护 prometheus.go 中按组/用户聚合的旧指标
+*/
+type PlaneExporter struct {
+	dao      *dao.DAO
+	quality  ConnectionQualitySource
+	interval time.Duration
+
+	mu          sync.RWMutex
+	cached      []prometheus.Metric
+	refreshedAt time.Time
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+/*
+NewPlaneExporter 创建业务指标导出器
+功能：quality 可为 nil（不导出连接质量）
+*/
+func NewPlaneExporter(d *dao.DAO, quality ConnectionQualitySource) *PlaneExporter {
+	return &PlaneExporter{
+		dao:      d,
+		quality:  quality,
+		interval: 15 * time.Second,
+		stopChan: make(chan struct{}),
+	}
+}
+
+/*
+Start 注册到默认 Registry 并启动周期刷新
+*/
+func (e *PlaneExporter) Start() {
+	e.refresh()
+	if err := prometheus.Register(e); err != nil {
+		logger.Error("注册业务指标导出器失败", zap.Error(err))
+		return
+	}
+	go e.loop()
+	logger.Info("✓ Prometheus 业务指标导出器已启动", zap.Duration("refresh", e.interval))
+}
+
+/*
+Stop 停止刷新并从默认 Registry 注销
+*/
+func (e *PlaneExporter) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopChan)
+		prometheus.Unregister(e)
+	})
+}
+
+func (e *PlaneExporter) loop() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.refresh()
+		case <-e.stopChan:
+			return
+		}
+	}
+}
+
+/*
+Describe 实现 prometheus.Collector
+*/
+func (e *PlaneExporter) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		tunnelInfoDesc, tunnelEnabledDesc, tunnelBytesDesc, tunnelConnsDesc, tunnelActiveConnsDesc, tunnelFailoversDesc,
+		nodeInfoDesc, nodeUpDesc, nodeRTTDesc, nodePacketLossDesc, nodeQualityDesc, nodeMissedHeartbeatsDesc,
+		nodeCPUDesc, nodeMemoryDesc, nodeDiskDesc, nodeConnectionsDesc, nodeActiveTunnelsDesc,
+		groupInfoDesc, groupNodesDesc, groupNodesOnlineDesc, groupBytesDesc,
+		userTunnelsDesc, userTrafficDesc, userTrafficLimitDesc, userTunnelLimitDesc,
+		exporterRefreshDesc,
+	} {
+		ch <- desc
+	}
+}
+
+/*
+Collect 实现 prometheus.Collector
+功能：输出缓存的数据库快照，再实时读取连接质量和隧道连接数
+*/
+func (e *PlaneExporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.RLock()
+	cached := e.cached
+	refreshedAt := e.refreshedAt
+	e.mu.RUnlock()
+
+	for _, m := range cached {
+		ch <- m
+	}
+	if !refreshedAt.IsZero() {
+		ch <- prometheus.MustNewConstMetric(exporterRefreshDesc, prometheus.GaugeValue, float64(refreshedAt.Unix()))
+	}
+
+	if e.quality != nil {
+		for _, q := range e.quality.NodeConnectionQuality() {
+			ch <- prometheus.MustNewConstMetric(nodeRTTDesc, prometheus.GaugeValue, q.RTT.Seconds(), q.NodeID)
+			ch <- prometheus.MustNewConstMetric(nodePacketLossDesc, prometheus.GaugeValue, q.PacketLoss, q.NodeID)
+			ch <- prometheus.MustNewConstMetric(nodeQualityDesc, prometheus.GaugeValue, float64(q.QualityScore), q.NodeID)
+			ch <- prometheus.MustNewConstMetric(nodeMissedHeartbeatsDesc, prometheus.GaugeValue, float64(q.MissedHeartbeats), q.NodeID)
+		}
+	}
+
+	now := time.Now()
+	liveTunnelConns.Lock()
+	for key, sample := range liveTunnelConns.samples {
+		if now.Sub(sample.at) > tunnelConnTTL {
+			delete(liveTunnelConns.samples, key)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(tunnelActiveConnsDesc, prometheus.GaugeValue,
+			float64(sample.active), key.tunnelID, key.nodeID)
+	}
+	liveTunnelConns.Unlock()
+}
+
+/* metricSet 刷新期间累积的常量指标 */
+type metricSet []prometheus.Metric
+
+func (s *metricSet) add(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels ...string) {
+	*s = append(*s, prometheus.MustNewConstMetric(desc, valueType, value, labels...))
+}
+
+/*
+refresh 从数据库重建指标快照
+功能：任一查询失败只跳过对应部分，保留其余指标
+*/
+func (e *PlaneExporter) refresh() {
+	var set metricSet
+
+	tunnels, err := e.dao.ListTunnelTrafficTotals()
+	if err != nil {
+		logger.Warn("导出隧道指标失败", zap.Error(err))
+	}
+	e.collectTunnels(&set, tunnels)
+
+	e.collectNodes(&set)
+	e.collectGroups(&set, tunnels)
+	e.collectUsers(&set, tunnels)
+
+	e.mu.Lock()
+	e.cached = set
+	e.refreshedAt = time.Now()
+	e.mu.Unlock()
+}
+
+func (e *PlaneExporter) collectTunnels(set *metricSet, tunnels []models.Tunnel) {
+	TunnelsActive.Reset()
+	for _, t := range tunnels {
+		enabled := 0.0
+		if t.Enabled {
+			enabled = 1
+			TunnelsActive.WithLabelValues(t.CreatedBy, string(t.Protocol)).Inc()
+		}
+		set.add(tunnelInfoDesc, prometheus.GaugeValue, 1, t.ID, t.Name, t.CreatedBy, string(t.Protocol), t.IngressGroupID)
+		set.add(tunnelEnabledDesc, prometheus.GaugeValue, enabled, t.ID, t.CreatedBy)
+		set.add(tunnelBytesDesc, prometheus.CounterValue, float64(t.BytesIn), t.ID, t.CreatedBy, "in")
+		set.add(tunnelBytesDesc, prometheus.CounterValue, float64(t.BytesOut), t.ID, t.CreatedBy, "out")
+		set.add(tunnelConnsDesc, prometheus.CounterValue, float64(t.ConnectionCount), t.ID, t.CreatedBy)
+	}
+
+	counts, err := e.dao.CountFailoverEvents()
+	if err != nil {
+		logger.Warn("导出容灾事件指标失败", zap.Error(err))
+		return
+	}
+	for _, c := range counts {
+		set.add(tunnelFailoversDesc, prometheus.CounterValue, float64(c.Count), c.TunnelID, c.NodeID, c.EventType)
+	}
+}
+
+/*
+collectNodes 导出节点状态和最近 5 分钟内的监控数据
+*/
+func (e *PlaneExporter) collectNodes(set *metricSet) {
+	nodes, err := e.dao.ListNodesForMetrics()
+	if err != nil {
+		logger.Warn("导出节点指标失败", zap.Error(err))
+		return
+	}
+
+	NodesOnline.Reset()
+	for _, n := range nodes {
+		up := 0.0
+		if n.Status == models.NodeStatusOnline {
+			up = 1
+		}
+		set.add(nodeInfoDesc, prometheus.GaugeValue, 1, n.ID, n.Name, string(n.Role), n.Version)
+		set.add(nodeUpDesc, prometheus.GaugeValue, up, n.ID)
+
+		if len(n.Groups) == 0 {
+			NodesOnline.WithLabelValues(string(n.Role), "").Add(up)
+		}
+		for _, g := range n.Groups {
+			NodesOnline.WithLabelValues(string(n.Role), g.ID).Add(up)
+		}
+	}
+
+	latest, err := e.dao.ListLatestNodeMonitoringData(time.Now().Add(-5 * time.Minute))
+	if err != nil {
+		logger.Warn("导出节点监控指标失败", zap.Error(err))
+		return
+	}
+	for _, d := range latest {
+		set.add(nodeCPUDesc, prometheus.GaugeValue, d.CPUUsage, d.NodeID)
+		set.add(nodeMemoryDesc, prometheus.GaugeValue, d.MemoryUsagePercent, d.NodeID)
+		set.add(nodeDiskDesc, prometheus.GaugeValue, d.DiskUsagePercent, d.NodeID)
+		set.add(nodeConnectionsDesc, prometheus.GaugeValue, float64(d.TotalConnections), d.NodeID)
+		set.add(nodeActiveTunnelsDesc, prometheus.GaugeValue, float64(d.ActiveTunnels), d.NodeID)
+	}
+}
+
+func (e *PlaneExporter) collectGroups(set *metricSet, tunnels []models.Tunnel) {
+	groups, err := e.dao.ListNodeGroups("")
+	if err != nil {
+		logger.Warn("导出节点组指标失败", zap.Error(err))
+		return
+	}
+
+	bytesIn := make(map[string]int64)
+	bytesOut := make(map[string]int64)
+	for _, t := range tunnels {
+		if t.IngressGroupID != "" {
+			bytesIn[t.IngressGroupID] += t.BytesIn
+			bytesOut[t.IngressGroupID] += t.BytesOut
+		}
+	}
+
+	for _, g := range groups {
+		online := 0
+		for _, n := range g.Nodes {
+			if n.Status == models.NodeStatusOnline {
+				online++
+			}
+		}
+		set.add(groupInfoDesc, prometheus.GaugeValue, 1, g.ID, g.Name, string(g.Role))
+		set.add(groupNodesDesc, prometheus.GaugeValue, float64(len(g.Nodes)), g.ID)
+		set.add(groupNodesOnlineDesc, prometheus.GaugeValue, float64(online), g.ID)
+		set.add(groupBytesDesc, prometheus.CounterValue, float64(bytesIn[g.ID]), g.ID, "in")
+		set.add(groupBytesDesc, prometheus.CounterValue, float64(bytesOut[g.ID]), g.ID, "out")
+	}
+}
+
+/*
+collectUsers 导出用户隧道数、流量和套餐配额
+功能：UserQuotaUsage 按 traffic / tunnels 两类输出使用率（0-1），仅对有上限的套餐
+*/
+func (e *PlaneExporter) collectUsers(set *metricSet, tunnels []models.Tunnel) {
+	tunnelCount := make(map[string]int)
+	traffic := make(map[string]int64)
+	for _, t := range tunnels {
+		tunnelCount[t.CreatedBy]++
+		traffic[t.CreatedBy] += t.BytesIn + t.BytesOut
+	}
+	for userID, count := range tunnelCount {
+		set.add(userTunnelsDesc, prometheus.GaugeValue, float64(count), userID)
+		set.add(userTrafficDesc, prometheus.GaugeValue, float64(traffic[userID]), userID)
+	}
+
+	subs, err := e.dao.ListActiveSubscriptions()
+	if err != nil {
+		logger.Warn("导出用户配额指标失败", zap.Error(err))
+		return
+	}
+
+	UserQuotaUsage.Reset()
+	seen := make(map[string]bool)
+	for _, sub := range subs {
+		/* 按创建时间倒序，同一用户只取最新的订阅 */
+		if seen[sub.UserID] {
+			continue
+		}
+		seen[sub.UserID] = true
+
+		if limit := sub.Plan.TrafficLimit; limit > 0 {
+			set.add(userTrafficLimitDesc, prometheus.GaugeValue, float64(limit), sub.UserID)
+			UserQuotaUsage.WithLabelValues(sub.UserID, "traffic").Set(float64(traffic[sub.UserID]) / float64(limit))
+		}
+		if limit := sub.Plan.RuleLimit; limit > 0 {
+			set.add(userTunnelLimitDesc, prometheus.GaugeValue, float64(limit), sub.UserID)
+			UserQuotaUsage.WithLabelValues(sub.UserID, "tunnels").Set(float64(tunnelCount[sub.UserID]) / float64(limit))
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"gkipass/plane/internal/db/dao"
+	"gkipass/plane/internal/db/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type staticQuality []NodeConnectionQuality
+
+func (q staticQuality) NodeConnectionQuality() []NodeConnectionQuality { return q }
+
+/*
+findMetric 在采集结果中按名称和标签查找指标值
+*/
+func findMetric(t *testing.T, families []*dto.MetricFamily, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range family.GetMetric() {
+			got := make(map[string]string)
+			for _, lp := range m.GetLabel() {
+				got[lp.GetName()] = lp.GetValue()
+			}
+			for k, v := range labels {
+				if got[k] != v {
+					continue next
+				}
+			}
+			switch {
+			case m.GetCounter() != nil:
+				return m.GetCounter().GetValue(), true
+			case m.GetGauge() != nil:
+				return m.GetGauge().GetValue(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+/*
+TestPlaneExporter_Collect 测试隧道、节点、节点组和用户指标导出
+*/
+func TestPlaneExporter_Collect(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Node{}, &models.NodeGroup{}, &models.Tunnel{},
+		&models.NodeMonitoringData{}, &models.Plan{}, &models.Subscription{}); err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+	db.Exec(`CREATE TABLE failover_events (id TEXT, node_id TEXT, tunnel_id TEXT, event_type TEXT, deleted_at DATETIME)`)
+	d := dao.New(db)
+
+	group := &models.NodeGroup{Name: "hk", Role: models.NodeRoleIngress}
+	group.ID = "group-hk"
+	db.Create(group)
+	for _, n := range []*models.Node{
+		{Name: "a", Status: models.NodeStatusOnline, Role: models.NodeRoleIngress},
+		{Name: "b", Status: models.NodeStatusOffline, Role: models.NodeRoleIngress},
+	} {
+		n.ID = "node-" + n.Name
+		db.Create(n)
+		db.Model(n).Association("Groups").Append(group)
+	}
+	db.Create(&models.NodeMonitoringData{ID: "m1", NodeID: "node-a", Timestamp: time.Now(), CPUUsage: 42})
+
+	for i, bytes := range []int64{100, 300} {
+		tunnel := &models.Tunnel{Name: "t", CreatedBy: "user-1", Enabled: true, Protocol: "tcp",
+			IngressGroupID: group.ID, BytesIn: bytes, BytesOut: bytes * 2, TargetAddress: "127.0.0.1"}
+		tunnel.ID = []string{"tunnel-1", "tunnel-2"}[i]
+		db.Create(tunnel)
+	}
+	db.Exec(`INSERT INTO failover_events (id, node_id, tunnel_id, event_type) VALUES ('e1','node-a','tunnel-1','failover'), ('e2','node-a','tunnel-1','failover')`)
+
+	plan := &models.Plan{Name: "basic", Price: 1, Duration: 1, TrafficLimit: 2400, RuleLimit: 4}
+	db.Create(plan)
+	db.Create(&models.Subscription{UserID: "user-1", PlanID: plan.ID, Status: "active",
+		StartAt: time.Now(), ExpireAt: time.Now().Add(time.Hour)})
+
+	ObserveTunnelConnections("node-a", "tunnel-1", 7)
+
+	exporter := NewPlaneExporter(d, staticQuality{{NodeID: "node-a", RTT: 40 * time.Millisecond, PacketLoss: 0.25, QualityScore: 90}})
+	exporter.refresh()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("采集指标失败: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{"gkipass_tunnel_traffic_bytes_total", map[string]string{"tunnel_id": "tunnel-2", "direction": "out"}, 600},
+		{"gkipass_tunnel_active_connections", map[string]string{"tunnel_id": "tunnel-1", "node_id": "node-a"}, 7},
+		{"gkipass_tunnel_failover_events_total", map[string]string{"tunnel_id": "tunnel-1", "event_type": "failover"}, 2},
+		{"gkipass_node_up", map[string]string{"node_id": "node-b"}, 0},
+		{"gkipass_node_cpu_usage_percent", map[string]string{"node_id": "node-a"}, 42},
+		{"gkipass_node_rtt_seconds", map[string]string{"node_id": "node-a"}, 0.04},
+		{"gkipass_node_packet_loss_ratio", map[string]string{"node_id": "node-a"}, 0.25},
+		{"gkipass_node_group_nodes", map[string]string{"group_id": "group-hk"}, 2},
+		{"gkipass_node_group_nodes_online", map[string]string{"group_id": "group-hk"}, 1},
+		{"gkipass_node_group_traffic_bytes_total", map[string]string{"group_id": "group-hk", "direction": "in"}, 400},
+		{"gkipass_user_tunnels", map[string]string{"user_id": "user-1"}, 2},
+		{"gkipass_user_traffic_used_bytes", map[string]string{"user_id": "user-1"}, 1200},
+		{"gkipass_user_traffic_limit_bytes", map[string]string{"user_id": "user-1"}, 2400},
+		{"gkipass_user_tunnel_limit", map[string]string{"user_id": "user-1"}, 4},
+	}
+	for _, c := range cases {
+		got, ok := findMetric(t, families, c.name, c.labels)
+		if !ok || got != c.want {
+			t.Errorf("%s%v 期望 %v，实际 %v（存在=%v）", c.name, c.labels, c.want, got, ok)
+		}
+	}
+
+	/* 旧的聚合指标同步更新：配额使用率 1200/2400 */
+	families, _ = prometheus.DefaultGatherer.Gather()
+	if got, ok := findMetric(t, families, "gkipass_user_quota_usage", map[string]string{"user_id": "user-1", "quota_type": "traffic"}); !ok || got != 0.5 {
+		t.Errorf("流量配额使用率期望 0.5，实际 %v（存在=%v）", got, ok)
+	}
+}
@@ -0,0 +1,329 @@
+/*
+Package oidc OpenID Connect 依赖方（授权码 + PKCE）
+
+面板作为 OIDC 客户端对接 Keycloak、Azure AD 等身份提供方，只实现登录需要的部分：
+  - 发现：读取 {issuer}/.well-known/openid-configuration，issuer 必须与配置一致
+  - 密钥：按 jwks_uri 拉取 JWKS（RSA、EC），遇到未知 kid 时刷新，刷新间隔不少于 1 分钟
+  - ID Token：校验签名（RS256/384/512、PS256/384/512、ES256/384/512）、iss、aud、azp、exp、nonce
+
+授权码交换使用 golang.org/x/oauth2，PKCE 使用其 GenerateVerifier / S256ChallengeOption。
+
+使用示例：
+
+	p, err := oidc.Discover(ctx, "https://sso.example.com/realms/main", nil)
+	conf := &oauth2.Config{ClientID: id, ClientSecret: secret, Endpoint: p.Endpoint(), Scopes: []string{"openid", "email"}}
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	idToken, err := p.VerifyIDToken(ctx, token.Extra("id_token").(string), id, nonce)
+*/
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+const (
+	maxResponseSize    = 1 << 20 /* 发现文档、JWKS 响应体上限 */
+	jwksRefreshBackoff = time.Minute
+	clockSkew          = time.Minute
+)
+
+/* signingAlgorithms 接受的 ID Token 签名算法（不接受 none 和 HMAC） */
+var signingAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+/*
+Provider 已完成发现的身份提供方
+功能：并发安全，JWKS 在首次校验时拉取并缓存
+*/
+type Provider struct {
+	Issuer                string
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	UserinfoEndpoint      string
+	JWKSURI               string
+
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+/* discoveryDocument 发现文档中用到的字段 */
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+/*
+IDToken 校验通过的 ID Token
+功能：Claims 为全部声明，用于按配置读取用户名、组、角色等
+*/
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Claims        map[string]interface{}
+}
+
+/*
+Discover 读取发现文档创建 Provider
+功能：client 为空时使用 10 秒超时的默认客户端
+*/
+func Discover(ctx context.Context, issuer string, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	var doc discoveryDocument
+	if err := getJSON(ctx, client, issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("读取 OIDC 发现文档失败: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("发现文档的 issuer %q 与配置的 %q 不一致", doc.Issuer, issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("发现文档缺少 authorization_endpoint、token_endpoint 或 jwks_uri")
+	}
+
+	return &Provider{
+		Issuer:                doc.Issuer,
+		AuthorizationEndpoint: doc.AuthorizationEndpoint,
+		TokenEndpoint:         doc.TokenEndpoint,
+		UserinfoEndpoint:      doc.UserinfoEndpoint,
+		JWKSURI:               doc.JWKSURI,
+		client:                client,
+	}, nil
+}
+
+/* Endpoint 返回 oauth2 使用的端点 */
+func (p *Provider) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{AuthURL: p.AuthorizationEndpoint, TokenURL: p.TokenEndpoint}
+}
+
+/*
+VerifyIDToken 校验 ID Token
+功能：签名、iss、aud 包含 clientID、多个 aud 时 azp 必须为 clientID、exp/iat（允许 1 分钟误差）、nonce
+*/
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, clientID, nonce string) (*IDToken, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingAlgorithms),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ID Token 校验失败: %w", err)
+	}
+
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != clientID {
+			return nil, errors.New("ID Token 的 azp 与客户端不一致")
+		}
+	}
+	if got, _ := claims["nonce"].(string); nonce == "" || got != nonce {
+		return nil, errors.New("ID Token 的 nonce 不匹配")
+	}
+
+	token := &IDToken{Claims: claims}
+	token.Issuer, _ = claims["iss"].(string)
+	token.Subject, _ = claims["sub"].(string)
+	token.Email, _ = claims["email"].(string)
+	token.Name, _ = claims["name"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		token.EmailVerified = v
+	case string: /* 部分提供方以字符串返回 */
+		token.EmailVerified = v == "true"
+	}
+	if token.Subject == "" {
+		return nil, errors.New("ID Token 缺少 sub")
+	}
+	return token, nil
+}
+
+/*
+ClaimStrings 按点分路径读取声明，返回字符串列表
+功能：支持嵌套对象（如 Keycloak 的 realm_access.roles），值为字符串或字符串数组
+*/
+func ClaimStrings(claims map[string]interface{}, path string) []string {
+	if path == "" {
+		return nil
+	}
+	var cur interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	switch v := cur.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+/* key 返回 kid 对应的公钥，未知 kid 时刷新 JWKS；kid 为空且只有一个密钥时使用该密钥 */
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k := p.lookup(kid); k != nil {
+		return k, nil
+	}
+	if !p.keysFetched.IsZero() && time.Since(p.keysFetched) < jwksRefreshBackoff {
+		return nil, fmt.Errorf("未知的签名密钥 %q", kid)
+	}
+	keys, err := fetchJWKS(ctx, p.client, p.JWKSURI)
+	p.keysFetched = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if k := p.lookup(kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("未知的签名密钥 %q", kid)
+}
+
+func (p *Provider) lookup(kid string) crypto.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k
+		}
+	}
+	return p.keys[kid]
+}
+
+/* jsonWebKey JWKS 中的一个密钥 */
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+/* fetchJWKS 拉取并解析 JWKS，跳过加密用途和不支持的密钥 */
+func fetchJWKS(ctx context.Context, client *http.Client, uri string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, client, uri, &set); err != nil {
+		return nil, fmt.Errorf("读取 JWKS 失败: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS 中没有可用的签名密钥")
+	}
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err1 := decode(k.N)
+		e, err2 := decode(k.E)
+		if err := errors.Join(err1, err2); err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("无效的 RSA 密钥")
+		}
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线 %s", k.Crv)
+		}
+		x, err1 := decode(k.X)
+		y, err2 := decode(k.Y)
+		if err := errors.Join(err1, err2); err != nil {
+			return nil, errors.New("无效的 EC 密钥")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("EC 公钥不在曲线上")
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥类型 %s", k.Kty)
+	}
+}
+
+func getJSON(ctx context.Context, client *http.Client, uri string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回状态码 %d", uri, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
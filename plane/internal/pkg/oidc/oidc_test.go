@@ -0,0 +1,106 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://sso.example.com/realms/main"
+	testClientID = "gkipass"
+	testNonce    = "nonce-1"
+)
+
+/* newTestProvider 创建已缓存签名密钥的 Provider，不发起网络请求 */
+func newTestProvider(t *testing.T) (*Provider, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	p := &Provider{
+		Issuer:      testIssuer,
+		keys:        map[string]crypto.PublicKey{"k1": &key.PublicKey},
+		keysFetched: time.Now(),
+	}
+	return p, key
+}
+
+func signToken(t *testing.T, key interface{}, method jwt.SigningMethod, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	return raw
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            testIssuer,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          testNonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"realm_access":   map[string]interface{}{"roles": []interface{}{"ops", "admin"}},
+	}
+}
+
+/* TestVerifyIDToken 合法令牌通过并解析声明，签发方、受众、nonce、有效期、算法、密钥不符时拒绝 */
+func TestVerifyIDToken(t *testing.T) {
+	p, key := newTestProvider(t)
+	ctx := context.Background()
+
+	token, err := p.VerifyIDToken(ctx, signToken(t, key, jwt.SigningMethodES256, "k1", validClaims()), testClientID, testNonce)
+	if err != nil {
+		t.Fatalf("合法令牌应通过校验: %v", err)
+	}
+	if token.Subject != "user-1" || token.Email != "alice@example.com" || !token.EmailVerified {
+		t.Errorf("声明解析不符合预期: %+v", token)
+	}
+	if roles := ClaimStrings(token.Claims, "realm_access.roles"); len(roles) != 2 || roles[1] != "admin" {
+		t.Errorf("嵌套声明应按点分路径读取，实际 %v", roles)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cases := []struct {
+		name   string
+		mutate func(jwt.MapClaims)
+		key    interface{}
+		method jwt.SigningMethod
+		kid    string
+	}{
+		{"签发方不符", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, key, jwt.SigningMethodES256, "k1"},
+		{"受众不符", func(c jwt.MapClaims) { c["aud"] = "other-client" }, key, jwt.SigningMethodES256, "k1"},
+		{"多受众时 azp 不符", func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "other"}; c["azp"] = "other" }, key, jwt.SigningMethodES256, "k1"},
+		{"nonce 不符", func(c jwt.MapClaims) { c["nonce"] = "replayed" }, key, jwt.SigningMethodES256, "k1"},
+		{"已过期", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, key, jwt.SigningMethodES256, "k1"},
+		{"缺少 sub", func(c jwt.MapClaims) { delete(c, "sub") }, key, jwt.SigningMethodES256, "k1"},
+		{"签名密钥不符", nil, other, jwt.SigningMethodES256, "k1"},
+		{"未知 kid", nil, key, jwt.SigningMethodES256, "k2"},
+		{"HMAC 算法", nil, []byte("secret"), jwt.SigningMethodHS256, "k1"},
+	}
+	for _, tc := range cases {
+		claims := validClaims()
+		if tc.mutate != nil {
+			tc.mutate(claims)
+		}
+		raw := signToken(t, tc.key, tc.method, tc.kid, claims)
+		if _, err := p.VerifyIDToken(ctx, raw, testClientID, testNonce); err == nil {
+			t.Errorf("%s：校验应失败", tc.name)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Package tracing 全局链路追踪
+
+基于 OpenTelemetry，串联一次隧道变更从 API 请求到节点落地的全过程：
+  - HTTP 请求：middleware.Tracing 为每个请求创建服务端 span，并复用调用方的 traceparent
+  - 规则同步：隧道服务和节点同步服务在请求 span 下创建子 span
+  - 节点下发：ws.Message.Trace 携带 W3C 追踪上下文，节点应用规则和启动监听作为子 span 上报
+  - 导出方式：otlp（OTLP/HTTP 收集器）或 file（本地文件，每行一个 JSON span）
+
+未调用 Init 时使用 OpenTelemetry 默认的空实现，所有 span 不记录、不导出。
+
+使用示例：
+
+	tracing.Init(&tracing.Config{Enabled: true, Exporter: "otlp", Endpoint: "127.0.0.1:4318"})
+	defer tracing.Shutdown()
+	ctx, span := tracing.Start(ctx, "GormTunnelService.UpdateTunnel")
+	defer func() { tracing.End(span, err) }()
+*/
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+/* 导出方式 */
+const (
+	ExporterOTLP = "otlp" /* 经 OTLP/HTTP 发送到收集器 */
+	ExporterFile = "file" /* 写入本地文件 */
+)
+
+/* instrumentationName 面板侧 Tracer 名称 */
+const instrumentationName = "gkipass/plane"
+
+/* Propagator HTTP 头和节点消息中的追踪上下文格式（W3C traceparent/tracestate + baggage） */
+var Propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+var (
+	provider *sdktrace.TracerProvider
+	file     *os.File
+)
+
+/*
+Config 链路追踪配置
+功能：选择导出方式和采样率
+*/
+type Config struct {
+	Enabled     bool    /* 是否启用，关闭时不创建导出器 */
+	Exporter    string  /* 导出方式：otlp, file，默认 otlp */
+	Endpoint    string  /* OTLP/HTTP 收集器地址（host:port），默认 127.0.0.1:4318 */
+	Insecure    bool    /* 不使用 TLS 连接收集器 */
+	FilePath    string  /* 文件导出路径，默认 ./logs/traces.jsonl */
+	SampleRatio float64 /* 采样率 (0,1]，默认 1；调用方已带采样决定时沿用调用方 */
+	ServiceName string  /* 上报的服务名，默认 gkipass-plane */
+}
+
+/*
+Init 初始化全局链路追踪
+功能：按配置创建导出器并注册为全局 TracerProvider 和传播器；未启用时只注册传播器
+*/
+func Init(cfg *Config) error {
+	otel.SetTextMapPropagator(Propagator)
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	/* 填充默认值 */
+	if cfg.Exporter == "" {
+		cfg.Exporter = ExporterOTLP
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "gkipass-plane"
+	}
+	if cfg.SampleRatio <= 0 || cfg.SampleRatio > 1 {
+		cfg.SampleRatio = 1
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch strings.ToLower(cfg.Exporter) {
+	case ExporterOTLP:
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = "127.0.0.1:4318"
+		}
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		otlp, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return fmt.Errorf("创建 OTLP 导出器失败: %w", err)
+		}
+		exporter = otlp
+	case ExporterFile:
+		if cfg.FilePath == "" {
+			cfg.FilePath = "./logs/traces.jsonl"
+		}
+		if err := os.MkdirAll(filepath.Dir(cfg.FilePath), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("打开追踪文件失败: %w", err)
+		}
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("创建文件导出器失败: %w", err)
+		}
+		exporter = stdout
+		file = f
+	default:
+		return fmt.Errorf("不支持的追踪导出方式: %s", cfg.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		res = resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	zap.L().Info("链路追踪已启用",
+		zap.String("exporter", cfg.Exporter),
+		zap.String("endpoint", cfg.Endpoint),
+		zap.String("file", cfg.FilePath),
+		zap.Float64("sampleRatio", cfg.SampleRatio))
+	return nil
+}
+
+/* Shutdown 导出剩余 span 并关闭导出器，应在程序退出前调用 */
+func Shutdown() {
+	if provider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := provider.Shutdown(ctx); err != nil {
+		zap.L().Warn("关闭链路追踪失败", zap.Error(err))
+	}
+	if file != nil {
+		file.Close()
+	}
+}
+
+/* Start 创建 span，未启用追踪时返回不记录的 span */
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+/* StartKind 创建指定类型的 span（服务端请求、消息发送等） */
+func StartKind(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+/* End 结束 span，err 非空时记录错误并标记失败 */
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+/*
+Inject 将上下文中的追踪信息写入消息载体
+功能：供 ws.Message 携带到节点，没有有效 span 时返回 nil（消息中省略该字段）
+*/
+func Inject(ctx context.Context) map[string]string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	carrier := propagation.MapCarrier{}
+	Propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+/* Extract 从节点消息载体恢复追踪上下文 */
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return Propagator.Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+/* TraceID 返回上下文中的 trace ID，没有有效 span 时返回空串 */
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/*
+TestFileExporterPropagation 测试文件导出和经消息载体跨进程传递的链路
+*/
+func TestFileExporterPropagation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	if err := Init(&Config{Enabled: true, Exporter: ExporterFile, FilePath: path}); err != nil {
+		t.Fatalf("初始化链路追踪失败: %v", err)
+	}
+
+	/* 面板侧：请求 span 下发送消息，载体随消息到达节点 */
+	ctx, root := Start(context.Background(), "POST /api/v1/tunnels/:id/update")
+	sendCtx, send := Start(ctx, "ws.SendToNode")
+	carrier := Inject(sendCtx)
+	if carrier["traceparent"] == "" {
+		t.Fatalf("载体应包含 traceparent，实际 %v", carrier)
+	}
+
+	/* 节点侧：从载体恢复上下文后创建子 span */
+	_, apply := Start(Extract(context.Background(), carrier), "tunnel.AddRule")
+	End(apply, errors.New("端口已被占用"))
+	send.End()
+	root.End()
+
+	if got, want := TraceID(Extract(context.Background(), carrier)), root.SpanContext().TraceID().String(); got != want {
+		t.Errorf("节点侧 trace ID 期望 %s，实际 %s", want, got)
+	}
+	if Inject(context.Background()) != nil {
+		t.Error("没有有效 span 时不应生成载体")
+	}
+
+	Shutdown()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("打开追踪文件失败: %v", err)
+	}
+	defer f.Close()
+
+	type exported struct {
+		Name        string
+		SpanContext struct{ TraceID string }
+		Parent      struct{ SpanID string }
+		Status      struct{ Code string }
+	}
+	spans := make(map[string]exported)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span exported
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("解析导出的 span 失败: %v", err)
+		}
+		spans[span.Name] = span
+	}
+
+	if len(spans) != 3 {
+		t.Fatalf("应导出 3 个 span，实际 %d", len(spans))
+	}
+	nodeSpan, sendSpan := spans["tunnel.AddRule"], spans["ws.SendToNode"]
+	if nodeSpan.SpanContext.TraceID != root.SpanContext().TraceID().String() {
+		t.Errorf("节点 span 应属于同一链路，实际 %s", nodeSpan.SpanContext.TraceID)
+	}
+	if nodeSpan.Parent.SpanID != send.SpanContext().SpanID().String() || sendSpan.Parent.SpanID != root.SpanContext().SpanID().String() {
+		t.Error("span 父子关系不正确")
+	}
+	if nodeSpan.Status.Code != "Error" {
+		t.Errorf("失败的 span 应标记为 Error，实际 %q", nodeSpan.Status.Code)
+	}
+}
@@ -0,0 +1,401 @@
+/*
+Package webauthn WebAuthn（通行密钥、安全密钥）注册与认证校验
+
+面板把 WebAuthn 作为登录的第二因素，只实现这一场景需要的部分：
+  - 注册：请求 attestation "none"，不校验证明声明，只解析凭据 ID 和 COSE 公钥
+  - 认证：校验 clientDataJSON（类型、挑战、来源）、authenticatorData（RP ID 哈希、用户在场）和签名
+  - 算法：ES256（-7）、RS256（-257）、EdDSA（-8）
+  - 签名计数：计数回退视为凭据被克隆，拒绝认证
+
+挑战由调用方生成并保存（面板放在签名的临时令牌中），二进制字段与前端之间统一使用 base64url 编码。
+
+使用示例：
+
+	rp := &webauthn.RelyingParty{ID: "panel.example.com", Name: "GKIPass", Origins: []string{"https://panel.example.com"}}
+	challenge, _ := webauthn.NewChallenge()
+	options := rp.NewCreationOptions(challenge, userHandle, "alice", "alice", nil)
+	// 前端 navigator.credentials.create(options) 后提交 clientDataJSON 和 attestationObject
+	cred, err := rp.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+*/
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+/* COSE 算法标识 */
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+
+	challengeSize  = 32
+	defaultTimeout = 120000 /* 前端等待用户操作的超时（毫秒） */
+	minRSABits     = 2048
+)
+
+/*
+RelyingParty 依赖方（面板）
+功能：ID 为面板域名（不含协议和端口），Origins 为允许发起 WebAuthn 的页面来源
+*/
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+/* Credential 注册成功后需要保存的凭据信息 */
+type Credential struct {
+	ID        []byte
+	PublicKey []byte /* COSE_Key 原始编码 */
+	Algorithm int64
+	SignCount uint32
+	AAGUID    []byte
+}
+
+/* CredentialDescriptor 凭据描述（excludeCredentials / allowCredentials） */
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+/* CreationOptions navigator.credentials.create 的 publicKey 参数，二进制字段为 base64url */
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+/* RequestOptions navigator.credentials.get 的 publicKey 参数 */
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+/* clientData 浏览器生成的 clientDataJSON */
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+/* authenticatorData 认证器数据 */
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+/* NewChallenge 生成随机挑战 */
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("生成挑战失败: %w", err)
+	}
+	return challenge, nil
+}
+
+/* EncodeBase64URL 按 WebAuthn 约定编码二进制字段（base64url，无填充） */
+func EncodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+/* DecodeBase64URL 解码 base64url，兼容带填充的写法 */
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+/*
+NewCreationOptions 构造注册参数
+功能：userHandle 为不含个人信息的用户标识；exclude 为用户已注册的凭据 ID，避免同一认证器重复注册
+*/
+func (rp *RelyingParty) NewCreationOptions(challenge, userHandle []byte, name, displayName string, exclude [][]byte) *CreationOptions {
+	o := &CreationOptions{
+		Challenge:   EncodeBase64URL(challenge),
+		Timeout:     defaultTimeout,
+		Attestation: "none",
+	}
+	o.RP.ID, o.RP.Name = rp.ID, rp.Name
+	o.User.ID, o.User.Name, o.User.DisplayName = EncodeBase64URL(userHandle), name, displayName
+	for _, alg := range []int64{AlgES256, AlgEdDSA, AlgRS256} {
+		o.PubKeyCredParams = append(o.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int64  `json:"alg"`
+		}{"public-key", alg})
+	}
+	o.ExcludeCredentials = descriptors(exclude)
+	o.AuthenticatorSelection.ResidentKey = "preferred"
+	o.AuthenticatorSelection.UserVerification = "preferred"
+	return o
+}
+
+/* NewRequestOptions 构造认证参数，allow 为用户已注册的凭据 ID */
+func (rp *RelyingParty) NewRequestOptions(challenge []byte, allow [][]byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        EncodeBase64URL(challenge),
+		Timeout:          defaultTimeout,
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: "preferred",
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: EncodeBase64URL(id)})
+	}
+	return list
+}
+
+/*
+VerifyRegistration 校验注册结果并返回凭据
+功能：校验 clientDataJSON 和 authenticatorData，解析并检查公钥算法；不校验证明声明（attestation "none"）
+*/
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	obj, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("解析 attestationObject 失败: %w", err)
+	}
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("attestationObject 格式无效")
+	}
+	raw, ok := m["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestationObject 缺少 authData")
+	}
+
+	auth, err := rp.parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+	if auth.flags&flagAttested == 0 || len(auth.credentialID) == 0 {
+		return nil, errors.New("认证器未返回凭据")
+	}
+
+	alg, _, err := parsePublicKey(auth.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        auth.credentialID,
+		PublicKey: auth.publicKey,
+		Algorithm: alg,
+		SignCount: auth.signCount,
+		AAGUID:    auth.aaguid,
+	}, nil
+}
+
+/*
+VerifyAssertion 校验认证结果
+功能：校验通过时返回认证器的新签名计数，调用方应保存；计数回退（可能被克隆）时返回错误
+*/
+func (rp *RelyingParty) VerifyAssertion(cred *Credential, challenge, clientDataJSON, authData, signature []byte) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	auth, err := rp.parseAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+
+	_, pub, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientHash := sha256.Sum256(clientDataJSON)
+	signed := make([]byte, 0, len(authData)+len(clientHash))
+	signed = append(append(signed, authData...), clientHash[:]...)
+	if err := verifySignature(pub, signed, signature); err != nil {
+		return 0, err
+	}
+
+	if (auth.signCount != 0 || cred.SignCount != 0) && auth.signCount <= cred.SignCount {
+		return 0, errors.New("签名计数回退，凭据可能已被复制")
+	}
+	return auth.signCount, nil
+}
+
+/* verifyClientData 校验类型、挑战和来源 */
+func (rp *RelyingParty) verifyClientData(raw []byte, typ string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("解析 clientDataJSON 失败: %w", err)
+	}
+	if cd.Type != typ {
+		return fmt.Errorf("clientData 类型应为 %s，实际 %s", typ, cd.Type)
+	}
+	got, err := DecodeBase64URL(cd.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return errors.New("挑战不匹配")
+	}
+	for _, origin := range rp.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("不允许的来源: %s", cd.Origin)
+}
+
+/* parseAuthenticatorData 解析认证器数据并校验 RP ID 哈希和用户在场标志 */
+func (rp *RelyingParty) parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticatorData 长度不足")
+	}
+	auth := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(auth.rpIDHash, rpIDHash[:]) {
+		return nil, errors.New("RP ID 不匹配")
+	}
+	if auth.flags&flagUserPresent == 0 {
+		return nil, errors.New("认证器未确认用户在场")
+	}
+
+	if auth.flags&flagAttested != 0 {
+		rest := data[37:]
+		if len(rest) < 18 {
+			return nil, errors.New("凭据数据长度不足")
+		}
+		auth.aaguid = append([]byte(nil), rest[:16]...)
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || len(rest) < idLen {
+			return nil, errors.New("凭据 ID 长度无效")
+		}
+		auth.credentialID = append([]byte(nil), rest[:idLen]...)
+		rest = rest[idLen:]
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("解析凭据公钥失败: %w", err)
+		}
+		auth.publicKey = append([]byte(nil), rest[:n]...)
+	}
+	return auth, nil
+}
+
+/* parsePublicKey 解析 COSE_Key，返回算法和公钥 */
+func parsePublicKey(raw []byte) (int64, crypto.PublicKey, error) {
+	v, _, err := decodeCBOR(raw)
+	if err != nil {
+		return 0, nil, fmt.Errorf("解析公钥失败: %w", err)
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, errors.New("公钥格式无效")
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == AlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, errors.New("仅支持 P-256 曲线")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return 0, nil, errors.New("公钥不在曲线上")
+		}
+		return alg, pub, nil
+
+	case kty == 3 && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n)*8 < minRSABits || len(e) == 0 || len(e) > 4 {
+			return 0, nil, errors.New("RSA 公钥无效")
+		}
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, nil
+
+	case kty == 1 && alg == AlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, errors.New("仅支持 Ed25519 曲线")
+		}
+		return alg, ed25519.PublicKey(x), nil
+
+	default:
+		return 0, nil, fmt.Errorf("不支持的公钥算法: kty=%d alg=%d", kty, alg)
+	}
+}
+
+func verifySignature(pub crypto.PublicKey, signed, signature []byte) error {
+	var ok bool
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		ok = ecdsa.VerifyASN1(k, digest[:], signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, signed, signature)
+	}
+	if !ok {
+		return errors.New("签名校验失败")
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+/* cborHead 编码 CBOR 头部（测试用，只覆盖需要的类型） */
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	}
+}
+
+func cborInt(v int64) []byte {
+	if v >= 0 {
+		return cborHead(0, int(v))
+	}
+	return cborHead(1, int(-1-v))
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, len(b)), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, len(s)), s...) }
+
+/* testAuthenticator 软件认证器：P-256 密钥、固定凭据 ID */
+type testAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	return &testAuthenticator{key: key, id: []byte("credential-1")}
+}
+
+func (a *testAuthenticator) coseKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	var b []byte
+	b = append(b, cborHead(5, 5)...)
+	b = append(append(b, cborInt(1)...), cborInt(2)...)
+	b = append(append(b, cborInt(3)...), cborInt(AlgES256)...)
+	b = append(append(b, cborInt(-1)...), cborInt(1)...)
+	b = append(append(b, cborInt(-2)...), cborBytes(x)...)
+	b = append(append(b, cborInt(-3)...), cborBytes(y)...)
+	return b
+}
+
+func (a *testAuthenticator) authData(rpID string, flags byte, attested bool) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, hash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func clientDataJSON(typ string, challenge []byte, origin string) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": EncodeBase64URL(challenge),
+		"origin":    origin,
+	})
+	return data
+}
+
+func (a *testAuthenticator) register(rpID, origin string, challenge []byte) ([]byte, []byte) {
+	var obj []byte
+	obj = append(obj, cborHead(5, 3)...)
+	obj = append(append(obj, cborText("fmt")...), cborText("none")...)
+	obj = append(append(obj, cborText("attStmt")...), cborHead(5, 0)...)
+	obj = append(append(obj, cborText("authData")...), cborBytes(a.authData(rpID, flagUserPresent|flagAttested, true))...)
+	return clientDataJSON("webauthn.create", challenge, origin), obj
+}
+
+func (a *testAuthenticator) assert(t *testing.T, rpID, origin string, challenge []byte) ([]byte, []byte, []byte) {
+	t.Helper()
+	a.signCount++
+	cd := clientDataJSON("webauthn.get", challenge, origin)
+	auth := a.authData(rpID, flagUserPresent, false)
+	clientHash := sha256.Sum256(cd)
+	digest := sha256.Sum256(append(append([]byte{}, auth...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	return cd, auth, sig
+}
+
+var testRP = &RelyingParty{ID: "panel.example.com", Name: "GKIPass", Origins: []string{"https://panel.example.com"}}
+
+/* TestWebAuthn_RegisterAndAssert 注册得到凭据，之后的认证签名校验通过并返回新计数 */
+func TestWebAuthn_RegisterAndAssert(t *testing.T) {
+	a := newTestAuthenticator(t)
+	challenge, _ := NewChallenge()
+
+	cd, obj := a.register(testRP.ID, testRP.Origins[0], challenge)
+	cred, err := testRP.VerifyRegistration(challenge, cd, obj)
+	if err != nil {
+		t.Fatalf("注册校验失败: %v", err)
+	}
+	if string(cred.ID) != "credential-1" || cred.Algorithm != AlgES256 {
+		t.Errorf("凭据内容不符合预期: %+v", cred)
+	}
+
+	challenge, _ = NewChallenge()
+	cd, auth, sig := a.assert(t, testRP.ID, testRP.Origins[0], challenge)
+	count, err := testRP.VerifyAssertion(cred, challenge, cd, auth, sig)
+	if err != nil {
+		t.Fatalf("认证校验失败: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("签名计数应为 1，实际 %d", count)
+	}
+}
+
+/* TestWebAuthn_Rejects 挑战、来源、RP ID、签名不符或计数回退时认证失败 */
+func TestWebAuthn_Rejects(t *testing.T) {
+	a := newTestAuthenticator(t)
+	challenge, _ := NewChallenge()
+	cd, obj := a.register(testRP.ID, testRP.Origins[0], challenge)
+	cred, err := testRP.VerifyRegistration(challenge, cd, obj)
+	if err != nil {
+		t.Fatalf("注册校验失败: %v", err)
+	}
+
+	other, _ := NewChallenge()
+	if _, err := testRP.VerifyRegistration(other, cd, obj); err == nil {
+		t.Errorf("挑战不符时注册应失败")
+	}
+
+	cases := []struct {
+		name   string
+		rpID   string
+		origin string
+		mutate func(cd, auth, sig []byte) ([]byte, []byte, []byte)
+	}{
+		{"来源不符", testRP.ID, "https://evil.example.com", nil},
+		{"RP ID 不符", "evil.example.com", testRP.Origins[0], nil},
+		{"签名被篡改", testRP.ID, testRP.Origins[0], func(cd, auth, sig []byte) ([]byte, []byte, []byte) {
+			auth[len(auth)-1] ^= 0xff
+			return cd, auth, sig
+		}},
+	}
+	for _, tc := range cases {
+		challenge, _ := NewChallenge()
+		cd, auth, sig := a.assert(t, tc.rpID, tc.origin, challenge)
+		if tc.mutate != nil {
+			cd, auth, sig = tc.mutate(cd, auth, sig)
+		}
+		if _, err := testRP.VerifyAssertion(cred, challenge, cd, auth, sig); err == nil {
+			t.Errorf("%s：认证应失败", tc.name)
+		}
+	}
+
+	/* 已保存的计数不小于认证器计数，视为克隆 */
+	cred.SignCount = 100
+	challenge, _ = NewChallenge()
+	cd, auth, sig := a.assert(t, testRP.ID, testRP.Origins[0], challenge)
+	if _, err := testRP.VerifyAssertion(cred, challenge, cd, auth, sig); err == nil {
+		t.Errorf("签名计数回退时认证应失败")
+	}
+}
+
+/* TestCBOR_Malformed 截断或过深的数据返回错误而不是崩溃 */
+func TestCBOR_Malformed(t *testing.T) {
+	deep := make([]byte, 40)
+	for i := range deep {
+		deep[i] = 0x81 /* 长度为 1 的数组 */
+	}
+	for _, data := range [][]byte{{0x5a, 0xff, 0xff, 0xff, 0xff}, {0xa1}, {0x9f}, deep} {
+		if _, _, err := decodeCBOR(data); err == nil {
+			t.Errorf("应拒绝无效数据 %x", data)
+		}
+	}
+}
@@ -170,6 +170,15 @@ type TrafficReportRequest struct {
 	TrafficOut  int64            `json:"traffic_out"`       // 出站流量(bytes)
 	Connections int              `json:"connections"`       // 连接数
 	Details     map[string]int64 `json:"details,omitempty"` // 详细统计
+	Sources     []TrafficSource  `json:"sources,omitempty"` // 按真实来源 IP 的增量
+}
+
+// TrafficSource 单个真实来源 IP 的流量增量（节点经 PROXY 头解析得到，超出跟踪上限的来源合并为 "other"）
+type TrafficSource struct {
+	IP          string `json:"ip"`
+	Connections int64  `json:"connections"`
+	BytesIn     int64  `json:"bytes_in"`
+	BytesOut    int64  `json:"bytes_out"`
 }
 
 // TrafficReportResponse 流量上报响应
@@ -267,7 +267,11 @@ func validatePortRange(portRange string) error {
 }
 
 // CheckAccess 检查访问权限
+// sourceIP 为节点上报的真实客户端地址（经 PROXY protocol 解析后可能带端口或为 IPv4 映射地址）
 func (s *ACLService) CheckAccess(ruleID, sourceIP, destIP, protocol string, port int) (bool, error) {
+	sourceIP = normalizeIP(sourceIP)
+	destIP = normalizeIP(destIP)
+
 	// 获取规则的ACL规则
 	rules, err := s.GetACLRules(ruleID)
 	if err != nil {
@@ -313,7 +317,11 @@ func (s *ACLService) CheckAccess(ruleID, sourceIP, destIP, protocol string, port
 func matchIP(ip, cidr string) bool {
 	// 如果CIDR是单个IP
 	if strings.IndexByte(cidr, '/') == -1 {
-		return ip == cidr
+		if ip == cidr {
+			return true
+		}
+		ruleIP := net.ParseIP(cidr)
+		return ruleIP != nil && ruleIP.Equal(net.ParseIP(ip))
 	}
 
 	// 检查IP是否在CIDR范围内
@@ -325,6 +333,20 @@ func matchIP(ip, cidr string) bool {
 	return ipNet.Contains(net.ParseIP(ip))
 }
 
+// normalizeIP 去掉地址中的端口并将 IPv4 映射的 IPv6 地址还原为 IPv4
+func normalizeIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if ip := net.ParseIP(addr); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			return v4.String()
+		}
+		return ip.String()
+	}
+	return addr
+}
+
 // matchProtocol 检查协议是否匹配
 func matchProtocol(protocol, ruleProtocol string) bool {
 	return strings.EqualFold(protocol, ruleProtocol)
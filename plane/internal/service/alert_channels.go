@@ -0,0 +1,554 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gkipass/plane/internal/db/models"
+)
+
+// 通用 Webhook 签名头：X-GKIPass-Signature = "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))
+const (
+	WebhookTimestampHeader = "X-GKIPass-Timestamp"
+	WebhookSignatureHeader = "X-GKIPass-Signature"
+)
+
+// alertResponseLimit 读取通道响应体的上限
+const alertResponseLimit = 64 * 1024
+
+var alertHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// AlertNotifier 告警通知通道
+type AlertNotifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// AlertChannelConfig 告警通道配置（models.AlertChannel.Config 的 JSON 结构，按通道类型取用字段）
+type AlertChannelConfig struct {
+	// slack / discord / dingtalk / feishu / wecom / webhook
+	URL    string `json:"url,omitempty"`
+	Secret string `json:"secret,omitempty"` // 钉钉/飞书的加签密钥，通用 Webhook 的 HMAC 签名密钥
+
+	// webhook
+	Method       string            `json:"method,omitempty"`        // 默认 POST
+	ContentType  string            `json:"content_type,omitempty"`  // 默认 application/json
+	Headers      map[string]string `json:"headers,omitempty"`       // 附加请求头
+	BodyTemplate string            `json:"body_template,omitempty"` // Go text/template，为空时发送默认 JSON
+
+	// email
+	SMTPHost string   `json:"smtp_host,omitempty"`
+	SMTPPort int      `json:"smtp_port,omitempty"` // 465 使用隐式 TLS，其它端口在服务器支持时使用 STARTTLS
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+
+	// telegram
+	BotToken string `json:"bot_token,omitempty"`
+	ChatID   string `json:"chat_id,omitempty"`
+}
+
+// NewAlertNotifier 按通道类型和配置创建通知通道，配置不完整时返回错误
+func NewAlertNotifier(channel *models.AlertChannel) (AlertNotifier, error) {
+	var cfg AlertChannelConfig
+	if strings.TrimSpace(channel.Config) != "" {
+		if err := json.Unmarshal([]byte(channel.Config), &cfg); err != nil {
+			return nil, fmt.Errorf("解析通道配置失败: %w", err)
+		}
+	}
+
+	switch channel.Type {
+	case models.AlertChannelEmail:
+		if cfg.SMTPHost == "" || len(cfg.To) == 0 {
+			return nil, fmt.Errorf("邮件通道需要 smtp_host 和 to")
+		}
+		return &emailNotifier{config: &EmailConfig{
+			SMTPHost: cfg.SMTPHost,
+			SMTPPort: cfg.SMTPPort,
+			Username: cfg.Username,
+			Password: cfg.Password,
+			From:     cfg.From,
+			To:       cfg.To,
+		}}, nil
+	case models.AlertChannelTelegram:
+		if cfg.BotToken == "" || cfg.ChatID == "" {
+			return nil, fmt.Errorf("Telegram 通道需要 bot_token 和 chat_id")
+		}
+		return &telegramNotifier{config: &TelegramConfig{BotToken: cfg.BotToken, ChatID: cfg.ChatID}}, nil
+	}
+
+	if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+		return nil, fmt.Errorf("%s 通道需要有效的 url", channel.Type)
+	}
+
+	switch channel.Type {
+	case models.AlertChannelSlack:
+		return &slackNotifier{url: cfg.URL}, nil
+	case models.AlertChannelDiscord:
+		return &discordNotifier{url: cfg.URL}, nil
+	case models.AlertChannelDingTalk:
+		return &dingTalkNotifier{url: cfg.URL, secret: cfg.Secret}, nil
+	case models.AlertChannelFeishu:
+		return &feishuNotifier{url: cfg.URL, secret: cfg.Secret}, nil
+	case models.AlertChannelWeCom:
+		return &weComNotifier{url: cfg.URL}, nil
+	case models.AlertChannelWebhook:
+		return newWebhookNotifier(&cfg)
+	default:
+		return nil, fmt.Errorf("不支持的通道类型: %s", channel.Type)
+	}
+}
+
+// ==================== 通用 Webhook ====================
+
+// webhookNotifier 通用 Webhook：模板渲染请求体，可选 HMAC 签名
+type webhookNotifier struct {
+	url         string
+	method      string
+	contentType string
+	headers     map[string]string
+	secret      string
+	body        *template.Template
+}
+
+func newWebhookNotifier(cfg *AlertChannelConfig) (*webhookNotifier, error) {
+	n := &webhookNotifier{
+		url:         cfg.URL,
+		method:      strings.ToUpper(cfg.Method),
+		contentType: cfg.ContentType,
+		headers:     cfg.Headers,
+		secret:      cfg.Secret,
+	}
+	if n.method == "" {
+		n.method = http.MethodPost
+	}
+	if n.contentType == "" {
+		n.contentType = "application/json"
+	}
+	if cfg.BodyTemplate != "" {
+		tmpl, err := template.New("webhook").Funcs(alertTemplateFuncs).Parse(cfg.BodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("解析请求体模板失败: %w", err)
+		}
+		n.body = tmpl
+	}
+	return n, nil
+}
+
+// alertTemplateFuncs 请求体模板可用的函数：json 输出 JSON 编码值（字符串带引号），join 拼接标签
+var alertTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, err := n.render(alert)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{"Content-Type": n.contentType}
+	for k, v := range n.headers {
+		headers[k] = v
+	}
+	if n.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		headers[WebhookTimestampHeader] = timestamp
+		headers[WebhookSignatureHeader] = SignWebhookPayload(n.secret, timestamp, body)
+	}
+
+	_, err = doAlertRequest(ctx, n.method, n.url, body, headers)
+	return err
+}
+
+// render 渲染请求体，未配置模板时使用默认 JSON
+func (n *webhookNotifier) render(alert Alert) ([]byte, error) {
+	if n.body == nil {
+		return json.Marshal(map[string]interface{}{
+			"level":     alert.Level,
+			"title":     alert.Title,
+			"message":   alert.Message,
+			"tags":      alert.Tags,
+			"rule_id":   alert.RuleID,
+			"node_id":   alert.NodeID,
+			"timestamp": alert.Time.Unix(),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := n.body.Execute(&buf, alert); err != nil {
+		return nil, fmt.Errorf("渲染请求体模板失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SignWebhookPayload 计算通用 Webhook 签名，接收方用同一密钥校验
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ==================== Slack / Discord ====================
+
+type slackNotifier struct {
+	url string
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, alert Alert) error {
+	_, err := postAlertJSON(ctx, n.url, map[string]interface{}{
+		"text": fmt.Sprintf("%s %s", alertEmoji(alert.Level), alert.Title),
+		"attachments": []map[string]interface{}{{
+			"color":  alertColorHex(alert.Level),
+			"title":  alert.Title,
+			"text":   alert.Message,
+			"footer": strings.Join(alert.Tags, ", "),
+			"ts":     alert.Time.Unix(),
+		}},
+	})
+	return err
+}
+
+type discordNotifier struct {
+	url string
+}
+
+func (n *discordNotifier) Notify(ctx context.Context, alert Alert) error {
+	color, _ := strconv.ParseInt(strings.TrimPrefix(alertColorHex(alert.Level), "#"), 16, 64)
+	_, err := postAlertJSON(ctx, n.url, map[string]interface{}{
+		"content": fmt.Sprintf("%s %s", alertEmoji(alert.Level), alert.Title),
+		"embeds": []map[string]interface{}{{
+			"title":       alert.Title,
+			"description": alert.Message,
+			"color":       color,
+			"timestamp":   alert.Time.Format(time.RFC3339),
+			"footer":      map[string]string{"text": strings.Join(alert.Tags, ", ")},
+		}},
+	})
+	return err
+}
+
+// ==================== 钉钉 / 飞书 / 企业微信 ====================
+
+// imBotResponse 钉钉/企业微信返回 errcode，飞书返回 code，非 0 表示失败
+type imBotResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+}
+
+func checkIMBotResponse(body []byte) error {
+	var resp imBotResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		// 非 JSON 响应只能以 HTTP 状态为准
+		return nil
+	}
+	if resp.ErrCode != 0 {
+		return fmt.Errorf("机器人返回错误 %d: %s", resp.ErrCode, resp.ErrMsg)
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("机器人返回错误 %d: %s", resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+type dingTalkNotifier struct {
+	url    string
+	secret string
+}
+
+func (n *dingTalkNotifier) Notify(ctx context.Context, alert Alert) error {
+	target := n.url
+	if n.secret != "" {
+		// 加签：HMAC-SHA256(secret, timestamp + "\n" + secret)，毫秒时间戳
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write([]byte(timestamp + "\n" + n.secret))
+		sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + "timestamp=" + timestamp + "&sign=" + url.QueryEscape(sign)
+	}
+
+	body, err := postAlertJSON(ctx, target, map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": alert.Title,
+			"text":  formatAlertMarkdown(alert),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return checkIMBotResponse(body)
+}
+
+type feishuNotifier struct {
+	url    string
+	secret string
+}
+
+func (n *feishuNotifier) Notify(ctx context.Context, alert Alert) error {
+	payload := map[string]interface{}{
+		"msg_type": "text",
+		"content":  map[string]string{"text": formatAlertText(alert)},
+	}
+	if n.secret != "" {
+		// 加签：以 timestamp + "\n" + secret 为密钥对空串做 HMAC-SHA256，秒级时间戳
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(timestamp+"\n"+n.secret))
+		payload["timestamp"] = timestamp
+		payload["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	body, err := postAlertJSON(ctx, n.url, payload)
+	if err != nil {
+		return err
+	}
+	return checkIMBotResponse(body)
+}
+
+type weComNotifier struct {
+	url string
+}
+
+func (n *weComNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, err := postAlertJSON(ctx, n.url, map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"content": formatAlertMarkdown(alert)},
+	})
+	if err != nil {
+		return err
+	}
+	return checkIMBotResponse(body)
+}
+
+// ==================== Telegram ====================
+
+type telegramNotifier struct {
+	config *TelegramConfig
+}
+
+func (n *telegramNotifier) Notify(ctx context.Context, alert Alert) error {
+	text := fmt.Sprintf("%s *%s*\n\n%s", alertEmoji(alert.Level), alert.Title, alert.Message)
+	_, err := postAlertJSON(ctx, fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.config.BotToken),
+		map[string]interface{}{
+			"chat_id":    n.config.ChatID,
+			"text":       text,
+			"parse_mode": "Markdown",
+		})
+	return err
+}
+
+// ==================== 邮件 ====================
+
+type emailNotifier struct {
+	config *EmailConfig
+}
+
+func (n *emailNotifier) Notify(ctx context.Context, alert Alert) error {
+	cfg := n.config
+	port := cfg.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	from := cfg.From
+	if from == "" {
+		from = cfg.Username
+	}
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: cfg.SMTPHost}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if port == 465 {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP 握手失败: %w", err)
+	}
+	defer client.Close()
+
+	if port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLS 失败: %w", err)
+			}
+		}
+	}
+	if cfg.Username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.SMTPHost)); err != nil {
+				return fmt.Errorf("SMTP 认证失败: %w", err)
+			}
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("设置发件人失败: %w", err)
+	}
+	for _, to := range cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("设置收件人 %s 失败: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildAlertEmail(from, cfg.To, alert)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("发送邮件失败: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildAlertEmail 构造纯文本告警邮件
+func buildAlertEmail(from string, to []string, alert Alert) []byte {
+	subject := fmt.Sprintf("[%s] %s", strings.ToUpper(string(alert.Level)), alert.Title)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", alert.Time.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(formatAlertText(alert)))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// ==================== 公共函数 ====================
+
+// postAlertJSON 以 JSON 发送 POST 请求，返回响应体
+func postAlertJSON(ctx context.Context, target string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return doAlertRequest(ctx, http.MethodPost, target, data, map[string]string{"Content-Type": "application/json"})
+}
+
+// doAlertRequest 发送请求，非 2xx 状态视为失败
+func doAlertRequest(ctx context.Context, method, target string, body []byte, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := alertHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, alertResponseLimit))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("返回状态 %d: %s", resp.StatusCode, truncateRunes(strings.TrimSpace(string(respBody)), 200))
+	}
+	return respBody, nil
+}
+
+// formatAlertText 纯文本告警内容
+func formatAlertText(alert Alert) string {
+	text := fmt.Sprintf("%s [%s] %s\n\n%s", alertEmoji(alert.Level), strings.ToUpper(string(alert.Level)), alert.Title, alert.Message)
+	if len(alert.Tags) > 0 {
+		text += "\n\n标签: " + strings.Join(alert.Tags, ", ")
+	}
+	return text + "\n时间: " + alert.Time.Format("2006-01-02 15:04:05")
+}
+
+// formatAlertMarkdown Markdown 告警内容（钉钉/企业微信）
+func formatAlertMarkdown(alert Alert) string {
+	text := fmt.Sprintf("### %s %s\n\n**级别**: %s\n\n%s", alertEmoji(alert.Level), alert.Title, alert.Level, alert.Message)
+	if len(alert.Tags) > 0 {
+		text += "\n\n**标签**: " + strings.Join(alert.Tags, ", ")
+	}
+	return text + "\n\n**时间**: " + alert.Time.Format("2006-01-02 15:04:05")
+}
+
+func alertEmoji(level AlertLevel) string {
+	switch level {
+	case AlertWarning:
+		return "⚠️"
+	case AlertCritical:
+		return "🚨"
+	default:
+		return "ℹ️"
+	}
+}
+
+func alertColorHex(level AlertLevel) string {
+	switch level {
+	case AlertWarning:
+		return "#F2C037"
+	case AlertCritical:
+		return "#D32F2F"
+	default:
+		return "#2196F3"
+	}
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max])
+}
@@ -0,0 +1,757 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gkipass/plane/internal/db/dao"
+	"gkipass/plane/internal/db/models"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// alertSampleRetention 内存中保留的样本时长，更长的窗口使用小时聚合历史（仅节点指标）
+	alertSampleRetention = time.Hour
+	// alertMaxSamples 每个序列最多保留的样本数
+	alertMaxSamples = 720
+	// alertPendingStaleAfter 待触发实例超过该时长没有新样本时重新计时，避免离线很久后一上报就触发
+	alertPendingStaleAfter = 5 * time.Minute
+	// defaultAlertGroupWait 同一规则、同一节点组的告警合并发送前的等待时间
+	defaultAlertGroupWait = 30 * time.Second
+	// alertSilenceCacheTTL 静默列表缓存时长
+	alertSilenceCacheTTL = 15 * time.Second
+)
+
+// 节点与隧道可用于告警的指标
+var (
+	nodeAlertMetrics = map[string]string{
+		"cpu":               "CPU 使用率(%)",
+		"memory":            "内存使用率(%)",
+		"disk":              "磁盘使用率(%)",
+		"load_1m":           "1 分钟负载",
+		"response_time":     "平均响应时间(ms)",
+		"connections":       "总连接数",
+		"bandwidth_in":      "入站带宽(bps)",
+		"bandwidth_out":     "出站带宽(bps)",
+		"connection_errors": "连接错误数",
+		"tunnel_errors":     "隧道错误数",
+	}
+	tunnelAlertMetrics = map[string]string{
+		"connections":     "活跃连接数",
+		"new_connections": "上报周期内新建连接数",
+		"traffic_in":      "上报周期内入站字节",
+		"traffic_out":     "上报周期内出站字节",
+		"response_time":   "平均响应时间(ms)",
+		"errors":          "错误数",
+	}
+)
+
+// ValidateAlertRule 校验告警规则的作用范围、指标、聚合方式和阈值配置
+func ValidateAlertRule(rule *models.NodeAlertRule) error {
+	if rule.Scope == "" {
+		rule.Scope = models.AlertScopeNode
+	}
+	if rule.Aggregation == "" {
+		rule.Aggregation = models.AlertAggLast
+	}
+
+	metrics := nodeAlertMetrics
+	switch rule.Scope {
+	case models.AlertScopeNode:
+		if rule.NodeID == "" {
+			return fmt.Errorf("node_id is required for node scope")
+		}
+	case models.AlertScopeGroup:
+		if rule.GroupID == "" {
+			return fmt.Errorf("group_id is required for group scope")
+		}
+	case models.AlertScopeTunnel:
+		metrics = tunnelAlertMetrics
+	default:
+		return fmt.Errorf("invalid scope, must be one of: node, group, tunnel")
+	}
+	if _, ok := metrics[rule.MetricType]; !ok {
+		names := make([]string, 0, len(metrics))
+		for name := range metrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("invalid metric_type for %s scope, must be one of: %s", rule.Scope, strings.Join(names, ", "))
+	}
+
+	switch rule.Operator {
+	case ">", "<", ">=", "<=", "=", "!=":
+	default:
+		return fmt.Errorf("invalid operator")
+	}
+	switch rule.Aggregation {
+	case models.AlertAggLast, models.AlertAggAvg, models.AlertAggMax, models.AlertAggMin, models.AlertAggP95:
+	default:
+		return fmt.Errorf("invalid aggregation, must be one of: last, avg, max, min, p95")
+	}
+	if rule.Aggregation != models.AlertAggLast && rule.WindowSeconds <= 0 {
+		return fmt.Errorf("window_seconds is required for %s aggregation", rule.Aggregation)
+	}
+	if rule.WindowSeconds < 0 || rule.DurationSeconds < 0 {
+		return fmt.Errorf("window_seconds and duration_seconds must be >= 0")
+	}
+	if rule.WindowSeconds > int(alertSampleRetention/time.Second) && rule.Scope == models.AlertScopeTunnel {
+		return fmt.Errorf("tunnel metrics support windows up to %d seconds", int(alertSampleRetention/time.Second))
+	}
+
+	/* 恢复阈值必须比触发阈值"更安全"，否则会在两者之间反复触发 */
+	if rule.ResolveThreshold != nil {
+		r, t := *rule.ResolveThreshold, rule.ThresholdValue
+		switch rule.Operator {
+		case ">", ">=":
+			if r > t {
+				return fmt.Errorf("resolve_threshold must be <= threshold_value for operator %s", rule.Operator)
+			}
+		case "<", "<=":
+			if r < t {
+				return fmt.Errorf("resolve_threshold must be >= threshold_value for operator %s", rule.Operator)
+			}
+		}
+	}
+	return nil
+}
+
+// NodeAlertMetricValues 从节点监控数据提取告警指标
+func NodeAlertMetricValues(data *models.NodeMonitoringData) map[string]float64 {
+	return map[string]float64{
+		"cpu":               data.CPUUsage,
+		"memory":            data.MemoryUsagePercent,
+		"disk":              data.DiskUsagePercent,
+		"load_1m":           data.CPULoad1m,
+		"response_time":     data.AvgResponseTime,
+		"connections":       float64(data.TotalConnections),
+		"bandwidth_in":      float64(data.BandwidthIn),
+		"bandwidth_out":     float64(data.BandwidthOut),
+		"connection_errors": float64(data.ConnectionErrors),
+		"tunnel_errors":     float64(data.TunnelErrors),
+	}
+}
+
+// alertSubject 告警对象：节点，或某节点上的隧道
+type alertSubject struct {
+	scope    string // node / tunnel
+	nodeID   string
+	tunnelID string
+}
+
+func (s alertSubject) key() string {
+	if s.scope == models.AlertScopeTunnel {
+		return "tunnel:" + s.tunnelID + "@" + s.nodeID
+	}
+	return "node:" + s.nodeID
+}
+
+type alertSample struct {
+	at    time.Time
+	value float64
+}
+
+// alertSeries 单个指标的样本序列（按时间递增）
+type alertSeries struct {
+	samples []alertSample
+}
+
+func (s *alertSeries) add(at time.Time, value float64) {
+	s.samples = append(s.samples, alertSample{at: at, value: value})
+
+	cutoff := at.Add(-alertSampleRetention)
+	drop := 0
+	for drop < len(s.samples) && s.samples[drop].at.Before(cutoff) {
+		drop++
+	}
+	if over := len(s.samples) - drop - alertMaxSamples; over > 0 {
+		drop += over
+	}
+	if drop > 0 {
+		s.samples = append(s.samples[:0], s.samples[drop:]...)
+	}
+}
+
+func (s *alertSeries) since(from time.Time) []float64 {
+	var values []float64
+	for _, sample := range s.samples {
+		if !sample.at.Before(from) {
+			values = append(values, sample.value)
+		}
+	}
+	return values
+}
+
+// 告警实例状态
+const (
+	alertStatePending = "pending" // 条件满足，等待持续时长
+	alertStateFiring  = "firing"  // 已触发，等待恢复
+)
+
+// alertInstance 规则在某个对象上的告警实例
+type alertInstance struct {
+	state     string
+	since     time.Time // 条件开始满足的时间
+	lastAt    time.Time // 最近一次评估时间
+	value     float64
+	historyID string
+	notified  bool // 触发时是否发送了通知，未通知的告警恢复时也不通知
+}
+
+// alertNotifyEvent 待合并发送的触发 / 恢复事件
+type alertNotifyEvent struct {
+	nodeID   string
+	text     string
+	resolved bool
+}
+
+// alertNotifyGroup 同一规则、同一节点组在等待期内的事件
+type alertNotifyGroup struct {
+	rule   *models.NodeAlertRule
+	events []alertNotifyEvent
+}
+
+// AlertEngine 告警规则引擎
+// 节点/隧道指标样本进入内存窗口，按规则聚合后驱动 pending -> firing -> resolved 状态机：
+// 条件需持续 DurationSeconds 才触发，回落过恢复阈值后自动恢复；同一规则、同一节点组的通知合并发送；
+// 静默期间照常记录告警但不通知，维护窗口内暂停评估
+type AlertEngine struct {
+	dao       *dao.DAO
+	groupWait time.Duration
+	notify    func(Alert)
+
+	mu         sync.Mutex
+	series     map[string]*alertSeries   // 对象 key + 指标 -> 样本
+	instances  map[string]*alertInstance // 指纹 -> 实例
+	restored   map[string]bool           // 已从告警历史恢复过的指纹
+	backfilled map[string]bool           // 已从监控数据回填样本的节点
+	groups     map[string]*alertNotifyGroup
+
+	silenceMu  sync.Mutex
+	silences   []*models.AlertSilence
+	silencesAt time.Time
+
+	logger *zap.Logger
+}
+
+var (
+	alertEngineInstance *AlertEngine
+	alertEngineOnce     sync.Once
+)
+
+// GetAlertEngine 获取告警规则引擎单例（节点可能经 HTTP 和 WebSocket 两条路径上报，须共享状态）
+func GetAlertEngine(d *dao.DAO) *AlertEngine {
+	alertEngineOnce.Do(func() {
+		alertEngineInstance = NewAlertEngine(d, NewAlertSystem(d))
+	})
+	return alertEngineInstance
+}
+
+// NewAlertEngine 创建告警规则引擎
+func NewAlertEngine(d *dao.DAO, alertSystem *AlertSystem) *AlertEngine {
+	e := &AlertEngine{
+		dao:        d,
+		groupWait:  defaultAlertGroupWait,
+		series:     make(map[string]*alertSeries),
+		instances:  make(map[string]*alertInstance),
+		restored:   make(map[string]bool),
+		backfilled: make(map[string]bool),
+		groups:     make(map[string]*alertNotifyGroup),
+		logger:     zap.L().Named("alert-engine"),
+	}
+	e.notify = func(alert Alert) {
+		go func() {
+			if err := alertSystem.Send(alert); err != nil {
+				e.logger.Error("发送告警通知失败", zap.String("title", alert.Title), zap.Error(err))
+			}
+		}()
+	}
+	return e
+}
+
+// ObserveNode 记录节点指标样本并评估节点规则和组规则
+func (e *AlertEngine) ObserveNode(nodeID string, metrics map[string]float64, at time.Time) {
+	e.observe(alertSubject{scope: models.AlertScopeNode, nodeID: nodeID}, metrics, at)
+}
+
+// ObserveTunnel 记录节点上某条隧道的指标样本并评估隧道规则
+func (e *AlertEngine) ObserveTunnel(nodeID, tunnelID string, metrics map[string]float64, at time.Time) {
+	e.observe(alertSubject{scope: models.AlertScopeTunnel, nodeID: nodeID, tunnelID: tunnelID}, metrics, at)
+}
+
+// NodeSilenced 节点当前是否处于不限规则的静默或维护窗口（用于节点离线等系统告警）
+func (e *AlertEngine) NodeSilenced(nodeID string, at time.Time) bool {
+	groupIDs, _ := e.dao.GetNodeGroupIDs(nodeID)
+	subject := alertSubject{scope: models.AlertScopeNode, nodeID: nodeID}
+	for _, silence := range e.activeSilences(at) {
+		if silence.RuleID == "" && silence.TunnelID == "" && silenceMatches(silence, "", subject, groupIDs, at) {
+			return true
+		}
+	}
+	return false
+}
+
+// InvalidateSilences 静默变更后丢弃缓存
+func (e *AlertEngine) InvalidateSilences() {
+	e.silenceMu.Lock()
+	e.silencesAt = time.Time{}
+	e.silenceMu.Unlock()
+}
+
+func (e *AlertEngine) observe(subject alertSubject, metrics map[string]float64, at time.Time) {
+	groupIDs, _ := e.dao.GetNodeGroupIDs(subject.nodeID)
+	sort.Strings(groupIDs)
+
+	var (
+		rules []*models.NodeAlertRule
+		err   error
+	)
+	if subject.scope == models.AlertScopeTunnel {
+		rules, err = e.dao.ListEnabledAlertRulesForTunnel(subject.nodeID, subject.tunnelID)
+	} else {
+		rules, err = e.dao.ListEnabledAlertRulesForNode(subject.nodeID, groupIDs)
+	}
+	if err != nil {
+		e.logger.Error("获取告警规则失败", zap.String("subject", subject.key()), zap.Error(err))
+		return
+	}
+	silences := e.activeSilences(at)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if subject.scope == models.AlertScopeNode {
+		e.backfillNode(subject, at)
+	}
+	for name, value := range metrics {
+		e.seriesFor(subject, name).add(at, value)
+	}
+
+	for _, rule := range rules {
+		if _, ok := metrics[rule.MetricType]; !ok {
+			continue
+		}
+		value, ok := e.evaluate(rule, subject, at)
+		if !ok {
+			continue
+		}
+		e.transition(rule, subject, groupIDs, value, silences, at)
+	}
+}
+
+func (e *AlertEngine) seriesFor(subject alertSubject, metric string) *alertSeries {
+	key := subject.key() + "/" + metric
+	series := e.series[key]
+	if series == nil {
+		series = &alertSeries{}
+		e.series[key] = series
+	}
+	return series
+}
+
+// backfillNode 面板重启后首次收到节点样本时，从监控数据回填最近一小时的样本
+func (e *AlertEngine) backfillNode(subject alertSubject, at time.Time) {
+	if e.backfilled[subject.nodeID] {
+		return
+	}
+	e.backfilled[subject.nodeID] = true
+
+	history, err := e.dao.ListNodeMonitoringData(subject.nodeID, at.Add(-alertSampleRetention), at, alertMaxSamples)
+	if err != nil {
+		return
+	}
+	for _, data := range history {
+		for name, value := range NodeAlertMetricValues(data) {
+			e.seriesFor(subject, name).add(data.Timestamp, value)
+		}
+	}
+}
+
+// evaluate 按规则的聚合方式计算窗口值
+func (e *AlertEngine) evaluate(rule *models.NodeAlertRule, subject alertSubject, at time.Time) (float64, bool) {
+	series := e.seriesFor(subject, rule.MetricType)
+	if len(series.samples) == 0 {
+		return 0, false
+	}
+
+	window := time.Duration(rule.WindowSeconds) * time.Second
+	if rule.Aggregation == "" || rule.Aggregation == models.AlertAggLast || window <= 0 {
+		return series.samples[len(series.samples)-1].value, true
+	}
+	if window > alertSampleRetention && subject.scope == models.AlertScopeNode {
+		return e.evaluateHistory(rule, subject.nodeID, at.Add(-window), at)
+	}
+	return aggregateAlertValues(series.since(at.Add(-window)), rule.Aggregation)
+}
+
+// evaluateHistory 长窗口使用小时聚合历史：max 取各小时最大值，其余取各小时平均值
+func (e *AlertEngine) evaluateHistory(rule *models.NodeAlertRule, nodeID string, from, to time.Time) (float64, bool) {
+	history, err := e.dao.ListNodeHourlyHistory(nodeID, from, to)
+	if err != nil {
+		e.logger.Error("查询性能历史失败", zap.String("node_id", nodeID), zap.Error(err))
+		return 0, false
+	}
+
+	values := make([]float64, 0, len(history))
+	for _, h := range history {
+		if value, ok := historyAlertValue(h, rule.MetricType, rule.Aggregation == models.AlertAggMax); ok {
+			values = append(values, value)
+		}
+	}
+	return aggregateAlertValues(values, rule.Aggregation)
+}
+
+func historyAlertValue(h *models.NodePerformanceHistory, metric string, useMax bool) (float64, bool) {
+	switch metric {
+	case "cpu":
+		if useMax {
+			return h.MaxCPUUsage, true
+		}
+		return h.AvgCPUUsage, true
+	case "memory":
+		if useMax {
+			return h.MaxMemoryUsage, true
+		}
+		return h.AvgMemoryUsage, true
+	case "disk":
+		return h.AvgDiskUsage, true
+	case "connections":
+		if useMax {
+			return float64(h.MaxConnections), true
+		}
+		return float64(h.AvgConnections), true
+	case "response_time":
+		if useMax {
+			return h.MaxResponseTime, true
+		}
+		return h.AvgResponseTime, true
+	case "bandwidth_in":
+		return float64(h.AvgBandwidthIn), true
+	case "bandwidth_out":
+		return float64(h.AvgBandwidthOut), true
+	default:
+		return 0, false
+	}
+}
+
+// aggregateAlertValues 聚合窗口内的样本，p95 使用最近秩法
+func aggregateAlertValues(values []float64, aggregation string) (float64, bool) {
+	if len(values) == 0 {
+		return 0, false
+	}
+
+	switch aggregation {
+	case models.AlertAggAvg:
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values)), true
+	case models.AlertAggMax:
+		result := values[0]
+		for _, v := range values[1:] {
+			result = math.Max(result, v)
+		}
+		return result, true
+	case models.AlertAggMin:
+		result := values[0]
+		for _, v := range values[1:] {
+			result = math.Min(result, v)
+		}
+		return result, true
+	case models.AlertAggP95:
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		return sorted[int(math.Ceil(0.95*float64(len(sorted))))-1], true
+	default:
+		return values[len(values)-1], true
+	}
+}
+
+func compareAlertValue(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case "<":
+		return value < threshold
+	case ">=":
+		return value >= threshold
+	case "<=":
+		return value <= threshold
+	case "=":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	default:
+		return false
+	}
+}
+
+// transition 推进告警实例状态机
+func (e *AlertEngine) transition(rule *models.NodeAlertRule, subject alertSubject, groupIDs []string,
+	value float64, silences []*models.AlertSilence, at time.Time) {
+	fingerprint := rule.ID + "/" + subject.key()
+
+	inst := e.instances[fingerprint]
+	if inst == nil && !e.restored[fingerprint] {
+		/* 面板重启后接管未恢复的告警，使其仍能自动恢复 */
+		e.restored[fingerprint] = true
+		if open, _ := e.dao.GetOpenNodeAlertByFingerprint(fingerprint); open != nil {
+			inst = &alertInstance{
+				state:     alertStateFiring,
+				since:     open.TriggeredAt,
+				historyID: open.ID,
+				notified:  !open.Silenced,
+			}
+			e.instances[fingerprint] = inst
+		}
+	}
+
+	if inst != nil && inst.state == alertStateFiring {
+		resolveAt := rule.ThresholdValue
+		if rule.ResolveThreshold != nil {
+			resolveAt = *rule.ResolveThreshold
+		}
+		inst.lastAt = at
+		inst.value = value
+		if compareAlertValue(value, rule.Operator, resolveAt) {
+			return
+		}
+		delete(e.instances, fingerprint)
+		e.resolve(rule, subject, groupIDs, inst, silences, at)
+		return
+	}
+
+	if matchSilences(silences, models.AlertSilenceKindMaintenance, rule, subject, groupIDs, at) ||
+		!compareAlertValue(value, rule.Operator, rule.ThresholdValue) {
+		delete(e.instances, fingerprint)
+		return
+	}
+
+	if inst == nil || at.Sub(inst.lastAt) > alertPendingStaleAfter {
+		inst = &alertInstance{state: alertStatePending, since: at}
+		e.instances[fingerprint] = inst
+	}
+	inst.lastAt = at
+	inst.value = value
+
+	if at.Sub(inst.since) < time.Duration(rule.DurationSeconds)*time.Second {
+		return
+	}
+	e.fire(rule, subject, groupIDs, fingerprint, inst, silences, at)
+}
+
+// fire 记录告警并（非静默时）加入通知分组
+func (e *AlertEngine) fire(rule *models.NodeAlertRule, subject alertSubject, groupIDs []string,
+	fingerprint string, inst *alertInstance, silences []*models.AlertSilence, at time.Time) {
+	silenced := matchSilences(silences, "", rule, subject, groupIDs, at)
+	text := e.describe(rule, subject, inst.value)
+
+	history := &models.NodeAlertHistory{
+		RuleID:         rule.ID,
+		NodeID:         subject.nodeID,
+		TunnelID:       subject.tunnelID,
+		AlertType:      rule.MetricType,
+		Severity:       rule.Severity,
+		Message:        truncateRunes(text, 500),
+		MetricValue:    inst.value,
+		ThresholdValue: rule.ThresholdValue,
+		Status:         "triggered",
+		TriggeredAt:    at,
+		Fingerprint:    fingerprint,
+		Silenced:       silenced,
+	}
+	if err := e.dao.CreateNodeAlertHistory(history); err != nil {
+		/* 保持 pending，下次评估重试 */
+		e.logger.Error("创建告警记录失败", zap.Error(err))
+		return
+	}
+
+	inst.state = alertStateFiring
+	inst.historyID = history.ID
+	inst.notified = !silenced
+	if !silenced {
+		e.enqueue(rule, subject, groupIDs, alertNotifyEvent{nodeID: subject.nodeID, text: text})
+	}
+
+	e.logger.Warn("告警触发",
+		zap.String("rule", rule.RuleName),
+		zap.String("subject", subject.key()),
+		zap.Float64("value", inst.value),
+		zap.Float64("threshold", rule.ThresholdValue),
+		zap.Bool("silenced", silenced))
+}
+
+// resolve 标记告警恢复，触发时通知过且当前未静默则发送恢复通知
+func (e *AlertEngine) resolve(rule *models.NodeAlertRule, subject alertSubject, groupIDs []string,
+	inst *alertInstance, silences []*models.AlertSilence, at time.Time) {
+	if err := e.dao.UpdateNodeAlertHistoryStatus(inst.historyID, "resolved", ""); err != nil {
+		e.logger.Error("更新告警状态失败", zap.String("alert_id", inst.historyID), zap.Error(err))
+	}
+
+	if inst.notified && !matchSilences(silences, "", rule, subject, groupIDs, at) {
+		text := fmt.Sprintf("%s（持续 %s）", e.describe(rule, subject, inst.value), at.Sub(inst.since).Round(time.Second))
+		e.enqueue(rule, subject, groupIDs, alertNotifyEvent{nodeID: subject.nodeID, text: text, resolved: true})
+	}
+
+	e.logger.Info("告警恢复",
+		zap.String("rule", rule.RuleName),
+		zap.String("subject", subject.key()),
+		zap.Float64("value", inst.value))
+}
+
+// describe 生成告警描述，如 "hk-1 cpu(avg 5m0s) = 93.20 > 90.00"
+func (e *AlertEngine) describe(rule *models.NodeAlertRule, subject alertSubject, value float64) string {
+	name := subject.nodeID
+	if node, _ := e.dao.GetNode(subject.nodeID); node != nil && node.Name != "" {
+		name = node.Name
+	}
+	if subject.scope == models.AlertScopeTunnel {
+		name = fmt.Sprintf("隧道 %s @ %s", subject.tunnelID, name)
+	}
+
+	metric := rule.MetricType
+	if rule.Aggregation != "" && rule.Aggregation != models.AlertAggLast && rule.WindowSeconds > 0 {
+		metric = fmt.Sprintf("%s(%s %s)", metric, rule.Aggregation, time.Duration(rule.WindowSeconds)*time.Second)
+	}
+	return fmt.Sprintf("%s %s = %.2f %s %.2f", name, metric, value, rule.Operator, rule.ThresholdValue)
+}
+
+// enqueue 按规则和节点组合并通知，等待 groupWait 后一并发送
+func (e *AlertEngine) enqueue(rule *models.NodeAlertRule, subject alertSubject, groupIDs []string, event alertNotifyEvent) {
+	groupKey := "node:" + subject.nodeID
+	if len(groupIDs) > 0 {
+		groupKey = "group:" + groupIDs[0]
+	}
+	key := rule.ID + "/" + groupKey
+
+	if e.groupWait <= 0 {
+		e.dispatch(&alertNotifyGroup{rule: rule, events: []alertNotifyEvent{event}})
+		return
+	}
+
+	group := e.groups[key]
+	if group == nil {
+		group = &alertNotifyGroup{rule: rule}
+		e.groups[key] = group
+		time.AfterFunc(e.groupWait, func() {
+			e.mu.Lock()
+			delete(e.groups, key)
+			e.mu.Unlock()
+			e.dispatch(group)
+		})
+	}
+	group.events = append(group.events, event)
+}
+
+// dispatch 将一组事件合并为触发通知和恢复通知
+func (e *AlertEngine) dispatch(group *alertNotifyGroup) {
+	var firing, resolved []alertNotifyEvent
+	for _, event := range group.events {
+		if event.resolved {
+			resolved = append(resolved, event)
+		} else {
+			firing = append(firing, event)
+		}
+	}
+
+	rule := group.rule
+	level := AlertInfo
+	switch rule.Severity {
+	case "warning":
+		level = AlertWarning
+	case "critical":
+		level = AlertCritical
+	}
+
+	if len(firing) > 0 {
+		e.notify(e.buildGroupAlert(rule, level, "告警", firing))
+	}
+	if len(resolved) > 0 {
+		e.notify(e.buildGroupAlert(rule, AlertInfo, "已恢复", resolved))
+	}
+}
+
+func (e *AlertEngine) buildGroupAlert(rule *models.NodeAlertRule, level AlertLevel, status string, events []alertNotifyEvent) Alert {
+	title := fmt.Sprintf("[%s] %s", status, rule.RuleName)
+	lines := make([]string, 0, len(events))
+	for _, event := range events {
+		lines = append(lines, event.text)
+	}
+
+	alert := Alert{
+		Level:    level,
+		Title:    title,
+		Message:  strings.Join(lines, "\n"),
+		Tags:     []string{"alert", rule.Scope, rule.MetricType},
+		RuleID:   rule.ID,
+		Channels: SplitAlertChannelIDs(rule.NotificationChannels),
+	}
+	if len(events) == 1 {
+		alert.NodeID = events[0].nodeID
+	} else {
+		alert.Title = fmt.Sprintf("%s（%d 个对象）", title, len(events))
+	}
+	return alert
+}
+
+// activeSilences 获取未结束的静默（带缓存）
+func (e *AlertEngine) activeSilences(at time.Time) []*models.AlertSilence {
+	e.silenceMu.Lock()
+	defer e.silenceMu.Unlock()
+
+	if !e.silencesAt.IsZero() && time.Since(e.silencesAt) < alertSilenceCacheTTL {
+		return e.silences
+	}
+	silences, err := e.dao.ListAlertSilences(at)
+	if err != nil {
+		e.logger.Error("加载告警静默失败", zap.Error(err))
+		return e.silences
+	}
+	e.silences = silences
+	e.silencesAt = time.Now()
+	return silences
+}
+
+// matchSilences 是否有生效中的静默匹配该告警，kind 为空时匹配任意类型
+func matchSilences(silences []*models.AlertSilence, kind string, rule *models.NodeAlertRule,
+	subject alertSubject, groupIDs []string, at time.Time) bool {
+	for _, silence := range silences {
+		if silence.RuleID != "" && silence.RuleID != rule.ID {
+			continue
+		}
+		if silenceMatches(silence, kind, subject, groupIDs, at) {
+			return true
+		}
+	}
+	return false
+}
+
+func silenceMatches(silence *models.AlertSilence, kind string, subject alertSubject, groupIDs []string, at time.Time) bool {
+	if kind != "" && silence.Kind != kind {
+		return false
+	}
+	if at.Before(silence.StartsAt) || !at.Before(silence.EndsAt) {
+		return false
+	}
+	if silence.NodeID != "" && silence.NodeID != subject.nodeID {
+		return false
+	}
+	if silence.TunnelID != "" && silence.TunnelID != subject.tunnelID {
+		return false
+	}
+	if silence.GroupID != "" {
+		for _, id := range groupIDs {
+			if id == silence.GroupID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gkipass/plane/internal/db/dao"
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/*
+setupAlertEngineTest 创建规则引擎测试专用的内存数据库，通知由 notified 收集
+*/
+func setupAlertEngineTest(t *testing.T) (*dao.DAO, *AlertEngine, func() []Alert) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+
+	err = db.AutoMigrate(
+		&models.Node{}, &models.NodeGroup{},
+		&models.NodeAlertRule{}, &models.NodeAlertHistory{}, &models.AlertSilence{},
+		&models.NodeMonitoringData{}, &models.NodePerformanceHistory{},
+	)
+	if err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+
+	d := dao.New(db)
+	engine := NewAlertEngine(d, NewAlertSystem(nil))
+	engine.groupWait = 0
+
+	var mu sync.Mutex
+	var alerts []Alert
+	engine.notify = func(alert Alert) {
+		mu.Lock()
+		alerts = append(alerts, alert)
+		mu.Unlock()
+	}
+	return d, engine, func() []Alert {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Alert(nil), alerts...)
+	}
+}
+
+func createAlertTestNode(t *testing.T, d *dao.DAO, id string, groups ...*models.NodeGroup) {
+	t.Helper()
+	node := &models.Node{Name: id}
+	node.ID = id
+	if err := d.DB.Create(node).Error; err != nil {
+		t.Fatalf("创建节点失败: %v", err)
+	}
+	for _, group := range groups {
+		d.DB.Model(node).Association("Groups").Append(group)
+	}
+}
+
+/*
+TestAlertEngine_ForDurationAndHysteresis 测试持续时长和滞回恢复
+*/
+func TestAlertEngine_ForDurationAndHysteresis(t *testing.T) {
+	d, engine, notified := setupAlertEngineTest(t)
+	createAlertTestNode(t, d, "node-1")
+
+	resolveAt := 80.0
+	rule := &models.NodeAlertRule{
+		Scope: models.AlertScopeNode, NodeID: "node-1", RuleName: "CPU 过高",
+		MetricType: "cpu", Operator: ">", ThresholdValue: 90, ResolveThreshold: &resolveAt,
+		DurationSeconds: 120, Severity: "critical", Enabled: true,
+	}
+	d.CreateNodeAlertRule(rule)
+
+	t0 := time.Now()
+	observe := func(offset time.Duration, cpu float64) {
+		engine.ObserveNode("node-1", map[string]float64{"cpu": cpu}, t0.Add(offset))
+	}
+
+	/* 单个尖峰后回落，不应触发 */
+	observe(0, 95)
+	observe(time.Minute, 50)
+	/* 持续 120 秒后才触发 */
+	observe(2*time.Minute, 95)
+	observe(3*time.Minute, 95)
+	if n := len(notified()); n != 0 {
+		t.Fatalf("未满持续时长不应触发，实际通知 %d 次", n)
+	}
+	observe(4*time.Minute, 95)
+
+	alerts := notified()
+	if len(alerts) != 1 || alerts[0].Level != AlertCritical || !strings.Contains(alerts[0].Title, "告警") {
+		t.Fatalf("持续满足后应触发 1 次 critical 告警，实际 %+v", alerts)
+	}
+	history, _ := d.ListNodeAlertHistory("node-1", 10)
+	if len(history) != 1 || history[0].Status != "triggered" {
+		t.Fatalf("应记录 1 条触发中的告警，实际 %+v", history)
+	}
+
+	/* 低于触发阈值但高于恢复阈值，保持触发 */
+	observe(5*time.Minute, 85)
+	if n := len(notified()); n != 1 {
+		t.Errorf("滞回区间内不应恢复，实际通知 %d 次", n)
+	}
+
+	observe(6*time.Minute, 79)
+	alerts = notified()
+	if len(alerts) != 2 || !strings.Contains(alerts[1].Title, "已恢复") {
+		t.Fatalf("低于恢复阈值应发送恢复通知，实际 %+v", alerts)
+	}
+	history, _ = d.ListNodeAlertHistory("node-1", 10)
+	if history[0].Status != "resolved" || history[0].ResolvedAt == nil {
+		t.Errorf("告警应标记为已恢复，实际 %+v", history[0])
+	}
+}
+
+/*
+TestAlertEngine_Silences 测试静默只屏蔽通知、维护窗口暂停评估
+*/
+func TestAlertEngine_Silences(t *testing.T) {
+	d, engine, notified := setupAlertEngineTest(t)
+	createAlertTestNode(t, d, "node-1")
+	createAlertTestNode(t, d, "node-2")
+
+	rule1 := &models.NodeAlertRule{Scope: models.AlertScopeNode, NodeID: "node-1", RuleName: "内存",
+		MetricType: "memory", Operator: ">=", ThresholdValue: 90, Severity: "warning", Enabled: true}
+	rule2 := &models.NodeAlertRule{Scope: models.AlertScopeNode, NodeID: "node-2", RuleName: "内存",
+		MetricType: "memory", Operator: ">=", ThresholdValue: 90, Severity: "warning", Enabled: true}
+	d.CreateNodeAlertRule(rule1)
+	d.CreateNodeAlertRule(rule2)
+
+	now := time.Now()
+	d.CreateAlertSilence(&models.AlertSilence{Kind: models.AlertSilenceKindSilence, NodeID: "node-1",
+		StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)})
+	d.CreateAlertSilence(&models.AlertSilence{Kind: models.AlertSilenceKindMaintenance, RuleID: rule2.ID,
+		StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)})
+
+	engine.ObserveNode("node-1", map[string]float64{"memory": 95}, now)
+	engine.ObserveNode("node-2", map[string]float64{"memory": 95}, now)
+
+	if n := len(notified()); n != 0 {
+		t.Errorf("静默和维护窗口内不应发送通知，实际 %d 次", n)
+	}
+	history, _ := d.ListNodeAlertHistory("node-1", 10)
+	if len(history) != 1 || !history[0].Silenced {
+		t.Errorf("静默期间应照常记录告警并标记 silenced，实际 %+v", history)
+	}
+	history, _ = d.ListNodeAlertHistory("node-2", 10)
+	if len(history) != 0 {
+		t.Errorf("维护窗口内不应产生告警，实际 %+v", history)
+	}
+
+	if !engine.NodeSilenced("node-1", now) || engine.NodeSilenced("node-2", now) {
+		t.Error("只有不限规则的静默才应屏蔽节点级系统告警")
+	}
+}
+
+/*
+TestAlertEngine_GroupRuleAndTunnel 测试组规则按节点组合并通知、隧道规则匹配所有隧道
+*/
+func TestAlertEngine_GroupRuleAndTunnel(t *testing.T) {
+	d, engine, notified := setupAlertEngineTest(t)
+	engine.groupWait = 50 * time.Millisecond
+
+	group := &models.NodeGroup{Name: "hk"}
+	group.ID = "group-hk"
+	d.DB.Create(group)
+	createAlertTestNode(t, d, "node-1", group)
+	createAlertTestNode(t, d, "node-2", group)
+
+	d.CreateNodeAlertRule(&models.NodeAlertRule{Scope: models.AlertScopeGroup, GroupID: group.ID, RuleName: "磁盘",
+		MetricType: "disk", Operator: ">", ThresholdValue: 90, Aggregation: models.AlertAggAvg, WindowSeconds: 300,
+		Severity: "warning", Enabled: true})
+	d.CreateNodeAlertRule(&models.NodeAlertRule{Scope: models.AlertScopeTunnel, RuleName: "隧道连接数",
+		MetricType: "connections", Operator: ">", ThresholdValue: 100, Severity: "info", Enabled: true})
+
+	now := time.Now()
+	engine.ObserveNode("node-1", map[string]float64{"disk": 85}, now.Add(-time.Minute))
+	engine.ObserveNode("node-1", map[string]float64{"disk": 99}, now)
+	engine.ObserveNode("node-2", map[string]float64{"disk": 95}, now)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(notified()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	alerts := notified()
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Title, "2 个对象") {
+		t.Fatalf("同组两个节点的告警应合并为 1 条通知，实际 %+v", alerts)
+	}
+
+	engine.groupWait = 0
+	engine.ObserveTunnel("node-1", "tunnel-1", map[string]float64{"connections": 150}, now)
+	alerts = notified()
+	if len(alerts) != 2 || alerts[1].Level != AlertInfo || !strings.Contains(alerts[1].Message, "tunnel-1") {
+		t.Errorf("隧道规则应对任意隧道生效，实际 %+v", alerts)
+	}
+}
+
+/*
+TestAggregateAlertValues 测试窗口聚合
+*/
+func TestAggregateAlertValues(t *testing.T) {
+	values := make([]float64, 0, 100)
+	for i := 1; i <= 100; i++ {
+		values = append(values, float64(i))
+	}
+
+	cases := map[string]float64{
+		models.AlertAggAvg:  50.5,
+		models.AlertAggMax:  100,
+		models.AlertAggMin:  1,
+		models.AlertAggP95:  95,
+		models.AlertAggLast: 100,
+	}
+	for agg, want := range cases {
+		if got, ok := aggregateAlertValues(values, agg); !ok || got != want {
+			t.Errorf("%s 聚合期望 %.2f，实际 %.2f", agg, want, got)
+		}
+	}
+
+	if _, ok := aggregateAlertValues(nil, models.AlertAggAvg); ok {
+		t.Error("空窗口不应返回有效值")
+	}
+}
@@ -1,12 +1,18 @@
 package service
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"math"
+	"strings"
 	"sync"
 	"time"
+
+	"gkipass/plane/internal/db/dao"
+	"gkipass/plane/internal/db/models"
+
+	"go.uber.org/zap"
 )
 
 // AlertLevel 告警级别
@@ -18,20 +24,39 @@ const (
 	AlertCritical AlertLevel = "critical"
 )
 
+const (
+	// alertSendTimeout 单次投递超时
+	alertSendTimeout = 15 * time.Second
+	// defaultAlertRetryBackoff 首次重试前的等待时间，之后每次翻倍
+	defaultAlertRetryBackoff = 2 * time.Second
+	// maxAlertRetryBackoff 重试等待上限
+	maxAlertRetryBackoff = 30 * time.Second
+	// builtinAlertRetries 内置通道（SetWebhook/SetTelegram/SetEmail）的重试次数
+	builtinAlertRetries = 2
+)
+
 // Alert 告警
 type Alert struct {
-	Level   AlertLevel
-	Title   string
-	Message string
-	Tags    []string
+	Level    AlertLevel
+	Title    string
+	Message  string
+	Tags     []string
+	RuleID   string    // 触发的告警规则，系统告警为空
+	NodeID   string    // 相关节点
+	Channels []string  // 指定的告警通道 ID，为空时发送到默认通道
+	Time     time.Time // 为空时取发送时间
 }
 
 // AlertSystem 告警系统
+// 告警按规则指定的通道（或默认通道）并发投递；每个通道独立限流、失败按指数退避重试，结果写入投递记录
 type AlertSystem struct {
+	dao            *dao.DAO
 	emailConfig    *EmailConfig
 	webhookURL     string
 	telegramConfig *TelegramConfig
+	retryBackoff   time.Duration
 	mu             sync.RWMutex
+	logger         *zap.Logger
 }
 
 type EmailConfig struct {
@@ -39,6 +64,7 @@ type EmailConfig struct {
 	SMTPPort int
 	Username string
 	Password string
+	From     string // 为空时使用 Username
 	To       []string
 }
 
@@ -47,9 +73,22 @@ type TelegramConfig struct {
 	ChatID   string
 }
 
-// NewAlertSystem 创建告警系统
-func NewAlertSystem() *AlertSystem {
-	return &AlertSystem{}
+// alertTarget 一次投递的目标通道
+type alertTarget struct {
+	id         string // 内置通道为空
+	typ        string
+	notifier   AlertNotifier
+	rateLimit  int
+	maxRetries int
+}
+
+// NewAlertSystem 创建告警系统，d 为 nil 时只发送到 SetWebhook/SetTelegram/SetEmail 配置的内置通道且不记录投递
+func NewAlertSystem(d *dao.DAO) *AlertSystem {
+	return &AlertSystem{
+		dao:          d,
+		retryBackoff: defaultAlertRetryBackoff,
+		logger:       zap.L().Named("alert"),
+	}
 }
 
 // SetWebhook 设置Webhook URL
@@ -66,83 +105,245 @@ func (as *AlertSystem) SetTelegram(config *TelegramConfig) {
 	as.telegramConfig = config
 }
 
-// Send 发送告警
+// SetEmail 设置邮件配置
+func (as *AlertSystem) SetEmail(config *EmailConfig) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.emailConfig = config
+}
+
+// Send 发送告警，阻塞到所有通道投递（含重试）结束；被限流的通道不计为失败
 func (as *AlertSystem) Send(alert Alert) error {
+	if alert.Time.IsZero() {
+		alert.Time = time.Now()
+	}
+
+	targets := append(as.builtinTargets(), as.channelTargets(alert.Channels)...)
+	if len(targets) == 0 {
+		as.logger.Debug("没有可用的告警通道，告警未发送", zap.String("title", alert.Title))
+		return nil
+	}
+
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target alertTarget) {
+			defer wg.Done()
+			if err := as.deliver(target, alert); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", target.typ, err)
+			}
+		}(i, target)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// SendToChannel 向单个通道发送告警（用于测试通道配置），不限流、不重试
+func (as *AlertSystem) SendToChannel(channel *models.AlertChannel, alert Alert) error {
+	notifier, err := NewAlertNotifier(channel)
+	if err != nil {
+		return err
+	}
+	if alert.Time.IsZero() {
+		alert.Time = time.Now()
+	}
+	return as.deliver(alertTarget{id: channel.ID, typ: channel.Type, notifier: notifier}, alert)
+}
+
+// builtinTargets 通过 SetWebhook/SetTelegram/SetEmail 配置的内置通道
+func (as *AlertSystem) builtinTargets() []alertTarget {
 	as.mu.RLock()
 	defer as.mu.RUnlock()
 
-	var errs []error
-
-	// Send to Webhook
+	var targets []alertTarget
 	if as.webhookURL != "" {
-		if err := as.sendWebhook(alert); err != nil {
-			errs = append(errs, fmt.Errorf("webhook: %w", err))
-		}
+		targets = append(targets, alertTarget{
+			typ:        models.AlertChannelWebhook,
+			notifier:   &webhookNotifier{url: as.webhookURL, method: "POST", contentType: "application/json"},
+			maxRetries: builtinAlertRetries,
+		})
 	}
-
-	// Send to Telegram
 	if as.telegramConfig != nil {
-		if err := as.sendTelegram(alert); err != nil {
-			errs = append(errs, fmt.Errorf("telegram: %w", err))
-		}
+		targets = append(targets, alertTarget{
+			typ:        models.AlertChannelTelegram,
+			notifier:   &telegramNotifier{config: as.telegramConfig},
+			maxRetries: builtinAlertRetries,
+		})
+	}
+	if as.emailConfig != nil {
+		targets = append(targets, alertTarget{
+			typ:        models.AlertChannelEmail,
+			notifier:   &emailNotifier{config: as.emailConfig},
+			maxRetries: builtinAlertRetries,
+		})
+	}
+	return targets
+}
+
+// channelTargets 加载指定的告警通道，未指定时加载默认通道；配置无效的通道被跳过
+func (as *AlertSystem) channelTargets(ids []string) []alertTarget {
+	if as.dao == nil {
+		return nil
 	}
 
-	if len(errs) > 0 {
-		return fmt.Errorf("alert errors: %v", errs)
+	var (
+		channels []*models.AlertChannel
+		err      error
+	)
+	if len(ids) > 0 {
+		channels, err = as.dao.GetAlertChannelsByIDs(ids)
+	} else {
+		channels, err = as.dao.ListDefaultAlertChannels()
+	}
+	if err != nil {
+		as.logger.Error("加载告警通道失败", zap.Error(err))
+		return nil
 	}
 
-	return nil
+	targets := make([]alertTarget, 0, len(channels))
+	for _, ch := range channels {
+		notifier, err := NewAlertNotifier(ch)
+		if err != nil {
+			as.logger.Warn("告警通道配置无效，跳过",
+				zap.String("channel_id", ch.ID),
+				zap.String("type", ch.Type),
+				zap.Error(err))
+			continue
+		}
+		targets = append(targets, alertTarget{
+			id:         ch.ID,
+			typ:        ch.Type,
+			notifier:   notifier,
+			rateLimit:  ch.RateLimit,
+			maxRetries: ch.MaxRetries,
+		})
+	}
+	return targets
 }
 
-func (as *AlertSystem) sendWebhook(alert Alert) error {
-	data, err := json.Marshal(map[string]interface{}{
-		"level":   alert.Level,
-		"title":   alert.Title,
-		"message": alert.Message,
-		"tags":    alert.Tags,
-	})
-	if err != nil {
-		return err
+// deliver 限流检查后投递，失败按指数退避重试，并记录投递结果
+func (as *AlertSystem) deliver(target alertTarget, alert Alert) error {
+	start := time.Now()
+	delivery := &models.AlertDelivery{
+		ChannelID:   target.id,
+		ChannelType: target.typ,
+		RuleID:      alert.RuleID,
+		NodeID:      alert.NodeID,
+		Level:       string(alert.Level),
+		Title:       truncateRunes(alert.Title, 256),
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post(as.webhookURL, "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		return err
+	if target.id != "" && !alertLimiters.allow(target.id, target.rateLimit, start) {
+		delivery.Status = models.AlertDeliveryRateLimited
+		as.logger.Warn("告警通道触发限流，丢弃本次通知",
+			zap.String("channel_id", target.id),
+			zap.Int("rate_limit", target.rateLimit),
+			zap.String("title", alert.Title))
+		as.recordDelivery(delivery)
+		return nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	var err error
+	backoff := as.retryBackoff
+	for attempt := 0; attempt <= target.maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff = time.Duration(math.Min(float64(backoff*2), float64(maxAlertRetryBackoff)))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), alertSendTimeout)
+		err = target.notifier.Notify(ctx, alert)
+		cancel()
+		delivery.Attempts = attempt + 1
+		if err == nil {
+			break
+		}
+		as.logger.Debug("告警投递失败",
+			zap.String("channel_id", target.id),
+			zap.String("type", target.typ),
+			zap.Int("attempt", attempt+1),
+			zap.Error(err))
 	}
 
-	return nil
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		delivery.Status = models.AlertDeliveryFailed
+		delivery.Error = truncateRunes(err.Error(), 500)
+	} else {
+		delivery.Status = models.AlertDeliverySent
+	}
+	as.recordDelivery(delivery)
+	return err
 }
 
-func (as *AlertSystem) sendTelegram(alert Alert) error {
-	emoji := "ℹ️"
-	switch alert.Level {
-	case AlertWarning:
-		emoji = "⚠️"
-	case AlertCritical:
-		emoji = "🚨"
+func (as *AlertSystem) recordDelivery(delivery *models.AlertDelivery) {
+	if as.dao == nil {
+		return
+	}
+	if err := as.dao.CreateAlertDelivery(delivery); err != nil {
+		as.logger.Error("写入告警投递记录失败", zap.Error(err))
 	}
+}
 
-	text := fmt.Sprintf("%s *%s*\n\n%s", emoji, alert.Title, alert.Message)
+// SplitAlertChannelIDs 解析告警规则中逗号分隔的通道 ID
+func SplitAlertChannelIDs(channels string) []string {
+	var ids []string
+	for _, id := range strings.Split(channels, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", as.telegramConfig.BotToken)
-	data, _ := json.Marshal(map[string]interface{}{
-		"chat_id":    as.telegramConfig.ChatID,
-		"text":       text,
-		"parse_mode": "Markdown",
-	})
+// ==================== 通道限流 ====================
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		return err
+// alertLimiters 全局共享，同一通道在多个 AlertSystem 实例间共用配额
+var alertLimiters = &alertLimiterRegistry{limiters: make(map[string]*alertRateLimiter)}
+
+type alertLimiterRegistry struct {
+	mu       sync.Mutex
+	limiters map[string]*alertRateLimiter
+}
+
+// allow 检查通道是否还有配额，perMinute <= 0 表示不限流；配额变更时重新计数
+func (r *alertLimiterRegistry) allow(channelID string, perMinute int, now time.Time) bool {
+	if perMinute <= 0 {
+		return true
+	}
+
+	r.mu.Lock()
+	limiter, ok := r.limiters[channelID]
+	if !ok || limiter.perMinute != perMinute {
+		limiter = &alertRateLimiter{perMinute: perMinute, tokens: float64(perMinute), last: now}
+		r.limiters[channelID] = limiter
 	}
-	defer resp.Body.Close()
+	r.mu.Unlock()
+
+	return limiter.allow(now)
+}
+
+// alertRateLimiter 令牌桶：容量为每分钟配额，按配额匀速补充
+type alertRateLimiter struct {
+	mu        sync.Mutex
+	perMinute int
+	tokens    float64
+	last      time.Time
+}
+
+func (l *alertRateLimiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	return nil
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = math.Min(float64(l.perMinute), l.tokens+elapsed.Minutes()*float64(l.perMinute))
+		l.last = now
+	}
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
 }
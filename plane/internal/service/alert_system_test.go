@@ -0,0 +1,169 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gkipass/plane/internal/db/dao"
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/*
+setupAlertTestDAO 创建告警通道测试专用的内存数据库
+*/
+func setupAlertTestDAO(t *testing.T) *dao.DAO {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+
+	if err := db.AutoMigrate(&models.AlertChannel{}, &models.AlertDelivery{}); err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+	return dao.New(db)
+}
+
+/*
+TestAlertSystem_WebhookTemplateAndSignature 测试通用 Webhook 的模板渲染和 HMAC 签名
+*/
+func TestAlertSystem_WebhookTemplateAndSignature(t *testing.T) {
+	var body []byte
+	var timestamp, signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		timestamp = r.Header.Get(WebhookTimestampHeader)
+		signature = r.Header.Get(WebhookSignatureHeader)
+	}))
+	defer server.Close()
+
+	d := setupAlertTestDAO(t)
+	channel := &models.AlertChannel{
+		Name:      "ops",
+		Type:      models.AlertChannelWebhook,
+		Enabled:   true,
+		RateLimit: 10,
+		Config: `{"url":"` + server.URL + `","secret":"s3cret",` +
+			`"body_template":"{\"text\":{{json .Title}},\"level\":\"{{upper (print .Level)}}\",\"tags\":\"{{join .Tags \",\"}}\"}"}`,
+	}
+	if err := d.CreateAlertChannel(channel); err != nil {
+		t.Fatalf("创建通道失败: %v", err)
+	}
+
+	as := NewAlertSystem(d)
+	err := as.Send(Alert{
+		Level:    AlertCritical,
+		Title:    `节点 "hk-1" 离线`,
+		Tags:     []string{"node", "offline"},
+		Channels: []string{channel.ID},
+	})
+	if err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	want := `{"text":"节点 \"hk-1\" 离线","level":"CRITICAL","tags":"node,offline"}`
+	if string(body) != want {
+		t.Errorf("模板渲染结果不正确:\n期望 %s\n实际 %s", want, body)
+	}
+	if signature != SignWebhookPayload("s3cret", timestamp, body) {
+		t.Errorf("签名校验失败: %s", signature)
+	}
+
+	deliveries, _ := d.ListAlertDeliveries(channel.ID, "", 10)
+	if len(deliveries) != 1 || deliveries[0].Status != models.AlertDeliverySent || deliveries[0].Attempts != 1 {
+		t.Errorf("应记录 1 条成功投递，实际 %+v", deliveries)
+	}
+}
+
+/*
+TestAlertSystem_RetryAndDefaultChannel 测试未指定通道时发送到默认通道，失败后重试
+*/
+func TestAlertSystem_RetryAndDefaultChannel(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	d := setupAlertTestDAO(t)
+	defaultChannel := &models.AlertChannel{
+		Name: "wecom", Type: models.AlertChannelWeCom, Enabled: true, IsDefault: true,
+		MaxRetries: 3, Config: `{"url":"` + server.URL + `"}`,
+	}
+	otherChannel := &models.AlertChannel{
+		Name: "slack", Type: models.AlertChannelSlack, Enabled: true,
+		MaxRetries: 0, Config: `{"url":"` + server.URL + `/never"}`,
+	}
+	d.CreateAlertChannel(defaultChannel)
+	d.CreateAlertChannel(otherChannel)
+
+	as := NewAlertSystem(d)
+	as.retryBackoff = time.Millisecond
+
+	if err := as.Send(Alert{Level: AlertWarning, Title: "节点离线", NodeID: "node-1"}); err != nil {
+		t.Fatalf("重试后应发送成功: %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("应请求 3 次（2 次失败 + 1 次成功），实际 %d", n)
+	}
+
+	deliveries, _ := d.ListAlertDeliveries("", "", 10)
+	if len(deliveries) != 1 || deliveries[0].ChannelID != defaultChannel.ID || deliveries[0].Attempts != 3 {
+		t.Errorf("应只向默认通道投递 1 次且尝试 3 次，实际 %+v", deliveries)
+	}
+}
+
+/*
+TestAlertSystem_RateLimit 测试通道限流：超出配额的告警被丢弃并记录
+*/
+func TestAlertSystem_RateLimit(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	d := setupAlertTestDAO(t)
+	channel := &models.AlertChannel{
+		Name: "discord", Type: models.AlertChannelDiscord, Enabled: true,
+		RateLimit: 2, Config: `{"url":"` + server.URL + `"}`,
+	}
+	d.CreateAlertChannel(channel)
+
+	as := NewAlertSystem(d)
+	for i := 0; i < 3; i++ {
+		if err := as.Send(Alert{Level: AlertInfo, Title: "test", Channels: []string{channel.ID}}); err != nil {
+			t.Fatalf("限流不应返回错误: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("每分钟 2 条的配额应只发送 2 次，实际 %d", n)
+	}
+	limited, _ := d.ListAlertDeliveries(channel.ID, models.AlertDeliveryRateLimited, 10)
+	if len(limited) != 1 {
+		t.Errorf("应记录 1 条限流投递，实际 %d", len(limited))
+	}
+
+	/* 令牌按配额匀速补充 */
+	limiter := &alertRateLimiter{perMinute: 2, tokens: 0, last: time.Now()}
+	if limiter.allow(limiter.last.Add(10 * time.Second)) {
+		t.Error("10 秒内不应补充到 1 个令牌")
+	}
+	if !limiter.allow(limiter.last.Add(30 * time.Second)) {
+		t.Error("累计 40 秒后应补充 1 个令牌")
+	}
+}
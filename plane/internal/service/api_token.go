@@ -0,0 +1,354 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"gkipass/plane/internal/db/models"
+)
+
+/* APITokenPrefix API 令牌明文前缀，认证中间件据此区分 API 令牌和 JWT */
+const APITokenPrefix = "gkp_"
+
+/* API 令牌权限范围 */
+const (
+	ScopeTunnelsRead  = "tunnels:read"
+	ScopeTunnelsWrite = "tunnels:write" /* 包含 tunnels:read */
+	ScopeStatsRead    = "stats:read"
+	ScopeNodesRead    = "nodes:read"
+)
+
+/* APITokenScopes 可授予的全部权限范围 */
+var APITokenScopes = []string{ScopeTunnelsRead, ScopeTunnelsWrite, ScopeStatsRead, ScopeNodesRead}
+
+const (
+	maxAPITokensPerUser   = 20
+	maxAPITokenAllowedIPs = 32
+	apiTokenDisplayPrefix = 12
+	/* 最近使用时间的写入间隔，避免每个请求都写库 */
+	apiTokenTouchInterval = time.Minute
+)
+
+var (
+	ErrAPITokenInvalid  = errors.New("API 令牌无效")
+	ErrAPITokenExpired  = errors.New("API 令牌已过期")
+	ErrAPITokenRevoked  = errors.New("API 令牌已吊销")
+	ErrAPITokenIPDenied = errors.New("来源 IP 不在 API 令牌允许范围内")
+)
+
+/*
+CreateAPITokenRequest 创建 API 令牌请求
+功能：ExpiresInDays 为 0 表示不过期；AllowedIPs 为 IP 或 CIDR，为空表示不限来源
+*/
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=64"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	AllowedIPs    []string `json:"allowed_ips"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=3650"`
+}
+
+/*
+APITokenInfo 对外展示的 API 令牌（不含明文和哈希）
+*/
+type APITokenInfo struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+/*
+APITokenService 用户个人 API 令牌服务
+功能：创建（明文只返回一次）、列出、吊销 API 令牌，以及认证中间件使用的令牌校验
+*/
+type APITokenService struct {
+	db     *gorm.DB
+	now    func() time.Time
+	logger *zap.Logger
+}
+
+/*
+NewAPITokenService 创建 API 令牌服务
+*/
+func NewAPITokenService(db *gorm.DB) *APITokenService {
+	return &APITokenService{
+		db:     db,
+		now:    time.Now,
+		logger: zap.L().Named("api-token-service"),
+	}
+}
+
+/* hashSecretToken 高熵随机令牌（API 令牌、刷新令牌）的存储哈希，无需加盐和慢哈希 */
+func hashSecretToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+Create 为用户创建 API 令牌
+功能：返回明文令牌和令牌信息，明文不落库，之后无法再次查看
+*/
+func (s *APITokenService) Create(userID string, req *CreateAPITokenRequest) (string, *APITokenInfo, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return "", nil, fmt.Errorf("令牌名称不能为空")
+	}
+	scopes, err := normalizeAPITokenScopes(req.Scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	allowedIPs, err := normalizeAllowedIPs(req.AllowedIPs)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := s.now()
+	var count int64
+	s.db.Model(&models.APIToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, now).
+		Count(&count)
+	if count >= maxAPITokensPerUser {
+		return "", nil, fmt.Errorf("最多只能创建 %d 个有效的 API 令牌", maxAPITokensPerUser)
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("生成令牌失败: %w", err)
+	}
+	raw := APITokenPrefix + secret
+
+	token := &models.APIToken{
+		UserID:     userID,
+		Name:       name,
+		Prefix:     raw[:apiTokenDisplayPrefix],
+		TokenHash:  hashSecretToken(raw),
+		Scopes:     strings.Join(scopes, ","),
+		AllowedIPs: strings.Join(allowedIPs, ","),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := s.db.Create(token).Error; err != nil {
+		return "", nil, fmt.Errorf("保存令牌失败: %w", err)
+	}
+	return raw, apiTokenInfo(token), nil
+}
+
+/*
+List 列出用户的 API 令牌（含已吊销、已过期），按创建时间倒序
+*/
+func (s *APITokenService) List(userID string) ([]*APITokenInfo, error) {
+	var tokens []models.APIToken
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	list := make([]*APITokenInfo, 0, len(tokens))
+	for i := range tokens {
+		list = append(list, apiTokenInfo(&tokens[i]))
+	}
+	return list, nil
+}
+
+/*
+Revoke 吊销用户的 API 令牌，吊销后立即失效；记录保留用于查看最近使用情况
+*/
+func (s *APITokenService) Revoke(userID, tokenID string) (*APITokenInfo, error) {
+	var token models.APIToken
+	if err := s.db.Where("id = ? AND user_id = ?", tokenID, userID).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("API 令牌不存在")
+		}
+		return nil, err
+	}
+	if token.RevokedAt != nil {
+		return nil, fmt.Errorf("API 令牌已吊销")
+	}
+	now := s.now()
+	if err := s.db.Model(&token).Update("revoked_at", now).Error; err != nil {
+		return nil, fmt.Errorf("吊销令牌失败: %w", err)
+	}
+	token.RevokedAt = &now
+	return apiTokenInfo(&token), nil
+}
+
+/*
+Authenticate 校验 API 令牌
+功能：按哈希查找令牌，检查吊销、过期、来源 IP 和所属用户状态，并更新最近使用时间和 IP；
+返回令牌和所属用户，用户角色以数据库当前值为准
+*/
+func (s *APITokenService) Authenticate(raw, clientIP string) (*models.APIToken, *models.User, error) {
+	if !strings.HasPrefix(raw, APITokenPrefix) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	var token models.APIToken
+	if err := s.db.Where("token_hash = ?", hashSecretToken(raw)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrAPITokenInvalid
+		}
+		return nil, nil, err
+	}
+
+	now := s.now()
+	if token.RevokedAt != nil {
+		return nil, nil, ErrAPITokenRevoked
+	}
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return nil, nil, ErrAPITokenExpired
+	}
+	if !ipAllowed(splitList(token.AllowedIPs), clientIP) {
+		s.logger.Warn("API 令牌来源 IP 不在允许范围内",
+			zap.String("tokenID", token.ID),
+			zap.String("client_ip", clientIP))
+		return nil, nil, ErrAPITokenIPDenied
+	}
+
+	var user models.User
+	if err := s.db.Select("id", "username", "role", "enabled").First(&user, "id = ?", token.UserID).Error; err != nil {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	if !user.Enabled {
+		return nil, nil, fmt.Errorf("账户已被禁用")
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval || token.LastUsedIP != clientIP {
+		if err := s.db.Model(&token).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		}).Error; err != nil {
+			s.logger.Warn("更新 API 令牌使用记录失败", zap.String("tokenID", token.ID), zap.Error(err))
+		}
+		token.LastUsedAt = &now
+		token.LastUsedIP = clientIP
+	}
+	return &token, &user, nil
+}
+
+/* APITokenScopeList 返回令牌的权限范围列表 */
+func APITokenScopeList(token *models.APIToken) []string {
+	return splitList(token.Scopes)
+}
+
+/* HasAPITokenScope 判断权限范围列表是否包含 scope，tunnels:write 包含 tunnels:read */
+func HasAPITokenScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope || (s == ScopeTunnelsWrite && scope == ScopeTunnelsRead) {
+			return true
+		}
+	}
+	return false
+}
+
+func apiTokenInfo(t *models.APIToken) *APITokenInfo {
+	return &APITokenInfo{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     splitList(t.Scopes),
+		AllowedIPs: splitList(t.AllowedIPs),
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		LastUsedIP: t.LastUsedIP,
+		RevokedAt:  t.RevokedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
+
+/* normalizeAPITokenScopes 校验并去重权限范围 */
+func normalizeAPITokenScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool, len(scopes))
+	out := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		valid := false
+		for _, known := range APITokenScopes {
+			if scope == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("未知的权限范围 %q", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			out = append(out, scope)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("至少需要一个权限范围")
+	}
+	return out, nil
+}
+
+/* normalizeAllowedIPs 校验 IP/CIDR，单个 IP 原样保存 */
+func normalizeAllowedIPs(entries []string) ([]string, error) {
+	if len(entries) > maxAPITokenAllowedIPs {
+		return nil, fmt.Errorf("IP 白名单最多 %d 条", maxAPITokenAllowedIPs)
+	}
+	out := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("无效的 CIDR %q", entry)
+			}
+			entry = network.String()
+		} else if ip := net.ParseIP(entry); ip == nil {
+			return nil, fmt.Errorf("无效的 IP 地址 %q", entry)
+		} else {
+			entry = ip.String()
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+/* ipAllowed 白名单为空时不限制 */
+func ipAllowed(allowed []string, clientIP string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(s string) []string {
+	out := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/* setupAPITokenTest 创建 API 令牌测试环境：一个用户，时钟可由测试控制 */
+func setupAPITokenTest(t *testing.T) (*gorm.DB, *APITokenService, *models.User, *time.Time) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.APIToken{}); err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+
+	user := &models.User{Username: "ci", Email: "ci@example.com", Password: "x", Role: models.RoleUser, Enabled: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	svc := NewAPITokenService(db)
+	svc.now = func() time.Time { return now }
+	return db, svc, user, &now
+}
+
+/* TestAPIToken_CreateAndAuthenticate 明文只保存哈希；认证返回所属用户、更新使用记录；过期、吊销、禁用用户后失效 */
+func TestAPIToken_CreateAndAuthenticate(t *testing.T) {
+	db, svc, user, now := setupAPITokenTest(t)
+
+	raw, info, err := svc.Create(user.ID, &CreateAPITokenRequest{
+		Name:          "ci",
+		Scopes:        []string{ScopeTunnelsWrite, ScopeStatsRead, ScopeStatsRead},
+		ExpiresInDays: 30,
+	})
+	if err != nil {
+		t.Fatalf("创建令牌失败: %v", err)
+	}
+	if len(info.Scopes) != 2 {
+		t.Errorf("重复的权限范围应去重，实际 %v", info.Scopes)
+	}
+	var stored models.APIToken
+	db.First(&stored, "id = ?", info.ID)
+	if stored.TokenHash == raw || stored.TokenHash != hashSecretToken(raw) || stored.Prefix != raw[:apiTokenDisplayPrefix] {
+		t.Errorf("库中应只保存令牌哈希和前缀")
+	}
+
+	token, owner, err := svc.Authenticate(raw, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("合法令牌应通过认证: %v", err)
+	}
+	if owner.ID != user.ID || owner.Role != models.RoleUser {
+		t.Errorf("应返回令牌所属用户")
+	}
+	if !HasAPITokenScope(APITokenScopeList(token), ScopeTunnelsRead) || HasAPITokenScope(APITokenScopeList(token), ScopeNodesRead) {
+		t.Errorf("tunnels:write 应包含 tunnels:read，且不包含未授予的范围")
+	}
+	db.First(&stored, "id = ?", info.ID)
+	if stored.LastUsedAt == nil || stored.LastUsedIP != "203.0.113.7" {
+		t.Errorf("认证后应记录最近使用时间和 IP")
+	}
+
+	if _, _, err := svc.Authenticate(raw+"x", "203.0.113.7"); !errors.Is(err, ErrAPITokenInvalid) {
+		t.Errorf("篡改的令牌应认证失败，实际 %v", err)
+	}
+
+	*now = now.AddDate(0, 0, 31)
+	if _, _, err := svc.Authenticate(raw, "203.0.113.7"); !errors.Is(err, ErrAPITokenExpired) {
+		t.Errorf("过期令牌应认证失败，实际 %v", err)
+	}
+
+	raw2, info2, _ := svc.Create(user.ID, &CreateAPITokenRequest{Name: "deploy", Scopes: []string{ScopeTunnelsRead}})
+	db.Model(&models.User{}).Where("id = ?", user.ID).Update("enabled", false)
+	if _, _, err := svc.Authenticate(raw2, "203.0.113.7"); err == nil {
+		t.Errorf("用户被禁用后令牌应失效")
+	}
+	db.Model(&models.User{}).Where("id = ?", user.ID).Update("enabled", true)
+
+	if _, err := svc.Revoke(user.ID, info2.ID); err != nil {
+		t.Fatalf("吊销令牌失败: %v", err)
+	}
+	if _, _, err := svc.Authenticate(raw2, "203.0.113.7"); !errors.Is(err, ErrAPITokenRevoked) {
+		t.Errorf("吊销的令牌应认证失败，实际 %v", err)
+	}
+	if _, err := svc.Revoke("other-user", info.ID); err == nil {
+		t.Errorf("不能吊销其他用户的令牌")
+	}
+}
+
+/* TestAPIToken_Validation 拒绝未知权限范围和无效 IP；IP 白名单按单个 IP 和 CIDR 匹配 */
+func TestAPIToken_Validation(t *testing.T) {
+	_, svc, user, _ := setupAPITokenTest(t)
+
+	if _, _, err := svc.Create(user.ID, &CreateAPITokenRequest{Name: "x", Scopes: []string{"admin"}}); err == nil {
+		t.Errorf("未知的权限范围应被拒绝")
+	}
+	if _, _, err := svc.Create(user.ID, &CreateAPITokenRequest{Name: "x", Scopes: []string{ScopeStatsRead}, AllowedIPs: []string{"10.0.0.300"}}); err == nil {
+		t.Errorf("无效的 IP 应被拒绝")
+	}
+
+	raw, info, err := svc.Create(user.ID, &CreateAPITokenRequest{
+		Name:       "ci",
+		Scopes:     []string{ScopeStatsRead},
+		AllowedIPs: []string{"10.1.2.3/16", "2001:db8::1"},
+	})
+	if err != nil {
+		t.Fatalf("创建令牌失败: %v", err)
+	}
+	if info.AllowedIPs[0] != "10.1.0.0/16" {
+		t.Errorf("CIDR 应规范化为网络地址，实际 %s", info.AllowedIPs[0])
+	}
+
+	cases := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"10.1.200.9", true},
+		{"2001:db8:0::1", true},
+		{"10.2.0.1", false},
+		{"2001:db8::2", false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		_, _, err := svc.Authenticate(raw, tc.ip)
+		if tc.allowed && err != nil {
+			t.Errorf("IP %q 应允许访问: %v", tc.ip, err)
+		}
+		if !tc.allowed && !errors.Is(err, ErrAPITokenIPDenied) {
+			t.Errorf("IP %q 应被拒绝，实际 %v", tc.ip, err)
+		}
+	}
+}
@@ -1,56 +1,464 @@
 package service
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"gkipass/plane/internal/db"
-	"gkipass/plane/internal/pkg/logger"
-
+	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"gkipass/plane/internal/db/models"
+)
+
+const (
+	auditAppendRetries = 3    /* 多实例并发写入时序号冲突的重试次数 */
+	auditScanBatch     = 1000 /* 校验、导出时每批读取的条数 */
+	auditMaxPageSize   = 200
+	auditRedacted      = "******"
 )
 
-// AuditLog 审计日志
-type AuditLog struct {
-	ID        string                 `json:"id"`
-	UserID    string                 `json:"user_id"`
-	Username  string                 `json:"username"`
-	Action    string                 `json:"action"`
-	Resource  string                 `json:"resource"`
-	Details   map[string]interface{} `json:"details"`
-	IP        string                 `json:"ip"`
-	UserAgent string                 `json:"user_agent"`
-	Status    string                 `json:"status"`
-	CreatedAt time.Time              `json:"created_at"`
-}
-
-// AuditService 审计服务
+/* auditSensitiveKeys 字段名包含这些词时，差异中只记录“已修改”，不记录明文 */
+var auditSensitiveKeys = []string{"password", "secret", "token", "private", "credential"}
+
+/*
+AuditEntry 待写入的审计记录
+功能：Before/After 传入变更前后的对象（结构体或 map），写入时只保留有变化的字段；
+创建类操作 Before 为 nil，删除类操作 After 为 nil
+*/
+type AuditEntry struct {
+	UserID    string
+	Username  string
+	Action    string
+	Resource  string
+	Method    string
+	Path      string
+	Status    int
+	RequestID string
+	IP        string
+	UserAgent string
+	Detail    interface{}
+	Before    interface{}
+	After     interface{}
+}
+
+/*
+AuditFilter 审计日志查询条件
+功能：Resource 和 Action 按前缀匹配（如 "tunnel:" 查询全部隧道、"settings." 查询全部设置变更），
+From/To 为空表示不限
+*/
+type AuditFilter struct {
+	UserID   string
+	Resource string
+	Action   string
+	From     time.Time
+	To       time.Time
+	Page     int
+	PageSize int
+}
+
+/*
+AuditVerifyResult 哈希链校验结果
+功能：Valid 为 false 时 BrokenSeq/BrokenID 指向第一条校验失败的记录；
+LastSeq/LastHash 为链尾，可定期抄录到外部系统，用于发现尾部记录被整体删除
+*/
+type AuditVerifyResult struct {
+	Valid     bool   `json:"valid"`
+	Checked   int64  `json:"checked"`
+	LastSeq   int64  `json:"last_seq"`
+	LastHash  string `json:"last_hash"`
+	BrokenSeq int64  `json:"broken_seq,omitempty"`
+	BrokenID  string `json:"broken_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+/*
+AuditService 审计服务
+功能：把审计记录持久化到 audit_logs 并串成哈希链，提供查询、导出和防篡改校验；
+审计日志不做自动清理，满足至少一年的留存要求
+*/
 type AuditService struct {
-	db *db.Manager
+	db     *gorm.DB
+	mu     sync.Mutex
+	logger *zap.Logger
 }
 
-// NewAuditService 创建审计服务
-func NewAuditService(dbManager *db.Manager) *AuditService {
-	return &AuditService{db: dbManager}
+/*
+NewAuditService 创建审计服务
+*/
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{
+		db:     db,
+		logger: zap.L().Named("audit"),
+	}
 }
 
-// Log 记录审计日志
-func (s *AuditService) Log(log *AuditLog) {
-	log.CreatedAt = time.Now()
+/*
+Record 写入一条审计记录
+功能：在事务中读取链尾并追加新记录；多个面板实例同时写入时由 seq 唯一索引发现冲突并重试
+*/
+func (s *AuditService) Record(ctx context.Context, entry *AuditEntry) (*models.AuditLog, error) {
+	before, after := AuditDiff(entry.Before, entry.After)
 
-	// 记录到结构化日志
-	logger.Info("审计日志",
-		zap.String("user_id", log.UserID),
-		zap.String("action", log.Action),
-		zap.String("resource", log.Resource),
-		zap.String("status", log.Status))
+	var detail string
+	switch d := entry.Detail.(type) {
+	case nil:
+	case string:
+		detail = d
+	default:
+		data, err := json.Marshal(d)
+		if err != nil {
+			return nil, fmt.Errorf("序列化审计详情失败: %w", err)
+		}
+		detail = string(data)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < auditAppendRetries; attempt++ {
+		log := &models.AuditLog{
+			UserID:    entry.UserID,
+			Username:  truncateRunes(entry.Username, 64),
+			Action:    truncateRunes(entry.Action, 64),
+			Resource:  truncateRunes(entry.Resource, 128),
+			Method:    entry.Method,
+			Path:      truncateRunes(entry.Path, 256),
+			Status:    entry.Status,
+			RequestID: truncateRunes(entry.RequestID, 64),
+			Detail:    detail,
+			Before:    before,
+			After:     after,
+			IP:        truncateRunes(entry.IP, 64),
+			UA:        truncateRunes(entry.UserAgent, 512),
+		}
+		if err = s.append(ctx, log); err == nil {
+			return log, nil
+		}
+	}
+
+	s.logger.Error("写入审计日志失败",
+		zap.String("action", entry.Action),
+		zap.String("resource", entry.Resource),
+		zap.String("user_id", entry.UserID),
+		zap.Error(err))
+	return nil, err
+}
+
+/* append 在事务中读取链尾、计算哈希并写入 */
+func (s *AuditService) append(ctx context.Context, log *models.AuditLog) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var last []models.AuditLog
+		q := tx.Unscoped().Select("seq", "hash").Order("seq DESC").Limit(1)
+		if tx.Dialector.Name() != "sqlite" {
+			q = q.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		if err := q.Find(&last).Error; err != nil {
+			return err
+		}
 
-	// 存储到Redis（可选）
-	if s.db.HasCache() {
-		key := fmt.Sprintf("audit:%s", log.ID)
-		if data, err := json.Marshal(log); err == nil {
-			_ = s.db.Cache.Redis.Set(key, string(data), 7*24*time.Hour)
+		log.ID = uuid.New().String()
+		/* 时间精度与数据库一致（MySQL datetime(3)），保证读回后哈希不变 */
+		log.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+		log.UpdatedAt = log.CreatedAt
+		log.Seq = 1
+		if len(last) > 0 {
+			log.Seq = last[0].Seq + 1
+			log.PrevHash = last[0].Hash
+		}
+		log.Hash = auditHash(log)
+		return tx.Create(log).Error
+	})
+}
+
+/*
+Search 按条件分页查询审计日志，按时间倒序；无效的分页参数会被修正并写回 filter
+*/
+func (s *AuditService) Search(filter *AuditFilter) ([]models.AuditLog, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > auditMaxPageSize {
+		filter.PageSize = 50
+	}
+	page, pageSize := filter.Page, filter.PageSize
+
+	q := s.query(filter)
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []models.AuditLog
+	if err := q.Order("seq DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+/*
+Export 按条件导出审计日志，按时间正序分批写入 w
+功能：format 为 csv 或 json；json 为数组，每条记录包含 prev_hash/hash，便于离线复核
+*/
+func (s *AuditService) Export(ctx context.Context, w io.Writer, format string, filter *AuditFilter) error {
+	var (
+		write  func(*models.AuditLog) error
+		finish func() error
+	)
+
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{
+			"seq", "created_at", "user_id", "username", "action", "resource", "method", "path",
+			"status", "ip", "request_id", "detail", "before", "after", "prev_hash", "hash",
+		}); err != nil {
+			return err
+		}
+		write = func(l *models.AuditLog) error {
+			return cw.Write([]string{
+				strconv.FormatInt(l.Seq, 10), l.CreatedAt.UTC().Format(time.RFC3339Nano), l.UserID, l.Username,
+				l.Action, l.Resource, l.Method, l.Path, strconv.Itoa(l.Status), l.IP, l.RequestID,
+				l.Detail, l.Before, l.After, l.PrevHash, l.Hash,
+			})
+		}
+		finish = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+
+	case "json":
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+		first := true
+		write = func(l *models.AuditLog) error {
+			data, err := json.Marshal(l)
+			if err != nil {
+				return err
+			}
+			if !first {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+			_, err = w.Write(data)
+			return err
+		}
+		finish = func() error {
+			_, err := io.WriteString(w, "]")
+			return err
+		}
+
+	default:
+		return fmt.Errorf("不支持的导出格式: %s", format)
+	}
+
+	var afterSeq int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var batch []models.AuditLog
+		if err := s.query(filter).Where("seq > ?", afterSeq).
+			Order("seq ASC").Limit(auditScanBatch).Find(&batch).Error; err != nil {
+			return err
 		}
+		for i := range batch {
+			if err := write(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if len(batch) < auditScanBatch {
+			break
+		}
+		afterSeq = batch[len(batch)-1].Seq
+	}
+	return finish()
+}
+
+/*
+Verify 校验整条哈希链
+功能：逐条重算哈希并检查序号连续、PrevHash 与上一条一致；包括被软删除的记录
+*/
+func (s *AuditService) Verify(ctx context.Context) (*AuditVerifyResult, error) {
+	result := &AuditVerifyResult{Valid: true}
+
+	var prevSeq int64
+	var prevHash string
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var batch []models.AuditLog
+		if err := s.db.WithContext(ctx).Unscoped().Where("seq > ?", prevSeq).
+			Order("seq ASC").Limit(auditScanBatch).Find(&batch).Error; err != nil {
+			return nil, err
+		}
+
+		for i := range batch {
+			l := &batch[i]
+			var reason string
+			switch {
+			case l.Seq != prevSeq+1:
+				reason = fmt.Sprintf("序号不连续：期望 %d，实际 %d", prevSeq+1, l.Seq)
+			case l.PrevHash != prevHash:
+				reason = "与上一条记录的哈希不一致"
+			case auditHash(l) != l.Hash:
+				reason = "记录内容与哈希不一致"
+			}
+			if reason != "" {
+				result.Valid = false
+				result.BrokenSeq = l.Seq
+				result.BrokenID = l.ID
+				result.Reason = reason
+				return result, nil
+			}
+			result.Checked++
+			result.LastSeq, result.LastHash = l.Seq, l.Hash
+			prevSeq, prevHash = l.Seq, l.Hash
+		}
+		if len(batch) < auditScanBatch {
+			break
+		}
+	}
+	return result, nil
+}
+
+/* query 构建查询条件；软删除的记录同样可见，避免通过软删除隐藏操作 */
+func (s *AuditService) query(filter *AuditFilter) *gorm.DB {
+	q := s.db.Model(&models.AuditLog{}).Unscoped()
+	if filter.UserID != "" {
+		q = q.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Resource != "" {
+		q = q.Where("resource LIKE ? ESCAPE '!'", escapeLike(filter.Resource)+"%")
+	}
+	if filter.Action != "" {
+		q = q.Where("action LIKE ? ESCAPE '!'", escapeLike(filter.Action)+"%")
+	}
+	if !filter.From.IsZero() {
+		q = q.Where("created_at >= ?", filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("created_at < ?", filter.To.UTC())
+	}
+	return q
+}
+
+/* escapeLike 转义 LIKE 通配符（转义符为 !，三种数据库写法一致），查询条件按字面前缀匹配 */
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+/* auditHash 计算记录哈希：覆盖除哈希本身和更新时间外的全部字段，时间按毫秒计 */
+func auditHash(l *models.AuditLog) string {
+	payload, _ := json.Marshal([]interface{}{
+		l.Seq, l.PrevHash, l.ID, l.CreatedAt.UnixMilli(),
+		l.UserID, l.Username, l.Action, l.Resource, l.Method, l.Path, l.Status, l.RequestID,
+		l.Detail, l.Before, l.After, l.IP, l.UA,
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+AuditDiff 计算变更前后的字段差异
+功能：两者都不为空时只保留值不同的字段；敏感字段（密码、密钥等）只记录“已修改”；
+返回 JSON 字符串，对应一侧为空时返回空串
+*/
+func AuditDiff(before, after interface{}) (string, string) {
+	b, a := auditFields(before), auditFields(after)
+	if b != nil && a != nil {
+		/* 更新时间每次都会变化，不作为差异记录 */
+		delete(b, "updated_at")
+		delete(a, "updated_at")
+		for k, v := range b {
+			if av, ok := a[k]; ok && reflect.DeepEqual(v, av) {
+				delete(b, k)
+				delete(a, k)
+			}
+		}
+	}
+	return auditJSON(redactAuditFields(b)), auditJSON(redactAuditFields(a))
+}
+
+/* auditFields 把对象转换为字段 map，非对象类型放在 "value" 下 */
+func auditFields(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return map[string]interface{}{"value": fmt.Sprint(v)}
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		var value interface{}
+		_ = json.Unmarshal(data, &value)
+		return map[string]interface{}{"value": value}
+	}
+	return fields
+}
+
+/* redactAuditFields 比较差异后再脱敏，保证敏感字段的修改也会被记录；嵌套对象（如提供方列表）逐层脱敏 */
+func redactAuditFields(fields map[string]interface{}) map[string]interface{} {
+	for k, val := range fields {
+		if val == nil || val == "" {
+			continue
+		}
+		lower := strings.ToLower(k)
+		sensitive := false
+		for _, word := range auditSensitiveKeys {
+			if strings.Contains(lower, word) {
+				sensitive = true
+				break
+			}
+		}
+		if sensitive {
+			fields[k] = auditRedacted
+			continue
+		}
+		fields[k] = redactAuditValue(val)
+	}
+	return fields
+}
+
+func redactAuditValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		return redactAuditFields(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = redactAuditValue(v[i])
+		}
+	}
+	return val
+}
+
+func auditJSON(fields map[string]interface{}) string {
+	if fields == nil {
+		return ""
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return ""
 	}
+	return string(data)
 }
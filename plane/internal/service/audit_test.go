@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/*
+setupAuditTest 创建审计日志测试环境，写入 3 条记录：
+admin-1 修改隧道 t1、admin-1 修改设置、user-2 删除隧道 t2
+*/
+func setupAuditTest(t *testing.T) (*gorm.DB, *AuditService) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.AuditLog{}); err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+
+	svc := NewAuditService(db)
+	entries := []*AuditEntry{
+		{
+			UserID: "admin-1", Action: "tunnel.update", Resource: "tunnel:t1",
+			Before: map[string]interface{}{"name": "a", "listen_port": 1000},
+			After:  map[string]interface{}{"name": "a", "listen_port": 2000},
+		},
+		{
+			UserID: "admin-1", Action: "settings.update", Resource: "setting:notification",
+			Before: map[string]interface{}{"email_password": "old", "email_port": 25},
+			After:  map[string]interface{}{"email_password": "new", "email_port": 25},
+		},
+		{
+			UserID: "user-2", Action: "tunnel.delete", Resource: "tunnel:t2",
+			Before: map[string]interface{}{"name": "b"},
+		},
+	}
+	for _, e := range entries {
+		if _, err := svc.Record(context.Background(), e); err != nil {
+			t.Fatalf("写入审计日志失败: %v", err)
+		}
+	}
+	return db, svc
+}
+
+/* TestAudit_RecordDiffAndChain 只记录变化的字段、敏感字段脱敏，记录按序号串成哈希链 */
+func TestAudit_RecordDiffAndChain(t *testing.T) {
+	db, svc := setupAuditTest(t)
+
+	var logs []models.AuditLog
+	db.Order("seq ASC").Find(&logs)
+	if len(logs) != 3 {
+		t.Fatalf("应有 3 条审计日志，实际 %d", len(logs))
+	}
+
+	if logs[0].Before != `{"listen_port":1000}` || logs[0].After != `{"listen_port":2000}` {
+		t.Errorf("只应记录变化的字段，实际 before=%s after=%s", logs[0].Before, logs[0].After)
+	}
+	if strings.Contains(logs[1].Before+logs[1].After, "old") || !strings.Contains(logs[1].After, auditRedacted) {
+		t.Errorf("密码字段的修改应被记录但不含明文，实际 before=%s after=%s", logs[1].Before, logs[1].After)
+	}
+	if logs[2].Before != `{"name":"b"}` || logs[2].After != "" {
+		t.Errorf("删除操作应只有 before，实际 before=%s after=%s", logs[2].Before, logs[2].After)
+	}
+
+	for i, l := range logs {
+		if l.Seq != int64(i+1) {
+			t.Errorf("序号应连续，第 %d 条为 %d", i+1, l.Seq)
+		}
+		if i > 0 && l.PrevHash != logs[i-1].Hash {
+			t.Errorf("第 %d 条的 prev_hash 应等于上一条的 hash", i+1)
+		}
+	}
+
+	result, err := svc.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if !result.Valid || result.Checked != 3 || result.LastSeq != 3 || result.LastHash != logs[2].Hash {
+		t.Errorf("未篡改的哈希链应校验通过: %+v", result)
+	}
+}
+
+/* TestAudit_VerifyDetectsTampering 修改内容、删除中间记录都能被校验发现 */
+func TestAudit_VerifyDetectsTampering(t *testing.T) {
+	db, svc := setupAuditTest(t)
+
+	db.Model(&models.AuditLog{}).Where("seq = ?", 2).Update("user_id", "someone-else")
+	result, err := svc.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if result.Valid || result.BrokenSeq != 2 {
+		t.Errorf("修改第 2 条记录应在第 2 条校验失败: %+v", result)
+	}
+
+	db, svc = setupAuditTest(t)
+	db.Unscoped().Where("seq = ?", 2).Delete(&models.AuditLog{})
+	result, err = svc.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if result.Valid || result.BrokenSeq != 3 {
+		t.Errorf("删除第 2 条记录应在第 3 条校验失败: %+v", result)
+	}
+
+	/* 软删除不影响校验，记录仍可查询 */
+	db, svc = setupAuditTest(t)
+	db.Where("seq = ?", 1).Delete(&models.AuditLog{})
+	if result, _ := svc.Verify(context.Background()); !result.Valid {
+		t.Errorf("软删除不应破坏哈希链: %+v", result)
+	}
+	if _, total, _ := svc.Search(&AuditFilter{}); total != 3 {
+		t.Errorf("软删除的记录仍应可查询，实际 %d 条", total)
+	}
+}
+
+/* TestAudit_SearchAndExport 按用户、资源前缀、操作和时间范围过滤，导出 CSV/JSON */
+func TestAudit_SearchAndExport(t *testing.T) {
+	_, svc := setupAuditTest(t)
+
+	cases := []struct {
+		name   string
+		filter AuditFilter
+		want   int64
+	}{
+		{"按用户", AuditFilter{UserID: "admin-1"}, 2},
+		{"按资源前缀", AuditFilter{Resource: "tunnel:"}, 2},
+		{"按资源", AuditFilter{Resource: "tunnel:t2"}, 1},
+		{"按操作前缀", AuditFilter{Action: "settings."}, 1},
+		{"通配符按字面匹配", AuditFilter{Resource: "tunnel_"}, 0},
+		{"时间范围内", AuditFilter{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)}, 3},
+		{"时间范围外", AuditFilter{To: time.Now().Add(-time.Hour)}, 0},
+	}
+	for _, tc := range cases {
+		if _, total, err := svc.Search(&tc.filter); err != nil || total != tc.want {
+			t.Errorf("%s：应返回 %d 条，实际 %d 条（%v）", tc.name, tc.want, total, err)
+		}
+	}
+
+	logs, _, _ := svc.Search(&AuditFilter{})
+	if len(logs) != 3 || logs[0].Seq != 3 {
+		t.Errorf("查询结果应按时间倒序")
+	}
+
+	var buf bytes.Buffer
+	if err := svc.Export(context.Background(), &buf, "csv", &AuditFilter{Resource: "tunnel:"}); err != nil {
+		t.Fatalf("导出 CSV 失败: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("解析导出的 CSV 失败: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "seq" || rows[1][0] != "1" || rows[2][4] != "tunnel.delete" {
+		t.Errorf("CSV 应包含表头和 2 条按时间正序的记录: %v", rows)
+	}
+
+	buf.Reset()
+	if err := svc.Export(context.Background(), &buf, "json", &AuditFilter{}); err != nil {
+		t.Fatalf("导出 JSON 失败: %v", err)
+	}
+	var exported []models.AuditLog
+	if err := json.Unmarshal(buf.Bytes(), &exported); err != nil {
+		t.Fatalf("解析导出的 JSON 失败: %v", err)
+	}
+	if len(exported) != 3 || exported[2].PrevHash != exported[1].Hash {
+		t.Errorf("JSON 应包含全部记录及哈希: %d 条", len(exported))
+	}
+
+	if err := svc.Export(context.Background(), &buf, "xml", &AuditFilter{}); err == nil {
+		t.Errorf("不支持的导出格式应返回错误")
+	}
+}
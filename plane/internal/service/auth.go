@@ -16,6 +16,8 @@ AuthService 认证服务
 */
 type AuthService struct {
 	jwtSecret string
+	apiTokens *APITokenService
+	sessions  *SessionService
 	logger    *zap.Logger
 }
 
@@ -44,6 +46,36 @@ func (s *AuthService) GetJWTSecret() string {
 	return s.jwtSecret
 }
 
+/*
+SetAPITokenService 设置 API 令牌服务
+功能：设置后 JWTAuth 中间件同时接受用户个人 API 令牌
+*/
+func (s *AuthService) SetAPITokenService(tokens *APITokenService) {
+	s.apiTokens = tokens
+}
+
+/*
+GetAPITokenService 获取 API 令牌服务，未设置时返回 nil
+*/
+func (s *AuthService) GetAPITokenService() *APITokenService {
+	return s.apiTokens
+}
+
+/*
+SetSessionService 设置会话服务
+功能：设置后 JWTAuth 中间件校验令牌所属会话，会话吊销后令牌立即失效
+*/
+func (s *AuthService) SetSessionService(sessions *SessionService) {
+	s.sessions = sessions
+}
+
+/*
+GetSessionService 获取会话服务，未设置时返回 nil
+*/
+func (s *AuthService) GetSessionService() *SessionService {
+	return s.sessions
+}
+
 /*
 ValidateAPIKey 验证 API 密钥
 功能：使用 HMAC-SHA256 验证 API 密钥的有效性
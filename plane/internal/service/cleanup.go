@@ -16,6 +16,7 @@ CleanupService 清理服务（定时任务）
 */
 type CleanupService struct {
 	dao      *dao.DAO
+	leader   *LeaderElector /* 多实例部署时只在主实例执行，nil 表示单实例 */
 	stopChan chan struct{}
 }
 
@@ -29,17 +30,26 @@ func NewCleanupService(d *dao.DAO) *CleanupService {
 	}
 }
 
+/* SetLeaderElector 设置主实例选举器，多实例部署时非主实例跳过清理 */
+func (s *CleanupService) SetLeaderElector(leader *LeaderElector) {
+	s.leader = leader
+}
+
 // Start 启动清理服务
 func (s *CleanupService) Start() {
-	s.cleanupExpiredSubscriptions()
-	s.cleanupInactiveTunnels()
+	if s.leader.IsLeader() {
+		s.cleanupExpiredSubscriptions()
+		s.cleanupInactiveTunnels()
+	}
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			s.runCleanup()
+			if s.leader.IsLeader() {
+				s.runCleanup()
+			}
 		case <-s.stopChan:
 			return
 		}
@@ -72,6 +82,12 @@ func (s *CleanupService) runCleanup() {
 
 	// 6. 提醒即将过期的订阅（3 天内）
 	s.notifyExpiringSubscriptions()
+
+	// 7. 压缩规则变更日志（保留 7 天）
+	s.compactRuleChanges()
+
+	// 8. 清理旧告警投递记录（保留 30 天）
+	s.cleanupOldAlertDeliveries()
 }
 
 /* cleanupExpiredSubscriptions 清理过期订阅 */
@@ -172,3 +188,27 @@ func (s *CleanupService) cleanupOldMonitoringData() {
 		logger.Info("已清理旧监控数据", zap.Int64("count", result.RowsAffected))
 	}
 }
+
+/* compactRuleChanges 压缩过期的规则变更日志，确认版本更早的节点重连时回退全量同步 */
+func (s *CleanupService) compactRuleChanges() {
+	count, err := NewIncrementalSyncService(s.dao.DB).Compact(DefaultRuleChangeRetention)
+	if err != nil {
+		logger.Error("压缩规则变更日志失败", zap.Error(err))
+		return
+	}
+	if count > 0 {
+		logger.Info("已压缩规则变更日志", zap.Int64("count", count))
+	}
+}
+
+/* cleanupOldAlertDeliveries 清理 30 天前的告警投递记录 */
+func (s *CleanupService) cleanupOldAlertDeliveries() {
+	count, err := s.dao.DeleteAlertDeliveriesBefore(time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		logger.Error("清理告警投递记录失败", zap.Error(err))
+		return
+	}
+	if count > 0 {
+		logger.Info("已清理告警投递记录", zap.Int64("count", count))
+	}
+}
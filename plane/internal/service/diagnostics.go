@@ -5,6 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,6 +23,9 @@ type DiagnosticsService struct {
 	logger      *zap.Logger
 	nodeService *NodeService
 	wsService   *WebSocketService
+
+	// hopMu 串行化隧道逐跳探测结果的读改写
+	hopMu sync.Mutex
 }
 
 // NewDiagnosticsService 创建诊断服务
@@ -295,6 +302,11 @@ func (s *DiagnosticsService) ListDiagnosticResults(sourceID, targetID string, li
 
 // HandleProbeResult 处理探测结果
 func (s *DiagnosticsService) HandleProbeResult(probeResult *protocol.ProbeResult) error {
+	// 隧道逐跳探测
+	if strings.Contains(probeResult.ProbeID, hopProbeSeparator) {
+		return s.handleHopProbeResult(probeResult)
+	}
+
 	// 获取诊断结果
 	result, err := s.GetDiagnosticResult(probeResult.ProbeID)
 	if err != nil {
@@ -320,18 +332,83 @@ func (s *DiagnosticsService) HandleProbeResult(probeResult *protocol.ProbeResult
 	return nil
 }
 
+// hopProbeSeparator 逐跳探测 ProbeID 的分隔符：<诊断ID>#<链路序号>
+const hopProbeSeparator = "#"
+
+// tunnelChainNode 隧道链路上参与探测的节点
+type tunnelChainNode struct {
+	Role     string // ingress / relay / egress
+	GroupID  string
+	NodeID   string
+	Address  string // 节点隧道地址（PublicIP:Port）
+	Protocol string // 上一跳进入本跳的协议
+}
+
 // TunnelDiagnostic 隧道诊断
+// 按链路逐跳探测：入口 → 各中继 → 出口 → 目标，每一段由前一跳的在线节点向下一跳发起探测，
+// 结果按段记录延迟，全部返回后汇总端到端延迟
 func (s *DiagnosticsService) TunnelDiagnostic(tunnelID string) (*DiagnosticResult, error) {
-	// TODO: 实现隧道诊断
+	chain, target, err := s.loadTunnelChain(tunnelID)
+	if err != nil {
+		return nil, err
+	}
 
 	// 创建诊断结果
 	result := &DiagnosticResult{
 		ID:        uuid.New().String(),
+		SourceID:  chain[0].NodeID,
+		TargetID:  tunnelID,
 		Type:      "tunnel",
 		Status:    "pending",
 		StartTime: time.Now(),
-		Results:   make([]map[string]interface{}, 0),
-		Summary:   make(map[string]interface{}),
+		Results:   make([]map[string]interface{}, 0, len(chain)),
+		Summary:   map[string]interface{}{"hops": len(chain)},
+	}
+
+	// 每一段链路：chain[i] → chain[i+1]，最后一段为出口 → 目标
+	requests := make([]*protocol.ProbeRequest, 0, len(chain))
+	for i, from := range chain {
+		entry := map[string]interface{}{
+			"hop":            i,
+			"from_role":      from.Role,
+			"from_group_id":  from.GroupID,
+			"source_node_id": from.NodeID,
+			"status":         "pending",
+		}
+
+		var to tunnelChainNode
+		if i+1 < len(chain) {
+			to = chain[i+1]
+		} else {
+			to = tunnelChainNode{Role: "target", Address: target, Protocol: "tcp"}
+		}
+		entry["to_role"] = to.Role
+		entry["to_group_id"] = to.GroupID
+		entry["target_node_id"] = to.NodeID
+		entry["target"] = to.Address
+		entry["protocol"] = to.Protocol
+
+		switch {
+		case from.NodeID == "":
+			entry["status"] = "skipped"
+			entry["message"] = "源节点组无在线节点"
+		case to.Address == "":
+			entry["status"] = "skipped"
+			entry["message"] = "下一跳无可用节点地址"
+		default:
+			requests = append(requests, &protocol.ProbeRequest{
+				ProbeID:       fmt.Sprintf("%s%s%d", result.ID, hopProbeSeparator, i),
+				Type:          "tcp",
+				Target:        to.Address,
+				SourceNodeID:  from.NodeID,
+				TargetNodeID:  to.NodeID,
+				TargetAddress: to.Address,
+				Count:         5,
+				Timeout:       20,
+				Protocol:      to.Protocol,
+			})
+		}
+		result.Results = append(result.Results, entry)
 	}
 
 	// 保存诊断结果
@@ -339,6 +416,256 @@ func (s *DiagnosticsService) TunnelDiagnostic(tunnelID string) (*DiagnosticResul
 		return nil, fmt.Errorf("保存诊断结果失败: %w", err)
 	}
 
+	// 发送逐跳探测请求；持锁直到保存完成，避免先返回的结果被覆盖
+	s.hopMu.Lock()
+	defer s.hopMu.Unlock()
+	for _, req := range requests {
+		msg, err := protocol.NewMessage(protocol.MessageTypeProbeRequest, req)
+		if err == nil {
+			err = s.wsService.SendMessageToNode(req.SourceNodeID, msg)
+		}
+		if err != nil {
+			s.logger.Warn("发送逐跳探测请求失败",
+				zap.String("probe_id", req.ProbeID),
+				zap.String("node_id", req.SourceNodeID),
+				zap.Error(err))
+			hop, _ := parseHopProbeID(req.ProbeID)
+			result.Results[hop]["status"] = "failed"
+			result.Results[hop]["message"] = fmt.Sprintf("发送探测请求失败: %s", err.Error())
+		}
+	}
+
+	finalizeTunnelDiagnostic(result)
+	if err := s.saveDiagnosticResult(result); err != nil {
+		return nil, fmt.Errorf("保存诊断结果失败: %w", err)
+	}
+
 	// 返回诊断结果
 	return result, nil
 }
+
+// loadTunnelChain 加载隧道链路并为每一跳选取探测节点
+func (s *DiagnosticsService) loadTunnelChain(tunnelID string) ([]tunnelChainNode, string, error) {
+	var ingressGroupID, egressGroupID, ingressNodeID, egressNodeID, tunnelProtocol, ingressProtocol, targetAddress string
+	var targetPort int
+	err := s.db.QueryRow(`
+		SELECT ingress_group_id, egress_group_id, ingress_node_id, egress_node_id,
+			protocol, ingress_protocol, target_address, target_port
+		FROM tunnels
+		WHERE id = ? AND deleted_at IS NULL
+	`, tunnelID).Scan(
+		&ingressGroupID, &egressGroupID, &ingressNodeID, &egressNodeID,
+		&tunnelProtocol, &ingressProtocol, &targetAddress, &targetPort,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", fmt.Errorf("隧道不存在: %s", tunnelID)
+		}
+		return nil, "", fmt.Errorf("查询隧道失败: %w", err)
+	}
+
+	chain := []tunnelChainNode{{Role: "ingress", GroupID: ingressGroupID, NodeID: ingressNodeID, Protocol: ingressProtocol}}
+
+	rows, err := s.db.Query(`
+		SELECT group_id, node_id, protocol
+		FROM tunnel_hops
+		WHERE tunnel_id = ? AND deleted_at IS NULL
+		ORDER BY position
+	`, tunnelID)
+	if err != nil {
+		return nil, "", fmt.Errorf("查询中继跳失败: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		hop := tunnelChainNode{Role: "relay"}
+		var nodeID sql.NullString
+		if err := rows.Scan(&hop.GroupID, &nodeID, &hop.Protocol); err != nil {
+			return nil, "", fmt.Errorf("扫描中继跳失败: %w", err)
+		}
+		hop.NodeID = nodeID.String
+		chain = append(chain, hop)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("查询中继跳失败: %w", err)
+	}
+
+	chain = append(chain, tunnelChainNode{Role: "egress", GroupID: egressGroupID, NodeID: egressNodeID, Protocol: tunnelProtocol})
+
+	for i := range chain {
+		chain[i].NodeID, chain[i].Address = s.pickProbeNode(chain[i].GroupID, chain[i].NodeID)
+	}
+
+	target := net.JoinHostPort(targetAddress, strconv.Itoa(targetPort))
+	return chain, target, nil
+}
+
+// pickProbeNode 选取一跳中参与探测的在线节点，返回节点ID和隧道地址
+func (s *DiagnosticsService) pickProbeNode(groupID, nodeID string) (string, string) {
+	var id, publicIP, ipAddress string
+	var port int
+	var err error
+	if nodeID != "" {
+		err = s.db.QueryRow(`
+			SELECT id, COALESCE(public_ip, ''), COALESCE(ip_address, ''), COALESCE(port, 0)
+			FROM nodes WHERE id = ? AND status = 'online'
+		`, nodeID).Scan(&id, &publicIP, &ipAddress, &port)
+	} else if groupID != "" {
+		err = s.db.QueryRow(`
+			SELECT n.id, COALESCE(n.public_ip, ''), COALESCE(n.ip_address, ''), COALESCE(n.port, 0)
+			FROM nodes n
+			JOIN node_group_nodes m ON m.node_id = n.id
+			WHERE m.group_id = ? AND n.status = 'online'
+			ORDER BY n.last_online DESC
+			LIMIT 1
+		`, groupID).Scan(&id, &publicIP, &ipAddress, &port)
+	} else {
+		return "", ""
+	}
+	if err != nil {
+		return "", ""
+	}
+
+	host := publicIP
+	if host == "" {
+		host = ipAddress
+	}
+	if host == "" || port == 0 {
+		return id, ""
+	}
+	return id, net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// handleHopProbeResult 处理逐跳探测结果，所有链路返回后汇总
+func (s *DiagnosticsService) handleHopProbeResult(probeResult *protocol.ProbeResult) error {
+	diagnosticID, _, _ := strings.Cut(probeResult.ProbeID, hopProbeSeparator)
+	hop, err := parseHopProbeID(probeResult.ProbeID)
+	if err != nil {
+		return err
+	}
+
+	s.hopMu.Lock()
+	defer s.hopMu.Unlock()
+
+	result, err := s.GetDiagnosticResult(diagnosticID)
+	if err != nil {
+		return fmt.Errorf("获取诊断结果失败: %w", err)
+	}
+	if hop < 0 || hop >= len(result.Results) {
+		return fmt.Errorf("无效的链路序号: %d", hop)
+	}
+
+	entry := result.Results[hop]
+	entry["status"] = "completed"
+	if !probeResult.Success {
+		entry["status"] = "failed"
+	}
+	entry["message"] = probeResult.Message
+	entry["summary"] = probeResult.Summary
+	if latency, ok := probeLatencyMs(probeResult); ok {
+		entry["latency_ms"] = latency
+	}
+
+	finalizeTunnelDiagnostic(result)
+	if err := s.saveDiagnosticResult(result); err != nil {
+		return fmt.Errorf("保存诊断结果失败: %w", err)
+	}
+	return nil
+}
+
+// parseHopProbeID 解析逐跳探测 ProbeID 中的链路序号
+func parseHopProbeID(probeID string) (int, error) {
+	_, hopStr, ok := strings.Cut(probeID, hopProbeSeparator)
+	if !ok {
+		return 0, fmt.Errorf("不是逐跳探测ID: %s", probeID)
+	}
+	hop, err := strconv.Atoi(hopStr)
+	if err != nil {
+		return 0, fmt.Errorf("无效的链路序号: %s", hopStr)
+	}
+	return hop, nil
+}
+
+// probeLatencyMs 从探测结果中提取平均延迟（毫秒）
+func probeLatencyMs(probeResult *protocol.ProbeResult) (float64, bool) {
+	for _, key := range []string{"avg_latency_ms", "avg_rtt_ms", "avg_latency", "avg_rtt", "latency_ms", "rtt_ms"} {
+		if value, ok := probeResult.Summary[key]; ok {
+			if latency, ok := toFloat(value); ok {
+				return latency, true
+			}
+		}
+	}
+
+	// 摘要中没有时按单次结果求平均
+	var total float64
+	var count int
+	for _, item := range probeResult.Results {
+		for _, key := range []string{"latency_ms", "rtt_ms"} {
+			if latency, ok := toFloat(item[key]); ok {
+				total += latency
+				count++
+				break
+			}
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return total / float64(count), true
+}
+
+// toFloat 将 JSON 数值转换为 float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// finalizeTunnelDiagnostic 所有链路均已返回时汇总状态和端到端延迟
+func finalizeTunnelDiagnostic(result *DiagnosticResult) {
+	var totalLatency, slowestLatency float64
+	slowestHop := -1
+	failed := 0
+	for i, entry := range result.Results {
+		status, _ := entry["status"].(string)
+		switch status {
+		case "pending":
+			return
+		case "failed", "skipped":
+			failed++
+		}
+		if latency, ok := toFloat(entry["latency_ms"]); ok {
+			totalLatency += latency
+			if latency > slowestLatency {
+				slowestLatency = latency
+				slowestHop = i
+			}
+		}
+	}
+
+	result.Status = "completed"
+	result.Message = "逐跳探测完成"
+	if failed > 0 {
+		result.Status = "failed"
+		result.Message = fmt.Sprintf("%d 段链路探测失败", failed)
+	}
+	result.EndTime = time.Now()
+	result.Duration = int(result.EndTime.Sub(result.StartTime).Milliseconds())
+	result.Summary["failed_hops"] = failed
+	result.Summary["total_latency_ms"] = totalLatency
+	if slowestHop >= 0 {
+		result.Summary["slowest_hop"] = slowestHop
+		result.Summary["slowest_latency_ms"] = slowestLatency
+	}
+}
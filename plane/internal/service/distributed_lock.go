@@ -61,6 +61,18 @@ func (dl *DistributedLock) Lock() error {
 	return fmt.Errorf("lock timeout")
 }
 
+// TryLock 只尝试一次获取锁，锁已被其他持有者占用时返回 false
+func (dl *DistributedLock) TryLock() (bool, error) {
+	return dl.redis.SetNX(dl.ctx, dl.key, dl.value, dl.expiration).Result()
+}
+
+// Refresh 续期自己持有的锁，锁已过期或已被其他持有者获取时返回 false
+func (dl *DistributedLock) Refresh() (bool, error) {
+	script := `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+	n, err := dl.redis.Eval(dl.ctx, script, []string{dl.key}, dl.value, dl.expiration.Milliseconds()).Int()
+	return n == 1, err
+}
+
 func (dl *DistributedLock) Unlock() error {
 	script := `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
 	_, err := dl.redis.Eval(dl.ctx, script, []string{dl.key}, dl.value).Result()
@@ -161,6 +161,71 @@ func (s *HealthService) HandleHealthReport(nodeID string, data []byte) error {
 	return nil
 }
 
+// ReportMonitoring 根据节点周期上报的监控数据更新健康状态
+// 系统资源超过阈值为降级；隧道错误率超过阈值为降级，超过两倍阈值为不健康
+func (s *HealthService) ReportMonitoring(nodeID string, data *NodeMonitoringReportData) {
+	now := time.Now()
+
+	system := NodeComponentHealth{
+		Name:        "system",
+		Status:      NodeHealthStatusHealthy,
+		LastChecked: now,
+		Details: map[string]interface{}{
+			"cpu_usage":    data.SystemInfo.CPUUsage,
+			"memory_usage": data.SystemInfo.MemoryUsagePercent,
+			"disk_usage":   data.SystemInfo.DiskUsagePercent,
+		},
+	}
+	if data.SystemInfo.CPUUsage > s.alertThresholds["cpu_usage"] ||
+		data.SystemInfo.MemoryUsagePercent > s.alertThresholds["memory_usage"] ||
+		data.SystemInfo.DiskUsagePercent > s.alertThresholds["disk_usage"] {
+		system.Status = NodeHealthStatusDegraded
+		system.Description = "系统资源使用率过高"
+	}
+
+	tunnel := NodeComponentHealth{
+		Name:        "tunnel",
+		Status:      NodeHealthStatusHealthy,
+		LastChecked: now,
+		Latency:     data.Performance.AvgResponseTime,
+		Details: map[string]interface{}{
+			"error_rate": data.Performance.ErrorRate,
+			"latency":    data.Performance.AvgResponseTime,
+		},
+	}
+	if threshold := s.alertThresholds["error_rate"]; data.Performance.ErrorRate > 2*threshold {
+		tunnel.Status = NodeHealthStatusUnhealthy
+		tunnel.Description = fmt.Sprintf("隧道错误率 %.2f%%", data.Performance.ErrorRate)
+	} else if data.Performance.ErrorRate > threshold {
+		tunnel.Status = NodeHealthStatusDegraded
+		tunnel.Description = fmt.Sprintf("隧道错误率 %.2f%%", data.Performance.ErrorRate)
+	}
+
+	// 整体状态取最差的组件
+	status := NodeHealthStatusHealthy
+	for _, component := range []NodeComponentHealth{system, tunnel} {
+		if component.Status == NodeHealthStatusUnhealthy ||
+			(component.Status == NodeHealthStatusDegraded && status == NodeHealthStatusHealthy) {
+			status = component.Status
+		}
+	}
+
+	report := &NodeHealthReport{
+		NodeID:       nodeID,
+		Status:       status,
+		Components:   map[string]NodeComponentHealth{"system": system, "tunnel": tunnel},
+		LastReported: now,
+		StartupTime:  data.AppInfo.StartTime,
+		Uptime:       float64(data.SystemInfo.Uptime),
+	}
+
+	s.mu.Lock()
+	s.nodeHealth[nodeID] = report
+	s.mu.Unlock()
+
+	s.handleStatusChange(nodeID, report)
+}
+
 // handleStatusChange 处理状态变化
 func (s *HealthService) handleStatusChange(nodeID string, report *NodeHealthReport) {
 	s.mu.Lock()
@@ -1,84 +1,307 @@
 package service
 
 import (
-	"sync"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
+
+	"gkipass/plane/internal/db/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// IncrementalSyncService 增量同步服务
+/* DefaultRuleChangeRetention 规则变更日志默认保留时长，更早的记录由清理服务压缩 */
+const DefaultRuleChangeRetention = 7 * 24 * time.Hour
+
+/*
+IncrementalSyncService 增量同步服务
+功能：维护持久化的规则变更日志（rule_changes）和节点同步状态（node_sync_states）：
+- 隧道变更按受影响的节点组记录，版本号全局单调递增且按事务提交顺序分配，面板重启不丢失
+- 节点确认已应用的版本，重连时只需拉取之后的变更
+- 日志被压缩到节点版本之后时由调用方回退为全量同步
+*/
 type IncrementalSyncService struct {
-	lastSync  map[string]time.Time
-	mu        sync.RWMutex
-	changeLog []ChangeRecord
-	changesMu sync.Mutex
+	db     *gorm.DB
+	logger *zap.Logger
 }
 
-// ChangeRecord 变更记录
-type ChangeRecord struct {
-	EntityType string // node, tunnel, settings
-	EntityID   string
-	Action     string // create, update, delete
-	Data       interface{}
-	Timestamp  time.Time
+/*
+NewIncrementalSyncService 创建增量同步服务
+*/
+func NewIncrementalSyncService(db *gorm.DB) *IncrementalSyncService {
+	return &IncrementalSyncService{
+		db:     db,
+		logger: zap.L().Named("incremental-sync"),
+	}
 }
 
-// NewIncrementalSyncService 创建增量同步服务
-func NewIncrementalSyncService() *IncrementalSyncService {
-	return &IncrementalSyncService{
-		lastSync:  make(map[string]time.Time),
-		changeLog: make([]ChangeRecord, 0),
+/*
+RecordChange 记录隧道变更
+功能：为每个受影响的节点组写入一条变更，返回最后写入的版本号；
+未指定节点组时不写入，返回当前版本。
+版本号在同一事务内从计数器行分配，计数器行锁持有到提交，
+并发变更按提交顺序获得连续版本，节点读到某版本时更小的版本都已可见
+*/
+func (s *IncrementalSyncService) RecordChange(tunnelID, action string, groupIDs ...string) (int64, error) {
+	groupIDs = uniqueGroupIDs(groupIDs)
+	if len(groupIDs) == 0 {
+		return s.CurrentVersion(), nil
+	}
+
+	var version int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		last, err := allocateVersions(tx, len(groupIDs))
+		if err != nil {
+			return err
+		}
+		version = last - int64(len(groupIDs))
+		for _, groupID := range groupIDs {
+			version++
+			change := &models.RuleChange{
+				Version:  version,
+				TunnelID: tunnelID,
+				GroupID:  groupID,
+				Action:   action,
+			}
+			if err := tx.Create(change).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("记录规则变更失败: %w", err)
 	}
+
+	s.logger.Debug("记录规则变更",
+		zap.String("tunnel_id", tunnelID),
+		zap.String("action", action),
+		zap.Strings("groups", groupIDs),
+		zap.Int64("version", version))
+
+	return version, nil
 }
 
-// RecordChange 记录变更
-func (iss *IncrementalSyncService) RecordChange(record ChangeRecord) {
-	iss.changesMu.Lock()
-	defer iss.changesMu.Unlock()
+/*
+allocateVersions 在事务内从计数器分配 n 个连续版本号，返回其中最大的一个
+功能：计数器行首次使用时以日志中已有的最大版本初始化（兼容升级前的自增版本），
+递增语句对计数器行加锁，其他事务的分配等待本事务提交或回滚
+*/
+func allocateVersions(tx *gorm.DB, n int) (int64, error) {
+	var existing int64
+	if err := tx.Model(&models.RuleChange{}).Select("COALESCE(MAX(version), 0)").Scan(&existing).Error; err != nil {
+		return 0, fmt.Errorf("查询变更日志版本失败: %w", err)
+	}
+	seq := &models.RuleChangeSequence{ID: 1, Version: existing}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(seq).Error; err != nil {
+		return 0, fmt.Errorf("初始化版本计数器失败: %w", err)
+	}
 
-	if record.Timestamp.IsZero() {
-		record.Timestamp = time.Now()
+	if err := tx.Model(&models.RuleChangeSequence{}).
+		Where("id = ?", 1).
+		UpdateColumn("version", gorm.Expr("version + ?", n)).Error; err != nil {
+		return 0, fmt.Errorf("分配变更版本失败: %w", err)
 	}
+	if err := tx.First(seq, "id = ?", 1).Error; err != nil {
+		return 0, fmt.Errorf("读取版本计数器失败: %w", err)
+	}
+	return seq.Version, nil
+}
 
-	iss.changeLog = append(iss.changeLog, record)
+/*
+CurrentVersion 获取当前最新版本号，日志为空时返回 0
+*/
+func (s *IncrementalSyncService) CurrentVersion() int64 {
+	var version int64
+	s.db.Model(&models.RuleChange{}).Select("COALESCE(MAX(version), 0)").Scan(&version)
+	return version
 }
 
-// GetChanges 获取变更（自上次同步以来）
-func (iss *IncrementalSyncService) GetChanges(nodeID string) []ChangeRecord {
-	iss.mu.RLock()
-	lastSync := iss.lastSync[nodeID]
-	iss.mu.RUnlock()
+/*
+TunnelVersion 获取隧道最近一次变更的版本号，日志中无记录时返回 0
+*/
+func (s *IncrementalSyncService) TunnelVersion(tunnelID string) int64 {
+	var version int64
+	s.db.Model(&models.RuleChange{}).
+		Where("tunnel_id = ?", tunnelID).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&version)
+	return version
+}
 
-	iss.changesMu.Lock()
-	defer iss.changesMu.Unlock()
+/*
+ChangesSince 获取指定节点组在 (since, until] 区间内的变更（按版本升序）
+功能：第二个返回值为 false 表示日志无法覆盖该区间（已被压缩或节点版本超前），
+调用方应回退为全量同步
+*/
+func (s *IncrementalSyncService) ChangesSince(groupIDs []string, since, until int64) ([]models.RuleChange, bool, error) {
+	var bounds struct {
+		Oldest int64
+		Newest int64
+	}
+	if err := s.db.Model(&models.RuleChange{}).
+		Select("COALESCE(MIN(version), 0) AS oldest, COALESCE(MAX(version), 0) AS newest").
+		Scan(&bounds).Error; err != nil {
+		return nil, false, fmt.Errorf("查询变更日志范围失败: %w", err)
+	}
 
-	changes := make([]ChangeRecord, 0)
-	for _, change := range iss.changeLog {
-		if change.Timestamp.After(lastSync) {
-			changes = append(changes, change)
-		}
+	/* 节点版本超前（面板数据库被重置）或 since 之后的记录已被压缩 */
+	if since > bounds.Newest || bounds.Oldest > since+1 {
+		return nil, false, nil
+	}
+	if len(groupIDs) == 0 || since >= until {
+		return nil, true, nil
 	}
 
-	// 更新最后同步时间
-	iss.mu.Lock()
-	iss.lastSync[nodeID] = time.Now()
-	iss.mu.Unlock()
+	var changes []models.RuleChange
+	if err := s.db.
+		Where("version > ? AND version <= ? AND group_id IN ?", since, until, groupIDs).
+		Order("version").
+		Find(&changes).Error; err != nil {
+		return nil, false, fmt.Errorf("查询规则变更失败: %w", err)
+	}
 
-	return changes
+	return changes, true, nil
 }
 
-// CleanupOldChanges 清理旧变更记录
-func (iss *IncrementalSyncService) CleanupOldChanges(retention time.Duration) {
-	iss.changesMu.Lock()
-	defer iss.changesMu.Unlock()
+/*
+GetNodeState 获取节点同步状态，节点从未同步过时返回 nil
+*/
+func (s *IncrementalSyncService) GetNodeState(nodeID string) *models.NodeSyncState {
+	var state models.NodeSyncState
+	if err := s.db.First(&state, "node_id = ?", nodeID).Error; err != nil {
+		return nil
+	}
+	return &state
+}
 
-	cutoff := time.Now().Add(-retention)
-	newLog := make([]ChangeRecord, 0)
+/*
+AckedVersion 获取节点已确认的版本号
+*/
+func (s *IncrementalSyncService) AckedVersion(nodeID string) int64 {
+	if state := s.GetNodeState(nodeID); state != nil {
+		return state.AckedVersion
+	}
+	return 0
+}
 
-	for _, change := range iss.changeLog {
-		if change.Timestamp.After(cutoff) {
-			newLog = append(newLog, change)
-		}
+/*
+Ack 记录节点确认的版本
+功能：版本只增不减，乱序到达的旧确认被忽略
+*/
+func (s *IncrementalSyncService) Ack(nodeID string, version int64) error {
+	if err := s.ensureNodeState(nodeID); err != nil {
+		return err
 	}
 
-	iss.changeLog = newLog
+	err := s.db.Model(&models.NodeSyncState{}).
+		Where("node_id = ? AND acked_version < ?", nodeID, version).
+		Updates(map[string]interface{}{
+			"acked_version": version,
+			"acked_at":      time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("更新节点同步版本失败: %w", err)
+	}
+	return nil
+}
+
+/*
+ResetAck 以节点自报的版本覆盖确认版本
+功能：节点重连注册时调用，节点重启后本地规则为空会上报 0
+*/
+func (s *IncrementalSyncService) ResetAck(nodeID string, version int64) error {
+	if err := s.ensureNodeState(nodeID); err != nil {
+		return err
+	}
+
+	err := s.db.Model(&models.NodeSyncState{}).
+		Where("node_id = ?", nodeID).
+		Updates(map[string]interface{}{
+			"acked_version": version,
+			"acked_at":      time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("重置节点同步版本失败: %w", err)
+	}
+	return nil
+}
+
+/*
+MarkFullSync 记录节点完成一次全量同步时所在的节点组
+*/
+func (s *IncrementalSyncService) MarkFullSync(nodeID string, groupIDs []string) error {
+	if err := s.ensureNodeState(nodeID); err != nil {
+		return err
+	}
+
+	return s.db.Model(&models.NodeSyncState{}).
+		Where("node_id = ?", nodeID).
+		Updates(map[string]interface{}{
+			"group_key":         GroupKey(groupIDs),
+			"last_full_sync_at": time.Now(),
+		}).Error
+}
+
+/*
+Compact 压缩规则变更日志
+功能：删除早于保留时长的记录，始终保留最新一条以维持版本号连续；
+确认版本落在被删除区间的节点重连时将回退为全量同步
+*/
+func (s *IncrementalSyncService) Compact(retention time.Duration) (int64, error) {
+	if retention <= 0 {
+		retention = DefaultRuleChangeRetention
+	}
+
+	newest := s.CurrentVersion()
+	if newest == 0 {
+		return 0, nil
+	}
+
+	result := s.db.
+		Where("created_at < ? AND version < ?", time.Now().Add(-retention), newest).
+		Delete(&models.RuleChange{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("压缩规则变更日志失败: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+/*
+ensureNodeState 节点同步状态不存在时创建
+*/
+func (s *IncrementalSyncService) ensureNodeState(nodeID string) error {
+	state := models.NodeSyncState{NodeID: nodeID}
+	if err := s.db.Where("node_id = ?", nodeID).FirstOrCreate(&state).Error; err != nil {
+		return fmt.Errorf("初始化节点同步状态失败: %w", err)
+	}
+	return nil
+}
+
+/*
+GroupKey 生成节点组集合的比较键（去重排序后逗号拼接）
+*/
+func GroupKey(groupIDs []string) string {
+	ids := uniqueGroupIDs(groupIDs)
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+/*
+uniqueGroupIDs 去除空值和重复的节点组 ID（保持原顺序）
+*/
+func uniqueGroupIDs(groupIDs []string) []string {
+	seen := make(map[string]bool, len(groupIDs))
+	result := make([]string, 0, len(groupIDs))
+	for _, id := range groupIDs {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
 }
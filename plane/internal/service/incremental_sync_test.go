@@ -0,0 +1,200 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/*
+setupJournalTestDB 创建规则变更日志测试专用的内存数据库
+*/
+func setupJournalTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+
+	if err := db.AutoMigrate(&models.RuleChange{}, &models.RuleChangeSequence{}, &models.NodeSyncState{}); err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+	return db
+}
+
+/*
+TestIncrementalSync_RecordAndChangesSince 测试按组记录变更并查询差异
+*/
+func TestIncrementalSync_RecordAndChangesSince(t *testing.T) {
+	svc := NewIncrementalSyncService(setupJournalTestDB(t))
+
+	if v := svc.CurrentVersion(); v != 0 {
+		t.Fatalf("空日志版本应为 0，实际 %d", v)
+	}
+
+	/* 重复和空的组 ID 被忽略 */
+	v1, err := svc.RecordChange("tunnel-1", models.RuleChangeUpsert, "group-a", "group-b", "group-a", "")
+	if err != nil {
+		t.Fatalf("记录变更失败: %v", err)
+	}
+	v2, _ := svc.RecordChange("tunnel-2", models.RuleChangeUpsert, "group-b")
+	v3, _ := svc.RecordChange("tunnel-1", models.RuleChangeDelete, "group-a")
+
+	if !(v1 < v2 && v2 < v3) {
+		t.Fatalf("版本号应单调递增: %d %d %d", v1, v2, v3)
+	}
+	if v := svc.CurrentVersion(); v != v3 {
+		t.Errorf("当前版本应为 %d，实际 %d", v3, v)
+	}
+	if v := svc.TunnelVersion("tunnel-1"); v != v3 {
+		t.Errorf("tunnel-1 版本应为 %d，实际 %d", v3, v)
+	}
+
+	changes, complete, err := svc.ChangesSince([]string{"group-a"}, 0, v3)
+	if err != nil || !complete {
+		t.Fatalf("查询差异失败: complete=%v err=%v", complete, err)
+	}
+	if len(changes) != 2 || changes[1].Action != models.RuleChangeDelete {
+		t.Errorf("group-a 应有 2 条变更且最后为删除，实际 %+v", changes)
+	}
+
+	changes, _, _ = svc.ChangesSince([]string{"group-b"}, v1, v3)
+	if len(changes) != 1 || changes[0].TunnelID != "tunnel-2" {
+		t.Errorf("group-b 在 v%d 之后应只有 tunnel-2，实际 %+v", v1, changes)
+	}
+
+	/* 节点版本超前当前日志，需全量同步 */
+	if _, complete, _ := svc.ChangesSince([]string{"group-a"}, v3+10, v3); complete {
+		t.Error("节点版本超前时应返回不完整")
+	}
+}
+
+/*
+TestIncrementalSync_Compact 测试压缩后回退全量同步的判定
+*/
+func TestIncrementalSync_Compact(t *testing.T) {
+	db := setupJournalTestDB(t)
+	svc := NewIncrementalSyncService(db)
+
+	v1, _ := svc.RecordChange("tunnel-1", models.RuleChangeUpsert, "group-a")
+	v2, _ := svc.RecordChange("tunnel-2", models.RuleChangeUpsert, "group-a")
+	v3, _ := svc.RecordChange("tunnel-3", models.RuleChangeUpsert, "group-a")
+
+	/* 将前两条标记为过期 */
+	db.Model(&models.RuleChange{}).Where("version <= ?", v2).
+		Update("created_at", time.Now().Add(-2*DefaultRuleChangeRetention))
+
+	removed, err := svc.Compact(DefaultRuleChangeRetention)
+	if err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("应删除 2 条，实际 %d", removed)
+	}
+
+	/* 确认到 v1 的节点缺少 v2，需回退全量；确认到 v2 的节点仍可增量 */
+	if _, complete, _ := svc.ChangesSince([]string{"group-a"}, v1, v3); complete {
+		t.Error("压缩区间内的版本应返回不完整")
+	}
+	changes, complete, _ := svc.ChangesSince([]string{"group-a"}, v2, v3)
+	if !complete || len(changes) != 1 {
+		t.Errorf("v%d 之后应可增量获取 1 条，complete=%v changes=%d", v2, complete, len(changes))
+	}
+
+	/* 最新一条即使过期也保留，维持版本号 */
+	db.Model(&models.RuleChange{}).Where("1 = 1").
+		Update("created_at", time.Now().Add(-2*DefaultRuleChangeRetention))
+	svc.Compact(DefaultRuleChangeRetention)
+	if v := svc.CurrentVersion(); v != v3 {
+		t.Errorf("压缩后当前版本应保持 %d，实际 %d", v3, v)
+	}
+}
+
+/*
+TestIncrementalSync_Ack 测试节点确认版本只增不减及注册时重置
+*/
+func TestIncrementalSync_Ack(t *testing.T) {
+	svc := NewIncrementalSyncService(setupJournalTestDB(t))
+
+	if v := svc.AckedVersion("node-1"); v != 0 {
+		t.Fatalf("未同步节点版本应为 0，实际 %d", v)
+	}
+
+	svc.Ack("node-1", 5)
+	svc.Ack("node-1", 3)
+	if v := svc.AckedVersion("node-1"); v != 5 {
+		t.Errorf("乱序确认不应回退版本，期望 5，实际 %d", v)
+	}
+
+	/* 节点重启后上报 0 */
+	svc.ResetAck("node-1", 0)
+	if v := svc.AckedVersion("node-1"); v != 0 {
+		t.Errorf("重置后版本应为 0，实际 %d", v)
+	}
+
+	if err := svc.MarkFullSync("node-1", []string{"group-b", "group-a", "group-b"}); err != nil {
+		t.Fatalf("记录全量同步失败: %v", err)
+	}
+	state := svc.GetNodeState("node-1")
+	if state == nil || state.GroupKey != "group-a,group-b" || state.LastFullSyncAt.IsZero() {
+		t.Errorf("全量同步状态不正确: %+v", state)
+	}
+}
+
+/*
+TestIncrementalSync_VersionCounter 测试版本号由计数器按事务分配：
+从升级前的自增版本继续、回滚的事务不留空洞，节点在任何已提交版本之后都能完整增量同步
+*/
+func TestIncrementalSync_VersionCounter(t *testing.T) {
+	db := setupJournalTestDB(t)
+	svc := NewIncrementalSyncService(db)
+
+	/* 升级前由自增主键写入的日志 */
+	for _, tunnelID := range []string{"tunnel-1", "tunnel-2"} {
+		db.Create(&models.RuleChange{TunnelID: tunnelID, GroupID: "group-a", Action: models.RuleChangeUpsert})
+	}
+	legacy := svc.CurrentVersion()
+
+	v1, err := svc.RecordChange("tunnel-3", models.RuleChangeUpsert, "group-a", "group-b")
+	if err != nil {
+		t.Fatalf("记录变更失败: %v", err)
+	}
+	if v1 != legacy+2 {
+		t.Fatalf("计数器应从已有最大版本 %d 继续分配，实际 %d", legacy, v1)
+	}
+
+	/* 分配后回滚的事务不占用版本号 */
+	db.Transaction(func(tx *gorm.DB) error {
+		if _, err := allocateVersions(tx, 3); err != nil {
+			t.Fatalf("分配版本失败: %v", err)
+		}
+		return gorm.ErrInvalidTransaction
+	})
+
+	v2, _ := svc.RecordChange("tunnel-4", models.RuleChangeDelete, "group-a")
+	if v2 != v1+1 {
+		t.Fatalf("回滚后版本应连续，期望 %d，实际 %d", v1+1, v2)
+	}
+
+	var versions []int64
+	db.Model(&models.RuleChange{}).Order("version").Pluck("version", &versions)
+	for i, v := range versions {
+		if v != int64(i+1) {
+			t.Fatalf("日志版本应连续无空洞，实际 %v", versions)
+		}
+	}
+
+	for since := int64(0); since < v2; since++ {
+		changes, complete, err := svc.ChangesSince([]string{"group-a", "group-b"}, since, v2)
+		if err != nil || !complete || int64(len(changes)) != v2-since {
+			t.Fatalf("v%d 之后应完整获取 %d 条变更，complete=%v changes=%d err=%v", since, v2-since, complete, len(changes), err)
+		}
+	}
+}
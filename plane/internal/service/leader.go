@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+/*
+LeaderElector 多实例主实例选举
+功能：多个面板实例共享 Redis 时，基于 LockManager 的分布式锁选出唯一主实例，
+清理（含订阅过期）、支付监听、告警检查等定时任务只在主实例执行，避免重复处理。
+
+选举策略：
+  - 主实例每 TTL/3 续期一次租约，续期失败（Redis 不可达或锁已被他人获取）立即放弃主身份
+  - 其他实例按同一间隔尝试抢锁，主实例宕机后最长一个 TTL 内完成接管
+  - 主实例正常退出时主动释放锁，其他实例在下一次尝试时即可接管
+
+nil 表示单实例部署，IsLeader 恒为 true，定时任务照常执行。
+*/
+type LeaderElector struct {
+	lock       *DistributedLock
+	instanceID string
+	interval   time.Duration
+	leader     atomic.Bool
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	logger   *zap.Logger
+}
+
+/*
+NewLeaderElector 创建主实例选举器
+功能：name 区分不同的选举（锁 key 为 lock:leader:<name>），ttl 为主实例租约时长，默认 15 秒
+*/
+func NewLeaderElector(locks *LockManager, name, instanceID string, ttl time.Duration) *LeaderElector {
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+	return &LeaderElector{
+		lock:       locks.NewLock(context.Background(), "leader:"+name, ttl),
+		instanceID: instanceID,
+		interval:   ttl / 3,
+		stopChan:   make(chan struct{}),
+		logger:     zap.L().Named("leader").With(zap.String("instance", instanceID)),
+	}
+}
+
+/*
+Start 启动选举
+功能：同步完成首次抢锁后再进入后台续期循环，调用返回时 IsLeader 已反映首轮结果
+*/
+func (e *LeaderElector) Start() {
+	e.campaign()
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				e.campaign()
+			case <-e.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+/*
+Stop 停止选举
+功能：停止续期循环，当前为主实例时释放锁以便其他实例尽快接管
+*/
+func (e *LeaderElector) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopChan)
+		e.wg.Wait()
+
+		if e.leader.Swap(false) {
+			if err := e.lock.Unlock(); err != nil {
+				e.logger.Warn("释放主实例锁失败", zap.Error(err))
+			} else {
+				e.logger.Info("已释放主实例身份")
+			}
+		}
+	})
+}
+
+/* IsLeader 当前实例是否为主实例，nil（单实例部署）时恒为 true */
+func (e *LeaderElector) IsLeader() bool {
+	if e == nil {
+		return true
+	}
+	return e.leader.Load()
+}
+
+/* InstanceID 返回当前实例 ID */
+func (e *LeaderElector) InstanceID() string {
+	if e == nil {
+		return ""
+	}
+	return e.instanceID
+}
+
+/* campaign 主实例续期租约，非主实例尝试抢锁 */
+func (e *LeaderElector) campaign() {
+	if e.leader.Load() {
+		ok, err := e.lock.Refresh()
+		if err != nil || !ok {
+			e.leader.Store(false)
+			e.logger.Warn("主实例租约续期失败，放弃主身份", zap.Bool("lockLost", err == nil), zap.Error(err))
+		}
+		return
+	}
+
+	ok, err := e.lock.TryLock()
+	if err != nil {
+		e.logger.Debug("竞选主实例失败", zap.Error(err))
+		return
+	}
+	if ok {
+		e.leader.Store(true)
+		e.logger.Info("当选主实例，开始执行定时任务")
+	}
+}
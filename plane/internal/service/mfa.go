@@ -0,0 +1,861 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"gkipass/plane/internal/config"
+	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/pkg/webauthn"
+)
+
+const (
+	totpDigits = 6
+	totpPeriod = 30 /* 秒 */
+	totpSkew   = 1  /* 允许前后各 1 个时间步的时钟误差 */
+
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 5 /* 10 位十六进制，显示为 xxxxx-xxxxx */
+
+	mfaMaxFailures  = 5
+	mfaLockDuration = 15 * time.Minute
+
+	webAuthnChallengeTTL       = 5 * time.Minute
+	webAuthnChallengeKeyPrefix = "mfa:webauthn:"
+)
+
+/* WebAuthn 挑战用途，完成时必须与发起时一致 */
+const (
+	webAuthnPurposeRegister = "register"
+	webAuthnPurposeLogin    = "login"
+)
+
+/* MFA 方式 */
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+	MFAMethodRecovery = "recovery"
+)
+
+var (
+	ErrMFALocked      = errors.New("两步验证失败次数过多，请稍后再试")
+	ErrMFAInvalidCode = errors.New("验证码无效")
+)
+
+/*
+MFAService 两步验证服务
+功能：TOTP（RFC 6238）绑定与校验、一次性恢复码、WebAuthn 凭据注册与认证，
+连续失败 5 次锁定 15 分钟；第一次启用第二因素时生成恢复码
+*/
+type MFAService struct {
+	db     *gorm.DB
+	rdb    *redis.Client
+	cfg    config.MFAConfig
+	logger *zap.Logger
+	now    func() time.Time
+
+	/* 未配置 Redis 时的一次性 WebAuthn 挑战 */
+	mu         sync.Mutex
+	challenges map[string]mfaMemoryChallenge
+}
+
+/* webAuthnChallenge 服务端保存的一次性 WebAuthn 挑战，完成注册/登录时取出并删除 */
+type webAuthnChallenge struct {
+	UserID    string `json:"user_id"`
+	Purpose   string `json:"purpose"`
+	Challenge []byte `json:"challenge"`
+}
+
+type mfaMemoryChallenge struct {
+	data     []byte
+	expireAt time.Time
+}
+
+/*
+NewMFAService 创建两步验证服务
+*/
+func NewMFAService(db *gorm.DB, cfg config.MFAConfig) *MFAService {
+	if cfg.Issuer == "" {
+		cfg.Issuer = "GKIPass"
+	}
+	if cfg.WebAuthnRPName == "" {
+		cfg.WebAuthnRPName = cfg.Issuer
+	}
+	return &MFAService{
+		db:         db,
+		cfg:        cfg,
+		logger:     zap.L().Named("mfa-service"),
+		now:        time.Now,
+		challenges: make(map[string]mfaMemoryChallenge),
+	}
+}
+
+/*
+SetRedis 设置保存 WebAuthn 挑战的 Redis
+功能：多实例部署时发起与完成可能落在不同实例，未设置时挑战只保存在本实例内存中
+*/
+func (s *MFAService) SetRedis(rdb *redis.Client) {
+	s.rdb = rdb
+}
+
+/*
+MFAStatus 用户两步验证状态
+*/
+type MFAStatus struct {
+	TOTPEnabled            bool                        `json:"totp_enabled"`
+	WebAuthnCredentials    []models.WebAuthnCredential `json:"webauthn_credentials"`
+	RecoveryCodesRemaining int64                       `json:"recovery_codes_remaining"`
+	LockedUntil            *time.Time                  `json:"locked_until,omitempty"`
+}
+
+/* ==================== TOTP ==================== */
+
+/*
+GenerateTOTPSecret 生成 160 位随机 TOTP 密钥（base32，无填充）
+*/
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成 TOTP 密钥失败: %w", err)
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+/*
+TOTPCode 计算指定时间步的 TOTP 验证码（HMAC-SHA1，6 位）
+*/
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("无效的 TOTP 密钥: %w", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+/* totpStep 当前时间步 */
+func (s *MFAService) totpStep() int64 {
+	return s.now().Unix() / totpPeriod
+}
+
+/*
+TOTPURI 生成验证器 App 扫码用的 otpauth:// 地址
+*/
+func (s *MFAService) TOTPURI(username, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", s.cfg.Issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(s.cfg.Issuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+/*
+SetupTOTP 开始绑定 TOTP
+功能：生成新密钥保存为待确认状态，已启用时需先关闭；返回密钥和 otpauth 地址
+*/
+func (s *MFAService) SetupTOTP(user *models.User) (string, string, error) {
+	if user.TOTPEnabled {
+		return "", "", fmt.Errorf("已启用 TOTP，请先关闭后再重新绑定")
+	}
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.db.Model(&models.User{}).Where("id = ? AND totp_enabled = ?", user.ID, false).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		return "", "", fmt.Errorf("保存 TOTP 密钥失败: %w", err)
+	}
+	return secret, s.TOTPURI(user.Username, secret), nil
+}
+
+/*
+ConfirmTOTP 用验证码确认绑定并启用 TOTP
+功能：确认成功后若用户没有可用恢复码则生成一组并返回明文（只返回这一次）
+*/
+func (s *MFAService) ConfirmTOTP(userID, code string) ([]string, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("TOTP 已启用")
+	}
+	if user.TOTPSecret == "" {
+		return nil, fmt.Errorf("请先获取 TOTP 密钥")
+	}
+	if err := s.verify(user, func() (bool, error) { return s.checkTOTP(user, code) }); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		codes, err = s.ensureRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("启用 TOTP 失败: %w", err)
+	}
+	s.logger.Info("用户已启用 TOTP", zap.String("userID", userID))
+	return codes, nil
+}
+
+/*
+DisableTOTP 校验当前验证码后关闭 TOTP
+功能：关闭后没有任何第二因素时一并删除恢复码
+*/
+func (s *MFAService) DisableTOTP(userID, code string) error {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return fmt.Errorf("未启用 TOTP")
+	}
+	if err := s.Verify(userID, MFAMethodTOTP, code); err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return s.dropOrphanRecoveryCodes(tx, userID)
+	})
+	if err != nil {
+		return fmt.Errorf("关闭 TOTP 失败: %w", err)
+	}
+	s.logger.Info("用户已关闭 TOTP", zap.String("userID", userID))
+	return nil
+}
+
+/*
+checkTOTP 校验 TOTP 验证码
+功能：接受当前及前后各 1 个时间步，时间步必须大于上次通过的时间步（防重放），
+以条件更新保证同一验证码并发提交只有一次成功
+*/
+func (s *MFAService) checkTOTP(user *models.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits || user.TOTPSecret == "" {
+		return false, nil
+	}
+	current := s.totpStep()
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= user.TOTPLastStep {
+			continue
+		}
+		expected, err := TOTPCode(user.TOTPSecret, step)
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+		result := s.db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected == 1, nil
+	}
+	return false, nil
+}
+
+/* ==================== 恢复码 ==================== */
+
+/* normalizeRecoveryCode 忽略大小写、空格和连字符 */
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+/* generateRecoveryCodes 替换用户的全部恢复码，返回明文 */
+func (s *MFAService) generateRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.UserRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.UserRecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("生成恢复码失败: %w", err)
+		}
+		raw := hex.EncodeToString(b)
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+
+		row := models.UserRecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)}
+		row.ID = uuid.New().String()
+		rows = append(rows, row)
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+/* ensureRecoveryCodes 没有可用恢复码时生成一组，已有时返回 nil */
+func (s *MFAService) ensureRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	var remaining int64
+	if err := tx.Model(&models.UserRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).Count(&remaining).Error; err != nil {
+		return nil, err
+	}
+	if remaining > 0 {
+		return nil, nil
+	}
+	return s.generateRecoveryCodes(tx, userID)
+}
+
+/* dropOrphanRecoveryCodes 用户不再有任何第二因素时删除恢复码 */
+func (s *MFAService) dropOrphanRecoveryCodes(tx *gorm.DB, userID string) error {
+	var user models.User
+	if err := tx.Select("totp_enabled").First(&user, "id = ?", userID).Error; err != nil {
+		return err
+	}
+	var credentials int64
+	if err := tx.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&credentials).Error; err != nil {
+		return err
+	}
+	if user.TOTPEnabled || credentials > 0 {
+		return nil
+	}
+	return tx.Unscoped().Where("user_id = ?", userID).Delete(&models.UserRecoveryCode{}).Error
+}
+
+/*
+RegenerateRecoveryCodes 重新生成恢复码，旧码全部作废
+*/
+func (s *MFAService) RegenerateRecoveryCodes(userID string) ([]string, error) {
+	enabled, err := s.HasMFA(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, fmt.Errorf("未启用两步验证")
+	}
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		codes, err = s.generateRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("生成恢复码失败: %w", err)
+	}
+	return codes, nil
+}
+
+/* useRecoveryCode 核销一个恢复码，条件更新保证只能使用一次 */
+func (s *MFAService) useRecoveryCode(userID, code string) (bool, error) {
+	if normalizeRecoveryCode(code) == "" {
+		return false, nil
+	}
+	result := s.db.Model(&models.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", s.now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		s.logger.Info("用户使用了恢复码", zap.String("userID", userID))
+	}
+	return result.RowsAffected == 1, nil
+}
+
+/* ==================== 校验与锁定 ==================== */
+
+/*
+Verify 校验第二因素（TOTP 或恢复码）
+功能：锁定期间直接拒绝；失败计数达到上限后锁定，成功后清零
+*/
+func (s *MFAService) Verify(userID, method, code string) error {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return err
+	}
+	return s.verify(user, func() (bool, error) {
+		switch method {
+		case MFAMethodTOTP:
+			if !user.TOTPEnabled {
+				return false, nil
+			}
+			return s.checkTOTP(user, code)
+		case MFAMethodRecovery:
+			return s.useRecoveryCode(user.ID, code)
+		default:
+			return false, fmt.Errorf("不支持的验证方式: %s", method)
+		}
+	})
+}
+
+/* verify 在锁定检查和失败计数中执行一次校验 */
+func (s *MFAService) verify(user *models.User, check func() (bool, error)) error {
+	if user.MFALockedUntil != nil && s.now().Before(*user.MFALockedUntil) {
+		return ErrMFALocked
+	}
+	ok, err := check()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return s.recordFailure(user.ID)
+	}
+	if user.MFAFailures > 0 || user.MFALockedUntil != nil {
+		s.db.Model(&models.User{}).Where("id = ?", user.ID).
+			Updates(map[string]interface{}{"mfa_failures": 0, "mfa_locked_until": nil})
+	}
+	return nil
+}
+
+/* recordFailure 累加失败次数，达到上限时锁定并清零计数；返回应告知调用方的错误 */
+func (s *MFAService) recordFailure(userID string) error {
+	if err := s.db.Model(&models.User{}).Where("id = ?", userID).
+		Update("mfa_failures", gorm.Expr("mfa_failures + 1")).Error; err != nil {
+		return err
+	}
+	var user models.User
+	if err := s.db.Select("mfa_failures").First(&user, "id = ?", userID).Error; err != nil {
+		return err
+	}
+	if user.MFAFailures < mfaMaxFailures {
+		return ErrMFAInvalidCode
+	}
+	s.db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"mfa_failures":     0,
+		"mfa_locked_until": s.now().Add(mfaLockDuration),
+	})
+	s.logger.Warn("两步验证连续失败，账户已临时锁定",
+		zap.String("userID", userID),
+		zap.Duration("duration", mfaLockDuration))
+	return ErrMFALocked
+}
+
+/* ==================== WebAuthn ==================== */
+
+/*
+RelyingParty 返回 WebAuthn 依赖方
+功能：RP 只由配置构建：允许的来源取 auth.mfa.webauthn_origins（仅配置 RP ID 时为 https://<RP ID>），
+RP ID 未配置时取第一个来源的主机名；请求的 Origin 必须在允许列表中，不会按请求头推导 RP
+*/
+func (s *MFAService) RelyingParty(origin string) (*webauthn.RelyingParty, error) {
+	origins := s.cfg.WebAuthnOrigins
+	if len(origins) == 0 && s.cfg.WebAuthnRPID != "" {
+		origins = []string{"https://" + s.cfg.WebAuthnRPID}
+	}
+	if len(origins) == 0 {
+		return nil, errors.New("未配置 WebAuthn，请配置 auth.mfa.webauthn_rp_id 或 auth.mfa.webauthn_origins")
+	}
+
+	rpID := s.cfg.WebAuthnRPID
+	if rpID == "" {
+		u, err := url.Parse(origins[0])
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("WebAuthn 来源配置无效: %s", origins[0])
+		}
+		rpID = u.Hostname()
+	}
+
+	allowed := false
+	for _, o := range origins {
+		allowed = allowed || strings.EqualFold(strings.TrimRight(o, "/"), origin)
+	}
+	if !allowed {
+		return nil, fmt.Errorf("请求来源 %q 不在 WebAuthn 允许的来源中", origin)
+	}
+	return &webauthn.RelyingParty{ID: rpID, Name: s.cfg.WebAuthnRPName, Origins: origins}, nil
+}
+
+/* putChallenge 保存一次性挑战，返回挑战 ID（写入临时令牌） */
+func (s *MFAService) putChallenge(ctx context.Context, userID, purpose string, challenge []byte) (string, error) {
+	key, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+	id := webauthn.EncodeBase64URL(key)
+	data, err := json.Marshal(&webAuthnChallenge{UserID: userID, Purpose: purpose, Challenge: challenge})
+	if err != nil {
+		return "", err
+	}
+	if s.rdb != nil {
+		if err := s.rdb.Set(ctx, webAuthnChallengeKeyPrefix+id, data, webAuthnChallengeTTL).Err(); err != nil {
+			return "", fmt.Errorf("保存 WebAuthn 挑战失败: %w", err)
+		}
+		return id, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for k, v := range s.challenges {
+		if now.After(v.expireAt) {
+			delete(s.challenges, k)
+		}
+	}
+	s.challenges[id] = mfaMemoryChallenge{data: data, expireAt: now.Add(webAuthnChallengeTTL)}
+	return id, nil
+}
+
+/* takeChallenge 取出并删除挑战，用户或用途不符时同样作废，保证每个挑战只能使用一次 */
+func (s *MFAService) takeChallenge(ctx context.Context, id, userID, purpose string) ([]byte, error) {
+	var data []byte
+	if s.rdb != nil {
+		raw, err := s.rdb.GetDel(ctx, webAuthnChallengeKeyPrefix+id).Bytes()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		data = raw
+	} else {
+		s.mu.Lock()
+		entry, ok := s.challenges[id]
+		delete(s.challenges, id)
+		s.mu.Unlock()
+		if ok && s.now().Before(entry.expireAt) {
+			data = entry.data
+		}
+	}
+
+	var stored webAuthnChallenge
+	if len(data) == 0 || json.Unmarshal(data, &stored) != nil ||
+		stored.UserID != userID || stored.Purpose != purpose || len(stored.Challenge) == 0 {
+		return nil, errors.New("WebAuthn 挑战无效或已使用，请重新发起")
+	}
+	return stored.Challenge, nil
+}
+
+/* credentialIDs 返回用户全部凭据 ID（原始字节） */
+func (s *MFAService) credentialIDs(userID string) ([][]byte, error) {
+	var creds []models.WebAuthnCredential
+	if err := s.db.Select("credential_id").Where("user_id = ?", userID).Find(&creds).Error; err != nil {
+		return nil, err
+	}
+	ids := make([][]byte, 0, len(creds))
+	for _, c := range creds {
+		if id, err := webauthn.DecodeBase64URL(c.CredentialID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+/*
+BeginWebAuthnRegistration 生成注册选项，挑战保存在服务端
+功能：返回挑战 ID；已注册的凭据放入 excludeCredentials，避免同一认证器重复注册
+*/
+func (s *MFAService) BeginWebAuthnRegistration(ctx context.Context, rp *webauthn.RelyingParty, user *models.User) (*webauthn.CreationOptions, string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, "", err
+	}
+	exclude, err := s.credentialIDs(user.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("查询已有凭据失败: %w", err)
+	}
+	id, err := s.putChallenge(ctx, user.ID, webAuthnPurposeRegister, challenge)
+	if err != nil {
+		return nil, "", err
+	}
+	return rp.NewCreationOptions(challenge, []byte(user.ID), user.Username, user.Username, exclude), id, nil
+}
+
+/*
+FinishWebAuthnRegistration 校验注册结果并保存凭据
+功能：取出并作废 challengeID 对应的挑战；这是用户的第一个第二因素时生成恢复码并返回
+*/
+func (s *MFAService) FinishWebAuthnRegistration(ctx context.Context, rp *webauthn.RelyingParty, userID, name, challengeID string, clientDataJSON, attestationObject []byte) (*models.WebAuthnCredential, []string, error) {
+	challenge, err := s.takeChallenge(ctx, challengeID, userID, webAuthnPurposeRegister)
+	if err != nil {
+		return nil, nil, err
+	}
+	cred, err := rp.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		return nil, nil, fmt.Errorf("WebAuthn 注册校验失败: %w", err)
+	}
+	if name == "" {
+		name = "通行密钥"
+	}
+	record := &models.WebAuthnCredential{
+		UserID:       userID,
+		Name:         name,
+		CredentialID: webauthn.EncodeBase64URL(cred.ID),
+		PublicKey:    base64.StdEncoding.EncodeToString(cred.PublicKey),
+		Algorithm:    cred.Algorithm,
+		SignCount:    cred.SignCount,
+	}
+	record.ID = uuid.New().String()
+	if len(cred.AAGUID) == 16 {
+		if id, err := uuid.FromBytes(cred.AAGUID); err == nil {
+			record.AAGUID = id.String()
+		}
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var exists int64
+		if err := tx.Unscoped().Model(&models.WebAuthnCredential{}).
+			Where("credential_id = ?", record.CredentialID).Count(&exists).Error; err != nil {
+			return err
+		}
+		if exists > 0 {
+			return fmt.Errorf("该凭据已注册")
+		}
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		codes, err = s.ensureRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("保存 WebAuthn 凭据失败: %w", err)
+	}
+	s.logger.Info("用户已注册 WebAuthn 凭据",
+		zap.String("userID", userID),
+		zap.String("credentialID", record.ID))
+	return record, codes, nil
+}
+
+/*
+BeginWebAuthnLogin 生成登录认证选项，挑战保存在服务端并返回挑战 ID，用户没有凭据时返回错误
+*/
+func (s *MFAService) BeginWebAuthnLogin(ctx context.Context, rp *webauthn.RelyingParty, userID string) (*webauthn.RequestOptions, string, error) {
+	allow, err := s.credentialIDs(userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("查询凭据失败: %w", err)
+	}
+	if len(allow) == 0 {
+		return nil, "", fmt.Errorf("未注册 WebAuthn 凭据")
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := s.putChallenge(ctx, userID, webAuthnPurposeLogin, challenge)
+	if err != nil {
+		return nil, "", err
+	}
+	return rp.NewRequestOptions(challenge, allow), id, nil
+}
+
+/*
+FinishWebAuthnLogin 校验登录认证结果
+功能：取出并作废 challengeID 对应的挑战，重放同一认证结果会被拒绝；
+凭据必须属于该用户；校验失败计入失败次数，成功后保存新的签名计数
+*/
+func (s *MFAService) FinishWebAuthnLogin(ctx context.Context, rp *webauthn.RelyingParty, userID, challengeID, credentialID string, clientDataJSON, authData, signature []byte) error {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return err
+	}
+	challenge, err := s.takeChallenge(ctx, challengeID, userID, webAuthnPurposeLogin)
+	if err != nil {
+		return err
+	}
+	return s.verify(user, func() (bool, error) {
+		var record models.WebAuthnCredential
+		if err := s.db.Where("user_id = ? AND credential_id = ?", userID, credentialID).First(&record).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		publicKey, err := base64.StdEncoding.DecodeString(record.PublicKey)
+		if err != nil {
+			return false, fmt.Errorf("凭据公钥损坏: %w", err)
+		}
+		count, err := rp.VerifyAssertion(&webauthn.Credential{
+			PublicKey: publicKey,
+			Algorithm: record.Algorithm,
+			SignCount: record.SignCount,
+		}, challenge, clientDataJSON, authData, signature)
+		if err != nil {
+			s.logger.Warn("WebAuthn 认证校验失败",
+				zap.String("userID", userID),
+				zap.String("credentialID", record.ID),
+				zap.Error(err))
+			return false, nil
+		}
+		s.db.Model(&record).Updates(map[string]interface{}{"sign_count": count, "last_used_at": s.now()})
+		return true, nil
+	})
+}
+
+/*
+DeleteWebAuthnCredential 删除用户自己的 WebAuthn 凭据
+*/
+func (s *MFAService) DeleteWebAuthnCredential(userID, id string) (*models.WebAuthnCredential, error) {
+	var record models.WebAuthnCredential
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("凭据不存在")
+		}
+		return nil, err
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(&record).Error; err != nil {
+			return err
+		}
+		return s.dropOrphanRecoveryCodes(tx, userID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("删除凭据失败: %w", err)
+	}
+	return &record, nil
+}
+
+/* ==================== 状态与策略 ==================== */
+
+/*
+HasMFA 用户是否已启用任一第二因素
+*/
+func (s *MFAService) HasMFA(userID string) (bool, error) {
+	methods, err := s.Methods(userID)
+	return len(methods) > 0, err
+}
+
+/*
+Methods 返回用户可用的第二因素，未启用时为空；启用后恢复码始终可作为备用方式
+*/
+func (s *MFAService) Methods(userID string) ([]string, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	var credentials int64
+	if err := s.db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&credentials).Error; err != nil {
+		return nil, err
+	}
+	var methods []string
+	if user.TOTPEnabled {
+		methods = append(methods, MFAMethodTOTP)
+	}
+	if credentials > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	if len(methods) > 0 {
+		methods = append(methods, MFAMethodRecovery)
+	}
+	return methods, nil
+}
+
+/*
+Status 查询用户两步验证状态
+*/
+func (s *MFAService) Status(userID string) (*MFAStatus, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{TOTPEnabled: user.TOTPEnabled, WebAuthnCredentials: []models.WebAuthnCredential{}}
+	if user.MFALockedUntil != nil && s.now().Before(*user.MFALockedUntil) {
+		status.LockedUntil = user.MFALockedUntil
+	}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&status.WebAuthnCredentials).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&models.UserRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).Count(&status.RecoveryCodesRemaining).Error; err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+/*
+Reset 清除用户全部第二因素和锁定状态（管理员为丢失验证器的用户操作）
+*/
+func (s *MFAService) Reset(userID string) error {
+	if _, err := s.getUser(userID); err != nil {
+		return err
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_enabled":     false,
+			"totp_secret":      "",
+			"totp_last_step":   0,
+			"mfa_failures":     0,
+			"mfa_locked_until": nil,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.WebAuthnCredential{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", userID).Delete(&models.UserRecoveryCode{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("重置两步验证失败: %w", err)
+	}
+	s.logger.Warn("用户两步验证已被重置", zap.String("userID", userID))
+	return nil
+}
+
+/*
+AdminMFARequired 安全设置是否要求管理员启用两步验证
+*/
+func (s *MFAService) AdminMFARequired() bool {
+	var setting models.SystemSetting
+	if err := s.db.Where(&models.SystemSetting{Key: "security"}).First(&setting).Error; err != nil {
+		return false
+	}
+	var security struct {
+		RequireAdmin2FA bool `json:"require_admin_2fa"`
+	}
+	if err := json.Unmarshal([]byte(setting.Value), &security); err != nil {
+		s.logger.Warn("解析安全设置失败", zap.Error(err))
+		return false
+	}
+	return security.RequireAdmin2FA
+}
+
+func (s *MFAService) getUser(userID string) (*models.User, error) {
+	var user models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("用户不存在")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
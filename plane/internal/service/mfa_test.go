@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gkipass/plane/internal/config"
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/* setupMFATest 创建两步验证测试环境：一个用户，时钟可由测试控制 */
+func setupMFATest(t *testing.T) (*gorm.DB, *MFAService, *models.User, *time.Time) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.UserRecoveryCode{}, &models.WebAuthnCredential{}, &models.SystemSetting{}); err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", Password: "x", Role: models.RoleAdmin, Enabled: true}
+	user.ID = "user-1"
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	svc := NewMFAService(db, config.MFAConfig{})
+	svc.now = func() time.Time { return now }
+	return db, svc, user, &now
+}
+
+/* enableTOTP 绑定并启用 TOTP，返回密钥和恢复码 */
+func enableTOTP(t *testing.T, svc *MFAService, user *models.User) (string, []string) {
+	t.Helper()
+	secret, uri, err := svc.SetupTOTP(user)
+	if err != nil {
+		t.Fatalf("生成 TOTP 密钥失败: %v", err)
+	}
+	if uri == "" {
+		t.Fatalf("应返回 otpauth 地址")
+	}
+	code, _ := TOTPCode(secret, svc.totpStep())
+	codes, err := svc.ConfirmTOTP(user.ID, code)
+	if err != nil {
+		t.Fatalf("确认 TOTP 失败: %v", err)
+	}
+	return secret, codes
+}
+
+/* TestTOTPCode_RFC6238 RFC 6238 附录 B 的 SHA1 测试向量（取后 6 位） */
+func TestTOTPCode_RFC6238(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" /* "12345678901234567890" */
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tc := range cases {
+		got, err := TOTPCode(secret, tc.unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("计算验证码失败: %v", err)
+		}
+		if got != tc.want {
+			t.Errorf("时间 %d 的验证码应为 %s，实际 %s", tc.unix, tc.want, got)
+		}
+	}
+}
+
+/* TestMFA_TOTPEnrollAndReplay 启用后生成恢复码，同一验证码不能重复使用，时钟误差一步内可接受 */
+func TestMFA_TOTPEnrollAndReplay(t *testing.T) {
+	_, svc, user, now := setupMFATest(t)
+
+	secret, codes := enableTOTP(t, svc, user)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("启用 TOTP 时应生成 %d 个恢复码，实际 %d", recoveryCodeCount, len(codes))
+	}
+	if methods, _ := svc.Methods(user.ID); len(methods) != 2 || methods[0] != MFAMethodTOTP || methods[1] != MFAMethodRecovery {
+		t.Errorf("可用方式应为 totp、recovery，实际 %v", methods)
+	}
+
+	/* 确认时使用的验证码不能再次用于登录 */
+	used, _ := TOTPCode(secret, svc.totpStep())
+	if err := svc.Verify(user.ID, MFAMethodTOTP, used); !errors.Is(err, ErrMFAInvalidCode) {
+		t.Errorf("重放验证码应失败，实际 %v", err)
+	}
+
+	*now = now.Add(totpPeriod * time.Second)
+	next, _ := TOTPCode(secret, svc.totpStep()+1)
+	if err := svc.Verify(user.ID, MFAMethodTOTP, next); err != nil {
+		t.Errorf("下一时间步的验证码应在误差范围内通过: %v", err)
+	}
+	/* 已接受更晚的时间步后，当前时间步的验证码也视为过期 */
+	current, _ := TOTPCode(secret, svc.totpStep())
+	if err := svc.Verify(user.ID, MFAMethodTOTP, current); err == nil {
+		t.Errorf("早于上次通过时间步的验证码应失败")
+	}
+
+	if _, _, err := svc.SetupTOTP(&models.User{BaseModel: user.BaseModel, TOTPEnabled: true}); err == nil {
+		t.Errorf("已启用 TOTP 时重新绑定应失败")
+	}
+
+	*now = now.Add(2 * totpPeriod * time.Second)
+	code, _ := TOTPCode(secret, svc.totpStep())
+	if err := svc.DisableTOTP(user.ID, code); err != nil {
+		t.Fatalf("关闭 TOTP 失败: %v", err)
+	}
+	status, _ := svc.Status(user.ID)
+	if status.TOTPEnabled || status.RecoveryCodesRemaining != 0 {
+		t.Errorf("关闭最后一个第二因素后应删除恢复码: %+v", status)
+	}
+}
+
+/* TestMFA_RecoveryCodesAndLockout 恢复码只能使用一次，连续失败后锁定，到期后解锁 */
+func TestMFA_RecoveryCodesAndLockout(t *testing.T) {
+	_, svc, user, now := setupMFATest(t)
+	secret, codes := enableTOTP(t, svc, user)
+
+	if err := svc.Verify(user.ID, MFAMethodRecovery, "  "+codes[0][:5]+" "+codes[0][6:]+" "); err != nil {
+		t.Fatalf("恢复码应忽略空格和连字符: %v", err)
+	}
+	if err := svc.Verify(user.ID, MFAMethodRecovery, codes[0]); err == nil {
+		t.Errorf("恢复码只能使用一次")
+	}
+	if status, _ := svc.Status(user.ID); status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Errorf("剩余恢复码应为 %d，实际 %d", recoveryCodeCount-1, status.RecoveryCodesRemaining)
+	}
+
+	/* 上面已失败 1 次，再失败 4 次触发锁定 */
+	var err error
+	for i := 0; i < mfaMaxFailures-1; i++ {
+		err = svc.Verify(user.ID, MFAMethodTOTP, "000000")
+	}
+	if !errors.Is(err, ErrMFALocked) {
+		t.Fatalf("连续失败 %d 次后应锁定，实际 %v", mfaMaxFailures, err)
+	}
+	*now = now.Add(totpPeriod * time.Second)
+	code, _ := TOTPCode(secret, svc.totpStep())
+	if err := svc.Verify(user.ID, MFAMethodTOTP, code); !errors.Is(err, ErrMFALocked) {
+		t.Errorf("锁定期间正确的验证码也应被拒绝，实际 %v", err)
+	}
+
+	*now = now.Add(mfaLockDuration)
+	code, _ = TOTPCode(secret, svc.totpStep())
+	if err := svc.Verify(user.ID, MFAMethodTOTP, code); err != nil {
+		t.Errorf("锁定到期后应可正常验证: %v", err)
+	}
+
+	regenerated, err := svc.RegenerateRecoveryCodes(user.ID)
+	if err != nil || len(regenerated) != recoveryCodeCount {
+		t.Fatalf("重新生成恢复码失败: %v", err)
+	}
+	if err := svc.Verify(user.ID, MFAMethodRecovery, codes[1]); err == nil {
+		t.Errorf("重新生成后旧恢复码应作废")
+	}
+
+	if err := svc.Reset(user.ID); err != nil {
+		t.Fatalf("重置两步验证失败: %v", err)
+	}
+	if enabled, _ := svc.HasMFA(user.ID); enabled {
+		t.Errorf("重置后不应再有第二因素")
+	}
+}
+
+/* TestMFA_RelyingPartyOriginAllowList WebAuthn 依赖方只由配置构建，请求来源必须在允许列表中 */
+func TestMFA_RelyingPartyOriginAllowList(t *testing.T) {
+	_, svc, _, _ := setupMFATest(t)
+
+	if _, err := svc.RelyingParty("https://panel.example.com"); err == nil {
+		t.Fatalf("未配置 WebAuthn 时不应按请求来源推导依赖方")
+	}
+
+	svc.cfg.WebAuthnOrigins = []string{"https://panel.example.com/", "https://admin.example.com"}
+	rp, err := svc.RelyingParty("https://admin.example.com")
+	if err != nil {
+		t.Fatalf("允许的来源应通过: %v", err)
+	}
+	if rp.ID != "panel.example.com" {
+		t.Errorf("未配置 RP ID 时应取第一个允许来源的主机名，实际 %s", rp.ID)
+	}
+	for _, origin := range []string{"https://evil.example.com", "", "https://panel.example.com.evil.com"} {
+		if _, err := svc.RelyingParty(origin); err == nil {
+			t.Errorf("来源 %q 不在允许列表中，应拒绝", origin)
+		}
+	}
+
+	svc.cfg.WebAuthnOrigins = nil
+	svc.cfg.WebAuthnRPID = "panel.example.com"
+	if _, err := svc.RelyingParty("https://panel.example.com"); err != nil {
+		t.Errorf("仅配置 RP ID 时应允许 https://<RP ID>: %v", err)
+	}
+	if _, err := svc.RelyingParty("http://panel.example.com"); err == nil {
+		t.Errorf("仅配置 RP ID 时不应允许其他来源")
+	}
+}
+
+/* TestMFA_WebAuthnChallengeSingleUse WebAuthn 挑战保存在服务端，完成时作废，不能重放或挪作他用 */
+func TestMFA_WebAuthnChallengeSingleUse(t *testing.T) {
+	db, svc, user, now := setupMFATest(t)
+	ctx := context.Background()
+	svc.cfg.WebAuthnOrigins = []string{"https://panel.example.com"}
+	rp, _ := svc.RelyingParty("https://panel.example.com")
+
+	cred := &models.WebAuthnCredential{UserID: user.ID, Name: "key", CredentialID: "Y3JlZA", PublicKey: "AA==", Algorithm: -7}
+	cred.ID = "cred-1"
+	if err := db.Create(cred).Error; err != nil {
+		t.Fatalf("创建凭据失败: %v", err)
+	}
+
+	_, id, err := svc.BeginWebAuthnLogin(ctx, rp, user.ID)
+	if err != nil || id == "" {
+		t.Fatalf("发起 WebAuthn 登录失败: %v", err)
+	}
+	/* 第一次完成会取出挑战（认证数据无效，校验失败） */
+	if err := svc.FinishWebAuthnLogin(ctx, rp, user.ID, id, "Y3JlZA", []byte("{}"), nil, nil); !errors.Is(err, ErrMFAInvalidCode) {
+		t.Fatalf("首次完成应进入认证校验，实际 %v", err)
+	}
+	if err := svc.FinishWebAuthnLogin(ctx, rp, user.ID, id, "Y3JlZA", []byte("{}"), nil, nil); err == nil || errors.Is(err, ErrMFAInvalidCode) {
+		t.Fatalf("同一挑战不能再次使用，实际 %v", err)
+	}
+
+	_, regID, err := svc.BeginWebAuthnRegistration(ctx, rp, user)
+	if err != nil {
+		t.Fatalf("发起 WebAuthn 注册失败: %v", err)
+	}
+	if err := svc.FinishWebAuthnLogin(ctx, rp, user.ID, regID, "Y3JlZA", []byte("{}"), nil, nil); err == nil || errors.Is(err, ErrMFAInvalidCode) {
+		t.Fatalf("注册挑战不能用于登录，实际 %v", err)
+	}
+
+	_, id, _ = svc.BeginWebAuthnLogin(ctx, rp, user.ID)
+	*now = now.Add(webAuthnChallengeTTL + time.Second)
+	if err := svc.FinishWebAuthnLogin(ctx, rp, user.ID, id, "Y3JlZA", []byte("{}"), nil, nil); err == nil || errors.Is(err, ErrMFAInvalidCode) {
+		t.Fatalf("过期的挑战应被拒绝，实际 %v", err)
+	}
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+/* 节点远程命令白名单，节点只执行以下命令 */
+const (
+	NodeCmdReloadRules     = "reload_rules"     /* 重新拉取并应用全部规则 */
+	NodeCmdRestartListener = "restart_listener" /* 重启指定隧道的监听，参数 tunnel_id */
+	NodeCmdDumpGoroutines  = "dump_goroutines"  /* 导出协程堆栈 */
+	NodeCmdRotateCert      = "rotate_cert"      /* 立即轮换节点证书 */
+	NodeCmdRunProbe        = "run_probe"        /* 从节点发起连通性探测，参数 target，可选 type、count */
+	NodeCmdFetchLogs       = "fetch_logs"       /* 获取节点最近的日志，可选 limit、level */
+	NodeCmdSetLogLevel     = "set_log_level"    /* 修改节点日志级别，参数 level */
+)
+
+const (
+	nodeCommandMaxTimeout   = 120 * time.Second      /* 单条命令允许的最长等待 */
+	nodeCommandPollInterval = 500 * time.Millisecond /* 结果由其他实例写入时的轮询间隔 */
+	nodeCommandMsgType      = "command"
+)
+
+/* nodeCommandSpec 白名单命令的默认超时与必填参数 */
+type nodeCommandSpec struct {
+	timeout  time.Duration
+	required []string
+}
+
+var nodeCommandSpecs = map[string]nodeCommandSpec{
+	NodeCmdReloadRules:     {timeout: 30 * time.Second},
+	NodeCmdRestartListener: {timeout: 30 * time.Second, required: []string{"tunnel_id"}},
+	NodeCmdDumpGoroutines:  {timeout: 15 * time.Second},
+	NodeCmdRotateCert:      {timeout: 60 * time.Second},
+	NodeCmdRunProbe:        {timeout: 60 * time.Second, required: []string{"target"}},
+	NodeCmdFetchLogs:       {timeout: 15 * time.Second},
+	NodeCmdSetLogLevel:     {timeout: 10 * time.Second, required: []string{"level"}},
+}
+
+/* NodeCommandNames 返回白名单命令（按名称排序） */
+func NodeCommandNames() []string {
+	names := make([]string, 0, len(nodeCommandSpecs))
+	for name := range nodeCommandSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+NodeCommandRequest 远程命令请求
+功能：由管理 API 构造，RequestedBy/Username/ClientIP/UserAgent 写入审计日志
+*/
+type NodeCommandRequest struct {
+	NodeID      string
+	Command     string
+	Params      map[string]interface{}
+	Timeout     time.Duration /* 0 使用命令的默认超时 */
+	RequestedBy string
+	Username    string
+	ClientIP    string
+	UserAgent   string
+}
+
+/*
+NodeCommandMessage 下发给节点的命令消息（command）
+功能：RequestID 即 node_commands 记录 ID，节点原样带回用于关联结果
+*/
+type NodeCommandMessage struct {
+	RequestID string                 `json:"request_id"`
+	Command   string                 `json:"command"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+	Timeout   int                    `json:"timeout"` /* 秒，节点执行超时 */
+	Timestamp int64                  `json:"timestamp"`
+}
+
+/*
+NodeCommandResult 节点返回的命令结果（command_result）
+*/
+type NodeCommandResult struct {
+	RequestID  string                 `json:"request_id"`
+	Command    string                 `json:"command"`
+	Status     string                 `json:"status"` /* success / failed */
+	Message    string                 `json:"message,omitempty"`
+	Result     map[string]interface{} `json:"result,omitempty"`
+	DurationMs int64                  `json:"duration_ms"`
+}
+
+/*
+NodeCommandService 节点远程命令服务
+功能：通过节点 WebSocket 下发白名单命令并等待结果：
+  - 每条命令先写入 node_commands（pending），其 ID 作为关联 ID 随命令下发
+  - 节点返回 command_result 后由节点所连接的实例更新记录；发起请求的实例本地直接唤醒，
+    其他实例转发的命令通过轮询记录获取结果
+  - 超时未返回的命令标记为 timeout，之后到达的结果不再覆盖
+  - 每条命令的最终结果写入审计日志（audit_logs）
+*/
+type NodeCommandService struct {
+	db     *gorm.DB
+	sender WebSocketSender
+	audit  *AuditService
+
+	mu      sync.Mutex
+	waiters map[string]chan struct{} /* 命令 ID → 结果到达通知 */
+
+	logger *zap.Logger
+}
+
+/*
+NewNodeCommandService 创建节点远程命令服务
+*/
+func NewNodeCommandService(db *gorm.DB, sender WebSocketSender) *NodeCommandService {
+	return &NodeCommandService{
+		db:      db,
+		sender:  sender,
+		audit:   NewAuditService(db),
+		waiters: make(map[string]chan struct{}),
+		logger:  zap.L().Named("node-command"),
+	}
+}
+
+/*
+Execute 下发命令并等待节点返回
+功能：校验白名单和必填参数后下发；返回的记录状态为 success、failed（含下发失败）或 timeout，
+只有请求本身无效或记录读写失败时返回 error
+*/
+func (s *NodeCommandService) Execute(ctx context.Context, req *NodeCommandRequest) (cmd *models.NodeCommand, err error) {
+	ctx, span := tracing.Start(ctx, "NodeCommandService.Execute",
+		attribute.String("gkipass.node.id", req.NodeID),
+		attribute.String("gkipass.command", req.Command))
+	defer func() { tracing.End(span, err) }()
+
+	spec, ok := nodeCommandSpecs[req.Command]
+	if !ok {
+		return nil, fmt.Errorf("不支持的命令: %s", req.Command)
+	}
+	for _, key := range spec.required {
+		if v, ok := req.Params[key]; !ok || v == nil || v == "" {
+			return nil, fmt.Errorf("命令 %s 缺少参数 %s", req.Command, key)
+		}
+	}
+
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = spec.timeout
+	}
+	if timeout > nodeCommandMaxTimeout {
+		timeout = nodeCommandMaxTimeout
+	}
+
+	var node models.Node
+	if err := s.db.Select("id").Where("id = ?", req.NodeID).First(&node).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("节点不存在: %s", req.NodeID)
+		}
+		return nil, fmt.Errorf("查询节点失败: %w", err)
+	}
+
+	params, _ := json.Marshal(req.Params)
+	cmd = &models.NodeCommand{
+		NodeID:         req.NodeID,
+		Command:        req.Command,
+		Params:         string(params),
+		Status:         models.NodeCommandPending,
+		TimeoutSeconds: int(timeout / time.Second),
+		RequestedBy:    req.RequestedBy,
+		ClientIP:       req.ClientIP,
+	}
+	if err := s.db.Create(cmd).Error; err != nil {
+		return nil, fmt.Errorf("创建命令记录失败: %w", err)
+	}
+	span.SetAttributes(attribute.String("gkipass.command.id", cmd.ID))
+
+	done := s.addWaiter(cmd.ID)
+	defer s.removeWaiter(cmd.ID)
+
+	started := time.Now()
+	msg := &NodeCommandMessage{
+		RequestID: cmd.ID,
+		Command:   req.Command,
+		Params:    req.Params,
+		Timeout:   cmd.TimeoutSeconds,
+		Timestamp: started.Unix(),
+	}
+	if sendErr := s.sender.SendToNode(ctx, req.NodeID, nodeCommandMsgType, msg); sendErr != nil {
+		s.finish(cmd.ID, models.NodeCommandFailed, "下发失败: "+sendErr.Error())
+	} else {
+		s.wait(ctx, cmd.ID, done, started.Add(timeout))
+	}
+
+	if err := s.db.Where("id = ?", cmd.ID).First(cmd).Error; err != nil {
+		return nil, fmt.Errorf("读取命令结果失败: %w", err)
+	}
+	span.SetAttributes(attribute.String("gkipass.command.status", cmd.Status))
+
+	s.recordAudit(ctx, req, cmd, time.Since(started))
+	return cmd, nil
+}
+
+/*
+wait 等待结果到达或超时
+功能：本实例收到结果时立即唤醒，否则按间隔轮询记录；到期或请求取消时标记为 timeout
+*/
+func (s *NodeCommandService) wait(ctx context.Context, id string, done <-chan struct{}, deadline time.Time) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	ticker := time.NewTicker(nodeCommandPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			var status []string
+			if err := s.db.Model(&models.NodeCommand{}).Where("id = ?", id).
+				Pluck("status", &status).Error; err == nil && len(status) > 0 && status[0] != models.NodeCommandPending {
+				return
+			}
+		case <-timer.C:
+			s.finish(id, models.NodeCommandTimeout, "节点未在超时时间内返回结果")
+			return
+		case <-ctx.Done():
+			s.finish(id, models.NodeCommandTimeout, "请求已取消: "+ctx.Err().Error())
+			return
+		}
+	}
+}
+
+/*
+Complete 处理节点返回的命令结果
+功能：只更新该节点仍处于 pending 的记录，超时后到达的结果和伪造的 ID 被忽略
+*/
+func (s *NodeCommandService) Complete(nodeID string, result *NodeCommandResult) error {
+	if result == nil || result.RequestID == "" {
+		return errors.New("命令结果缺少 request_id")
+	}
+
+	status := models.NodeCommandFailed
+	if result.Status == models.NodeCommandSuccess {
+		status = models.NodeCommandSuccess
+	}
+	var resultJSON string
+	if result.Result != nil {
+		data, _ := json.Marshal(result.Result)
+		resultJSON = string(data)
+	}
+	errMsg := ""
+	if status != models.NodeCommandSuccess {
+		errMsg = result.Message
+	}
+
+	now := time.Now()
+	tx := s.db.Model(&models.NodeCommand{}).
+		Where("id = ? AND node_id = ? AND status = ?", result.RequestID, nodeID, models.NodeCommandPending).
+		Updates(map[string]interface{}{
+			"status":       status,
+			"result":       resultJSON,
+			"error":        truncateRunes(errMsg, 1024),
+			"completed_at": &now,
+		})
+	if tx.Error != nil {
+		return fmt.Errorf("更新命令结果失败: %w", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		s.logger.Debug("忽略迟到或未知的命令结果",
+			zap.String("node_id", nodeID),
+			zap.String("request_id", result.RequestID))
+		return nil
+	}
+
+	s.notify(result.RequestID)
+	return nil
+}
+
+/*
+Get 获取命令记录
+*/
+func (s *NodeCommandService) Get(nodeID, id string) (*models.NodeCommand, error) {
+	var cmd models.NodeCommand
+	if err := s.db.Where("id = ? AND node_id = ?", id, nodeID).First(&cmd).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("命令记录不存在: %s", id)
+		}
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+/*
+List 列出节点的命令记录（按创建时间倒序）
+*/
+func (s *NodeCommandService) List(nodeID string, limit int) ([]models.NodeCommand, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	var list []models.NodeCommand
+	err := s.db.Where("node_id = ?", nodeID).Order("created_at DESC").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+/* finish 将仍为 pending 的记录更新为最终状态 */
+func (s *NodeCommandService) finish(id, status, errMsg string) {
+	now := time.Now()
+	if err := s.db.Model(&models.NodeCommand{}).
+		Where("id = ? AND status = ?", id, models.NodeCommandPending).
+		Updates(map[string]interface{}{
+			"status":       status,
+			"error":        truncateRunes(errMsg, 1024),
+			"completed_at": &now,
+		}).Error; err != nil {
+		s.logger.Error("更新命令状态失败", zap.String("id", id), zap.Error(err))
+	}
+}
+
+/*
+recordAudit 写入审计日志
+功能：记录操作人、节点、命令、参数和最终状态；写入失败只记录日志，不影响命令结果
+*/
+func (s *NodeCommandService) recordAudit(ctx context.Context, req *NodeCommandRequest, cmd *models.NodeCommand, elapsed time.Duration) {
+	_, _ = s.audit.Record(context.WithoutCancel(ctx), &AuditEntry{
+		UserID:    req.RequestedBy,
+		Username:  req.Username,
+		Action:    "node_command." + cmd.Command,
+		Resource:  "node:" + cmd.NodeID,
+		IP:        req.ClientIP,
+		UserAgent: req.UserAgent,
+		Detail: map[string]interface{}{
+			"command_id":  cmd.ID,
+			"node_id":     cmd.NodeID,
+			"command":     cmd.Command,
+			"params":      req.Params,
+			"status":      cmd.Status,
+			"error":       cmd.Error,
+			"duration_ms": elapsed.Milliseconds(),
+		},
+	})
+
+	s.logger.Info("节点远程命令",
+		zap.String("command_id", cmd.ID),
+		zap.String("node_id", cmd.NodeID),
+		zap.String("command", cmd.Command),
+		zap.String("status", cmd.Status),
+		zap.String("user_id", req.RequestedBy),
+		zap.Duration("elapsed", elapsed))
+}
+
+func (s *NodeCommandService) addWaiter(id string) <-chan struct{} {
+	ch := make(chan struct{})
+	s.mu.Lock()
+	s.waiters[id] = ch
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *NodeCommandService) removeWaiter(id string) {
+	s.mu.Lock()
+	delete(s.waiters, id)
+	s.mu.Unlock()
+}
+
+func (s *NodeCommandService) notify(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ch, ok := s.waiters[id]; ok {
+		close(ch)
+		delete(s.waiters, id)
+	}
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/*
+commandTestSender 模拟节点的 WebSocketSender
+功能：reply 不为 nil 时异步以节点身份返回结果，否则不返回（用于超时场景）
+*/
+type commandTestSender struct {
+	svc     *NodeCommandService
+	reply   func(msg *NodeCommandMessage) *NodeCommandResult
+	sendErr error
+}
+
+func (s *commandTestSender) SendToNode(_ context.Context, nodeID string, msgType string, data interface{}) error {
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+	msg := data.(*NodeCommandMessage)
+	if msgType != "command" || s.reply == nil {
+		return nil
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		s.svc.Complete(nodeID, s.reply(msg))
+	}()
+	return nil
+}
+
+func (s *commandTestSender) SendToGroup(context.Context, []string, string, interface{}) error {
+	return nil
+}
+
+func (s *commandTestSender) GetOnlineNodeIDs() []string {
+	return []string{"n1"}
+}
+
+/*
+setupCommandTest 创建远程命令测试环境，含节点 n1
+*/
+func setupCommandTest(t *testing.T) (*gorm.DB, *NodeCommandService, *commandTestSender) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	/* 结果由另一个协程写入，内存库每个连接独立，限制为单连接 */
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Node{}, &models.NodeGroup{}, &models.NodeCommand{}, &models.AuditLog{}); err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+
+	node := models.Node{Name: "n1", Status: models.NodeStatusOnline}
+	node.ID = "n1"
+	if err := db.Create(&node).Error; err != nil {
+		t.Fatalf("创建节点失败: %v", err)
+	}
+
+	sender := &commandTestSender{}
+	svc := NewNodeCommandService(db, sender)
+	sender.svc = svc
+	return db, svc, sender
+}
+
+/* TestNodeCommand_Success 节点返回结果后记录为 success，并写入审计日志 */
+func TestNodeCommand_Success(t *testing.T) {
+	db, svc, sender := setupCommandTest(t)
+	sender.reply = func(msg *NodeCommandMessage) *NodeCommandResult {
+		return &NodeCommandResult{
+			RequestID: msg.RequestID,
+			Command:   msg.Command,
+			Status:    "success",
+			Result:    map[string]interface{}{"level": msg.Params["level"]},
+		}
+	}
+
+	cmd, err := svc.Execute(context.Background(), &NodeCommandRequest{
+		NodeID:      "n1",
+		Command:     NodeCmdSetLogLevel,
+		Params:      map[string]interface{}{"level": "debug"},
+		RequestedBy: "admin-1",
+		ClientIP:    "10.0.0.1",
+	})
+	if err != nil {
+		t.Fatalf("下发命令失败: %v", err)
+	}
+	if cmd.Status != models.NodeCommandSuccess {
+		t.Fatalf("命令状态应为 success，实际 %s（%s）", cmd.Status, cmd.Error)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(cmd.Result), &result); err != nil || result["level"] != "debug" {
+		t.Errorf("命令结果不符合预期: %s", cmd.Result)
+	}
+
+	var audit models.AuditLog
+	if err := db.Where("resource = ?", "node:n1").First(&audit).Error; err != nil {
+		t.Fatalf("未写入审计日志: %v", err)
+	}
+	if audit.UserID != "admin-1" || audit.Action != "node_command.set_log_level" || audit.IP != "10.0.0.1" {
+		t.Errorf("审计日志内容不符合预期: %+v", audit)
+	}
+	if !strings.Contains(audit.Detail, cmd.ID) || !strings.Contains(audit.Detail, `"status":"success"`) {
+		t.Errorf("审计详情应包含命令 ID 和状态: %s", audit.Detail)
+	}
+}
+
+/* TestNodeCommand_Timeout 节点未返回时标记为 timeout，迟到的结果和其他节点伪造的结果都不覆盖 */
+func TestNodeCommand_Timeout(t *testing.T) {
+	_, svc, _ := setupCommandTest(t)
+
+	cmd, err := svc.Execute(context.Background(), &NodeCommandRequest{
+		NodeID:  "n1",
+		Command: NodeCmdDumpGoroutines,
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("下发命令失败: %v", err)
+	}
+	if cmd.Status != models.NodeCommandTimeout {
+		t.Fatalf("命令状态应为 timeout，实际 %s", cmd.Status)
+	}
+
+	svc.Complete("n2", &NodeCommandResult{RequestID: cmd.ID, Status: "success"})
+	svc.Complete("n1", &NodeCommandResult{RequestID: cmd.ID, Status: "success"})
+	got, err := svc.Get("n1", cmd.ID)
+	if err != nil {
+		t.Fatalf("读取命令记录失败: %v", err)
+	}
+	if got.Status != models.NodeCommandTimeout {
+		t.Errorf("超时后到达的结果不应覆盖记录，实际状态 %s", got.Status)
+	}
+}
+
+/* TestNodeCommand_Rejected 白名单外的命令、缺少参数、未知节点直接拒绝，不创建记录 */
+func TestNodeCommand_Rejected(t *testing.T) {
+	db, svc, _ := setupCommandTest(t)
+
+	cases := []*NodeCommandRequest{
+		{NodeID: "n1", Command: "exec", Params: map[string]interface{}{"cmd": "rm -rf /"}},
+		{NodeID: "n1", Command: NodeCmdRestartListener},
+		{NodeID: "n9", Command: NodeCmdReloadRules},
+	}
+	for _, req := range cases {
+		if _, err := svc.Execute(context.Background(), req); err == nil {
+			t.Errorf("命令 %s（节点 %s）应被拒绝", req.Command, req.NodeID)
+		}
+	}
+
+	var count int64
+	db.Model(&models.NodeCommand{}).Count(&count)
+	if count != 0 {
+		t.Errorf("被拒绝的命令不应创建记录，实际 %d 条", count)
+	}
+}
+
+/* TestNodeCommand_SendFailed 下发失败时记录为 failed 并保留原因 */
+func TestNodeCommand_SendFailed(t *testing.T) {
+	_, svc, sender := setupCommandTest(t)
+	sender.sendErr = errors.New("节点未连接")
+
+	cmd, err := svc.Execute(context.Background(), &NodeCommandRequest{NodeID: "n1", Command: NodeCmdReloadRules})
+	if err != nil {
+		t.Fatalf("下发失败应记录在命令结果中而非返回错误: %v", err)
+	}
+	if cmd.Status != models.NodeCommandFailed || !strings.Contains(cmd.Error, "节点未连接") {
+		t.Errorf("命令应为 failed 并记录原因，实际 %s（%s）", cmd.Status, cmd.Error)
+	}
+}
@@ -45,6 +45,22 @@ type onlineEntry struct {
 	UpdatedAt time.Time
 }
 
+var (
+	nodeGroupCacheInstance *NodeGroupCache
+	nodeGroupCacheOnce     sync.Once
+)
+
+/*
+GetNodeGroupCache 获取进程内共享的节点组缓存
+功能：多实例部署时由全局在线节点表刷新在线数，调度、容灾等读取方共享同一份缓存
+*/
+func GetNodeGroupCache(gormDB *gorm.DB) *NodeGroupCache {
+	nodeGroupCacheOnce.Do(func() {
+		nodeGroupCacheInstance = NewNodeGroupCache(gormDB)
+	})
+	return nodeGroupCacheInstance
+}
+
 /*
 NewNodeGroupCache 创建节点组缓存
 */
@@ -151,6 +167,42 @@ func (c *NodeGroupCache) SetOnlineCount(groupID string, count int) {
 	c.onlineMu.Unlock()
 }
 
+/*
+SyncOnlineCounts 按全局在线节点列表刷新所有组的在线节点数
+功能：多实例部署时节点分散连接在各实例上，数据库中的节点状态可能滞后，
+由 ws.Cluster 定期以全部实例的在线节点调用，各实例得到一致的组在线数
+*/
+func (c *NodeGroupCache) SyncOnlineCounts(nodeIDs []string) {
+	online := make(map[string]bool, len(nodeIDs))
+	for _, id := range nodeIDs {
+		online[id] = true
+	}
+
+	/* 关联表由 Node.Groups 的 many2many 生成，列为 node_id / node_group_id */
+	var members []struct {
+		NodeGroupID string
+		NodeID      string
+	}
+	if err := c.gormDB.Table("node_group_nodes").Select("node_group_id, node_id").Scan(&members).Error; err != nil {
+		c.logger.Error("查询节点组成员失败", zap.Error(err))
+		return
+	}
+
+	/* 没有在线节点的组也要刷新为 0 */
+	counts := make(map[string]int)
+	for _, g := range c.ListGroups() {
+		counts[g.ID] = 0
+	}
+	for _, m := range members {
+		if online[m.NodeID] {
+			counts[m.NodeGroupID]++
+		}
+	}
+	for groupID, count := range counts {
+		c.SetOnlineCount(groupID, count)
+	}
+}
+
 /*
 InvalidateGroup 使指定组的缓存失效
 功能：节点组更新/删除时调用，强制下次查询刷新
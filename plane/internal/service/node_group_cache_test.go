@@ -209,3 +209,31 @@ func TestNodeGroupCache_TTLExpiry(t *testing.T) {
 		t.Errorf("TTL 过期后期望查库返回 0, 实际 %d", count)
 	}
 }
+
+/*
+TestNodeGroupCache_SyncOnlineCounts 测试按全局在线节点列表刷新组在线数
+*/
+func TestNodeGroupCache_SyncOnlineCounts(t *testing.T) {
+	db := setupCacheTestDB(t)
+
+	for _, id := range []string{"group-001", "group-002", "group-003"} {
+		g := models.NodeGroup{Name: id, Role: models.NodeRoleBoth}
+		g.ID = id
+		db.Create(&g)
+	}
+	db.Exec(`INSERT INTO node_group_nodes (node_group_id, node_id) VALUES
+		('group-001', 'node-a'), ('group-001', 'node-b'), ('group-002', 'node-b'), ('group-003', 'node-c')`)
+
+	cache := NewNodeGroupCache(db)
+	cache.SetOnlineCount("group-003", 5)
+
+	/* node-a、node-b 连接在不同实例上，数据库中的状态不影响结果 */
+	cache.SyncOnlineCounts([]string{"node-a", "node-b"})
+
+	want := map[string]int{"group-001": 2, "group-002": 1, "group-003": 0}
+	for groupID, expected := range want {
+		if count := cache.GetOnlineCount(groupID); count != expected {
+			t.Errorf("组 %s 期望在线数 %d, 实际 %d", groupID, expected, count)
+		}
+	}
+}
@@ -18,6 +18,8 @@ NodeMonitoringService 节点监控服务
 type NodeMonitoringService struct {
 	dao         *dao.DAO
 	alertSystem *AlertSystem
+	alertEngine *AlertEngine
+	leader      *LeaderElector /* 多实例部署时聚合、离线检查和清理只在主实例执行 */
 	stopChan    chan struct{}
 }
 
@@ -27,11 +29,17 @@ NewNodeMonitoringService 创建节点监控服务
 func NewNodeMonitoringService(d *dao.DAO) *NodeMonitoringService {
 	return &NodeMonitoringService{
 		dao:         d,
-		alertSystem: NewAlertSystem(),
+		alertSystem: NewAlertSystem(d),
+		alertEngine: GetAlertEngine(d),
 		stopChan:    make(chan struct{}),
 	}
 }
 
+/* SetLeaderElector 设置主实例选举器，须在 Start 之前调用 */
+func (s *NodeMonitoringService) SetLeaderElector(leader *LeaderElector) {
+	s.leader = leader
+}
+
 // Start 启动监控服务
 func (s *NodeMonitoringService) Start() {
 	logger.Info("节点监控服务启动")
@@ -94,7 +102,7 @@ func (s *NodeMonitoringService) ReportMonitoringData(nodeID string, data *NodeMo
 				logger.Error("checkAlerts panic", zap.String("nodeID", nodeID), zap.Any("panic", r))
 			}
 		}()
-		s.checkAlerts(nodeID, monitoringData)
+		s.checkAlerts(nodeID, monitoringData, data.TunnelStats.TunnelList)
 	}()
 
 	/* 5. 更新节点状态（含 panic 恢复） */
@@ -246,110 +254,20 @@ func (s *NodeMonitoringService) updateNodeStatus(nodeID string) {
 	_ = s.dao.UpdateNodeStatus(nodeID, models.NodeStatusOnline)
 }
 
-/* checkAlerts 检查告警条件 */
-func (s *NodeMonitoringService) checkAlerts(nodeID string, data *models.NodeMonitoringData) {
-	rules, err := s.dao.ListNodeAlertRules(nodeID)
-	if err != nil {
-		logger.Error("获取告警规则失败", zap.String("nodeID", nodeID), zap.Error(err))
-		return
-	}
+/* checkAlerts 将本次上报的节点指标和隧道指标交给告警规则引擎评估 */
+func (s *NodeMonitoringService) checkAlerts(nodeID string, data *models.NodeMonitoringData, tunnels []TunnelStatusInfo) {
+	s.alertEngine.ObserveNode(nodeID, NodeAlertMetricValues(data), data.Timestamp)
 
-	for _, rule := range rules {
-		if !rule.Enabled {
+	for _, tunnel := range tunnels {
+		if tunnel.TunnelID == "" {
 			continue
 		}
-
-		var metricValue float64
-		var triggered bool
-
-		// 根据指标类型获取对应值
-		switch rule.MetricType {
-		case "cpu":
-			metricValue = data.CPUUsage
-		case "memory":
-			metricValue = data.MemoryUsagePercent
-		case "disk":
-			metricValue = data.DiskUsagePercent
-		case "response_time":
-			metricValue = data.AvgResponseTime
-		case "connections":
-			metricValue = float64(data.TotalConnections)
-		default:
-			continue
-		}
-
-		// 检查是否触发告警
-		switch rule.Operator {
-		case ">":
-			triggered = metricValue > rule.ThresholdValue
-		case "<":
-			triggered = metricValue < rule.ThresholdValue
-		case ">=":
-			triggered = metricValue >= rule.ThresholdValue
-		case "<=":
-			triggered = metricValue <= rule.ThresholdValue
-		case "=":
-			triggered = metricValue == rule.ThresholdValue
-		case "!=":
-			triggered = metricValue != rule.ThresholdValue
-		}
-
-		if triggered {
-			s.triggerAlert(rule, nodeID, metricValue)
-		}
-	}
-}
-
-/* triggerAlert 触发告警 */
-func (s *NodeMonitoringService) triggerAlert(rule *models.NodeAlertRule, nodeID string, metricValue float64) {
-	alert := &models.NodeAlertHistory{
-		RuleID:         rule.ID,
-		NodeID:         nodeID,
-		AlertType:      rule.MetricType,
-		Severity:       rule.Severity,
-		Message:        fmt.Sprintf("%s: %.2f %s %.2f", rule.RuleName, metricValue, rule.Operator, rule.ThresholdValue),
-		MetricValue:    metricValue,
-		ThresholdValue: rule.ThresholdValue,
-		Status:         "triggered",
-		TriggeredAt:    time.Now(),
-	}
-
-	if err := s.dao.CreateNodeAlertHistory(alert); err != nil {
-		logger.Error("创建告警记录失败", zap.Error(err))
-		return
-	}
-
-	/* 发送告警通知 */
-	alertLevel := AlertInfo
-	switch rule.Severity {
-	case "warning":
-		alertLevel = AlertWarning
-	case "critical":
-		alertLevel = AlertCritical
-	}
-
-	node, _ := s.dao.GetNode(nodeID)
-	nodeName := nodeID
-	if node != nil {
-		nodeName = node.Name
-	}
-
-	systemAlert := Alert{
-		Level:   alertLevel,
-		Title:   fmt.Sprintf("节点告警: %s", nodeName),
-		Message: alert.Message,
-		Tags:    []string{"node", nodeID, rule.MetricType},
+		s.alertEngine.ObserveTunnel(nodeID, tunnel.TunnelID, map[string]float64{
+			"connections":   float64(tunnel.Connections),
+			"response_time": tunnel.AvgResponseTime,
+			"errors":        float64(tunnel.ErrorCount),
+		}, data.Timestamp)
 	}
-
-	if err := s.alertSystem.Send(systemAlert); err != nil {
-		logger.Error("发送告警通知失败", zap.Error(err))
-	}
-
-	logger.Warn("节点告警触发",
-		zap.String("nodeID", nodeID),
-		zap.String("ruleName", rule.RuleName),
-		zap.Float64("value", metricValue),
-		zap.Float64("threshold", rule.ThresholdValue))
 }
 
 // dataAggregationLoop 数据聚合循环
@@ -361,7 +279,9 @@ func (s *NodeMonitoringService) dataAggregationLoop() {
 	for {
 		select {
 		case <-ticker.C:
-			s.aggregateHourlyData()
+			if s.leader.IsLeader() {
+				s.aggregateHourlyData()
+			}
 		case <-s.stopChan:
 			return
 		}
@@ -377,7 +297,9 @@ func (s *NodeMonitoringService) alertCheckLoop() {
 	for {
 		select {
 		case <-ticker.C:
-			s.checkOfflineNodes()
+			if s.leader.IsLeader() {
+				s.checkOfflineNodes()
+			}
 		case <-s.stopChan:
 			return
 		}
@@ -393,7 +315,9 @@ func (s *NodeMonitoringService) dataCleanupLoop() {
 	for {
 		select {
 		case <-ticker.C:
-			s.cleanupExpiredData()
+			if s.leader.IsLeader() {
+				s.cleanupExpiredData()
+			}
 		case <-s.stopChan:
 			return
 		}
@@ -526,17 +450,42 @@ func (s *NodeMonitoringService) checkOfflineNodes() {
 		if node.Status == models.NodeStatusOnline && now.Sub(node.LastOnline) > 5*time.Minute {
 			_ = s.dao.UpdateNodeStatus(node.ID, models.NodeStatusOffline)
 
-			alert := Alert{
+			/* 静默或维护窗口内的节点不发送离线通知 */
+			if s.alertEngine.NodeSilenced(node.ID, now) {
+				logger.Info("节点离线，处于静默期不发送通知", zap.String("nodeID", node.ID))
+				continue
+			}
+
+			go s.sendAlert(Alert{
 				Level:   AlertWarning,
 				Title:   fmt.Sprintf("节点离线: %s", node.Name),
 				Message: fmt.Sprintf("节点 %s (%s) 已离线超过5分钟", node.Name, node.ID),
 				Tags:    []string{"node", "offline", node.ID},
-			}
-			s.alertSystem.Send(alert)
+				NodeID:  node.ID,
+			})
 		}
 	}
 }
 
+/* sendAlert 发送告警通知（含重试，需在独立协程中调用以免阻塞上报处理） */
+func (s *NodeMonitoringService) sendAlert(alert Alert) {
+	if err := s.alertSystem.Send(alert); err != nil {
+		logger.Error("发送告警通知失败",
+			zap.String("title", alert.Title),
+			zap.Error(err))
+	}
+}
+
+/* AlertSystem 获取告警系统，用于测试通道等直接发送场景 */
+func (s *NodeMonitoringService) AlertSystem() *AlertSystem {
+	return s.alertSystem
+}
+
+/* AlertEngine 获取告警规则引擎 */
+func (s *NodeMonitoringService) AlertEngine() *AlertEngine {
+	return s.alertEngine
+}
+
 /* cleanupExpiredData 清理过期数据 */
 func (s *NodeMonitoringService) cleanupExpiredData() {
 	logger.Info("开始清理过期监控数据")
@@ -1,12 +1,18 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/pkg/tracing"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -16,24 +22,28 @@ GormNodeSyncService 基于 GORM 的节点同步服务
 功能：管理隧道规则到节点的同步推送，支持：
 - 隧道创建/更新/删除时自动推送规则变更到相关节点
 - 按节点组批量同步规则
-- 版本化增量同步（仅推送变更）
+- 基于持久化变更日志的版本化增量同步，节点重连时只推送其确认版本之后的差异
+- 分批发布期间尚未轮到（或已回滚）的节点保持变更前的规则
 - 端口冲突全局检测
 */
 type GormNodeSyncService struct {
 	db        *gorm.DB
 	logger    *zap.Logger
 	encKeySvc *EncryptionKeyService
-	wsSender  WebSocketSender /* WebSocket 消息发送接口 */
+	wsSender  WebSocketSender         /* WebSocket 消息发送接口 */
+	journal   *IncrementalSyncService /* 规则变更日志与节点确认版本 */
+	rollouts  *RolloutController      /* 规则分批发布，nil 表示变更立即推送到全部节点 */
 	mu        sync.RWMutex
 }
 
 /*
 WebSocketSender WebSocket 消息发送接口
-功能：解耦同步服务与 WebSocket 实现，支持测试和替换
+功能：解耦同步服务与 WebSocket 实现，支持测试和替换；
+ctx 中的追踪上下文随消息下发，节点应用规则时接续同一条链路
 */
 type WebSocketSender interface {
-	SendToNode(nodeID string, msgType string, data interface{}) error
-	SendToGroup(nodeIDs []string, msgType string, data interface{}) error
+	SendToNode(ctx context.Context, nodeID string, msgType string, data interface{}) error
+	SendToGroup(ctx context.Context, nodeIDs []string, msgType string, data interface{}) error
 	GetOnlineNodeIDs() []string
 }
 
@@ -46,6 +56,7 @@ func NewGormNodeSyncService(db *gorm.DB, wsSender WebSocketSender) *GormNodeSync
 		logger:    zap.L().Named("gorm-node-sync"),
 		encKeySvc: NewEncryptionKeyService(db),
 		wsSender:  wsSender,
+		journal:   NewIncrementalSyncService(db),
 	}
 }
 
@@ -57,6 +68,8 @@ type SyncRulePayload struct {
 	TunnelID         string              `json:"tunnel_id"`
 	TunnelName       string              `json:"tunnel_name"`
 	Protocol         string              `json:"protocol"`
+	IngressProtocol  string              `json:"ingress_protocol"`
+	EgressProtocol   string              `json:"egress_protocol"`
 	ListenPort       int                 `json:"listen_port"`
 	TargetAddress    string              `json:"target_address"`
 	TargetPort       int                 `json:"target_port"`
@@ -69,6 +82,7 @@ type SyncRulePayload struct {
 	MaxConnections   int                 `json:"max_connections"`
 	IdleTimeout      int                 `json:"idle_timeout"`
 	Version          int64               `json:"version"`
+	Priority         int                 `json:"priority,omitempty"` /* 规则优先级，节点作为复用传输（tls-mux）上的流优先级 */
 	UserID           string              `json:"user_id"`
 
 	/*
@@ -76,10 +90,94 @@ type SyncRulePayload struct {
 		节点检测到出口组不可达超过 FailoverTimeout 秒后，
 		自动切换到 FailoverTargets 中的目标节点
 	*/
+	EgressGroupID       string              `json:"egress_group_id,omitempty"`       /* 主出口组 ID（容灾事件的原出口组） */
 	FailoverTargets     []SyncTargetPayload `json:"failover_targets,omitempty"`      /* 容灾出口组的目标节点列表 */
 	FailoverTimeout     int                 `json:"failover_timeout,omitempty"`      /* 容灾触发超时（秒） */
 	FailoverAutoRecover bool                `json:"failover_auto_recover,omitempty"` /* 原出口恢复后是否自动回切 */
 	FailoverGroupID     string              `json:"failover_group_id,omitempty"`     /* 容灾出口组 ID（用于事件上报） */
+
+	/*
+		PROXY protocol：AcceptProxyProtocol 要求入口监听解析传入的 PROXY 头，
+		SendProxyProtocol 指定出口向目标发送的头版本（v1/v2，空为不发送）
+	*/
+	SendProxyProtocol   string `json:"send_proxy_protocol,omitempty"`
+	AcceptProxyProtocol bool   `json:"accept_proxy_protocol,omitempty"`
+
+	/* 访问控制规则（按优先级从高到低），节点以 PROXY 头解析出的真实来源地址匹配，空表示全部允许 */
+	ACL []SyncACLPayload `json:"acl,omitempty"`
+
+	/* 代理入口认证凭据（仅下发摘要，含隧道创建者的用户级凭据），入口节点对代理入口始终强制认证 */
+	Credentials []SyncCredentialPayload `json:"credentials,omitempty"`
+
+	/* 代理入口目标白名单（支持 *.example.com），空表示不限制 */
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+
+	/* 是否允许 SOCKS5 BIND，默认关闭 */
+	AllowBind bool `json:"allow_bind,omitempty"`
+
+	/* 共享端口路由主机名（SNI/Host），非空时入口节点以共享监听模式承载该规则 */
+	Hostnames []string `json:"hostnames,omitempty"`
+
+	/*
+		多跳链路（仅配置了中继跳的隧道）：Hops 为完整有序链路（入口、中继、出口），
+		Role/HopIndex 为接收节点在链路中的位置，NextHop 为其应转发到的下一跳。
+		Role 为空表示传统单跳隧道
+	*/
+	Role     string           `json:"role,omitempty"`
+	HopIndex int              `json:"hop_index,omitempty"`
+	Hops     []SyncHopPayload `json:"hops,omitempty"`
+	NextHop  *SyncHopPayload  `json:"next_hop,omitempty"`
+
+	/*
+		反向隧道：出口组为反向模式时 Reverse=true，上一跳（入口或最后一个中继）
+		不再拨号出口，而是等待出口节点回连并经其连接池开流。
+		ReverseSecret 仅下发给出口组和上一跳，ReversePeers 仅下发给出口组（需要回连的上一跳节点地址）
+	*/
+	Reverse       bool                `json:"reverse,omitempty"`
+	ReverseSecret string              `json:"reverse_secret,omitempty"`
+	ReversePeers  []SyncTargetPayload `json:"reverse_peers,omitempty"`
+}
+
+/* 节点在多跳链路中的角色 */
+const (
+	HopRoleIngress = "ingress"
+	HopRoleRelay   = "relay"
+	HopRoleEgress  = "egress"
+)
+
+/*
+SyncHopPayload 同步链路中的一跳
+功能：Protocol 为上一跳进入本跳所用的协议，Nodes 为本跳节点的隧道地址（含节点ID与证书固定）
+*/
+type SyncHopPayload struct {
+	Index    int                 `json:"index"`
+	Role     string              `json:"role"`
+	GroupID  string              `json:"group_id"`
+	NodeID   string              `json:"node_id,omitempty"`
+	Protocol string              `json:"protocol"`
+	Nodes    []SyncTargetPayload `json:"nodes,omitempty"`
+}
+
+/*
+SyncCredentialPayload 同步代理认证凭据
+节点以 hex(SHA-256(salt + password)) 校验客户端提交的密码
+*/
+type SyncCredentialPayload struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Salt         string `json:"salt"`
+}
+
+/*
+SyncACLPayload 同步访问控制规则
+字段为空表示不限制该维度，节点按顺序匹配第一条命中的规则，未命中时允许
+*/
+type SyncACLPayload struct {
+	Action    string `json:"action"`
+	SourceIP  string `json:"source_ip,omitempty"`
+	DestIP    string `json:"dest_ip,omitempty"`
+	Protocol  string `json:"protocol,omitempty"`
+	PortRange string `json:"port_range,omitempty"`
 }
 
 /*
@@ -90,18 +188,32 @@ type SyncTargetPayload struct {
 	Port    int    `json:"port"`
 	Weight  int    `json:"weight"`
 	Enabled bool   `json:"enabled"`
+
+	/* 目标为链路节点时携带节点ID与CA公钥固定，节点据此校验相邻节点的QUIC/TLS证书 */
+	NodeID  string `json:"node_id,omitempty"`
+	CertPin string `json:"cert_pin,omitempty"`
 }
 
 /*
 SyncRulesMessage 同步规则消息
-功能：包含完整的规则列表，用于全量同步
+功能：Force 为全量同步（节点移除未下发的规则）；Incremental 为增量同步，
+仅包含 BaseVersion 之后变更的规则和需删除的隧道。Version 为本次同步后节点应确认的变更日志版本
 */
 type SyncRulesMessage struct {
-	Rules   []SyncRulePayload `json:"rules"`
-	Force   bool              `json:"force"`
-	Version string            `json:"version"`
+	Rules       []SyncRulePayload `json:"rules"`
+	Deleted     []string          `json:"deleted,omitempty"` /* 需删除的隧道 ID（仅增量同步） */
+	Force       bool              `json:"force"`
+	Incremental bool              `json:"incremental,omitempty"`
+	BaseVersion int64             `json:"base_version,omitempty"` /* 增量起点：节点应已应用到该版本 */
+	Version     string            `json:"version"`
 }
 
+/*
+RuleSnapshot 规则快照（隧道 ID → 节点组 ID → 面向该组下发的规则）
+功能：分批发布保存变更前的规则，隧道在快照中没有某组的规则表示该组节点原本不承载此隧道
+*/
+type RuleSnapshot map[string]map[string]SyncRulePayload
+
 /*
 DeleteRuleMessage 删除规则消息
 */
@@ -111,102 +223,501 @@ type DeleteRuleMessage struct {
 
 /*
 OnTunnelCreated 隧道创建后触发同步
-功能：将新隧道的规则推送到入口组和出口组的所有在线节点
+功能：为入口组、出口组和各中继组记录变更，并向这些组的在线节点推送其确认版本之后的差异
 */
-func (s *GormNodeSyncService) OnTunnelCreated(tunnel *models.Tunnel) error {
+func (s *GormNodeSyncService) OnTunnelCreated(ctx context.Context, tunnel *models.Tunnel) (err error) {
+	ctx, span := tracing.Start(ctx, "GormNodeSyncService.OnTunnelCreated", attribute.String("gkipass.tunnel.id", tunnel.ID))
+	defer func() { tracing.End(span, err) }()
+
 	s.logger.Info("隧道创建，触发规则同步",
 		zap.String("tunnel_id", tunnel.ID),
 		zap.String("name", tunnel.Name))
 
-	/* 生成加密密钥（如果启用加密） */
-	if tunnel.EnableEncryption {
-		if _, err := s.encKeySvc.EnsureKeyForTunnel(tunnel); err != nil {
-			s.logger.Error("生成加密密钥失败", zap.Error(err))
+	return s.onTunnelChanged(ctx, tunnel)
+}
+
+/*
+OnTunnelUpdated 隧道更新后触发同步
+功能：previousGroupIDs 为更新前隧道经过的节点组，不再经过的组记录删除变更
+*/
+func (s *GormNodeSyncService) OnTunnelUpdated(ctx context.Context, tunnel *models.Tunnel, previousGroupIDs ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "GormNodeSyncService.OnTunnelUpdated",
+		attribute.String("gkipass.tunnel.id", tunnel.ID),
+		attribute.Bool("gkipass.tunnel.enabled", tunnel.Enabled))
+	defer func() { tracing.End(span, err) }()
+
+	s.logger.Info("隧道更新，触发规则同步",
+		zap.String("tunnel_id", tunnel.ID))
+
+	groupIDs, err := s.recordTunnelUpdate(ctx, tunnel, previousGroupIDs)
+	if err != nil {
+		return err
+	}
+
+	s.pushChanges(ctx, groupIDs)
+	return nil
+}
+
+/*
+OnNodeGroupUpdated 节点组配置变更后触发同步
+功能：出口组的反向模式、容灾策略体现在以其为出口的隧道规则中，为这些隧道记录变更并推送
+*/
+func (s *GormNodeSyncService) OnNodeGroupUpdated(ctx context.Context, groupID string) (err error) {
+	ctx, span := tracing.Start(ctx, "GormNodeSyncService.OnNodeGroupUpdated", attribute.String("gkipass.group.id", groupID))
+	defer func() { tracing.End(span, err) }()
+
+	groupIDs := make([]string, 0)
+	for _, tunnelID := range s.EgressTunnelIDs(groupID) {
+		var tunnel models.Tunnel
+		if err := s.db.First(&tunnel, "id = ?", tunnelID).Error; err != nil {
+			continue
 		}
+		changed, err := s.recordTunnelChange(ctx, &tunnel)
+		if err != nil {
+			return err
+		}
+		groupIDs = append(groupIDs, changed...)
 	}
 
-	/* 同步到入口组节点 */
-	if tunnel.IngressGroupID != "" {
-		if err := s.syncTunnelToGroup(tunnel, tunnel.IngressGroupID); err != nil {
-			s.logger.Error("同步到入口组失败",
-				zap.String("group_id", tunnel.IngressGroupID),
-				zap.Error(err))
+	s.pushChanges(ctx, groupIDs)
+	return nil
+}
+
+/*
+OnUserProxyCredentialsUpdated 用户级代理凭据变更后触发同步
+功能：用户创建的代理入口隧道（socks5/http）规则中含其用户级凭据，为这些隧道记录变更并推送，
+吊销或轮换的密码随即在节点上失效
+*/
+func (s *GormNodeSyncService) OnUserProxyCredentialsUpdated(ctx context.Context, userID string) (err error) {
+	ctx, span := tracing.Start(ctx, "GormNodeSyncService.OnUserProxyCredentialsUpdated", attribute.String("gkipass.user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	var tunnels []models.Tunnel
+	if err := s.db.Where("created_by = ? AND enabled = ? AND ingress_protocol IN ?", userID, true,
+		[]models.TunnelProtocol{models.ProtocolSOCKS5, models.ProtocolHTTP}).
+		Find(&tunnels).Error; err != nil {
+		return err
+	}
+
+	groupIDs := make([]string, 0)
+	for i := range tunnels {
+		changed, err := s.recordTunnelChange(ctx, &tunnels[i])
+		if err != nil {
+			return err
 		}
+		groupIDs = append(groupIDs, changed...)
 	}
 
-	/* 同步到出口组节点 */
-	if tunnel.EgressGroupID != "" && tunnel.EgressGroupID != tunnel.IngressGroupID {
-		if err := s.syncTunnelToGroup(tunnel, tunnel.EgressGroupID); err != nil {
-			s.logger.Error("同步到出口组失败",
-				zap.String("group_id", tunnel.EgressGroupID),
-				zap.Error(err))
+	s.logger.Info("用户代理凭据变更，触发规则同步",
+		zap.String("user_id", userID),
+		zap.Int("tunnels", len(tunnels)))
+	s.pushChanges(ctx, groupIDs)
+	return nil
+}
+
+/*
+OnNodeCertPinChanged 节点CA公钥固定变更后触发同步
+功能：节点首次注册或重新生成CA后，经过其所在组的隧道规则中相邻节点的证书固定随之变化，
+为这些隧道记录变更并推送，链路上的其他节点才能校验该节点的证书
+*/
+func (s *GormNodeSyncService) OnNodeCertPinChanged(ctx context.Context, nodeID string) (err error) {
+	ctx, span := tracing.Start(ctx, "GormNodeSyncService.OnNodeCertPinChanged", attribute.String("gkipass.node.id", nodeID))
+	defer func() { tracing.End(span, err) }()
+
+	var memberOf []string
+	s.db.Table("node_group_nodes").Where("node_id = ?", nodeID).Pluck("group_id", &memberOf)
+
+	seen := make(map[string]bool)
+	groupIDs := make([]string, 0)
+	for _, groupID := range memberOf {
+		var tunnels []models.Tunnel
+		if err := s.groupTunnelsQuery(groupID).Find(&tunnels).Error; err != nil {
+			return err
+		}
+		for i := range tunnels {
+			if seen[tunnels[i].ID] {
+				continue
+			}
+			seen[tunnels[i].ID] = true
+			changed, err := s.recordTunnelChange(ctx, &tunnels[i])
+			if err != nil {
+				return err
+			}
+			groupIDs = append(groupIDs, changed...)
 		}
 	}
 
+	s.logger.Info("节点证书固定变更，触发规则同步",
+		zap.String("node_id", nodeID),
+		zap.Int("tunnels", len(seen)))
+	s.pushChanges(ctx, groupIDs)
 	return nil
 }
 
 /*
-OnTunnelUpdated 隧道更新后触发同步
-功能：将更新后的隧道规则推送到关联的所有节点
+groupTunnelsQuery 经过指定节点组的启用隧道查询（入口、出口、中继或出口的容灾组）
 */
-func (s *GormNodeSyncService) OnTunnelUpdated(tunnel *models.Tunnel) error {
-	s.logger.Info("隧道更新，触发规则同步",
-		zap.String("tunnel_id", tunnel.ID))
+func (s *GormNodeSyncService) groupTunnelsQuery(groupID string) *gorm.DB {
+	return s.db.Model(&models.Tunnel{}).
+		Where("enabled = ? AND (ingress_group_id = ? OR egress_group_id = ? OR id IN (?) OR egress_group_id IN (?))", true, groupID, groupID,
+			s.db.Model(&models.TunnelHop{}).Select("tunnel_id").Where("group_id = ?", groupID),
+			s.db.Model(&models.NodeGroup{}).Select("id").Where("failover_group_id = ?", groupID))
+}
 
-	return s.OnTunnelCreated(tunnel) /* 更新和创建的同步逻辑相同 */
+/*
+EgressTunnelIDs 获取以指定节点组为出口的启用隧道
+*/
+func (s *GormNodeSyncService) EgressTunnelIDs(groupID string) []string {
+	var tunnelIDs []string
+	s.db.Model(&models.Tunnel{}).
+		Where("egress_group_id = ? AND enabled = ?", groupID, true).
+		Order("id").
+		Pluck("id", &tunnelIDs)
+	return tunnelIDs
 }
 
 /*
 OnTunnelDeleted 隧道删除后触发同步
-功能：通知关联节点删除对应的转发规则
+功能：为入口、出口及各中继组记录删除变更，并通知这些组的在线节点移除对应规则
 */
-func (s *GormNodeSyncService) OnTunnelDeleted(tunnelID, ingressGroupID, egressGroupID string) error {
+func (s *GormNodeSyncService) OnTunnelDeleted(ctx context.Context, tunnelID, ingressGroupID, egressGroupID string, relayGroupIDs ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "GormNodeSyncService.OnTunnelDeleted", attribute.String("gkipass.tunnel.id", tunnelID))
+	defer func() { tracing.End(span, err) }()
+
 	s.logger.Info("隧道删除，触发规则清理",
 		zap.String("tunnel_id", tunnelID))
 
-	deleteMsg := &DeleteRuleMessage{TunnelID: tunnelID}
+	groupIDs := append([]string{ingressGroupID, egressGroupID}, relayGroupIDs...)
+	if _, err := s.journal.RecordChange(tunnelID, models.RuleChangeDelete, groupIDs...); err != nil {
+		return err
+	}
 
-	/* 通知入口组节点 */
-	if ingressGroupID != "" {
-		nodeIDs := s.getOnlineNodeIDsByGroup(ingressGroupID)
-		if len(nodeIDs) > 0 {
-			if err := s.wsSender.SendToGroup(nodeIDs, "delete_rule", deleteMsg); err != nil {
-				s.logger.Error("通知入口组删除规则失败", zap.Error(err))
-			}
+	s.pushChanges(ctx, groupIDs)
+	return nil
+}
+
+/*
+onTunnelChanged 记录隧道在其经过的所有节点组上的变更并推送
+*/
+func (s *GormNodeSyncService) onTunnelChanged(ctx context.Context, tunnel *models.Tunnel) error {
+	groupIDs, err := s.recordTunnelChange(ctx, tunnel)
+	if err != nil {
+		return err
+	}
+
+	s.pushChanges(ctx, groupIDs)
+	return nil
+}
+
+/*
+recordTunnelUpdate 记录隧道更新的变更
+功能：不再经过的组记录删除变更，当前经过的组记录更新变更，返回需要推送的全部节点组
+*/
+func (s *GormNodeSyncService) recordTunnelUpdate(ctx context.Context, tunnel *models.Tunnel, previousGroupIDs []string) ([]string, error) {
+	current := make(map[string]bool)
+	for _, groupID := range s.tunnelGroupIDs(tunnel) {
+		current[groupID] = true
+	}
+
+	removed := make([]string, 0)
+	for _, groupID := range previousGroupIDs {
+		if groupID != "" && !current[groupID] {
+			removed = append(removed, groupID)
+		}
+	}
+	if len(removed) > 0 {
+		if _, err := s.journal.RecordChange(tunnel.ID, models.RuleChangeDelete, removed...); err != nil {
+			return nil, err
 		}
+		trace.SpanFromContext(ctx).SetAttributes(attribute.StringSlice("gkipass.sync.removed_groups", removed))
+	}
+
+	groupIDs, err := s.recordTunnelChange(ctx, tunnel)
+	if err != nil {
+		return nil, err
+	}
+	return append(groupIDs, removed...), nil
+}
+
+/*
+recordTunnelChange 记录隧道在其经过的所有节点组上的更新变更，返回这些节点组
+*/
+func (s *GormNodeSyncService) recordTunnelChange(ctx context.Context, tunnel *models.Tunnel) ([]string, error) {
+	/* 生成加密密钥（如果启用加密） */
+	if tunnel.EnableEncryption {
+		if _, err := s.encKeySvc.EnsureKeyForTunnel(tunnel); err != nil {
+			s.logger.Error("生成加密密钥失败", zap.Error(err))
+		}
+	}
+
+	groupIDs := s.tunnelGroupIDs(tunnel)
+	version, err := s.journal.RecordChange(tunnel.ID, models.RuleChangeUpsert, groupIDs...)
+	if err != nil {
+		return nil, err
 	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int64("gkipass.sync.version", version),
+		attribute.StringSlice("gkipass.sync.groups", groupIDs))
 
-	/* 通知出口组节点 */
-	if egressGroupID != "" && egressGroupID != ingressGroupID {
-		nodeIDs := s.getOnlineNodeIDsByGroup(egressGroupID)
-		if len(nodeIDs) > 0 {
-			if err := s.wsSender.SendToGroup(nodeIDs, "delete_rule", deleteMsg); err != nil {
-				s.logger.Error("通知出口组删除规则失败", zap.Error(err))
+	return groupIDs, nil
+}
+
+/*
+pushChanges 向指定组的在线节点推送各自确认版本之后的差异
+功能：按节点确认版本计算差异，之前推送失败或未确认的变更会在本次一并补发
+*/
+func (s *GormNodeSyncService) pushChanges(ctx context.Context, groupIDs []string) {
+	pushed := make(map[string]bool)
+	for _, groupID := range uniqueGroupIDs(groupIDs) {
+		for _, nodeID := range s.getOnlineNodeIDsByGroup(groupID) {
+			if pushed[nodeID] {
+				continue
+			}
+			pushed[nodeID] = true
+
+			if err := s.SyncNodeSince(ctx, nodeID, s.journal.AckedVersion(nodeID)); err != nil {
+				s.logger.Error("推送规则变更失败",
+					zap.String("node_id", nodeID),
+					zap.String("group_id", groupID),
+					zap.Error(err))
 			}
 		}
 	}
+}
+
+/*
+tunnelGroupIDs 获取隧道经过的所有节点组（入口、出口、中继及出口组的容灾组）
+*/
+func (s *GormNodeSyncService) tunnelGroupIDs(tunnel *models.Tunnel) []string {
+	groupIDs := []string{tunnel.IngressGroupID, tunnel.EgressGroupID}
+	for _, hop := range s.loadTunnelHops(tunnel) {
+		groupIDs = append(groupIDs, hop.GroupID)
+	}
+	if tunnel.EgressGroupID != "" {
+		var egressGroup models.NodeGroup
+		if err := s.db.Select("failover_group_id").First(&egressGroup, "id = ?", tunnel.EgressGroupID).Error; err == nil {
+			groupIDs = append(groupIDs, egressGroup.FailoverGroupID)
+		}
+	}
+	return uniqueGroupIDs(groupIDs)
+}
+
+/*
+TunnelGroupIDs 获取隧道当前经过的所有节点组
+功能：供更新/删除前记录原节点组，以便通知不再经过的组移除规则
+*/
+func (s *GormNodeSyncService) TunnelGroupIDs(tunnelID string) []string {
+	var tunnel models.Tunnel
+	if err := s.db.First(&tunnel, "id = ?", tunnelID).Error; err != nil {
+		return nil
+	}
+	return s.tunnelGroupIDs(&tunnel)
+}
+
+/*
+ResyncNode 按节点上报的已应用版本同步规则
+功能：节点注册（含重连）或发现版本缺口时调用。以节点自报版本覆盖确认版本，
+日志可覆盖时只推送差异，否则全量同步；节点重启后上报 0，始终全量同步
+*/
+func (s *GormNodeSyncService) ResyncNode(ctx context.Context, nodeID string, rulesVersion int64) error {
+	if err := s.journal.ResetAck(nodeID, rulesVersion); err != nil {
+		s.logger.Warn("重置节点同步版本失败", zap.String("node_id", nodeID), zap.Error(err))
+	}
+	return s.SyncNodeSince(ctx, nodeID, rulesVersion)
+}
+
+/*
+AckNodeVersion 记录节点确认已应用的版本
+功能：failedRules 为节点应用失败的隧道 ID，分批发布据此判定新规则是否应用成功
+*/
+func (s *GormNodeSyncService) AckNodeVersion(nodeID string, version int64, failedRules ...string) error {
+	if err := s.journal.Ack(nodeID, version); err != nil {
+		return err
+	}
+	s.rollouts.observeAck(nodeID, version, failedRules)
+	return nil
+}
+
+/* Rollouts 返回规则分批发布控制器，未启用时为 nil */
+func (s *GormNodeSyncService) Rollouts() *RolloutController {
+	return s.rollouts
+}
+
+/*
+SyncNodeSince 增量同步规则到指定节点
+功能：推送节点所在组自 since 版本以来变更的规则，tunnelIDs 为需额外重新下发的隧道
+（分批发布推进或回滚时，节点确认版本已覆盖这些隧道的变更）。以下情况回退为全量同步：
+- since 为 0（节点首次连接或重启）
+- 节点所在组与上次全量同步时不同（新组的存量规则不在日志差异中）
+- 日志已被压缩到 since 之后，或 since 超过当前版本
+*/
+func (s *GormNodeSyncService) SyncNodeSince(ctx context.Context, nodeID string, since int64, tunnelIDs ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "GormNodeSyncService.SyncNodeSince",
+		attribute.String("gkipass.node.id", nodeID),
+		attribute.Int64("gkipass.sync.since", since))
+	defer func() { tracing.End(span, err) }()
+
+	if since <= 0 {
+		return s.SyncAllRulesToNode(ctx, nodeID)
+	}
+
+	var node models.Node
+	if err := s.db.Preload("Groups").First(&node, "id = ?", nodeID).Error; err != nil {
+		return fmt.Errorf("节点不存在: %s", nodeID)
+	}
+	groupIDs := make([]string, 0, len(node.Groups))
+	for _, group := range node.Groups {
+		groupIDs = append(groupIDs, group.ID)
+	}
+
+	state := s.journal.GetNodeState(nodeID)
+	if state == nil || state.GroupKey != GroupKey(groupIDs) {
+		s.logger.Info("节点所在组已变化，回退全量同步", zap.String("node_id", nodeID))
+		return s.SyncAllRulesToNode(ctx, nodeID)
+	}
+
+	current := s.journal.CurrentVersion()
+	changes, complete, err := s.journal.ChangesSince(groupIDs, since, current)
+	if err != nil {
+		return err
+	}
+	if !complete {
+		s.logger.Info("变更日志无法覆盖节点版本，回退全量同步",
+			zap.String("node_id", nodeID),
+			zap.Int64("since", since),
+			zap.Int64("current", current))
+		return s.SyncAllRulesToNode(ctx, nodeID)
+	}
+	if current <= since && len(tunnelIDs) == 0 {
+		return nil
+	}
+	for _, tunnelID := range tunnelIDs {
+		changes = append(changes, models.RuleChange{TunnelID: tunnelID, Action: models.RuleChangeUpsert})
+	}
+
+	rules, deleted := s.buildChangedRules(changes, groupIDs, s.rollouts.heldRules(nodeID))
+	span.SetAttributes(
+		attribute.Int64("gkipass.sync.version", current),
+		attribute.Int("gkipass.sync.rules", len(rules)),
+		attribute.Int("gkipass.sync.deleted", len(deleted)))
+	syncMsg := &SyncRulesMessage{
+		Rules:       rules,
+		Deleted:     deleted,
+		Force:       false,
+		Incremental: true,
+		BaseVersion: since,
+		Version:     strconv.FormatInt(current, 10),
+	}
+
+	if err := s.wsSender.SendToNode(ctx, nodeID, "sync_rules", syncMsg); err != nil {
+		return fmt.Errorf("推送增量规则到节点失败: %w", err)
+	}
+
+	s.logger.Info("增量同步规则到节点完成",
+		zap.String("node_id", nodeID),
+		zap.Int64("since", since),
+		zap.Int64("version", current),
+		zap.Int("changes", len(changes)),
+		zap.Int("rule_count", len(rules)),
+		zap.Int("deleted", len(deleted)))
 
 	return nil
 }
 
+/*
+buildChangedRules 将变更记录折叠为节点应用的规则和删除列表
+功能：按隧道当前状态决定结果，而非逐条回放动作——
+隧道已删除、已禁用或不再经过节点所在的任何组时删除，否则按节点所在的每个相关组下发最新规则；
+held 中的隧道改为下发快照里节点所在组的规则（快照中没有则删除）
+*/
+func (s *GormNodeSyncService) buildChangedRules(changes []models.RuleChange, nodeGroupIDs []string, held RuleSnapshot) ([]SyncRulePayload, []string) {
+	nodeGroups := make(map[string]bool, len(nodeGroupIDs))
+	for _, groupID := range nodeGroupIDs {
+		nodeGroups[groupID] = true
+	}
+
+	tunnelIDs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, change := range changes {
+		if !seen[change.TunnelID] {
+			seen[change.TunnelID] = true
+			tunnelIDs = append(tunnelIDs, change.TunnelID)
+		}
+	}
+
+	rules := make([]SyncRulePayload, 0, len(tunnelIDs))
+	deleted := make([]string, 0)
+	for _, tunnelID := range tunnelIDs {
+		if snapshot, ok := held[tunnelID]; ok {
+			built := false
+			for _, groupID := range nodeGroupIDs {
+				if rule, ok := snapshot[groupID]; ok {
+					rules = append(rules, rule)
+					built = true
+				}
+			}
+			if !built {
+				deleted = append(deleted, tunnelID)
+			}
+			continue
+		}
+
+		var tunnel models.Tunnel
+		err := s.db.Preload("Targets").Preload("Rules").First(&tunnel, "id = ?", tunnelID).Error
+		if err != nil || !tunnel.Enabled {
+			deleted = append(deleted, tunnelID)
+			continue
+		}
+
+		built := false
+		for _, groupID := range s.tunnelGroupIDs(&tunnel) {
+			if !nodeGroups[groupID] {
+				continue
+			}
+			payload, err := s.buildRulePayloadForGroup(&tunnel, groupID)
+			if err != nil {
+				s.logger.Warn("构建规则payload失败",
+					zap.String("tunnel_id", tunnelID),
+					zap.Error(err))
+				continue
+			}
+			rules = append(rules, *payload)
+			built = true
+		}
+		if !built {
+			deleted = append(deleted, tunnelID)
+		}
+	}
+
+	return rules, deleted
+}
+
 /*
 SyncAllRulesToNode 全量同步规则到指定节点
 功能：将节点所在组的所有启用隧道规则推送到该节点，
 通常在节点首次注册或重连时调用
 */
-func (s *GormNodeSyncService) SyncAllRulesToNode(nodeID string) error {
+func (s *GormNodeSyncService) SyncAllRulesToNode(ctx context.Context, nodeID string) (err error) {
+	ctx, span := tracing.Start(ctx, "GormNodeSyncService.SyncAllRulesToNode", attribute.String("gkipass.node.id", nodeID))
+	defer func() { tracing.End(span, err) }()
+
 	/* 查询节点信息 */
 	var node models.Node
 	if err := s.db.Preload("Groups").First(&node, "id = ?", nodeID).Error; err != nil {
 		return fmt.Errorf("节点不存在: %s", nodeID)
 	}
 
+	/* 先取版本再构建规则，构建期间的新变更留给下一次差异推送 */
+	version := s.journal.CurrentVersion()
+
 	/* 收集节点所在所有组的隧道 */
 	allRules := make([]SyncRulePayload, 0)
+	groupIDs := make([]string, 0, len(node.Groups))
+	held := s.rollouts.heldRules(nodeID)
 
 	for _, group := range node.Groups {
-		rules, err := s.buildRulesForGroup(group.ID)
+		groupIDs = append(groupIDs, group.ID)
+		rules, err := s.buildRulesForGroup(group.ID, held)
 		if err != nil {
 			s.logger.Error("构建组规则失败",
 				zap.String("group_id", group.ID),
@@ -217,16 +728,23 @@ func (s *GormNodeSyncService) SyncAllRulesToNode(nodeID string) error {
 	}
 
 	/* 推送全量规则 */
+	span.SetAttributes(
+		attribute.Int64("gkipass.sync.version", version),
+		attribute.Int("gkipass.sync.rules", len(allRules)))
 	syncMsg := &SyncRulesMessage{
 		Rules:   allRules,
 		Force:   true,
-		Version: fmt.Sprintf("%d", time.Now().Unix()),
+		Version: strconv.FormatInt(version, 10),
 	}
 
-	if err := s.wsSender.SendToNode(nodeID, "sync_rules", syncMsg); err != nil {
+	if err := s.wsSender.SendToNode(ctx, nodeID, "sync_rules", syncMsg); err != nil {
 		return fmt.Errorf("推送规则到节点失败: %w", err)
 	}
 
+	if err := s.journal.MarkFullSync(nodeID, groupIDs); err != nil {
+		s.logger.Warn("记录全量同步状态失败", zap.String("node_id", nodeID), zap.Error(err))
+	}
+
 	s.logger.Info("全量同步规则到节点完成",
 		zap.String("node_id", nodeID),
 		zap.Int("rule_count", len(allRules)))
@@ -238,14 +756,16 @@ func (s *GormNodeSyncService) SyncAllRulesToNode(nodeID string) error {
 SyncAllRulesToGroup 全量同步规则到节点组
 功能：将组内所有启用隧道的规则推送到组内所有在线节点
 */
-func (s *GormNodeSyncService) SyncAllRulesToGroup(groupID string) error {
+func (s *GormNodeSyncService) SyncAllRulesToGroup(ctx context.Context, groupID string) error {
 	nodeIDs := s.getOnlineNodeIDsByGroup(groupID)
 	if len(nodeIDs) == 0 {
 		s.logger.Debug("组内无在线节点", zap.String("group_id", groupID))
 		return nil
 	}
 
-	rules, err := s.buildRulesForGroup(groupID)
+	/* 组内节点同时下发，不区分分批发布中各节点的进度 */
+	version := s.journal.CurrentVersion()
+	rules, err := s.buildRulesForGroup(groupID, nil)
 	if err != nil {
 		return fmt.Errorf("构建组规则失败: %w", err)
 	}
@@ -253,10 +773,10 @@ func (s *GormNodeSyncService) SyncAllRulesToGroup(groupID string) error {
 	syncMsg := &SyncRulesMessage{
 		Rules:   rules,
 		Force:   true,
-		Version: fmt.Sprintf("%d", time.Now().Unix()),
+		Version: strconv.FormatInt(version, 10),
 	}
 
-	if err := s.wsSender.SendToGroup(nodeIDs, "sync_rules", syncMsg); err != nil {
+	if err := s.wsSender.SendToGroup(ctx, nodeIDs, "sync_rules", syncMsg); err != nil {
 		return fmt.Errorf("推送规则到组失败: %w", err)
 	}
 
@@ -292,38 +812,15 @@ func (s *GormNodeSyncService) CheckGlobalPortConflict(groupID string, port int,
 	return true, tunnel.Name, nil /* 有冲突，返回占用的隧道名称 */
 }
 
-/*
-syncTunnelToGroup 同步单个隧道到节点组
-*/
-func (s *GormNodeSyncService) syncTunnelToGroup(tunnel *models.Tunnel, groupID string) error {
-	nodeIDs := s.getOnlineNodeIDsByGroup(groupID)
-	if len(nodeIDs) == 0 {
-		return nil
-	}
-
-	payload, err := s.buildRulePayload(tunnel)
-	if err != nil {
-		return err
-	}
-
-	syncMsg := &SyncRulesMessage{
-		Rules:   []SyncRulePayload{*payload},
-		Force:   false,
-		Version: fmt.Sprintf("%d", time.Now().Unix()),
-	}
-
-	return s.wsSender.SendToGroup(nodeIDs, "sync_rules", syncMsg)
-}
-
 /*
 buildRulesForGroup 构建节点组的全量规则列表
+功能：held 中的隧道以快照里该组的规则代替当前配置
 */
-func (s *GormNodeSyncService) buildRulesForGroup(groupID string) ([]SyncRulePayload, error) {
+func (s *GormNodeSyncService) buildRulesForGroup(groupID string, held RuleSnapshot) ([]SyncRulePayload, error) {
 	var tunnels []models.Tunnel
-	err := s.db.
+	err := s.groupTunnelsQuery(groupID).
 		Preload("Targets").
 		Preload("Rules").
-		Where("enabled = ? AND (ingress_group_id = ? OR egress_group_id = ?)", true, groupID, groupID).
 		Find(&tunnels).Error
 
 	if err != nil {
@@ -332,7 +829,10 @@ func (s *GormNodeSyncService) buildRulesForGroup(groupID string) ([]SyncRulePayl
 
 	rules := make([]SyncRulePayload, 0, len(tunnels))
 	for i := range tunnels {
-		payload, err := s.buildRulePayload(&tunnels[i])
+		if _, ok := held[tunnels[i].ID]; ok {
+			continue
+		}
+		payload, err := s.buildRulePayloadForGroup(&tunnels[i], groupID)
 		if err != nil {
 			s.logger.Warn("构建规则payload失败",
 				zap.String("tunnel_id", tunnels[i].ID),
@@ -342,9 +842,43 @@ func (s *GormNodeSyncService) buildRulesForGroup(groupID string) ([]SyncRulePayl
 		rules = append(rules, *payload)
 	}
 
+	heldIDs := make([]string, 0, len(held))
+	for tunnelID := range held {
+		heldIDs = append(heldIDs, tunnelID)
+	}
+	sort.Strings(heldIDs)
+	for _, tunnelID := range heldIDs {
+		if rule, ok := held[tunnelID][groupID]; ok {
+			rules = append(rules, rule)
+		}
+	}
+
 	return rules, nil
 }
 
+/*
+tunnelRules 构建隧道面向其经过的每个节点组的当前规则，隧道不存在或已禁用时为空
+*/
+func (s *GormNodeSyncService) tunnelRules(tunnelID string) map[string]SyncRulePayload {
+	rules := make(map[string]SyncRulePayload)
+
+	var tunnel models.Tunnel
+	if err := s.db.Preload("Targets").Preload("Rules").First(&tunnel, "id = ?", tunnelID).Error; err != nil || !tunnel.Enabled {
+		return rules
+	}
+	for _, groupID := range s.tunnelGroupIDs(&tunnel) {
+		payload, err := s.buildRulePayloadForGroup(&tunnel, groupID)
+		if err != nil {
+			s.logger.Warn("构建规则payload失败",
+				zap.String("tunnel_id", tunnelID),
+				zap.Error(err))
+			continue
+		}
+		rules[groupID] = *payload
+	}
+	return rules
+}
+
 /*
 buildRulePayload 构建单个隧道的同步规则消息体
 */
@@ -353,6 +887,8 @@ func (s *GormNodeSyncService) buildRulePayload(tunnel *models.Tunnel) (*SyncRule
 		TunnelID:         tunnel.ID,
 		TunnelName:       tunnel.Name,
 		Protocol:         string(tunnel.Protocol),
+		IngressProtocol:  string(tunnel.IngressProtocol),
+		EgressProtocol:   string(tunnel.EgressProtocol),
 		ListenPort:       tunnel.ListenPort,
 		TargetAddress:    tunnel.TargetAddress,
 		TargetPort:       tunnel.TargetPort,
@@ -363,6 +899,18 @@ func (s *GormNodeSyncService) buildRulePayload(tunnel *models.Tunnel) (*SyncRule
 		MaxConnections:   tunnel.MaxConnections,
 		IdleTimeout:      tunnel.IdleTimeout,
 		UserID:           tunnel.CreatedBy,
+
+		SendProxyProtocol:   tunnel.SendProxyProtocol,
+		AcceptProxyProtocol: tunnel.AcceptProxyProtocol,
+		AllowedDomains:      DecodeAllowedDomains(tunnel.AllowedDomains),
+		AllowBind:           tunnel.AllowBind,
+		Hostnames:           DecodeHostnames(tunnel.Hostnames),
+		EgressGroupID:       tunnel.EgressGroupID,
+	}
+
+	/* 多跳链路 */
+	if hops := s.loadTunnelHops(tunnel); len(hops) > 0 {
+		payload.Hops = s.buildHopChain(tunnel, hops)
 	}
 
 	/* 填充目标列表 */
@@ -385,13 +933,67 @@ func (s *GormNodeSyncService) buildRulePayload(tunnel *models.Tunnel) (*SyncRule
 		}}
 	}
 
-	/* 获取规则版本号 */
-	var maxVersion int64
+	/* 规则版本号：取变更日志中该隧道的最新版本，节点据此跳过未变化的规则；日志已压缩时退回规则表版本 */
+	payload.Version = s.journal.TunnelVersion(tunnel.ID)
+	if payload.Version == 0 {
+		s.db.Model(&models.Rule{}).
+			Where("tunnel_id = ?", tunnel.ID).
+			Select("COALESCE(MAX(version), 1)").
+			Scan(&payload.Version)
+	}
+
+	/* 规则优先级：取该隧道启用规则的最高优先级 */
 	s.db.Model(&models.Rule{}).
-		Where("tunnel_id = ?", tunnel.ID).
-		Select("COALESCE(MAX(version), 1)").
-		Scan(&maxVersion)
-	payload.Version = maxVersion
+		Where("tunnel_id = ? AND enabled = ?", tunnel.ID, true).
+		Select("COALESCE(MAX(priority), 0)").
+		Scan(&payload.Priority)
+
+	/* 获取代理认证凭据：隧道凭据优先，其次为创建者的用户级凭据 */
+	var credentials []models.TunnelCredential
+	s.db.Where("tunnel_id = ? AND enabled = ?", tunnel.ID, true).Find(&credentials)
+	usernames := make(map[string]bool, len(credentials))
+	for _, cred := range credentials {
+		usernames[cred.Username] = true
+		payload.Credentials = append(payload.Credentials, SyncCredentialPayload{
+			Username:     cred.Username,
+			PasswordHash: cred.PasswordHash,
+			Salt:         cred.Salt,
+		})
+	}
+	if tunnel.CreatedBy != "" {
+		var userCredentials []models.UserProxyCredential
+		s.db.Where("user_id = ? AND enabled = ?", tunnel.CreatedBy, true).Find(&userCredentials)
+		for _, cred := range userCredentials {
+			if usernames[cred.Username] {
+				continue
+			}
+			payload.Credentials = append(payload.Credentials, SyncCredentialPayload{
+				Username:     cred.Username,
+				PasswordHash: cred.PasswordHash,
+				Salt:         cred.Salt,
+			})
+		}
+	}
+
+	/* 代理入口没有任何启用的凭据时不下发，节点随之移除该规则，避免成为开放代理 */
+	if isProxyIngress(tunnel.IngressProtocol) && len(payload.Credentials) == 0 {
+		return nil, fmt.Errorf("代理入口隧道 %s 没有启用的认证凭据，拒绝下发", tunnel.ID)
+	}
+
+	/* 访问控制：汇总该隧道各规则的 ACL */
+	var acls []models.ACLRule
+	s.db.Where("rule_id IN (?)", s.db.Model(&models.Rule{}).Select("id").Where("tunnel_id = ?", tunnel.ID)).
+		Order("priority DESC").
+		Find(&acls)
+	for _, acl := range acls {
+		payload.ACL = append(payload.ACL, SyncACLPayload{
+			Action:    acl.Action,
+			SourceIP:  acl.SourceIP,
+			DestIP:    acl.DestIP,
+			Protocol:  acl.Protocol,
+			PortRange: acl.PortRange,
+		})
+	}
 
 	/* 获取加密密钥 */
 	if tunnel.EnableEncryption {
@@ -404,38 +1006,196 @@ func (s *GormNodeSyncService) buildRulePayload(tunnel *models.Tunnel) (*SyncRule
 	/*
 		填充出口容灾策略
 		当隧道绑定了出口组且该组配置了容灾组时，
-		查询容灾组内在线节点的公网 IP，作为 FailoverTargets 下发
+		容灾组节点的隧道地址（与主链路相同的监听端口）作为 FailoverTargets 下发，容灾组同时收到出口角色的规则
 	*/
 	if tunnel.EgressGroupID != "" {
 		var egressGroup models.NodeGroup
-		if err := s.db.First(&egressGroup, "id = ?", tunnel.EgressGroupID).Error; err == nil && egressGroup.FailoverGroupID != "" {
+		err := s.db.First(&egressGroup, "id = ?", tunnel.EgressGroupID).Error
+		if err == nil && egressGroup.ReverseMode {
+			payload.Reverse = true
+		}
+		if err == nil && egressGroup.FailoverGroupID != "" {
 			payload.FailoverGroupID = egressGroup.FailoverGroupID
 			payload.FailoverTimeout = egressGroup.FailoverTimeout
 			payload.FailoverAutoRecover = egressGroup.FailoverAutoRecover
 
-			/* 查询容灾组内在线节点作为备用目标 */
-			var failoverNodes []models.Node
-			s.db.Model(&models.Node{}).
-				Joins("JOIN node_group_nodes ON node_group_nodes.node_id = nodes.id").
-				Where("node_group_nodes.group_id = ? AND nodes.status = ?", egressGroup.FailoverGroupID, models.NodeStatusOnline).
-				Find(&failoverNodes)
-
-			for _, node := range failoverNodes {
-				if node.PublicIP != "" {
-					payload.FailoverTargets = append(payload.FailoverTargets, SyncTargetPayload{
-						Host:    node.PublicIP,
-						Port:    tunnel.TargetPort,
-						Weight:  1,
-						Enabled: true,
-					})
-				}
-			}
+			/* 容灾组节点以出口角色承载该隧道，与主链路一样在隧道监听端口接收上一跳流量 */
+			payload.FailoverTargets = s.getHopNodes(egressGroup.FailoverGroupID, "", tunnel.ListenPort)
+		}
+	}
+
+	return payload, nil
+}
+
+/*
+buildRulePayloadForGroup 构建面向指定节点组的同步规则
+功能：在通用规则基础上标注该组在多跳链路中的角色和下一跳
+*/
+func (s *GormNodeSyncService) buildRulePayloadForGroup(tunnel *models.Tunnel, groupID string) (*SyncRulePayload, error) {
+	payload, err := s.buildRulePayload(tunnel)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, hop := range payload.Hops {
+		if hop.GroupID != groupID {
+			continue
+		}
+		payload.Role = hop.Role
+		payload.HopIndex = hop.Index
+		if i+1 < len(payload.Hops) {
+			next := payload.Hops[i+1]
+			payload.NextHop = &next
+		}
+		break
+	}
+
+	/* 容灾出口组：替代主出口接收上一跳流量并连接最终目标，自身不再容灾 */
+	if payload.FailoverGroupID == groupID && payload.Role == "" {
+		payload.Role = HopRoleEgress
+		payload.HopIndex = 1
+		if n := len(payload.Hops); n > 0 {
+			payload.HopIndex = payload.Hops[n-1].Index
+		}
+		payload.FailoverGroupID = ""
+		payload.FailoverTargets = nil
+		payload.FailoverTimeout = 0
+		payload.FailoverAutoRecover = false
+		payload.Reverse = false
+		return payload, nil
+	}
+
+	/* 反向隧道：出口组获得上一跳地址，出口组与上一跳获得握手密钥 */
+	if payload.Reverse {
+		peerGroupID, peerNodeID := tunnel.IngressGroupID, tunnel.IngressNodeID
+		if n := len(payload.Hops); n > 2 {
+			peerGroupID, peerNodeID = payload.Hops[n-2].GroupID, payload.Hops[n-2].NodeID
+		}
+
+		switch groupID {
+		case tunnel.EgressGroupID:
+			payload.ReversePeers = s.getHopNodes(peerGroupID, peerNodeID, tunnel.ListenPort)
+			payload.ReverseSecret = s.ensureReverseSecret(tunnel)
+		case peerGroupID:
+			payload.ReverseSecret = s.ensureReverseSecret(tunnel)
 		}
 	}
 
 	return payload, nil
 }
 
+/*
+ensureReverseSecret 获取隧道的反向握手密钥，旧隧道缺失时补全并保存
+*/
+func (s *GormNodeSyncService) ensureReverseSecret(tunnel *models.Tunnel) string {
+	if tunnel.ReverseSecret != "" {
+		return tunnel.ReverseSecret
+	}
+
+	secret, err := newReverseSecret()
+	if err != nil {
+		s.logger.Error("生成反向隧道密钥失败", zap.String("tunnel_id", tunnel.ID), zap.Error(err))
+		return ""
+	}
+	if err := s.db.Model(&models.Tunnel{}).Where("id = ?", tunnel.ID).Update("reverse_secret", secret).Error; err != nil {
+		s.logger.Error("保存反向隧道密钥失败", zap.String("tunnel_id", tunnel.ID), zap.Error(err))
+		return ""
+	}
+	tunnel.ReverseSecret = secret
+	return secret
+}
+
+/*
+loadTunnelHops 获取隧道的中继跳（按顺序）
+*/
+func (s *GormNodeSyncService) loadTunnelHops(tunnel *models.Tunnel) []models.TunnelHop {
+	if len(tunnel.Hops) > 0 {
+		return tunnel.Hops
+	}
+	var hops []models.TunnelHop
+	s.db.Where("tunnel_id = ?", tunnel.ID).Order("position").Find(&hops)
+	return hops
+}
+
+/*
+buildHopChain 构建完整的多跳链路
+功能：入口（序号 0）→ 中继（1..N）→ 出口（N+1），中继与出口附带节点隧道地址
+*/
+func (s *GormNodeSyncService) buildHopChain(tunnel *models.Tunnel, hops []models.TunnelHop) []SyncHopPayload {
+	chain := make([]SyncHopPayload, 0, len(hops)+2)
+	chain = append(chain, SyncHopPayload{
+		Index:    0,
+		Role:     HopRoleIngress,
+		GroupID:  tunnel.IngressGroupID,
+		NodeID:   tunnel.IngressNodeID,
+		Protocol: string(tunnel.IngressProtocol),
+		Nodes:    s.getHopNodes(tunnel.IngressGroupID, tunnel.IngressNodeID, tunnel.ListenPort),
+	})
+
+	for _, hop := range hops {
+		chain = append(chain, SyncHopPayload{
+			Index:    hop.Position,
+			Role:     HopRoleRelay,
+			GroupID:  hop.GroupID,
+			NodeID:   hop.NodeID,
+			Protocol: string(hop.Protocol),
+			Nodes:    s.getHopNodes(hop.GroupID, hop.NodeID, tunnel.ListenPort),
+		})
+	}
+
+	chain = append(chain, SyncHopPayload{
+		Index:    len(hops) + 1,
+		Role:     HopRoleEgress,
+		GroupID:  tunnel.EgressGroupID,
+		NodeID:   tunnel.EgressNodeID,
+		Protocol: string(tunnel.Protocol),
+		Nodes:    s.getHopNodes(tunnel.EgressGroupID, tunnel.EgressNodeID, tunnel.ListenPort),
+	})
+
+	return chain
+}
+
+/*
+getHopNodes 获取一跳可接收流量的节点隧道地址
+功能：指定节点时只返回该节点，否则返回组内未禁用的节点；离线节点标记为不可用。
+节点ID与CA公钥固定一并下发，相邻节点据此互相校验证书（入口跳的节点供下一跳校验来连的入口）。
+每一跳的规则都在隧道监听端口上监听，port 传入 tunnel.ListenPort（节点的 Port 是控制端口，不承载隧道流量）
+*/
+func (s *GormNodeSyncService) getHopNodes(groupID, nodeID string, port int) []SyncTargetPayload {
+	var nodes []models.Node
+	query := s.db.Model(&models.Node{}).Where("nodes.status != ?", models.NodeStatusDisabled)
+	if nodeID != "" {
+		query = query.Where("nodes.id = ?", nodeID)
+	} else if groupID != "" {
+		query = query.
+			Joins("JOIN node_group_nodes ON node_group_nodes.node_id = nodes.id").
+			Where("node_group_nodes.group_id = ?", groupID)
+	} else {
+		return nil
+	}
+	query.Find(&nodes)
+
+	targets := make([]SyncTargetPayload, 0, len(nodes))
+	for _, node := range nodes {
+		host := node.PublicIP
+		if host == "" {
+			host = node.IPAddress
+		}
+		if host == "" || port == 0 {
+			continue
+		}
+		targets = append(targets, SyncTargetPayload{
+			Host:    host,
+			Port:    port,
+			Weight:  1,
+			Enabled: node.Status == models.NodeStatusOnline,
+			NodeID:  node.ID,
+			CertPin: node.CertPin,
+		})
+	}
+	return targets
+}
+
 /*
 getOnlineNodeIDsByGroup 获取组内在线节点ID列表
 */
@@ -492,12 +1252,26 @@ func (s *GormNodeSyncService) GetNodeSyncStatus(nodeID string) (map[string]inter
 		totalRules += int(count)
 	}
 
-	return map[string]interface{}{
-		"node_id":        nodeID,
-		"node_name":      node.Name,
-		"node_status":    string(node.Status),
-		"groups":         len(node.Groups),
-		"expected_rules": totalRules,
-		"last_sync":      time.Now().Format(time.RFC3339),
-	}, nil
+	status := map[string]interface{}{
+		"node_id":         nodeID,
+		"node_name":       node.Name,
+		"node_status":     string(node.Status),
+		"groups":          len(node.Groups),
+		"expected_rules":  totalRules,
+		"current_version": s.journal.CurrentVersion(),
+		"acked_version":   int64(0),
+	}
+
+	/* 节点确认版本落后于当前版本时说明有未应用的变更 */
+	if state := s.journal.GetNodeState(nodeID); state != nil {
+		status["acked_version"] = state.AckedVersion
+		if !state.AckedAt.IsZero() {
+			status["last_sync"] = state.AckedAt.Format(time.RFC3339)
+		}
+		if !state.LastFullSyncAt.IsZero() {
+			status["last_full_sync"] = state.LastFullSyncAt.Format(time.RFC3339)
+		}
+	}
+
+	return status, nil
 }
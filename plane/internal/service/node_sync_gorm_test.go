@@ -0,0 +1,264 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/*
+setupHopChainTest 创建多跳链路测试环境
+功能：入口组 ingress(n1) → 中继组 relay(n2) → 出口组 egress(n3)，
+节点控制端口均为 9000，隧道监听端口为 10001
+*/
+func setupHopChainTest(t *testing.T) (*gorm.DB, *GormNodeSyncService, *models.Tunnel) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	createNodeGroupNodesTable(db)
+	err = db.AutoMigrate(&models.Node{}, &models.NodeGroup{}, &models.Tunnel{}, &models.TunnelTarget{},
+		&models.TunnelHop{}, &models.Rule{}, &models.TunnelCredential{}, &models.UserProxyCredential{},
+		&models.RuleChange{}, &models.RuleChangeSequence{}, &models.NodeSyncState{})
+	if err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+
+	for _, g := range []struct {
+		id, node, ip string
+		role         models.NodeRole
+	}{
+		{"ingress", "n1", "198.51.100.1", models.NodeRoleIngress},
+		{"relay", "n2", "198.51.100.2", models.NodeRoleBoth},
+		{"egress", "n3", "198.51.100.3", models.NodeRoleEgress},
+	} {
+		group := models.NodeGroup{Name: g.id, Role: g.role}
+		group.ID = g.id
+		db.Create(&group)
+		node := models.Node{Name: g.node, Status: models.NodeStatusOnline, PublicIP: g.ip, Port: 9000}
+		node.ID = g.node
+		if err := db.Create(&node).Error; err != nil {
+			t.Fatalf("创建节点失败: %v", err)
+		}
+		addGroupMember(db, g.id, g.node)
+	}
+
+	tunnel := &models.Tunnel{
+		Name:            "多跳隧道",
+		Enabled:         true,
+		CreatedBy:       "user-1",
+		IngressGroupID:  "ingress",
+		EgressGroupID:   "egress",
+		Protocol:        models.ProtocolTCP,
+		IngressProtocol: models.ProtocolTCP,
+		ListenPort:      10001,
+		TargetAddress:   "127.0.0.1",
+		TargetPort:      80,
+	}
+	tunnel.ID = "tunnel-hop"
+	db.Create(tunnel)
+	hop := models.TunnelHop{TunnelID: tunnel.ID, Position: 1, GroupID: "relay", Protocol: models.ProtocolTCP}
+	db.Create(&hop)
+
+	return db, NewGormNodeSyncService(db, &rolloutTestSender{sent: make(map[string][]*SyncRulesMessage)}), tunnel
+}
+
+/* TestBuildHopChain_NextHopUsesTunnelListenPort 下一跳地址使用该隧道的监听端口，而不是节点控制端口 */
+func TestBuildHopChain_NextHopUsesTunnelListenPort(t *testing.T) {
+	_, svc, tunnel := setupHopChainTest(t)
+
+	cases := []struct {
+		group    string
+		role     string
+		nextHost string
+	}{
+		{"ingress", HopRoleIngress, "198.51.100.2"},
+		{"relay", HopRoleRelay, "198.51.100.3"},
+	}
+	for _, tc := range cases {
+		payload, err := svc.buildRulePayloadForGroup(tunnel, tc.group)
+		if err != nil {
+			t.Fatalf("构建 %s 规则失败: %v", tc.group, err)
+		}
+		if payload.Role != tc.role {
+			t.Errorf("%s 的角色应为 %s，实际 %s", tc.group, tc.role, payload.Role)
+		}
+		if payload.NextHop == nil || len(payload.NextHop.Nodes) != 1 {
+			t.Fatalf("%s 应有一个下一跳节点", tc.group)
+		}
+		next := payload.NextHop.Nodes[0]
+		if next.Host != tc.nextHost || next.Port != tunnel.ListenPort {
+			t.Errorf("%s 的下一跳应为 %s:%d，实际 %s:%d", tc.group, tc.nextHost, tunnel.ListenPort, next.Host, next.Port)
+		}
+	}
+
+	egress, err := svc.buildRulePayloadForGroup(tunnel, "egress")
+	if err != nil {
+		t.Fatalf("构建出口规则失败: %v", err)
+	}
+	if egress.Role != HopRoleEgress || egress.NextHop != nil {
+		t.Errorf("出口节点不应有下一跳，角色 %s", egress.Role)
+	}
+	if egress.ListenPort != tunnel.ListenPort {
+		t.Errorf("出口节点应在隧道端口 %d 监听，实际 %d", tunnel.ListenPort, egress.ListenPort)
+	}
+	for _, hop := range egress.Hops {
+		for _, node := range hop.Nodes {
+			if node.Port == 9000 {
+				t.Errorf("第 %d 跳不应使用节点控制端口", hop.Index)
+			}
+		}
+	}
+}
+
+/* TestBuildHopChain_NodeCertPins 链路各跳节点携带节点ID与证书固定，入口跳也列出入口节点供下一跳校验 */
+func TestBuildHopChain_NodeCertPins(t *testing.T) {
+	db, svc, tunnel := setupHopChainTest(t)
+	for _, id := range []string{"n1", "n2", "n3"} {
+		db.Model(&models.Node{}).Where("id = ?", id).Update("cert_pin", "pin-"+id)
+	}
+
+	payload, err := svc.buildRulePayloadForGroup(tunnel, "relay")
+	if err != nil {
+		t.Fatalf("构建中继规则失败: %v", err)
+	}
+	if payload.NextHop == nil || len(payload.NextHop.Nodes) != 1 {
+		t.Fatal("中继应有一个下一跳节点")
+	}
+	if next := payload.NextHop.Nodes[0]; next.NodeID != "n3" || next.CertPin != "pin-n3" {
+		t.Errorf("下一跳应携带出口节点的ID与证书固定，实际 %s/%s", next.NodeID, next.CertPin)
+	}
+	ingress := payload.Hops[0]
+	if len(ingress.Nodes) != 1 || ingress.Nodes[0].NodeID != "n1" || ingress.Nodes[0].CertPin != "pin-n1" {
+		t.Errorf("入口跳应列出入口节点及其证书固定，实际 %+v", ingress.Nodes)
+	}
+}
+
+/* TestBuildRulePayload_Priority 下发隧道启用规则中的最高优先级 */
+func TestBuildRulePayload_Priority(t *testing.T) {
+	db, svc, tunnel := setupHopChainTest(t)
+	for i, priority := range []int{3, 9, 5} {
+		rule := models.Rule{Name: "r", Enabled: true, Priority: priority, TunnelID: tunnel.ID, ListenPort: 10001, TargetAddress: "127.0.0.1", TargetPort: 80}
+		rule.ID = fmt.Sprintf("rule-%d", i)
+		if err := db.Create(&rule).Error; err != nil {
+			t.Fatalf("创建规则失败: %v", err)
+		}
+	}
+	/* 停用的规则不参与 */
+	db.Model(&models.Rule{}).Where("priority = ?", 9).Update("enabled", false)
+
+	payload, err := svc.buildRulePayload(tunnel)
+	if err != nil {
+		t.Fatalf("构建规则失败: %v", err)
+	}
+	if payload.Priority != 5 {
+		t.Errorf("应下发启用规则的最高优先级 5，实际 %d", payload.Priority)
+	}
+}
+
+/* TestBuildRulePayload_ReversePeersUseTunnelListenPort 反向隧道出口回连上一跳的隧道端口 */
+func TestBuildRulePayload_ReversePeersUseTunnelListenPort(t *testing.T) {
+	db, svc, tunnel := setupHopChainTest(t)
+	db.Model(&models.NodeGroup{}).Where("id = ?", "egress").Update("reverse_mode", true)
+
+	payload, err := svc.buildRulePayloadForGroup(tunnel, "egress")
+	if err != nil {
+		t.Fatalf("构建出口规则失败: %v", err)
+	}
+	if len(payload.ReversePeers) != 1 {
+		t.Fatalf("出口应获得一个反向对端，实际 %d", len(payload.ReversePeers))
+	}
+	peer := payload.ReversePeers[0]
+	if peer.Host != "198.51.100.2" || peer.Port != tunnel.ListenPort {
+		t.Errorf("反向对端应为中继节点的隧道端口，实际 %s:%d", peer.Host, peer.Port)
+	}
+}
+
+/* TestBuildRulePayload_FailoverTargetsUseTunnelListenPort 容灾目标与主链路一样使用隧道监听端口，容灾组收到出口角色的规则 */
+func TestBuildRulePayload_FailoverTargetsUseTunnelListenPort(t *testing.T) {
+	db, svc, tunnel := setupHopChainTest(t)
+
+	backup := models.NodeGroup{Name: "backup", Role: models.NodeRoleEgress}
+	backup.ID = "backup"
+	db.Create(&backup)
+	node := models.Node{Name: "n4", Status: models.NodeStatusOnline, PublicIP: "198.51.100.4", Port: 9000}
+	node.ID = "n4"
+	db.Create(&node)
+	addGroupMember(db, "backup", "n4")
+	db.Model(&models.NodeGroup{}).Where("id = ?", "egress").Updates(map[string]interface{}{
+		"failover_group_id": "backup",
+		"failover_timeout":  15,
+	})
+
+	relay, err := svc.buildRulePayloadForGroup(tunnel, "relay")
+	if err != nil {
+		t.Fatalf("构建中继规则失败: %v", err)
+	}
+	if relay.FailoverGroupID != "backup" || len(relay.FailoverTargets) != 1 {
+		t.Fatalf("出口的上一跳应获得一个容灾目标，实际 %v", relay.FailoverTargets)
+	}
+	target := relay.FailoverTargets[0]
+	if target.Host != "198.51.100.4" || target.Port != tunnel.ListenPort || !target.Enabled {
+		t.Errorf("容灾目标应为 198.51.100.4:%d，实际 %s:%d", tunnel.ListenPort, target.Host, target.Port)
+	}
+
+	groups := svc.tunnelGroupIDs(tunnel)
+	found := false
+	for _, id := range groups {
+		found = found || id == "backup"
+	}
+	if !found {
+		t.Errorf("隧道变更应通知容灾组，实际 %v", groups)
+	}
+
+	rules, err := svc.buildRulesForGroup("backup", nil)
+	if err != nil || len(rules) != 1 {
+		t.Fatalf("容灾组应收到该隧道规则，实际 %d, %v", len(rules), err)
+	}
+	rule := rules[0]
+	if rule.Role != HopRoleEgress || rule.HopIndex != 2 || rule.ListenPort != tunnel.ListenPort {
+		t.Errorf("容灾组应作为第 2 跳出口在隧道端口监听，实际 %s/%d/%d", rule.Role, rule.HopIndex, rule.ListenPort)
+	}
+	if rule.NextHop != nil || len(rule.FailoverTargets) != 0 {
+		t.Errorf("容灾出口直连目标，不应再有下一跳或容灾目标")
+	}
+}
+
+/* TestBuildRulePayload_ACLByPriority 隧道规则的 ACL 按优先级下发到每一跳 */
+func TestBuildRulePayload_ACLByPriority(t *testing.T) {
+	db, svc, tunnel := setupHopChainTest(t)
+	if err := db.AutoMigrate(&models.ACLRule{}); err != nil {
+		t.Fatalf("迁移 ACL 表失败: %v", err)
+	}
+	rule := models.Rule{TunnelID: tunnel.ID, Name: "默认规则"}
+	rule.ID = "rule-1"
+	if err := db.Create(&rule).Error; err != nil {
+		t.Fatalf("创建规则失败: %v", err)
+	}
+	db.Create(&models.ACLRule{RuleID: rule.ID, Action: "deny", Priority: 1, SourceIP: "203.0.113.0/24"})
+	db.Create(&models.ACLRule{RuleID: rule.ID, Action: "allow", Priority: 10, SourceIP: "203.0.113.5"})
+
+	for _, group := range []string{"ingress", "relay", "egress"} {
+		payload, err := svc.buildRulePayloadForGroup(tunnel, group)
+		if err != nil {
+			t.Fatalf("构建 %s 规则失败: %v", group, err)
+		}
+		if len(payload.ACL) != 2 {
+			t.Fatalf("%s 应收到 2 条 ACL，实际 %d", group, len(payload.ACL))
+		}
+		if payload.ACL[0].Action != "allow" || payload.ACL[0].SourceIP != "203.0.113.5" {
+			t.Errorf("%s 的 ACL 应按优先级从高到低排列，实际 %+v", group, payload.ACL)
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 // PaymentMonitorService 支付监听服务
 type PaymentMonitorService struct {
 	dao    *dao.DAO
+	leader *LeaderElector // 多实例部署时只在主实例检查，避免重复确认支付
 	ctx    context.Context
 	cancel context.CancelFunc
 }
@@ -34,6 +35,11 @@ func NewPaymentMonitorService(d *dao.DAO) *PaymentMonitorService {
 	}
 }
 
+// SetLeaderElector 设置主实例选举器
+func (s *PaymentMonitorService) SetLeaderElector(leader *LeaderElector) {
+	s.leader = leader
+}
+
 // Start 启动支付监听服务
 func (s *PaymentMonitorService) Start() {
 	logger.Info("支付监听服务启动")
@@ -47,7 +53,9 @@ func (s *PaymentMonitorService) Start() {
 			logger.Info("支付监听服务停止")
 			return
 		case <-ticker.C:
-			s.checkPendingPayments()
+			if s.leader.IsLeader() {
+				s.checkPendingPayments()
+			}
 		}
 	}
 }
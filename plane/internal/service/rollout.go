@@ -0,0 +1,892 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	rolloutCheckInterval  = 5 * time.Second /* 推进、回滚判定间隔 */
+	rolloutMinConnections = 20              /* 新建连接达到该数量后才按失败率判定，避免样本过少误判 */
+	rolloutActiveCacheTTL = 5 * time.Second /* 推进中隧道缓存有效期（流量上报频繁，避免逐条查库） */
+)
+
+/*
+RolloutOptions 规则分批发布参数
+功能：零值字段使用默认值（金丝雀 10%、之后 3 批、观察 60 秒、确认超时 30 秒、失败率 5%）
+*/
+type RolloutOptions struct {
+	Enabled       bool          /* 关闭时变更立即推送到全部节点 */
+	CanaryPercent int           /* 金丝雀批次占在线节点的百分比，至少 1 个节点 */
+	Waves         int           /* 金丝雀之后的推进批次数 */
+	BakeTime      time.Duration /* 每批节点确认后的观察时长 */
+	AckTimeout    time.Duration /* 等待节点确认新规则的超时 */
+	MaxErrorRate  float64       /* 允许的连接失败率 */
+}
+
+/*
+RolloutBaseline 变更前的规则基线
+功能：由 Capture 在修改配置之前获取，记录各隧道原经过的节点组和节点上正在运行的规则
+*/
+type RolloutBaseline struct {
+	tunnelIDs []string
+	groupIDs  map[string][]string /* 隧道 ID → 变更前经过的节点组 */
+	rules     RuleSnapshot
+}
+
+/*
+RolloutController 规则分批发布控制器
+功能：隧道更新、节点组配置变更不再同时推送到所有节点：
+  - 金丝雀：变更记录后只推送给一小批在线节点，其余节点保持快照中的变更前规则
+  - 推进：当前批次节点全部确认（sync_ack）并经过观察时长后，推进到下一批
+  - 回滚：节点应用失败、确认超时、应用后离线、HealthService 判定不健康或连接失败率超过阈值时，
+    向已应用新规则的节点推送快照规则；此后所有节点保持快照规则，直到这些隧道再次变更
+    （数据库中的配置仍为修改后的内容，修正后再次保存即发起新的发布）
+
+判定只在主实例执行（多实例部署）；节点确认和流量统计由节点所连接的实例写入数据库。
+*/
+type RolloutController struct {
+	db      *gorm.DB
+	syncSvc *GormNodeSyncService
+	opts    RolloutOptions
+	health  *HealthService /* 可为 nil */
+	leader  *LeaderElector /* nil 表示单实例 */
+
+	mu sync.Mutex /* 串行化本实例的推进、回滚与取消 */
+
+	trafficMu      sync.Mutex
+	lastFailed     map[string]int64    /* 节点/隧道 → 上次上报的累计失败连接数 */
+	activeTunnels  map[string][]string /* 推进中的隧道 → 发布 ID */
+	activeLoadedAt time.Time
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	logger   *zap.Logger
+}
+
+/*
+NewRolloutController 创建规则分批发布控制器并挂载到节点同步服务
+功能：挂载后同步服务在构建节点规则时遵循发布进度；未启用时仍处理已有的发布记录，只是不再发起新的发布
+*/
+func NewRolloutController(db *gorm.DB, syncSvc *GormNodeSyncService, opts RolloutOptions) *RolloutController {
+	if opts.CanaryPercent <= 0 || opts.CanaryPercent > 100 {
+		opts.CanaryPercent = 10
+	}
+	if opts.Waves <= 0 {
+		opts.Waves = 3
+	}
+	if opts.BakeTime <= 0 {
+		opts.BakeTime = 60 * time.Second
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = 30 * time.Second
+	}
+	if opts.MaxErrorRate <= 0 {
+		opts.MaxErrorRate = 0.05
+	}
+
+	c := &RolloutController{
+		db:         db,
+		syncSvc:    syncSvc,
+		opts:       opts,
+		lastFailed: make(map[string]int64),
+		stopChan:   make(chan struct{}),
+		logger:     zap.L().Named("rollout"),
+	}
+	syncSvc.rollouts = c
+	return c
+}
+
+/* SetHealthService 设置节点健康来源，判定为不健康的已应用节点触发回滚 */
+func (c *RolloutController) SetHealthService(health *HealthService) {
+	c.health = health
+}
+
+/* SetLeaderElector 设置主实例选举器，多实例部署时只在主实例推进和回滚 */
+func (c *RolloutController) SetLeaderElector(leader *LeaderElector) {
+	c.leader = leader
+}
+
+/* Enabled 新的变更是否分批发布，nil 时为 false */
+func (c *RolloutController) Enabled() bool {
+	return c != nil && c.opts.Enabled
+}
+
+/*
+Start 启动发布判定循环
+*/
+func (c *RolloutController) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(rolloutCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.tick()
+			case <-c.stopChan:
+				return
+			}
+		}
+	}()
+
+	c.logger.Info("规则分批发布控制器已启动",
+		zap.Bool("enabled", c.opts.Enabled),
+		zap.Int("canaryPercent", c.opts.CanaryPercent),
+		zap.Int("waves", c.opts.Waves))
+}
+
+/*
+Stop 停止发布判定循环
+功能：进行中的发布保留在数据库中，重启（或其他实例当选主实例）后继续推进
+*/
+func (c *RolloutController) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopChan)
+		c.wg.Wait()
+	})
+}
+
+/*
+Capture 在修改配置之前获取隧道的规则基线
+功能：隧道仍处于其他发布的快照中时以该快照为基线（节点实际运行的规则）；
+未启用分批发布时返回 nil，调用方按普通变更同步
+*/
+func (c *RolloutController) Capture(tunnelIDs ...string) *RolloutBaseline {
+	if !c.Enabled() || len(tunnelIDs) == 0 {
+		return nil
+	}
+
+	pinned := make(RuleSnapshot)
+	for _, pin := range c.pins() {
+		for _, tunnelID := range pin.tunnelIDs {
+			pinned[tunnelID] = pin.snapshot[tunnelID]
+		}
+	}
+
+	baseline := &RolloutBaseline{
+		groupIDs: make(map[string][]string, len(tunnelIDs)),
+		rules:    make(RuleSnapshot, len(tunnelIDs)),
+	}
+	for _, tunnelID := range tunnelIDs {
+		baseline.tunnelIDs = append(baseline.tunnelIDs, tunnelID)
+		baseline.groupIDs[tunnelID] = c.syncSvc.TunnelGroupIDs(tunnelID)
+		if rules, ok := pinned[tunnelID]; ok {
+			baseline.rules[tunnelID] = rules
+			continue
+		}
+		baseline.rules[tunnelID] = c.syncSvc.tunnelRules(tunnelID)
+	}
+	return baseline
+}
+
+/*
+Begin 记录变更并发起分批发布
+功能：kind/targetID 为变更对象（隧道或节点组），baseline 为 Capture 获取的基线。
+相关节点组的节点按 ID 排序后，在线节点依次分为金丝雀和后续批次，离线节点排在最后一批；
+没有在线节点时不发起发布，按普通变更推送（返回 nil）
+*/
+func (c *RolloutController) Begin(ctx context.Context, baseline *RolloutBaseline, kind, targetID, createdBy string) (rollout *models.RuleRollout, err error) {
+	ctx, span := tracing.Start(ctx, "RolloutController.Begin",
+		attribute.String("gkipass.rollout.kind", kind),
+		attribute.String("gkipass.rollout.target", targetID))
+	defer func() { tracing.End(span, err) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	groupIDs := make([]string, 0)
+	tunnelIDs := make([]string, 0, len(baseline.tunnelIDs))
+	for _, tunnelID := range baseline.tunnelIDs {
+		var tunnel models.Tunnel
+		if err := c.db.First(&tunnel, "id = ?", tunnelID).Error; err != nil {
+			continue
+		}
+		changed, err := c.syncSvc.recordTunnelUpdate(ctx, &tunnel, baseline.groupIDs[tunnelID])
+		if err != nil {
+			return nil, err
+		}
+		groupIDs = append(groupIDs, changed...)
+		tunnelIDs = append(tunnelIDs, tunnelID)
+	}
+	version := c.syncSvc.journal.CurrentVersion()
+
+	waves := c.planWaves(c.memberNodeIDs(groupIDs))
+	if len(tunnelIDs) == 0 || len(waves) == 0 {
+		c.syncSvc.pushChanges(ctx, groupIDs)
+		return nil, nil
+	}
+
+	snapshot := make(RuleSnapshot, len(tunnelIDs))
+	for _, tunnelID := range tunnelIDs {
+		snapshot[tunnelID] = baseline.rules[tunnelID]
+	}
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("序列化规则快照失败: %w", err)
+	}
+	tunnelIDsJSON, _ := json.Marshal(tunnelIDs)
+
+	now := time.Now()
+	rollout = &models.RuleRollout{
+		Kind:              kind,
+		TargetID:          targetID,
+		TunnelIDs:         string(tunnelIDsJSON),
+		Snapshot:          string(snapshotJSON),
+		Version:           version,
+		Status:            models.RolloutStatusRunning,
+		Pinned:            true,
+		TotalWaves:        len(waves),
+		WaveStartedAt:     now,
+		BakeSeconds:       int(c.opts.BakeTime / time.Second),
+		AckTimeoutSeconds: int(c.opts.AckTimeout / time.Second),
+		MaxErrorRate:      c.opts.MaxErrorRate,
+		CreatedBy:         createdBy,
+	}
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(rollout).Error; err != nil {
+			return err
+		}
+		nodes := make([]models.RuleRolloutNode, 0)
+		for wave, nodeIDs := range waves {
+			for _, nodeID := range nodeIDs {
+				node := models.RuleRolloutNode{RolloutID: rollout.ID, NodeID: nodeID, Wave: wave, Status: models.RolloutNodeHeld}
+				if wave == 0 {
+					node.Status = models.RolloutNodeApplied
+					node.SyncVersion = version
+					node.AppliedAt = &now
+				}
+				nodes = append(nodes, node)
+			}
+		}
+		return tx.Create(&nodes).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建分批发布失败: %w", err)
+	}
+
+	span.SetAttributes(
+		attribute.String("gkipass.rollout.id", rollout.ID),
+		attribute.Int64("gkipass.sync.version", version),
+		attribute.StringSlice("gkipass.rollout.canary", waves[0]))
+	c.logger.Info("发起规则分批发布",
+		zap.String("rollout_id", rollout.ID),
+		zap.String("kind", kind),
+		zap.String("target_id", targetID),
+		zap.Strings("tunnels", tunnelIDs),
+		zap.Strings("canary", waves[0]),
+		zap.Int("waves", len(waves)),
+		zap.Int64("version", version))
+
+	/* 只推送给金丝雀节点，其余节点保持原有规则，无需推送 */
+	for _, nodeID := range c.push(ctx, tunnelIDs, waves[0]) {
+		c.markUnreachable(rollout.ID, nodeID)
+	}
+	return rollout, nil
+}
+
+/*
+Get 获取发布详情（含各节点进度）
+*/
+func (c *RolloutController) Get(id string) (*models.RuleRollout, error) {
+	var rollout models.RuleRollout
+	err := c.db.Preload("Nodes", func(db *gorm.DB) *gorm.DB {
+		return db.Order("wave, node_id")
+	}).First(&rollout, "id = ?", id).Error
+	if err != nil {
+		return nil, fmt.Errorf("发布记录不存在: %s", id)
+	}
+	return &rollout, nil
+}
+
+/*
+List 列出发布记录（按创建时间倒序）
+功能：status、targetID 为空表示不筛选
+*/
+func (c *RolloutController) List(status, targetID string, limit int) ([]models.RuleRollout, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	query := c.db.Model(&models.RuleRollout{}).Order("created_at DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	var rollouts []models.RuleRollout
+	if err := query.Find(&rollouts).Error; err != nil {
+		return nil, fmt.Errorf("查询发布记录失败: %w", err)
+	}
+	return rollouts, nil
+}
+
+/*
+Cancel 取消进行中的发布
+功能：与自动回滚相同，已应用新规则的节点恢复到快照规则，此后全部节点保持快照规则
+*/
+func (c *RolloutController) Cancel(ctx context.Context, id, userID string) (*models.RuleRollout, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var rollout models.RuleRollout
+	if err := c.db.First(&rollout, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("发布记录不存在: %s", id)
+	}
+	if rollout.Status != models.RolloutStatusRunning {
+		return nil, fmt.Errorf("发布已结束（%s），无法取消", rollout.Status)
+	}
+	if !c.rollback(ctx, &rollout, models.RolloutStatusCancelled, fmt.Sprintf("由用户 %s 取消", userID)) {
+		return nil, fmt.Errorf("发布状态已变化，请刷新后重试")
+	}
+	return c.Get(id)
+}
+
+/*
+ObserveTraffic 记录节点上报的隧道连接统计
+功能：connections 为本次上报的新建连接数，failedTotal 为规则运行以来的累计失败连接数；
+累加到推进中发布里已应用新规则的节点上，作为失败率判定依据
+*/
+func (c *RolloutController) ObserveTraffic(nodeID, tunnelID string, connections, failedTotal int64) {
+	if c == nil || tunnelID == "" {
+		return
+	}
+
+	c.trafficMu.Lock()
+	key := nodeID + "/" + tunnelID
+	previous, seen := c.lastFailed[key]
+	c.lastFailed[key] = failedTotal
+	rolloutIDs := c.activeRollouts(tunnelID)
+	c.trafficMu.Unlock()
+
+	/* 首次上报无法得知增量；累计值变小说明规则已重建，计数从零开始 */
+	failed := failedTotal - previous
+	if !seen {
+		failed = 0
+	} else if failedTotal < previous {
+		failed = failedTotal
+	}
+	if len(rolloutIDs) == 0 || (connections <= 0 && failed <= 0) {
+		return
+	}
+
+	err := c.db.Model(&models.RuleRolloutNode{}).
+		Where("rollout_id IN ? AND node_id = ? AND status IN ?", rolloutIDs, nodeID,
+			[]string{models.RolloutNodeApplied, models.RolloutNodeAcked}).
+		Updates(map[string]interface{}{
+			"connections":        gorm.Expr("connections + ?", connections),
+			"failed_connections": gorm.Expr("failed_connections + ?", failed),
+		}).Error
+	if err != nil {
+		c.logger.Warn("记录发布节点连接统计失败", zap.String("node_id", nodeID), zap.Error(err))
+	}
+}
+
+/*
+observeAck 处理节点的同步确认
+功能：确认版本达到下发版本的已应用节点标记为已确认；新规则中有隧道应用失败时标记为失败
+*/
+func (c *RolloutController) observeAck(nodeID string, version int64, failedRules []string) {
+	if c == nil {
+		return
+	}
+
+	var nodes []models.RuleRolloutNode
+	c.db.Where("node_id = ? AND status = ? AND sync_version <= ? AND rollout_id IN (?)",
+		nodeID, models.RolloutNodeApplied, version,
+		c.db.Model(&models.RuleRollout{}).Select("id").Where("status = ?", models.RolloutStatusRunning)).
+		Find(&nodes)
+
+	now := time.Now()
+	for _, node := range nodes {
+		var rollout models.RuleRollout
+		if err := c.db.Select("id", "tunnel_ids").First(&rollout, "id = ?", node.RolloutID).Error; err != nil {
+			continue
+		}
+
+		inRollout := make(map[string]bool)
+		for _, tunnelID := range decodeRolloutIDs(rollout.TunnelIDs) {
+			inRollout[tunnelID] = true
+		}
+		failed := make([]string, 0)
+		for _, tunnelID := range failedRules {
+			if inRollout[tunnelID] {
+				failed = append(failed, tunnelID)
+			}
+		}
+
+		updates := map[string]interface{}{"status": models.RolloutNodeAcked, "acked_at": now}
+		if len(failed) > 0 {
+			updates = map[string]interface{}{
+				"status": models.RolloutNodeFailed,
+				"error":  "应用失败的隧道: " + strings.Join(failed, ", "),
+			}
+		}
+		c.db.Model(&models.RuleRolloutNode{}).
+			Where("rollout_id = ? AND node_id = ? AND status = ?", node.RolloutID, nodeID, models.RolloutNodeApplied).
+			Updates(updates)
+	}
+}
+
+/*
+heldRules 获取节点当前应保持快照规则的隧道
+功能：推进中的发布只对尚未轮到的节点生效，已回滚或取消的发布对全部节点生效；nil 时为空
+*/
+func (c *RolloutController) heldRules(nodeID string) RuleSnapshot {
+	if c == nil {
+		return nil
+	}
+
+	held := make(RuleSnapshot)
+	for _, pin := range c.pins() {
+		if pin.rollout.Status == models.RolloutStatusRunning {
+			var node models.RuleRolloutNode
+			err := c.db.First(&node, "rollout_id = ? AND node_id = ?", pin.rollout.ID, nodeID).Error
+			if err != nil || node.Status != models.RolloutNodeHeld {
+				continue
+			}
+		}
+		for _, tunnelID := range pin.tunnelIDs {
+			held[tunnelID] = pin.snapshot[tunnelID]
+		}
+	}
+	return held
+}
+
+/* rolloutPin 快照规则仍在生效的发布 */
+type rolloutPin struct {
+	rollout   models.RuleRollout
+	snapshot  RuleSnapshot
+	tunnelIDs []string /* 发布之后未再变更的隧道 */
+}
+
+/*
+pins 获取快照规则仍在生效的发布（新发布在前）
+功能：每个隧道以覆盖它的最新发布为准；隧道在发布之后再次变更时，快照对该隧道失效
+*/
+func (c *RolloutController) pins() []rolloutPin {
+	var rollouts []models.RuleRollout
+	if err := c.db.Where("pinned = ?", true).Order("version DESC").Find(&rollouts).Error; err != nil {
+		c.logger.Error("查询生效中的发布失败", zap.Error(err))
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	pins := make([]rolloutPin, 0, len(rollouts))
+	for _, rollout := range rollouts {
+		pin := rolloutPin{rollout: rollout}
+		for _, tunnelID := range decodeRolloutIDs(rollout.TunnelIDs) {
+			if seen[tunnelID] {
+				continue
+			}
+			seen[tunnelID] = true
+			if c.syncSvc.journal.TunnelVersion(tunnelID) <= rollout.Version {
+				pin.tunnelIDs = append(pin.tunnelIDs, tunnelID)
+			}
+		}
+		if len(pin.tunnelIDs) == 0 {
+			continue
+		}
+		if err := json.Unmarshal([]byte(rollout.Snapshot), &pin.snapshot); err != nil {
+			c.logger.Error("解析规则快照失败", zap.String("rollout_id", rollout.ID), zap.Error(err))
+			continue
+		}
+		pins = append(pins, pin)
+	}
+	return pins
+}
+
+/*
+tick 推进或回滚进行中的发布，释放已失效的快照
+*/
+func (c *RolloutController) tick() {
+	if !c.leader.IsLeader() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var rollouts []models.RuleRollout
+	if err := c.db.Where("pinned = ?", true).Order("version").Find(&rollouts).Error; err != nil {
+		c.logger.Error("查询进行中的发布失败", zap.Error(err))
+		return
+	}
+
+	ctx := context.Background()
+	for i := range rollouts {
+		rollout := &rollouts[i]
+		tunnelIDs := decodeRolloutIDs(rollout.TunnelIDs)
+		changed := make([]string, 0)
+		for _, tunnelID := range tunnelIDs {
+			if c.syncSvc.journal.TunnelVersion(tunnelID) > rollout.Version {
+				changed = append(changed, tunnelID)
+			}
+		}
+
+		switch {
+		case rollout.Status == models.RolloutStatusRunning && len(changed) > 0:
+			c.supersede(ctx, rollout, changed)
+		case rollout.Status == models.RolloutStatusRunning:
+			c.advance(ctx, rollout)
+		case len(changed) == len(tunnelIDs):
+			c.db.Model(&models.RuleRollout{}).Where("id = ?", rollout.ID).Update("pinned", false)
+		}
+	}
+}
+
+/*
+advance 检查当前批次并决定推进、完成或回滚
+功能：当前批次节点全部确认且健康、经过观察时长后推进到下一批，最后一批完成后发布成功
+*/
+func (c *RolloutController) advance(ctx context.Context, rollout *models.RuleRollout) {
+	var nodes []models.RuleRolloutNode
+	c.db.Where("rollout_id = ? AND wave = ?", rollout.ID, rollout.CurrentWave).Find(&nodes)
+
+	online := c.onlineNodes()
+	elapsed := time.Since(rollout.WaveStartedAt)
+	pending, applied := 0, 0
+	for i := range nodes {
+		if reason := c.checkNode(rollout, &nodes[i], online, elapsed); reason != "" {
+			c.rollback(ctx, rollout, models.RolloutStatusRolledBack, reason)
+			return
+		}
+		switch nodes[i].Status {
+		case models.RolloutNodeApplied:
+			pending++
+			applied++
+		case models.RolloutNodeAcked:
+			applied++
+		}
+	}
+
+	if pending > 0 {
+		return
+	}
+	if applied > 0 && elapsed < time.Duration(rollout.BakeSeconds)*time.Second {
+		return
+	}
+
+	if rollout.CurrentWave+1 >= rollout.TotalWaves {
+		if c.finish(rollout, models.RolloutStatusSucceeded, "", false) {
+			c.logger.Info("规则分批发布完成", zap.String("rollout_id", rollout.ID), zap.Int("waves", rollout.TotalWaves))
+		}
+		return
+	}
+	c.startWave(ctx, rollout, rollout.CurrentWave+1)
+}
+
+/*
+checkNode 检查当前批次中的节点，返回回滚原因（空表示正常）
+*/
+func (c *RolloutController) checkNode(rollout *models.RuleRollout, node *models.RuleRolloutNode, online map[string]bool, elapsed time.Duration) string {
+	switch node.Status {
+	case models.RolloutNodeFailed:
+		return fmt.Sprintf("节点 %s 应用新规则失败（%s）", node.NodeID, node.Error)
+
+	case models.RolloutNodeApplied:
+		if !online[node.NodeID] {
+			return fmt.Sprintf("节点 %s 下发新规则后离线", node.NodeID)
+		}
+		if elapsed > time.Duration(rollout.AckTimeoutSeconds)*time.Second {
+			return fmt.Sprintf("节点 %s 未在 %d 秒内确认新规则", node.NodeID, rollout.AckTimeoutSeconds)
+		}
+
+	case models.RolloutNodeAcked:
+		if !online[node.NodeID] {
+			return fmt.Sprintf("节点 %s 应用新规则后离线", node.NodeID)
+		}
+		if c.health != nil {
+			if status, err := c.health.GetNodeStatus(node.NodeID); err == nil && status == NodeHealthStatusUnhealthy {
+				return fmt.Sprintf("节点 %s 应用新规则后健康状态为 %s", node.NodeID, status)
+			}
+		}
+		if node.Connections >= rolloutMinConnections {
+			rate := float64(node.FailedConnections) / float64(node.Connections)
+			if rate > rollout.MaxErrorRate {
+				return fmt.Sprintf("节点 %s 应用新规则后连接失败率 %.1f%% 超过阈值 %.1f%%",
+					node.NodeID, rate*100, rollout.MaxErrorRate*100)
+			}
+		}
+	}
+	return ""
+}
+
+/*
+startWave 推进到下一批
+功能：在线节点下发新规则，离线节点标记为离线（重连后直接获得新规则，不再等待其确认）
+*/
+func (c *RolloutController) startWave(ctx context.Context, rollout *models.RuleRollout, wave int) {
+	now := time.Now()
+	result := c.db.Model(&models.RuleRollout{}).
+		Where("id = ? AND status = ? AND current_wave = ?", rollout.ID, models.RolloutStatusRunning, rollout.CurrentWave).
+		Updates(map[string]interface{}{"current_wave": wave, "wave_started_at": now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	rollout.CurrentWave, rollout.WaveStartedAt = wave, now
+
+	var nodes []models.RuleRolloutNode
+	c.db.Where("rollout_id = ? AND wave = ? AND status = ?", rollout.ID, wave, models.RolloutNodeHeld).Find(&nodes)
+
+	online := c.onlineNodes()
+	version := c.syncSvc.journal.CurrentVersion()
+	nodeIDs := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		updates := map[string]interface{}{"status": models.RolloutNodeOffline}
+		if online[node.NodeID] {
+			updates = map[string]interface{}{"status": models.RolloutNodeApplied, "sync_version": version, "applied_at": now}
+			nodeIDs = append(nodeIDs, node.NodeID)
+		}
+		c.db.Model(&models.RuleRolloutNode{}).
+			Where("rollout_id = ? AND node_id = ?", rollout.ID, node.NodeID).
+			Updates(updates)
+	}
+
+	c.logger.Info("规则分批发布推进",
+		zap.String("rollout_id", rollout.ID),
+		zap.Int("wave", wave),
+		zap.Strings("nodes", nodeIDs),
+		zap.Int("offline", len(nodes)-len(nodeIDs)))
+
+	for _, nodeID := range c.push(ctx, decodeRolloutIDs(rollout.TunnelIDs), nodeIDs) {
+		c.markUnreachable(rollout.ID, nodeID)
+	}
+}
+
+/*
+rollback 回滚发布
+功能：status 为 rolled_back（自动）或 cancelled（手动）；快照保持生效，
+向已应用新规则的在线节点推送快照规则，离线节点在重连同步时获得快照规则
+*/
+func (c *RolloutController) rollback(ctx context.Context, rollout *models.RuleRollout, status, reason string) bool {
+	if !c.finish(rollout, status, reason, true) {
+		return false
+	}
+
+	var nodes []models.RuleRolloutNode
+	c.db.Where("rollout_id = ? AND status IN ?", rollout.ID,
+		[]string{models.RolloutNodeApplied, models.RolloutNodeAcked, models.RolloutNodeFailed}).
+		Find(&nodes)
+
+	online := c.onlineNodes()
+	nodeIDs := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if online[node.NodeID] {
+			nodeIDs = append(nodeIDs, node.NodeID)
+		}
+	}
+	c.push(ctx, decodeRolloutIDs(rollout.TunnelIDs), nodeIDs)
+
+	c.db.Model(&models.RuleRolloutNode{}).
+		Where("rollout_id = ? AND status IN ?", rollout.ID,
+			[]string{models.RolloutNodeApplied, models.RolloutNodeAcked, models.RolloutNodeFailed, models.RolloutNodeOffline}).
+		Update("status", models.RolloutNodeRolledBack)
+
+	c.logger.Warn("规则分批发布已回滚",
+		zap.String("rollout_id", rollout.ID),
+		zap.String("status", status),
+		zap.String("reason", reason),
+		zap.Strings("nodes", nodeIDs))
+	return true
+}
+
+/*
+supersede 推进中的隧道再次变更，由新的变更接管
+功能：快照失效，尚未轮到的节点改为下发当前配置（再次变更的隧道以新的变更为准）
+*/
+func (c *RolloutController) supersede(ctx context.Context, rollout *models.RuleRollout, changed []string) {
+	if !c.finish(rollout, models.RolloutStatusSuperseded, "隧道再次变更: "+strings.Join(changed, ", "), false) {
+		return
+	}
+
+	var nodeIDs []string
+	c.db.Model(&models.RuleRolloutNode{}).
+		Where("rollout_id = ? AND status = ?", rollout.ID, models.RolloutNodeHeld).
+		Pluck("node_id", &nodeIDs)
+
+	online := c.onlineNodes()
+	reachable := make([]string, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		if online[nodeID] {
+			reachable = append(reachable, nodeID)
+		}
+	}
+	c.push(ctx, decodeRolloutIDs(rollout.TunnelIDs), reachable)
+
+	c.logger.Info("规则分批发布由新的变更接管",
+		zap.String("rollout_id", rollout.ID),
+		zap.Strings("changed", changed))
+}
+
+/*
+finish 结束进行中的发布
+功能：以状态为条件更新，避免与其他实例（或手动取消）重复处理；返回是否由本次调用结束
+*/
+func (c *RolloutController) finish(rollout *models.RuleRollout, status, reason string, pinned bool) bool {
+	now := time.Now()
+	result := c.db.Model(&models.RuleRollout{}).
+		Where("id = ? AND status = ?", rollout.ID, models.RolloutStatusRunning).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"reason":      reason,
+			"pinned":      pinned,
+			"finished_at": now,
+		})
+	if result.Error != nil {
+		c.logger.Error("更新发布状态失败", zap.String("rollout_id", rollout.ID), zap.Error(result.Error))
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+
+	rollout.Status, rollout.Reason, rollout.Pinned, rollout.FinishedAt = status, reason, pinned, &now
+	return true
+}
+
+/*
+push 向节点重新下发隧道规则，返回推送失败的节点
+功能：规则内容由同步服务按发布进度决定（新规则或快照规则）
+*/
+func (c *RolloutController) push(ctx context.Context, tunnelIDs, nodeIDs []string) []string {
+	failed := make([]string, 0)
+	for _, nodeID := range nodeIDs {
+		err := c.syncSvc.SyncNodeSince(ctx, nodeID, c.syncSvc.journal.AckedVersion(nodeID), tunnelIDs...)
+		if err != nil {
+			c.logger.Warn("分批发布推送规则失败", zap.String("node_id", nodeID), zap.Error(err))
+			failed = append(failed, nodeID)
+		}
+	}
+	return failed
+}
+
+/* markUnreachable 推送失败的节点视为离线，重连同步时直接获得新规则 */
+func (c *RolloutController) markUnreachable(rolloutID, nodeID string) {
+	c.db.Model(&models.RuleRolloutNode{}).
+		Where("rollout_id = ? AND node_id = ? AND status = ?", rolloutID, nodeID, models.RolloutNodeApplied).
+		Updates(map[string]interface{}{"status": models.RolloutNodeOffline, "error": "推送新规则失败"})
+}
+
+/*
+planWaves 将节点划分为发布批次
+功能：第 0 批为金丝雀；没有在线节点时返回 nil
+*/
+func (c *RolloutController) planWaves(nodeIDs []string) [][]string {
+	online := c.onlineNodes()
+	up, down := make([]string, 0), make([]string, 0)
+	for _, nodeID := range nodeIDs {
+		if online[nodeID] {
+			up = append(up, nodeID)
+		} else {
+			down = append(down, nodeID)
+		}
+	}
+	if len(up) == 0 {
+		return nil
+	}
+
+	canary := (len(up)*c.opts.CanaryPercent + 99) / 100
+	if canary < 1 {
+		canary = 1
+	}
+	waves := [][]string{up[:canary]}
+
+	rest := up[canary:]
+	if n := len(rest); n > 0 {
+		size := (n + c.opts.Waves - 1) / c.opts.Waves
+		for i := 0; i < n; i += size {
+			end := i + size
+			if end > n {
+				end = n
+			}
+			waves = append(waves, rest[i:end])
+		}
+	}
+
+	if len(down) > 0 {
+		if len(waves) == 1 {
+			waves = append(waves, down)
+		} else {
+			last := len(waves) - 1
+			waves[last] = append(append([]string{}, waves[last]...), down...)
+		}
+	}
+	return waves
+}
+
+/*
+memberNodeIDs 获取节点组的全部成员节点（去重、按 ID 排序）
+*/
+func (c *RolloutController) memberNodeIDs(groupIDs []string) []string {
+	groupIDs = uniqueGroupIDs(groupIDs)
+	if len(groupIDs) == 0 {
+		return nil
+	}
+
+	/* 关联表由 Node.Groups 的 many2many 生成，列为 node_id / node_group_id */
+	var nodeIDs []string
+	c.db.Table("node_group_nodes").
+		Where("node_group_id IN ?", groupIDs).
+		Distinct("node_id").
+		Order("node_id").
+		Pluck("node_id", &nodeIDs)
+	return nodeIDs
+}
+
+/* onlineNodes 全部实例上的在线节点 */
+func (c *RolloutController) onlineNodes() map[string]bool {
+	online := make(map[string]bool)
+	if c.syncSvc.wsSender == nil {
+		return online
+	}
+	for _, nodeID := range c.syncSvc.wsSender.GetOnlineNodeIDs() {
+		online[nodeID] = true
+	}
+	return online
+}
+
+/*
+activeRollouts 获取包含指定隧道的推进中发布，调用方须持有 trafficMu
+*/
+func (c *RolloutController) activeRollouts(tunnelID string) []string {
+	if c.activeTunnels == nil || time.Since(c.activeLoadedAt) > rolloutActiveCacheTTL {
+		var rollouts []models.RuleRollout
+		c.db.Select("id", "tunnel_ids").Where("status = ?", models.RolloutStatusRunning).Find(&rollouts)
+
+		c.activeTunnels = make(map[string][]string)
+		for _, rollout := range rollouts {
+			for _, id := range decodeRolloutIDs(rollout.TunnelIDs) {
+				c.activeTunnels[id] = append(c.activeTunnels[id], rollout.ID)
+			}
+		}
+		c.activeLoadedAt = time.Now()
+	}
+	return c.activeTunnels[tunnelID]
+}
+
+/* decodeRolloutIDs 解析发布记录中的隧道 ID 列表（排序） */
+func decodeRolloutIDs(raw string) []string {
+	var ids []string
+	if raw == "" || json.Unmarshal([]byte(raw), &ids) != nil {
+		return nil
+	}
+	sort.Strings(ids)
+	return ids
+}
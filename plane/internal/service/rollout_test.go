@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/*
+rolloutTestSender 记录下发消息的 WebSocketSender，所有节点视为在线
+*/
+type rolloutTestSender struct {
+	mu     sync.Mutex
+	online []string
+	sent   map[string][]*SyncRulesMessage
+}
+
+func (s *rolloutTestSender) SendToNode(_ context.Context, nodeID string, _ string, data interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent[nodeID] = append(s.sent[nodeID], data.(*SyncRulesMessage))
+	return nil
+}
+
+func (s *rolloutTestSender) SendToGroup(ctx context.Context, nodeIDs []string, msgType string, data interface{}) error {
+	for _, nodeID := range nodeIDs {
+		s.SendToNode(ctx, nodeID, msgType, data)
+	}
+	return nil
+}
+
+func (s *rolloutTestSender) GetOnlineNodeIDs() []string {
+	return s.online
+}
+
+/* lastPort 节点最近一次收到的隧道监听端口，未收到该隧道时为 0 */
+func (s *rolloutTestSender) lastPort(nodeID, tunnelID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msgs := s.sent[nodeID]
+	if len(msgs) == 0 {
+		return 0
+	}
+	for _, rule := range msgs[len(msgs)-1].Rules {
+		if rule.TunnelID == tunnelID {
+			return rule.ListenPort
+		}
+	}
+	return 0
+}
+
+func (s *rolloutTestSender) count(nodeID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent[nodeID])
+}
+
+/*
+setupRolloutTest 创建分批发布测试环境
+功能：入口组 ingress 含 4 个在线节点，隧道 tunnel-1 监听 10001 端口
+*/
+func setupRolloutTest(t *testing.T) (*gorm.DB, *GormNodeSyncService, *RolloutController, *rolloutTestSender) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.Node{}, &models.NodeGroup{}, &models.Tunnel{}, &models.TunnelTarget{},
+		&models.TunnelHop{}, &models.Rule{}, &models.TunnelCredential{}, &models.UserProxyCredential{},
+		&models.RuleChange{}, &models.RuleChangeSequence{}, &models.NodeSyncState{}, &models.RuleRollout{}, &models.RuleRolloutNode{})
+	if err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+
+	ingress := models.NodeGroup{Name: "入口组", Role: models.NodeRoleIngress}
+	ingress.ID = "ingress"
+	egress := models.NodeGroup{Name: "出口组", Role: models.NodeRoleEgress}
+	egress.ID = "egress"
+	db.Create(&ingress)
+	db.Create(&egress)
+
+	sender := &rolloutTestSender{sent: make(map[string][]*SyncRulesMessage)}
+	for _, id := range []string{"n1", "n2", "n3", "n4"} {
+		node := models.Node{Name: id, Status: models.NodeStatusOnline, Groups: []models.NodeGroup{ingress}}
+		node.ID = id
+		if err := db.Create(&node).Error; err != nil {
+			t.Fatalf("创建节点失败: %v", err)
+		}
+		sender.online = append(sender.online, id)
+	}
+
+	tunnel := models.Tunnel{
+		Name:           "测试隧道",
+		Enabled:        true,
+		CreatedBy:      "user-1",
+		IngressGroupID: "ingress",
+		EgressGroupID:  "egress",
+		Protocol:       models.TunnelProtocol("tcp"),
+		ListenPort:     10001,
+		TargetAddress:  "127.0.0.1",
+		TargetPort:     80,
+	}
+	tunnel.ID = "tunnel-1"
+	db.Create(&tunnel)
+
+	svc := NewGormNodeSyncService(db, sender)
+	if _, err := svc.recordTunnelChange(context.Background(), &tunnel); err != nil {
+		t.Fatalf("记录隧道创建失败: %v", err)
+	}
+
+	c := NewRolloutController(db, svc, RolloutOptions{Enabled: true, CanaryPercent: 25, Waves: 1})
+	c.opts.BakeTime = 0
+	return db, svc, c, sender
+}
+
+/*
+updatePort 修改隧道端口并发起分批发布
+*/
+func updatePort(t *testing.T, db *gorm.DB, c *RolloutController, port int) *models.RuleRollout {
+	t.Helper()
+	baseline := c.Capture("tunnel-1")
+	if baseline == nil {
+		t.Fatal("启用分批发布时 Capture 不应返回 nil")
+	}
+	db.Model(&models.Tunnel{}).Where("id = ?", "tunnel-1").Update("listen_port", port)
+
+	rollout, err := c.Begin(context.Background(), baseline, models.RolloutKindTunnel, "tunnel-1", "admin")
+	if err != nil || rollout == nil {
+		t.Fatalf("发起分批发布失败: rollout=%v err=%v", rollout, err)
+	}
+	return rollout
+}
+
+/*
+TestRollout_CanaryThenWaves 测试金丝雀确认后推进到下一批并完成
+*/
+func TestRollout_CanaryThenWaves(t *testing.T) {
+	db, svc, c, sender := setupRolloutTest(t)
+	rollout := updatePort(t, db, c, 10002)
+
+	if rollout.TotalWaves != 2 {
+		t.Fatalf("4 个节点、25%% 金丝雀、之后 1 批，应共 2 批，实际 %d", rollout.TotalWaves)
+	}
+	if port := sender.lastPort("n1", "tunnel-1"); port != 10002 {
+		t.Errorf("金丝雀节点 n1 应收到新端口 10002，实际 %d", port)
+	}
+	if n := sender.count("n2"); n != 0 {
+		t.Errorf("非金丝雀节点不应收到推送，n2 收到 %d 条", n)
+	}
+
+	/* 尚未轮到的节点全量同步时仍获得原有规则 */
+	if err := svc.SyncAllRulesToNode(context.Background(), "n2"); err != nil {
+		t.Fatalf("全量同步失败: %v", err)
+	}
+	if port := sender.lastPort("n2", "tunnel-1"); port != 10001 {
+		t.Errorf("保持中的节点 n2 全量同步应得到原端口 10001，实际 %d", port)
+	}
+
+	/* 未确认时不推进 */
+	c.tick()
+	if got, _ := c.Get(rollout.ID); got.CurrentWave != 0 {
+		t.Fatalf("金丝雀未确认时不应推进，当前批次 %d", got.CurrentWave)
+	}
+
+	svc.AckNodeVersion("n1", rollout.Version)
+	c.tick()
+	got, _ := c.Get(rollout.ID)
+	if got.CurrentWave != 1 || got.Status != models.RolloutStatusRunning {
+		t.Fatalf("金丝雀确认后应推进到第 1 批，实际批次 %d 状态 %s", got.CurrentWave, got.Status)
+	}
+	for _, id := range []string{"n2", "n3", "n4"} {
+		if port := sender.lastPort(id, "tunnel-1"); port != 10002 {
+			t.Errorf("第 1 批节点 %s 应收到新端口 10002，实际 %d", id, port)
+		}
+		svc.AckNodeVersion(id, rollout.Version)
+	}
+
+	c.tick()
+	got, _ = c.Get(rollout.ID)
+	if got.Status != models.RolloutStatusSucceeded || got.Pinned {
+		t.Fatalf("全部确认后发布应成功并释放快照，实际状态 %s pinned=%v", got.Status, got.Pinned)
+	}
+	if held := c.heldRules("n2"); len(held) != 0 {
+		t.Errorf("发布完成后不应再有保持的规则，实际 %v", held)
+	}
+}
+
+/*
+TestRollout_FailedAckRollsBack 测试金丝雀应用失败时回滚并在后续变更前保持原有规则
+*/
+func TestRollout_FailedAckRollsBack(t *testing.T) {
+	db, svc, c, sender := setupRolloutTest(t)
+	rollout := updatePort(t, db, c, 10002)
+
+	svc.AckNodeVersion("n1", rollout.Version, "tunnel-1")
+	c.tick()
+
+	got, _ := c.Get(rollout.ID)
+	if got.Status != models.RolloutStatusRolledBack || !got.Pinned {
+		t.Fatalf("应用失败应回滚并保持快照，实际状态 %s pinned=%v", got.Status, got.Pinned)
+	}
+	if port := sender.lastPort("n1", "tunnel-1"); port != 10001 {
+		t.Errorf("回滚后 n1 应收到原端口 10001，实际 %d", port)
+	}
+	for _, node := range got.Nodes {
+		if node.NodeID == "n1" && node.Status != models.RolloutNodeRolledBack {
+			t.Errorf("n1 状态应为 %s，实际 %s", models.RolloutNodeRolledBack, node.Status)
+		}
+	}
+
+	/* 回滚后所有节点（含已轮到的）全量同步均为原有规则 */
+	for _, id := range []string{"n1", "n3"} {
+		svc.SyncAllRulesToNode(context.Background(), id)
+		if port := sender.lastPort(id, "tunnel-1"); port != 10001 {
+			t.Errorf("回滚后 %s 全量同步应得到原端口 10001，实际 %d", id, port)
+		}
+	}
+
+	/* 再次变更（未启用分批时的普通更新）后快照失效 */
+	var tunnel models.Tunnel
+	db.First(&tunnel, "id = ?", "tunnel-1")
+	tunnel.ListenPort = 10003
+	db.Save(&tunnel)
+	svc.OnTunnelUpdated(context.Background(), &tunnel)
+
+	svc.SyncAllRulesToNode(context.Background(), "n3")
+	if port := sender.lastPort("n3", "tunnel-1"); port != 10003 {
+		t.Errorf("再次变更后应得到最新端口 10003，实际 %d", port)
+	}
+	c.tick()
+	if got, _ := c.Get(rollout.ID); got.Pinned {
+		t.Error("隧道再次变更后回滚记录应释放快照")
+	}
+}
+
+/*
+TestRollout_ErrorRateRollsBack 测试金丝雀连接失败率超过阈值时回滚
+*/
+func TestRollout_ErrorRateRollsBack(t *testing.T) {
+	db, svc, c, sender := setupRolloutTest(t)
+	rollout := updatePort(t, db, c, 10002)
+	svc.AckNodeVersion("n1", rollout.Version)
+
+	/* 首次上报只作为累计失败数的基准 */
+	c.ObserveTraffic("n1", "tunnel-1", 10, 3)
+	c.ObserveTraffic("n1", "tunnel-1", 20, 13)
+
+	got, _ := c.Get(rollout.ID)
+	for _, node := range got.Nodes {
+		if node.NodeID == "n1" && (node.Connections != 30 || node.FailedConnections != 10) {
+			t.Fatalf("n1 应累计 30 个连接、10 个失败，实际 %d/%d", node.Connections, node.FailedConnections)
+		}
+	}
+
+	c.tick()
+	got, _ = c.Get(rollout.ID)
+	if got.Status != models.RolloutStatusRolledBack {
+		t.Fatalf("失败率超过阈值应回滚，实际状态 %s", got.Status)
+	}
+	if port := sender.lastPort("n1", "tunnel-1"); port != 10001 {
+		t.Errorf("回滚后 n1 应收到原端口 10001，实际 %d", port)
+	}
+}
+
+/*
+TestRollout_Cancel 测试手动取消进行中的发布
+*/
+func TestRollout_Cancel(t *testing.T) {
+	db, _, c, sender := setupRolloutTest(t)
+	rollout := updatePort(t, db, c, 10002)
+
+	got, err := c.Cancel(context.Background(), rollout.ID, "admin")
+	if err != nil {
+		t.Fatalf("取消发布失败: %v", err)
+	}
+	if got.Status != models.RolloutStatusCancelled {
+		t.Errorf("状态应为 %s，实际 %s", models.RolloutStatusCancelled, got.Status)
+	}
+	if port := sender.lastPort("n1", "tunnel-1"); port != 10001 {
+		t.Errorf("取消后 n1 应收到原端口 10001，实际 %d", port)
+	}
+
+	if _, err := c.Cancel(context.Background(), rollout.ID, "admin"); err == nil {
+		t.Error("已结束的发布不应再次取消")
+	}
+}
+
+/*
+TestRollout_PlanWaves 测试批次划分：在线节点按比例分批，离线节点排在最后一批
+*/
+func TestRollout_PlanWaves(t *testing.T) {
+	_, _, c, sender := setupRolloutTest(t)
+	sender.online = []string{"n1", "n2", "n3"}
+	c.opts.Waves = 2
+
+	waves := c.planWaves([]string{"n1", "n2", "n3", "n4"})
+	if len(waves) != 3 {
+		t.Fatalf("应分为 3 批，实际 %v", waves)
+	}
+	if len(waves[0]) != 1 || waves[0][0] != "n1" {
+		t.Errorf("金丝雀应为 [n1]，实际 %v", waves[0])
+	}
+	if last := waves[len(waves)-1]; last[len(last)-1] != "n4" {
+		t.Errorf("离线节点 n4 应排在最后一批，实际 %v", waves)
+	}
+
+	sender.online = nil
+	if waves := c.planWaves([]string{"n1"}); waves != nil {
+		t.Errorf("没有在线节点时不应分批，实际 %v", waves)
+	}
+}
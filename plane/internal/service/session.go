@@ -0,0 +1,252 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"gkipass/plane/internal/db/models"
+)
+
+/* 会话吊销原因 */
+const (
+	SessionRevokeLogout          = "logout"
+	SessionRevokeUser            = "user_revoked"     /* 用户在会话列表中吊销 */
+	SessionRevokeAdmin           = "admin_revoked"    /* 管理员强制下线 */
+	SessionRevokePasswordChanged = "password_changed" /* 修改密码 */
+	SessionRevokeUserDisabled    = "user_disabled"
+	SessionRevokeUserDeleted     = "user_deleted"
+	SessionRevokeRefreshReuse    = "refresh_reuse" /* 已轮换的刷新令牌再次出现 */
+)
+
+const (
+	/* 最近活动时间的写入间隔，避免每个请求都写库 */
+	sessionTouchInterval = time.Minute
+	/* 已过期或已吊销的会话保留多久后清理 */
+	sessionRetention = 7 * 24 * time.Hour
+)
+
+var (
+	ErrSessionInvalid      = errors.New("会话已失效，请重新登录")
+	ErrSessionRefreshReuse = errors.New("刷新令牌已被使用，会话已吊销，请重新登录")
+)
+
+/*
+SessionTokens 新建或刷新会话后返回给客户端的凭据
+*/
+type SessionTokens struct {
+	SessionID        string
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+/*
+SessionService 登录会话服务
+功能：登录时创建会话并签发刷新令牌；刷新时轮换刷新令牌并检测重放；
+JWTAuth 按访问令牌中的会话 ID 校验会话，吊销后访问令牌立即失效
+*/
+type SessionService struct {
+	db         *gorm.DB
+	refreshTTL time.Duration
+	now        func() time.Time
+	logger     *zap.Logger
+}
+
+/*
+NewSessionService 创建会话服务
+功能：refreshDays 为刷新令牌有效天数，每次刷新后重新计算
+*/
+func NewSessionService(db *gorm.DB, refreshDays int) *SessionService {
+	if refreshDays <= 0 {
+		refreshDays = 30
+	}
+	return &SessionService{
+		db:         db,
+		refreshTTL: time.Duration(refreshDays) * 24 * time.Hour,
+		now:        time.Now,
+		logger:     zap.L().Named("session-service"),
+	}
+}
+
+/*
+Create 为通过全部认证步骤的用户创建会话
+功能：同时清理该用户过期较久的会话记录
+*/
+func (s *SessionService) Create(userID, ip, userAgent string) (*SessionTokens, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("生成刷新令牌失败: %w", err)
+	}
+	now := s.now()
+	session := &models.UserSession{
+		UserID:      userID,
+		RefreshHash: hashSecretToken(raw),
+		IP:          ip,
+		UserAgent:   truncateRunes(userAgent, 512),
+		LastSeenAt:  now,
+		LastSeenIP:  ip,
+		ExpiresAt:   now.Add(s.refreshTTL),
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		return nil, fmt.Errorf("创建会话失败: %w", err)
+	}
+
+	cutoff := now.Add(-sessionRetention)
+	s.db.Where("user_id = ? AND (expires_at < ? OR revoked_at < ?)", userID, cutoff, cutoff).
+		Delete(&models.UserSession{})
+
+	return &SessionTokens{SessionID: session.ID, RefreshToken: raw, RefreshExpiresAt: session.ExpiresAt}, nil
+}
+
+/*
+Refresh 使用刷新令牌换取新的刷新令牌
+功能：令牌为当前令牌时轮换并延长有效期；为上一个令牌时说明已被他人使用过，吊销整个会话
+*/
+func (s *SessionService) Refresh(raw, ip string) (*models.UserSession, *SessionTokens, error) {
+	if raw == "" {
+		return nil, nil, ErrSessionInvalid
+	}
+	hash := hashSecretToken(raw)
+	now := s.now()
+
+	var session models.UserSession
+	err := s.db.Where("refresh_hash = ?", hash).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err := s.db.Where("prev_refresh_hash = ?", hash).First(&session).Error; err == nil {
+			if session.RevokedAt == nil {
+				s.logger.Warn("检测到刷新令牌重放，吊销会话",
+					zap.String("sessionID", session.ID),
+					zap.String("userID", session.UserID),
+					zap.String("client_ip", ip))
+				s.revoke(s.db.Where("id = ?", session.ID), SessionRevokeRefreshReuse)
+			}
+			return nil, nil, ErrSessionRefreshReuse
+		}
+		return nil, nil, ErrSessionInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		return nil, nil, ErrSessionInvalid
+	}
+
+	next, err := randomToken()
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成刷新令牌失败: %w", err)
+	}
+	expiresAt := now.Add(s.refreshTTL)
+	/* 以当前哈希为条件更新，并发使用同一令牌时只有一个请求成功 */
+	result := s.db.Model(&models.UserSession{}).
+		Where("id = ? AND refresh_hash = ?", session.ID, hash).
+		Updates(map[string]interface{}{
+			"refresh_hash":      hashSecretToken(next),
+			"prev_refresh_hash": hash,
+			"expires_at":        expiresAt,
+			"last_seen_at":      now,
+			"last_seen_ip":      ip,
+		})
+	if result.Error != nil {
+		return nil, nil, fmt.Errorf("轮换刷新令牌失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrSessionRefreshReuse
+	}
+
+	session.ExpiresAt = expiresAt
+	session.LastSeenAt = now
+	session.LastSeenIP = ip
+	return &session, &SessionTokens{SessionID: session.ID, RefreshToken: next, RefreshExpiresAt: expiresAt}, nil
+}
+
+/*
+Validate 校验访问令牌所属会话
+功能：会话必须属于 userID、未吊销、刷新令牌未过期；按间隔更新最近活动时间和 IP
+*/
+func (s *SessionService) Validate(sessionID, userID, ip string) error {
+	if sessionID == "" {
+		return ErrSessionInvalid
+	}
+	var session models.UserSession
+	if err := s.db.Select("id", "user_id", "expires_at", "revoked_at", "last_seen_at", "last_seen_ip").
+		First(&session, "id = ?", sessionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionInvalid
+		}
+		return err
+	}
+	now := s.now()
+	if session.UserID != userID || session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		return ErrSessionInvalid
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval || session.LastSeenIP != ip {
+		if err := s.db.Model(&models.UserSession{}).Where("id = ?", session.ID).UpdateColumns(map[string]interface{}{
+			"last_seen_at": now,
+			"last_seen_ip": ip,
+		}).Error; err != nil {
+			s.logger.Warn("更新会话活动时间失败", zap.String("sessionID", session.ID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+/*
+List 列出用户的有效会话，按最近活动时间倒序
+*/
+func (s *SessionService) List(userID string) ([]models.UserSession, error) {
+	sessions := []models.UserSession{}
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, s.now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+/*
+Revoke 吊销用户的指定会话
+*/
+func (s *SessionService) Revoke(userID, sessionID, reason string) error {
+	n, err := s.revoke(s.db.Where("id = ? AND user_id = ?", sessionID, userID), reason)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("会话不存在或已失效")
+	}
+	return nil
+}
+
+/*
+RevokeAll 吊销用户的全部会话，exceptSessionID 非空时保留该会话；返回吊销的数量
+*/
+func (s *SessionService) RevokeAll(userID, exceptSessionID, reason string) (int64, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if exceptSessionID != "" {
+		query = query.Where("id <> ?", exceptSessionID)
+	}
+	n, err := s.revoke(query, reason)
+	if err == nil && n > 0 {
+		s.logger.Info("吊销用户会话",
+			zap.String("userID", userID),
+			zap.String("reason", reason),
+			zap.Int64("count", n))
+	}
+	return n, err
+}
+
+/* revoke 吊销条件匹配的有效会话 */
+func (s *SessionService) revoke(query *gorm.DB, reason string) (int64, error) {
+	result := query.Model(&models.UserSession{}).
+		Where("revoked_at IS NULL").
+		Updates(map[string]interface{}{
+			"revoked_at":    s.now(),
+			"revoke_reason": reason,
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("吊销会话失败: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/* setupSessionTest 创建会话测试环境，刷新令牌有效期 30 天，时钟可由测试控制 */
+func setupSessionTest(t *testing.T) (*gorm.DB, *SessionService, *time.Time) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.UserSession{}); err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	svc := NewSessionService(db, 30)
+	svc.now = func() time.Time { return now }
+	return db, svc, &now
+}
+
+/* TestSession_RefreshRotation 刷新令牌每次使用后轮换；已轮换的令牌再次出现时吊销整个会话 */
+func TestSession_RefreshRotation(t *testing.T) {
+	db, svc, now := setupSessionTest(t)
+
+	first, err := svc.Create("user-1", "198.51.100.1", "Mozilla/5.0")
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	if err := svc.Validate(first.SessionID, "user-1", "198.51.100.1"); err != nil {
+		t.Fatalf("新会话应有效: %v", err)
+	}
+	if err := svc.Validate(first.SessionID, "user-2", "198.51.100.1"); !errors.Is(err, ErrSessionInvalid) {
+		t.Errorf("会话不属于令牌中的用户时应失效")
+	}
+
+	*now = now.Add(time.Hour)
+	session, second, err := svc.Refresh(first.RefreshToken, "198.51.100.2")
+	if err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	if second.SessionID != first.SessionID || second.RefreshToken == first.RefreshToken {
+		t.Errorf("刷新应保持会话 ID 并轮换刷新令牌")
+	}
+	if session.UserID != "user-1" || !second.RefreshExpiresAt.Equal(now.AddDate(0, 0, 30)) {
+		t.Errorf("刷新后有效期应从当前时间重新计算，实际 %v", second.RefreshExpiresAt)
+	}
+
+	/* 旧令牌被重放：吊销会话，新令牌也随之失效 */
+	if _, _, err := svc.Refresh(first.RefreshToken, "203.0.113.9"); !errors.Is(err, ErrSessionRefreshReuse) {
+		t.Fatalf("已轮换的刷新令牌应被识别为重放，实际 %v", err)
+	}
+	if err := svc.Validate(first.SessionID, "user-1", "198.51.100.2"); !errors.Is(err, ErrSessionInvalid) {
+		t.Errorf("重放后会话应被吊销")
+	}
+	if _, _, err := svc.Refresh(second.RefreshToken, "198.51.100.2"); err == nil {
+		t.Errorf("会话吊销后新的刷新令牌也应失效")
+	}
+	var stored models.UserSession
+	db.First(&stored, "id = ?", first.SessionID)
+	if stored.RevokeReason != SessionRevokeRefreshReuse {
+		t.Errorf("吊销原因应为 %s，实际 %s", SessionRevokeRefreshReuse, stored.RevokeReason)
+	}
+
+	if _, _, err := svc.Refresh("unknown", "198.51.100.2"); !errors.Is(err, ErrSessionInvalid) {
+		t.Errorf("未知的刷新令牌应无效")
+	}
+}
+
+/* TestSession_RevokeAndExpiry 吊销单个会话、吊销其他会话、刷新令牌过期后会话失效 */
+func TestSession_RevokeAndExpiry(t *testing.T) {
+	_, svc, now := setupSessionTest(t)
+
+	a, _ := svc.Create("user-1", "198.51.100.1", "laptop")
+	b, _ := svc.Create("user-1", "198.51.100.2", "phone")
+	c, _ := svc.Create("user-1", "198.51.100.3", "ci")
+	other, _ := svc.Create("user-2", "198.51.100.4", "other")
+
+	if err := svc.Revoke("user-2", a.SessionID, SessionRevokeUser); err == nil {
+		t.Errorf("不能吊销其他用户的会话")
+	}
+	if err := svc.Revoke("user-1", c.SessionID, SessionRevokeUser); err != nil {
+		t.Fatalf("吊销会话失败: %v", err)
+	}
+
+	n, err := svc.RevokeAll("user-1", a.SessionID, SessionRevokeUser)
+	if err != nil || n != 1 {
+		t.Fatalf("应吊销除当前会话外的 1 个会话，实际 %d, %v", n, err)
+	}
+	sessions, _ := svc.List("user-1")
+	if len(sessions) != 1 || sessions[0].ID != a.SessionID {
+		t.Errorf("只应保留当前会话，实际 %d 个", len(sessions))
+	}
+	if err := svc.Validate(b.SessionID, "user-1", "198.51.100.2"); err == nil {
+		t.Errorf("被吊销的会话应失效")
+	}
+
+	if n, _ := svc.RevokeAll("user-1", "", SessionRevokePasswordChanged); n != 1 {
+		t.Errorf("修改密码应吊销剩余的全部会话，实际 %d", n)
+	}
+	if err := svc.Validate(other.SessionID, "user-2", "198.51.100.4"); err != nil {
+		t.Errorf("其他用户的会话不受影响: %v", err)
+	}
+
+	*now = now.AddDate(0, 0, 31)
+	if err := svc.Validate(other.SessionID, "user-2", "198.51.100.4"); !errors.Is(err, ErrSessionInvalid) {
+		t.Errorf("刷新令牌过期后会话应失效")
+	}
+	if _, _, err := svc.Refresh(other.RefreshToken, "198.51.100.4"); !errors.Is(err, ErrSessionInvalid) {
+		t.Errorf("过期的刷新令牌不能刷新，实际 %v", err)
+	}
+}
@@ -0,0 +1,665 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+
+	"gkipass/plane/internal/config"
+	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/pkg/oidc"
+)
+
+/*
+SSOStateTTL 授权状态有效期；SSOStateCookie 发起登录/关联时写入浏览器的 state Cookie，
+回调时必须与提交的 state 一致，防止把攻击者的授权码注入受害者浏览器（登录 CSRF）
+*/
+const (
+	SSOStateTTL    = 10 * time.Minute
+	SSOStateCookie = "sso_state"
+)
+
+const (
+	ssoStateKeyPrefix = "sso:state:"
+	ssoSettingKey     = "sso"
+	ssoProviderPrefix = "oidc:"
+)
+
+var ssoProviderNameRegex = regexp.MustCompile(`^[a-z0-9_-]{1,27}$`)
+
+/*
+SSOSettings 管理员维护的单点登录设置（系统设置 sso）
+*/
+type SSOSettings struct {
+	Providers []config.OIDCProvider `json:"providers"`
+}
+
+/*
+SSOProviderInfo 登录页展示的提供方信息
+*/
+type SSOProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+/*
+SSOLoginResult 单点登录回调结果
+功能：Linked 为 true 表示本次是已登录用户关联外部身份，调用方不应签发新令牌
+*/
+type SSOLoginResult struct {
+	User    *models.User
+	Created bool
+	Linked  bool
+}
+
+/* ssoState 授权请求的一次性状态，回调时取出并删除 */
+type ssoState struct {
+	Provider   string `json:"provider"`
+	Verifier   string `json:"verifier"`
+	Nonce      string `json:"nonce"`
+	LinkUserID string `json:"link_user_id,omitempty"`
+}
+
+type ssoMemoryState struct {
+	data     []byte
+	expireAt time.Time
+}
+
+/*
+SSOService 通用 OIDC 单点登录服务
+功能：授权码 + PKCE 登录、ID Token 校验、按组映射角色和开通套餐、自动创建用户，
+以及外部身份与本地用户的关联；授权状态优先存 Redis（多实例共享），否则存进程内存
+*/
+type SSOService struct {
+	db     *gorm.DB
+	rdb    *redis.Client
+	static []config.OIDCProvider
+	plans  *GormPlanService
+	client *http.Client
+	logger *zap.Logger
+
+	mu         sync.Mutex
+	discovered map[string]*oidc.Provider /* issuer → 发现结果 */
+	states     map[string]ssoMemoryState
+}
+
+/*
+NewSSOService 创建单点登录服务
+功能：rdb 为空时授权状态只保存在本实例内存中
+*/
+func NewSSOService(db *gorm.DB, rdb *redis.Client, providers []config.OIDCProvider) *SSOService {
+	return &SSOService{
+		db:         db,
+		rdb:        rdb,
+		static:     providers,
+		plans:      NewGormPlanService(db),
+		client:     &http.Client{Timeout: 10 * time.Second},
+		logger:     zap.L().Named("sso-service"),
+		discovered: make(map[string]*oidc.Provider),
+		states:     make(map[string]ssoMemoryState),
+	}
+}
+
+/* ==================== 提供方配置 ==================== */
+
+/*
+ValidateOIDCProvider 校验提供方配置
+*/
+func ValidateOIDCProvider(p *config.OIDCProvider) error {
+	if !ssoProviderNameRegex.MatchString(p.Name) {
+		return fmt.Errorf("提供方标识 %q 无效，只允许 1-27 位小写字母、数字、下划线和连字符", p.Name)
+	}
+	if !strings.HasPrefix(p.Issuer, "https://") && !strings.HasPrefix(p.Issuer, "http://") {
+		return fmt.Errorf("提供方 %s 的 issuer 必须是 http(s) 地址", p.Name)
+	}
+	if p.ClientID == "" || p.RedirectURL == "" {
+		return fmt.Errorf("提供方 %s 缺少 client_id 或 redirect_url", p.Name)
+	}
+	return nil
+}
+
+/*
+Settings 读取管理员维护的单点登录设置，未设置时返回空列表
+*/
+func (s *SSOService) Settings() (*SSOSettings, error) {
+	settings := &SSOSettings{Providers: []config.OIDCProvider{}}
+	var setting models.SystemSetting
+	if err := s.db.Where(&models.SystemSetting{Key: ssoSettingKey}).First(&setting).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return settings, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(setting.Value), settings); err != nil {
+		return nil, fmt.Errorf("解析单点登录设置失败: %w", err)
+	}
+	return settings, nil
+}
+
+/*
+Providers 返回全部提供方：配置文件中的提供方，管理员设置中的同名提供方覆盖之
+*/
+func (s *SSOService) Providers() []config.OIDCProvider {
+	providers := append([]config.OIDCProvider(nil), s.static...)
+	settings, err := s.Settings()
+	if err != nil {
+		s.logger.Warn("读取单点登录设置失败，只使用配置文件中的提供方", zap.Error(err))
+		return providers
+	}
+	for _, p := range settings.Providers {
+		replaced := false
+		for i := range providers {
+			if providers[i].Name == p.Name {
+				providers[i] = p
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+/*
+EnabledProviders 返回登录页展示的已启用提供方
+*/
+func (s *SSOService) EnabledProviders() []SSOProviderInfo {
+	list := []SSOProviderInfo{}
+	for _, p := range s.Providers() {
+		if !p.Enabled {
+			continue
+		}
+		name := p.DisplayName
+		if name == "" {
+			name = p.Name
+		}
+		list = append(list, SSOProviderInfo{Name: p.Name, DisplayName: name})
+	}
+	return list
+}
+
+/* provider 按标识查找已启用的提供方 */
+func (s *SSOService) provider(name string) (*config.OIDCProvider, error) {
+	for _, p := range s.Providers() {
+		if p.Name == name && p.Enabled {
+			if err := ValidateOIDCProvider(&p); err != nil {
+				return nil, err
+			}
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("单点登录提供方 %s 不存在或未启用", name)
+}
+
+/* oauthConfig 发现提供方端点（按 issuer 缓存）并生成 oauth2 配置 */
+func (s *SSOService) oauthConfig(ctx context.Context, p *config.OIDCProvider) (*oauth2.Config, *oidc.Provider, error) {
+	s.mu.Lock()
+	discovered := s.discovered[p.Issuer]
+	s.mu.Unlock()
+
+	if discovered == nil {
+		var err error
+		if discovered, err = oidc.Discover(ctx, p.Issuer, s.client); err != nil {
+			return nil, nil, err
+		}
+		s.mu.Lock()
+		s.discovered[p.Issuer] = discovered
+		s.mu.Unlock()
+	}
+
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  p.RedirectURL,
+		Endpoint:     discovered.Endpoint(),
+		Scopes:       scopes,
+	}, discovered, nil
+}
+
+/* ==================== 授权状态 ==================== */
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (s *SSOService) putState(ctx context.Context, key string, state *ssoState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if s.rdb != nil {
+		return s.rdb.Set(ctx, ssoStateKeyPrefix+key, data, SSOStateTTL).Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, v := range s.states {
+		if now.After(v.expireAt) {
+			delete(s.states, k)
+		}
+	}
+	s.states[key] = ssoMemoryState{data: data, expireAt: now.Add(SSOStateTTL)}
+	return nil
+}
+
+/* takeState 取出并删除授权状态，保证每个 state 只能回调一次 */
+func (s *SSOService) takeState(ctx context.Context, key string) (*ssoState, error) {
+	var data []byte
+	if s.rdb != nil {
+		raw, err := s.rdb.GetDel(ctx, ssoStateKeyPrefix+key).Bytes()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		data = raw
+	} else {
+		s.mu.Lock()
+		entry, ok := s.states[key]
+		delete(s.states, key)
+		s.mu.Unlock()
+		if ok && time.Now().Before(entry.expireAt) {
+			data = entry.data
+		}
+	}
+	if len(data) == 0 {
+		return nil, errors.New("登录状态无效或已过期，请重新登录")
+	}
+	var state ssoState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+/* ==================== 登录流程 ==================== */
+
+/*
+AuthURL 生成提供方授权地址
+功能：生成 state、nonce 和 PKCE verifier 并保存；linkUserID 非空表示已登录用户关联外部身份
+*/
+func (s *SSOService) AuthURL(ctx context.Context, name, linkUserID string) (string, string, error) {
+	p, err := s.provider(name)
+	if err != nil {
+		return "", "", err
+	}
+	conf, _, err := s.oauthConfig(ctx, p)
+	if err != nil {
+		return "", "", err
+	}
+
+	key, err1 := randomToken()
+	nonce, err2 := randomToken()
+	if err := errors.Join(err1, err2); err != nil {
+		return "", "", fmt.Errorf("生成登录状态失败: %w", err)
+	}
+	state := &ssoState{Provider: p.Name, Verifier: oauth2.GenerateVerifier(), Nonce: nonce, LinkUserID: linkUserID}
+	if err := s.putState(ctx, key, state); err != nil {
+		return "", "", fmt.Errorf("保存登录状态失败: %w", err)
+	}
+	url := conf.AuthCodeURL(key,
+		oauth2.S256ChallengeOption(state.Verifier),
+		oauth2.SetAuthURLParam("nonce", nonce))
+	return url, key, nil
+}
+
+/*
+Callback 处理提供方回调
+功能：校验 state 与发起时写入浏览器的 boundState 一致 → 取出一次性 state → 用 PKCE verifier 交换授权码 →
+校验 ID Token → 检查允许的组 → 关联或查找（必要时创建）本地用户 → 按组同步角色、开通套餐。
+关联流程要求 sessionUserID（回调请求的当前登录用户）与发起关联的用户相同
+*/
+func (s *SSOService) Callback(ctx context.Context, name, code, stateKey, boundState, sessionUserID string) (*SSOLoginResult, error) {
+	if boundState == "" || subtle.ConstantTimeCompare([]byte(boundState), []byte(stateKey)) != 1 {
+		return nil, errors.New("登录状态与当前浏览器不一致，请重新发起登录")
+	}
+	state, err := s.takeState(ctx, stateKey)
+	if err != nil {
+		return nil, err
+	}
+	if state.Provider != name {
+		return nil, errors.New("登录状态与提供方不一致")
+	}
+	if state.LinkUserID != "" && state.LinkUserID != sessionUserID {
+		return nil, errors.New("关联外部账号需以发起关联的用户登录")
+	}
+	p, err := s.provider(name)
+	if err != nil {
+		return nil, err
+	}
+	conf, discovered, err := s.oauthConfig(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := conf.Exchange(context.WithValue(ctx, oauth2.HTTPClient, s.client), code, oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		s.logger.Warn("OIDC 授权码交换失败", zap.String("provider", name), zap.Error(err))
+		return nil, errors.New("单点登录认证失败，请重试")
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, errors.New("提供方未返回 ID Token")
+	}
+	idToken, err := discovered.VerifyIDToken(ctx, rawIDToken, p.ClientID, state.Nonce)
+	if err != nil {
+		s.logger.Warn("OIDC ID Token 校验失败", zap.String("provider", name), zap.Error(err))
+		return nil, errors.New("单点登录认证失败，请重试")
+	}
+
+	groupsClaim := p.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	groups := oidc.ClaimStrings(idToken.Claims, groupsClaim)
+	if len(p.AllowedGroups) > 0 && !intersects(groups, p.AllowedGroups) {
+		return nil, errors.New("您所在的组无权登录本系统")
+	}
+
+	var result *SSOLoginResult
+	if state.LinkUserID != "" {
+		result, err = s.link(p, idToken, state.LinkUserID)
+	} else {
+		result, err = s.resolveUser(p, idToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !result.User.Enabled {
+		return nil, errors.New("账户已被禁用")
+	}
+
+	if !result.Linked {
+		s.syncRole(p, result.User, groups)
+		s.provisionPlan(p, result.User, groups)
+	}
+	now := time.Now()
+	s.db.Model(&models.UserIdentity{}).
+		Where("provider = ? AND subject = ?", ssoProviderPrefix+p.Name, idToken.Subject).
+		Update("last_login_at", now)
+	return result, nil
+}
+
+/* link 把外部身份关联到已登录用户，已被其他用户关联时拒绝 */
+func (s *SSOService) link(p *config.OIDCProvider, idToken *oidc.IDToken, userID string) (*SSOLoginResult, error) {
+	var user models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+	identity, err := s.findIdentity(p.Name, idToken.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		if identity.UserID != userID {
+			return nil, errors.New("该外部账号已关联其他用户")
+		}
+		return &SSOLoginResult{User: &user, Linked: true}, nil
+	}
+	if err := s.createIdentity(s.db, p.Name, idToken, userID); err != nil {
+		return nil, err
+	}
+	s.logger.Info("用户已关联外部身份", zap.String("userID", userID), zap.String("provider", p.Name))
+	return &SSOLoginResult{User: &user, Linked: true}, nil
+}
+
+/*
+resolveUser 按外部身份查找本地用户
+功能：已关联 → 对应用户；邮箱已验证且允许按邮箱关联 → 同邮箱的本地用户；允许自动创建 → 新用户
+*/
+func (s *SSOService) resolveUser(p *config.OIDCProvider, idToken *oidc.IDToken) (*SSOLoginResult, error) {
+	identity, err := s.findIdentity(p.Name, idToken.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		var user models.User
+		if err := s.db.First(&user, "id = ?", identity.UserID).Error; err != nil {
+			return nil, fmt.Errorf("关联的用户不存在")
+		}
+		return &SSOLoginResult{User: &user}, nil
+	}
+
+	email := strings.ToLower(strings.TrimSpace(idToken.Email))
+	if email != "" {
+		var existing models.User
+		err := s.db.Where("LOWER(email) = ?", email).First(&existing).Error
+		if err == nil {
+			if !p.LinkByEmail || !idToken.EmailVerified {
+				return nil, errors.New("该邮箱已被本地账户使用，请先用本地账户登录后在个人设置中关联")
+			}
+			if err := s.createIdentity(s.db, p.Name, idToken, existing.ID); err != nil {
+				return nil, err
+			}
+			s.logger.Info("按邮箱关联外部身份", zap.String("userID", existing.ID), zap.String("provider", p.Name))
+			return &SSOLoginResult{User: &existing}, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if !p.AutoCreate {
+		return nil, errors.New("该外部账号未关联本地用户，请联系管理员")
+	}
+	user, err := s.createUser(p, idToken, email)
+	if err != nil {
+		return nil, err
+	}
+	return &SSOLoginResult{User: user, Created: true}, nil
+}
+
+func (s *SSOService) findIdentity(provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := s.db.Where("provider = ? AND subject = ?", ssoProviderPrefix+provider, subject).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (s *SSOService) createIdentity(tx *gorm.DB, provider string, idToken *oidc.IDToken, userID string) error {
+	identity := &models.UserIdentity{
+		UserID:   userID,
+		Provider: ssoProviderPrefix + provider,
+		Subject:  idToken.Subject,
+		Email:    idToken.Email,
+	}
+	if err := tx.Create(identity).Error; err != nil {
+		return fmt.Errorf("关联外部身份失败: %w", err)
+	}
+	return nil
+}
+
+/*
+createUser 首次单点登录自动创建用户和钱包
+功能：用户名取 username_claim，不合法或已存在时加上 sub 摘要；没有邮箱时生成不可投递的占位邮箱
+*/
+func (s *SSOService) createUser(p *config.OIDCProvider, idToken *oidc.IDToken, email string) (*models.User, error) {
+	sum := sha256.Sum256([]byte(p.Name + ":" + idToken.Subject))
+	suffix := hex.EncodeToString(sum[:])[:8]
+
+	usernameClaim := p.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	username := ""
+	if values := oidc.ClaimStrings(idToken.Claims, usernameClaim); len(values) > 0 {
+		username = values[0]
+		if at := strings.IndexByte(username, '@'); at > 0 {
+			username = username[:at]
+		}
+	}
+	if ValidateUsername(username) != nil {
+		username = p.Name + "_" + suffix
+	} else {
+		var count int64
+		s.db.Model(&models.User{}).Where("username = ?", username).Count(&count)
+		if count > 0 {
+			if len(username) > 23 {
+				username = username[:23]
+			}
+			username = username + "_" + suffix
+		}
+	}
+	if email == "" {
+		email = p.Name + "-" + suffix + "@sso.invalid"
+	}
+
+	user := &models.User{
+		Username:   username,
+		Email:      email,
+		Role:       models.RoleUser,
+		Enabled:    true,
+		Provider:   ssoProviderPrefix + p.Name,
+		ProviderID: idToken.Subject,
+		LastLogin:  time.Now(),
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return fmt.Errorf("创建用户失败: %w", err)
+		}
+		if err := tx.Create(&models.Wallet{UserID: user.ID}).Error; err != nil {
+			return fmt.Errorf("创建钱包失败: %w", err)
+		}
+		return s.createIdentity(tx, p.Name, idToken, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("单点登录自动创建用户",
+		zap.String("userID", user.ID),
+		zap.String("username", user.Username),
+		zap.String("provider", p.Name))
+	return user, nil
+}
+
+/*
+syncRole 按组同步角色
+功能：配置了 admin_groups 时，组内用户提升为管理员；由该提供方创建的用户离开管理员组后降为普通用户，
+本地创建后关联的账户不会被降级
+*/
+func (s *SSOService) syncRole(p *config.OIDCProvider, user *models.User, groups []string) {
+	if len(p.AdminGroups) == 0 {
+		return
+	}
+	role := user.Role
+	if intersects(groups, p.AdminGroups) {
+		role = models.RoleAdmin
+	} else if user.Role == models.RoleAdmin && user.Provider == ssoProviderPrefix+p.Name {
+		role = models.RoleUser
+	}
+	if role == user.Role {
+		return
+	}
+	if err := s.db.Model(&models.User{}).Where("id = ?", user.ID).Update("role", role).Error; err != nil {
+		s.logger.Error("同步单点登录角色失败", zap.String("userID", user.ID), zap.Error(err))
+		return
+	}
+	s.logger.Info("按组同步用户角色",
+		zap.String("userID", user.ID),
+		zap.String("from", string(user.Role)),
+		zap.String("to", string(role)))
+	user.Role = role
+}
+
+/* provisionPlan 用户所在组映射了套餐且当前没有有效订阅时自动开通 */
+func (s *SSOService) provisionPlan(p *config.OIDCProvider, user *models.User, groups []string) {
+	for _, mapping := range p.GroupPlans {
+		if mapping.PlanID == "" || !intersects(groups, []string{mapping.Group}) {
+			continue
+		}
+		active, err := s.plans.GetActiveSubscription(user.ID)
+		if err != nil || active != nil {
+			return
+		}
+		if _, err := s.plans.Subscribe(user.ID, &SubscribeRequest{PlanID: mapping.PlanID}); err != nil {
+			s.logger.Warn("按组开通套餐失败",
+				zap.String("userID", user.ID),
+				zap.String("group", mapping.Group),
+				zap.String("planID", mapping.PlanID),
+				zap.Error(err))
+		}
+		return
+	}
+}
+
+/* ==================== 身份管理 ==================== */
+
+/*
+ListIdentities 列出用户关联的外部身份
+*/
+func (s *SSOService) ListIdentities(userID string) ([]models.UserIdentity, error) {
+	identities := []models.UserIdentity{}
+	err := s.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error
+	return identities, err
+}
+
+/*
+Unlink 解除外部身份关联
+功能：没有本地密码的用户不能解除最后一个外部身份，否则将无法登录
+*/
+func (s *SSOService) Unlink(userID, identityID string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := s.db.Where("id = ? AND user_id = ?", identityID, userID).First(&identity).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("外部身份不存在")
+		}
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.db.Select("password").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	var count int64
+	s.db.Model(&models.UserIdentity{}).Where("user_id = ?", userID).Count(&count)
+	if user.Password == "" && count <= 1 {
+		return nil, fmt.Errorf("账户未设置密码，不能解除最后一个外部身份")
+	}
+
+	/* 唯一索引包含软删除记录，直接物理删除以便重新关联 */
+	if err := s.db.Unscoped().Delete(&identity).Error; err != nil {
+		return nil, fmt.Errorf("解除关联失败: %w", err)
+	}
+	return &identity, nil
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"gkipass/plane/internal/config"
+	"gkipass/plane/internal/db/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/* testIdP 测试用 OIDC 提供方：发现、JWKS、授权码交换（校验 PKCE） */
+type testIdP struct {
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	idp := &testIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		base := idp.server.URL
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 base,
+			"authorization_endpoint": base + "/authorize",
+			"token_endpoint":         base + "/token",
+			"jwks_uri":               base + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "EC", "kid": "k1", "use": "sig", "crv": "P-256",
+			"x": enc(key.PublicKey.X.FillBytes(make([]byte, 32))),
+			"y": enc(key.PublicKey.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, idp.claims)
+		token.Header["kid"] = "k1"
+		raw, _ := token.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "at", "token_type": "Bearer", "expires_in": 300, "id_token": raw,
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+/* authorize 模拟浏览器跳转到授权地址：记录 PKCE challenge，按 nonce 准备 ID Token 声明 */
+func (idp *testIdP) authorize(t *testing.T, authURL string, claims jwt.MapClaims) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("授权地址无效: %v", err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("nonce") == "" {
+		t.Fatalf("授权地址缺少 PKCE 或 nonce 参数: %s", authURL)
+	}
+	now := time.Now()
+	claims["iss"] = idp.server.URL
+	claims["aud"] = "gkipass"
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(5 * time.Minute).Unix()
+	claims["nonce"] = q.Get("nonce")
+
+	idp.mu.Lock()
+	idp.challenge = q.Get("code_challenge")
+	idp.claims = claims
+	idp.mu.Unlock()
+}
+
+func setupSSOTest(t *testing.T) (*gorm.DB, *SSOService, *testIdP) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.UserIdentity{}, &models.SystemSetting{}); err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+
+	idp := newTestIdP(t)
+	svc := NewSSOService(db, nil, []config.OIDCProvider{{
+		Name:          "corp",
+		Enabled:       true,
+		Issuer:        idp.server.URL,
+		ClientID:      "gkipass",
+		ClientSecret:  "secret",
+		RedirectURL:   "https://panel.example.com/sso/callback",
+		GroupsClaim:   "groups",
+		AdminGroups:   []string{"ops"},
+		AllowedGroups: []string{"staff", "ops"},
+		AutoCreate:    true,
+		LinkByEmail:   true,
+	}})
+	return db, svc, idp
+}
+
+/* ssoLogin 走一遍完整的授权码流程 */
+func ssoLogin(t *testing.T, svc *SSOService, idp *testIdP, claims jwt.MapClaims) (*SSOLoginResult, error) {
+	t.Helper()
+	authURL, state, err := svc.AuthURL(context.Background(), "corp", "")
+	if err != nil {
+		t.Fatalf("生成授权地址失败: %v", err)
+	}
+	idp.authorize(t, authURL, claims)
+	return svc.Callback(context.Background(), "corp", "code", state, state, "")
+}
+
+/* TestSSO_AutoCreateAndRoleSync 首次登录自动创建用户并按组授予管理员，再次登录复用同一用户，离开管理员组后降级 */
+func TestSSO_AutoCreateAndRoleSync(t *testing.T) {
+	db, svc, idp := setupSSOTest(t)
+
+	result, err := ssoLogin(t, svc, idp, jwt.MapClaims{
+		"sub": "sub-1", "preferred_username": "bob", "email": "bob@corp.example", "email_verified": true,
+		"groups": []string{"staff", "ops"},
+	})
+	if err != nil {
+		t.Fatalf("首次单点登录失败: %v", err)
+	}
+	if !result.Created || result.User.Username != "bob" || result.User.Role != models.RoleAdmin {
+		t.Fatalf("应自动创建管理员用户 bob，实际 created=%v username=%s role=%s",
+			result.Created, result.User.Username, result.User.Role)
+	}
+	var wallets int64
+	db.Model(&models.Wallet{}).Where("user_id = ?", result.User.ID).Count(&wallets)
+	if wallets != 1 {
+		t.Errorf("自动创建用户应同时创建钱包")
+	}
+
+	again, err := ssoLogin(t, svc, idp, jwt.MapClaims{"sub": "sub-1", "groups": []string{"staff"}})
+	if err != nil {
+		t.Fatalf("再次单点登录失败: %v", err)
+	}
+	if again.Created || again.User.ID != result.User.ID {
+		t.Errorf("同一外部身份应登录到同一用户")
+	}
+	if again.User.Role != models.RoleUser {
+		t.Errorf("离开管理员组后应降为普通用户，实际 %s", again.User.Role)
+	}
+
+	if _, err := ssoLogin(t, svc, idp, jwt.MapClaims{"sub": "sub-2", "groups": []string{"guest"}}); err == nil {
+		t.Errorf("不在允许的组内应拒绝登录")
+	}
+}
+
+/* TestSSO_StateAndLinking state 只能使用一次；邮箱已验证时关联同邮箱的本地用户，未验证时拒绝；已登录用户可关联外部身份 */
+func TestSSO_StateAndLinking(t *testing.T) {
+	db, svc, idp := setupSSOTest(t)
+	ctx := context.Background()
+
+	local := &models.User{Username: "alice", Email: "alice@corp.example", Password: "x", Role: models.RoleUser, Enabled: true}
+	if err := db.Create(local).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+
+	authURL, state, _ := svc.AuthURL(ctx, "corp", "")
+	idp.authorize(t, authURL, jwt.MapClaims{
+		"sub": "sub-a", "email": "Alice@corp.example", "email_verified": false, "groups": []string{"staff"},
+	})
+	if _, err := svc.Callback(ctx, "corp", "code", state, state, ""); err == nil {
+		t.Fatalf("邮箱未验证时不应按邮箱关联本地用户")
+	}
+	if _, err := svc.Callback(ctx, "corp", "code", state, state, ""); err == nil {
+		t.Fatalf("state 只能使用一次")
+	}
+
+	result, err := ssoLogin(t, svc, idp, jwt.MapClaims{
+		"sub": "sub-a", "email": "Alice@corp.example", "email_verified": true, "groups": []string{"staff"},
+	})
+	if err != nil {
+		t.Fatalf("按邮箱关联登录失败: %v", err)
+	}
+	if result.Created || result.User.ID != local.ID {
+		t.Errorf("应登录到同邮箱的本地用户")
+	}
+
+	/* 已登录用户关联另一个外部身份 */
+	authURL, state, _ = svc.AuthURL(ctx, "corp", local.ID)
+	idp.authorize(t, authURL, jwt.MapClaims{"sub": "sub-b", "groups": []string{"staff"}})
+	linked, err := svc.Callback(ctx, "corp", "code", state, state, local.ID)
+	if err != nil || !linked.Linked {
+		t.Fatalf("关联外部身份失败: %v", err)
+	}
+	identities, _ := svc.ListIdentities(local.ID)
+	if len(identities) != 2 {
+		t.Fatalf("应有 2 个外部身份，实际 %d", len(identities))
+	}
+
+	if _, err := svc.Unlink(local.ID, identities[0].ID); err != nil {
+		t.Errorf("有本地密码的用户应能解除关联: %v", err)
+	}
+}
+
+/* TestSSO_StateBoundToBrowserAndLinkUser 回调的 state 必须与发起浏览器的 Cookie 一致；关联回调必须由发起关联的用户提交 */
+func TestSSO_StateBoundToBrowserAndLinkUser(t *testing.T) {
+	db, svc, idp := setupSSOTest(t)
+	ctx := context.Background()
+
+	victim := &models.User{Username: "victim", Email: "victim@corp.example", Password: "x", Role: models.RoleUser, Enabled: true}
+	if err := db.Create(victim).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+
+	/* 攻击者发起的授权被注入受害者浏览器：受害者没有对应的 state Cookie */
+	authURL, state, _ := svc.AuthURL(ctx, "corp", "")
+	idp.authorize(t, authURL, jwt.MapClaims{"sub": "sub-attacker", "groups": []string{"staff"}})
+	if _, err := svc.Callback(ctx, "corp", "code", state, "", ""); err == nil {
+		t.Fatalf("缺少 state Cookie 时应拒绝回调")
+	}
+	_, otherState, _ := svc.AuthURL(ctx, "corp", "")
+	if _, err := svc.Callback(ctx, "corp", "code", state, otherState, ""); err == nil {
+		t.Fatalf("state Cookie 与提交的 state 不一致时应拒绝回调")
+	}
+	if _, err := svc.Callback(ctx, "corp", "code", state, state, ""); err != nil {
+		t.Fatalf("不匹配的尝试不应消耗 state: %v", err)
+	}
+
+	/* 关联流程：回调时的登录用户必须是发起关联的用户 */
+	authURL, state, _ = svc.AuthURL(ctx, "corp", victim.ID)
+	idp.authorize(t, authURL, jwt.MapClaims{"sub": "sub-link", "groups": []string{"staff"}})
+	if _, err := svc.Callback(ctx, "corp", "code", state, state, ""); err == nil {
+		t.Fatalf("未登录时不应完成关联")
+	}
+	authURL, state, _ = svc.AuthURL(ctx, "corp", victim.ID)
+	idp.authorize(t, authURL, jwt.MapClaims{"sub": "sub-link", "groups": []string{"staff"}})
+	if _, err := svc.Callback(ctx, "corp", "code", state, state, "someone-else"); err == nil {
+		t.Fatalf("其他用户提交的回调不应关联到发起用户")
+	}
+	if identities, _ := svc.ListIdentities(victim.ID); len(identities) != 0 {
+		t.Fatalf("被拒绝的关联不应创建外部身份，实际 %d", len(identities))
+	}
+
+	authURL, state, _ = svc.AuthURL(ctx, "corp", victim.ID)
+	idp.authorize(t, authURL, jwt.MapClaims{"sub": "sub-link", "groups": []string{"staff"}})
+	if result, err := svc.Callback(ctx, "corp", "code", state, state, victim.ID); err != nil || !result.Linked {
+		t.Fatalf("发起用户本人应能完成关联: %v", err)
+	}
+}
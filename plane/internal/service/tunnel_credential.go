@@ -0,0 +1,226 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"gkipass/plane/internal/db/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+/*
+TunnelCredentialInput 隧道代理认证凭据输入
+功能：创建/更新隧道时提交的用户名密码。
+更新时 Password 为空表示沿用该用户名已有的密码
+*/
+type TunnelCredentialInput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Enabled  *bool  `json:"enabled,omitempty"`
+}
+
+/*
+HashProxyPassword 计算代理认证密码摘要
+功能：hex(SHA-256(salt + password))，节点端使用相同算法校验
+*/
+func HashProxyPassword(salt, password string) string {
+	sum := sha256.Sum256([]byte(salt + password))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+isProxyIngress 入口协议是否为 SOCKS5/HTTP 正向代理（必须认证）
+*/
+func isProxyIngress(protocol models.TunnelProtocol) bool {
+	return protocol == models.ProtocolSOCKS5 || protocol == models.ProtocolHTTP
+}
+
+/*
+credentialDigest 凭据摘要
+功能：隧道凭据与用户级凭据共用的校验结果
+*/
+type credentialDigest struct {
+	Username     string
+	PasswordHash string
+	Salt         string
+	Enabled      bool
+}
+
+/*
+digestCredentialInputs 校验并计算凭据摘要
+功能：检查用户名密码长度与重复；未提交密码的已有用户名沿用 existing 中的摘要
+*/
+func digestCredentialInputs(inputs []TunnelCredentialInput, existing map[string]credentialDigest) ([]credentialDigest, error) {
+	digests := make([]credentialDigest, 0, len(inputs))
+	seen := make(map[string]bool, len(inputs))
+	for _, input := range inputs {
+		/* RFC 1929 用户名和密码长度均为 1-255 字节 */
+		if len(input.Username) == 0 || len(input.Username) > 255 {
+			return nil, fmt.Errorf("凭据用户名长度必须在 1-255 字节之间")
+		}
+		if len(input.Password) > 255 {
+			return nil, fmt.Errorf("凭据 '%s' 的密码超过 255 字节", input.Username)
+		}
+		/* HTTP Basic 认证以冒号分隔用户名和密码 */
+		if strings.Contains(input.Username, ":") {
+			return nil, fmt.Errorf("凭据用户名 '%s' 不能包含冒号", input.Username)
+		}
+		if seen[input.Username] {
+			return nil, fmt.Errorf("凭据用户名 '%s' 重复", input.Username)
+		}
+		seen[input.Username] = true
+
+		enabled := true
+		if input.Enabled != nil {
+			enabled = *input.Enabled
+		}
+
+		digest := credentialDigest{Username: input.Username, Enabled: enabled}
+		if input.Password != "" {
+			salt := make([]byte, 16)
+			if _, err := rand.Read(salt); err != nil {
+				return nil, fmt.Errorf("生成凭据盐值失败: %w", err)
+			}
+			digest.Salt = hex.EncodeToString(salt)
+			digest.PasswordHash = HashProxyPassword(digest.Salt, input.Password)
+		} else if old, ok := existing[input.Username]; ok {
+			digest.Salt = old.Salt
+			digest.PasswordHash = old.PasswordHash
+		} else {
+			return nil, fmt.Errorf("新凭据 '%s' 必须设置密码", input.Username)
+		}
+		digests = append(digests, digest)
+	}
+	return digests, nil
+}
+
+/*
+replaceTunnelCredentials 替换隧道的全部认证凭据
+功能：在事务中按输入重建凭据列表；未提交密码的已有用户名保留原摘要
+*/
+func replaceTunnelCredentials(tx *gorm.DB, tunnelID string, inputs []TunnelCredentialInput) error {
+	var existing []models.TunnelCredential
+	if err := tx.Where("tunnel_id = ?", tunnelID).Find(&existing).Error; err != nil {
+		return fmt.Errorf("查询隧道凭据失败: %w", err)
+	}
+	existingByUser := make(map[string]credentialDigest, len(existing))
+	for _, cred := range existing {
+		existingByUser[cred.Username] = credentialDigest{PasswordHash: cred.PasswordHash, Salt: cred.Salt}
+	}
+
+	digests, err := digestCredentialInputs(inputs, existingByUser)
+	if err != nil {
+		return err
+	}
+
+	/* 硬删除旧凭据，避免软删除记录残留摘要 */
+	if err := tx.Unscoped().Where("tunnel_id = ?", tunnelID).Delete(&models.TunnelCredential{}).Error; err != nil {
+		return fmt.Errorf("删除旧凭据失败: %w", err)
+	}
+	if len(digests) == 0 {
+		return nil
+	}
+
+	credentials := make([]models.TunnelCredential, 0, len(digests))
+	for _, d := range digests {
+		credentials = append(credentials, models.TunnelCredential{
+			TunnelID:     tunnelID,
+			Username:     d.Username,
+			PasswordHash: d.PasswordHash,
+			Salt:         d.Salt,
+			Enabled:      d.Enabled,
+		})
+	}
+	if err := tx.Create(&credentials).Error; err != nil {
+		return fmt.Errorf("保存隧道凭据失败: %w", err)
+	}
+	return nil
+}
+
+/*
+GormProxyCredentialService 用户级代理认证凭据服务
+功能：管理对用户全部代理入口隧道生效的凭据
+*/
+type GormProxyCredentialService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+/*
+NewGormProxyCredentialService 创建用户级代理凭据服务
+*/
+func NewGormProxyCredentialService(db *gorm.DB) *GormProxyCredentialService {
+	return &GormProxyCredentialService{
+		db:     db,
+		logger: zap.L().Named("gorm-proxy-credential"),
+	}
+}
+
+/*
+ListUserCredentials 列出用户的代理凭据（不含摘要）
+*/
+func (s *GormProxyCredentialService) ListUserCredentials(userID string) ([]models.UserProxyCredential, error) {
+	var credentials []models.UserProxyCredential
+	if err := s.db.Where("user_id = ?", userID).Order("username").Find(&credentials).Error; err != nil {
+		return nil, fmt.Errorf("查询用户代理凭据失败: %w", err)
+	}
+	return credentials, nil
+}
+
+/*
+ReplaceUserCredentials 替换用户的全部代理凭据
+功能：语义与隧道凭据一致，空列表表示清空；
+调用方随后通过 GormNodeSyncService.OnUserProxyCredentialsUpdated 推送到节点使其立即生效
+*/
+func (s *GormProxyCredentialService) ReplaceUserCredentials(userID string, inputs []TunnelCredentialInput) ([]models.UserProxyCredential, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var existing []models.UserProxyCredential
+		if err := tx.Where("user_id = ?", userID).Find(&existing).Error; err != nil {
+			return fmt.Errorf("查询用户代理凭据失败: %w", err)
+		}
+		existingByUser := make(map[string]credentialDigest, len(existing))
+		for _, cred := range existing {
+			existingByUser[cred.Username] = credentialDigest{PasswordHash: cred.PasswordHash, Salt: cred.Salt}
+		}
+
+		digests, err := digestCredentialInputs(inputs, existingByUser)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.UserProxyCredential{}).Error; err != nil {
+			return fmt.Errorf("删除旧凭据失败: %w", err)
+		}
+		if len(digests) == 0 {
+			return nil
+		}
+
+		credentials := make([]models.UserProxyCredential, 0, len(digests))
+		for _, d := range digests {
+			credentials = append(credentials, models.UserProxyCredential{
+				UserID:       userID,
+				Username:     d.Username,
+				PasswordHash: d.PasswordHash,
+				Salt:         d.Salt,
+				Enabled:      d.Enabled,
+			})
+		}
+		if err := tx.Create(&credentials).Error; err != nil {
+			return fmt.Errorf("保存用户代理凭据失败: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("用户代理凭据已更新",
+		zap.String("user_id", userID),
+		zap.Int("count", len(inputs)))
+	return s.ListUserCredentials(userID)
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/*
+setupProxyCredentialTest 创建用户级代理凭据测试环境
+功能：入口组 ingress 含在线节点 n1，user-1 创建了 socks5 入口隧道 tunnel-socks（无隧道凭据）
+*/
+func setupProxyCredentialTest(t *testing.T) (*GormProxyCredentialService, *GormNodeSyncService, *rolloutTestSender) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	createNodeGroupNodesTable(db)
+	err = db.AutoMigrate(&models.Node{}, &models.NodeGroup{}, &models.Tunnel{}, &models.TunnelTarget{},
+		&models.TunnelHop{}, &models.Rule{}, &models.TunnelCredential{}, &models.UserProxyCredential{},
+		&models.RuleChange{}, &models.RuleChangeSequence{}, &models.NodeSyncState{})
+	if err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+
+	ingress := models.NodeGroup{Name: "入口组", Role: models.NodeRoleIngress}
+	ingress.ID = "ingress"
+	db.Create(&ingress)
+	node := models.Node{Name: "n1", Status: models.NodeStatusOnline}
+	node.ID = "n1"
+	if err := db.Create(&node).Error; err != nil {
+		t.Fatalf("创建节点失败: %v", err)
+	}
+	addGroupMember(db, "ingress", "n1")
+
+	tunnel := models.Tunnel{
+		Name:            "代理隧道",
+		Enabled:         true,
+		CreatedBy:       "user-1",
+		IngressGroupID:  "ingress",
+		Protocol:        models.ProtocolTCP,
+		IngressProtocol: models.ProtocolSOCKS5,
+		ListenPort:      1080,
+		TargetAddress:   "0.0.0.0",
+		TargetPort:      1,
+	}
+	tunnel.ID = "tunnel-socks"
+	db.Create(&tunnel)
+
+	sender := &rolloutTestSender{online: []string{"n1"}, sent: make(map[string][]*SyncRulesMessage)}
+	return NewGormProxyCredentialService(db), NewGormNodeSyncService(db, sender), sender
+}
+
+/*
+createNodeGroupNodesTable 创建节点组成员关联表
+功能：同步服务按 group_id 查询组成员，GORM 关联预加载使用 node_group_id，测试中两列同时保存
+*/
+func createNodeGroupNodesTable(db *gorm.DB) {
+	db.Exec(`CREATE TABLE IF NOT EXISTS node_group_nodes (
+		group_id VARCHAR(36) NOT NULL,
+		node_group_id VARCHAR(36) NOT NULL,
+		node_id VARCHAR(36) NOT NULL,
+		PRIMARY KEY (group_id, node_id)
+	)`)
+}
+
+/* addGroupMember 将节点加入节点组 */
+func addGroupMember(db *gorm.DB, groupID, nodeID string) {
+	db.Exec("INSERT INTO node_group_nodes (group_id, node_group_id, node_id) VALUES (?, ?, ?)", groupID, groupID, nodeID)
+}
+
+/* lastProxyRule 节点最近一次收到的代理隧道规则，未下发时为 nil */
+func lastProxyRule(s *rolloutTestSender) *SyncRulePayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msgs := s.sent["n1"]
+	if len(msgs) == 0 {
+		return nil
+	}
+	for _, rule := range msgs[len(msgs)-1].Rules {
+		if rule.TunnelID == "tunnel-socks" {
+			return &rule
+		}
+	}
+	return nil
+}
+
+/* proxyRuleAccepts 按节点的校验方式判断规则中的凭据是否接受该用户名密码 */
+func proxyRuleAccepts(rule *SyncRulePayload, username, password string) bool {
+	for _, cred := range rule.Credentials {
+		if cred.Username == username && cred.PasswordHash == HashProxyPassword(cred.Salt, password) {
+			return true
+		}
+	}
+	return false
+}
+
+/* TestProxyCredentials_RotateAndRevokeResync 用户级凭据轮换、吊销后立即推送，旧密码在节点上不再通过 */
+func TestProxyCredentials_RotateAndRevokeResync(t *testing.T) {
+	credSvc, syncSvc, sender := setupProxyCredentialTest(t)
+	ctx := context.Background()
+
+	if _, err := credSvc.ReplaceUserCredentials("user-1", []TunnelCredentialInput{{Username: "alice", Password: "old-pass"}}); err != nil {
+		t.Fatalf("设置凭据失败: %v", err)
+	}
+	if err := syncSvc.OnUserProxyCredentialsUpdated(ctx, "user-1"); err != nil {
+		t.Fatalf("同步凭据失败: %v", err)
+	}
+	rule := lastProxyRule(sender)
+	if rule == nil || !proxyRuleAccepts(rule, "alice", "old-pass") {
+		t.Fatalf("设置凭据后节点应收到可校验 alice 的规则")
+	}
+
+	/* 轮换密码：旧密码被拒绝，新密码通过 */
+	if _, err := credSvc.ReplaceUserCredentials("user-1", []TunnelCredentialInput{{Username: "alice", Password: "new-pass"}}); err != nil {
+		t.Fatalf("轮换凭据失败: %v", err)
+	}
+	syncSvc.OnUserProxyCredentialsUpdated(ctx, "user-1")
+	rule = lastProxyRule(sender)
+	if rule == nil {
+		t.Fatal("轮换后节点应收到更新的规则")
+	}
+	if proxyRuleAccepts(rule, "alice", "old-pass") {
+		t.Errorf("轮换后旧密码应被拒绝")
+	}
+	if !proxyRuleAccepts(rule, "alice", "new-pass") {
+		t.Errorf("轮换后新密码应通过")
+	}
+
+	/* 吊销全部凭据：代理入口不再下发，节点移除规则而不是变成开放代理 */
+	if _, err := credSvc.ReplaceUserCredentials("user-1", nil); err != nil {
+		t.Fatalf("清空凭据失败: %v", err)
+	}
+	syncSvc.OnUserProxyCredentialsUpdated(ctx, "user-1")
+	sender.mu.Lock()
+	msgs := sender.sent["n1"]
+	last := msgs[len(msgs)-1]
+	sender.mu.Unlock()
+	if len(msgs) != 3 {
+		t.Fatalf("每次凭据变更都应立即推送，实际推送 %d 次", len(msgs))
+	}
+	if rule := lastProxyRule(sender); rule != nil {
+		t.Errorf("没有凭据的代理入口不应下发，实际凭据 %v", rule.Credentials)
+	}
+	if !last.Force {
+		for _, id := range last.Deleted {
+			if id == "tunnel-socks" {
+				return
+			}
+		}
+		t.Errorf("增量同步应要求节点删除该隧道规则")
+	}
+}
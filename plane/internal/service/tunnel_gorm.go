@@ -1,11 +1,19 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/pkg/tracing"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -53,6 +61,25 @@ type CreateTunnelRequest struct {
 	MaxConnections   int    `json:"max_connections"`
 	IdleTimeout      int    `json:"idle_timeout"`
 	LoadBalanceMode  string `json:"load_balance_mode"`
+
+	/* PROXY protocol：SendProxyProtocol 为空、v1 或 v2 */
+	SendProxyProtocol   string `json:"send_proxy_protocol"`
+	AcceptProxyProtocol bool   `json:"accept_proxy_protocol"`
+
+	/* 代理入口目标白名单：更新时为 null 表示不修改，空数组表示不限制 */
+	AllowedDomains []string `json:"allowed_domains"`
+
+	/* 是否允许 SOCKS5 BIND 命令 */
+	AllowBind bool `json:"allow_bind"`
+
+	/* 共享端口路由主机名：更新时为 null 表示不修改，空数组表示独占端口 */
+	Hostnames []string `json:"hostnames"`
+
+	/* 中继跳（按顺序）：更新时为 null 表示不修改，空数组表示恢复单跳 */
+	Hops []TunnelHopInput `json:"hops"`
+
+	/* 代理入口认证凭据：更新时为 null 表示不修改，空数组表示清空 */
+	Credentials []TunnelCredentialInput `json:"credentials"`
 }
 
 /*
@@ -60,7 +87,12 @@ CreateTunnel 创建隧道
 功能：在事务中创建隧道和关联的默认转发规则
 流程：验证 → 创建隧道 → 创建默认规则 → 提交
 */
-func (s *GormTunnelService) CreateTunnel(req *CreateTunnelRequest, userID string) (*models.Tunnel, error) {
+func (s *GormTunnelService) CreateTunnel(ctx context.Context, req *CreateTunnelRequest, userID string) (result *models.Tunnel, err error) {
+	_, span := tracing.Start(ctx, "GormTunnelService.CreateTunnel",
+		attribute.String("gkipass.tunnel.name", req.Name),
+		attribute.String("gkipass.user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
 	/* 参数验证 */
 	if req.Name == "" {
 		return nil, fmt.Errorf("隧道名称不能为空")
@@ -74,6 +106,17 @@ func (s *GormTunnelService) CreateTunnel(req *CreateTunnelRequest, userID string
 	if req.TargetAddress == "" {
 		return nil, fmt.Errorf("目标地址不能为空")
 	}
+	if err := validateProxyProtocolVersion(req.SendProxyProtocol); err != nil {
+		return nil, err
+	}
+	allowedDomains, err := encodeAllowedDomains(req.AllowedDomains)
+	if err != nil {
+		return nil, err
+	}
+	hostnames, err := encodeHostnames(req.Hostnames)
+	if err != nil {
+		return nil, err
+	}
 
 	/* 设置默认值 */
 	protocol := models.TunnelProtocol(req.Protocol)
@@ -100,6 +143,13 @@ func (s *GormTunnelService) CreateTunnel(req *CreateTunnelRequest, userID string
 	if loadBalanceMode == "" {
 		loadBalanceMode = "round-robin"
 	}
+	if err := s.checkReverseEgress(req.EgressGroupID, protocol); err != nil {
+		return nil, err
+	}
+	reverseSecret, err := newReverseSecret()
+	if err != nil {
+		return nil, err
+	}
 
 	/* 检查名称重复 */
 	var nameCount int64
@@ -108,8 +158,18 @@ func (s *GormTunnelService) CreateTunnel(req *CreateTunnelRequest, userID string
 		return nil, fmt.Errorf("隧道名称 '%s' 已存在", req.Name)
 	}
 
+	/* 共享端口路由校验 */
+	if hostnames != "" {
+		if err := validateHostnameIngress(ingressProtocol); err != nil {
+			return nil, err
+		}
+		if err := s.checkHostnameConflict(req.IngressGroupID, DecodeHostnames(hostnames), ""); err != nil {
+			return nil, err
+		}
+	}
+
 	/* 检查端口冲突 */
-	if err := s.checkPortConflict(req.IngressGroupID, req.ListenPort, ""); err != nil {
+	if err := s.checkPortConflict(req.IngressGroupID, req.ListenPort, "", hostnames != ""); err != nil {
 		return nil, err
 	}
 
@@ -134,10 +194,17 @@ func (s *GormTunnelService) CreateTunnel(req *CreateTunnelRequest, userID string
 		MaxConnections:   req.MaxConnections,
 		IdleTimeout:      idleTimeout,
 		LoadBalanceMode:  loadBalanceMode,
+
+		SendProxyProtocol:   req.SendProxyProtocol,
+		AcceptProxyProtocol: req.AcceptProxyProtocol,
+		AllowedDomains:      allowedDomains,
+		AllowBind:           req.AllowBind,
+		Hostnames:           hostnames,
+		ReverseSecret:       reverseSecret,
 	}
 
 	/* 事务中创建隧道和默认规则 */
-	err := s.db.Transaction(func(tx *gorm.DB) error {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
 		/* 创建隧道 */
 		if err := tx.Create(tunnel).Error; err != nil {
 			return fmt.Errorf("创建隧道失败: %w", err)
@@ -173,6 +240,20 @@ func (s *GormTunnelService) CreateTunnel(req *CreateTunnelRequest, userID string
 			return fmt.Errorf("创建默认规则失败: %w", err)
 		}
 
+		/* 保存中继跳 */
+		if len(req.Hops) > 0 {
+			if err := replaceTunnelHops(tx, tunnel, req.Hops); err != nil {
+				return err
+			}
+		}
+
+		/* 保存代理认证凭据 */
+		if len(req.Credentials) > 0 {
+			if err := replaceTunnelCredentials(tx, tunnel.ID, req.Credentials); err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 
@@ -200,6 +281,8 @@ func (s *GormTunnelService) GetTunnel(id string) (*models.Tunnel, error) {
 	err := s.db.
 		Preload("Rules").
 		Preload("Targets").
+		Preload("Credentials").
+		Preload("Hops", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
 		First(&tunnel, "id = ?", id).Error
 
 	if err != nil {
@@ -235,7 +318,10 @@ func (s *GormTunnelService) ListTunnels(userID string, enabledOnly bool) ([]mode
 UpdateTunnel 更新隧道
 功能：更新隧道配置并同步更新关联规则
 */
-func (s *GormTunnelService) UpdateTunnel(id string, req *CreateTunnelRequest) (*models.Tunnel, error) {
+func (s *GormTunnelService) UpdateTunnel(ctx context.Context, id string, req *CreateTunnelRequest) (result *models.Tunnel, err error) {
+	_, span := tracing.Start(ctx, "GormTunnelService.UpdateTunnel", attribute.String("gkipass.tunnel.id", id))
+	defer func() { tracing.End(span, err) }()
+
 	var tunnel models.Tunnel
 	if err := s.db.First(&tunnel, "id = ?", id).Error; err != nil {
 		return nil, fmt.Errorf("隧道不存在: %s", id)
@@ -250,19 +336,59 @@ func (s *GormTunnelService) UpdateTunnel(id string, req *CreateTunnelRequest) (*
 		}
 	}
 
-	/* 检查端口冲突（排除自身） */
+	if err := validateProxyProtocolVersion(req.SendProxyProtocol); err != nil {
+		return nil, err
+	}
+
+	/* 反向出口组校验（按更新后的出口组和协议） */
+	protocol := tunnel.Protocol
+	if req.Protocol != "" {
+		protocol = models.TunnelProtocol(req.Protocol)
+	}
+	if err := s.checkReverseEgress(req.EgressGroupID, protocol); err != nil {
+		return nil, err
+	}
+
+	/* 共享端口路由校验（按更新后的主机名和入口协议） */
 	groupID := req.IngressGroupID
 	if groupID == "" {
 		groupID = tunnel.IngressGroupID
 	}
-	if req.ListenPort != tunnel.ListenPort {
-		if err := s.checkPortConflict(groupID, req.ListenPort, id); err != nil {
+	hostnames := tunnel.Hostnames
+	if req.Hostnames != nil {
+		encoded, err := encodeHostnames(req.Hostnames)
+		if err != nil {
+			return nil, err
+		}
+		hostnames = encoded
+	}
+	if hostnames != "" {
+		ingressProtocol := tunnel.IngressProtocol
+		if req.Protocol != "" {
+			ingressProtocol = models.TunnelProtocol(req.IngressProtocol)
+			if ingressProtocol == "" {
+				ingressProtocol = models.TunnelProtocol(req.Protocol)
+			}
+		}
+		if err := validateHostnameIngress(ingressProtocol); err != nil {
+			return nil, err
+		}
+		if req.Hostnames != nil || groupID != tunnel.IngressGroupID {
+			if err := s.checkHostnameConflict(groupID, DecodeHostnames(hostnames), id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	/* 检查端口冲突（排除自身） */
+	if req.ListenPort != tunnel.ListenPort || hostnames != tunnel.Hostnames {
+		if err := s.checkPortConflict(groupID, req.ListenPort, id, hostnames != ""); err != nil {
 			return nil, err
 		}
 	}
 
 	/* 事务中更新隧道和规则 */
-	err := s.db.Transaction(func(tx *gorm.DB) error {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
 		updates := map[string]interface{}{
 			"name":              req.Name,
 			"description":       req.Description,
@@ -277,6 +403,10 @@ func (s *GormTunnelService) UpdateTunnel(id string, req *CreateTunnelRequest) (*
 			"rate_limit_bps":    req.RateLimitBPS,
 			"max_connections":   req.MaxConnections,
 			"idle_timeout":      req.IdleTimeout,
+
+			"send_proxy_protocol":   req.SendProxyProtocol,
+			"accept_proxy_protocol": req.AcceptProxyProtocol,
+			"allow_bind":            req.AllowBind,
 		}
 
 		if req.Protocol != "" {
@@ -290,6 +420,16 @@ func (s *GormTunnelService) UpdateTunnel(id string, req *CreateTunnelRequest) (*
 		if req.LoadBalanceMode != "" {
 			updates["load_balance_mode"] = req.LoadBalanceMode
 		}
+		if req.AllowedDomains != nil {
+			allowedDomains, err := encodeAllowedDomains(req.AllowedDomains)
+			if err != nil {
+				return err
+			}
+			updates["allowed_domains"] = allowedDomains
+		}
+		if req.Hostnames != nil {
+			updates["hostnames"] = hostnames
+		}
 
 		if err := tx.Model(&tunnel).Updates(updates).Error; err != nil {
 			return fmt.Errorf("更新隧道失败: %w", err)
@@ -316,6 +456,24 @@ func (s *GormTunnelService) UpdateTunnel(id string, req *CreateTunnelRequest) (*
 			return fmt.Errorf("同步更新规则失败: %w", err)
 		}
 
+		/* 替换中继跳（按更新后的入口/出口组校验） */
+		if req.Hops != nil {
+			var updated models.Tunnel
+			if err := tx.First(&updated, "id = ?", id).Error; err != nil {
+				return fmt.Errorf("查询隧道失败: %w", err)
+			}
+			if err := replaceTunnelHops(tx, &updated, req.Hops); err != nil {
+				return err
+			}
+		}
+
+		/* 替换代理认证凭据 */
+		if req.Credentials != nil {
+			if err := replaceTunnelCredentials(tx, id, req.Credentials); err != nil {
+				return err
+			}
+		}
+
 		/* 递增规则版本号 */
 		if err := tx.Model(&models.Rule{}).
 			Where("tunnel_id = ?", id).
@@ -336,9 +494,12 @@ func (s *GormTunnelService) UpdateTunnel(id string, req *CreateTunnelRequest) (*
 
 /*
 DeleteTunnel 删除隧道
-功能：在事务中删除隧道及其关联的规则、目标、ACL
+功能：在事务中删除隧道及其关联的规则、目标、ACL、凭据和中继跳
 */
-func (s *GormTunnelService) DeleteTunnel(id string) error {
+func (s *GormTunnelService) DeleteTunnel(ctx context.Context, id string) (err error) {
+	_, span := tracing.Start(ctx, "GormTunnelService.DeleteTunnel", attribute.String("gkipass.tunnel.id", id))
+	defer func() { tracing.End(span, err) }()
+
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		/* 删除关联的 ACL 规则 */
 		if err := tx.Where("rule_id IN (?)",
@@ -357,6 +518,16 @@ func (s *GormTunnelService) DeleteTunnel(id string) error {
 			return fmt.Errorf("删除关联目标失败: %w", err)
 		}
 
+		/* 删除代理认证凭据 */
+		if err := tx.Unscoped().Where("tunnel_id = ?", id).Delete(&models.TunnelCredential{}).Error; err != nil {
+			return fmt.Errorf("删除关联凭据失败: %w", err)
+		}
+
+		/* 删除中继跳 */
+		if err := tx.Where("tunnel_id = ?", id).Delete(&models.TunnelHop{}).Error; err != nil {
+			return fmt.Errorf("删除中继跳失败: %w", err)
+		}
+
 		/* 删除隧道 */
 		result := tx.Delete(&models.Tunnel{}, "id = ?", id)
 		if result.Error != nil {
@@ -374,7 +545,12 @@ func (s *GormTunnelService) DeleteTunnel(id string) error {
 ToggleTunnel 切换隧道启用/禁用状态
 功能：同时更新隧道和其关联规则的启用状态
 */
-func (s *GormTunnelService) ToggleTunnel(id string, enabled bool) (*models.Tunnel, error) {
+func (s *GormTunnelService) ToggleTunnel(ctx context.Context, id string, enabled bool) (_ *models.Tunnel, err error) {
+	_, span := tracing.Start(ctx, "GormTunnelService.ToggleTunnel",
+		attribute.String("gkipass.tunnel.id", id),
+		attribute.Bool("gkipass.tunnel.enabled", enabled))
+	defer func() { tracing.End(span, err) }()
+
 	return nil, s.db.Transaction(func(tx *gorm.DB) error {
 		/* 更新隧道状态 */
 		if err := tx.Model(&models.Tunnel{}).
@@ -451,8 +627,9 @@ func (s *GormTunnelService) GetRulesByTunnelID(tunnelID string) ([]models.Rule,
 checkPortConflict 检查端口冲突
 功能：在同一个入口节点组中检测端口是否已被占用
 excludeTunnelID 排除当前隧道（用于更新场景）
+shared 为 true（隧道配置了主机名）时仅与同端口上的独占隧道冲突
 */
-func (s *GormTunnelService) checkPortConflict(ingressGroupID string, port int, excludeTunnelID string) error {
+func (s *GormTunnelService) checkPortConflict(ingressGroupID string, port int, excludeTunnelID string, shared bool) error {
 	if ingressGroupID == "" {
 		return nil /* 无入口组时跳过检查 */
 	}
@@ -463,6 +640,9 @@ func (s *GormTunnelService) checkPortConflict(ingressGroupID string, port int, e
 	if excludeTunnelID != "" {
 		query = query.Where("id != ?", excludeTunnelID)
 	}
+	if shared {
+		query = query.Where("hostnames IS NULL OR hostnames = ''")
+	}
 
 	var count int64
 	if err := query.Count(&count).Error; err != nil {
@@ -475,3 +655,94 @@ func (s *GormTunnelService) checkPortConflict(ingressGroupID string, port int, e
 
 	return nil
 }
+
+/*
+checkReverseEgress 校验反向模式出口组
+功能：反向连接池基于流式传输建立，出口组为反向模式时隧道协议不能为 udp
+*/
+func (s *GormTunnelService) checkReverseEgress(egressGroupID string, protocol models.TunnelProtocol) error {
+	if egressGroupID == "" {
+		return nil
+	}
+
+	var group models.NodeGroup
+	if err := s.db.Select("id", "reverse_mode").First(&group, "id = ?", egressGroupID).Error; err != nil {
+		return nil /* 出口组不存在时交由其他校验处理 */
+	}
+
+	if group.ReverseMode && protocol == models.ProtocolUDP {
+		return fmt.Errorf("出口组为反向模式，隧道协议不能为 udp")
+	}
+	return nil
+}
+
+/*
+newReverseSecret 生成反向隧道握手密钥
+*/
+func newReverseSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成反向隧道密钥失败: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+/*
+validateProxyProtocolVersion 校验 PROXY protocol 版本
+功能：仅允许空（不发送）、v1、v2
+*/
+func validateProxyProtocolVersion(version string) error {
+	switch version {
+	case "", "v1", "v2":
+		return nil
+	default:
+		return fmt.Errorf("不支持的 PROXY protocol 版本: %s（可选 v1、v2）", version)
+	}
+}
+
+/*
+encodeAllowedDomains 规范化并编码代理入口目标白名单
+功能：去除空白与末尾点号、统一小写，仅允许精确域名/IP 或 *.example.com 通配，
+空列表编码为空字符串（不限制）
+*/
+func encodeAllowedDomains(domains []string) (string, error) {
+	normalized := make([]string, 0, len(domains))
+	seen := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain == "" || seen[domain] {
+			continue
+		}
+		if strings.ContainsAny(domain, " /:") && net.ParseIP(domain) == nil {
+			return "", fmt.Errorf("无效的白名单域名: %s", domain)
+		}
+		if strings.Contains(domain, "*") && domain != "*" && (!strings.HasPrefix(domain, "*.") || strings.Count(domain, "*") > 1) {
+			return "", fmt.Errorf("白名单通配符仅支持 *.example.com 形式: %s", domain)
+		}
+		seen[domain] = true
+		normalized = append(normalized, domain)
+	}
+	if len(normalized) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("编码白名单失败: %w", err)
+	}
+	return string(data), nil
+}
+
+/*
+DecodeAllowedDomains 解析隧道存储的目标白名单
+*/
+func DecodeAllowedDomains(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	var domains []string
+	if err := json.Unmarshal([]byte(raw), &domains); err != nil {
+		return nil
+	}
+	return domains
+}
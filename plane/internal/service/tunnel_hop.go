@@ -0,0 +1,103 @@
+package service
+
+import (
+	"fmt"
+
+	"gkipass/plane/internal/db/models"
+
+	"gorm.io/gorm"
+)
+
+/*
+TunnelHopInput 隧道中继跳输入
+功能：创建/更新隧道时提交的有序中继跳，Protocol 为空时沿用隧道的 Protocol
+*/
+type TunnelHopInput struct {
+	GroupID  string `json:"group_id"`
+	NodeID   string `json:"node_id"`
+	Protocol string `json:"protocol"`
+}
+
+/* relayProtocols 可用于节点间跳转的协议（socks5/http 仅用于入口） */
+var relayProtocols = map[models.TunnelProtocol]bool{
+	models.ProtocolTCP:    true,
+	models.ProtocolUDP:    true,
+	models.ProtocolWS:     true,
+	models.ProtocolWSS:    true,
+	models.ProtocolTLS:    true,
+	models.ProtocolTLSMux: true,
+	models.ProtocolKCP:    true,
+	models.ProtocolQUIC:   true,
+}
+
+/*
+replaceTunnelHops 替换隧道的全部中继跳
+功能：校验中继组存在、协议可用于节点间传输、链路中各组互不重复（含入口/出口组），
+然后按顺序重建跳列表
+*/
+func replaceTunnelHops(tx *gorm.DB, tunnel *models.Tunnel, inputs []TunnelHopInput) error {
+	seen := map[string]bool{}
+	if tunnel.IngressGroupID != "" {
+		seen[tunnel.IngressGroupID] = true
+	}
+	if tunnel.EgressGroupID != "" {
+		seen[tunnel.EgressGroupID] = true
+	}
+
+	hops := make([]models.TunnelHop, 0, len(inputs))
+	for i, input := range inputs {
+		position := i + 1
+		if input.GroupID == "" {
+			return fmt.Errorf("第 %d 跳未指定中继节点组", position)
+		}
+		if seen[input.GroupID] {
+			return fmt.Errorf("第 %d 跳的节点组在链路中重复出现", position)
+		}
+		seen[input.GroupID] = true
+
+		var groupCount int64
+		if err := tx.Model(&models.NodeGroup{}).Where("id = ?", input.GroupID).Count(&groupCount).Error; err != nil {
+			return fmt.Errorf("查询中继节点组失败: %w", err)
+		}
+		if groupCount == 0 {
+			return fmt.Errorf("第 %d 跳的节点组不存在: %s", position, input.GroupID)
+		}
+
+		if input.NodeID != "" {
+			var memberCount int64
+			tx.Table("node_group_nodes").
+				Where("group_id = ? AND node_id = ?", input.GroupID, input.NodeID).
+				Count(&memberCount)
+			if memberCount == 0 {
+				return fmt.Errorf("第 %d 跳的节点不属于该节点组", position)
+			}
+		}
+
+		protocol := models.TunnelProtocol(input.Protocol)
+		if protocol == "" {
+			protocol = tunnel.Protocol
+		}
+		if !relayProtocols[protocol] {
+			return fmt.Errorf("第 %d 跳的协议不能用于节点间传输: %s", position, protocol)
+		}
+
+		hops = append(hops, models.TunnelHop{
+			TunnelID: tunnel.ID,
+			Position: position,
+			GroupID:  input.GroupID,
+			NodeID:   input.NodeID,
+			Protocol: protocol,
+		})
+	}
+
+	if err := tx.Unscoped().Where("tunnel_id = ?", tunnel.ID).Delete(&models.TunnelHop{}).Error; err != nil {
+		return fmt.Errorf("删除旧中继跳失败: %w", err)
+	}
+	if len(hops) == 0 {
+		return nil
+	}
+	if err := tx.Create(&hops).Error; err != nil {
+		return fmt.Errorf("保存中继跳失败: %w", err)
+	}
+	return nil
+}
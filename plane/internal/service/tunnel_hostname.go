@@ -0,0 +1,122 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gkipass/plane/internal/db/models"
+)
+
+/*
+encodeHostnames 规范化并编码共享端口路由主机名
+功能：去除空白与末尾点号、统一小写，仅允许合法域名字符和 *.example.com 通配，
+空列表编码为空字符串（独占端口）
+*/
+func encodeHostnames(hostnames []string) (string, error) {
+	normalized := make([]string, 0, len(hostnames))
+	seen := make(map[string]bool, len(hostnames))
+	for _, host := range hostnames {
+		host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+		if host == "" || seen[host] {
+			continue
+		}
+		if err := validateHostname(host); err != nil {
+			return "", err
+		}
+		seen[host] = true
+		normalized = append(normalized, host)
+	}
+	if len(normalized) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("编码主机名失败: %w", err)
+	}
+	return string(data), nil
+}
+
+/*
+DecodeHostnames 解析隧道存储的共享端口路由主机名
+*/
+func DecodeHostnames(raw string) []string {
+	return DecodeAllowedDomains(raw)
+}
+
+/*
+validateHostname 校验单个路由主机名
+功能：SNI 与 Host 只携带域名，不接受端口、路径或 IP 之外的特殊字符；
+通配符只能作为首个标签（*.example.com）
+*/
+func validateHostname(host string) error {
+	name := host
+	if strings.HasPrefix(name, "*.") {
+		name = name[2:]
+	}
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("无效的路由主机名: %s", host)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("无效的路由主机名: %s", host)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				if c == '*' {
+					return fmt.Errorf("路由主机名通配符仅支持 *.example.com 形式: %s", host)
+				}
+				return fmt.Errorf("无效的路由主机名: %s", host)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+validateHostnameIngress 检查入口协议是否支持按主机名路由
+功能：只有首包携带 TLS ClientHello 或 HTTP 请求头的协议才能在共享端口上识别目标隧道
+*/
+func validateHostnameIngress(protocol models.TunnelProtocol) error {
+	switch protocol {
+	case models.ProtocolTCP, models.ProtocolTLS, models.ProtocolWS, models.ProtocolWSS, models.ProtocolHTTP:
+		return nil
+	default:
+		return fmt.Errorf("入口协议 %s 不支持主机名路由（可选 tcp、tls、ws、wss、http）", protocol)
+	}
+}
+
+/*
+checkHostnameConflict 检查入口组内的主机名冲突
+功能：同一入口组内同一主机名只能属于一个启用的隧道，
+excludeTunnelID 排除当前隧道（用于更新场景）
+*/
+func (s *GormTunnelService) checkHostnameConflict(ingressGroupID string, hostnames []string, excludeTunnelID string) error {
+	if ingressGroupID == "" || len(hostnames) == 0 {
+		return nil
+	}
+
+	var tunnels []models.Tunnel
+	query := s.db.Select("id", "name", "hostnames").
+		Where("ingress_group_id = ? AND enabled = ? AND hostnames <> ''", ingressGroupID, true)
+	if excludeTunnelID != "" {
+		query = query.Where("id != ?", excludeTunnelID)
+	}
+	if err := query.Find(&tunnels).Error; err != nil {
+		return fmt.Errorf("检查主机名冲突失败: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(hostnames))
+	for _, host := range hostnames {
+		wanted[host] = true
+	}
+	for _, tunnel := range tunnels {
+		for _, host := range DecodeHostnames(tunnel.Hostnames) {
+			if wanted[host] {
+				return fmt.Errorf("主机名 %s 已被隧道 '%s' 使用", host, tunnel.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"gkipass/plane/internal/pkg/logger"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+/* Redis key 与频道 */
+const (
+	clusterNodeKeyPrefix = "cluster:node:"     /* 节点 → 所在实例 ID，带 TTL */
+	clusterNodesKey      = "cluster:nodes"     /* 全局在线节点表（ZSET，score 为最近登记时间） */
+	clusterChannelPrefix = "cluster:instance:" /* 各实例的消息转发频道 */
+	clusterLogsPrefix    = "cluster:logs:"     /* 各实例的节点日志转发频道（订阅在该实例上） */
+)
+
+const (
+	clusterOnlineInterval = 5 * time.Second /* 全局在线节点回调间隔，小于节点组在线数缓存 TTL */
+	clusterForwardTimeout = 3 * time.Second /* 单次转发查询和发布的超时 */
+)
+
+/* clusterEnvelope 经 Redis 转发到其他实例的节点消息 */
+type clusterEnvelope struct {
+	NodeID  string   `json:"node_id"`
+	Message *Message `json:"message"`
+}
+
+/* clusterLogEnvelope 经 Redis 转发到订阅所在实例的节点日志批次 */
+type clusterLogEnvelope struct {
+	NodeID string          `json:"node_id"`
+	Batch  *LogStreamBatch `json:"batch"`
+}
+
+/*
+Cluster 多实例节点连接协同
+功能：面板多实例部署在负载均衡之后时，每个节点只与其中一个实例保持 WebSocket 连接：
+  - 在线登记：本实例连接的节点写入 Redis（节点 → 实例 ID，带 TTL 定期续期），组成全局在线节点表；
+    实例宕机后其节点在 TTL 到期后自动视为离线
+  - 消息转发：Manager.SendToNode 发往其他实例上的节点时，发布到该实例的频道，由其写入节点连接；
+    转发为单向投递，节点侧的处理结果仍经 sync_ack 等消息回到其所连接的实例
+  - 日志转发：节点推送的日志批次发布到订阅所在实例的日志频道
+  - 在线统计：定期以全局在线节点列表回调 onOnline（刷新节点组在线数缓存）
+
+nil 表示单实例部署，Manager 只投递本实例的连接。
+*/
+type Cluster struct {
+	redis      *redis.Client
+	instanceID string
+	nodeTTL    time.Duration
+	manager    *Manager
+	onOnline   func(nodeIDs []string)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	pubsub *redis.PubSub
+	wg     sync.WaitGroup
+	logger *zap.Logger
+}
+
+/*
+NewCluster 创建多实例协同并挂载到连接管理器
+功能：nodeTTL 为在线登记有效期，默认 90 秒（与死连接检测超时一致）
+*/
+func NewCluster(client *redis.Client, instanceID string, nodeTTL time.Duration, manager *Manager) *Cluster {
+	if nodeTTL <= 0 {
+		nodeTTL = 90 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Cluster{
+		redis:      client,
+		instanceID: instanceID,
+		nodeTTL:    nodeTTL,
+		manager:    manager,
+		ctx:        ctx,
+		cancel:     cancel,
+		logger:     zap.L().Named("ws-cluster").With(zap.String("instance", instanceID)),
+	}
+	manager.cluster = c
+	return c
+}
+
+/* SetOnOnlineNodes 设置全局在线节点回调（如 NodeGroupCache.SyncOnlineCounts），须在 Start 之前调用 */
+func (c *Cluster) SetOnOnlineNodes(fn func(nodeIDs []string)) {
+	c.onOnline = fn
+}
+
+/*
+Start 订阅本实例的转发频道并启动在线登记续期
+功能：订阅确认后才返回，避免启动初期其他实例的转发丢失
+*/
+func (c *Cluster) Start() error {
+	c.pubsub = c.redis.Subscribe(c.ctx, clusterChannelPrefix+c.instanceID, clusterLogsPrefix+c.instanceID)
+	if _, err := c.pubsub.Receive(c.ctx); err != nil {
+		c.pubsub.Close()
+		return fmt.Errorf("订阅实例转发频道失败: %w", err)
+	}
+
+	c.wg.Add(2)
+	go c.receiveLoop()
+	go c.refreshLoop()
+
+	logger.Info("✓ 多实例协同已启用", zap.String("instance", c.instanceID), zap.Duration("nodeTTL", c.nodeTTL))
+	return nil
+}
+
+/*
+Stop 停止协同
+功能：注销本实例登记的节点，使其他实例立即将其视为离线，而不必等待 TTL 到期
+*/
+func (c *Cluster) Stop() {
+	for _, nodeID := range c.manager.GetAllNodeIDs() {
+		c.unregister(nodeID)
+	}
+	c.cancel()
+	if c.pubsub != nil {
+		c.pubsub.Close()
+	}
+	c.wg.Wait()
+}
+
+/* InstanceID 返回当前实例 ID */
+func (c *Cluster) InstanceID() string {
+	return c.instanceID
+}
+
+/*
+OnlineNodeIDs 获取全部实例的在线节点
+功能：只返回有效期内续期过的节点，宕机实例遗留的登记自动排除
+*/
+func (c *Cluster) OnlineNodeIDs() ([]string, error) {
+	minScore := strconv.FormatInt(time.Now().Add(-c.nodeTTL).Unix(), 10)
+	return c.redis.ZRangeByScore(c.ctx, clusterNodesKey, &redis.ZRangeBy{Min: minScore, Max: "+inf"}).Result()
+}
+
+/* Owner 返回节点所连接的实例 ID，节点不在线时返回空串 */
+func (c *Cluster) Owner(nodeID string) (string, error) {
+	owner, err := c.redis.Get(c.ctx, clusterNodeKeyPrefix+nodeID).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return owner, err
+}
+
+/* register 登记本实例连接的节点（节点重连到本实例时覆盖其他实例的旧登记） */
+func (c *Cluster) register(nodeID string) {
+	pipe := c.redis.TxPipeline()
+	pipe.Set(c.ctx, clusterNodeKeyPrefix+nodeID, c.instanceID, c.nodeTTL)
+	pipe.ZAdd(c.ctx, clusterNodesKey, redis.Z{Score: float64(time.Now().Unix()), Member: nodeID})
+	if _, err := pipe.Exec(c.ctx); err != nil && c.ctx.Err() == nil {
+		c.logger.Error("登记在线节点失败", zap.String("nodeID", nodeID), zap.Error(err))
+	}
+}
+
+/*
+unregister 注销本实例连接的节点
+功能：节点已重连到其他实例时登记属于对方，保持不变
+*/
+func (c *Cluster) unregister(nodeID string) {
+	script := `if redis.call("get", KEYS[1]) == ARGV[1] then
+	redis.call("del", KEYS[1])
+	redis.call("zrem", KEYS[2], ARGV[2])
+	return 1
+end
+return 0`
+	if err := c.redis.Eval(c.ctx, script, []string{clusterNodeKeyPrefix + nodeID, clusterNodesKey}, c.instanceID, nodeID).Err(); err != nil && c.ctx.Err() == nil {
+		c.logger.Error("注销在线节点失败", zap.String("nodeID", nodeID), zap.Error(err))
+	}
+}
+
+/* connectedElsewhere 节点当前是否已连接到其他实例（节点重连换实例后，旧实例不应将其标记为离线） */
+func (c *Cluster) connectedElsewhere(nodeID string) bool {
+	owner, err := c.Owner(nodeID)
+	return err == nil && owner != "" && owner != c.instanceID
+}
+
+/*
+forward 将消息转发到节点所在的实例
+功能：节点未登记、登记指向本实例（本地连接已断开）或目标实例未订阅时返回 ErrNodeNotConnected
+*/
+func (c *Cluster) forward(nodeID string, msg *Message) error {
+	ctx, cancel := context.WithTimeout(c.ctx, clusterForwardTimeout)
+	defer cancel()
+
+	owner, err := c.redis.Get(ctx, clusterNodeKeyPrefix+nodeID).Result()
+	if err == redis.Nil || owner == c.instanceID {
+		return ErrNodeNotConnected
+	}
+	if err != nil {
+		return fmt.Errorf("查询节点所在实例失败: %w", err)
+	}
+
+	payload, err := json.Marshal(clusterEnvelope{NodeID: nodeID, Message: msg})
+	if err != nil {
+		return err
+	}
+	receivers, err := c.redis.Publish(ctx, clusterChannelPrefix+owner, payload).Result()
+	if err != nil {
+		return fmt.Errorf("转发消息到实例 %s 失败: %w", owner, err)
+	}
+	if receivers == 0 {
+		return ErrNodeNotConnected
+	}
+	return nil
+}
+
+/* receiveLoop 将其他实例转发来的消息投递到本实例的节点连接，日志批次转交本实例的订阅 */
+func (c *Cluster) receiveLoop() {
+	defer c.wg.Done()
+
+	for msg := range c.pubsub.Channel() {
+		if msg.Channel == clusterLogsPrefix+c.instanceID {
+			c.receiveLogs(msg.Payload)
+			continue
+		}
+
+		var envelope clusterEnvelope
+		if err := json.Unmarshal([]byte(msg.Payload), &envelope); err != nil || envelope.Message == nil {
+			c.logger.Warn("丢弃无法解析的转发消息", zap.Error(err))
+			continue
+		}
+		if err := c.manager.sendLocal(envelope.NodeID, envelope.Message); err != nil {
+			c.logger.Warn("投递转发消息失败",
+				zap.String("nodeID", envelope.NodeID),
+				zap.String("type", string(envelope.Message.Type)),
+				zap.Error(err))
+		}
+	}
+}
+
+/* receiveLogs 转交其他实例转发来的日志批次，订阅已结束时丢弃（节点将在续租过期后停止推送） */
+func (c *Cluster) receiveLogs(payload string) {
+	var envelope clusterLogEnvelope
+	if err := json.Unmarshal([]byte(payload), &envelope); err != nil || envelope.Batch == nil {
+		c.logger.Warn("丢弃无法解析的日志批次", zap.Error(err))
+		return
+	}
+	if c.manager.logStreams != nil {
+		c.manager.logStreams.deliverLocal(envelope.NodeID, envelope.Batch)
+	}
+}
+
+/* forwardLogs 将节点日志批次转发到订阅所在的实例，目标实例未订阅时返回错误 */
+func (c *Cluster) forwardLogs(instanceID, nodeID string, batch *LogStreamBatch) error {
+	ctx, cancel := context.WithTimeout(c.ctx, clusterForwardTimeout)
+	defer cancel()
+
+	payload, err := json.Marshal(clusterLogEnvelope{NodeID: nodeID, Batch: batch})
+	if err != nil {
+		return err
+	}
+	receivers, err := c.redis.Publish(ctx, clusterLogsPrefix+instanceID, payload).Result()
+	if err != nil {
+		return fmt.Errorf("转发日志到实例 %s 失败: %w", instanceID, err)
+	}
+	if receivers == 0 {
+		return fmt.Errorf("实例 %s 未订阅日志频道", instanceID)
+	}
+	return nil
+}
+
+/*
+refreshLoop 定期续期本实例节点的登记，清理过期登记并回调全局在线节点
+功能：续期间隔为 nodeTTL/3，在线回调间隔为 clusterOnlineInterval
+*/
+func (c *Cluster) refreshLoop() {
+	defer c.wg.Done()
+
+	renew := time.NewTicker(c.nodeTTL / 3)
+	defer renew.Stop()
+	online := time.NewTicker(clusterOnlineInterval)
+	defer online.Stop()
+
+	c.notifyOnline()
+	for {
+		select {
+		case <-renew.C:
+			c.renew()
+		case <-online.C:
+			c.notifyOnline()
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+/*
+renew 续期本实例全部节点的登记，并清理已过期的全局在线表条目
+功能：登记已被其他实例覆盖的节点（已重连到对方、本地连接尚未超时断开）不再续期
+*/
+func (c *Cluster) renew() {
+	script := `local owner = redis.call("get", KEYS[1])
+if owner == false or owner == ARGV[1] then
+	redis.call("set", KEYS[1], ARGV[1], "PX", ARGV[2])
+	redis.call("zadd", KEYS[2], ARGV[3], ARGV[4])
+end
+return 0`
+	now := time.Now()
+	pipe := c.redis.Pipeline()
+	for _, nodeID := range c.manager.GetAllNodeIDs() {
+		pipe.Eval(c.ctx, script, []string{clusterNodeKeyPrefix + nodeID, clusterNodesKey},
+			c.instanceID, c.nodeTTL.Milliseconds(), now.Unix(), nodeID)
+	}
+	pipe.ZRemRangeByScore(c.ctx, clusterNodesKey, "-inf", "("+strconv.FormatInt(now.Add(-c.nodeTTL).Unix(), 10))
+	if _, err := pipe.Exec(c.ctx); err != nil && c.ctx.Err() == nil {
+		c.logger.Error("续期在线节点登记失败", zap.Error(err))
+	}
+}
+
+/* notifyOnline 以全局在线节点回调 onOnline */
+func (c *Cluster) notifyOnline() {
+	if c.onOnline == nil {
+		return
+	}
+	nodeIDs, err := c.OnlineNodeIDs()
+	if err != nil {
+		if c.ctx.Err() == nil {
+			c.logger.Error("获取全局在线节点失败", zap.Error(err))
+		}
+		return
+	}
+	c.onOnline(nodeIDs)
+}
@@ -1,17 +1,23 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
 	"gkipass/plane/internal/db/dao"
 	"gkipass/plane/internal/db/models"
+	"gkipass/plane/internal/metrics"
 	"gkipass/plane/internal/modules/node"
 	"gkipass/plane/internal/pkg/logger"
+	"gkipass/plane/internal/pkg/tracing"
 	"gkipass/plane/internal/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -37,10 +43,15 @@ type Handler struct {
 	nodeManager       *node.Manager
 	failoverService   *service.FailoverService
 	monitoringService *service.NodeMonitoringService
+	syncService       *service.GormNodeSyncService
+	commandService    *service.NodeCommandService
+	logStreams        *LogStreamHub
+	healthService     *service.HealthService /* 可为 nil，由 Server.SetHealthService 设置 */
 }
 
 // NewHandler 创建处理器
 func NewHandler(manager *Manager, d *dao.DAO, failoverSvc *service.FailoverService) *Handler {
+	sender := &syncSender{manager: manager}
 	return &Handler{
 		manager:           manager,
 		dao:               d,
@@ -48,6 +59,9 @@ func NewHandler(manager *Manager, d *dao.DAO, failoverSvc *service.FailoverServi
 		nodeManager:       node.NewManager(d),
 		failoverService:   failoverSvc,
 		monitoringService: service.NewNodeMonitoringService(d),
+		syncService:       service.NewGormNodeSyncService(d.DB, sender),
+		commandService:    service.NewNodeCommandService(d.DB, sender),
+		logStreams:        NewLogStreamHub(manager),
 	}
 }
 
@@ -96,6 +110,7 @@ func (h *Handler) HandleConnection(conn *websocket.Conn) {
 	h.manager.register <- nodeConn
 	h.sendRegisterAck(nodeConn, true, "注册成功")
 	go h.sendFullNodeConfig(req.NodeID)
+	go h.syncRulesToNode(req.NodeID, req.RulesVersion)
 	go h.readPump(nodeConn)
 	go h.writePump(nodeConn)
 }
@@ -116,6 +131,9 @@ func (h *Handler) readPump(conn *NodeConnection) {
 			logger.Error("设置读取超时失败", zap.Error(err))
 		}
 		conn.UpdateLastSeen()
+		if enc := h.manager.qualityOf(conn); enc != nil {
+			enc.RecordPong()
+		}
 		return nil
 	})
 
@@ -172,6 +190,9 @@ func (h *Handler) writePump(conn *NodeConnection) {
 			if err := conn.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+			if enc := h.manager.qualityOf(conn); enc != nil {
+				enc.RecordPingSent()
+			}
 		}
 	}
 }
@@ -209,6 +230,18 @@ func (h *Handler) handleMessage(conn *NodeConnection, msg *Message) {
 	case MsgTypeFailoverEvent:
 		h.handleFailoverEvent(conn, msg)
 
+	case MsgTypeSyncAck:
+		h.handleSyncAck(conn, msg)
+
+	case MsgTypeSyncRequest:
+		h.handleSyncRequest(conn, msg)
+
+	case MsgTypeCommandResult:
+		h.handleCommandResult(conn, msg)
+
+	case MsgTypeLogStream:
+		h.handleLogStream(conn, msg)
+
 	case MsgTypePong:
 		// Pong 消息已在 readPump 中处理
 
@@ -280,6 +313,43 @@ func (h *Handler) handleTrafficReport(conn *NodeConnection, msg *Message) {
 			zap.Error(err))
 	}
 
+	/* Counter 不接受负数，异常上报直接忽略 */
+	if req.TrafficIn > 0 {
+		metrics.TrafficBytes.WithLabelValues("in", conn.NodeID).Add(float64(req.TrafficIn))
+	}
+	if req.TrafficOut > 0 {
+		metrics.TrafficBytes.WithLabelValues("out", conn.NodeID).Add(float64(req.TrafficOut))
+	}
+
+	// 隧道指标交给告警规则引擎（按承载节点区分实例）
+	if req.TunnelID != "" {
+		values := map[string]float64{
+			"new_connections": float64(req.Connections),
+			"traffic_in":      float64(req.TrafficIn),
+			"traffic_out":     float64(req.TrafficOut),
+		}
+		if active, ok := req.Details["active_conns"]; ok {
+			values["connections"] = float64(active)
+			metrics.ObserveTunnelConnections(conn.NodeID, req.TunnelID, active)
+		}
+		if len(req.Sources) > 0 {
+			values["source_ips"] = float64(len(req.Sources))
+			for _, source := range req.Sources {
+				logger.Debug("隧道来源流量",
+					zap.String("nodeID", conn.NodeID),
+					zap.String("tunnelID", req.TunnelID),
+					zap.String("source", source.IP),
+					zap.Int64("connections", source.Connections),
+					zap.Int64("bytesIn", source.BytesIn),
+					zap.Int64("bytesOut", source.BytesOut))
+			}
+		}
+		go h.monitoringService.AlertEngine().ObserveTunnel(conn.NodeID, req.TunnelID, values, time.Now())
+
+		// 分批发布中已应用新规则的节点按连接失败率判定是否回滚
+		h.syncService.Rollouts().ObserveTraffic(conn.NodeID, req.TunnelID, int64(req.Connections), req.Details["failed_conns"])
+	}
+
 	// 发送响应
 	resp := &TrafficReportResponse{
 		Success: true,
@@ -411,6 +481,10 @@ func (h *Handler) handleMonitoringReport(conn *NodeConnection, msg *Message) {
 		return
 	}
 
+	if h.healthService != nil {
+		h.healthService.ReportMonitoring(nodeID, reportData)
+	}
+
 	// 发送确认响应
 	resp := gin.H{
 		"success":   true,
@@ -465,65 +539,87 @@ func convertTunnelStatusList(tunnels []TunnelStatusInfo) []service.TunnelStatusI
 	return result
 }
 
-// syncRulesToNode 同步规则到节点
-func (h *Handler) syncRulesToNode(nodeID, groupID, nodeType string) {
+/*
+syncRulesToNode 节点注册后同步规则
+功能：节点上报已应用的规则版本，变更日志可覆盖时只推送差异，否则全量同步，
+避免面板重启后所有节点重连时收到全量规则
+*/
+func (h *Handler) syncRulesToNode(nodeID string, rulesVersion int64) {
 	logger.Info("同步隧道规则到节点",
 		zap.String("nodeID", nodeID),
-		zap.String("groupID", groupID))
+		zap.Int64("rulesVersion", rulesVersion))
 
-	// 获取该节点组的所有隧道
-	tunnels, err := h.gormTunnelSvc.GetTunnelsByGroupID(groupID)
+	ctx, span := tracing.StartKind(context.Background(), "ws.NodeRegisterSync", trace.SpanKindConsumer,
+		attribute.String("gkipass.node.id", nodeID),
+		attribute.Int64("gkipass.sync.since", rulesVersion))
+	err := h.syncService.ResyncNode(ctx, nodeID, rulesVersion)
+	tracing.End(span, err)
 	if err != nil {
-		logger.Error("获取隧道规则失败", zap.Error(err))
-		return
+		logger.Error("同步规则到节点失败",
+			zap.String("nodeID", nodeID),
+			zap.Error(err))
 	}
+}
 
-	// 转换为规则格式
-	rules := make([]TunnelRule, 0, len(tunnels))
-	for _, tunnel := range tunnels {
-		// 构建单个目标
-		wsTargets := []TunnelTarget{
-			{
-				Host:   tunnel.TargetAddress,
-				Port:   tunnel.TargetPort,
-				Weight: 1,
-			},
-		}
-
-		// 根据节点类型选择协议
-		protocol := string(tunnel.IngressProtocol)
-		if nodeType == "egress" || nodeType == "exit" {
-			protocol = string(tunnel.EgressProtocol)
-		}
+/*
+handleSyncAck 处理节点的规则同步确认
+功能：记录节点已应用的版本，作为后续差异推送和重连同步的起点
+*/
+func (h *Handler) handleSyncAck(conn *NodeConnection, msg *Message) {
+	var ack SyncAckRequest
+	if err := msg.ParseData(&ack); err != nil {
+		logger.Error("解析同步确认失败",
+			zap.String("nodeID", conn.NodeID),
+			zap.Error(err))
+		return
+	}
 
-		rule := TunnelRule{
-			TunnelID:  tunnel.ID,
-			Name:      tunnel.Name,
-			Protocol:  protocol,
-			LocalPort: tunnel.ListenPort,
-			Targets:   wsTargets,
-			Enabled:   tunnel.Enabled,
-			UserID:    tunnel.CreatedBy,
-		}
+	/* 节点在确认中携带应用规则时的链路，规则失败会体现在同一条链路上 */
+	_, span := tracing.StartKind(tracing.Extract(context.Background(), msg.Trace), "ws.SyncAck", trace.SpanKindConsumer,
+		attribute.String("gkipass.node.id", conn.NodeID),
+		attribute.Int64("gkipass.sync.version", ack.Version),
+		attribute.Int("gkipass.sync.applied", ack.AppliedCount),
+		attribute.StringSlice("gkipass.sync.failed_rules", ack.FailedRules))
+	defer span.End()
 
-		rules = append(rules, rule)
+	if len(ack.FailedRules) > 0 {
+		span.SetStatus(codes.Error, ack.Message)
+		logger.Warn("节点部分规则应用失败",
+			zap.String("nodeID", conn.NodeID),
+			zap.Int64("version", ack.Version),
+			zap.Strings("failedRules", ack.FailedRules),
+			zap.String("message", ack.Message))
 	}
 
-	// 发送同步请求
-	syncReq := &SyncRulesRequest{
-		Rules: rules,
-		Force: true,
+	if err := h.syncService.AckNodeVersion(conn.NodeID, ack.Version, ack.FailedRules...); err != nil {
+		span.RecordError(err)
+		logger.Error("记录同步确认失败",
+			zap.String("nodeID", conn.NodeID),
+			zap.Error(err))
 	}
+}
 
-	msg, err := NewMessage(MsgTypeSyncRules, syncReq)
-	if err != nil {
-		logger.Error("创建同步消息失败", zap.Error(err))
+/*
+handleSyncRequest 处理节点的增量同步请求
+功能：节点发现收到的增量消息与本地版本之间存在缺口时，请求自本地版本以来的差异
+*/
+func (h *Handler) handleSyncRequest(conn *NodeConnection, msg *Message) {
+	var req SyncRequest
+	if err := msg.ParseData(&req); err != nil {
+		logger.Error("解析同步请求失败",
+			zap.String("nodeID", conn.NodeID),
+			zap.Error(err))
 		return
 	}
 
-	if err := h.manager.SendToNode(nodeID, msg); err != nil {
-		logger.Error("发送同步消息失败",
-			zap.String("nodeID", nodeID),
+	ctx, span := tracing.StartKind(tracing.Extract(context.Background(), msg.Trace), "ws.SyncRequest", trace.SpanKindConsumer,
+		attribute.String("gkipass.node.id", conn.NodeID),
+		attribute.Int64("gkipass.sync.since", req.SinceVersion))
+	err := h.syncService.ResyncNode(ctx, conn.NodeID, req.SinceVersion)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Error("处理同步请求失败",
+			zap.String("nodeID", conn.NodeID),
 			zap.Error(err))
 	}
 }
@@ -600,7 +696,23 @@ func (h *Handler) updateNodeInfo(req *NodeRegisterRequest) error {
 	ndNode.Version = req.Version
 	ndNode.LastOnline = time.Now()
 
-	return h.dao.UpdateNode(ndNode)
+	// 节点CA变化（含首次上报）时，相邻节点的规则需要携带新的证书固定
+	pinChanged := req.CertPin != "" && req.CertPin != ndNode.CertPin
+	if pinChanged {
+		ndNode.CertPin = req.CertPin
+	}
+
+	if err := h.dao.UpdateNode(ndNode); err != nil {
+		return err
+	}
+	if pinChanged && h.syncService != nil {
+		go func() {
+			if err := h.syncService.OnNodeCertPinChanged(context.Background(), req.NodeID); err != nil {
+				logger.Error("同步节点证书固定失败", zap.String("node_id", req.NodeID), zap.Error(err))
+			}
+		}()
+	}
+	return nil
 }
 
 // sendRegisterAck 发送注册确认
@@ -652,7 +764,7 @@ func (h *Handler) NotifyRuleChange(groupID, nodeType string, tunnel *models.Tunn
 
 // getOnlineNodesInGroup 获取组内所有在线节点ID
 func (h *Handler) getOnlineNodesInGroup(groupID string) []string {
-	allNodeIDs := h.manager.GetAllNodeIDs()
+	allNodeIDs := h.manager.OnlineNodeIDs()
 	groupNodeIDs := make([]string, 0)
 
 	if h.dao == nil {
@@ -678,7 +790,7 @@ func (h *Handler) getOnlineNodesInGroup(groupID string) []string {
 
 // syncRulesToAllNodes 同步规则到所有节点
 func (h *Handler) syncRulesToAllNodes() {
-	nodeIDs := h.manager.GetAllNodeIDs()
+	nodeIDs := h.manager.OnlineNodeIDs()
 	for _, nodeID := range nodeIDs {
 		go h.sendFullNodeConfig(nodeID)
 	}
@@ -720,3 +832,39 @@ func (h *Handler) sendFullNodeConfig(nodeID string) {
 		zap.Int("tunnelCount", len(config.Tunnels)),
 		zap.Int("peerCount", len(config.PeerServers)))
 }
+
+/*
+handleCommandResult 处理节点返回的远程命令结果
+功能：按 request_id 更新命令记录，只接受发给该连接节点的命令
+*/
+func (h *Handler) handleCommandResult(conn *NodeConnection, msg *Message) {
+	var result service.NodeCommandResult
+	if err := msg.ParseData(&result); err != nil {
+		logger.Error("解析命令结果失败",
+			zap.String("nodeID", conn.NodeID),
+			zap.Error(err))
+		return
+	}
+
+	if err := h.commandService.Complete(conn.NodeID, &result); err != nil {
+		logger.Error("处理命令结果失败",
+			zap.String("nodeID", conn.NodeID),
+			zap.String("requestID", result.RequestID),
+			zap.Error(err))
+	}
+}
+
+/*
+handleLogStream 处理节点推送的日志批次
+功能：按订阅 ID 转交给订阅方（可能在其他实例），节点只能推送到发给自己的订阅
+*/
+func (h *Handler) handleLogStream(conn *NodeConnection, msg *Message) {
+	var batch LogStreamBatch
+	if err := msg.ParseData(&batch); err != nil {
+		logger.Error("解析日志批次失败",
+			zap.String("nodeID", conn.NodeID),
+			zap.Error(err))
+		return
+	}
+	h.logStreams.Deliver(conn.NodeID, &batch)
+}
@@ -0,0 +1,391 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	logStreamLeaseInterval = 30 * time.Second /* 向节点续租订阅的间隔，节点 90 秒未收到续租即停止推送 */
+	logStreamBuffer        = 64               /* 每个订阅缓存的日志批次数，订阅方读取不及时时丢弃新批次 */
+	logStreamMaxBatch      = 500              /* 单批最多接受的日志条数 */
+	logStreamRateLimit     = 1000             /* 每个订阅每秒最多转交的日志条数 */
+	logStreamMaxPerNode    = 8                /* 单个节点同时存在的订阅数 */
+	logStreamMaxPerUser    = 4                /* 单个用户同时存在的订阅数 */
+)
+
+var (
+	ErrLogStreamNodeLimit = errors.New("该节点的日志订阅数已达上限")
+	ErrLogStreamUserLimit = errors.New("日志订阅数已达上限，请关闭其他日志窗口")
+)
+
+// LogEntry 节点日志条目
+type LogEntry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Logger  string                 `json:"logger,omitempty"`
+	Message string                 `json:"message"`
+	Caller  string                 `json:"caller,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+/* tunnelID 条目关联的隧道（tunnel_id 或 rule_id 字段） */
+func (e *LogEntry) tunnelID() string {
+	for _, key := range []string{"tunnel_id", "rule_id"} {
+		if v, ok := e.Fields[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// LogStreamStart 开始或续租日志订阅（服务器 -> 节点）
+type LogStreamStart struct {
+	StreamID  string   `json:"stream_id"`
+	Level     string   `json:"level,omitempty"`      // 最低级别，空为 info
+	TunnelIDs []string `json:"tunnel_ids,omitempty"` // 只推送关联这些隧道的日志，空为全部
+	Backlog   int      `json:"backlog,omitempty"`    // 首次订阅时先推送的最近日志条数
+}
+
+// LogStreamStop 结束日志订阅（服务器 -> 节点）
+type LogStreamStop struct {
+	StreamID string `json:"stream_id"`
+}
+
+// LogStreamBatch 节点推送的一批日志（节点 -> 服务器）
+type LogStreamBatch struct {
+	StreamID string     `json:"stream_id"`
+	Entries  []LogEntry `json:"entries"`
+	Dropped  int64      `json:"dropped,omitempty"` // 节点侧因限速或缓冲区满丢弃的条数（自上一批起）
+	Error    string     `json:"error,omitempty"`   // 节点拒绝订阅的原因
+}
+
+// LogStreamFilter 日志订阅条件
+type LogStreamFilter struct {
+	Level     string
+	TunnelIDs []string
+	Backlog   int
+}
+
+/*
+LogSubscription 一个日志订阅（通常对应一个浏览器日志窗口）
+功能：C 按批次输出日志；读取不及时或超过速率上限的日志被丢弃并计入 Dropped，节点侧的丢弃也累加在内
+*/
+type LogSubscription struct {
+	ID     string
+	NodeID string
+	UserID string
+	C      <-chan *LogStreamBatch
+
+	ch      chan *LogStreamBatch
+	start   *LogStreamStart
+	tunnels map[string]bool /* 非空时只转交关联这些隧道的条目（节点侧已过滤，这里再校验一次） */
+
+	mu          sync.Mutex
+	dropped     int64
+	windowStart time.Time
+	windowCount int
+	err         string
+}
+
+/* Dropped 累计丢弃的日志条数 */
+func (s *LogSubscription) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+/* Err 节点拒绝订阅时的原因 */
+func (s *LogSubscription) Err() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+/* accept 过滤、限速后投递一批日志，返回是否投递 */
+func (s *LogSubscription) accept(batch *LogStreamBatch) bool {
+	entries := batch.Entries
+	if len(s.tunnels) > 0 {
+		filtered := entries[:0:0]
+		for i := range entries {
+			if s.tunnels[entries[i].tunnelID()] {
+				filtered = append(filtered, entries[i])
+			}
+		}
+		entries = filtered
+	}
+
+	s.mu.Lock()
+	s.dropped += batch.Dropped
+	if batch.Error != "" {
+		s.err = batch.Error
+	}
+	now := time.Now()
+	if now.Sub(s.windowStart) >= time.Second {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	if allowed := logStreamRateLimit - s.windowCount; len(entries) > allowed {
+		if allowed < 0 {
+			allowed = 0
+		}
+		s.dropped += int64(len(entries) - allowed)
+		entries = entries[:allowed]
+	}
+	s.windowCount += len(entries)
+	s.mu.Unlock()
+
+	if len(entries) == 0 && batch.Error == "" {
+		return false
+	}
+
+	select {
+	case s.ch <- &LogStreamBatch{StreamID: s.ID, Entries: entries, Error: batch.Error}:
+		return true
+	default:
+		s.mu.Lock()
+		s.dropped += int64(len(entries))
+		s.mu.Unlock()
+		return false
+	}
+}
+
+/*
+LogStreamHub 节点日志实时订阅
+功能：订阅时向节点下发 log_stream_start，节点按条件推送 log_stream 批次，转交给订阅方：
+  - 订阅定期续租，节点未收到续租（实例宕机、订阅方异常退出）时自行停止推送；
+    节点重连（包括重连到其他实例）后续租消息重新开启推送
+  - 多实例部署时订阅 ID 带有订阅所在实例的前缀，节点连接的实例将批次经 Redis 转发到订阅所在实例
+  - 背压：节点侧限速并在缓冲区满时丢弃；本实例按订阅限速，订阅方读取不及时时丢弃新批次，
+    丢弃条数随后告知订阅方，日志量大的节点不会占满面板内存
+*/
+type LogStreamHub struct {
+	manager *Manager
+
+	mu      sync.RWMutex
+	streams map[string]*LogSubscription
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	logger   *zap.Logger
+}
+
+/*
+NewLogStreamHub 创建日志订阅中心并挂载到连接管理器（接收其他实例转发的批次）
+*/
+func NewLogStreamHub(manager *Manager) *LogStreamHub {
+	h := &LogStreamHub{
+		manager:  manager,
+		streams:  make(map[string]*LogSubscription),
+		stopChan: make(chan struct{}),
+		logger:   zap.L().Named("ws-logstream"),
+	}
+	manager.logStreams = h
+	return h
+}
+
+/* Start 启动续租循环 */
+func (h *LogStreamHub) Start() {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		ticker := time.NewTicker(logStreamLeaseInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.renew()
+			case <-h.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+/* Stop 结束全部订阅 */
+func (h *LogStreamHub) Stop() {
+	h.stopOnce.Do(func() { close(h.stopChan) })
+	h.wg.Wait()
+
+	h.mu.RLock()
+	subs := make([]*LogSubscription, 0, len(h.streams))
+	for _, sub := range h.streams {
+		subs = append(subs, sub)
+	}
+	h.mu.RUnlock()
+	for _, sub := range subs {
+		h.Unsubscribe(sub)
+	}
+}
+
+/*
+Subscribe 订阅节点日志
+功能：节点不在线（本实例和其他实例均未连接）时返回错误；订阅方用完后必须调用 Unsubscribe
+*/
+func (h *LogStreamHub) Subscribe(nodeID, userID string, filter LogStreamFilter) (*LogSubscription, error) {
+	id := uuid.New().String()
+	if h.manager.cluster != nil {
+		id = h.manager.cluster.InstanceID() + "/" + id
+	}
+	ch := make(chan *LogStreamBatch, logStreamBuffer)
+	sub := &LogSubscription{
+		ID:     id,
+		NodeID: nodeID,
+		UserID: userID,
+		C:      ch,
+		ch:     ch,
+		start: &LogStreamStart{
+			StreamID:  id,
+			Level:     filter.Level,
+			TunnelIDs: filter.TunnelIDs,
+			Backlog:   filter.Backlog,
+		},
+	}
+	if len(filter.TunnelIDs) > 0 {
+		sub.tunnels = make(map[string]bool, len(filter.TunnelIDs))
+		for _, tunnelID := range filter.TunnelIDs {
+			sub.tunnels[tunnelID] = true
+		}
+	}
+
+	h.mu.Lock()
+	perNode, perUser := 0, 0
+	for _, s := range h.streams {
+		if s.NodeID == nodeID {
+			perNode++
+		}
+		if s.UserID == userID {
+			perUser++
+		}
+	}
+	if perNode >= logStreamMaxPerNode {
+		h.mu.Unlock()
+		return nil, ErrLogStreamNodeLimit
+	}
+	if perUser >= logStreamMaxPerUser {
+		h.mu.Unlock()
+		return nil, ErrLogStreamUserLimit
+	}
+	h.streams[id] = sub
+	h.mu.Unlock()
+
+	if err := h.send(nodeID, MsgTypeLogStreamStart, sub.start); err != nil {
+		h.remove(id)
+		return nil, fmt.Errorf("节点不在线: %w", err)
+	}
+
+	h.logger.Info("开始订阅节点日志",
+		zap.String("stream_id", id),
+		zap.String("node_id", nodeID),
+		zap.String("user_id", userID),
+		zap.String("level", filter.Level),
+		zap.Strings("tunnel_ids", filter.TunnelIDs))
+	return sub, nil
+}
+
+/* Unsubscribe 结束订阅并通知节点停止推送 */
+func (h *LogStreamHub) Unsubscribe(sub *LogSubscription) {
+	if !h.remove(sub.ID) {
+		return
+	}
+	if err := h.send(sub.NodeID, MsgTypeLogStreamStop, &LogStreamStop{StreamID: sub.ID}); err != nil {
+		h.logger.Debug("通知节点停止日志推送失败（节点将在续租过期后自行停止）",
+			zap.String("stream_id", sub.ID), zap.Error(err))
+	}
+	h.logger.Info("结束订阅节点日志",
+		zap.String("stream_id", sub.ID),
+		zap.String("node_id", sub.NodeID),
+		zap.Int64("dropped", sub.Dropped()))
+}
+
+/*
+Deliver 处理节点推送的日志批次
+功能：订阅在本实例时直接转交；订阅属于其他实例时经 Redis 转发；订阅已不存在时通知节点停止推送
+*/
+func (h *LogStreamHub) Deliver(nodeID string, batch *LogStreamBatch) {
+	if len(batch.Entries) > logStreamMaxBatch {
+		batch.Dropped += int64(len(batch.Entries) - logStreamMaxBatch)
+		batch.Entries = batch.Entries[:logStreamMaxBatch]
+	}
+
+	if h.deliverLocal(nodeID, batch) {
+		return
+	}
+
+	if cluster := h.manager.cluster; cluster != nil {
+		if i := strings.LastIndex(batch.StreamID, "/"); i > 0 {
+			if owner := batch.StreamID[:i]; owner != cluster.InstanceID() {
+				if err := cluster.forwardLogs(owner, nodeID, batch); err == nil {
+					return
+				}
+			}
+		}
+	}
+
+	/* 订阅已结束（订阅方已关闭或实例已重启），让节点停止推送 */
+	if err := h.send(nodeID, MsgTypeLogStreamStop, &LogStreamStop{StreamID: batch.StreamID}); err != nil {
+		h.logger.Debug("通知节点停止日志推送失败", zap.String("stream_id", batch.StreamID), zap.Error(err))
+	}
+}
+
+/* deliverLocal 转交给本实例的订阅，订阅不在本实例时返回 false */
+func (h *LogStreamHub) deliverLocal(nodeID string, batch *LogStreamBatch) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	sub, ok := h.streams[batch.StreamID]
+	if !ok || sub.NodeID != nodeID {
+		return false
+	}
+	sub.accept(batch)
+	return true
+}
+
+/* remove 移除订阅并关闭其输出，订阅不存在时返回 false */
+func (h *LogStreamHub) remove(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub, ok := h.streams[id]
+	if !ok {
+		return false
+	}
+	delete(h.streams, id)
+	close(sub.ch)
+	return true
+}
+
+/* renew 向各订阅的节点续租；节点暂时离线时忽略，重连后由下次续租恢复 */
+func (h *LogStreamHub) renew() {
+	h.mu.RLock()
+	subs := make([]*LogSubscription, 0, len(h.streams))
+	for _, sub := range h.streams {
+		subs = append(subs, sub)
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range subs {
+		renewal := *sub.start
+		renewal.Backlog = 0
+		if err := h.send(sub.NodeID, MsgTypeLogStreamStart, &renewal); err != nil {
+			h.logger.Debug("续租日志订阅失败",
+				zap.String("stream_id", sub.ID),
+				zap.String("node_id", sub.NodeID),
+				zap.Error(err))
+		}
+	}
+}
+
+func (h *LogStreamHub) send(nodeID string, msgType MessageType, data interface{}) error {
+	msg, err := NewMessage(msgType, data)
+	if err != nil {
+		return err
+	}
+	return h.manager.SendToNode(nodeID, msg)
+}
@@ -0,0 +1,133 @@
+package ws
+
+import (
+	"fmt"
+	"testing"
+)
+
+/* setupLogStreamTest 创建带一个本地节点连接 n1 的订阅中心，返回节点的下行消息通道 */
+func setupLogStreamTest(t *testing.T) (*LogStreamHub, chan *Message) {
+	t.Helper()
+	manager := NewManager()
+	send := make(chan *Message, 256)
+	manager.connections["n1"] = &NodeConnection{NodeID: "n1", Send: send, IsAlive: true}
+	return NewLogStreamHub(manager), send
+}
+
+func expectMessage(t *testing.T, send chan *Message, msgType MessageType) *Message {
+	t.Helper()
+	select {
+	case msg := <-send:
+		if msg.Type != msgType {
+			t.Fatalf("节点应收到 %s，实际 %s", msgType, msg.Type)
+		}
+		return msg
+	default:
+		t.Fatalf("节点未收到 %s", msgType)
+		return nil
+	}
+}
+
+func entries(n int, tunnelID string) []LogEntry {
+	list := make([]LogEntry, n)
+	for i := range list {
+		list[i] = LogEntry{Level: "info", Message: fmt.Sprintf("m%d", i), Fields: map[string]interface{}{"tunnel_id": tunnelID}}
+	}
+	return list
+}
+
+/* TestLogStream_SubscribeAndFilter 订阅下发条件，非订阅隧道的日志和其他节点的推送被忽略 */
+func TestLogStream_SubscribeAndFilter(t *testing.T) {
+	hub, send := setupLogStreamTest(t)
+
+	sub, err := hub.Subscribe("n1", "u1", LogStreamFilter{Level: "debug", TunnelIDs: []string{"t1"}, Backlog: 10})
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+	var start LogStreamStart
+	if err := expectMessage(t, send, MsgTypeLogStreamStart).ParseData(&start); err != nil {
+		t.Fatalf("解析订阅消息失败: %v", err)
+	}
+	if start.StreamID != sub.ID || start.Level != "debug" || start.Backlog != 10 || len(start.TunnelIDs) != 1 {
+		t.Errorf("订阅消息内容不符合预期: %+v", start)
+	}
+
+	hub.Deliver("n1", &LogStreamBatch{StreamID: sub.ID, Entries: append(entries(3, "t1"), entries(2, "t2")...)})
+	batch := <-sub.C
+	if len(batch.Entries) != 3 {
+		t.Errorf("只应转交隧道 t1 的 3 条日志，实际 %d 条", len(batch.Entries))
+	}
+
+	/* 其他节点不能向该订阅推送 */
+	hub.Deliver("n2", &LogStreamBatch{StreamID: sub.ID, Entries: entries(1, "t1")})
+	select {
+	case b := <-sub.C:
+		t.Errorf("不应转交其他节点推送的日志: %+v", b)
+	default:
+	}
+
+	hub.Unsubscribe(sub)
+	expectMessage(t, send, MsgTypeLogStreamStop)
+	if _, ok := <-sub.C; ok {
+		t.Errorf("取消订阅后输出通道应关闭")
+	}
+}
+
+/* TestLogStream_Backpressure 订阅方不读取时丢弃新批次并计数，超过速率上限的条目被截断 */
+func TestLogStream_Backpressure(t *testing.T) {
+	hub, send := setupLogStreamTest(t)
+	sub, err := hub.Subscribe("n1", "u1", LogStreamFilter{})
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+	expectMessage(t, send, MsgTypeLogStreamStart)
+
+	/* 单批超过上限的部分被截断，节点侧丢弃数累加 */
+	hub.Deliver("n1", &LogStreamBatch{StreamID: sub.ID, Entries: entries(logStreamMaxBatch+50, ""), Dropped: 7})
+	if got := sub.Dropped(); got != 57 {
+		t.Errorf("丢弃数应为 57，实际 %d", got)
+	}
+
+	/* 1 秒内累计超过速率上限的条目被丢弃 */
+	hub.Deliver("n1", &LogStreamBatch{StreamID: sub.ID, Entries: entries(logStreamMaxBatch, "")})
+	hub.Deliver("n1", &LogStreamBatch{StreamID: sub.ID, Entries: entries(logStreamMaxBatch, "")})
+	if got := sub.Dropped(); got != 57+logStreamMaxBatch {
+		t.Errorf("超过速率上限后丢弃数应为 %d，实际 %d", 57+logStreamMaxBatch, got)
+	}
+
+	/* 缓冲区满后新批次整体丢弃，不阻塞节点消息处理 */
+	for len(sub.C) < logStreamBuffer {
+		sub.accept(&LogStreamBatch{Entries: entries(1, "")})
+		sub.windowCount = 0
+	}
+	before := sub.Dropped()
+	sub.windowCount = 0
+	hub.Deliver("n1", &LogStreamBatch{StreamID: sub.ID, Entries: entries(5, "")})
+	if got := sub.Dropped(); got != before+5 {
+		t.Errorf("缓冲区满时应丢弃整批 5 条，实际丢弃 %d 条", got-before)
+	}
+	hub.Unsubscribe(sub)
+}
+
+/* TestLogStream_UnknownStreamStops 未知订阅的推送让节点停止，订阅数按节点和用户限制 */
+func TestLogStream_UnknownStreamStops(t *testing.T) {
+	hub, send := setupLogStreamTest(t)
+
+	hub.Deliver("n1", &LogStreamBatch{StreamID: "gone", Entries: entries(1, "")})
+	var stop LogStreamStop
+	if err := expectMessage(t, send, MsgTypeLogStreamStop).ParseData(&stop); err != nil || stop.StreamID != "gone" {
+		t.Errorf("应通知节点停止推送未知订阅，实际 %+v（%v）", stop, err)
+	}
+
+	for i := 0; i < logStreamMaxPerUser; i++ {
+		if _, err := hub.Subscribe("n1", "u1", LogStreamFilter{}); err != nil {
+			t.Fatalf("第 %d 个订阅失败: %v", i+1, err)
+		}
+	}
+	if _, err := hub.Subscribe("n1", "u1", LogStreamFilter{}); err != ErrLogStreamUserLimit {
+		t.Errorf("超过用户订阅上限应返回 ErrLogStreamUserLimit，实际 %v", err)
+	}
+	if _, err := hub.Subscribe("n9", "u2", LogStreamFilter{}); err == nil {
+		t.Errorf("节点不在线时订阅应失败")
+	}
+}
@@ -1,12 +1,18 @@
 package ws
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"time"
 
+	"gkipass/plane/internal/metrics"
 	"gkipass/plane/internal/pkg/logger"
+	"gkipass/plane/internal/pkg/tracing"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -30,13 +36,16 @@ func (nc *NodeConnection) closeSend() {
 
 // Manager WebSocket 连接管理器
 type Manager struct {
-	connections    map[string]*NodeConnection // nodeID -> connection
+	connections    map[string]*NodeConnection         // nodeID -> connection
+	quality        map[string]*EnhancedNodeConnection /* nodeID -> 连接质量（Ping/Pong 往返时延与丢包） */
 	register       chan *NodeConnection
 	unregister     chan *NodeConnection
 	broadcast      chan *Message
 	maxConnections int /* 最大连接数限制，0 表示不限制 */
 	stopChan       chan struct{}
 	onDisconnect   func(nodeID string) /* 节点断开回调（可选） */
+	cluster        *Cluster            /* 多实例协同（可选），nil 表示单实例 */
+	logStreams     *LogStreamHub       /* 节点日志订阅，接收其他实例转发的日志批次 */
 	mu             sync.RWMutex
 }
 
@@ -53,6 +62,7 @@ func NewManager(maxConnections ...int) *Manager {
 	}
 	return &Manager{
 		connections:    make(map[string]*NodeConnection),
+		quality:        make(map[string]*EnhancedNodeConnection),
 		register:       make(chan *NodeConnection, 10),
 		unregister:     make(chan *NodeConnection, 10),
 		broadcast:      make(chan *Message, 100),
@@ -85,9 +95,14 @@ func (m *Manager) Run() {
 		select {
 		case conn := <-m.register:
 			m.registerNode(conn)
+			if m.cluster != nil {
+				m.cluster.register(conn.NodeID)
+			}
 
 		case conn := <-m.unregister:
-			m.unregisterNode(conn)
+			if m.unregisterNode(conn) && m.cluster != nil {
+				m.cluster.unregister(conn.NodeID)
+			}
 
 		case msg := <-m.broadcast:
 			m.broadcastMessage(msg)
@@ -115,20 +130,25 @@ func (m *Manager) registerNode(conn *NodeConnection) {
 	}
 
 	m.connections[conn.NodeID] = conn
+	m.quality[conn.NodeID] = newEnhancedNodeConnection(conn)
+	metrics.WSConnections.Set(float64(len(m.connections)))
 
 	logger.Info("节点已连接",
 		zap.String("nodeID", conn.NodeID),
 		zap.Int("totalNodes", len(m.connections)))
 }
 
-// unregisterNode 注销节点
-func (m *Manager) unregisterNode(conn *NodeConnection) {
+// unregisterNode 注销节点，返回节点是否在线
+func (m *Manager) unregisterNode(conn *NodeConnection) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, exists := m.connections[conn.NodeID]; exists {
+	_, exists := m.connections[conn.NodeID]
+	if exists {
 		nodeID := conn.NodeID
 		delete(m.connections, nodeID)
+		delete(m.quality, nodeID)
+		metrics.WSConnections.Set(float64(len(m.connections)))
 		conn.closeSend()
 
 		logger.Info("节点已断开",
@@ -147,10 +167,23 @@ func (m *Manager) unregisterNode(conn *NodeConnection) {
 			}()
 		}
 	}
+	return exists
 }
 
-// SendToNode 发送消息到指定节点
+/*
+SendToNode 发送消息到指定节点
+功能：节点不在本实例且启用了多实例协同时，转发到节点所连接的实例
+*/
 func (m *Manager) SendToNode(nodeID string, msg *Message) error {
+	err := m.sendLocal(nodeID, msg)
+	if err == ErrNodeNotConnected && m.cluster != nil {
+		return m.cluster.forward(nodeID, msg)
+	}
+	return err
+}
+
+// sendLocal 发送消息到本实例连接的节点
+func (m *Manager) sendLocal(nodeID string, msg *Message) error {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -181,6 +214,55 @@ func (m *Manager) SendToGroup(nodeIDs []string, msg *Message) map[string]error {
 	return results
 }
 
+/*
+syncSender 将 Manager 适配为 service.WebSocketSender
+功能：供规则同步服务按消息类型和数据推送，不依赖 ws 包的消息结构；
+每次发送记录一个 producer span，并把其追踪上下文写入消息，节点侧的规则应用作为其子 span
+*/
+type syncSender struct {
+	manager *Manager
+}
+
+func (s *syncSender) SendToNode(ctx context.Context, nodeID string, msgType string, data interface{}) (err error) {
+	ctx, span := tracing.StartKind(ctx, "ws.SendToNode", trace.SpanKindProducer,
+		attribute.String("gkipass.node.id", nodeID),
+		attribute.String("gkipass.message.type", msgType))
+	defer func() { tracing.End(span, err) }()
+
+	msg, err := NewMessage(MessageType(msgType), data)
+	if err != nil {
+		return err
+	}
+	msg.Trace = tracing.Inject(ctx)
+	return s.manager.SendToNode(nodeID, msg)
+}
+
+func (s *syncSender) SendToGroup(ctx context.Context, nodeIDs []string, msgType string, data interface{}) (err error) {
+	ctx, span := tracing.StartKind(ctx, "ws.SendToGroup", trace.SpanKindProducer,
+		attribute.StringSlice("gkipass.node.ids", nodeIDs),
+		attribute.String("gkipass.message.type", msgType))
+	defer func() { tracing.End(span, err) }()
+
+	msg, err := NewMessage(MessageType(msgType), data)
+	if err != nil {
+		return err
+	}
+	msg.Trace = tracing.Inject(ctx)
+	if errs := s.manager.SendToGroup(nodeIDs, msg); len(errs) > 0 {
+		failed := make([]string, 0, len(errs))
+		for nodeID := range errs {
+			failed = append(failed, nodeID)
+		}
+		span.SetAttributes(attribute.StringSlice("gkipass.node.failed_ids", failed))
+		return fmt.Errorf("%d/%d 个节点发送失败", len(errs), len(nodeIDs))
+	}
+	return nil
+}
+
+func (s *syncSender) GetOnlineNodeIDs() []string {
+	return s.manager.OnlineNodeIDs()
+}
+
 // BroadcastToAll 广播消息到所有节点
 func (m *Manager) BroadcastToAll(msg *Message) {
 	m.broadcast <- msg
@@ -210,6 +292,52 @@ func (m *Manager) GetConnection(nodeID string) (*NodeConnection, bool) {
 	return conn, exists
 }
 
+/*
+qualityOf 获取连接对应的质量统计
+功能：同一节点重连后旧连接的读写协程可能仍在运行，只返回与 conn 匹配的记录
+*/
+func (m *Manager) qualityOf(conn *NodeConnection) *EnhancedNodeConnection {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	enc, exists := m.quality[conn.NodeID]
+	if !exists || enc.NodeConnection != conn {
+		return nil
+	}
+	return enc
+}
+
+// GetConnectionInfos 获取所有在线节点的连接质量信息
+func (m *Manager) GetConnectionInfos() []ConnectionInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	infos := make([]ConnectionInfo, 0, len(m.quality))
+	for _, enc := range m.quality {
+		infos = append(infos, enc.GetConnectionInfo())
+	}
+	return infos
+}
+
+/*
+NodeConnectionQuality 实现 metrics.ConnectionQualitySource
+功能：把 WebSocket 连接的往返时延、丢包率和质量评分提供给 Prometheus 导出器
+*/
+func (m *Manager) NodeConnectionQuality() []metrics.NodeConnectionQuality {
+	infos := m.GetConnectionInfos()
+	result := make([]metrics.NodeConnectionQuality, 0, len(infos))
+	for _, info := range infos {
+		result = append(result, metrics.NodeConnectionQuality{
+			NodeID:           info.NodeID,
+			RTT:              info.RTT,
+			PacketLoss:       info.PacketLossRate / 100,
+			QualityScore:     info.QualityScore,
+			MissedHeartbeats: info.MissedHeartbeats,
+		})
+	}
+	return result
+}
+
 // GetAllNodeIDs 获取所有在线节点ID
 func (m *Manager) GetAllNodeIDs() []string {
 	m.mu.RLock()
@@ -223,6 +351,23 @@ func (m *Manager) GetAllNodeIDs() []string {
 	return nodeIDs
 }
 
+/*
+OnlineNodeIDs 获取可投递的在线节点ID
+功能：启用多实例协同时返回全部实例的在线节点（SendToNode 可转发到这些节点），
+查询 Redis 失败时退回本实例的连接
+*/
+func (m *Manager) OnlineNodeIDs() []string {
+	if m.cluster == nil {
+		return m.GetAllNodeIDs()
+	}
+	nodeIDs, err := m.cluster.OnlineNodeIDs()
+	if err != nil {
+		logger.Warn("获取全局在线节点失败，仅使用本实例连接", zap.Error(err))
+		return m.GetAllNodeIDs()
+	}
+	return nodeIDs
+}
+
 // GetNodeCount 获取在线节点数量
 func (m *Manager) GetNodeCount() int {
 	m.mu.RLock()
@@ -304,6 +449,8 @@ func (m *Manager) closeAllConnections() {
 		logger.Info("节点连接已关闭（服务器关闭）", zap.String("nodeID", nodeID))
 	}
 	m.connections = make(map[string]*NodeConnection)
+	m.quality = make(map[string]*EnhancedNodeConnection)
+	metrics.WSConnections.Set(0)
 }
 
 /* Stop 停止管理器 */
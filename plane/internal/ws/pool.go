@@ -51,6 +51,7 @@ type EnhancedNodeConnection struct {
 	// 心跳配置
 	heartbeatInterval atomic.Int64 // 心跳间隔（纳秒）
 	missedHeartbeats  atomic.Int32 // 连续丢失的心跳数
+	pingSentAt        atomic.Int64 // 未收到 Pong 的 Ping 发出时间（UnixNano），0 表示无待响应 Ping
 
 	// 连接状态
 	createdAt      time.Time
@@ -97,16 +98,7 @@ func (cp *ConnectionPool) Add(nodeID string, conn *NodeConnection) (*EnhancedNod
 		cp.currentCount.Add(-1)
 	}
 
-	// 创建增强连接
-	enhanced := &EnhancedNodeConnection{
-		NodeConnection:    conn,
-		createdAt:         time.Now(),
-		heartbeatInterval: atomic.Int64{},
-	}
-	enhanced.heartbeatInterval.Store(int64(30 * time.Second))
-	enhanced.lastActivityAt.Store(time.Now())
-	enhanced.qualityScore.Store(100) // 初始满分
-
+	enhanced := newEnhancedNodeConnection(conn)
 	cp.connections[nodeID] = enhanced
 	cp.currentCount.Add(1)
 	cp.stats.TotalConnections.Add(1)
@@ -119,6 +111,18 @@ func (cp *ConnectionPool) Add(nodeID string, conn *NodeConnection) (*EnhancedNod
 	return enhanced, nil
 }
 
+// newEnhancedNodeConnection 创建增强连接
+func newEnhancedNodeConnection(conn *NodeConnection) *EnhancedNodeConnection {
+	enhanced := &EnhancedNodeConnection{
+		NodeConnection: conn,
+		createdAt:      time.Now(),
+	}
+	enhanced.heartbeatInterval.Store(int64(30 * time.Second))
+	enhanced.lastActivityAt.Store(time.Now())
+	enhanced.qualityScore.Store(100) // 初始满分
+	return enhanced
+}
+
 // Remove 从池中移除连接
 func (cp *ConnectionPool) Remove(nodeID string) {
 	cp.mu.Lock()
@@ -309,6 +313,26 @@ func (enc *EnhancedNodeConnection) RecordPacket(lost bool) {
 	enc.updateQualityScore()
 }
 
+// RecordPingSent 记录发出 Ping，上一个 Ping 仍未收到 Pong 时计为一次丢包
+func (enc *EnhancedNodeConnection) RecordPingSent() {
+	if enc.pingSentAt.Swap(time.Now().UnixNano()) != 0 {
+		enc.missedHeartbeats.Add(1)
+		enc.RecordPacket(true)
+	}
+}
+
+// RecordPong 收到 Pong，按对应 Ping 的发出时间计算往返时延
+func (enc *EnhancedNodeConnection) RecordPong() {
+	sentAt := enc.pingSentAt.Swap(0)
+	if sentAt == 0 {
+		return
+	}
+	enc.missedHeartbeats.Store(0)
+	enc.RecordActivity()
+	enc.RecordRTT(time.Since(time.Unix(0, sentAt)))
+	enc.RecordPacket(false)
+}
+
 // RecordTraffic 记录流量
 func (enc *EnhancedNodeConnection) RecordTraffic(bytesIn, bytesOut int64) {
 	enc.bytesIn.Add(bytesIn)
@@ -31,6 +31,19 @@ const (
 	// 服务器 -> 节点：容灾事件确认
 	MsgTypeFailoverEventAck MessageType = "failover_event_ack" // 确认收到容灾事件
 
+	// 节点 -> 服务器：规则同步确认与补发请求
+	MsgTypeSyncAck     MessageType = "sync_ack"     // 确认已应用的规则版本
+	MsgTypeSyncRequest MessageType = "sync_request" // 请求自指定版本以来的差异（发现版本缺口时）
+
+	// 远程命令：服务器下发白名单命令，节点按 request_id 返回结果
+	MsgTypeCommand       MessageType = "command"        // 服务器 -> 节点
+	MsgTypeCommandResult MessageType = "command_result" // 节点 -> 服务器
+
+	// 日志实时订阅：服务器开始/续租、结束订阅，节点按订阅推送日志批次
+	MsgTypeLogStreamStart MessageType = "log_stream_start" // 服务器 -> 节点
+	MsgTypeLogStreamStop  MessageType = "log_stream_stop"  // 服务器 -> 节点
+	MsgTypeLogStream      MessageType = "log_stream"       // 节点 -> 服务器
+
 	// 双向
 	MsgTypePong  MessageType = "pong"  // Pong
 	MsgTypeError MessageType = "error" // 错误消息
@@ -38,22 +51,25 @@ const (
 
 // Message WebSocket 消息结构
 type Message struct {
-	Type      MessageType     `json:"type"`
-	Timestamp time.Time       `json:"timestamp"`
-	Data      json.RawMessage `json:"data"`
+	Type      MessageType       `json:"type"`
+	Timestamp time.Time         `json:"timestamp"`
+	Data      json.RawMessage   `json:"data"`
+	Trace     map[string]string `json:"trace,omitempty"` // 链路追踪上下文（W3C traceparent），规则同步消息及节点的确认/补发请求携带
 }
 
 // NodeRegisterRequest 节点注册请求
 type NodeRegisterRequest struct {
-	NodeID       string          `json:"node_id"`      // 节点ID
-	NodeName     string          `json:"node_name"`    // 节点名称
-	NodeType     string          `json:"node_type"`    // entry/exit
-	GroupID      string          `json:"group_id"`     // 节点组ID
-	Version      string          `json:"version"`      // 节点版本
-	IP           string          `json:"ip"`           // 节点IP
-	Port         int             `json:"port"`         // 节点端口
-	CK           string          `json:"ck"`           // Connection Key
-	Capabilities map[string]bool `json:"capabilities"` // 节点能力
+	NodeID       string          `json:"node_id"`       // 节点ID
+	NodeName     string          `json:"node_name"`     // 节点名称
+	NodeType     string          `json:"node_type"`     // entry/exit
+	GroupID      string          `json:"group_id"`      // 节点组ID
+	Version      string          `json:"version"`       // 节点版本
+	IP           string          `json:"ip"`            // 节点IP
+	Port         int             `json:"port"`          // 节点端口
+	CK           string          `json:"ck"`            // Connection Key
+	Capabilities map[string]bool `json:"capabilities"`  // 节点能力
+	RulesVersion int64           `json:"rules_version"` // 节点已应用的规则版本（0 表示无本地规则，需全量同步）
+	CertPin      string          `json:"cert_pin"`      // 节点CA公钥固定（SPKI SHA-256）
 }
 
 // NodeRegisterResponse 节点注册响应
@@ -89,6 +105,15 @@ type TrafficReportRequest struct {
 	TrafficOut  int64            `json:"traffic_out"`       // 出站流量(bytes)
 	Connections int              `json:"connections"`       // 连接数
 	Details     map[string]int64 `json:"details,omitempty"` // 详细统计
+	Sources     []TrafficSource  `json:"sources,omitempty"` // 按真实来源 IP 的增量
+}
+
+// TrafficSource 单个真实来源 IP 的流量增量（节点经 PROXY 头解析得到，超出跟踪上限的来源合并为 "other"）
+type TrafficSource struct {
+	IP          string `json:"ip"`
+	Connections int64  `json:"connections"`
+	BytesIn     int64  `json:"bytes_in"`
+	BytesOut    int64  `json:"bytes_out"`
 }
 
 // TrafficReportResponse 流量上报响应
@@ -130,6 +155,20 @@ type SyncRulesResponse struct {
 	Message      string   `json:"message,omitempty"`
 }
 
+// SyncAckRequest 规则同步确认
+type SyncAckRequest struct {
+	Version      int64    `json:"version"` // 已应用到的规则版本
+	Success      bool     `json:"success"`
+	AppliedCount int      `json:"applied_count"`
+	FailedRules  []string `json:"failed_rules,omitempty"`
+	Message      string   `json:"message,omitempty"`
+}
+
+// SyncRequest 增量同步请求
+type SyncRequest struct {
+	SinceVersion int64 `json:"since_version"` // 节点当前已应用的版本
+}
+
 // DeleteRuleRequest 删除规则请求
 type DeleteRuleRequest struct {
 	TunnelID string `json:"tunnel_id"`
@@ -2,6 +2,7 @@ package ws
 
 import (
 	"net/http"
+	"time"
 
 	"gkipass/plane/internal/db/dao"
 	"gkipass/plane/internal/db/models"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
@@ -49,6 +51,11 @@ func NewServer(d *dao.DAO, maxConnections int, failoverSvc ...*service.FailoverS
 	/* 注册节点断开回调：自动将节点状态标记为 offline */
 	if d != nil {
 		manager.SetOnDisconnect(func(nodeID string) {
+			/* 多实例部署时节点可能已重连到其他实例，此时不标记离线 */
+			if manager.cluster != nil && manager.cluster.connectedElsewhere(nodeID) {
+				logger.Info("节点已连接到其他实例，跳过离线标记", zap.String("nodeID", nodeID))
+				return
+			}
 			if err := d.DB.Model(&models.Node{}).Where("id = ?", nodeID).
 				Update("status", "offline").Error; err != nil {
 				logger.Error("自动标记节点离线失败",
@@ -68,6 +75,7 @@ func NewServer(d *dao.DAO, maxConnections int, failoverSvc ...*service.FailoverS
 // Start 启动服务器
 func (s *Server) Start() {
 	go s.manager.Run()
+	s.handler.logStreams.Start()
 	logger.Info("✓ WebSocket 服务器已启动")
 }
 
@@ -95,10 +103,26 @@ func (s *Server) HandleWebSocket(c *gin.Context) {
 
 /* Stop 停止 WebSocket 服务器，关闭所有节点连接 */
 func (s *Server) Stop() {
+	s.handler.logStreams.Stop()
 	s.manager.Stop()
 	logger.Info("WebSocket 服务器已停止")
 }
 
+/*
+EnableCluster 启用多实例协同
+功能：节点在线登记和跨实例消息转发经 Redis 完成，onOnline 定期接收全部实例的在线节点（可为 nil）。
+须在 Start 之前调用；返回的 Cluster 由调用方在 Server.Stop 之前 Stop
+*/
+func (s *Server) EnableCluster(client *redis.Client, instanceID string, nodeTTL time.Duration, onOnline func(nodeIDs []string)) (*Cluster, error) {
+	cluster := NewCluster(client, instanceID, nodeTTL, s.manager)
+	cluster.SetOnOnlineNodes(onOnline)
+	if err := cluster.Start(); err != nil {
+		s.manager.cluster = nil
+		return nil, err
+	}
+	return cluster, nil
+}
+
 // GetManager 获取管理器（用于外部调用）
 func (s *Server) GetManager() *Manager {
 	return s.manager
@@ -109,10 +133,35 @@ func (s *Server) GetHandler() *Handler {
 	return s.handler
 }
 
+// GetSyncService 获取规则同步服务（供隧道 API 在变更后触发同步）
+func (s *Server) GetSyncService() *service.GormNodeSyncService {
+	return s.handler.syncService
+}
+
+// GetCommandService 获取节点远程命令服务
+func (s *Server) GetCommandService() *service.NodeCommandService {
+	return s.handler.commandService
+}
+
+// GetLogStreams 获取节点日志订阅中心
+func (s *Server) GetLogStreams() *LogStreamHub {
+	return s.handler.logStreams
+}
+
+// SetHealthService 设置节点健康服务，节点上报的监控数据同时用于健康判定
+func (s *Server) SetHealthService(health *service.HealthService) {
+	s.handler.healthService = health
+}
+
 // GetStats 获取统计信息
 func (s *Server) GetStats() map[string]interface{} {
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"online_nodes": s.manager.GetNodeCount(),
 		"node_ids":     s.manager.GetAllNodeIDs(),
 	}
+	if cluster := s.manager.cluster; cluster != nil {
+		stats["instance_id"] = cluster.InstanceID()
+		stats["cluster_node_ids"] = s.manager.OnlineNodeIDs()
+	}
+	return stats
 }